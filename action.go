@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"slices"
 	"strings"
 
 	"github.com/davidroman0O/gostage/store"
@@ -58,7 +59,8 @@ type StageState struct {
 // ActionContext provides access to the workflow environment.
 // It is passed to an Action's Execute method and provides access to
 // the workflow, stage, logger, and various utilities for
-// dynamic action and stage management.
+// dynamic action and stage management. The runner reuses it once the stage
+// finishes, so actions must not keep it after they return.
 type ActionContext struct {
 	// GoContext is the embedded Go context
 	GoContext context.Context
@@ -68,12 +70,15 @@ type ActionContext struct {
 	Stage    *Stage
 	Action   Action
 
-	// Logger for output and debugging
-	Logger Logger
+	// Logger for output and debugging; Logger.With adds structured fields
+	Logger FieldLogger
 
 	// Dynamically generated actions (will be inserted after the current action)
 	dynamicActions []Action
 
+	// Placements of the dynamic actions added with AddDynamicActionAt
+	dynamicActionPlacements []Placement
+
 	// Dynamically generated stages (will be inserted after the current stage)
 	dynamicStages []*Stage
 
@@ -83,14 +88,39 @@ type ActionContext struct {
 	// Track stages to disable
 	disabledStages map[string]bool
 
+	// Result set by the current action, recorded when it succeeds
+	result *ActionResult
+
 	// Information about the action's position in execution
 	ActionIndex  int
 	IsLastAction bool
+
+	// Iteration is the number of the current iteration of a loop stage, zero otherwise
+	Iteration int
+
+	// PrimaryError is the error of the failed action a fallback runs for, nil otherwise
+	PrimaryError error
+
+	// Heartbeats of the current action, tracked when the runner has a watchdog
+	watch *actionWatch
 }
 
-// Store returns the workflow's key-value store for data access
+// Store returns the workflow's key-value store for data access. Actions get
+// a view of it enforcing its access policy with their tags, if it has one, and
+// read-only for actions tagged with TagReadOnly.
 func (ctx *ActionContext) Store() *store.KVStore {
-	return ctx.Workflow.Store
+	s := ctx.Workflow.Store
+	if ctx.Action == nil {
+		return s
+	}
+	tags := ctx.Action.Tags()
+	if s.HasAccessPolicy() {
+		s = s.AccessAs(tags...)
+	}
+	if slices.Contains(tags, TagReadOnly) {
+		s = s.ReadOnlyView()
+	}
+	return s
 }
 
 // It's recommended that custom actions embed this struct to handle common properties.
@@ -98,6 +128,17 @@ type BaseAction struct {
 	name        string
 	description string
 	tags        []string
+
+	// registryID and params record how the action was built by an ActionRegistry,
+	// so the action can be serialized back to an ActionDef
+	registryID string
+	params     map[string]interface{}
+
+	// limits constrains the child process running the action when its stage is spawned
+	limits ResourceLimits
+
+	// annotations holds arbitrary key/value metadata set with SetAnnotation
+	annotations map[string]string
 }
 
 // GetActionBaseFields uses reflection to access BaseAction fields from any Action.
@@ -107,6 +148,11 @@ func GetActionBaseFields(action Action) *BaseAction {
 		return nil
 	}
 
+	// Actions embedding BaseAction find it without reflection
+	if embedded, ok := action.(interface{ baseAction() *BaseAction }); ok {
+		return embedded.baseAction()
+	}
+
 	// Use reflection to find embedded BaseAction
 	val := reflect.ValueOf(action)
 	if val.Kind() == reflect.Ptr {
@@ -134,11 +180,21 @@ func GetActionBaseFields(action Action) *BaseAction {
 		if fieldType.Type == reflect.TypeOf(&BaseAction{}) && !field.IsNil() {
 			return field.Interface().(*BaseAction)
 		}
+
+		// Wrappers that embed the Action interface expose the wrapped action's fields
+		if fieldType.Anonymous && fieldType.Type == reflect.TypeOf((*Action)(nil)).Elem() && !field.IsNil() {
+			return GetActionBaseFields(field.Interface().(Action))
+		}
 	}
 
 	return nil
 }
 
+// baseAction returns the BaseAction embedded in an action.
+func (a *BaseAction) baseAction() *BaseAction {
+	return a
+}
+
 // NewBaseAction creates a new BaseAction with a name and description.
 func NewBaseAction(name, description string) BaseAction {
 	return BaseAction{
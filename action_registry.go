@@ -1,32 +1,166 @@
 package gostage
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
 
 // ActionFactory is a function that creates a new instance of an Action.
 // It's used by the registry to instantiate actions from their IDs.
 type ActionFactory func() Action
 
-var (
-	actionRegistry = make(map[string]ActionFactory)
-)
+// ActionParamsFactory is a function that creates a new instance of an Action
+// from the parameters supplied by a definition.
+type ActionParamsFactory func(params map[string]interface{}) (Action, error)
+
+// ActionRegistry maps action IDs to the factories that construct them.
+// It is the resolver used by the definition loader and the serialization layer
+// to instantiate actions by their string name.
+type ActionRegistry struct {
+	mu        sync.RWMutex
+	factories map[string]ActionParamsFactory
+}
+
+// NewActionRegistry creates an empty action registry.
+func NewActionRegistry() *ActionRegistry {
+	return &ActionRegistry{
+		factories: make(map[string]ActionParamsFactory),
+	}
+}
+
+var defaultActionRegistry = NewActionRegistry()
+
+// DefaultActionRegistry returns the process-wide registry used by RegisterAction.
+func DefaultActionRegistry() *ActionRegistry {
+	return defaultActionRegistry
+}
+
+// Register adds a factory that ignores definition parameters.
+// It returns an error if an action with the same ID is already registered.
+func (r *ActionRegistry) Register(id string, factory ActionFactory) error {
+	return r.RegisterWithParams(id, func(map[string]interface{}) (Action, error) {
+		return factory(), nil
+	})
+}
+
+// RegisterWithParams adds a factory that receives the raw definition parameters.
+// It returns an error if an action with the same ID is already registered.
+func (r *ActionRegistry) RegisterWithParams(id string, factory ActionParamsFactory) error {
+	if id == "" {
+		return fmt.Errorf("action id cannot be empty")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.factories[id]; exists {
+		return fmt.Errorf("action with id '%s' is already registered", id)
+	}
+	r.factories[id] = factory
+	return nil
+}
+
+// RegisterTyped adds a factory whose parameters are decoded into P.
+// Definition parameters are converted through JSON, so P can use json struct tags.
+func RegisterTyped[P any](r *ActionRegistry, id string, factory func(params P) (Action, error)) error {
+	return r.RegisterWithParams(id, func(raw map[string]interface{}) (Action, error) {
+		var params P
+		if raw != nil {
+			data, err := json.Marshal(raw)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode params for action '%s': %w", id, err)
+			}
+			if err := json.Unmarshal(data, &params); err != nil {
+				return nil, fmt.Errorf("failed to decode params for action '%s': %w", id, err)
+			}
+		}
+		return factory(params)
+	})
+}
+
+// Resolve creates a new Action instance for the given ID and parameters.
+// It returns an error if the action ID is not found.
+func (r *ActionRegistry) Resolve(id string, params map[string]interface{}) (Action, error) {
+	r.mu.RLock()
+	factory, ok := r.factories[id]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("action with id '%s' not found in registry", id)
+	}
+
+	action, err := factory(params)
+	if err != nil {
+		return nil, err
+	}
+	if action == nil {
+		return nil, fmt.Errorf("factory for action '%s' returned nil", id)
+	}
+
+	// Remember the origin of the action so it can be serialized by ID later
+	if base := GetActionBaseFields(action); base != nil {
+		base.registryID = id
+		base.params = copyParams(params)
+	}
+	return action, nil
+}
+
+// copyParams returns a shallow copy of params, or nil if params is empty.
+func copyParams(params map[string]interface{}) map[string]interface{} {
+	if len(params) == 0 {
+		return nil
+	}
+	out := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		out[k] = v
+	}
+	return out
+}
+
+// Has checks if an action ID is registered.
+func (r *ActionRegistry) Has(id string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.factories[id]
+	return ok
+}
+
+// IDs returns the registered action IDs in sorted order.
+func (r *ActionRegistry) IDs() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ids := make([]string, 0, len(r.factories))
+	for id := range r.factories {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
 
 // RegisterAction registers an action factory with a unique ID.
 // This function should be called at application startup for all actions
 // that might be executed in a child process.
 // It will panic if an action with the same ID is already registered.
 func RegisterAction(id string, factory ActionFactory) {
-	if _, exists := actionRegistry[id]; exists {
-		panic(fmt.Sprintf("action with id '%s' is already registered", id))
+	if err := defaultActionRegistry.Register(id, factory); err != nil {
+		panic(err.Error())
+	}
+}
+
+// RegisterTypedAction registers an action factory whose parameters are decoded into P
+// in the default registry.
+// It will panic if an action with the same ID is already registered.
+func RegisterTypedAction[P any](id string, factory func(params P) (Action, error)) {
+	if err := RegisterTyped(defaultActionRegistry, id, factory); err != nil {
+		panic(err.Error())
 	}
-	actionRegistry[id] = factory
 }
 
 // NewActionFromRegistry creates a new Action instance from the registry using its ID.
 // It returns an error if the action ID is not found.
 func NewActionFromRegistry(id string) (Action, error) {
-	factory, ok := actionRegistry[id]
-	if !ok {
-		return nil, fmt.Errorf("action with id '%s' not found in registry", id)
-	}
-	return factory(), nil
+	return defaultActionRegistry.Resolve(id, nil)
 }
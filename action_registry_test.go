@@ -0,0 +1,69 @@
+package gostage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type httpGetParams struct {
+	URL     string `json:"url"`
+	Retries int    `json:"retries"`
+}
+
+type httpGetAction struct {
+	BaseAction
+	params httpGetParams
+}
+
+func (a *httpGetAction) Execute(ctx *ActionContext) error {
+	return ctx.Store().Put("fetched", a.params.URL)
+}
+
+func TestActionRegistryResolve(t *testing.T) {
+	registry := NewActionRegistry()
+
+	require.NoError(t, registry.Register("noop", func() Action {
+		return NewTestAction("noop", "does nothing", nil)
+	}))
+	require.NoError(t, RegisterTyped(registry, "http-get", func(p httpGetParams) (Action, error) {
+		return &httpGetAction{BaseAction: NewBaseAction("http-get", "GET a URL"), params: p}, nil
+	}))
+
+	assert.Error(t, registry.Register("noop", func() Action { return nil }), "duplicate IDs are rejected")
+	assert.Equal(t, []string{"http-get", "noop"}, registry.IDs())
+	assert.True(t, registry.Has("noop"))
+
+	action, err := registry.Resolve("http-get", map[string]interface{}{"url": "https://example.com", "retries": 3})
+	require.NoError(t, err)
+	httpGet := action.(*httpGetAction)
+	assert.Equal(t, "https://example.com", httpGet.params.URL)
+	assert.Equal(t, 3, httpGet.params.Retries)
+
+	_, err = registry.Resolve("http-get", map[string]interface{}{"retries": "many"})
+	assert.ErrorContains(t, err, "failed to decode params")
+
+	_, err = registry.Resolve("missing", nil)
+	assert.ErrorContains(t, err, "not found in registry")
+}
+
+func TestWorkflowFromDefWithRegistry(t *testing.T) {
+	registry := NewActionRegistry()
+	require.NoError(t, RegisterTyped(registry, "http-get", func(p httpGetParams) (Action, error) {
+		return &httpGetAction{BaseAction: NewBaseAction("http-get", "GET a URL"), params: p}, nil
+	}))
+
+	wf, err := NewWorkflowFromDefWithRegistry(&SubWorkflowDef{
+		ID: "fetch",
+		Stages: []StageDef{{
+			ID:      "s1",
+			Actions: []ActionDef{{ID: "http-get", Params: map[string]interface{}{"url": "https://example.com/manifest"}}},
+		}},
+	}, registry)
+	require.NoError(t, err)
+
+	result := RunWorkflow(wf, DefaultRunOptions())
+	require.NoError(t, result.Error)
+	assert.Equal(t, "https://example.com/manifest", result.FinalStore["fetched"])
+}
@@ -0,0 +1,312 @@
+// Package exec provides an action that runs an external command.
+//
+// The command, its arguments, its environment and its working directory are
+// rendered as templates against the workflow store before the command starts,
+// so earlier actions can decide what runs:
+//
+//	deploy := exec.New("deploy", "kubectl",
+//		exec.WithArgs("rollout", "restart", "deployment/{{ .store.service }}"),
+//		exec.WithEnv("KUBECONFIG", "{{ .store.kubeconfig }}"),
+//		exec.WithTimeout(2*time.Minute),
+//		exec.CaptureStdout("deploy.output"),
+//	)
+//
+// A command exiting with a code other than zero, or than the codes allowed
+// with AllowExitCodes, fails the action with an *ExitError, or with the error
+// mapped to that code with MapExitCode.
+package exec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	osexec "os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+)
+
+// ActionID is the ID under which Register adds the command action to a registry.
+const ActionID = "exec.command"
+
+// ExitError is returned when a command exits with a code that is not allowed.
+type ExitError struct {
+	// Command is the rendered command that ran
+	Command string
+	// Code is the exit code of the command
+	Code int
+	// Stderr is what the command wrote to its standard error
+	Stderr string
+}
+
+func (e *ExitError) Error() string {
+	msg := fmt.Sprintf("command '%s' exited with code %d", e.Command, e.Code)
+	if stderr := strings.TrimSpace(e.Stderr); stderr != "" {
+		msg += ": " + stderr
+	}
+	return msg
+}
+
+// CommandAction runs an external command and records its outcome in the store.
+type CommandAction struct {
+	gostage.BaseAction
+
+	command      string
+	args         []string
+	env          map[string]string
+	dir          string
+	timeout      time.Duration
+	stdoutKey    string
+	stderrKey    string
+	exitCodeKey  string
+	allowedCodes map[int]bool
+	exitErrors   map[int]error
+}
+
+// Option configures a CommandAction.
+type Option func(*CommandAction)
+
+// WithArgs sets the arguments of the command. Each one is rendered as a template.
+func WithArgs(args ...string) Option {
+	return func(a *CommandAction) {
+		a.args = append(a.args, args...)
+	}
+}
+
+// WithEnv adds a variable to the environment of the command, which otherwise
+// inherits the environment of the process. The value is rendered as a template.
+func WithEnv(key, value string) Option {
+	return func(a *CommandAction) {
+		a.env[key] = value
+	}
+}
+
+// WithDir sets the working directory of the command. It is rendered as a template.
+func WithDir(dir string) Option {
+	return func(a *CommandAction) {
+		a.dir = dir
+	}
+}
+
+// WithTimeout kills the command if it runs longer than timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(a *CommandAction) {
+		a.timeout = timeout
+	}
+}
+
+// CaptureStdout stores the standard output of the command under key, without
+// its trailing newlines.
+func CaptureStdout(key string) Option {
+	return func(a *CommandAction) {
+		a.stdoutKey = key
+	}
+}
+
+// CaptureStderr stores the standard error of the command under key, without
+// its trailing newlines.
+func CaptureStderr(key string) Option {
+	return func(a *CommandAction) {
+		a.stderrKey = key
+	}
+}
+
+// CaptureExitCode stores the exit code of the command under key.
+func CaptureExitCode(key string) Option {
+	return func(a *CommandAction) {
+		a.exitCodeKey = key
+	}
+}
+
+// AllowExitCodes makes the action succeed when the command exits with one of
+// codes. Zero is always allowed.
+func AllowExitCodes(codes ...int) Option {
+	return func(a *CommandAction) {
+		for _, code := range codes {
+			a.allowedCodes[code] = true
+		}
+	}
+}
+
+// MapExitCode fails the action with an error wrapping err when the command
+// exits with code, so that callers can match it with errors.Is.
+func MapExitCode(code int, err error) Option {
+	return func(a *CommandAction) {
+		a.exitErrors[code] = err
+	}
+}
+
+// New creates an action named name that runs command.
+func New(name, command string, opts ...Option) *CommandAction {
+	a := &CommandAction{
+		BaseAction:   gostage.NewBaseAction(name, "Runs "+command),
+		command:      command,
+		env:          make(map[string]string),
+		allowedCodes: map[int]bool{0: true},
+		exitErrors:   make(map[int]error),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Execute renders the command and runs it.
+func (a *CommandAction) Execute(ctx *gostage.ActionContext) error {
+	command, err := ctx.Render(a.command)
+	if err != nil {
+		return fmt.Errorf("failed to render command: %w", err)
+	}
+	args := make([]string, len(a.args))
+	for i, arg := range a.args {
+		if args[i], err = ctx.Render(arg); err != nil {
+			return fmt.Errorf("failed to render argument %d: %w", i, err)
+		}
+	}
+	dir, err := ctx.Render(a.dir)
+	if err != nil {
+		return fmt.Errorf("failed to render working directory: %w", err)
+	}
+	env, err := a.renderEnv(ctx)
+	if err != nil {
+		return err
+	}
+
+	runCtx := ctx.GoContext
+	if runCtx == nil {
+		runCtx = context.Background()
+	}
+	if a.timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(runCtx, a.timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := osexec.CommandContext(runCtx, command, args...)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Children keeping the output pipes open must not block the action after a kill
+	cmd.WaitDelay = time.Second
+
+	ctx.Logger.Debug("Running command %s %s", command, strings.Join(args, " "))
+	runErr := cmd.Run()
+
+	code := cmd.ProcessState.ExitCode()
+	if err := a.capture(ctx, stdout.String(), stderr.String(), code); err != nil {
+		return err
+	}
+
+	if runErr != nil {
+		if a.timeout > 0 && errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("command '%s' timed out after %s", command, a.timeout)
+		}
+		var exitErr *osexec.ExitError
+		if !errors.As(runErr, &exitErr) || code < 0 {
+			return fmt.Errorf("failed to run command '%s': %w", command, runErr)
+		}
+	}
+
+	if a.allowedCodes[code] {
+		return nil
+	}
+	if mapped, ok := a.exitErrors[code]; ok {
+		return fmt.Errorf("command '%s' exited with code %d: %w", command, code, mapped)
+	}
+	return &ExitError{Command: command, Code: code, Stderr: stderr.String()}
+}
+
+// renderEnv returns the environment of the process with the action's variables added.
+func (a *CommandAction) renderEnv(ctx *gostage.ActionContext) ([]string, error) {
+	if len(a.env) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, 0, len(a.env))
+	for key := range a.env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	env := os.Environ()
+	for _, key := range keys {
+		value, err := ctx.Render(a.env[key])
+		if err != nil {
+			return nil, fmt.Errorf("failed to render environment variable %s: %w", key, err)
+		}
+		env = append(env, key+"="+value)
+	}
+	return env, nil
+}
+
+// capture records the output and exit code of the command in the store.
+func (a *CommandAction) capture(ctx *gostage.ActionContext, stdout, stderr string, code int) error {
+	if a.stdoutKey != "" {
+		if err := ctx.Store().Put(a.stdoutKey, strings.TrimRight(stdout, "\r\n")); err != nil {
+			return fmt.Errorf("failed to store stdout: %w", err)
+		}
+	}
+	if a.stderrKey != "" {
+		if err := ctx.Store().Put(a.stderrKey, strings.TrimRight(stderr, "\r\n")); err != nil {
+			return fmt.Errorf("failed to store stderr: %w", err)
+		}
+	}
+	if a.exitCodeKey != "" {
+		if err := ctx.Store().Put(a.exitCodeKey, code); err != nil {
+			return fmt.Errorf("failed to store exit code: %w", err)
+		}
+	}
+	return nil
+}
+
+// Params configure an exec.command action in a workflow definition. The
+// command runs with args, env and dir, and the output and exit code are stored
+// under the keys set by StdoutKey, StderrKey and ExitCodeKey.
+type Params struct {
+	Command string            `json:"command"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	Dir     string            `json:"dir,omitempty"`
+	// Timeout is a duration such as "30s"
+	Timeout          string `json:"timeout,omitempty"`
+	StdoutKey        string `json:"stdoutKey,omitempty"`
+	StderrKey        string `json:"stderrKey,omitempty"`
+	ExitCodeKey      string `json:"exitCodeKey,omitempty"`
+	AllowedExitCodes []int  `json:"allowedExitCodes,omitempty"`
+}
+
+// Register adds the command action to registry under ActionID, so that
+// declarative definitions can run commands.
+func Register(registry *gostage.ActionRegistry) error {
+	return gostage.RegisterTyped(registry, ActionID, func(params Params) (gostage.Action, error) {
+		if params.Command == "" {
+			return nil, errors.New("the command parameter is required")
+		}
+
+		opts := []Option{
+			WithArgs(params.Args...),
+			WithDir(params.Dir),
+			CaptureStdout(params.StdoutKey),
+			CaptureStderr(params.StderrKey),
+			CaptureExitCode(params.ExitCodeKey),
+			AllowExitCodes(params.AllowedExitCodes...),
+		}
+		for key, value := range params.Env {
+			opts = append(opts, WithEnv(key, value))
+		}
+		if params.Timeout != "" {
+			timeout, err := time.ParseDuration(params.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timeout: %w", err)
+			}
+			opts = append(opts, WithTimeout(timeout))
+		}
+		return New(ActionID, params.Command, opts...), nil
+	})
+}
@@ -0,0 +1,119 @@
+package exec
+
+import (
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/davidroman0O/gostage/gostagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func requireShell(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the tests run commands through sh")
+	}
+}
+
+func TestCommandRendersArgumentsAndCapturesOutput(t *testing.T) {
+	requireShell(t)
+	dir := t.TempDir()
+
+	action := New("greet", "sh",
+		WithArgs("-c", `echo "hello $1 from $(pwd) as $ROLE"; echo warning >&2`, "sh", "{{ .store.name }}"),
+		WithEnv("ROLE", "{{ .store.role }}"),
+		WithDir("{{ .store.dir }}"),
+		CaptureStdout("greeting"),
+		CaptureStderr("warnings"),
+		CaptureExitCode("code"),
+	)
+	result := gostagetest.RunActions(t, map[string]interface{}{"name": "gopher", "role": "builder", "dir": dir}, action)
+	require.True(t, result.Success, "%v", result.Error)
+
+	resolved, err := filepath.EvalSymlinks(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "hello gopher from "+resolved+" as builder", result.FinalStore["greeting"])
+	assert.Equal(t, "warning", result.FinalStore["warnings"])
+	assert.Equal(t, 0, result.FinalStore["code"])
+}
+
+func TestCommandExitCodes(t *testing.T) {
+	requireShell(t)
+	errNotFound := errors.New("resource not found")
+
+	t.Run("not allowed", func(t *testing.T) {
+		result := gostagetest.RunActions(t, nil, New("fail", "sh", WithArgs("-c", "echo broken >&2; exit 3"), CaptureExitCode("code")))
+		var exitErr *ExitError
+		require.ErrorAs(t, result.Error, &exitErr)
+		assert.Equal(t, 3, exitErr.Code)
+		assert.Equal(t, "command 'sh' exited with code 3: broken", exitErr.Error())
+		assert.Equal(t, 3, result.FinalStore["code"])
+	})
+
+	t.Run("allowed", func(t *testing.T) {
+		result := gostagetest.RunActions(t, nil, New("diff", "sh", WithArgs("-c", "exit 1"), AllowExitCodes(1), CaptureExitCode("code")))
+		require.True(t, result.Success, "%v", result.Error)
+		assert.Equal(t, 1, result.FinalStore["code"])
+	})
+
+	t.Run("mapped", func(t *testing.T) {
+		result := gostagetest.RunActions(t, nil, New("lookup", "sh", WithArgs("-c", "exit 4"), MapExitCode(4, errNotFound)))
+		assert.ErrorIs(t, result.Error, errNotFound)
+	})
+}
+
+func TestCommandTimeout(t *testing.T) {
+	requireShell(t)
+
+	started := time.Now()
+	result := gostagetest.RunActions(t, nil, New("hang", "sh", WithArgs("-c", "sleep 10"), WithTimeout(100*time.Millisecond)))
+	require.Error(t, result.Error)
+	assert.Contains(t, result.Error.Error(), "timed out after 100ms")
+	assert.Less(t, time.Since(started), 5*time.Second)
+}
+
+func TestCommandNotFound(t *testing.T) {
+	result := gostagetest.RunActions(t, nil, New("missing", "gostage-no-such-command"))
+	require.Error(t, result.Error)
+	assert.Contains(t, result.Error.Error(), "failed to run command 'gostage-no-such-command'")
+}
+
+func TestRegisteredCommand(t *testing.T) {
+	requireShell(t)
+	registry := gostage.NewActionRegistry()
+	require.NoError(t, Register(registry))
+
+	def := &gostage.SubWorkflowDef{
+		ID:           "defined",
+		InitialStore: map[string]interface{}{"word": "declared"},
+		Stages: []gostage.StageDef{{
+			ID: "run",
+			Actions: []gostage.ActionDef{{
+				ID: ActionID,
+				Params: map[string]interface{}{
+					"command":   "sh",
+					"args":      []interface{}{"-c", "printf '%s' \"$WORD\""},
+					"env":       map[string]interface{}{"WORD": "{{ .store.word }}"},
+					"timeout":   "5s",
+					"stdoutKey": "out",
+				},
+			}},
+		}},
+	}
+	wf, err := gostage.NewWorkflowFromDefWithRegistry(def, registry)
+	require.NoError(t, err)
+
+	result := gostage.NewRunner().ExecuteWithOptions(wf, gostage.DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, "declared", result.FinalStore["out"])
+
+	_, err = registry.Resolve(ActionID, map[string]interface{}{"command": "sh", "timeout": "soon"})
+	assert.ErrorContains(t, err, "invalid timeout")
+	_, err = registry.Resolve(ActionID, nil)
+	assert.ErrorContains(t, err, "command parameter is required")
+}
@@ -0,0 +1,310 @@
+package fs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/davidroman0O/gostage"
+)
+
+// Archive formats, chosen from the file name of the archive.
+const (
+	formatTar   = "tar"
+	formatTarGz = "tar.gz"
+	formatZip   = "zip"
+)
+
+// archiveFormat returns the format of the archive at path from its extension.
+func archiveFormat(path string) (string, error) {
+	name := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return formatTarGz, nil
+	case strings.HasSuffix(name, ".tar"):
+		return formatTar, nil
+	case strings.HasSuffix(name, ".zip"):
+		return formatZip, nil
+	}
+	return "", fmt.Errorf("unknown archive format for '%s', expected .tar, .tar.gz, .tgz or .zip", path)
+}
+
+// Pack creates an action packing the file or directory src into the archive
+// dst. The format follows the extension of dst: .tar, .tar.gz, .tgz or .zip.
+// The contents of a directory are stored at the root of the archive.
+func Pack(name, src, dst string) *FileAction {
+	return newFileAction(name, "Packs "+src+" into "+dst, func(ctx *gostage.ActionContext, paths []string) error {
+		format, err := archiveFormat(paths[1])
+		if err != nil {
+			return err
+		}
+		ctx.Logger.Debug("Packing %s into %s", paths[0], paths[1])
+
+		out, err := os.Create(paths[1])
+		if err != nil {
+			return fmt.Errorf("failed to create archive: %w", err)
+		}
+		if format == formatZip {
+			err = packZip(paths[0], out)
+		} else {
+			err = packTar(paths[0], out, format == formatTarGz)
+		}
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(paths[1])
+			return fmt.Errorf("failed to pack '%s': %w", paths[0], err)
+		}
+		return nil
+	}, src, dst)
+}
+
+// Unpack creates an action extracting the archive src into the directory dst,
+// which is created if needed. The format follows the extension of src. Entries
+// that would land outside of dst, links and special files are refused.
+func Unpack(name, src, dst string) *FileAction {
+	return newFileAction(name, "Unpacks "+src+" into "+dst, func(ctx *gostage.ActionContext, paths []string) error {
+		format, err := archiveFormat(paths[0])
+		if err != nil {
+			return err
+		}
+		ctx.Logger.Debug("Unpacking %s into %s", paths[0], paths[1])
+
+		if err := os.MkdirAll(paths[1], 0o755); err != nil {
+			return fmt.Errorf("failed to create directory '%s': %w", paths[1], err)
+		}
+		if format == formatZip {
+			err = unpackZip(paths[0], paths[1])
+		} else {
+			err = unpackTar(paths[0], paths[1], format == formatTarGz)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to unpack '%s': %w", paths[0], err)
+		}
+		return nil
+	}, src, dst)
+}
+
+// walkArchived calls fn for every file and directory to pack from src, with
+// its slash-separated name in the archive. A single file is named after its base name.
+func walkArchived(src string, fn func(path, name string, info fs.FileInfo) error) error {
+	root, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !root.IsDir() {
+		return fn(src, filepath.Base(src), root)
+	}
+
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || path == src {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return fmt.Errorf("cannot pack '%s': unsupported file type %s", path, info.Mode().Type())
+		}
+		return fn(path, filepath.ToSlash(rel), info)
+	})
+}
+
+// packTar writes src as a tar archive, compressed with gzip if compress is set.
+func packTar(src string, out io.Writer, compress bool) error {
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(out)
+		out = gz
+	}
+	tw := tar.NewWriter(out)
+
+	err := walkArchived(src, func(path, name string, info fs.FileInfo) error {
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		return copyInto(tw, path)
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if gz != nil {
+		return gz.Close()
+	}
+	return nil
+}
+
+// packZip writes src as a zip archive.
+func packZip(src string, out io.Writer) error {
+	zw := zip.NewWriter(out)
+
+	err := walkArchived(src, func(path, name string, info fs.FileInfo) error {
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if info.IsDir() {
+			header.Name += "/"
+		} else {
+			header.Method = zip.Deflate
+		}
+		w, err := zw.CreateHeader(header)
+		if err != nil || info.IsDir() {
+			return err
+		}
+		return copyInto(w, path)
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// copyInto copies the contents of the file at path to w.
+func copyInto(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// extractPath returns where the archive entry name goes in dst, refusing
+// names that escape it.
+func extractPath(dst, name string) (string, error) {
+	target := filepath.Join(dst, filepath.FromSlash(name))
+	rel, err := filepath.Rel(dst, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(name) {
+		return "", fmt.Errorf("entry '%s' would be extracted outside of the destination", name)
+	}
+	return target, nil
+}
+
+// extractFile writes the contents of an archive entry to target.
+func extractFile(target string, r io.Reader, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// unpackTar extracts a tar archive, decompressing it with gzip if compressed is set.
+func unpackTar(src, dst string, compressed bool) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var in io.Reader = file
+	if compressed {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		in = gz
+	}
+
+	tr := tar.NewReader(in)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target, err := extractPath(dst, header.Name)
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, os.FileMode(header.Mode).Perm()|0o700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := extractFile(target, tr, os.FileMode(header.Mode).Perm()); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("entry '%s' has an unsupported type", header.Name)
+		}
+	}
+}
+
+// unpackZip extracts a zip archive.
+func unpackZip(src, dst string) error {
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, entry := range zr.File {
+		target, err := extractPath(dst, entry.Name)
+		if err != nil {
+			return err
+		}
+
+		mode := entry.Mode()
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(target, mode.Perm()|0o700); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			r, err := entry.Open()
+			if err != nil {
+				return err
+			}
+			err = extractFile(target, r, mode.Perm())
+			r.Close()
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("entry '%s' has an unsupported type", entry.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+// Package fs provides actions that manipulate files: copying, moving,
+// deleting, creating directories, rendering templates, computing checksums and
+// packing or unpacking tar and zip archives.
+//
+// Every path is rendered as a template against the workflow store when the
+// action runs, so earlier actions can decide where files go:
+//
+//	fs.Mkdir("workspace", "{{ .store.workdir }}/build", 0o755)
+//	fs.Render("config", "templates/app.yaml", "{{ .store.workdir }}/app.yaml")
+//	fs.Pack("bundle", "{{ .store.workdir }}/build", "{{ .store.workdir }}/build.tar.gz")
+//	fs.Checksum("digest", "{{ .store.workdir }}/build.tar.gz", "bundle.sha256")
+package fs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/davidroman0O/gostage"
+)
+
+// FileAction is an action operating on paths rendered from the store.
+type FileAction struct {
+	gostage.BaseAction
+
+	paths []string
+	op    func(ctx *gostage.ActionContext, paths []string) error
+}
+
+// newFileAction creates an action running op on the rendered paths.
+func newFileAction(name, description string, op func(ctx *gostage.ActionContext, paths []string) error, paths ...string) *FileAction {
+	return &FileAction{
+		BaseAction: gostage.NewBaseAction(name, description),
+		paths:      paths,
+		op:         op,
+	}
+}
+
+// Execute renders the paths of the action and runs its operation.
+func (a *FileAction) Execute(ctx *gostage.ActionContext) error {
+	paths := make([]string, len(a.paths))
+	for i, path := range a.paths {
+		rendered, err := ctx.Render(path)
+		if err != nil {
+			return fmt.Errorf("failed to render path '%s': %w", path, err)
+		}
+		if rendered == "" {
+			return fmt.Errorf("path '%s' rendered empty", path)
+		}
+		paths[i] = rendered
+	}
+	return a.op(ctx, paths)
+}
+
+// Copy creates an action copying the file or directory src to dst, keeping
+// file modes. Existing files at dst are overwritten.
+func Copy(name, src, dst string) *FileAction {
+	return newFileAction(name, "Copies "+src+" to "+dst, func(ctx *gostage.ActionContext, paths []string) error {
+		ctx.Logger.Debug("Copying %s to %s", paths[0], paths[1])
+		return copyPath(paths[0], paths[1])
+	}, src, dst)
+}
+
+// Move creates an action moving the file or directory src to dst. Moves across
+// file systems fall back to copying and deleting.
+func Move(name, src, dst string) *FileAction {
+	return newFileAction(name, "Moves "+src+" to "+dst, func(ctx *gostage.ActionContext, paths []string) error {
+		ctx.Logger.Debug("Moving %s to %s", paths[0], paths[1])
+		err := os.Rename(paths[0], paths[1])
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, syscall.EXDEV) {
+			return fmt.Errorf("failed to move '%s': %w", paths[0], err)
+		}
+		if err := copyPath(paths[0], paths[1]); err != nil {
+			return err
+		}
+		if err := os.RemoveAll(paths[0]); err != nil {
+			return fmt.Errorf("failed to remove '%s' after copying it: %w", paths[0], err)
+		}
+		return nil
+	}, src, dst)
+}
+
+// Delete creates an action deleting the file or directory at path, with all
+// its contents. Deleting a missing path succeeds.
+func Delete(name, path string) *FileAction {
+	return newFileAction(name, "Deletes "+path, func(ctx *gostage.ActionContext, paths []string) error {
+		ctx.Logger.Debug("Deleting %s", paths[0])
+		if err := os.RemoveAll(paths[0]); err != nil {
+			return fmt.Errorf("failed to delete '%s': %w", paths[0], err)
+		}
+		return nil
+	}, path)
+}
+
+// Mkdir creates an action creating the directory at path and its missing
+// parents with perm.
+func Mkdir(name, path string, perm os.FileMode) *FileAction {
+	return newFileAction(name, "Creates "+path, func(ctx *gostage.ActionContext, paths []string) error {
+		ctx.Logger.Debug("Creating directory %s", paths[0])
+		if err := os.MkdirAll(paths[0], perm); err != nil {
+			return fmt.Errorf("failed to create directory '%s': %w", paths[0], err)
+		}
+		return nil
+	}, path)
+}
+
+// Render creates an action rendering the template file src against the
+// workflow store, as gostage.RenderTemplate does, and writing the result to
+// dst with the mode of src.
+func Render(name, src, dst string) *FileAction {
+	return newFileAction(name, "Renders "+src+" to "+dst, func(ctx *gostage.ActionContext, paths []string) error {
+		info, err := os.Stat(paths[0])
+		if err != nil {
+			return fmt.Errorf("failed to read template: %w", err)
+		}
+		text, err := os.ReadFile(paths[0])
+		if err != nil {
+			return fmt.Errorf("failed to read template: %w", err)
+		}
+		rendered, err := ctx.Render(string(text))
+		if err != nil {
+			return fmt.Errorf("failed to render template '%s': %w", paths[0], err)
+		}
+
+		ctx.Logger.Debug("Rendering %s to %s", paths[0], paths[1])
+		if err := os.WriteFile(paths[1], []byte(rendered), info.Mode().Perm()); err != nil {
+			return fmt.Errorf("failed to write '%s': %w", paths[1], err)
+		}
+		return nil
+	}, src, dst)
+}
+
+// Checksum creates an action storing the hex-encoded SHA-256 digest of the
+// file at path under key.
+func Checksum(name, path, key string) *FileAction {
+	return newFileAction(name, "Computes the checksum of "+path, func(ctx *gostage.ActionContext, paths []string) error {
+		file, err := os.Open(paths[0])
+		if err != nil {
+			return fmt.Errorf("failed to open '%s': %w", paths[0], err)
+		}
+		defer file.Close()
+
+		hash := sha256.New()
+		if _, err := io.Copy(hash, file); err != nil {
+			return fmt.Errorf("failed to read '%s': %w", paths[0], err)
+		}
+		return ctx.Store().Put(key, hex.EncodeToString(hash.Sum(nil)))
+	}, path)
+}
+
+// copyPath copies a file or a directory tree.
+func copyPath(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("failed to copy '%s': %w", src, err)
+	}
+	if !info.IsDir() {
+		return copyFile(src, dst, info.Mode().Perm())
+	}
+
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case entry.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case entry.Type().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		default:
+			return fmt.Errorf("cannot copy '%s': unsupported file type %s", path, entry.Type())
+		}
+	})
+}
+
+// copyFile copies the contents of a regular file.
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to copy '%s': %w", src, err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return fmt.Errorf("failed to copy to '%s': %w", dst, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to copy '%s' to '%s': %w", src, dst, err)
+	}
+	return out.Close()
+}
+
+// Action IDs under which Register adds the file actions to a registry.
+const (
+	CopyID     = "fs.copy"
+	MoveID     = "fs.move"
+	DeleteID   = "fs.delete"
+	MkdirID    = "fs.mkdir"
+	RenderID   = "fs.render"
+	ChecksumID = "fs.checksum"
+	PackID     = "fs.pack"
+	UnpackID   = "fs.unpack"
+)
+
+// Params configure the fs actions in a workflow definition.
+// Copy, move, render, pack and unpack use src and dst, delete, mkdir and
+// checksum use path. Checksum stores its digest under key, and mkdir creates
+// directories with mode, an octal string defaulting to "0755".
+type Params struct {
+	Src  string `json:"src,omitempty"`
+	Dst  string `json:"dst,omitempty"`
+	Path string `json:"path,omitempty"`
+	Key  string `json:"key,omitempty"`
+	Mode string `json:"mode,omitempty"`
+}
+
+// Register adds the file actions to registry, so that declarative definitions
+// can use them.
+func Register(registry *gostage.ActionRegistry) error {
+	withPaths := func(id string, build func(params Params) (gostage.Action, error), required ...string) error {
+		return gostage.RegisterTyped(registry, id, func(params Params) (gostage.Action, error) {
+			values := map[string]string{"src": params.Src, "dst": params.Dst, "path": params.Path, "key": params.Key}
+			for _, name := range required {
+				if values[name] == "" {
+					return nil, fmt.Errorf("the %s parameter is required", name)
+				}
+			}
+			return build(params)
+		})
+	}
+
+	return errors.Join(
+		withPaths(CopyID, func(p Params) (gostage.Action, error) { return Copy(CopyID, p.Src, p.Dst), nil }, "src", "dst"),
+		withPaths(MoveID, func(p Params) (gostage.Action, error) { return Move(MoveID, p.Src, p.Dst), nil }, "src", "dst"),
+		withPaths(DeleteID, func(p Params) (gostage.Action, error) { return Delete(DeleteID, p.Path), nil }, "path"),
+		withPaths(MkdirID, func(p Params) (gostage.Action, error) {
+			perm := uint64(0o755)
+			if p.Mode != "" {
+				var err error
+				if perm, err = strconv.ParseUint(p.Mode, 8, 32); err != nil {
+					return nil, fmt.Errorf("invalid mode '%s': %w", p.Mode, err)
+				}
+			}
+			return Mkdir(MkdirID, p.Path, os.FileMode(perm)), nil
+		}, "path"),
+		withPaths(RenderID, func(p Params) (gostage.Action, error) { return Render(RenderID, p.Src, p.Dst), nil }, "src", "dst"),
+		withPaths(ChecksumID, func(p Params) (gostage.Action, error) { return Checksum(ChecksumID, p.Path, p.Key), nil }, "path", "key"),
+		withPaths(PackID, func(p Params) (gostage.Action, error) { return Pack(PackID, p.Src, p.Dst), nil }, "src", "dst"),
+		withPaths(UnpackID, func(p Params) (gostage.Action, error) { return Unpack(UnpackID, p.Src, p.Dst), nil }, "src", "dst"),
+	)
+}
@@ -0,0 +1,170 @@
+package fs
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/davidroman0O/gostage/gostagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTree creates files relative to dir.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+}
+
+// readTree returns the contents of the files under dir, keyed by slash-separated relative path.
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	require.NoError(t, filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		files[filepath.ToSlash(rel)] = string(data)
+		return err
+	}))
+	return files
+}
+
+func TestFileActions(t *testing.T) {
+	dir := t.TempDir()
+	tree := map[string]string{"app.txt": "app", "conf/settings.ini": "debug=false"}
+	writeTree(t, filepath.Join(dir, "src"), tree)
+	writeTree(t, dir, map[string]string{"greeting.tmpl": "Hello {{ .store.name }}!"})
+
+	result := gostagetest.RunActions(t, map[string]interface{}{"dir": dir, "name": "gopher"},
+		Mkdir("mkdir", "{{ .store.dir }}/out/nested", 0o755),
+		Copy("copy", "{{ .store.dir }}/src", "{{ .store.dir }}/copy"),
+		Move("move", "{{ .store.dir }}/copy", "{{ .store.dir }}/out/moved"),
+		Render("render", "{{ .store.dir }}/greeting.tmpl", "{{ .store.dir }}/out/greeting.txt"),
+		Checksum("checksum", "{{ .store.dir }}/out/greeting.txt", "greeting.sha256"),
+		Delete("delete", "{{ .store.dir }}/src"),
+	)
+	require.True(t, result.Success, "%v", result.Error)
+
+	assert.DirExists(t, filepath.Join(dir, "out", "nested"))
+	assert.Equal(t, tree, readTree(t, filepath.Join(dir, "out", "moved")))
+	assert.NoDirExists(t, filepath.Join(dir, "copy"))
+	assert.NoDirExists(t, filepath.Join(dir, "src"))
+
+	greeting, err := os.ReadFile(filepath.Join(dir, "out", "greeting.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "Hello gopher!", string(greeting))
+	digest := sha256.Sum256(greeting)
+	assert.Equal(t, hex.EncodeToString(digest[:]), result.FinalStore["greeting.sha256"])
+}
+
+func TestFileActionErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	result := gostagetest.RunActions(t, nil, Copy("copy", filepath.Join(dir, "missing"), filepath.Join(dir, "copy")))
+	require.Error(t, result.Error)
+	assert.Contains(t, result.Error.Error(), "failed to copy")
+
+	result = gostagetest.RunActions(t, nil, Delete("delete", "{{ .store.target }}"))
+	require.Error(t, result.Error)
+	assert.Contains(t, result.Error.Error(), "failed to render path")
+}
+
+func TestPackAndUnpack(t *testing.T) {
+	for _, archive := range []string{"bundle.tar", "bundle.tar.gz", "bundle.tgz", "bundle.zip"} {
+		t.Run(archive, func(t *testing.T) {
+			dir := t.TempDir()
+			tree := map[string]string{"bin/app": "binary", "README": "docs", "empty/.keep": ""}
+			writeTree(t, filepath.Join(dir, "build"), tree)
+
+			result := gostagetest.RunActions(t, map[string]interface{}{"dir": dir},
+				Pack("pack", "{{ .store.dir }}/build", "{{ .store.dir }}/"+archive),
+				Unpack("unpack", "{{ .store.dir }}/"+archive, "{{ .store.dir }}/restored"),
+			)
+			require.True(t, result.Success, "%v", result.Error)
+			assert.Equal(t, tree, readTree(t, filepath.Join(dir, "restored")))
+		})
+	}
+}
+
+func TestPackSingleFile(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"report.csv": "a,b"})
+
+	result := gostagetest.RunActions(t, nil,
+		Pack("pack", filepath.Join(dir, "report.csv"), filepath.Join(dir, "report.zip")),
+		Unpack("unpack", filepath.Join(dir, "report.zip"), filepath.Join(dir, "out")),
+	)
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, map[string]string{"report.csv": "a,b"}, readTree(t, filepath.Join(dir, "out")))
+}
+
+func TestUnpackRefusesEscapingEntries(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "evil.tar")
+	file, err := os.Create(archive)
+	require.NoError(t, err)
+	tw := tar.NewWriter(file)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "../escaped.txt", Mode: 0o644, Size: 4, Typeflag: tar.TypeReg}))
+	_, err = tw.Write([]byte("evil"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, file.Close())
+
+	result := gostagetest.RunActions(t, nil, Unpack("unpack", archive, filepath.Join(dir, "out")))
+	require.Error(t, result.Error)
+	assert.Contains(t, result.Error.Error(), "outside of the destination")
+	assert.NoFileExists(t, filepath.Join(dir, "escaped.txt"))
+}
+
+func TestUnknownArchiveFormat(t *testing.T) {
+	dir := t.TempDir()
+	result := gostagetest.RunActions(t, nil, Pack("pack", dir, filepath.Join(t.TempDir(), "bundle.rar")))
+	require.Error(t, result.Error)
+	assert.Contains(t, result.Error.Error(), "unknown archive format")
+}
+
+func TestRegisteredFileActions(t *testing.T) {
+	registry := gostage.NewActionRegistry()
+	require.NoError(t, Register(registry))
+
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"data.txt": "payload"})
+	def := &gostage.SubWorkflowDef{
+		ID:           "defined",
+		InitialStore: map[string]interface{}{"dir": dir},
+		Stages: []gostage.StageDef{{
+			ID: "run",
+			Actions: []gostage.ActionDef{
+				{ID: MkdirID, Params: map[string]interface{}{"path": "{{ .store.dir }}/out", "mode": "0700"}},
+				{ID: CopyID, Params: map[string]interface{}{"src": "{{ .store.dir }}/data.txt", "dst": "{{ .store.dir }}/out/data.txt"}},
+				{ID: ChecksumID, Params: map[string]interface{}{"path": "{{ .store.dir }}/out/data.txt", "key": "sum"}},
+			},
+		}},
+	}
+	wf, err := gostage.NewWorkflowFromDefWithRegistry(def, registry)
+	require.NoError(t, err)
+
+	result := gostage.NewRunner().ExecuteWithOptions(wf, gostage.DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	digest := sha256.Sum256([]byte("payload"))
+	assert.Equal(t, hex.EncodeToString(digest[:]), result.FinalStore["sum"])
+
+	_, err = registry.Resolve(CopyID, map[string]interface{}{"src": "a"})
+	assert.ErrorContains(t, err, "the dst parameter is required")
+	_, err = registry.Resolve(MkdirID, map[string]interface{}{"path": "a", "mode": "rwx"})
+	assert.ErrorContains(t, err, "invalid mode")
+}
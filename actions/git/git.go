@@ -0,0 +1,611 @@
+// Package git provides actions that clone repositories, check out revisions,
+// commit changes, create tags and push, so release and GitOps workflows can be
+// expressed as gostage workflows.
+//
+// The actions are built on go-git, so workflows do not need a git binary on
+// the host. Every argument, including URLs, directories, refs and messages,
+// is rendered as a template against the workflow store when the action runs:
+//
+//	checkout := "{{ .store.workdir }}/deploy-config"
+//	stage.AddAction(git.Clone("clone", "https://github.com/acme/deploy-config.git", checkout,
+//		git.WithDepth(1), git.WithCredentials("x-access-token", "{{ .store.githubToken }}")))
+//	stage.AddAction(fs.Render("manifest", "templates/app.yaml", checkout+"/apps/app.yaml"))
+//	stage.AddAction(git.Commit("commit", checkout, "Deploy {{ .store.version }}",
+//		git.WithAuthor("Release Bot", "release@acme.io"), git.SkipUnchanged(), git.StoreHead("deploy.commit")))
+//	stage.AddAction(git.Push("push", checkout, "origin", []string{"HEAD:main"},
+//		git.WithCredentials("x-access-token", "{{ .store.githubToken }}")))
+//
+// Local repositories, given as paths or file:// URLs, are served in process
+// as well: importing the package installs go-git's in-process server as its
+// file transport.
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/server"
+)
+
+func init() {
+	// go-git runs git-upload-pack and git-receive-pack for local
+	// repositories unless another file transport is installed
+	client.InstallProtocol("file", server.DefaultServer)
+}
+
+// GitAction runs a git operation in a working tree.
+type GitAction struct {
+	gostage.BaseAction
+
+	op      string
+	dir     string
+	run     func(a *GitAction, ctx *gostage.ActionContext, runCtx context.Context, dir string) error
+	headKey string
+	timeout time.Duration
+
+	username    string
+	password    string
+	authorName  string
+	authorEmail string
+
+	depth         int
+	branch        string
+	create        bool
+	message       string
+	paths         []string
+	skipUnchanged bool
+	force         bool
+}
+
+// Option configures a GitAction. Options that do not apply to an action are ignored.
+type Option func(*GitAction)
+
+// WithCredentials authenticates HTTP(S) remotes with basic auth. Both values
+// are rendered as templates; tokens usually go in password.
+func WithCredentials(username, password string) Option {
+	return func(a *GitAction) {
+		a.username = username
+		a.password = password
+	}
+}
+
+// WithAuthor sets the author and committer of commits and annotated tags.
+// Both values are rendered as templates.
+func WithAuthor(name, email string) Option {
+	return func(a *GitAction) {
+		a.authorName = name
+		a.authorEmail = email
+	}
+}
+
+// WithTimeout cancels the operation if the action runs longer than timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(a *GitAction) {
+		a.timeout = timeout
+	}
+}
+
+// StoreHead stores the commit hash of HEAD under key once the action succeeds.
+func StoreHead(key string) Option {
+	return func(a *GitAction) {
+		a.headKey = key
+	}
+}
+
+// WithDepth makes Clone create a shallow clone with depth commits. As with
+// git, the depth is ignored when cloning a local repository.
+func WithDepth(depth int) Option {
+	return func(a *GitAction) {
+		a.depth = depth
+	}
+}
+
+// WithBranch makes Clone check out branch instead of the remote's default branch.
+// It is rendered as a template.
+func WithBranch(branch string) Option {
+	return func(a *GitAction) {
+		a.branch = branch
+	}
+}
+
+// CreateBranch makes Checkout create the branch at HEAD, or reset it to HEAD
+// if it exists. Changes in the working tree are kept.
+func CreateBranch() Option {
+	return func(a *GitAction) {
+		a.create = true
+	}
+}
+
+// WithMessage makes Tag create an annotated tag with message, rendered as a template.
+func WithMessage(message string) Option {
+	return func(a *GitAction) {
+		a.message = message
+	}
+}
+
+// WithPaths makes Commit stage only paths instead of every change. Paths are
+// rendered as templates.
+func WithPaths(paths ...string) Option {
+	return func(a *GitAction) {
+		a.paths = append(a.paths, paths...)
+	}
+}
+
+// SkipUnchanged makes Commit succeed without committing when nothing changed.
+func SkipUnchanged() Option {
+	return func(a *GitAction) {
+		a.skipUnchanged = true
+	}
+}
+
+// WithForce makes Push force-update the remote refs.
+func WithForce() Option {
+	return func(a *GitAction) {
+		a.force = true
+	}
+}
+
+// newGitAction creates an action running the operation op in dir.
+func newGitAction(name, description, op, dir string, run func(a *GitAction, ctx *gostage.ActionContext, runCtx context.Context, dir string) error, opts []Option) *GitAction {
+	a := &GitAction{
+		BaseAction: gostage.NewBaseAction(name, description),
+		op:         op,
+		dir:        dir,
+		run:        run,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Clone creates an action cloning the repository at url into dir.
+func Clone(name, url, dir string, opts ...Option) *GitAction {
+	return newGitAction(name, "Clones "+url, "clone", dir, func(a *GitAction, ctx *gostage.ActionContext, runCtx context.Context, dir string) error {
+		values, err := renderAll(ctx, []string{url, a.branch})
+		if err != nil {
+			return err
+		}
+		auth, err := a.auth(ctx)
+		if err != nil {
+			return err
+		}
+		options := &gogit.CloneOptions{URL: values[0], Auth: auth, Depth: a.depth}
+		if values[1] != "" {
+			options.ReferenceName = plumbing.NewBranchReferenceName(values[1])
+			options.SingleBranch = true
+		}
+		if endpoint, err := transport.NewEndpoint(values[0]); err == nil && endpoint.Protocol == "file" {
+			options.Depth = 0
+		}
+		_, err = gogit.PlainCloneContext(runCtx, dir, false, options)
+		return err
+	}, opts)
+}
+
+// Checkout creates an action checking out ref, a branch, tag or commit, in
+// the working tree at dir. A branch only known to the origin remote is
+// created to start at the remote branch.
+func Checkout(name, dir, ref string, opts ...Option) *GitAction {
+	return newGitAction(name, "Checks out "+ref, "checkout", dir, func(a *GitAction, ctx *gostage.ActionContext, runCtx context.Context, dir string) error {
+		ref, err := ctx.Render(ref)
+		if err != nil {
+			return fmt.Errorf("failed to render '%s': %w", ref, err)
+		}
+		repo, worktree, err := open(dir)
+		if err != nil {
+			return err
+		}
+
+		branch := plumbing.NewBranchReferenceName(ref)
+		if a.create {
+			head, err := repo.Head()
+			if err != nil {
+				return err
+			}
+			if err := repo.Storer.SetReference(plumbing.NewHashReference(branch, head.Hash())); err != nil {
+				return err
+			}
+			return worktree.Checkout(&gogit.CheckoutOptions{Branch: branch, Keep: true})
+		}
+
+		if _, err := repo.Reference(branch, false); err == nil {
+			return worktree.Checkout(&gogit.CheckoutOptions{Branch: branch})
+		}
+		if remote, err := repo.Reference(plumbing.NewRemoteReferenceName("origin", ref), true); err == nil {
+			return worktree.Checkout(&gogit.CheckoutOptions{Branch: branch, Hash: remote.Hash(), Create: true})
+		}
+		hash, err := repo.ResolveRevision(plumbing.Revision(ref))
+		if err != nil {
+			return fmt.Errorf("'%s': %w", ref, err)
+		}
+		return worktree.Checkout(&gogit.CheckoutOptions{Hash: *hash})
+	}, opts)
+}
+
+// Commit creates an action staging every change of the working tree at dir,
+// or only the paths given with WithPaths, and committing them with message.
+func Commit(name, dir, message string, opts ...Option) *GitAction {
+	return newGitAction(name, "Commits changes", "commit", dir, func(a *GitAction, ctx *gostage.ActionContext, runCtx context.Context, dir string) error {
+		message, err := ctx.Render(message)
+		if err != nil {
+			return fmt.Errorf("failed to render '%s': %w", message, err)
+		}
+		paths, err := renderAll(ctx, a.paths)
+		if err != nil {
+			return err
+		}
+		_, worktree, err := open(dir)
+		if err != nil {
+			return err
+		}
+
+		if len(paths) == 0 {
+			err = worktree.AddWithOptions(&gogit.AddOptions{All: true})
+		}
+		for _, path := range paths {
+			if err = worktree.AddWithOptions(&gogit.AddOptions{Path: path}); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		if a.skipUnchanged {
+			staged, err := hasStagedChanges(worktree)
+			if err != nil {
+				return err
+			}
+			if !staged {
+				ctx.Logger.Info("Nothing to commit in %s", dir)
+				return nil
+			}
+		}
+		signature, err := a.signature(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = worktree.Commit(message, &gogit.CommitOptions{Author: signature, Committer: signature})
+		return err
+	}, opts)
+}
+
+// Tag creates an action tagging HEAD of the working tree at dir with tag.
+// The tag is lightweight unless WithMessage is given.
+func Tag(name, dir, tag string, opts ...Option) *GitAction {
+	return newGitAction(name, "Tags "+tag, "tag", dir, func(a *GitAction, ctx *gostage.ActionContext, runCtx context.Context, dir string) error {
+		values, err := renderAll(ctx, []string{tag, a.message})
+		if err != nil {
+			return err
+		}
+		repo, _, err := open(dir)
+		if err != nil {
+			return err
+		}
+		head, err := repo.Head()
+		if err != nil {
+			return err
+		}
+
+		var options *gogit.CreateTagOptions
+		if values[1] != "" {
+			signature, err := a.signature(ctx)
+			if err != nil {
+				return err
+			}
+			options = &gogit.CreateTagOptions{Message: values[1], Tagger: signature}
+		}
+		_, err = repo.CreateTag(values[0], head.Hash(), options)
+		return err
+	}, opts)
+}
+
+// Push creates an action pushing refspecs, such as "main", "HEAD:main" or
+// "refs/tags/v1.0.0", from the working tree at dir to remote. As with git,
+// short names are looked up among the branches and then the tags, and a
+// short destination is of the same kind as its source.
+func Push(name, dir, remote string, refspecs []string, opts ...Option) *GitAction {
+	return newGitAction(name, "Pushes to "+remote, "push", dir, func(a *GitAction, ctx *gostage.ActionContext, runCtx context.Context, dir string) error {
+		remote, err := ctx.Render(remote)
+		if err != nil {
+			return fmt.Errorf("failed to render '%s': %w", remote, err)
+		}
+		specs, err := renderAll(ctx, refspecs)
+		if err != nil {
+			return err
+		}
+		auth, err := a.auth(ctx)
+		if err != nil {
+			return err
+		}
+		repo, _, err := open(dir)
+		if err != nil {
+			return err
+		}
+
+		options := &gogit.PushOptions{RemoteName: remote, Force: a.force, Auth: auth}
+		for _, spec := range specs {
+			refspec, err := pushRefSpec(repo, spec)
+			if err != nil {
+				return err
+			}
+			options.RefSpecs = append(options.RefSpecs, refspec)
+		}
+		if err := repo.PushContext(runCtx, options); err != nil && !errors.Is(err, gogit.NoErrAlreadyUpToDate) {
+			return err
+		}
+		return nil
+	}, opts)
+}
+
+// Execute runs the operation of the action.
+func (a *GitAction) Execute(ctx *gostage.ActionContext) error {
+	runCtx := ctx.GoContext
+	if runCtx == nil {
+		runCtx = context.Background()
+	}
+	if a.timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(runCtx, a.timeout)
+		defer cancel()
+	}
+
+	dir, err := ctx.Render(a.dir)
+	if err != nil {
+		return fmt.Errorf("failed to render directory: %w", err)
+	}
+	ctx.Logger.Debug("Running git %s in %s", a.op, dir)
+	if err := a.run(a, ctx, runCtx, dir); err != nil {
+		if runCtx.Err() != nil {
+			return fmt.Errorf("git %s: %w", a.op, runCtx.Err())
+		}
+		return fmt.Errorf("git %s failed: %w", a.op, err)
+	}
+
+	if a.headKey == "" {
+		return nil
+	}
+	repo, _, err := open(dir)
+	if err != nil {
+		return fmt.Errorf("git %s failed: %w", a.op, err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+	return ctx.Store().Put(a.headKey, head.Hash().String())
+}
+
+// auth returns the basic auth credentials of the action, or nil without any.
+func (a *GitAction) auth(ctx *gostage.ActionContext) (transport.AuthMethod, error) {
+	values, err := renderAll(ctx, []string{a.username, a.password})
+	if err != nil {
+		return nil, err
+	}
+	if values[0] == "" && values[1] == "" {
+		return nil, nil
+	}
+	return &githttp.BasicAuth{Username: values[0], Password: values[1]}, nil
+}
+
+// signature returns the author of the action, timed on the runner clock, or
+// nil to let go-git read it from the git configuration.
+func (a *GitAction) signature(ctx *gostage.ActionContext) (*object.Signature, error) {
+	values, err := renderAll(ctx, []string{a.authorName, a.authorEmail})
+	if err != nil {
+		return nil, err
+	}
+	if values[0] == "" && values[1] == "" {
+		return nil, nil
+	}
+	return &object.Signature{Name: values[0], Email: values[1], When: ctx.Now()}, nil
+}
+
+// open opens the repository of the working tree at dir.
+func open(dir string) (*gogit.Repository, *gogit.Worktree, error) {
+	repo, err := gogit.PlainOpen(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("'%s': %w", dir, err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, nil, err
+	}
+	return repo, worktree, nil
+}
+
+// hasStagedChanges reports whether the index of worktree differs from HEAD.
+func hasStagedChanges(worktree *gogit.Worktree) (bool, error) {
+	status, err := worktree.Status()
+	if err != nil {
+		return false, err
+	}
+	for _, file := range status {
+		if file.Staging != gogit.Unmodified && file.Staging != gogit.Untracked {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// pushRefSpec expands a refspec given as to git push into the full refspec
+// go-git expects.
+func pushRefSpec(repo *gogit.Repository, spec string) (config.RefSpec, error) {
+	prefix := ""
+	if strings.HasPrefix(spec, "+") {
+		prefix, spec = "+", spec[1:]
+	}
+	src, dst, hasDst := strings.Cut(spec, ":")
+
+	source, err := localRef(repo, src)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case !hasDst && !strings.HasPrefix(source, "refs/"):
+		return "", fmt.Errorf("refspec '%s' needs a destination", spec)
+	case !hasDst:
+		dst = source
+	case !strings.HasPrefix(dst, "refs/") && strings.HasPrefix(source, "refs/tags/"):
+		dst = "refs/tags/" + dst
+	case !strings.HasPrefix(dst, "refs/"):
+		dst = "refs/heads/" + dst
+	}
+
+	refspec := config.RefSpec(prefix + source + ":" + dst)
+	if err := refspec.Validate(); err != nil {
+		return "", fmt.Errorf("invalid refspec '%s': %w", spec, err)
+	}
+	return refspec, nil
+}
+
+// localRef returns the full name of the local reference name designates, or
+// the commit hash of a detached HEAD.
+func localRef(repo *gogit.Repository, name string) (string, error) {
+	if name == "HEAD" {
+		head, err := repo.Reference(plumbing.HEAD, false)
+		if err != nil {
+			return "", err
+		}
+		if head.Type() == plumbing.SymbolicReference {
+			return head.Target().String(), nil
+		}
+		return head.Hash().String(), nil
+	}
+	if strings.HasPrefix(name, "refs/") {
+		return name, nil
+	}
+	for _, ref := range []plumbing.ReferenceName{plumbing.NewBranchReferenceName(name), plumbing.NewTagReferenceName(name)} {
+		if _, err := repo.Reference(ref, false); err == nil {
+			return ref.String(), nil
+		}
+	}
+	return "", fmt.Errorf("'%s' does not match any branch or tag", name)
+}
+
+// renderAll renders every value as a template.
+func renderAll(ctx *gostage.ActionContext, values []string) ([]string, error) {
+	rendered := make([]string, len(values))
+	for i, value := range values {
+		var err error
+		if rendered[i], err = ctx.Render(value); err != nil {
+			return nil, fmt.Errorf("failed to render '%s': %w", value, err)
+		}
+	}
+	return rendered, nil
+}
+
+// Action IDs under which Register adds the git actions to a registry.
+const (
+	CloneID    = "git.clone"
+	CheckoutID = "git.checkout"
+	CommitID   = "git.commit"
+	TagID      = "git.tag"
+	PushID     = "git.push"
+)
+
+// Params configure the git actions in a workflow definition. Every action
+// works in the tree at dir, and username and password authenticate to remotes.
+// Clone uses url, dir, depth and branch; checkout uses dir, ref and create;
+// commit uses dir, message, paths and skipUnchanged; tag uses dir, tag and
+// message; push uses dir, remote, refspecs and force.
+type Params struct {
+	URL           string   `json:"url,omitempty"`
+	Dir           string   `json:"dir"`
+	Depth         int      `json:"depth,omitempty"`
+	Branch        string   `json:"branch,omitempty"`
+	Ref           string   `json:"ref,omitempty"`
+	Create        bool     `json:"create,omitempty"`
+	Message       string   `json:"message,omitempty"`
+	Paths         []string `json:"paths,omitempty"`
+	SkipUnchanged bool     `json:"skipUnchanged,omitempty"`
+	Tag           string   `json:"tag,omitempty"`
+	Remote        string   `json:"remote,omitempty"`
+	Refspecs      []string `json:"refspecs,omitempty"`
+	Force         bool     `json:"force,omitempty"`
+	Username      string   `json:"username,omitempty"`
+	Password      string   `json:"password,omitempty"`
+	AuthorName    string   `json:"authorName,omitempty"`
+	AuthorEmail   string   `json:"authorEmail,omitempty"`
+	// HeadKey is the store key the commit hash of HEAD is saved to, if set
+	HeadKey string `json:"headKey,omitempty"`
+	// Timeout is a duration such as "5m"
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// options returns the options shared by every git action.
+func (p Params) options() ([]Option, error) {
+	opts := []Option{
+		WithCredentials(p.Username, p.Password),
+		WithAuthor(p.AuthorName, p.AuthorEmail),
+		StoreHead(p.HeadKey),
+	}
+	if p.Timeout != "" {
+		timeout, err := time.ParseDuration(p.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout: %w", err)
+		}
+		opts = append(opts, WithTimeout(timeout))
+	}
+	return opts, nil
+}
+
+// Register adds the git actions to registry, so that declarative definitions
+// can use them.
+func Register(registry *gostage.ActionRegistry) error {
+	register := func(id, param string, value func(p Params) string, build func(p Params, opts []Option) gostage.Action) error {
+		return gostage.RegisterTyped(registry, id, func(p Params) (gostage.Action, error) {
+			if p.Dir == "" {
+				return nil, errors.New("the dir parameter is required")
+			}
+			if value(p) == "" {
+				return nil, fmt.Errorf("the %s parameter is required", param)
+			}
+			opts, err := p.options()
+			if err != nil {
+				return nil, err
+			}
+			return build(p, opts), nil
+		})
+	}
+
+	return errors.Join(
+		register(CloneID, "url", func(p Params) string { return p.URL }, func(p Params, opts []Option) gostage.Action {
+			return Clone(CloneID, p.URL, p.Dir, append(opts, WithDepth(p.Depth), WithBranch(p.Branch))...)
+		}),
+		register(CheckoutID, "ref", func(p Params) string { return p.Ref }, func(p Params, opts []Option) gostage.Action {
+			if p.Create {
+				opts = append(opts, CreateBranch())
+			}
+			return Checkout(CheckoutID, p.Dir, p.Ref, opts...)
+		}),
+		register(CommitID, "message", func(p Params) string { return p.Message }, func(p Params, opts []Option) gostage.Action {
+			opts = append(opts, WithPaths(p.Paths...))
+			if p.SkipUnchanged {
+				opts = append(opts, SkipUnchanged())
+			}
+			return Commit(CommitID, p.Dir, p.Message, opts...)
+		}),
+		register(TagID, "tag", func(p Params) string { return p.Tag }, func(p Params, opts []Option) gostage.Action {
+			return Tag(TagID, p.Dir, p.Tag, append(opts, WithMessage(p.Message))...)
+		}),
+		register(PushID, "remote", func(p Params) string { return p.Remote }, func(p Params, opts []Option) gostage.Action {
+			if p.Force {
+				opts = append(opts, WithForce())
+			}
+			return Push(PushID, p.Dir, p.Remote, p.Refspecs, opts...)
+		}),
+	)
+}
@@ -0,0 +1,194 @@
+package git
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/davidroman0O/gostage/gostagetest"
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRemote creates a bare repository with one commit on main and returns its path.
+func newRemote(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	remote := filepath.Join(root, "remote.git")
+	_, err := gogit.PlainInitWithOptions(remote, &gogit.PlainInitOptions{
+		Bare:        true,
+		InitOptions: gogit.InitOptions{DefaultBranch: plumbing.Main},
+	})
+	require.NoError(t, err)
+
+	seed := filepath.Join(root, "seed")
+	repo, err := gogit.PlainInitWithOptions(seed, &gogit.PlainInitOptions{
+		InitOptions: gogit.InitOptions{DefaultBranch: plumbing.Main},
+	})
+	require.NoError(t, err)
+	_, err = repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{remote}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(seed, "README.md"), []byte("hello\n"), 0o644))
+	worktree, err := repo.Worktree()
+	require.NoError(t, err)
+	_, err = worktree.Add("README.md")
+	require.NoError(t, err)
+	signature := &object.Signature{Name: "Test", Email: "test@example.com", When: time.Now()}
+	_, err = worktree.Commit("Initial commit", &gogit.CommitOptions{Author: signature})
+	require.NoError(t, err)
+	require.NoError(t, repo.Push(&gogit.PushOptions{RefSpecs: []config.RefSpec{"refs/heads/main:refs/heads/main"}}))
+	return remote
+}
+
+// openRepo opens the repository at path.
+func openRepo(t *testing.T, path string) *gogit.Repository {
+	t.Helper()
+	repo, err := gogit.PlainOpen(path)
+	require.NoError(t, err)
+	return repo
+}
+
+// revision resolves rev in the repository at path to a commit hash.
+func revision(t *testing.T, path, rev string) string {
+	t.Helper()
+	hash, err := openRepo(t, path).ResolveRevision(plumbing.Revision(rev))
+	require.NoError(t, err)
+	return hash.String()
+}
+
+func TestReleaseFlow(t *testing.T) {
+	remote := newRemote(t)
+	dir := filepath.Join(t.TempDir(), "checkout")
+
+	write := gostage.NewBaseAction("write", "")
+	result := gostagetest.RunActions(t, map[string]interface{}{"remote": remote, "dir": dir, "version": "v1.2.0"},
+		Clone("clone", "{{ .store.remote }}", "{{ .store.dir }}", WithDepth(1), WithBranch("main"), StoreHead("cloned")),
+		Checkout("branch", "{{ .store.dir }}", "release/{{ .store.version }}", CreateBranch()),
+		&funcAction{BaseAction: write, fn: func(ctx *gostage.ActionContext) error {
+			return os.WriteFile(filepath.Join(dir, "VERSION"), []byte("v1.2.0\n"), 0o644)
+		}},
+		Commit("commit", "{{ .store.dir }}", "Release {{ .store.version }}",
+			WithAuthor("Release Bot", "release@example.com"), WithPaths("VERSION"), StoreHead("released")),
+		Commit("commit-again", "{{ .store.dir }}", "Nothing", SkipUnchanged(), StoreHead("unchanged")),
+		Tag("tag", "{{ .store.dir }}", "{{ .store.version }}", WithMessage("Version {{ .store.version }}"),
+			WithAuthor("Release Bot", "release@example.com")),
+		Push("push", "{{ .store.dir }}", "origin", []string{"HEAD:main", "refs/tags/{{ .store.version }}"}),
+	)
+	require.True(t, result.Success, "%v", result.Error)
+
+	released := result.FinalStore["released"].(string)
+	assert.Len(t, released, 40)
+	assert.NotEqual(t, result.FinalStore["cloned"], released)
+	assert.Equal(t, released, result.FinalStore["unchanged"])
+
+	assert.Equal(t, released, revision(t, remote, "main"))
+	assert.Equal(t, released, revision(t, remote, "v1.2.0"))
+
+	repo := openRepo(t, remote)
+	tagRef, err := repo.Tag("v1.2.0")
+	require.NoError(t, err)
+	tag, err := repo.TagObject(tagRef.Hash())
+	require.NoError(t, err, "v1.2.0 should be an annotated tag")
+	assert.Equal(t, "Version v1.2.0\n", tag.Message)
+	assert.Equal(t, "Release Bot", tag.Tagger.Name)
+
+	commit, err := repo.CommitObject(plumbing.NewHash(released))
+	require.NoError(t, err)
+	assert.Equal(t, "Release Bot <release@example.com> Release v1.2.0", commit.Author.Name+" <"+commit.Author.Email+"> "+commit.Message)
+
+	head, err := openRepo(t, dir).Head()
+	require.NoError(t, err)
+	assert.Equal(t, "release/v1.2.0", head.Name().Short())
+}
+
+func TestGitErrors(t *testing.T) {
+	remote := newRemote(t)
+	dir := filepath.Join(t.TempDir(), "checkout")
+
+	result := gostagetest.RunActions(t, nil, Clone("clone", remote, dir), Commit("commit", dir, "Nothing", WithAuthor("Bot", "bot@example.com")))
+	require.False(t, result.Success)
+	assert.ErrorContains(t, result.Error, "git commit failed")
+	assert.ErrorIs(t, result.Error, gogit.ErrEmptyCommit)
+
+	result = gostagetest.RunActions(t, nil, Checkout("checkout", dir, "missing"))
+	assert.ErrorContains(t, result.Error, "git checkout failed")
+
+	result = gostagetest.RunActions(t, nil, Tag("tag", dir, "{{ .store.missing }}"))
+	assert.ErrorContains(t, result.Error, "failed to render")
+}
+
+func TestCredentials(t *testing.T) {
+	var mu sync.Mutex
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		authorization = r.Header.Get("Authorization")
+		mu.Unlock()
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	result := gostagetest.RunActions(t, map[string]interface{}{"token": "s3cr3t"},
+		Clone("clone", server.URL+"/repo.git", filepath.Join(t.TempDir(), "repo"),
+			WithCredentials("x-access-token", "{{ .store.token }}")))
+	require.False(t, result.Success)
+	assert.NotContains(t, result.Error.Error(), "s3cr3t")
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, "Basic eC1hY2Nlc3MtdG9rZW46czNjcjN0", authorization)
+}
+
+func TestRegisteredGitActions(t *testing.T) {
+	remote := newRemote(t)
+	registry := gostage.NewActionRegistry()
+	require.NoError(t, Register(registry))
+
+	def := &gostage.SubWorkflowDef{
+		ID:           "defined",
+		InitialStore: map[string]interface{}{"dir": filepath.Join(t.TempDir(), "checkout")},
+		Stages: []gostage.StageDef{{
+			ID: "run",
+			Actions: []gostage.ActionDef{
+				{ID: CloneID, Params: map[string]interface{}{"url": remote, "dir": "{{ .store.dir }}", "depth": 1}},
+				{ID: CheckoutID, Params: map[string]interface{}{"dir": "{{ .store.dir }}", "ref": "main"}},
+				{ID: CommitID, Params: map[string]interface{}{"dir": "{{ .store.dir }}", "message": "Nothing", "skipUnchanged": true,
+					"authorName": "Bot", "authorEmail": "bot@example.com"}},
+				{ID: TagID, Params: map[string]interface{}{"dir": "{{ .store.dir }}", "tag": "v0.1.0", "headKey": "head"}},
+				{ID: PushID, Params: map[string]interface{}{"dir": "{{ .store.dir }}", "remote": "origin", "refspecs": []string{"v0.1.0"}, "timeout": "1m"}},
+			},
+		}},
+	}
+	wf, err := gostage.NewWorkflowFromDefWithRegistry(def, registry)
+	require.NoError(t, err)
+
+	result := gostage.NewRunner().ExecuteWithOptions(wf, gostage.DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, result.FinalStore["head"], revision(t, remote, "v0.1.0"))
+
+	_, err = registry.Resolve(CloneID, map[string]interface{}{"dir": "repo"})
+	assert.ErrorContains(t, err, "the url parameter is required")
+	_, err = registry.Resolve(PushID, map[string]interface{}{"remote": "origin"})
+	assert.ErrorContains(t, err, "the dir parameter is required")
+	_, err = registry.Resolve(CommitID, map[string]interface{}{"dir": "repo", "message": "m", "timeout": "soon"})
+	assert.ErrorContains(t, err, "invalid timeout")
+}
+
+// funcAction runs a function as an action.
+type funcAction struct {
+	gostage.BaseAction
+	fn func(ctx *gostage.ActionContext) error
+}
+
+func (a *funcAction) Execute(ctx *gostage.ActionContext) error {
+	return a.fn(ctx)
+}
@@ -0,0 +1,665 @@
+// Package k8s provides actions that drive Kubernetes deployments: applying
+// and deleting manifests, waiting for resources to become ready and scaling
+// them, with the changes recorded so a failed run can roll them back.
+//
+// The actions talk to the API server with the client-go dynamic client and
+// apply manifests with server-side apply, so workflows do not need kubectl on
+// the host. The cluster comes from the kubeconfig, as kubectl would find it,
+// or from the in-cluster configuration. Manifests, resources and namespaces
+// are rendered as templates against the workflow store when the action runs:
+//
+//	deploy := gostage.NewStage("deploy", "Deploy", "")
+//	deploy.AddAction(k8s.ApplyFile("apply", "deploy/api.yaml", k8s.WithNamespace("{{ .store.env }}")))
+//	deploy.AddAction(k8s.WaitReady("ready", "deployment/api", k8s.WithNamespace("{{ .store.env }}"),
+//		k8s.WithTimeout(5*time.Minute)))
+//	workflow.AddStage(deploy)
+//	workflow.AddStage(k8s.RollbackStage("rollback"))
+//
+// Apply, Delete and Scale record the state of the objects they change under
+// RollbackKey in the store. When the run fails, Rollback restores that state
+// in reverse order: objects that existed are re-applied as they were, objects
+// that were created are deleted and scaled resources get their replica count
+// back.
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// DefaultFieldManager is the field manager server-side apply records for the
+// fields set by the actions.
+const DefaultFieldManager = "gostage"
+
+// K8sAction runs an operation against a cluster.
+type K8sAction struct {
+	gostage.BaseAction
+
+	op           func(ctx *gostage.ActionContext, c *cluster) error
+	namespace    string
+	kubeContext  string
+	kubeconfig   string
+	client       dynamic.Interface
+	mapper       meta.RESTMapper
+	fieldManager string
+	timeout      time.Duration
+	interval     time.Duration
+	rollbackKey  string
+	noRollback   bool
+}
+
+// Option configures a K8sAction.
+type Option func(*K8sAction)
+
+// WithNamespace sets the namespace of the objects that do not name one, which
+// defaults to the namespace of the kubeconfig context. It is rendered as a
+// template.
+func WithNamespace(namespace string) Option {
+	return func(a *K8sAction) {
+		a.namespace = namespace
+	}
+}
+
+// WithKubeContext selects a context of the kubeconfig file.
+func WithKubeContext(name string) Option {
+	return func(a *K8sAction) {
+		a.kubeContext = name
+	}
+}
+
+// WithKubeconfig sets the kubeconfig file to read instead of the files named
+// by KUBECONFIG or ~/.kube/config. It is rendered as a template.
+func WithKubeconfig(path string) Option {
+	return func(a *K8sAction) {
+		a.kubeconfig = path
+	}
+}
+
+// WithClient makes the action use client and mapper, which maps kinds and
+// resource names such as "deployment" to API resources, instead of connecting
+// with the kubeconfig. Tests pass the fake dynamic client of client-go.
+func WithClient(client dynamic.Interface, mapper meta.RESTMapper) Option {
+	return func(a *K8sAction) {
+		a.client = client
+		a.mapper = mapper
+	}
+}
+
+// WithFieldManager sets the field manager of server-side apply, which
+// defaults to DefaultFieldManager.
+func WithFieldManager(name string) Option {
+	return func(a *K8sAction) {
+		a.fieldManager = name
+	}
+}
+
+// WithTimeout bounds how long the action runs, including the wait of WaitReady
+// and Delete.
+func WithTimeout(timeout time.Duration) Option {
+	return func(a *K8sAction) {
+		a.timeout = timeout
+	}
+}
+
+// WithPollInterval sets how often WaitReady and Delete check the cluster,
+// which defaults to two seconds.
+func WithPollInterval(interval time.Duration) Option {
+	return func(a *K8sAction) {
+		a.interval = interval
+	}
+}
+
+// WithRollbackKey sets the store key changes are recorded under and rolled back
+// from, which defaults to RollbackKey. Actions sharing a key roll back together.
+func WithRollbackKey(key string) Option {
+	return func(a *K8sAction) {
+		a.rollbackKey = key
+	}
+}
+
+// NoRollback stops Apply, Delete and Scale from recording their changes.
+func NoRollback() Option {
+	return func(a *K8sAction) {
+		a.noRollback = true
+	}
+}
+
+// newK8sAction creates an action running op against the configured cluster.
+func newK8sAction(name, description string, op func(ctx *gostage.ActionContext, c *cluster) error, opts []Option) *K8sAction {
+	a := &K8sAction{
+		BaseAction:   gostage.NewBaseAction(name, description),
+		op:           op,
+		fieldManager: DefaultFieldManager,
+		interval:     2 * time.Second,
+		rollbackKey:  RollbackKey,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Apply creates an action applying manifest, one or more YAML or JSON
+// documents rendered as a template. Objects are applied with server-side
+// apply, forcing conflicts so that the manifest wins as with kubectl apply.
+func Apply(name, manifest string, opts ...Option) *K8sAction {
+	a := newK8sAction(name, "Applies a manifest", nil, opts)
+	a.op = func(ctx *gostage.ActionContext, c *cluster) error {
+		rendered, err := ctx.Render(manifest)
+		if err != nil {
+			return fmt.Errorf("failed to render manifest: %w", err)
+		}
+		return a.apply(ctx, c, rendered)
+	}
+	return a
+}
+
+// ApplyFile creates an action applying the manifest in the file at path. Both
+// the path and the content of the file are rendered as templates.
+func ApplyFile(name, path string, opts ...Option) *K8sAction {
+	a := newK8sAction(name, "Applies "+path, nil, opts)
+	a.op = func(ctx *gostage.ActionContext, c *cluster) error {
+		rendered, err := renderFile(ctx, path)
+		if err != nil {
+			return err
+		}
+		return a.apply(ctx, c, rendered)
+	}
+	return a
+}
+
+// apply records the current state of the objects of manifest and applies it.
+func (a *K8sAction) apply(ctx *gostage.ActionContext, c *cluster, manifest string) error {
+	objects, err := decodeManifest(manifest)
+	if err != nil {
+		return err
+	}
+	if err := a.record(ctx, c, objects); err != nil {
+		return err
+	}
+	ctx.Logger.Info("Applying manifest in namespace '%s'", c.namespace)
+	for _, object := range objects {
+		if err := c.apply(object); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete creates an action deleting the objects of manifest, rendered as a
+// template, and waiting until they are gone. Objects that do not exist are
+// ignored.
+func Delete(name, manifest string, opts ...Option) *K8sAction {
+	a := newK8sAction(name, "Deletes a manifest", nil, opts)
+	a.op = func(ctx *gostage.ActionContext, c *cluster) error {
+		rendered, err := ctx.Render(manifest)
+		if err != nil {
+			return fmt.Errorf("failed to render manifest: %w", err)
+		}
+		return a.delete(ctx, c, rendered)
+	}
+	return a
+}
+
+// DeleteFile creates an action deleting the objects of the manifest in the
+// file at path. Both the path and the content of the file are rendered as templates.
+func DeleteFile(name, path string, opts ...Option) *K8sAction {
+	a := newK8sAction(name, "Deletes "+path, nil, opts)
+	a.op = func(ctx *gostage.ActionContext, c *cluster) error {
+		rendered, err := renderFile(ctx, path)
+		if err != nil {
+			return err
+		}
+		return a.delete(ctx, c, rendered)
+	}
+	return a
+}
+
+// delete records the current state of the objects of manifest, deletes them
+// and waits until they are gone.
+func (a *K8sAction) delete(ctx *gostage.ActionContext, c *cluster, manifest string) error {
+	objects, err := decodeManifest(manifest)
+	if err != nil {
+		return err
+	}
+	if err := a.record(ctx, c, objects); err != nil {
+		return err
+	}
+	ctx.Logger.Info("Deleting manifest in namespace '%s'", c.namespace)
+	for _, object := range objects {
+		if err := c.delete(object); err != nil {
+			return err
+		}
+	}
+	for _, object := range objects {
+		resource, err := c.resourceFor(object)
+		if err != nil {
+			return err
+		}
+		err = a.poll(ctx, c, "deletion of "+describe(object.Object), func() (bool, error) {
+			_, err := resource.Get(c.ctx, object.GetName(), metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				return true, nil
+			}
+			return false, err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WaitReady creates an action waiting until resource, such as
+// "deployment/api", is ready. Deployments, stateful sets and daemon sets wait
+// for their rollout to finish, jobs for their completion and other resources
+// for their Ready condition. A deployment that exceeded its progress deadline
+// or a failed job fails the action. The resource is rendered as a template.
+func WaitReady(name, resource string, opts ...Option) *K8sAction {
+	a := newK8sAction(name, "Waits for "+resource, nil, opts)
+	a.op = func(ctx *gostage.ActionContext, c *cluster) error {
+		rendered, err := ctx.Render(resource)
+		if err != nil {
+			return fmt.Errorf("failed to render resource: %w", err)
+		}
+		client, kind, objectName, err := c.lookup(rendered)
+		if err != nil {
+			return err
+		}
+
+		ctx.Logger.Info("Waiting for %s", rendered)
+		return a.poll(ctx, c, rendered, func() (bool, error) {
+			object, err := client.Get(c.ctx, objectName, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			return ready(kind, object)
+		})
+	}
+	return a
+}
+
+// Scale creates an action setting the replica count of resource, such as
+// "deployment/api", rendered as a template, through its scale subresource.
+func Scale(name, resource string, replicas int, opts ...Option) *K8sAction {
+	a := newK8sAction(name, "Scales "+resource, nil, opts)
+	a.op = func(ctx *gostage.ActionContext, c *cluster) error {
+		rendered, err := ctx.Render(resource)
+		if err != nil {
+			return fmt.Errorf("failed to render resource: %w", err)
+		}
+		if !a.noRollback {
+			previous, err := c.replicas(rendered)
+			if err != nil {
+				return err
+			}
+			if err := a.addChanges(ctx, Change{Namespace: c.namespace, Resource: rendered, Replicas: &previous}); err != nil {
+				return err
+			}
+		}
+
+		ctx.Logger.Info("Scaling %s to %d replicas", rendered, replicas)
+		return c.scale(rendered, replicas)
+	}
+	return a
+}
+
+// Execute connects to the cluster and runs the operation of the action.
+func (a *K8sAction) Execute(ctx *gostage.ActionContext) error {
+	runCtx := ctx.GoContext
+	if runCtx == nil {
+		runCtx = context.Background()
+	}
+	if a.timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(runCtx, a.timeout)
+		defer cancel()
+	}
+
+	namespace, err := ctx.Render(a.namespace)
+	if err != nil {
+		return fmt.Errorf("failed to render namespace: %w", err)
+	}
+	c, err := a.connect(ctx)
+	if err != nil {
+		return err
+	}
+	c.ctx = runCtx
+	if namespace != "" {
+		c.namespace = namespace
+	}
+	return a.op(ctx, c)
+}
+
+// connect returns the cluster of the action, built from the kubeconfig unless
+// WithClient was given.
+func (a *K8sAction) connect(ctx *gostage.ActionContext) (*cluster, error) {
+	if a.client != nil {
+		return &cluster{client: a.client, mapper: a.mapper, namespace: metav1.NamespaceDefault, fieldManager: a.fieldManager}, nil
+	}
+
+	kubeconfig, err := ctx.Render(a.kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render kubeconfig: %w", err)
+	}
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	config := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: a.kubeContext})
+	restConfig, err := config.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	namespace, _, err := config.Namespace()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	client, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+	cached := memory.NewMemCacheClient(discoveryClient)
+	mapper := restmapper.NewShortcutExpander(restmapper.NewDeferredDiscoveryRESTMapper(cached), cached, nil)
+	return &cluster{client: client, mapper: mapper, namespace: namespace, fieldManager: a.fieldManager}, nil
+}
+
+// poll calls check right away and then every poll interval of the action
+// until it reports done, fails or the run of the action ends.
+func (a *K8sAction) poll(ctx *gostage.ActionContext, c *cluster, what string, check func() (bool, error)) error {
+	for {
+		done, err := check()
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+
+		timer := ctx.Clock().NewTimer(a.interval)
+		select {
+		case <-timer.C():
+		case <-c.ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("stopped waiting for %s: %w", what, c.ctx.Err())
+		}
+	}
+}
+
+// renderFile reads the file at the rendered path and renders its content.
+func renderFile(ctx *gostage.ActionContext, path string) (string, error) {
+	rendered, err := ctx.Render(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to render '%s': %w", path, err)
+	}
+	data, err := os.ReadFile(rendered)
+	if err != nil {
+		return "", fmt.Errorf("failed to read manifest: %w", err)
+	}
+	manifest, err := ctx.Render(string(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to render manifest '%s': %w", rendered, err)
+	}
+	return manifest, nil
+}
+
+// cluster runs requests against one cluster, defaulting to one namespace.
+type cluster struct {
+	ctx          context.Context
+	client       dynamic.Interface
+	mapper       meta.RESTMapper
+	namespace    string
+	fieldManager string
+}
+
+// inNamespace returns a copy of c defaulting to namespace.
+func (c *cluster) inNamespace(namespace string) *cluster {
+	copied := *c
+	copied.namespace = namespace
+	return &copied
+}
+
+// resourceFor returns the client of the API resource of object, in the
+// namespace of object or the default namespace unless it is cluster-scoped.
+func (c *cluster) resourceFor(object *unstructured.Unstructured) (dynamic.ResourceInterface, error) {
+	gvk := object.GroupVersionKind()
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the resource of '%s': %w", describe(object.Object), err)
+	}
+	return c.namespaced(mapping, object.GetNamespace()), nil
+}
+
+// lookup resolves resource, such as "deployment/api" or "jobs.batch/migrate",
+// to the client of its API resource, its kind and the object name.
+func (c *cluster) lookup(resource string) (dynamic.ResourceInterface, schema.GroupKind, string, error) {
+	kind, name, ok := strings.Cut(resource, "/")
+	if !ok || kind == "" || name == "" {
+		return nil, schema.GroupKind{}, "", fmt.Errorf("resource '%s' is not of the form kind/name", resource)
+	}
+	partial := schema.ParseGroupResource(strings.ToLower(kind)).WithVersion("")
+	gvk, err := c.mapper.KindFor(partial)
+	if err != nil {
+		return nil, schema.GroupKind{}, "", fmt.Errorf("failed to find the resource of '%s': %w", resource, err)
+	}
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, schema.GroupKind{}, "", fmt.Errorf("failed to find the resource of '%s': %w", resource, err)
+	}
+	return c.namespaced(mapping, ""), gvk.GroupKind(), name, nil
+}
+
+// namespaced returns the client of the resource of mapping in namespace, or
+// in the default namespace if empty, unless the resource is cluster-scoped.
+func (c *cluster) namespaced(mapping *meta.RESTMapping, namespace string) dynamic.ResourceInterface {
+	resource := c.client.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+		return resource
+	}
+	if namespace == "" {
+		namespace = c.namespace
+	}
+	return resource.Namespace(namespace)
+}
+
+// get returns the current state of object, or nil if it does not exist.
+func (c *cluster) get(object *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	resource, err := c.resourceFor(object)
+	if err != nil {
+		return nil, err
+	}
+	current, err := resource.Get(c.ctx, object.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get '%s': %w", describe(object.Object), err)
+	}
+	return current, nil
+}
+
+// apply applies object with server-side apply.
+func (c *cluster) apply(object *unstructured.Unstructured) error {
+	resource, err := c.resourceFor(object)
+	if err != nil {
+		return err
+	}
+	_, err = resource.Apply(c.ctx, object.GetName(), object, metav1.ApplyOptions{FieldManager: c.fieldManager, Force: true})
+	if err != nil {
+		return fmt.Errorf("failed to apply '%s': %w", describe(object.Object), err)
+	}
+	return nil
+}
+
+// delete deletes object in the background, ignoring objects that do not exist.
+func (c *cluster) delete(object *unstructured.Unstructured) error {
+	resource, err := c.resourceFor(object)
+	if err != nil {
+		return err
+	}
+	propagation := metav1.DeletePropagationBackground
+	err = resource.Delete(c.ctx, object.GetName(), metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete '%s': %w", describe(object.Object), err)
+	}
+	return nil
+}
+
+// replicas returns the replica count of resource, read from its scale subresource.
+func (c *cluster) replicas(resource string) (int, error) {
+	client, _, name, err := c.lookup(resource)
+	if err != nil {
+		return 0, err
+	}
+	scale, err := client.Get(c.ctx, name, metav1.GetOptions{}, "scale")
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the scale of '%s': %w", resource, err)
+	}
+	replicas, _, err := unstructured.NestedInt64(scale.Object, "spec", "replicas")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the replicas of '%s': %w", resource, err)
+	}
+	return int(replicas), nil
+}
+
+// scale sets the replica count of resource through its scale subresource.
+func (c *cluster) scale(resource string, replicas int) error {
+	client, _, name, err := c.lookup(resource)
+	if err != nil {
+		return err
+	}
+	patch := fmt.Sprintf(`{"spec":{"replicas":%d}}`, replicas)
+	if _, err := client.Patch(c.ctx, name, types.MergePatchType, []byte(patch), metav1.PatchOptions{}, "scale"); err != nil {
+		return fmt.Errorf("failed to scale '%s': %w", resource, err)
+	}
+	return nil
+}
+
+// Action IDs under which Register adds the Kubernetes actions to a registry.
+const (
+	ApplyID    = "k8s.apply"
+	DeleteID   = "k8s.delete"
+	WaitID     = "k8s.wait"
+	ScaleID    = "k8s.scale"
+	RollbackID = "k8s.rollback"
+)
+
+// Params configure the k8s actions in a workflow definition. Namespace,
+// context and kubeconfig select the namespace and cluster the actions work on.
+// Apply and delete take either an inline manifest or a manifest file; wait
+// and scale take a resource such as "deployment/api".
+type Params struct {
+	Manifest    string `json:"manifest,omitempty"`
+	File        string `json:"file,omitempty"`
+	Resource    string `json:"resource,omitempty"`
+	Replicas    *int   `json:"replicas,omitempty"`
+	Namespace   string `json:"namespace,omitempty"`
+	Context     string `json:"context,omitempty"`
+	Kubeconfig  string `json:"kubeconfig,omitempty"`
+	RollbackKey string `json:"rollbackKey,omitempty"`
+	NoRollback  bool   `json:"noRollback,omitempty"`
+	// Timeout is a duration such as "5m"
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// options returns the options shared by every Kubernetes action.
+func (p Params) options() ([]Option, error) {
+	var opts []Option
+	if p.Namespace != "" {
+		opts = append(opts, WithNamespace(p.Namespace))
+	}
+	if p.Context != "" {
+		opts = append(opts, WithKubeContext(p.Context))
+	}
+	if p.Kubeconfig != "" {
+		opts = append(opts, WithKubeconfig(p.Kubeconfig))
+	}
+	if p.RollbackKey != "" {
+		opts = append(opts, WithRollbackKey(p.RollbackKey))
+	}
+	if p.NoRollback {
+		opts = append(opts, NoRollback())
+	}
+	if p.Timeout != "" {
+		timeout, err := time.ParseDuration(p.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout: %w", err)
+		}
+		opts = append(opts, WithTimeout(timeout))
+	}
+	return opts, nil
+}
+
+// manifest builds the action for either an inline manifest or a manifest
+// file, requiring exactly one.
+func (p Params) manifest(id string, inline, file func(name, source string, opts ...Option) *K8sAction, opts []Option) (gostage.Action, error) {
+	if (p.Manifest == "") == (p.File == "") {
+		return nil, errors.New("exactly one of the manifest and file parameters is required")
+	}
+	if p.File != "" {
+		return file(id, p.File, opts...), nil
+	}
+	return inline(id, p.Manifest, opts...), nil
+}
+
+// Register adds the Kubernetes actions to registry, so that declarative
+// definitions can use them. The options, such as WithClient, apply to every
+// action built from a definition, before its parameters.
+func Register(registry *gostage.ActionRegistry, opts ...Option) error {
+	register := func(id string, build func(p Params, opts []Option) (gostage.Action, error)) error {
+		return gostage.RegisterTyped(registry, id, func(p Params) (gostage.Action, error) {
+			params, err := p.options()
+			if err != nil {
+				return nil, err
+			}
+			return build(p, append(append([]Option{}, opts...), params...))
+		})
+	}
+
+	return errors.Join(
+		register(ApplyID, func(p Params, opts []Option) (gostage.Action, error) {
+			return p.manifest(ApplyID, Apply, ApplyFile, opts)
+		}),
+		register(DeleteID, func(p Params, opts []Option) (gostage.Action, error) {
+			return p.manifest(DeleteID, Delete, DeleteFile, opts)
+		}),
+		register(WaitID, func(p Params, opts []Option) (gostage.Action, error) {
+			if p.Resource == "" {
+				return nil, errors.New("the resource parameter is required")
+			}
+			return WaitReady(WaitID, p.Resource, opts...), nil
+		}),
+		register(ScaleID, func(p Params, opts []Option) (gostage.Action, error) {
+			if p.Resource == "" {
+				return nil, errors.New("the resource parameter is required")
+			}
+			if p.Replicas == nil {
+				return nil, errors.New("the replicas parameter is required")
+			}
+			return Scale(ScaleID, p.Resource, *p.Replicas, opts...), nil
+		}),
+		register(RollbackID, func(p Params, opts []Option) (gostage.Action, error) {
+			return Rollback(RollbackID, opts...), nil
+		}),
+	)
+}
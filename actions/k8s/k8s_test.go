@@ -0,0 +1,323 @@
+package k8s
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/davidroman0O/gostage/gostagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const manifest = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: existing
+data:
+  version: "{{ .store.version }}"
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+  namespace: "{{ .store.env }}"
+spec:
+  replicas: 1
+`
+
+var (
+	configMaps  = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	pods        = schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	deployments = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+)
+
+// object builds an unstructured object from its JSON form.
+func object(t *testing.T, data string) *unstructured.Unstructured {
+	t.Helper()
+	o := &unstructured.Unstructured{}
+	require.NoError(t, o.UnmarshalJSON([]byte(data)))
+	return o
+}
+
+// newCluster returns a fake cluster holding objects, which applies objects as
+// the API server does by creating or replacing them, and a mapper of the kinds
+// the tests use.
+func newCluster(t *testing.T, objects ...*unstructured.Unstructured) (*fake.FakeDynamicClient, meta.RESTMapper) {
+	t.Helper()
+	initial := make([]runtime.Object, len(objects))
+	for i, o := range objects {
+		initial[i] = o
+	}
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), initial...)
+	client.PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		if patch.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+		applied := &unstructured.Unstructured{}
+		if err := applied.UnmarshalJSON(patch.GetPatch()); err != nil {
+			return true, nil, err
+		}
+		tracker := client.Tracker()
+		if _, err := tracker.Get(action.GetResource(), action.GetNamespace(), patch.GetName()); apierrors.IsNotFound(err) {
+			return true, applied, tracker.Create(action.GetResource(), applied, action.GetNamespace())
+		}
+		return true, applied, tracker.Update(action.GetResource(), applied, action.GetNamespace())
+	})
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Pod"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "batch", Version: "v1", Kind: "Job"}, meta.RESTScopeNamespace)
+	return client, mapper
+}
+
+// calls describes the requests the client received, as "verb namespace resource/name[/subresource]".
+func calls(client *fake.FakeDynamicClient) []string {
+	var described []string
+	for _, action := range client.Actions() {
+		call := action.GetVerb() + " " + action.GetNamespace() + " " + action.GetResource().Resource + "/"
+		switch action := action.(type) {
+		case k8stesting.GetAction:
+			call += action.GetName()
+		case k8stesting.PatchAction:
+			call += action.GetName()
+		case k8stesting.DeleteAction:
+			call += action.GetName()
+		}
+		if action.GetSubresource() != "" {
+			call += "/" + action.GetSubresource()
+		}
+		described = append(described, call)
+	}
+	return described
+}
+
+// get returns the object name in namespace, or nil if it does not exist.
+func get(t *testing.T, client *fake.FakeDynamicClient, gvr schema.GroupVersionResource, namespace, name string) *unstructured.Unstructured {
+	t.Helper()
+	o, err := client.Tracker().Get(gvr, namespace, name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	require.NoError(t, err)
+	return o.(*unstructured.Unstructured)
+}
+
+// staging is the initial store of the deployments run by the tests.
+var staging = map[string]interface{}{"env": "staging", "version": "v2"}
+
+func TestRollbackOnFailure(t *testing.T) {
+	client, mapper := newCluster(t,
+		object(t, `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"existing","namespace":"staging","resourceVersion":"7","uid":"abc"},"data":{"version":"old"}}`),
+		object(t, `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web","namespace":"staging"},"spec":{"replicas":2}}`),
+		object(t, `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"broken","namespace":"staging","generation":3},
+			"status":{"observedGeneration":3,"conditions":[{"type":"Progressing","status":"False","reason":"ProgressDeadlineExceeded"}]}}`),
+	)
+	opts := []Option{WithClient(client, mapper), WithNamespace("{{ .store.env }}")}
+
+	deploy := gostage.NewStage("deploy", "Deploy", "")
+	deploy.AddAction(Apply("apply", manifest, opts...))
+	deploy.AddAction(Scale("scale", "deployment/web", 5, opts...))
+	deploy.AddAction(WaitReady("ready", "deployment/broken", append(opts, WithTimeout(time.Minute))...))
+
+	result := gostagetest.RunStages(t, staging, deploy, RollbackStage("rollback", WithClient(client, mapper)))
+	require.False(t, result.Success)
+	assert.ErrorContains(t, result.Error, `deployment "broken" exceeded its progress deadline`)
+	assert.Equal(t, gostage.StatusCompleted, result.StageStatuses["rollback"])
+	assert.NotContains(t, result.FinalStore, RollbackKey)
+
+	assert.Equal(t, []string{
+		"get staging configmaps/existing",
+		"get staging deployments/api",
+		"patch staging configmaps/existing",
+		"patch staging deployments/api",
+		"get staging deployments/web/scale",
+		"patch staging deployments/web/scale",
+		"get staging deployments/broken",
+		// Rollback reverts in reverse order
+		"patch staging deployments/web/scale",
+		"delete staging deployments/api",
+		"patch staging configmaps/existing",
+	}, calls(client))
+
+	restored := get(t, client, configMaps, "staging", "existing")
+	require.NotNil(t, restored)
+	version, _, _ := unstructured.NestedString(restored.Object, "data", "version")
+	assert.Equal(t, "old", version)
+	assert.Empty(t, restored.GetUID())
+	assert.Nil(t, get(t, client, deployments, "staging", "api"))
+	replicas, _, _ := unstructured.NestedInt64(get(t, client, deployments, "staging", "web").Object, "spec", "replicas")
+	assert.Equal(t, int64(2), replicas)
+}
+
+func TestNoRollbackOnSuccess(t *testing.T) {
+	client, mapper := newCluster(t,
+		object(t, `{"apiVersion":"v1","kind":"Pod","metadata":{"name":"job","namespace":"default"}}`),
+		object(t, `{"apiVersion":"batch/v1","kind":"Job","metadata":{"name":"migrate","namespace":"default"},
+			"status":{"conditions":[{"type":"Complete","status":"True"}]}}`),
+		object(t, `{"apiVersion":"v1","kind":"Pod","metadata":{"name":"api","namespace":"default"},
+			"status":{"conditions":[{"type":"Ready","status":"True"}]}}`),
+	)
+	// The pod only reports ready on the third check
+	checks := 0
+	client.PrependReactor("get", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.(k8stesting.GetAction).GetName() != "api" {
+			return false, nil, nil
+		}
+		if checks++; checks < 3 {
+			return true, object(t, `{"apiVersion":"v1","kind":"Pod","metadata":{"name":"api","namespace":"default"}}`), nil
+		}
+		return false, nil, nil
+	})
+	opts := []Option{WithClient(client, mapper), WithPollInterval(time.Millisecond)}
+
+	deploy := gostage.NewStage("deploy", "Deploy", "")
+	deploy.AddAction(Apply("apply", manifest, append(opts, WithRollbackKey("changes"))...))
+	deploy.AddAction(Delete("delete", `{"apiVersion":"v1","kind":"Pod","metadata":{"name":"job"}}`, append(opts, NoRollback())...))
+	deploy.AddAction(WaitReady("job", "job/migrate", opts...))
+	deploy.AddAction(WaitReady("pod", "pod/api", append(opts, WithTimeout(time.Minute))...))
+
+	result := gostagetest.RunStages(t, staging, deploy, RollbackStage("rollback", WithClient(client, mapper), WithRollbackKey("changes")))
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Len(t, result.FinalStore["changes"], 2)
+	assert.Equal(t, 3, checks)
+
+	assert.Nil(t, get(t, client, pods, "default", "job"))
+	applied := get(t, client, configMaps, "default", "existing")
+	require.NotNil(t, applied)
+	version, _, _ := unstructured.NestedString(applied.Object, "data", "version")
+	assert.Equal(t, "v2", version)
+	assert.NotNil(t, get(t, client, deployments, "staging", "api"))
+}
+
+func TestWaitReadyTimeout(t *testing.T) {
+	client, mapper := newCluster(t, object(t, `{"apiVersion":"v1","kind":"Pod","metadata":{"name":"api","namespace":"default"}}`))
+
+	result := gostagetest.RunActions(t, nil, WaitReady("pod", "pod/api",
+		WithClient(client, mapper), WithPollInterval(time.Millisecond), WithTimeout(20*time.Millisecond)))
+	require.False(t, result.Success)
+	assert.ErrorContains(t, result.Error, "stopped waiting for pod/api")
+
+	result = gostagetest.RunActions(t, nil, WaitReady("missing", "pod/missing", WithClient(client, mapper)))
+	assert.True(t, apierrors.IsNotFound(errors.Unwrap(result.Error)), "%v", result.Error)
+
+	result = gostagetest.RunActions(t, nil, WaitReady("kind", "gadget/api", WithClient(client, mapper)))
+	assert.ErrorContains(t, result.Error, "failed to find the resource of 'gadget/api'")
+}
+
+func TestReady(t *testing.T) {
+	tests := []struct {
+		name  string
+		kind  schema.GroupKind
+		state string
+		ready bool
+		err   string
+	}{
+		{"rolling deployment", schema.GroupKind{Group: "apps", Kind: "Deployment"},
+			`{"metadata":{"generation":2},"spec":{"replicas":3},"status":{"observedGeneration":2,"replicas":4,"updatedReplicas":3,"availableReplicas":3}}`, false, ""},
+		{"rolled out deployment", schema.GroupKind{Group: "apps", Kind: "Deployment"},
+			`{"metadata":{"generation":2},"spec":{"replicas":3},"status":{"observedGeneration":2,"replicas":3,"updatedReplicas":3,"availableReplicas":3}}`, true, ""},
+		{"unobserved deployment", schema.GroupKind{Group: "apps", Kind: "Deployment"},
+			`{"metadata":{"generation":3},"spec":{"replicas":3},"status":{"observedGeneration":2,"replicas":3,"updatedReplicas":3,"availableReplicas":3}}`, false, ""},
+		{"updating stateful set", schema.GroupKind{Group: "apps", Kind: "StatefulSet"},
+			`{"metadata":{"generation":1},"spec":{"replicas":2},"status":{"observedGeneration":1,"readyReplicas":2,"currentRevision":"a","updateRevision":"b"}}`, false, ""},
+		{"partitioned stateful set", schema.GroupKind{Group: "apps", Kind: "StatefulSet"},
+			`{"metadata":{"generation":1},"spec":{"replicas":3,"updateStrategy":{"rollingUpdate":{"partition":2}}},"status":{"observedGeneration":1,"readyReplicas":3,"updatedReplicas":1}}`, true, ""},
+		{"daemon set", schema.GroupKind{Group: "apps", Kind: "DaemonSet"},
+			`{"status":{"desiredNumberScheduled":4,"updatedNumberScheduled":4,"numberAvailable":3}}`, false, ""},
+		{"failed job", schema.GroupKind{Group: "batch", Kind: "Job"},
+			`{"metadata":{"name":"migrate"},"status":{"conditions":[{"type":"Failed","status":"True","reason":"BackoffLimitExceeded"}]}}`, false, `job "migrate" failed: BackoffLimitExceeded`},
+		{"ready node", schema.GroupKind{Kind: "Node"},
+			`{"status":{"conditions":[{"type":"Ready","status":"True"}]}}`, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := &unstructured.Unstructured{}
+			require.NoError(t, utiljson.Unmarshal([]byte(tt.state), &state.Object))
+			ok, err := ready(tt.kind, state)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.ready, ok)
+		})
+	}
+}
+
+func TestDecodeManifest(t *testing.T) {
+	objects, err := decodeManifest(`{"apiVersion":"v1","kind":"List","items":[{"apiVersion":"v1","kind":"Service","metadata":{"name":"api","labels":{"app":"api"}},"spec":{"ports":[{"port":80}]}}]}`)
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	assert.Equal(t, map[string]interface{}{"apiVersion": "v1", "kind": "Service", "metadata": map[string]interface{}{"name": "api"}}, reference(objects[0]))
+	ports, _, _ := unstructured.NestedSlice(objects[0].Object, "spec", "ports")
+	assert.Equal(t, int64(80), ports[0].(map[string]interface{})["port"])
+
+	_, err = decodeManifest("---\n# nothing\n")
+	assert.ErrorContains(t, err, "manifest has no objects")
+	_, err = decodeManifest("kind: Service\n")
+	assert.ErrorContains(t, err, "without apiVersion, kind or metadata.name")
+	_, err = decodeManifest("kind: [")
+	assert.ErrorContains(t, err, "failed to parse manifest")
+}
+
+func TestRegisteredK8sActions(t *testing.T) {
+	client, mapper := newCluster(t, object(t, `{"apiVersion":"batch/v1","kind":"Job","metadata":{"name":"migrate","namespace":"staging"},
+		"status":{"conditions":[{"type":"Complete","status":"True"}]}}`))
+	registry := gostage.NewActionRegistry()
+	require.NoError(t, Register(registry, WithClient(client, mapper)))
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app.yaml"), []byte(manifest), 0o644))
+
+	def := &gostage.SubWorkflowDef{
+		ID:           "defined",
+		InitialStore: map[string]interface{}{"dir": dir, "env": "staging", "version": "v3"},
+		Stages: []gostage.StageDef{{
+			ID: "run",
+			Actions: []gostage.ActionDef{
+				{ID: ApplyID, Params: map[string]interface{}{"file": "{{ .store.dir }}/app.yaml", "namespace": "{{ .store.env }}"}},
+				{ID: ScaleID, Params: map[string]interface{}{"resource": "deployment/api", "replicas": 3, "noRollback": true, "namespace": "staging"}},
+				{ID: WaitID, Params: map[string]interface{}{"resource": "jobs.batch/migrate", "timeout": "2m", "namespace": "staging"}},
+			},
+		}},
+	}
+	wf, err := gostage.NewWorkflowFromDefWithRegistry(def, registry)
+	require.NoError(t, err)
+
+	result := gostage.NewRunner().ExecuteWithOptions(wf, gostage.DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	version, _, _ := unstructured.NestedString(get(t, client, configMaps, "staging", "existing").Object, "data", "version")
+	assert.Equal(t, "v3", version)
+	replicas, _, _ := unstructured.NestedInt64(get(t, client, deployments, "staging", "api").Object, "spec", "replicas")
+	assert.Equal(t, int64(3), replicas)
+
+	_, err = registry.Resolve(ApplyID, map[string]interface{}{})
+	assert.ErrorContains(t, err, "exactly one of the manifest and file parameters is required")
+	_, err = registry.Resolve(ScaleID, map[string]interface{}{"resource": "deployment/api"})
+	assert.ErrorContains(t, err, "the replicas parameter is required")
+	_, err = registry.Resolve(WaitID, map[string]interface{}{"resource": "deployment/api", "timeout": "soon"})
+	assert.ErrorContains(t, err, "invalid timeout")
+}
+
+func TestKubeconfig(t *testing.T) {
+	result := gostagetest.RunActions(t, map[string]interface{}{"dir": t.TempDir()},
+		Apply("apply", manifest, WithKubeconfig("{{ .store.dir }}/missing")))
+	require.False(t, result.Success)
+	assert.ErrorContains(t, result.Error, "failed to load kubeconfig")
+}
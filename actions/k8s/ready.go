@@ -0,0 +1,101 @@
+package k8s
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ready reports whether object, of kind, is ready, following the checks of
+// kubectl rollout status and kubectl wait. It fails for a deployment that
+// exceeded its progress deadline and for a failed job.
+func ready(kind schema.GroupKind, object *unstructured.Unstructured) (bool, error) {
+	generation := object.GetGeneration()
+	observed := field(object, "status", "observedGeneration")
+
+	switch kind {
+	case schema.GroupKind{Group: "apps", Kind: "Deployment"}:
+		if generation > observed {
+			return false, nil
+		}
+		if condition(object, "Progressing") == "False" && reason(object, "Progressing") == "ProgressDeadlineExceeded" {
+			return false, fmt.Errorf("deployment %q exceeded its progress deadline", object.GetName())
+		}
+		updated := field(object, "status", "updatedReplicas")
+		if replicas, ok := specReplicas(object); ok && updated < replicas {
+			return false, nil
+		}
+		return field(object, "status", "replicas") <= updated && field(object, "status", "availableReplicas") >= updated, nil
+
+	case schema.GroupKind{Group: "apps", Kind: "StatefulSet"}:
+		if observed == 0 || generation > observed {
+			return false, nil
+		}
+		replicas, ok := specReplicas(object)
+		if ok && field(object, "status", "readyReplicas") < replicas {
+			return false, nil
+		}
+		if partition, found, _ := unstructured.NestedInt64(object.Object, "spec", "updateStrategy", "rollingUpdate", "partition"); found && ok {
+			return field(object, "status", "updatedReplicas") >= replicas-partition, nil
+		}
+		current, _, _ := unstructured.NestedString(object.Object, "status", "currentRevision")
+		update, _, _ := unstructured.NestedString(object.Object, "status", "updateRevision")
+		return current == update, nil
+
+	case schema.GroupKind{Group: "apps", Kind: "DaemonSet"}:
+		if generation > observed {
+			return false, nil
+		}
+		desired := field(object, "status", "desiredNumberScheduled")
+		return field(object, "status", "updatedNumberScheduled") >= desired && field(object, "status", "numberAvailable") >= desired, nil
+
+	case schema.GroupKind{Group: "batch", Kind: "Job"}:
+		if condition(object, "Failed") == "True" {
+			return false, fmt.Errorf("job %q failed: %s", object.GetName(), reason(object, "Failed"))
+		}
+		return condition(object, "Complete") == "True", nil
+
+	default:
+		return condition(object, "Ready") == "True", nil
+	}
+}
+
+// field returns the integer at path in object, or 0 if it is not set.
+func field(object *unstructured.Unstructured, path ...string) int64 {
+	value, _, _ := unstructured.NestedInt64(object.Object, path...)
+	return value
+}
+
+// specReplicas returns the desired replica count of object, if set.
+func specReplicas(object *unstructured.Unstructured) (int64, bool) {
+	replicas, found, _ := unstructured.NestedInt64(object.Object, "spec", "replicas")
+	return replicas, found
+}
+
+// condition returns the status of the condition of type name of object, or
+// "" if it has none.
+func condition(object *unstructured.Unstructured, name string) string {
+	status, _ := conditionField(object, name, "status")
+	return status
+}
+
+// reason returns the reason of the condition of type name of object.
+func reason(object *unstructured.Unstructured, name string) string {
+	value, _ := conditionField(object, name, "reason")
+	return value
+}
+
+// conditionField returns a field of the condition of type name of object.
+func conditionField(object *unstructured.Unstructured, name, key string) (string, bool) {
+	conditions, _, _ := unstructured.NestedSlice(object.Object, "status", "conditions")
+	for _, item := range conditions {
+		c, ok := item.(map[string]interface{})
+		if !ok || c["type"] != name {
+			continue
+		}
+		value, ok := c[key].(string)
+		return value, ok
+	}
+	return "", false
+}
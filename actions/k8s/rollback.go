@@ -0,0 +1,220 @@
+package k8s
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/davidroman0O/gostage/store"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+)
+
+// RollbackKey is the default store key under which changes are recorded.
+const RollbackKey = "k8s.rollback"
+
+// Change is a change made to a cluster, recorded so Rollback can revert it.
+// It either describes an object, with its state before the change, or the
+// replica count of a scaled resource.
+type Change struct {
+	// Namespace is the namespace of the action, used for objects that do not name one
+	Namespace string `json:"namespace,omitempty"`
+	// Object identifies the changed object by apiVersion, kind, name and namespace
+	Object map[string]interface{} `json:"object,omitempty"`
+	// Previous is the object before the change, or nil if it did not exist
+	Previous map[string]interface{} `json:"previous,omitempty"`
+	// Resource is the scaled resource, such as "deployment/api"
+	Resource string `json:"resource,omitempty"`
+	// Replicas is the replica count of Resource before it was scaled
+	Replicas *int `json:"replicas,omitempty"`
+}
+
+// record stores the current state of objects, unless the action does not
+// roll back.
+func (a *K8sAction) record(ctx *gostage.ActionContext, c *cluster, objects []*unstructured.Unstructured) error {
+	if a.noRollback {
+		return nil
+	}
+	changes := make([]Change, 0, len(objects))
+	for _, object := range objects {
+		current, err := c.get(object)
+		if err != nil {
+			return err
+		}
+		change := Change{Namespace: c.namespace, Object: reference(object)}
+		if current != nil {
+			change.Previous = current.Object
+			stripServerFields(change.Previous)
+		}
+		changes = append(changes, change)
+	}
+	return a.addChanges(ctx, changes...)
+}
+
+// addChanges appends changes to the ones recorded under the rollback key.
+func (a *K8sAction) addChanges(ctx *gostage.ActionContext, changes ...Change) error {
+	recorded, err := store.Get[[]Change](ctx.Store(), a.rollbackKey)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("failed to read recorded changes: %w", err)
+	}
+	return ctx.Store().Put(a.rollbackKey, append(recorded, changes...))
+}
+
+// Rollback creates an action reverting, in reverse order, the changes
+// recorded under the rollback key when the workflow failed or was
+// interrupted. It does nothing when the workflow is still successful. Every
+// change is attempted even if some fail, and the record is removed afterwards.
+// The kubeconfig, kube context and client options apply; namespaces come from
+// the recorded changes.
+func Rollback(name string, opts ...Option) *K8sAction {
+	a := newK8sAction(name, "Rolls back Kubernetes changes", nil, opts)
+	a.op = func(ctx *gostage.ActionContext, c *cluster) error {
+		status := ctx.Run().Status
+		if status != gostage.StatusFailed && status != gostage.StatusInterrupted {
+			return nil
+		}
+		changes, err := store.Get[[]Change](ctx.Store(), a.rollbackKey)
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read recorded changes: %w", err)
+		}
+
+		var errs []error
+		for i := len(changes) - 1; i >= 0; i-- {
+			if err := revert(ctx, c.inNamespace(changes[i].Namespace), changes[i]); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		ctx.Store().Delete(a.rollbackKey)
+		return errors.Join(errs...)
+	}
+	return a
+}
+
+// RollbackStage returns a stage tagged with gostage.TagAlwaysRun holding a
+// Rollback action, to be added last to a workflow.
+func RollbackStage(id string, opts ...Option) *gostage.Stage {
+	stage := gostage.NewStageWithTags(id, "Rollback", "Rolls back Kubernetes changes when the workflow fails",
+		[]string{gostage.TagAlwaysRun})
+	stage.AddAction(Rollback(id, opts...))
+	return stage
+}
+
+// revert undoes one change.
+func revert(ctx *gostage.ActionContext, c *cluster, change Change) error {
+	switch {
+	case change.Replicas != nil:
+		ctx.Logger.Info("Rolling back %s to %d replicas", change.Resource, *change.Replicas)
+		return c.scale(change.Resource, *change.Replicas)
+	case change.Previous != nil:
+		ctx.Logger.Info("Restoring %s", describe(change.Object))
+		return c.apply(&unstructured.Unstructured{Object: change.Previous})
+	default:
+		ctx.Logger.Info("Deleting %s", describe(change.Object))
+		return c.delete(&unstructured.Unstructured{Object: change.Object})
+	}
+}
+
+// decodeManifest returns the objects of manifest, a stream of YAML or JSON
+// documents. Lists are flattened into their items.
+func decodeManifest(manifest string) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+	var add func(doc map[string]interface{}) error
+	add = func(doc map[string]interface{}) error {
+		if items, ok := doc["items"].([]interface{}); ok && doc["kind"] == "List" {
+			for _, item := range items {
+				object, ok := item.(map[string]interface{})
+				if !ok {
+					return errors.New("manifest has a list item that is not an object")
+				}
+				if err := add(object); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		// Round-trip through JSON so numbers become the int64 and float64
+		// values unstructured objects hold
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return fmt.Errorf("failed to encode object: %w", err)
+		}
+		object := &unstructured.Unstructured{}
+		if err := utiljson.Unmarshal(data, &object.Object); err != nil {
+			return fmt.Errorf("failed to decode object: %w", err)
+		}
+		if object.GetAPIVersion() == "" || object.GetKind() == "" || object.GetName() == "" {
+			return errors.New("manifest has an object without apiVersion, kind or metadata.name")
+		}
+		objects = append(objects, object)
+		return nil
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader([]byte(manifest)))
+	for {
+		var doc map[string]interface{}
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse manifest: %w", err)
+		}
+		if doc == nil {
+			continue
+		}
+		if err := add(doc); err != nil {
+			return nil, err
+		}
+	}
+	if len(objects) == 0 {
+		return nil, errors.New("manifest has no objects")
+	}
+	return objects, nil
+}
+
+// reference returns the apiVersion, kind, name and namespace of object.
+func reference(object *unstructured.Unstructured) map[string]interface{} {
+	metadata := map[string]interface{}{"name": object.GetName()}
+	if namespace := object.GetNamespace(); namespace != "" {
+		metadata["namespace"] = namespace
+	}
+	return map[string]interface{}{
+		"apiVersion": object.GetAPIVersion(),
+		"kind":       object.GetKind(),
+		"metadata":   metadata,
+	}
+}
+
+// stripServerFields removes the fields set by the API server from object, so
+// it can be applied again.
+func stripServerFields(object map[string]interface{}) {
+	delete(object, "status")
+	metadata, ok := object["metadata"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, field := range []string{"resourceVersion", "uid", "creationTimestamp", "generation", "managedFields", "selfLink"} {
+		delete(metadata, field)
+	}
+	if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+		delete(annotations, "kubectl.kubernetes.io/last-applied-configuration")
+		delete(annotations, "deployment.kubernetes.io/revision")
+		if len(annotations) == 0 {
+			delete(metadata, "annotations")
+		}
+	}
+}
+
+// describe returns "kind/name" for an object reference.
+func describe(object map[string]interface{}) string {
+	metadata, _ := object["metadata"].(map[string]interface{})
+	return fmt.Sprintf("%v/%v", object["kind"], metadata["name"])
+}
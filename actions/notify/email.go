@@ -0,0 +1,127 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPConfig describes the server an email is sent through.
+type SMTPConfig struct {
+	// Addr is the host:port of the server
+	Addr string
+	// Username and Password authenticate with PLAIN auth when Username is set,
+	// which the server must offer over TLS unless it runs on localhost
+	Username string
+	Password string
+	// From is the sender address
+	From string
+}
+
+// Email creates an action sending a plain text email through server to the
+// comma-separated addresses in to. The recipients, the subject and the body
+// are rendered as templates. The connection is upgraded with STARTTLS when
+// the server supports it.
+func Email(name string, server SMTPConfig, to, subject, body string, opts ...Option) *NotifyAction {
+	return newNotifyAction(name, "Emails "+to, func(ctx context.Context, a *NotifyAction, texts []string, _ map[string]string) error {
+		var recipients []string
+		for _, address := range strings.Split(texts[0], ",") {
+			if address = strings.TrimSpace(address); address != "" {
+				recipients = append(recipients, address)
+			}
+		}
+		if len(recipients) == 0 {
+			return errors.New("email has no recipients")
+		}
+		return sendMail(ctx, server, recipients, emailMessage(server.From, recipients, texts[1], texts[2]))
+	}, []string{to, subject, body}, opts)
+}
+
+// emailMessage formats a plain text message. Line breaks are removed from the
+// header values so that rendered values cannot add headers.
+func emailMessage(from string, to []string, subject, body string) []byte {
+	header := func(value string) string {
+		return strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", header(from))
+	fmt.Fprintf(&msg, "To: %s\r\n", header(strings.Join(to, ", ")))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", header(subject)))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(msg.String())
+}
+
+// sendMail delivers msg like smtp.SendMail, aborting when ctx is done.
+func sendMail(ctx context.Context, server SMTPConfig, to []string, msg []byte) error {
+	host, _, err := net.SplitHostPort(server.Addr)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP address '%s': %w", server.Addr, err)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to greet SMTP server: %w", err)
+	}
+	defer client.Close()
+
+	if err := deliver(client, host, server, to, msg); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("failed to send email: %w", ctx.Err())
+		}
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// deliver runs the SMTP conversation on an established client.
+func deliver(client *smtp.Client, host string, server SMTPConfig, to []string, msg []byte) error {
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if server.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", server.Username, server.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(server.From); err != nil {
+		return err
+	}
+	for _, address := range to {
+		if err := client.Rcpt(address); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
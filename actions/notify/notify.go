@@ -0,0 +1,290 @@
+// Package notify provides actions that announce the progress of a workflow:
+// posting to a Slack incoming webhook, sending an email over SMTP and calling
+// a generic HTTP webhook.
+//
+// Messages, addresses, URLs and headers are rendered as templates when the
+// action runs. Store values are exposed under .store and the run of the action
+// under .run, so a notification placed in an always-run stage can report a
+// failure:
+//
+//	report := gostage.NewStage("report", "Report", "")
+//	report.AddTag(gostage.TagAlwaysRun)
+//	report.AddAction(notify.Slack("announce", "{{ .store.slackWebhook }}",
+//		"{{ .run.WorkflowName }} finished as {{ .run.Status }} {{ .run.FailedStages }}"))
+//
+// A notification that cannot be delivered fails the action, unless it was
+// created with BestEffort, in which case the failure is only logged.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+)
+
+// NotifyAction sends a notification whose contents are rendered from the
+// store and the run.
+type NotifyAction struct {
+	gostage.BaseAction
+
+	texts      []string
+	headers    map[string]string
+	method     string
+	client     *http.Client
+	timeout    time.Duration
+	bestEffort bool
+	send       func(ctx context.Context, a *NotifyAction, texts []string, headers map[string]string) error
+}
+
+// Option configures a NotifyAction.
+type Option func(*NotifyAction)
+
+// WithHTTPClient sets the client used by the Slack and webhook actions,
+// http.DefaultClient otherwise.
+func WithHTTPClient(client *http.Client) Option {
+	return func(a *NotifyAction) {
+		a.client = client
+	}
+}
+
+// WithMethod sets the HTTP method of a webhook, POST by default.
+func WithMethod(method string) Option {
+	return func(a *NotifyAction) {
+		a.method = method
+	}
+}
+
+// WithHeader adds a header to the request of a webhook. The value is
+// rendered as a template. A Content-Type header replaces the default
+// application/json one.
+func WithHeader(key, value string) Option {
+	return func(a *NotifyAction) {
+		a.headers[http.CanonicalHeaderKey(key)] = value
+	}
+}
+
+// WithTimeout bounds how long delivering the notification may take.
+func WithTimeout(timeout time.Duration) Option {
+	return func(a *NotifyAction) {
+		a.timeout = timeout
+	}
+}
+
+// BestEffort makes the action log a warning instead of failing when the
+// notification cannot be rendered or delivered.
+func BestEffort() Option {
+	return func(a *NotifyAction) {
+		a.bestEffort = true
+	}
+}
+
+// newNotifyAction creates an action calling send with the rendered texts.
+func newNotifyAction(name, description string, send func(ctx context.Context, a *NotifyAction, texts []string, headers map[string]string) error, texts []string, opts []Option) *NotifyAction {
+	a := &NotifyAction{
+		BaseAction: gostage.NewBaseAction(name, description),
+		texts:      texts,
+		headers:    make(map[string]string),
+		method:     http.MethodPost,
+		client:     http.DefaultClient,
+		send:       send,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Execute renders the notification and delivers it.
+func (a *NotifyAction) Execute(ctx *gostage.ActionContext) error {
+	err := a.notify(ctx)
+	if err != nil && a.bestEffort {
+		ctx.Logger.Warn("Notification %s was not sent: %v", a.Name(), err)
+		return nil
+	}
+	return err
+}
+
+func (a *NotifyAction) notify(ctx *gostage.ActionContext) error {
+	texts := make([]string, len(a.texts))
+	for i, text := range a.texts {
+		rendered, err := ctx.Render(text)
+		if err != nil {
+			return fmt.Errorf("failed to render notification: %w", err)
+		}
+		texts[i] = rendered
+	}
+	headers := make(map[string]string, len(a.headers))
+	for key, value := range a.headers {
+		rendered, err := ctx.Render(value)
+		if err != nil {
+			return fmt.Errorf("failed to render header %s: %w", key, err)
+		}
+		headers[key] = rendered
+	}
+
+	sendCtx := ctx.GoContext
+	if sendCtx == nil {
+		sendCtx = context.Background()
+	}
+	if a.timeout > 0 {
+		var cancel context.CancelFunc
+		sendCtx, cancel = context.WithTimeout(sendCtx, a.timeout)
+		defer cancel()
+	}
+	return a.send(sendCtx, a, texts, headers)
+}
+
+// Slack creates an action posting text to a Slack incoming webhook. Both the
+// webhook URL and the text are rendered as templates.
+func Slack(name, webhookURL, text string, opts ...Option) *NotifyAction {
+	return newNotifyAction(name, "Posts to Slack", func(ctx context.Context, a *NotifyAction, texts []string, headers map[string]string) error {
+		body, err := json.Marshal(map[string]string{"text": texts[1]})
+		if err != nil {
+			return fmt.Errorf("failed to encode Slack message: %w", err)
+		}
+		headers["Content-Type"] = "application/json"
+		return a.post(ctx, http.MethodPost, texts[0], body, headers)
+	}, []string{webhookURL, text}, opts)
+}
+
+// Webhook creates an action sending body to url, with POST unless WithMethod
+// is given. The URL, the body and the header values are rendered as
+// templates. Responses with a status outside of 2xx fail the action.
+func Webhook(name, url, body string, opts ...Option) *NotifyAction {
+	return newNotifyAction(name, "Calls "+url, func(ctx context.Context, a *NotifyAction, texts []string, headers map[string]string) error {
+		if _, ok := headers["Content-Type"]; !ok && texts[1] != "" {
+			headers["Content-Type"] = "application/json"
+		}
+		return a.post(ctx, a.method, texts[0], []byte(texts[1]), headers)
+	}, []string{url, body}, opts)
+}
+
+// post sends an HTTP request and checks its response status.
+func (a *NotifyAction) post(ctx context.Context, method, url string, body []byte, headers map[string]string) error {
+	if url == "" {
+		return errors.New("notification URL rendered empty")
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid notification request: %w", err)
+	}
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		req.Header.Set(key, headers[key])
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		reply, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		msg := fmt.Sprintf("notification endpoint returned %s", resp.Status)
+		if reply := strings.TrimSpace(string(reply)); reply != "" {
+			msg += ": " + reply
+		}
+		return errors.New(msg)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// Action IDs under which Register adds the notification actions to a registry.
+const (
+	SlackID   = "notify.slack"
+	EmailID   = "notify.email"
+	WebhookID = "notify.webhook"
+)
+
+// Params configure the notify actions in a workflow definition.
+// Slack posts text to url. Webhook sends body to url with method and headers.
+// Email sends subject and body to the comma-separated addresses in to, from
+// from, through the SMTP server at addr.
+type Params struct {
+	URL     string            `json:"url,omitempty"`
+	Text    string            `json:"text,omitempty"`
+	Method  string            `json:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+
+	Addr     string `json:"addr,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	From     string `json:"from,omitempty"`
+	To       string `json:"to,omitempty"`
+	Subject  string `json:"subject,omitempty"`
+
+	// Timeout is a duration such as "10s"
+	Timeout    string `json:"timeout,omitempty"`
+	BestEffort bool   `json:"bestEffort,omitempty"`
+}
+
+// options returns the options shared by every notification.
+func (p Params) options() ([]Option, error) {
+	var opts []Option
+	if p.Timeout != "" {
+		timeout, err := time.ParseDuration(p.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout: %w", err)
+		}
+		opts = append(opts, WithTimeout(timeout))
+	}
+	if p.BestEffort {
+		opts = append(opts, BestEffort())
+	}
+	return opts, nil
+}
+
+// Register adds the notification actions to registry, so that declarative
+// definitions can use them.
+func Register(registry *gostage.ActionRegistry) error {
+	register := func(id string, build func(p Params, opts []Option) gostage.Action, required ...string) error {
+		return gostage.RegisterTyped(registry, id, func(p Params) (gostage.Action, error) {
+			values := map[string]string{"url": p.URL, "text": p.Text, "addr": p.Addr, "from": p.From, "to": p.To}
+			for _, name := range required {
+				if values[name] == "" {
+					return nil, fmt.Errorf("the %s parameter is required", name)
+				}
+			}
+			opts, err := p.options()
+			if err != nil {
+				return nil, err
+			}
+			return build(p, opts), nil
+		})
+	}
+
+	return errors.Join(
+		register(SlackID, func(p Params, opts []Option) gostage.Action {
+			return Slack(SlackID, p.URL, p.Text, opts...)
+		}, "url", "text"),
+		register(WebhookID, func(p Params, opts []Option) gostage.Action {
+			if p.Method != "" {
+				opts = append(opts, WithMethod(p.Method))
+			}
+			for key, value := range p.Headers {
+				opts = append(opts, WithHeader(key, value))
+			}
+			return Webhook(WebhookID, p.URL, p.Body, opts...)
+		}, "url"),
+		register(EmailID, func(p Params, opts []Option) gostage.Action {
+			server := SMTPConfig{Addr: p.Addr, Username: p.Username, Password: p.Password, From: p.From}
+			return Email(EmailID, server, p.To, p.Subject, p.Body, opts...)
+		}, "addr", "from", "to"),
+	)
+}
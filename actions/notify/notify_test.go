@@ -0,0 +1,301 @@
+package notify
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/davidroman0O/gostage/gostagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// funcAction runs a function as an action.
+type funcAction struct {
+	gostage.BaseAction
+	fn func(ctx *gostage.ActionContext) error
+}
+
+func (a *funcAction) Execute(ctx *gostage.ActionContext) error {
+	return a.fn(ctx)
+}
+
+// recordedRequest is a request received by a test endpoint.
+type recordedRequest struct {
+	Method string
+	Header http.Header
+	Body   string
+}
+
+// endpoint starts a server recording requests and answering with status.
+func endpoint(t *testing.T, status int) (*httptest.Server, func() []recordedRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []recordedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, recordedRequest{Method: r.Method, Header: r.Header.Clone(), Body: string(body)})
+		mu.Unlock()
+		w.WriteHeader(status)
+		if status >= 300 {
+			io.WriteString(w, "invalid_token")
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []recordedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]recordedRequest(nil), requests...)
+	}
+}
+
+func TestSlackReportsFailure(t *testing.T) {
+	server, requests := endpoint(t, http.StatusOK)
+
+	wf := gostage.NewWorkflow("release", "Release", "")
+	build := gostage.NewStage("build", "Build", "")
+	build.AddAction(&funcAction{BaseAction: gostage.NewBaseAction("compile", ""), fn: func(ctx *gostage.ActionContext) error {
+		return errors.New("compiler crashed")
+	}})
+	report := gostage.NewStage("report", "Report", "")
+	report.AddTag(gostage.TagAlwaysRun)
+	report.AddAction(Slack("announce", "{{ .store.webhook }}",
+		`{{ .run.WorkflowName }} {{ .store.version }} is {{ .run.Status }}: "{{ index .run.FailedStages 0 }}" failed`))
+	wf.AddStage(build)
+	wf.AddStage(report)
+
+	options := gostage.DefaultRunOptions()
+	options.InitialStore = map[string]interface{}{"webhook": server.URL, "version": "v1.2.0"}
+	result := gostage.NewRunner().ExecuteWithOptions(wf, options)
+	require.ErrorContains(t, result.Error, "compiler crashed")
+
+	received := requests()
+	require.Len(t, received, 1)
+	assert.Equal(t, http.MethodPost, received[0].Method)
+	assert.Equal(t, "application/json", received[0].Header.Get("Content-Type"))
+	var payload map[string]string
+	require.NoError(t, json.Unmarshal([]byte(received[0].Body), &payload))
+	assert.Equal(t, `Release v1.2.0 is failed: "build" failed`, payload["text"])
+}
+
+func TestWebhook(t *testing.T) {
+	server, requests := endpoint(t, http.StatusAccepted)
+
+	result := gostagetest.RunActions(t, map[string]interface{}{"url": server.URL, "token": "secret", "version": "v2"},
+		Webhook("hook", "{{ .store.url }}/deploys", `{"version":"{{ .store.version }}","stage":"{{ .run.StageID }}"}`,
+			WithMethod(http.MethodPut),
+			WithHeader("authorization", "Bearer {{ .store.token }}"),
+		),
+	)
+	require.True(t, result.Success, "%v", result.Error)
+
+	received := requests()
+	require.Len(t, received, 1)
+	assert.Equal(t, http.MethodPut, received[0].Method)
+	assert.Equal(t, "Bearer secret", received[0].Header.Get("Authorization"))
+	assert.Equal(t, "application/json", received[0].Header.Get("Content-Type"))
+	assert.JSONEq(t, `{"version":"v2","stage":"run"}`, received[0].Body)
+}
+
+func TestWebhookFailures(t *testing.T) {
+	server, _ := endpoint(t, http.StatusUnauthorized)
+
+	result := gostagetest.RunActions(t, nil, Webhook("hook", server.URL, "{}"))
+	require.Error(t, result.Error)
+	assert.Contains(t, result.Error.Error(), "notification endpoint returned 401 Unauthorized: invalid_token")
+
+	result = gostagetest.RunActions(t, nil, Webhook("hook", server.URL, "{}", BestEffort()), Webhook("missing", "{{ .store.url }}", "", BestEffort()))
+	assert.True(t, result.Success, "%v", result.Error)
+
+	result = gostagetest.RunActions(t, nil, Slack("announce", "{{ .store.url }}", "hello"))
+	assert.ErrorContains(t, result.Error, "failed to render notification")
+}
+
+func TestWebhookTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	started := time.Now()
+	result := gostagetest.RunActions(t, nil, Webhook("hook", server.URL, "", WithTimeout(100*time.Millisecond)))
+	require.Error(t, result.Error)
+	assert.Contains(t, result.Error.Error(), "context deadline exceeded")
+	assert.Less(t, time.Since(started), 5*time.Second)
+}
+
+// mail is a message received by smtpServer.
+type mail struct {
+	From string
+	To   []string
+	Data string
+}
+
+// smtpServer starts a minimal SMTP server accepting every message.
+func smtpServer(t *testing.T) (string, <-chan mail) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { lis.Close() })
+
+	received := make(chan mail, 10)
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, received)
+		}
+	}()
+	return lis.Addr().String(), received
+}
+
+func serveSMTP(conn net.Conn, received chan<- mail) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	reply("220 localhost ready")
+	var current mail
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO", "HELO":
+			reply("250 localhost")
+		case "MAIL":
+			current = mail{From: strings.Trim(strings.TrimPrefix(line, "MAIL FROM:"), "<>")}
+			reply("250 OK")
+		case "RCPT":
+			current.To = append(current.To, strings.Trim(strings.TrimPrefix(line, "RCPT TO:"), "<>"))
+			reply("250 OK")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			current.Data = data.String()
+			received <- current
+			reply("250 OK")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestEmail(t *testing.T) {
+	addr, received := smtpServer(t)
+
+	server := SMTPConfig{Addr: addr, From: "ci@example.com"}
+	result := gostagetest.RunActions(t, map[string]interface{}{"team": "ops@example.com", "version": "v3"},
+		Email("mail", server, "{{ .store.team }}, lead@example.com",
+			"{{ .run.WorkflowName }} {{ .store.version }}\nBcc: attacker@example.com",
+			"Status: {{ .run.Status }}\nStage: {{ .run.StageName }}"),
+	)
+	require.True(t, result.Success, "%v", result.Error)
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, "ci@example.com", msg.From)
+		assert.Equal(t, []string{"ops@example.com", "lead@example.com"}, msg.To)
+		assert.Contains(t, msg.Data, "To: ops@example.com, lead@example.com\r\n")
+		assert.Contains(t, msg.Data, "Subject: Test v3 Bcc: attacker@example.com\r\n")
+		assert.NotContains(t, msg.Data, "\r\nBcc:")
+		assert.True(t, strings.HasSuffix(msg.Data, "\r\n\r\nStatus: running\r\nStage: Run\r\n"), msg.Data)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no email received")
+	}
+}
+
+func TestEmailFailures(t *testing.T) {
+	addr, _ := smtpServer(t)
+
+	result := gostagetest.RunActions(t, nil, Email("mail", SMTPConfig{Addr: addr, From: "ci@example.com"}, " , ", "subject", "body"))
+	assert.ErrorContains(t, result.Error, "email has no recipients")
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closed := lis.Addr().String()
+	lis.Close()
+	result = gostagetest.RunActions(t, nil, Email("mail", SMTPConfig{Addr: closed, From: "ci@example.com"}, "ops@example.com", "subject", "body"))
+	assert.ErrorContains(t, result.Error, "failed to connect to SMTP server")
+}
+
+func TestRegisteredNotifications(t *testing.T) {
+	registry := gostage.NewActionRegistry()
+	require.NoError(t, Register(registry))
+
+	server, requests := endpoint(t, http.StatusOK)
+	addr, received := smtpServer(t)
+	def := &gostage.SubWorkflowDef{
+		ID:           "defined",
+		Name:         "Defined",
+		InitialStore: map[string]interface{}{"url": server.URL},
+		Stages: []gostage.StageDef{{
+			ID: "run",
+			Actions: []gostage.ActionDef{
+				{ID: SlackID, Params: map[string]interface{}{"url": "{{ .store.url }}", "text": "{{ .run.WorkflowName }} started"}},
+				{ID: WebhookID, Params: map[string]interface{}{
+					"url":     "{{ .store.url }}",
+					"method":  "PATCH",
+					"headers": map[string]interface{}{"Content-Type": "text/plain"},
+					"body":    "{{ .run.ActionName }}",
+				}},
+				{ID: EmailID, Params: map[string]interface{}{"addr": addr, "from": "ci@example.com", "to": "ops@example.com", "subject": "done", "timeout": "5s"}},
+			},
+		}},
+	}
+	wf, err := gostage.NewWorkflowFromDefWithRegistry(def, registry)
+	require.NoError(t, err)
+
+	result := gostage.NewRunner().ExecuteWithOptions(wf, gostage.DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+
+	got := requests()
+	require.Len(t, got, 2)
+	assert.JSONEq(t, `{"text":"Defined started"}`, got[0].Body)
+	assert.Equal(t, "PATCH", got[1].Method)
+	assert.Equal(t, "text/plain", got[1].Header.Get("Content-Type"))
+	assert.Equal(t, WebhookID, got[1].Body)
+	select {
+	case msg := <-received:
+		assert.Equal(t, []string{"ops@example.com"}, msg.To)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no email received")
+	}
+
+	_, err = registry.Resolve(SlackID, map[string]interface{}{"url": "http://example.com"})
+	assert.ErrorContains(t, err, "the text parameter is required")
+	_, err = registry.Resolve(EmailID, map[string]interface{}{"addr": addr, "from": "a@example.com"})
+	assert.ErrorContains(t, err, "the to parameter is required")
+	_, err = registry.Resolve(WebhookID, map[string]interface{}{"url": "http://example.com", "timeout": "soon"})
+	assert.ErrorContains(t, err, "invalid timeout")
+}
@@ -0,0 +1,415 @@
+package objectstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is wrapped by the errors of requests targeting a missing bucket or object.
+var ErrNotFound = errors.New("object not found")
+
+// emptyPayloadHash is the SHA-256 digest of an empty body.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// unsignedPayload marks streamed bodies, which are not hashed before sending.
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// Error is returned when the server rejects a request.
+type Error struct {
+	// StatusCode is the HTTP status of the response
+	StatusCode int
+	// Code is the S3 error code, such as "NoSuchKey" or "AccessDenied"
+	Code    string
+	Message string
+	Bucket  string
+	Key     string
+}
+
+func (e *Error) Error() string {
+	target := e.Bucket
+	if e.Key != "" {
+		target += "/" + e.Key
+	}
+	msg := fmt.Sprintf("object store request on '%s' failed with status %d", target, e.StatusCode)
+	if e.Code != "" {
+		msg += ": " + e.Code
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// Unwrap returns ErrNotFound for 404 responses.
+func (e *Error) Unwrap() error {
+	if e.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Object describes a stored object.
+type Object struct {
+	Key          string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+}
+
+// Client talks to an S3-compatible API, signing requests with AWS Signature Version 4.
+type Client struct {
+	endpoint     *url.URL
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	virtualHost  bool
+	http         *http.Client
+	now          func() time.Time
+}
+
+// ClientOption configures a Client.
+type ClientOption func(*Client)
+
+// WithRegion sets the region requests are signed for. The default is "us-east-1".
+func WithRegion(region string) ClientOption {
+	return func(c *Client) {
+		c.region = region
+	}
+}
+
+// WithCredentials sets the access key, secret key and optional session token
+// requests are signed with. Requests are sent anonymously without credentials.
+func WithCredentials(accessKey, secretKey, sessionToken string) ClientOption {
+	return func(c *Client) {
+		c.accessKey = accessKey
+		c.secretKey = secretKey
+		c.sessionToken = sessionToken
+	}
+}
+
+// FromEnv reads the credentials and the region from the standard AWS
+// environment variables: AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY,
+// AWS_SESSION_TOKEN and AWS_REGION or AWS_DEFAULT_REGION.
+func FromEnv() ClientOption {
+	return func(c *Client) {
+		c.accessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		c.secretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		c.sessionToken = os.Getenv("AWS_SESSION_TOKEN")
+		if region := os.Getenv("AWS_REGION"); region != "" {
+			c.region = region
+		} else if region := os.Getenv("AWS_DEFAULT_REGION"); region != "" {
+			c.region = region
+		}
+	}
+}
+
+// WithVirtualHostedStyle addresses buckets as subdomains of the endpoint
+// instead of as the first path segment, which most S3-compatible servers expect.
+func WithVirtualHostedStyle() ClientOption {
+	return func(c *Client) {
+		c.virtualHost = true
+	}
+}
+
+// WithHTTPClient sets the client used to send requests.
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(c *Client) {
+		c.http = client
+	}
+}
+
+// NewClient creates a client for the S3-compatible API at endpoint, such as
+// "https://s3.eu-west-1.amazonaws.com" or "http://localhost:9000".
+func NewClient(endpoint string, opts ...ClientOption) (*Client, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid object store endpoint '%s'", endpoint)
+	}
+	c := &Client{
+		endpoint: u,
+		region:   "us-east-1",
+		http:     http.DefaultClient,
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// PutObject uploads size bytes read from body to key in bucket.
+func (c *Client) PutObject(ctx context.Context, bucket, key string, body io.Reader, size int64, contentType string) error {
+	req, err := c.request(ctx, http.MethodPut, bucket, key, nil, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.do(req, bucket, key, unsignedPayload)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// GetObject returns the content of key in bucket and its size. The caller
+// closes the returned reader.
+func (c *Client) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, int64, error) {
+	req, err := c.request(ctx, http.MethodGet, bucket, key, nil, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, err := c.do(req, bucket, key, emptyPayloadHash)
+	if err != nil {
+		return nil, 0, err
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+// DeleteObject deletes key from bucket. Deleting a missing key succeeds.
+func (c *Client) DeleteObject(ctx context.Context, bucket, key string) error {
+	req, err := c.request(ctx, http.MethodDelete, bucket, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req, bucket, key, emptyPayloadHash)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// listResult is the body of a ListObjectsV2 response.
+type listResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		ETag         string    `xml:"ETag"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+}
+
+// ListObjects returns the objects of bucket whose key starts with prefix,
+// following pagination.
+func (c *Client) ListObjects(ctx context.Context, bucket, prefix string) ([]Object, error) {
+	var objects []Object
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}}
+		if prefix != "" {
+			query.Set("prefix", prefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		req, err := c.request(ctx, http.MethodGet, bucket, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.do(req, bucket, "", emptyPayloadHash)
+		if err != nil {
+			return nil, err
+		}
+		var page listResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode object list of '%s': %w", bucket, err)
+		}
+
+		for _, item := range page.Contents {
+			objects = append(objects, Object{
+				Key:          item.Key,
+				Size:         item.Size,
+				ETag:         strings.Trim(item.ETag, `"`),
+				LastModified: item.LastModified,
+			})
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// request builds a request for key in bucket.
+func (c *Client) request(ctx context.Context, method, bucket, key string, query url.Values, body io.Reader) (*http.Request, error) {
+	if bucket == "" {
+		return nil, errors.New("bucket cannot be empty")
+	}
+
+	u := *c.endpoint
+	path := strings.TrimSuffix(u.Path, "/")
+	if c.virtualHost {
+		u.Host = bucket + "." + u.Host
+	} else {
+		path += "/" + bucket
+	}
+	if key != "" {
+		path += "/" + key
+	}
+	u.Path = path
+	u.RawPath = uriEncode(path, false)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid object store request: %w", err)
+	}
+	return req, nil
+}
+
+// do signs and sends a request, converting error responses to *Error.
+func (c *Client) do(req *http.Request, bucket, key, payloadHash string) (*http.Response, error) {
+	c.sign(req, payloadHash, c.now())
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("object store request failed: %w", err)
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	apiErr := &Error{StatusCode: resp.StatusCode, Bucket: bucket, Key: key}
+	var body struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body); err == nil {
+		apiErr.Code = body.Code
+		apiErr.Message = body.Message
+	}
+	return nil, apiErr
+}
+
+// sign adds the AWS Signature Version 4 headers to req. Every header already
+// set on the request is signed, along with the host.
+func (c *Client) sign(req *http.Request, payloadHash string, now time.Time) {
+	if c.accessKey == "" {
+		return
+	}
+
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + c.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hashHex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.secretKey), day)
+	key = hmacSHA256(key, c.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.accessKey, scope, signedHeaders, signature))
+}
+
+// canonicalQuery encodes query with sorted keys, as signatures require.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes every byte of s except unreserved characters and,
+// unless encodeSlash is set, slashes.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case 'A' <= ch && ch <= 'Z', 'a' <= ch && ch <= 'z', '0' <= ch && ch <= '9',
+			ch == '-', ch == '_', ch == '.', ch == '~':
+			b.WriteByte(ch)
+		case ch == '/' && !encodeSlash:
+			b.WriteByte(ch)
+		default:
+			b.WriteString("%" + strings.ToUpper(strconv.FormatUint(uint64(ch)|0x100, 16)[1:]))
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,292 @@
+// Package objectstore provides actions that move artifacts to and from
+// S3-compatible object storage: uploading, downloading, listing and deleting
+// objects.
+//
+// Uploads and downloads stream between the object store and either a local
+// file or a blob of the workflow store, so large artifacts never sit in
+// memory. Buckets, keys, prefixes and paths are rendered as templates when the
+// action runs:
+//
+//	client, err := objectstore.NewClient("https://s3.eu-west-1.amazonaws.com", objectstore.FromEnv())
+//
+//	stage.AddAction(objectstore.UploadFile("publish", client,
+//		"{{ .store.workdir }}/release.tar.gz", "artifacts", "releases/{{ .store.version }}.tar.gz"))
+//	stage.AddAction(objectstore.DownloadBlob("fetch", client,
+//		"artifacts", "releases/{{ .store.version }}.tar.gz", "release"))
+//
+// The client signs requests with AWS Signature Version 4, which AWS S3, MinIO,
+// Ceph, Cloudflare R2 and other compatible servers accept.
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/davidroman0O/gostage/store"
+)
+
+// ObjectAction is an action operating on an object store with templated arguments.
+type ObjectAction struct {
+	gostage.BaseAction
+
+	client      *Client
+	args        []string
+	contentType string
+	op          func(ctx *gostage.ActionContext, runCtx context.Context, a *ObjectAction, args []string) error
+}
+
+// Option configures an ObjectAction.
+type Option func(*ObjectAction)
+
+// WithContentType sets the content type of uploaded objects. It is rendered as a template.
+func WithContentType(contentType string) Option {
+	return func(a *ObjectAction) {
+		a.contentType = contentType
+	}
+}
+
+// newObjectAction creates an action running op with the rendered args.
+func newObjectAction(name, description string, client *Client, op func(ctx *gostage.ActionContext, runCtx context.Context, a *ObjectAction, args []string) error, args []string, opts []Option) *ObjectAction {
+	a := &ObjectAction{
+		BaseAction: gostage.NewBaseAction(name, description),
+		client:     client,
+		args:       args,
+		op:         op,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Execute renders the arguments of the action and runs its operation.
+func (a *ObjectAction) Execute(ctx *gostage.ActionContext) error {
+	args := make([]string, len(a.args))
+	for i, arg := range a.args {
+		rendered, err := ctx.Render(arg)
+		if err != nil {
+			return fmt.Errorf("failed to render '%s': %w", arg, err)
+		}
+		args[i] = rendered
+	}
+
+	runCtx := ctx.GoContext
+	if runCtx == nil {
+		runCtx = context.Background()
+	}
+	return a.op(ctx, runCtx, a, args)
+}
+
+// upload sends size bytes of r to key in bucket.
+func (a *ObjectAction) upload(ctx *gostage.ActionContext, runCtx context.Context, bucket, key string, r io.Reader, size int64) error {
+	contentType, err := ctx.Render(a.contentType)
+	if err != nil {
+		return fmt.Errorf("failed to render content type: %w", err)
+	}
+	ctx.Logger.Debug("Uploading %d bytes to %s/%s", size, bucket, key)
+	if err := a.client.PutObject(runCtx, bucket, key, r, size, contentType); err != nil {
+		return fmt.Errorf("failed to upload to '%s/%s': %w", bucket, key, err)
+	}
+	return nil
+}
+
+// UploadFile creates an action uploading the file at path to key in bucket.
+func UploadFile(name string, client *Client, path, bucket, key string, opts ...Option) *ObjectAction {
+	return newObjectAction(name, "Uploads "+path, client, func(ctx *gostage.ActionContext, runCtx context.Context, a *ObjectAction, args []string) error {
+		file, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to open '%s': %w", args[0], err)
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			return fmt.Errorf("failed to open '%s': %w", args[0], err)
+		}
+		return a.upload(ctx, runCtx, args[1], args[2], file, info.Size())
+	}, []string{path, bucket, key}, opts)
+}
+
+// UploadBlob creates an action uploading the blob stored under blobKey, as
+// written by store.KVStore.PutBlob, to key in bucket.
+func UploadBlob(name string, client *Client, blobKey, bucket, key string, opts ...Option) *ObjectAction {
+	return newObjectAction(name, "Uploads blob "+blobKey, client, func(ctx *gostage.ActionContext, runCtx context.Context, a *ObjectAction, args []string) error {
+		ref, err := store.Get[store.BlobRef](ctx.Store(), args[0])
+		if err != nil {
+			return fmt.Errorf("failed to read blob '%s': %w", args[0], err)
+		}
+		blob, err := ctx.Store().GetBlob(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to read blob '%s': %w", args[0], err)
+		}
+		defer blob.Close()
+		return a.upload(ctx, runCtx, args[1], args[2], blob, ref.Size)
+	}, []string{blobKey, bucket, key}, opts)
+}
+
+// DownloadFile creates an action downloading key from bucket to the file at
+// path, creating its directory if needed.
+func DownloadFile(name string, client *Client, bucket, key, path string) *ObjectAction {
+	return newObjectAction(name, "Downloads "+key+" to "+path, client, func(ctx *gostage.ActionContext, runCtx context.Context, a *ObjectAction, args []string) error {
+		body, err := a.download(ctx, runCtx, args[0], args[1])
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+
+		if err := os.MkdirAll(filepath.Dir(args[2]), 0o755); err != nil {
+			return fmt.Errorf("failed to create directory of '%s': %w", args[2], err)
+		}
+		file, err := os.Create(args[2])
+		if err != nil {
+			return fmt.Errorf("failed to create '%s': %w", args[2], err)
+		}
+		if _, err := io.Copy(file, body); err != nil {
+			file.Close()
+			os.Remove(args[2])
+			return fmt.Errorf("failed to download '%s/%s': %w", args[0], args[1], err)
+		}
+		return file.Close()
+	}, []string{bucket, key, path}, nil)
+}
+
+// DownloadBlob creates an action downloading key from bucket into a blob of
+// the workflow store under blobKey.
+func DownloadBlob(name string, client *Client, bucket, key, blobKey string) *ObjectAction {
+	return newObjectAction(name, "Downloads "+key+" to blob "+blobKey, client, func(ctx *gostage.ActionContext, runCtx context.Context, a *ObjectAction, args []string) error {
+		body, err := a.download(ctx, runCtx, args[0], args[1])
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+
+		if err := ctx.Store().PutBlob(args[2], body); err != nil {
+			return fmt.Errorf("failed to download '%s/%s': %w", args[0], args[1], err)
+		}
+		return nil
+	}, []string{bucket, key, blobKey}, nil)
+}
+
+// download opens the object named by bucket and key.
+func (a *ObjectAction) download(ctx *gostage.ActionContext, runCtx context.Context, bucket, key string) (io.ReadCloser, error) {
+	ctx.Logger.Debug("Downloading %s/%s", bucket, key)
+	body, _, err := a.client.GetObject(runCtx, bucket, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download '%s/%s': %w", bucket, key, err)
+	}
+	return body, nil
+}
+
+// List creates an action storing the objects of bucket whose key starts with
+// prefix under storeKey, as a list of maps holding their key, size, etag and
+// lastModified time.
+func List(name string, client *Client, bucket, prefix, storeKey string) *ObjectAction {
+	return newObjectAction(name, "Lists "+bucket, client, func(ctx *gostage.ActionContext, runCtx context.Context, a *ObjectAction, args []string) error {
+		objects, err := a.client.ListObjects(runCtx, args[0], args[1])
+		if err != nil {
+			return fmt.Errorf("failed to list '%s': %w", args[0], err)
+		}
+		listed := make([]interface{}, len(objects))
+		for i, object := range objects {
+			listed[i] = map[string]interface{}{
+				"key":          object.Key,
+				"size":         object.Size,
+				"etag":         object.ETag,
+				"lastModified": object.LastModified,
+			}
+		}
+		return ctx.Store().Put(storeKey, listed)
+	}, []string{bucket, prefix}, nil)
+}
+
+// Delete creates an action deleting key from bucket. Deleting a missing key succeeds.
+func Delete(name string, client *Client, bucket, key string) *ObjectAction {
+	return newObjectAction(name, "Deletes "+key, client, func(ctx *gostage.ActionContext, runCtx context.Context, a *ObjectAction, args []string) error {
+		ctx.Logger.Debug("Deleting %s/%s", args[0], args[1])
+		if err := a.client.DeleteObject(runCtx, args[0], args[1]); err != nil {
+			return fmt.Errorf("failed to delete '%s/%s': %w", args[0], args[1], err)
+		}
+		return nil
+	}, []string{bucket, key}, nil)
+}
+
+// Action IDs under which Register adds the object store actions to a registry.
+const (
+	UploadID   = "objectstore.upload"
+	DownloadID = "objectstore.download"
+	ListID     = "objectstore.list"
+	DeleteID   = "objectstore.delete"
+)
+
+// Params configure the objectstore actions in a workflow definition.
+// Upload and download move key of bucket from or to either a local file or a
+// store blob. List stores the objects under prefix in output.
+type Params struct {
+	Bucket      string `json:"bucket"`
+	Key         string `json:"key,omitempty"`
+	Prefix      string `json:"prefix,omitempty"`
+	File        string `json:"file,omitempty"`
+	Blob        string `json:"blob,omitempty"`
+	Output      string `json:"output,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+}
+
+// source returns whether the params name a file or a blob, requiring exactly one.
+func (p Params) source() (file bool, err error) {
+	if (p.File == "") == (p.Blob == "") {
+		return false, errors.New("exactly one of the file and blob parameters is required")
+	}
+	return p.File != "", nil
+}
+
+// Register adds the object store actions to registry, bound to client, so
+// that declarative definitions can use them.
+func Register(registry *gostage.ActionRegistry, client *Client) error {
+	register := func(id string, build func(p Params) (gostage.Action, error), needsKey bool) error {
+		return gostage.RegisterTyped(registry, id, func(p Params) (gostage.Action, error) {
+			if p.Bucket == "" {
+				return nil, errors.New("the bucket parameter is required")
+			}
+			if needsKey && p.Key == "" {
+				return nil, errors.New("the key parameter is required")
+			}
+			return build(p)
+		})
+	}
+
+	return errors.Join(
+		register(UploadID, func(p Params) (gostage.Action, error) {
+			file, err := p.source()
+			if err != nil {
+				return nil, err
+			}
+			if file {
+				return UploadFile(UploadID, client, p.File, p.Bucket, p.Key, WithContentType(p.ContentType)), nil
+			}
+			return UploadBlob(UploadID, client, p.Blob, p.Bucket, p.Key, WithContentType(p.ContentType)), nil
+		}, true),
+		register(DownloadID, func(p Params) (gostage.Action, error) {
+			file, err := p.source()
+			if err != nil {
+				return nil, err
+			}
+			if file {
+				return DownloadFile(DownloadID, client, p.Bucket, p.Key, p.File), nil
+			}
+			return DownloadBlob(DownloadID, client, p.Bucket, p.Key, p.Blob), nil
+		}, true),
+		register(ListID, func(p Params) (gostage.Action, error) {
+			if p.Output == "" {
+				return nil, errors.New("the output parameter is required")
+			}
+			return List(ListID, client, p.Bucket, p.Prefix, p.Output), nil
+		}, false),
+		register(DeleteID, func(p Params) (gostage.Action, error) {
+			return Delete(DeleteID, client, p.Bucket, p.Key), nil
+		}, true),
+	)
+}
@@ -0,0 +1,389 @@
+// Package script provides an action running inline Starlark scripts, for the
+// glue logic of declarative workflows that does not deserve a Go action.
+//
+// Starlark is a small dialect of Python designed for embedding. Scripts cannot
+// reach the file system, the network or the clock; they see the workflow
+// store through a store module and log through a log module:
+//
+//	total = 0
+//	for item in store.get("order.items"):
+//	    total += item["price"] * item["quantity"]
+//	store.put("order.total", total)
+//	log.info("order total is %d" % total)
+//
+// Store values cross into scripts as JSON values do: None, booleans, integers,
+// floats, strings, lists and dicts. Other Go values are converted through
+// their JSON encoding, and values put by a script are stored as int, float64,
+// string, bool, []interface{} and map[string]interface{}.
+package script
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/davidroman0O/gostage/store"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+)
+
+// ActionID is the ID under which Register adds the script action to a registry.
+const ActionID = "script.starlark"
+
+// DefaultMaxSteps bounds the computation steps of a script unless WithMaxSteps
+// changes it, so that a runaway loop fails instead of hanging the workflow.
+const DefaultMaxSteps = 10_000_000
+
+// fileOptions allows the statements commonly expected in glue code, such as
+// top-level loops and while loops, which the Starlark defaults reject.
+var fileOptions = &syntax.FileOptions{
+	While:           true,
+	TopLevelControl: true,
+	GlobalReassign:  true,
+	Set:             true,
+}
+
+// ScriptAction runs a Starlark script against the workflow store.
+type ScriptAction struct {
+	gostage.BaseAction
+
+	program  *starlark.Program
+	maxSteps uint64
+}
+
+// Option configures a ScriptAction.
+type Option func(*ScriptAction)
+
+// WithMaxSteps fails the script once it has run max computation steps, zero
+// removing the bound.
+func WithMaxSteps(max uint64) Option {
+	return func(a *ScriptAction) {
+		a.maxSteps = max
+	}
+}
+
+// New creates an action named name that runs source. The script is compiled
+// here, so syntax errors and references to undefined names fail New rather
+// than the workflow.
+func New(name, source string, opts ...Option) (*ScriptAction, error) {
+	_, program, err := starlark.SourceProgramOptions(fileOptions, name+".star", source, predeclared.Has)
+	if err != nil {
+		return nil, fmt.Errorf("invalid script for action '%s': %w", name, err)
+	}
+
+	a := &ScriptAction{
+		BaseAction: gostage.NewBaseAction(name, "Runs a Starlark script"),
+		program:    program,
+		maxSteps:   DefaultMaxSteps,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a, nil
+}
+
+// predeclared lists the names bound by Execute, for the compiler to resolve.
+var predeclared = starlark.StringDict{"store": starlark.None, "log": starlark.None}
+
+// Execute runs the script. A script failing, by calling fail() or with a
+// runtime error, fails the action with the Starlark backtrace.
+func (a *ScriptAction) Execute(ctx *gostage.ActionContext) error {
+	thread := &starlark.Thread{
+		Name:  a.Name(),
+		Print: func(_ *starlark.Thread, msg string) { ctx.Logger.Info("%s", msg) },
+	}
+	if a.maxSteps > 0 {
+		thread.SetMaxExecutionSteps(a.maxSteps)
+	}
+
+	runCtx := ctx.GoContext
+	if runCtx == nil {
+		runCtx = context.Background()
+	}
+	stop := context.AfterFunc(runCtx, func() {
+		thread.Cancel(context.Cause(runCtx).Error())
+	})
+	defer stop()
+
+	_, err := a.program.Init(thread, starlark.StringDict{
+		"store": storeModule(ctx.Store()),
+		"log":   logModule(ctx.Logger),
+	})
+	if err == nil {
+		return nil
+	}
+	if runCtx.Err() != nil {
+		return fmt.Errorf("script '%s' was cancelled: %w", a.Name(), context.Cause(runCtx))
+	}
+	var evalErr *starlark.EvalError
+	if errors.As(err, &evalErr) {
+		return fmt.Errorf("script '%s' failed: %s", a.Name(), evalErr.Backtrace())
+	}
+	return fmt.Errorf("script '%s' failed: %w", a.Name(), err)
+}
+
+// storeModule exposes s to scripts as store.get, store.put, store.delete and store.keys.
+func storeModule(s *store.KVStore) *starlarkstruct.Module {
+	return &starlarkstruct.Module{Name: "store", Members: starlark.StringDict{
+		// get(key, default) returns default, or fails without one, for a missing key
+		"get": starlark.NewBuiltin("store.get", func(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var key string
+			var fallback starlark.Value
+			if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "key", &key, "default?", &fallback); err != nil {
+				return nil, err
+			}
+			value, err := s.GetValue(key)
+			if errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrExpired) {
+				if fallback != nil {
+					return fallback, nil
+				}
+				return nil, fmt.Errorf("%s: key '%s' not found", fn.Name(), key)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+			}
+			return toStarlark(value)
+		}),
+		"put": starlark.NewBuiltin("store.put", func(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var key string
+			var value starlark.Value
+			if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &key, &value); err != nil {
+				return nil, err
+			}
+			converted, err := fromStarlark(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: key '%s': %w", fn.Name(), key, err)
+			}
+			if err := s.Put(key, converted); err != nil {
+				return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+			}
+			return starlark.None, nil
+		}),
+		// delete(key) returns whether the key existed
+		"delete": starlark.NewBuiltin("store.delete", func(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var key string
+			if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &key); err != nil {
+				return nil, err
+			}
+			return starlark.Bool(s.Delete(key)), nil
+		}),
+		// keys(prefix) returns the sorted keys starting with prefix
+		"keys": starlark.NewBuiltin("store.keys", func(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var prefix string
+			if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "prefix?", &prefix); err != nil {
+				return nil, err
+			}
+			var keys []string
+			s.Range(prefix, func(key string, _ any) bool {
+				keys = append(keys, key)
+				return true
+			})
+			sort.Strings(keys)
+			values := make([]starlark.Value, len(keys))
+			for i, key := range keys {
+				values[i] = starlark.String(key)
+			}
+			return starlark.NewList(values), nil
+		}),
+	}}
+}
+
+// logModule exposes logger to scripts as log.debug, log.info, log.warn and
+// log.error, which join their arguments with spaces as print does.
+func logModule(logger gostage.Logger) *starlarkstruct.Module {
+	levels := map[string]func(format string, args ...interface{}){
+		"debug": logger.Debug,
+		"info":  logger.Info,
+		"warn":  logger.Warn,
+		"error": logger.Error,
+	}
+	members := make(starlark.StringDict, len(levels))
+	for level, log := range levels {
+		members[level] = starlark.NewBuiltin("log."+level, func(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			if len(kwargs) > 0 {
+				return nil, fmt.Errorf("%s: unexpected keyword arguments", fn.Name())
+			}
+			parts := make([]string, len(args))
+			for i, arg := range args {
+				if str, ok := starlark.AsString(arg); ok {
+					parts[i] = str
+				} else {
+					parts[i] = arg.String()
+				}
+			}
+			log("%s", strings.Join(parts, " "))
+			return starlark.None, nil
+		})
+	}
+	return &starlarkstruct.Module{Name: "log", Members: members}
+}
+
+// toStarlark converts a store value into a Starlark value.
+func toStarlark(value any) (starlark.Value, error) {
+	switch v := value.(type) {
+	case nil:
+		return starlark.None, nil
+	case bool:
+		return starlark.Bool(v), nil
+	case int:
+		return starlark.MakeInt(v), nil
+	case int8:
+		return starlark.MakeInt64(int64(v)), nil
+	case int16:
+		return starlark.MakeInt64(int64(v)), nil
+	case int32:
+		return starlark.MakeInt64(int64(v)), nil
+	case int64:
+		return starlark.MakeInt64(v), nil
+	case uint:
+		return starlark.MakeUint(v), nil
+	case uint8:
+		return starlark.MakeUint64(uint64(v)), nil
+	case uint16:
+		return starlark.MakeUint64(uint64(v)), nil
+	case uint32:
+		return starlark.MakeUint64(uint64(v)), nil
+	case uint64:
+		return starlark.MakeUint64(v), nil
+	case float32:
+		return starlark.Float(v), nil
+	case float64:
+		return starlark.Float(v), nil
+	case string:
+		return starlark.String(v), nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return starlark.MakeInt64(i), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return starlark.Float(f), nil
+	case []interface{}:
+		elems := make([]starlark.Value, len(v))
+		for i, elem := range v {
+			converted, err := toStarlark(elem)
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = converted
+		}
+		return starlark.NewList(elems), nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		dict := starlark.NewDict(len(v))
+		for _, key := range keys {
+			converted, err := toStarlark(v[key])
+			if err != nil {
+				return nil, err
+			}
+			if err := dict.SetKey(starlark.String(key), converted); err != nil {
+				return nil, err
+			}
+		}
+		return dict, nil
+	}
+
+	// Other values, such as structs and typed slices, go through their JSON encoding
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("cannot convert a %T to a script value: %w", value, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var generic interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, fmt.Errorf("cannot convert a %T to a script value: %w", value, err)
+	}
+	return toStarlark(generic)
+}
+
+// fromStarlark converts a Starlark value into a store value.
+func fromStarlark(value starlark.Value) (any, error) {
+	switch v := value.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.Int:
+		i, ok := v.Int64()
+		if !ok || i < math.MinInt || i > math.MaxInt {
+			return nil, fmt.Errorf("integer %s is too large", v)
+		}
+		return int(i), nil
+	case starlark.Float:
+		return float64(v), nil
+	case starlark.String:
+		return string(v), nil
+	case *starlark.List:
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			elem, err := fromStarlark(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			out[i] = elem
+		}
+		return out, nil
+	case starlark.Tuple:
+		out := make([]interface{}, len(v))
+		for i, elem := range v {
+			converted, err := fromStarlark(elem)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = converted
+		}
+		return out, nil
+	case *starlark.Dict:
+		out := make(map[string]interface{}, v.Len())
+		for _, item := range v.Items() {
+			key, ok := starlark.AsString(item[0])
+			if !ok {
+				return nil, fmt.Errorf("dict keys must be strings, not %s", item[0].Type())
+			}
+			converted, err := fromStarlark(item[1])
+			if err != nil {
+				return nil, err
+			}
+			out[key] = converted
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("cannot store a %s", value.Type())
+}
+
+// Params configure a script.starlark action in a workflow definition.
+type Params struct {
+	// Source is the Starlark script
+	Source string `json:"source"`
+	// MaxSteps bounds the computation steps of the script, DefaultMaxSteps if zero
+	MaxSteps uint64 `json:"maxSteps,omitempty"`
+}
+
+// Register adds the script action to registry under ActionID, so that
+// declarative definitions can include inline scripts.
+func Register(registry *gostage.ActionRegistry) error {
+	return gostage.RegisterTyped(registry, ActionID, func(params Params) (gostage.Action, error) {
+		if params.Source == "" {
+			return nil, errors.New("the source parameter is required")
+		}
+		var opts []Option
+		if params.MaxSteps > 0 {
+			opts = append(opts, WithMaxSteps(params.MaxSteps))
+		}
+		return New(ActionID, params.Source, opts...)
+	})
+}
@@ -0,0 +1,128 @@
+package script
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/davidroman0O/gostage/gostagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type lineItem struct {
+	Price    int `json:"price"`
+	Quantity int `json:"quantity"`
+}
+
+func TestScriptReadsAndWritesTheStore(t *testing.T) {
+	action, err := New("total", `
+total = 0
+for item in store.get("order.items"):
+    total += item["price"] * item["quantity"]
+store.put("order.total", total)
+store.put("order.summary", {"total": total, "currency": store.get("order.currency", "EUR"), "paid": False})
+store.delete("order.draft")
+log.info("order total is", total)
+print("keys:", store.keys("order."))
+`)
+	require.NoError(t, err)
+
+	options := gostage.DefaultRunOptions()
+	options.InitialStore = map[string]interface{}{
+		"order.items": []lineItem{{Price: 3, Quantity: 2}, {Price: 10, Quantity: 1}},
+		"order.draft": true,
+	}
+	options.CaptureLogs = true
+	result := gostagetest.New(t, gostagetest.WithRunOptions(options)).RunActions(action)
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, 16, result.FinalStore["order.total"])
+	assert.Equal(t, map[string]interface{}{"total": 16, "currency": "EUR", "paid": false}, result.FinalStore["order.summary"])
+	assert.NotContains(t, result.FinalStore, "order.draft")
+
+	var messages []string
+	for _, entry := range result.Logs {
+		messages = append(messages, entry.Message)
+	}
+	assert.Contains(t, messages, "order total is 16")
+	assert.Contains(t, messages, `keys: ["order.items", "order.summary", "order.total"]`)
+}
+
+func TestScriptFailures(t *testing.T) {
+	_, err := New("broken", "store.put(")
+	assert.ErrorContains(t, err, "invalid script for action 'broken'")
+	_, err = New("undefined", "store.put('a', missing)")
+	assert.ErrorContains(t, err, "undefined: missing")
+
+	action, err := New("failing", `fail("no customer for order", store.get("order.id"))`)
+	require.NoError(t, err)
+	result := gostagetest.RunActions(t, map[string]interface{}{"order.id": "o-1"}, action)
+	require.Error(t, result.Error)
+	assert.Contains(t, result.Error.Error(), "no customer for order o-1")
+
+	action, err = New("missing", `store.get("nothing")`)
+	require.NoError(t, err)
+	result = gostagetest.RunActions(t, nil, action)
+	assert.ErrorContains(t, result.Error, "key 'nothing' not found")
+
+	action, err = New("unstorable", `store.put("fn", len)`)
+	require.NoError(t, err)
+	result = gostagetest.RunActions(t, nil, action)
+	assert.ErrorContains(t, result.Error, "cannot store a builtin_function_or_method")
+}
+
+func TestScriptLimits(t *testing.T) {
+	action, err := New("spin", "while True:\n    pass", WithMaxSteps(1000))
+	require.NoError(t, err)
+	result := gostagetest.RunActions(t, nil, action)
+	assert.ErrorContains(t, result.Error, "too many steps")
+
+	action, err = New("spin", "while True:\n    pass", WithMaxSteps(0))
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	options := gostage.DefaultRunOptions()
+	options.Context = ctx
+	result = gostagetest.New(t, gostagetest.WithRunOptions(options)).RunActions(action)
+	assert.ErrorIs(t, result.Error, context.DeadlineExceeded)
+	assert.Less(t, time.Since(started), 5*time.Second)
+}
+
+func TestScriptRespectsReadOnlyTag(t *testing.T) {
+	action, err := New("readonly", `store.put("a", 1)`)
+	require.NoError(t, err)
+	action.AddTag(gostage.TagReadOnly)
+
+	result := gostagetest.RunActions(t, nil, action)
+	assert.ErrorContains(t, result.Error, "read-only")
+}
+
+func TestRegisteredScript(t *testing.T) {
+	registry := gostage.NewActionRegistry()
+	require.NoError(t, Register(registry))
+
+	def := &gostage.SubWorkflowDef{
+		ID:           "defined",
+		InitialStore: map[string]interface{}{"name": "gopher"},
+		Stages: []gostage.StageDef{{
+			ID: "run",
+			Actions: []gostage.ActionDef{{
+				ID:     ActionID,
+				Params: map[string]interface{}{"source": `store.put("greeting", "hello " + store.get("name"))`},
+			}},
+		}},
+	}
+	wf, err := gostage.NewWorkflowFromDefWithRegistry(def, registry)
+	require.NoError(t, err)
+
+	result := gostage.NewRunner().ExecuteWithOptions(wf, gostage.DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, "hello gopher", result.FinalStore["greeting"])
+
+	_, err = registry.Resolve(ActionID, nil)
+	assert.ErrorContains(t, err, "source parameter is required")
+	_, err = registry.Resolve(ActionID, map[string]interface{}{"source": "if"})
+	assert.ErrorContains(t, err, "invalid script")
+}
@@ -0,0 +1,83 @@
+package terraform
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/davidroman0O/gostage/store"
+)
+
+// RollbackKey is the default store key under which applied configurations are recorded.
+const RollbackKey = "terraform.rollback"
+
+// Applied is a configuration recorded by Apply so Rollback can destroy it.
+// Variables are recorded rendered, since destroying needs the same values.
+type Applied struct {
+	Dir      string            `json:"dir"`
+	Vars     map[string]string `json:"vars,omitempty"`
+	VarFiles []string          `json:"varFiles,omitempty"`
+}
+
+// record adds the configuration of tf to the ones recorded under the
+// rollback key, before it is applied so that partial applies are destroyed too.
+func (a *TerraformAction) record(ctx *gostage.ActionContext, tf *terraform) error {
+	recorded, err := store.Get[[]Applied](ctx.Store(), a.rollbackKey)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("failed to read applied configurations: %w", err)
+	}
+	for _, applied := range recorded {
+		if applied.Dir == tf.dir {
+			return nil
+		}
+	}
+	applied := Applied{Dir: tf.dir, Vars: tf.vars, VarFiles: tf.varFiles}
+	return ctx.Store().Put(a.rollbackKey, append(recorded, applied))
+}
+
+// Rollback creates an action destroying, in reverse order, the configurations
+// recorded by Apply under the rollback key when the workflow failed or was
+// interrupted. It does nothing when the workflow is still successful. Every
+// configuration is destroyed even if some fail, and the record is removed
+// afterwards. The binary, environment and timeout options apply.
+func Rollback(name string, opts ...Option) *TerraformAction {
+	a := newTerraformAction(name, "Destroys applied configurations", "", "", append(opts, NoInit()))
+	a.op = func(ctx *gostage.ActionContext, tf *terraform) error {
+		status := ctx.Run().Status
+		if status != gostage.StatusFailed && status != gostage.StatusInterrupted {
+			return nil
+		}
+		recorded, err := store.Get[[]Applied](ctx.Store(), a.rollbackKey)
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read applied configurations: %w", err)
+		}
+
+		var errs []error
+		for i := len(recorded) - 1; i >= 0; i-- {
+			applied := *tf
+			applied.dir = recorded[i].Dir
+			applied.vars = recorded[i].Vars
+			applied.varFiles = recorded[i].VarFiles
+
+			ctx.Logger.Info("Destroying %s after the workflow %s", applied.dir, status)
+			if err := applied.destroy(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		ctx.Store().Delete(a.rollbackKey)
+		return errors.Join(errs...)
+	}
+	return a
+}
+
+// RollbackStage returns a stage tagged with gostage.TagAlwaysRun holding a
+// Rollback action, to be added last to a workflow.
+func RollbackStage(id string, opts ...Option) *gostage.Stage {
+	stage := gostage.NewStageWithTags(id, "Rollback", "Destroys applied configurations when the workflow fails",
+		[]string{gostage.TagAlwaysRun})
+	stage.AddAction(Rollback(id, opts...))
+	return stage
+}
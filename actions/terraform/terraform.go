@@ -0,0 +1,508 @@
+// Package terraform provides actions that plan, apply and destroy Terraform or
+// OpenTofu configurations, with their JSON output parsed into the store and
+// applied configurations destroyed again when a run fails.
+//
+// The actions run the terraform binary, or another one such as tofu given
+// with WithBinary, in the directory of the configuration. Directories,
+// variables and plan files are rendered as templates against the workflow
+// store when the action runs:
+//
+//	provision := gostage.NewStage("provision", "Provision", "")
+//	provision.AddAction(terraform.Plan("plan", "infra/{{ .store.env }}",
+//		terraform.WithVar("image", "{{ .store.image }}"), terraform.WithPlanFile("release.tfplan")))
+//	provision.AddAction(terraform.Apply("apply", "infra/{{ .store.env }}",
+//		terraform.WithPlanFile("release.tfplan"), terraform.WithOutputKey("infra")))
+//	workflow.AddStage(provision)
+//	workflow.AddStage(terraform.RollbackStage("destroy"))
+//
+// Plan stores a summary of the planned changes and Apply the outputs of the
+// configuration, so later actions can use "{{ .store.infra.endpoint }}".
+package terraform
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+)
+
+// Store keys Plan and Apply write to unless WithOutputKey is given.
+const (
+	DefaultPlanKey   = "terraform.plan"
+	DefaultOutputKey = "terraform.outputs"
+)
+
+// TerraformAction runs terraform commands in the directory of a configuration.
+type TerraformAction struct {
+	gostage.BaseAction
+
+	dir         string
+	op          func(ctx *gostage.ActionContext, tf *terraform) error
+	binary      string
+	vars        map[string]string
+	varFiles    []string
+	env         map[string]string
+	planFile    string
+	outputKey   string
+	timeout     time.Duration
+	rollbackKey string
+	noRollback  bool
+	noInit      bool
+}
+
+// Option configures a TerraformAction.
+type Option func(*TerraformAction)
+
+// WithBinary sets the binary to run, such as "tofu". It defaults to "terraform".
+func WithBinary(path string) Option {
+	return func(a *TerraformAction) {
+		a.binary = path
+	}
+}
+
+// WithVar sets an input variable of the configuration. The value is rendered as a template.
+func WithVar(name, value string) Option {
+	return func(a *TerraformAction) {
+		a.vars[name] = value
+	}
+}
+
+// WithVarFile adds a variable definitions file. The path is rendered as a template.
+func WithVarFile(path string) Option {
+	return func(a *TerraformAction) {
+		a.varFiles = append(a.varFiles, path)
+	}
+}
+
+// WithEnv sets an environment variable of terraform, such as a provider
+// credential. The value is rendered as a template.
+func WithEnv(key, value string) Option {
+	return func(a *TerraformAction) {
+		a.env[key] = value
+	}
+}
+
+// WithPlanFile makes Plan save the plan to path, relative to the directory of
+// the configuration, and Apply apply that saved plan instead of planning again.
+// The path is rendered as a template.
+func WithPlanFile(path string) Option {
+	return func(a *TerraformAction) {
+		a.planFile = path
+	}
+}
+
+// WithOutputKey sets the store key Plan stores its summary under, or Apply
+// the outputs of the configuration.
+func WithOutputKey(key string) Option {
+	return func(a *TerraformAction) {
+		a.outputKey = key
+	}
+}
+
+// WithTimeout kills terraform if the action runs longer than timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(a *TerraformAction) {
+		a.timeout = timeout
+	}
+}
+
+// WithRollbackKey sets the store key applied configurations are recorded under
+// and destroyed from, which defaults to RollbackKey.
+func WithRollbackKey(key string) Option {
+	return func(a *TerraformAction) {
+		a.rollbackKey = key
+	}
+}
+
+// NoRollback stops Apply from recording its configuration for Rollback.
+func NoRollback() Option {
+	return func(a *TerraformAction) {
+		a.noRollback = true
+	}
+}
+
+// NoInit skips "terraform init", for directories that are already initialized.
+func NoInit() Option {
+	return func(a *TerraformAction) {
+		a.noInit = true
+	}
+}
+
+// newTerraformAction creates an action running op in dir.
+func newTerraformAction(name, description, dir, outputKey string, opts []Option) *TerraformAction {
+	a := &TerraformAction{
+		BaseAction:  gostage.NewBaseAction(name, description),
+		dir:         dir,
+		binary:      "terraform",
+		vars:        make(map[string]string),
+		env:         make(map[string]string),
+		outputKey:   outputKey,
+		rollbackKey: RollbackKey,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Plan creates an action planning the configuration in dir and storing a
+// summary of the changes under DefaultPlanKey: a map holding "hasChanges",
+// the "add", "change" and "destroy" counts, and "changes", the address and
+// actions of every changed resource.
+func Plan(name, dir string, opts ...Option) *TerraformAction {
+	a := newTerraformAction(name, "Plans "+dir, dir, DefaultPlanKey, opts)
+	a.op = func(ctx *gostage.ActionContext, tf *terraform) error {
+		planFile := tf.planFile
+		if planFile == "" {
+			file, err := os.CreateTemp("", "gostage-*.tfplan")
+			if err != nil {
+				return fmt.Errorf("failed to create plan file: %w", err)
+			}
+			file.Close()
+			defer os.Remove(file.Name())
+			planFile = file.Name()
+		}
+
+		ctx.Logger.Info("Planning %s", tf.dir)
+		args := append([]string{"plan", "-input=false", "-no-color", "-detailed-exitcode", "-out=" + planFile}, tf.varArgs()...)
+		if _, err := tf.run(args, 2); err != nil {
+			return err
+		}
+		out, err := tf.run([]string{"show", "-json", "-no-color", planFile})
+		if err != nil {
+			return err
+		}
+		summary, err := summarizePlan(out)
+		if err != nil {
+			return err
+		}
+		return ctx.Store().Put(a.outputKey, summary)
+	}
+	return a
+}
+
+// Apply creates an action applying the configuration in dir, or the plan saved
+// by Plan with WithPlanFile, and storing its outputs under DefaultOutputKey as
+// a map of output names to values. Sensitive outputs are stored as well.
+func Apply(name, dir string, opts ...Option) *TerraformAction {
+	a := newTerraformAction(name, "Applies "+dir, dir, DefaultOutputKey, opts)
+	a.op = func(ctx *gostage.ActionContext, tf *terraform) error {
+		if !a.noRollback {
+			if err := a.record(ctx, tf); err != nil {
+				return err
+			}
+		}
+
+		ctx.Logger.Info("Applying %s", tf.dir)
+		args := []string{"apply", "-input=false", "-no-color", "-auto-approve"}
+		if tf.planFile != "" {
+			args = append(args, tf.planFile)
+		} else {
+			args = append(args, tf.varArgs()...)
+		}
+		if _, err := tf.run(args); err != nil {
+			return err
+		}
+
+		out, err := tf.run([]string{"output", "-json", "-no-color"})
+		if err != nil {
+			return err
+		}
+		var outputs map[string]struct {
+			Value interface{} `json:"value"`
+		}
+		if err := json.Unmarshal(out, &outputs); err != nil {
+			return fmt.Errorf("failed to decode outputs: %w", err)
+		}
+		values := make(map[string]interface{}, len(outputs))
+		for name, output := range outputs {
+			values[name] = output.Value
+		}
+		return ctx.Store().Put(a.outputKey, values)
+	}
+	return a
+}
+
+// Destroy creates an action destroying the resources of the configuration in dir.
+func Destroy(name, dir string, opts ...Option) *TerraformAction {
+	a := newTerraformAction(name, "Destroys "+dir, dir, "", opts)
+	a.op = func(ctx *gostage.ActionContext, tf *terraform) error {
+		ctx.Logger.Info("Destroying %s", tf.dir)
+		return tf.destroy()
+	}
+	return a
+}
+
+// Execute renders the configuration of the action, initializes the directory
+// and runs the operation of the action.
+func (a *TerraformAction) Execute(ctx *gostage.ActionContext) error {
+	runCtx := ctx.GoContext
+	if runCtx == nil {
+		runCtx = context.Background()
+	}
+	if a.timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(runCtx, a.timeout)
+		defer cancel()
+	}
+
+	tf, err := a.render(ctx, runCtx)
+	if err != nil {
+		return err
+	}
+	if !a.noInit {
+		if err := tf.init(); err != nil {
+			return err
+		}
+	}
+	return a.op(ctx, tf)
+}
+
+// render returns a terraform runner for the rendered configuration of the action.
+func (a *TerraformAction) render(ctx *gostage.ActionContext, runCtx context.Context) (*terraform, error) {
+	tf := &terraform{ctx: runCtx, binary: a.binary, vars: make(map[string]string, len(a.vars))}
+	var err error
+	if tf.dir, err = ctx.Render(a.dir); err != nil {
+		return nil, fmt.Errorf("failed to render directory: %w", err)
+	}
+	if tf.planFile, err = ctx.Render(a.planFile); err != nil {
+		return nil, fmt.Errorf("failed to render plan file: %w", err)
+	}
+	for name, value := range a.vars {
+		if tf.vars[name], err = ctx.Render(value); err != nil {
+			return nil, fmt.Errorf("failed to render variable '%s': %w", name, err)
+		}
+	}
+	for _, path := range a.varFiles {
+		rendered, err := ctx.Render(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render '%s': %w", path, err)
+		}
+		tf.varFiles = append(tf.varFiles, rendered)
+	}
+	tf.env = append(os.Environ(), "TF_IN_AUTOMATION=1", "TF_INPUT=0")
+	for key, value := range a.env {
+		rendered, err := ctx.Render(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render environment variable '%s': %w", key, err)
+		}
+		tf.env = append(tf.env, key+"="+rendered)
+	}
+	return tf, nil
+}
+
+// summarizePlan returns the summary Plan stores for the output of "terraform show -json".
+func summarizePlan(out []byte) (map[string]interface{}, error) {
+	var plan struct {
+		ResourceChanges []struct {
+			Address string `json:"address"`
+			Change  struct {
+				Actions []string `json:"actions"`
+			} `json:"change"`
+		} `json:"resource_changes"`
+	}
+	if err := json.Unmarshal(out, &plan); err != nil {
+		return nil, fmt.Errorf("failed to decode plan: %w", err)
+	}
+
+	counts := map[string]int{}
+	changes := []interface{}{}
+	for _, resource := range plan.ResourceChanges {
+		actions := resource.Change.Actions
+		if len(actions) == 0 || actions[0] == "no-op" || actions[0] == "read" {
+			continue
+		}
+		for _, action := range actions {
+			counts[action]++
+		}
+		listed := make([]interface{}, len(actions))
+		for i, action := range actions {
+			listed[i] = action
+		}
+		changes = append(changes, map[string]interface{}{"address": resource.Address, "actions": listed})
+	}
+	return map[string]interface{}{
+		"hasChanges": len(changes) > 0,
+		"add":        counts["create"],
+		"change":     counts["update"],
+		"destroy":    counts["delete"],
+		"changes":    changes,
+	}, nil
+}
+
+// terraform runs terraform commands for one rendered configuration.
+type terraform struct {
+	ctx      context.Context
+	binary   string
+	dir      string
+	vars     map[string]string
+	varFiles []string
+	env      []string
+	planFile string
+}
+
+// varArgs returns the -var and -var-file arguments, sorted for stable command lines.
+func (tf *terraform) varArgs() []string {
+	names := make([]string, 0, len(tf.vars))
+	for name := range tf.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var args []string
+	for _, name := range names {
+		args = append(args, "-var="+name+"="+tf.vars[name])
+	}
+	for _, path := range tf.varFiles {
+		args = append(args, "-var-file="+path)
+	}
+	return args
+}
+
+func (tf *terraform) init() error {
+	_, err := tf.run([]string{"init", "-input=false", "-no-color"})
+	return err
+}
+
+func (tf *terraform) destroy() error {
+	_, err := tf.run(append([]string{"destroy", "-input=false", "-no-color", "-auto-approve"}, tf.varArgs()...))
+	return err
+}
+
+// run runs terraform with args in the configuration directory and returns its
+// standard output. Exit codes other than 0 and ok fail.
+func (tf *terraform) run(args []string, ok ...int) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := osexec.CommandContext(tf.ctx, tf.binary, args...)
+	cmd.Dir = tf.dir
+	cmd.Env = tf.env
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	if err == nil {
+		return stdout.Bytes(), nil
+	}
+	if tf.ctx.Err() != nil {
+		return nil, fmt.Errorf("%s %s: %w", filepath.Base(tf.binary), args[0], tf.ctx.Err())
+	}
+	var exitErr *osexec.ExitError
+	if !errors.As(err, &exitErr) {
+		return nil, fmt.Errorf("failed to run %s: %w", tf.binary, err)
+	}
+	for _, code := range ok {
+		if exitErr.ExitCode() == code {
+			return stdout.Bytes(), nil
+		}
+	}
+	return nil, fmt.Errorf("%s %s failed: %w: %s", filepath.Base(tf.binary), args[0], err, strings.TrimSpace(stderr.String()))
+}
+
+// Action IDs under which Register adds the terraform actions to a registry.
+const (
+	PlanID     = "terraform.plan"
+	ApplyID    = "terraform.apply"
+	DestroyID  = "terraform.destroy"
+	RollbackID = "terraform.rollback"
+)
+
+// Params configure the terraform actions in a workflow definition. Plan,
+// apply and destroy run in the configuration directory dir, with vars,
+// varFiles and env passed to the binary.
+type Params struct {
+	Dir      string            `json:"dir"`
+	Binary   string            `json:"binary,omitempty"`
+	Vars     map[string]string `json:"vars,omitempty"`
+	VarFiles []string          `json:"varFiles,omitempty"`
+	Env      map[string]string `json:"env,omitempty"`
+	PlanFile string            `json:"planFile,omitempty"`
+	// Output is the store key the plan summary or the outputs are saved to
+	Output      string `json:"output,omitempty"`
+	RollbackKey string `json:"rollbackKey,omitempty"`
+	NoRollback  bool   `json:"noRollback,omitempty"`
+	NoInit      bool   `json:"noInit,omitempty"`
+	// Timeout is a duration such as "30m"
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// options returns the options described by the params.
+func (p Params) options() ([]Option, error) {
+	var opts []Option
+	if p.Binary != "" {
+		opts = append(opts, WithBinary(p.Binary))
+	}
+	for name, value := range p.Vars {
+		opts = append(opts, WithVar(name, value))
+	}
+	for _, path := range p.VarFiles {
+		opts = append(opts, WithVarFile(path))
+	}
+	for key, value := range p.Env {
+		opts = append(opts, WithEnv(key, value))
+	}
+	if p.PlanFile != "" {
+		opts = append(opts, WithPlanFile(p.PlanFile))
+	}
+	if p.Output != "" {
+		opts = append(opts, WithOutputKey(p.Output))
+	}
+	if p.RollbackKey != "" {
+		opts = append(opts, WithRollbackKey(p.RollbackKey))
+	}
+	if p.NoRollback {
+		opts = append(opts, NoRollback())
+	}
+	if p.NoInit {
+		opts = append(opts, NoInit())
+	}
+	if p.Timeout != "" {
+		timeout, err := time.ParseDuration(p.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout: %w", err)
+		}
+		opts = append(opts, WithTimeout(timeout))
+	}
+	return opts, nil
+}
+
+// Register adds the terraform actions to registry, so that declarative
+// definitions can use them.
+func Register(registry *gostage.ActionRegistry) error {
+	register := func(id string, needsDir bool, build func(p Params, opts []Option) gostage.Action) error {
+		return gostage.RegisterTyped(registry, id, func(p Params) (gostage.Action, error) {
+			if needsDir && p.Dir == "" {
+				return nil, errors.New("the dir parameter is required")
+			}
+			opts, err := p.options()
+			if err != nil {
+				return nil, err
+			}
+			return build(p, opts), nil
+		})
+	}
+
+	return errors.Join(
+		register(PlanID, true, func(p Params, opts []Option) gostage.Action {
+			return Plan(PlanID, p.Dir, opts...)
+		}),
+		register(ApplyID, true, func(p Params, opts []Option) gostage.Action {
+			return Apply(ApplyID, p.Dir, opts...)
+		}),
+		register(DestroyID, true, func(p Params, opts []Option) gostage.Action {
+			return Destroy(DestroyID, p.Dir, opts...)
+		}),
+		register(RollbackID, false, func(p Params, opts []Option) gostage.Action {
+			return Rollback(RollbackID, opts...)
+		}),
+	)
+}
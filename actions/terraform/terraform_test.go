@@ -0,0 +1,161 @@
+package terraform
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/davidroman0O/gostage/gostagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTerraform logs every invocation with its directory and answers with a
+// plan creating a bucket and replacing an instance. Directories named
+// "broken" fail to apply.
+const fakeTerraform = `#!/bin/sh
+printf '%s: %s\n' "$(basename "$PWD")" "$*" >> "$TERRAFORM_LOG"
+case "$1" in
+plan) exit 2 ;;
+show) echo '{"resource_changes":[{"address":"aws_s3_bucket.logs","change":{"actions":["create"]}},{"address":"aws_instance.web","change":{"actions":["delete","create"]}},{"address":"data.aws_ami.base","change":{"actions":["read"]}},{"address":"aws_vpc.main","change":{"actions":["no-op"]}}]}' ;;
+apply) case "$PWD" in *broken) echo 'Error: creating instance: quota exceeded' >&2; exit 1 ;; esac ;;
+output) echo '{"endpoint":{"sensitive":false,"type":"string","value":"https://app.example.com"},"ports":{"sensitive":false,"value":[80,443]}}' ;;
+esac
+`
+
+// setup installs the fake terraform and returns its path, the path of its log
+// and a directory holding the "network", "app" and "broken" configurations.
+func setup(t *testing.T) (string, string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "terraform")
+	require.NoError(t, os.WriteFile(binary, []byte(fakeTerraform), 0o755))
+	log := filepath.Join(dir, "log")
+	t.Setenv("TERRAFORM_LOG", log)
+
+	infra := filepath.Join(dir, "infra")
+	for _, name := range []string{"network", "app", "broken"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(infra, name), 0o755))
+	}
+	return binary, log, infra
+}
+
+func calls(t *testing.T, log string) []string {
+	t.Helper()
+	data, err := os.ReadFile(log)
+	require.NoError(t, err)
+	return strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+}
+
+func TestPlanAndApply(t *testing.T) {
+	binary, log, infra := setup(t)
+	initial := map[string]interface{}{"infra": infra, "region": "eu-west-1"}
+
+	provision := gostage.NewStage("provision", "Provision", "")
+	provision.AddAction(Plan("plan", "{{ .store.infra }}/app", WithBinary(binary), WithPlanFile("app.tfplan"),
+		WithVar("region", "{{ .store.region }}"), WithVar("count", "2"), WithVarFile("{{ .store.region }}.tfvars")))
+	provision.AddAction(Apply("apply", "{{ .store.infra }}/app", WithBinary(binary), WithPlanFile("app.tfplan"),
+		WithOutputKey("app"), NoInit()))
+
+	result := gostagetest.RunStages(t, initial, provision, RollbackStage("destroy", WithBinary(binary)))
+	require.True(t, result.Success, "%v", result.Error)
+
+	assert.Equal(t, map[string]interface{}{
+		"hasChanges": true,
+		"add":        2,
+		"change":     0,
+		"destroy":    1,
+		"changes": []interface{}{
+			map[string]interface{}{"address": "aws_s3_bucket.logs", "actions": []interface{}{"create"}},
+			map[string]interface{}{"address": "aws_instance.web", "actions": []interface{}{"delete", "create"}},
+		},
+	}, result.FinalStore[DefaultPlanKey])
+	assert.Equal(t, map[string]interface{}{
+		"endpoint": "https://app.example.com",
+		"ports":    []interface{}{float64(80), float64(443)},
+	}, result.FinalStore["app"])
+
+	assert.Equal(t, []string{
+		"app: init -input=false -no-color",
+		"app: plan -input=false -no-color -detailed-exitcode -out=app.tfplan -var=count=2 -var=region=eu-west-1 -var-file=eu-west-1.tfvars",
+		"app: show -json -no-color app.tfplan",
+		"app: apply -input=false -no-color -auto-approve app.tfplan",
+		"app: output -json -no-color",
+	}, calls(t, log))
+}
+
+func TestRollbackOnFailure(t *testing.T) {
+	binary, log, infra := setup(t)
+	initial := map[string]interface{}{"infra": infra, "region": "eu-west-1"}
+	opts := []Option{WithBinary(binary), NoInit(), WithVar("region", "{{ .store.region }}")}
+
+	provision := gostage.NewStage("provision", "Provision", "")
+	provision.AddAction(Apply("network", "{{ .store.infra }}/network", opts...))
+	provision.AddAction(Apply("network-again", "{{ .store.infra }}/network", opts...))
+	provision.AddAction(Apply("scratch", "{{ .store.infra }}/app", append(opts, NoRollback())...))
+	provision.AddAction(Apply("broken", "{{ .store.infra }}/broken", opts...))
+
+	result := gostagetest.RunStages(t, initial, provision, RollbackStage("destroy", WithBinary(binary)))
+	require.False(t, result.Success)
+	assert.ErrorContains(t, result.Error, "terraform apply failed: exit status 1: Error: creating instance: quota exceeded")
+	assert.Equal(t, gostage.StatusCompleted, result.StageStatuses["destroy"])
+	assert.NotContains(t, result.FinalStore, RollbackKey)
+
+	got := calls(t, log)
+	assert.Equal(t, []string{
+		"broken: destroy -input=false -no-color -auto-approve -var=region=eu-west-1",
+		"network: destroy -input=false -no-color -auto-approve -var=region=eu-west-1",
+	}, got[len(got)-2:])
+	assert.NotContains(t, got, "app: destroy -input=false -no-color -auto-approve -var=region=eu-west-1")
+}
+
+func TestDestroy(t *testing.T) {
+	binary, log, infra := setup(t)
+	initial := map[string]interface{}{"infra": infra, "region": "eu-west-1"}
+
+	stage := gostage.NewStage("teardown", "Teardown", "")
+	stage.AddAction(Destroy("destroy", "{{ .store.infra }}/app", WithBinary(binary), WithEnv("TF_WORKSPACE", "{{ .store.region }}")))
+	result := gostagetest.RunStages(t, initial, stage)
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, []string{"app: init -input=false -no-color", "app: destroy -input=false -no-color -auto-approve"}, calls(t, log))
+
+	missing := gostage.NewStage("missing", "Missing", "")
+	missing.AddAction(Destroy("destroy", "{{ .store.infra }}/app", WithBinary(filepath.Join(infra, "none"))))
+	result = gostagetest.RunStages(t, initial, missing)
+	assert.ErrorContains(t, result.Error, "failed to run")
+}
+
+func TestRegisteredTerraformActions(t *testing.T) {
+	binary, log, infra := setup(t)
+	registry := gostage.NewActionRegistry()
+	require.NoError(t, Register(registry))
+
+	def := &gostage.SubWorkflowDef{
+		ID:           "defined",
+		InitialStore: map[string]interface{}{"infra": infra},
+		Stages: []gostage.StageDef{{
+			ID: "run",
+			Actions: []gostage.ActionDef{
+				{ID: PlanID, Params: map[string]interface{}{"dir": "{{ .store.infra }}/app", "binary": binary, "output": "plan", "vars": map[string]interface{}{"env": "prod"}}},
+				{ID: ApplyID, Params: map[string]interface{}{"dir": "{{ .store.infra }}/app", "binary": binary, "noInit": true, "timeout": "10m"}},
+			},
+		}},
+	}
+	wf, err := gostage.NewWorkflowFromDefWithRegistry(def, registry)
+	require.NoError(t, err)
+
+	result := gostage.NewRunner().ExecuteWithOptions(wf, gostage.DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, true, result.FinalStore["plan"].(map[string]interface{})["hasChanges"])
+	assert.Equal(t, "https://app.example.com", result.FinalStore[DefaultOutputKey].(map[string]interface{})["endpoint"])
+	assert.Len(t, calls(t, log), 5)
+
+	_, err = registry.Resolve(PlanID, map[string]interface{}{})
+	assert.ErrorContains(t, err, "the dir parameter is required")
+	_, err = registry.Resolve(ApplyID, map[string]interface{}{"dir": "infra", "timeout": "soon"})
+	assert.ErrorContains(t, err, "invalid timeout")
+	_, err = registry.Resolve(RollbackID, map[string]interface{}{})
+	assert.NoError(t, err)
+}
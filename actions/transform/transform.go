@@ -0,0 +1,250 @@
+// Package transform provides an action reshaping store data with jq
+// expressions, replacing the trivial Go actions whose only job is to filter,
+// project or compute values between stages.
+//
+// Each mapping computes the value of an output key with an expression in the
+// jq language. Expressions read store keys with the store function, which
+// takes an optional default for missing keys:
+//
+//	summarize, err := transform.New("summarize",
+//		transform.Map("order.total", `store("order.items") | map(.price * .quantity) | add`),
+//		transform.Map("order.large", `store("order.items") | map(select(.quantity >= 10))`),
+//		transform.Map("order.currency", `store("order.currency"; "EUR") | ascii_upcase`),
+//	)
+//
+// Store values are read as their JSON encodings are, so struct fields go by
+// their JSON names, and results are stored as int, float64, string, bool,
+// []interface{} and map[string]interface{}.
+package transform
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/davidroman0O/gostage/store"
+	"github.com/itchyny/gojq"
+)
+
+// ActionID is the ID under which Register adds the transform action to a registry.
+const ActionID = "transform.jq"
+
+// mapping computes the value of key with a jq query.
+type mapping struct {
+	key   string
+	query *gojq.Query
+}
+
+// TransformAction puts the values its jq expressions compute into the store.
+type TransformAction struct {
+	gostage.BaseAction
+
+	mappings []mapping
+	errs     []error
+}
+
+// Option configures a TransformAction.
+type Option func(*TransformAction)
+
+// Map sets key to the value of the jq expression expr. An expression must
+// produce a single value: wrap it in [...] to collect several. An expression
+// producing none, such as select filtering its input out, leaves key as it is.
+func Map(key, expr string) Option {
+	return func(a *TransformAction) {
+		query, err := gojq.Parse(expr)
+		if err == nil {
+			// Compiling checks the functions the expression calls
+			_, err = compile(query, nil)
+		}
+		if err != nil {
+			a.errs = append(a.errs, fmt.Errorf("invalid expression for key '%s': %w", key, err))
+			return
+		}
+		a.mappings = append(a.mappings, mapping{key: key, query: query})
+	}
+}
+
+// New creates an action named name that applies mappings. Invalid expressions
+// fail New rather than the workflow.
+func New(name string, mappings ...Option) (*TransformAction, error) {
+	a := &TransformAction{BaseAction: gostage.NewBaseAction(name, "Transforms store data")}
+	for _, opt := range mappings {
+		opt(a)
+	}
+	if err := errors.Join(a.errs...); err != nil {
+		return nil, err
+	}
+	if len(a.mappings) == 0 {
+		return nil, fmt.Errorf("transform action '%s' has no mappings", name)
+	}
+	return a, nil
+}
+
+// Execute evaluates every expression against the store as it was when the
+// action started, then puts their values, so mappings do not see each other's
+// results.
+func (a *TransformAction) Execute(ctx *gostage.ActionContext) error {
+	runCtx := ctx.GoContext
+	if runCtx == nil {
+		runCtx = context.Background()
+	}
+
+	s := ctx.Store()
+	results := make([]any, len(a.mappings))
+	produced := make([]bool, len(a.mappings))
+	for i, m := range a.mappings {
+		code, err := compile(m.query, s)
+		if err != nil {
+			return fmt.Errorf("invalid expression for key '%s': %w", m.key, err)
+		}
+		iter := code.RunWithContext(runCtx, nil)
+		for {
+			value, ok := iter.Next()
+			if !ok {
+				break
+			}
+			if err, isErr := value.(error); isErr {
+				return fmt.Errorf("failed to compute key '%s': %w", m.key, err)
+			}
+			if produced[i] {
+				return fmt.Errorf("expression for key '%s' produced several values; wrap it in [...] to collect them", m.key)
+			}
+			results[i], produced[i] = value, true
+		}
+	}
+
+	for i, m := range a.mappings {
+		if !produced[i] {
+			ctx.Logger.Debug("Expression for key %s produced no value", m.key)
+			continue
+		}
+		if err := s.Put(m.key, fromJQ(results[i])); err != nil {
+			return fmt.Errorf("failed to store key '%s': %w", m.key, err)
+		}
+	}
+	return nil
+}
+
+// compile compiles query with the store function reading from s, or failing
+// if s is nil.
+func compile(query *gojq.Query, s *store.KVStore) (*gojq.Code, error) {
+	return gojq.Compile(query, gojq.WithFunction("store", 1, 2, func(_ any, args []any) any {
+		key, ok := args[0].(string)
+		if !ok {
+			return fmt.Errorf("store: key must be a string, not %T", args[0])
+		}
+		if s == nil {
+			return errors.New("store: no store")
+		}
+		value, err := s.GetValue(key)
+		if errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrExpired) {
+			if len(args) == 2 {
+				return args[1]
+			}
+			return fmt.Errorf("store: key '%s' not found", key)
+		}
+		if err != nil {
+			return fmt.Errorf("store: %w", err)
+		}
+		converted, err := toJQ(value)
+		if err != nil {
+			return fmt.Errorf("store: key '%s': %w", key, err)
+		}
+		return converted
+	}))
+}
+
+// toJQ converts a store value into the values gojq works with.
+func toJQ(value any) (any, error) {
+	switch v := value.(type) {
+	case nil, bool, int, float64, string:
+		return v, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("cannot convert a %T: %w", value, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var generic any
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, fmt.Errorf("cannot convert a %T: %w", value, err)
+	}
+	return normalizeNumbers(generic), nil
+}
+
+// normalizeNumbers replaces the json.Number values of v with ints, or with
+// float64 values for those that are not integers.
+func normalizeNumbers(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return int(i)
+		}
+		if i, ok := new(big.Int).SetString(v.String(), 10); ok {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case []any:
+		for i, elem := range v {
+			v[i] = normalizeNumbers(elem)
+		}
+	case map[string]any:
+		for key, elem := range v {
+			v[key] = normalizeNumbers(elem)
+		}
+	}
+	return v
+}
+
+// fromJQ converts a value computed by gojq into a store value. Integers too
+// large for an int are stored as float64.
+func fromJQ(value any) any {
+	switch v := value.(type) {
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f
+	case []any:
+		for i, elem := range v {
+			v[i] = fromJQ(elem)
+		}
+	case map[string]any:
+		for key, elem := range v {
+			v[key] = fromJQ(elem)
+		}
+	}
+	return value
+}
+
+// Params configure a transform.jq action in a workflow definition.
+type Params struct {
+	// Mappings maps each output key to its jq expression
+	Mappings map[string]string `json:"mappings"`
+}
+
+// Register adds the transform action to registry under ActionID, so that
+// declarative definitions can reshape store data.
+func Register(registry *gostage.ActionRegistry) error {
+	return gostage.RegisterTyped(registry, ActionID, func(params Params) (gostage.Action, error) {
+		if len(params.Mappings) == 0 {
+			return nil, errors.New("the mappings parameter is required")
+		}
+		keys := make([]string, 0, len(params.Mappings))
+		for key := range params.Mappings {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		opts := make([]Option, len(keys))
+		for i, key := range keys {
+			opts[i] = Map(key, params.Mappings[key])
+		}
+		return New(ActionID, opts...)
+	})
+}
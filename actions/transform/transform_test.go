@@ -0,0 +1,98 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/davidroman0O/gostage/gostagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type lineItem struct {
+	SKU      string  `json:"sku"`
+	Price    float64 `json:"price"`
+	Quantity int     `json:"quantity"`
+}
+
+func TestTransformMapsStoreKeys(t *testing.T) {
+	action, err := New("summarize",
+		Map("order.total", `store("order.items") | map(.price * .quantity) | add`),
+		Map("order.bulk", `store("order.items") | map(select(.quantity >= 10) | .sku)`),
+		Map("order.currency", `store("order.currency"; "eur") | ascii_upcase`),
+		Map("order.count", `store("order.items") | length`),
+		Map("order.label", `"\(store("customer").name) (\(store("order.items") | length) items)"`),
+		Map("order.items", `store("order.items") | map(.sku)`),
+		Map("order.rush", `store("order.items") | select(length > 5)`),
+	)
+	require.NoError(t, err)
+
+	result := gostagetest.RunActions(t, map[string]interface{}{
+		"order.items": []lineItem{{SKU: "a", Price: 2.5, Quantity: 4}, {SKU: "b", Price: 1, Quantity: 10}},
+		"customer":    map[string]interface{}{"name": "Ada"},
+	}, action)
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, 20.0, result.FinalStore["order.total"])
+	assert.Equal(t, []interface{}{"b"}, result.FinalStore["order.bulk"])
+	assert.Equal(t, "EUR", result.FinalStore["order.currency"])
+	assert.Equal(t, 2, result.FinalStore["order.count"])
+	assert.Equal(t, "Ada (2 items)", result.FinalStore["order.label"])
+	// Every expression sees the store as it was when the action started
+	assert.Equal(t, []interface{}{"a", "b"}, result.FinalStore["order.items"])
+	assert.NotContains(t, result.FinalStore, "order.rush")
+}
+
+func TestTransformErrors(t *testing.T) {
+	_, err := New("broken", Map("a", `store("x") |`), Map("b", `nosuchfunction(1)`))
+	assert.ErrorContains(t, err, "invalid expression for key 'a'")
+	assert.ErrorContains(t, err, "invalid expression for key 'b'")
+	_, err = New("empty")
+	assert.ErrorContains(t, err, "has no mappings")
+
+	action, err := New("missing", Map("out", `store("nothing")`))
+	require.NoError(t, err)
+	result := gostagetest.RunActions(t, nil, action)
+	assert.ErrorContains(t, result.Error, "key 'nothing' not found")
+
+	action, err = New("several", Map("out", `store("items")[]`))
+	require.NoError(t, err)
+	result = gostagetest.RunActions(t, map[string]interface{}{"items": []int{1, 2}}, action)
+	assert.ErrorContains(t, result.Error, "produced several values")
+
+	action, err = New("failing", Map("out", `store("items") | error("bad items")`))
+	require.NoError(t, err)
+	result = gostagetest.RunActions(t, map[string]interface{}{"items": []int{1, 2}}, action)
+	assert.ErrorContains(t, result.Error, "bad items")
+}
+
+func TestRegisteredTransform(t *testing.T) {
+	registry := gostage.NewActionRegistry()
+	require.NoError(t, Register(registry))
+
+	def := &gostage.SubWorkflowDef{
+		ID:           "defined",
+		InitialStore: map[string]interface{}{"prices": []interface{}{1, 2, 3}},
+		Stages: []gostage.StageDef{{
+			ID: "run",
+			Actions: []gostage.ActionDef{{
+				ID: ActionID,
+				Params: map[string]interface{}{"mappings": map[string]interface{}{
+					"sum": `store("prices") | add`,
+					"max": `store("prices") | max`,
+				}},
+			}},
+		}},
+	}
+	wf, err := gostage.NewWorkflowFromDefWithRegistry(def, registry)
+	require.NoError(t, err)
+
+	result := gostage.NewRunner().ExecuteWithOptions(wf, gostage.DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, 6, result.FinalStore["sum"])
+	assert.Equal(t, 3, result.FinalStore["max"])
+
+	_, err = registry.Resolve(ActionID, nil)
+	assert.ErrorContains(t, err, "mappings parameter is required")
+	_, err = registry.Resolve(ActionID, map[string]interface{}{"mappings": map[string]interface{}{"a": "("}})
+	assert.ErrorContains(t, err, "invalid expression for key 'a'")
+}
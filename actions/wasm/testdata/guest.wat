@@ -0,0 +1,63 @@
+;; The module the tests run, assembled into guest.wasm with:
+;;
+;;	wat2wasm guest.wat -o guest.wasm
+(module
+  (import "gostage" "store_get" (func $store_get (param i32 i32 i32 i32) (result i32)))
+  (import "gostage" "store_put" (func $store_put (param i32 i32 i32 i32)))
+  (import "gostage" "log" (func $log (param i32 i32 i32)))
+
+  (memory (export "memory") 1)
+  (global $runs (mut i32) (i32.const 0))
+
+  (data (i32.const 0) "input")
+  (data (i32.const 16) "output")
+  (data (i32.const 32) "missing")
+  (data (i32.const 48) "found")
+  (data (i32.const 64) "false")
+  (data (i32.const 80) "copied the input")
+  (data (i32.const 96) "runs")
+
+  ;; Copies the value of input to output, records that missing is not found
+  ;; and logs. Fails with code 1 without input and 2 if it is too large.
+  (func (export "run") (result i32)
+    (local $n i32)
+    (local.set $n (call $store_get (i32.const 0) (i32.const 5) (i32.const 1024) (i32.const 1024)))
+    (if (i32.lt_s (local.get $n) (i32.const 0))
+      (then (return (i32.const 1))))
+    (if (i32.gt_s (local.get $n) (i32.const 1024))
+      (then (return (i32.const 2))))
+    (call $store_put (i32.const 16) (i32.const 6) (i32.const 1024) (local.get $n))
+    (if (i32.eq (call $store_get (i32.const 32) (i32.const 7) (i32.const 0) (i32.const 0)) (i32.const -1))
+      (then (call $store_put (i32.const 48) (i32.const 5) (i32.const 64) (i32.const 5))))
+    (call $log (i32.const 1) (i32.const 80) (i32.const 16))
+    (i32.const 0))
+
+  ;; Never returns.
+  (func (export "spin")
+    (loop $forever
+      (br $forever)))
+
+  ;; Fails with code 3 if the memory cannot grow by 300 pages.
+  (func (export "grow") (result i32)
+    (if (i32.eq (memory.grow (i32.const 300)) (i32.const -1))
+      (then (return (i32.const 3))))
+    (i32.const 0))
+
+  ;; Puts a value that is not JSON.
+  (func (export "put_invalid")
+    (call $store_put (i32.const 0) (i32.const 5) (i32.const 80) (i32.const 16)))
+
+  ;; Puts a value out of the bounds of the memory.
+  (func (export "put_out_of_bounds")
+    (call $store_put (i32.const 0) (i32.const 5) (i32.const 65530) (i32.const 16)))
+
+  ;; Logs at an unknown level.
+  (func (export "log_unknown")
+    (call $log (i32.const 7) (i32.const 80) (i32.const 16)))
+
+  ;; Counts the runs of the instance in a global and puts the count as runs.
+  (func (export "count")
+    (global.set $runs (i32.add (global.get $runs) (i32.const 1)))
+    (i32.store8 (i32.const 2048) (i32.add (global.get $runs) (i32.const 48)))
+    (call $store_put (i32.const 96) (i32.const 4) (i32.const 2048) (i32.const 1)))
+)
@@ -0,0 +1,9 @@
+;; A module importing a host function the action does not provide, assembled
+;; into unknown_import.wasm with:
+;;
+;;	wat2wasm unknown_import.wat -o unknown_import.wasm
+(module
+  (import "gostage" "exec" (func $exec))
+  (func (export "run")
+    (call $exec))
+)
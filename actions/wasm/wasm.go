@@ -0,0 +1,397 @@
+// Package wasm provides an action running WebAssembly modules, for action
+// code supplied by the users of a multi-tenant deployment, which the workflow
+// must not trust.
+//
+// Modules run on wazero, without cgo. Every run gets a fresh instance of the
+// module with its own memory, bounded by WithMaxMemoryPages. Modules cannot
+// reach the file system, the network, the environment or the real clock;
+// they see the workflow store and log through the functions of the gostage
+// host module, which they import:
+//
+//	(import "gostage" "store_get" (func (param i32 i32 i32 i32) (result i32)))
+//	(import "gostage" "store_put" (func (param i32 i32 i32 i32)))
+//	(import "gostage" "log" (func (param i32 i32 i32)))
+//
+// Strings and values are passed as a pointer and a length in the exported
+// memory of the module, and store values are encoded as JSON:
+//
+//   - store_get(key, key_len, buf, buf_cap) writes the value of key to buf
+//     and returns its length, or -1 if the key is missing. Nothing is written
+//     if the value is longer than buf_cap, so that the module can call again
+//     with a larger buffer.
+//   - store_put(key, key_len, value, value_len) stores the value.
+//   - log(level, msg, msg_len) logs msg at level 0 (debug), 1 (info),
+//     2 (warn) or 3 (error).
+//
+// The action calls the exported function run, which takes no parameters. It
+// fails if run traps, such as when a host function fails, or returns a
+// non-zero i32. Modules built for WASI, such as with TinyGo or the Rust
+// wasm32-wasip1 target, can run too: their standard output is logged at the
+// info level and their standard error at the error level.
+//
+// Values put by a module are stored as JSON values decode: nil, bool, int,
+// float64, string, []interface{} and map[string]interface{}.
+package wasm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/davidroman0O/gostage/store"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// ActionID is the ID under which Register adds the wasm action to a registry.
+const ActionID = "wasm.module"
+
+// HostModule is the name of the module whose functions modules import to
+// reach the store and the logger.
+const HostModule = "gostage"
+
+// DefaultEntrypoint is the exported function the action calls unless
+// WithEntrypoint changes it.
+const DefaultEntrypoint = "run"
+
+// DefaultMaxMemoryPages bounds the memory of a module, in 64 KiB pages,
+// unless WithMaxMemoryPages changes it: 256 pages are 16 MiB.
+const DefaultMaxMemoryPages = 256
+
+// hostFunctions lists the functions of HostModule.
+var hostFunctions = map[string]bool{"store_get": true, "store_put": true, "log": true}
+
+// WasmAction runs a WebAssembly module against the workflow store.
+type WasmAction struct {
+	gostage.BaseAction
+
+	runtime        wazero.Runtime
+	module         wazero.CompiledModule
+	entrypoint     string
+	maxMemoryPages uint32
+	timeout        time.Duration
+}
+
+// Option configures a WasmAction.
+type Option func(*WasmAction)
+
+// WithEntrypoint calls the exported function name instead of DefaultEntrypoint.
+func WithEntrypoint(name string) Option {
+	return func(a *WasmAction) {
+		a.entrypoint = name
+	}
+}
+
+// WithMaxMemoryPages bounds the memory of the module to pages of 64 KiB.
+func WithMaxMemoryPages(pages uint32) Option {
+	return func(a *WasmAction) {
+		a.maxMemoryPages = pages
+	}
+}
+
+// WithTimeout stops the module if it runs longer than timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(a *WasmAction) {
+		a.timeout = timeout
+	}
+}
+
+// New creates an action named name that runs the module in binary. The
+// module is compiled here, so invalid modules, modules importing functions
+// the action does not provide and modules without the entrypoint fail New
+// rather than the workflow. Close releases the compiled module.
+func New(name string, binary []byte, opts ...Option) (*WasmAction, error) {
+	a := &WasmAction{
+		BaseAction:     gostage.NewBaseAction(name, "Runs a WebAssembly module"),
+		entrypoint:     DefaultEntrypoint,
+		maxMemoryPages: DefaultMaxMemoryPages,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	ctx := context.Background()
+	config := wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(a.maxMemoryPages).
+		WithCloseOnContextDone(true)
+	a.runtime = wazero.NewRuntimeWithConfig(ctx, config)
+	if err := a.instantiateHost(ctx); err != nil {
+		a.runtime.Close(ctx)
+		return nil, fmt.Errorf("failed to set up the host functions of action '%s': %w", name, err)
+	}
+
+	module, err := a.runtime.CompileModule(ctx, binary)
+	if err == nil {
+		a.module = module
+		err = a.checkModule()
+	}
+	if err != nil {
+		a.runtime.Close(ctx)
+		return nil, fmt.Errorf("invalid module for action '%s': %w", name, err)
+	}
+	return a, nil
+}
+
+// instantiateHost instantiates HostModule and WASI in the runtime of a.
+func (a *WasmAction) instantiateHost(ctx context.Context) error {
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, a.runtime); err != nil {
+		return err
+	}
+	_, err := a.runtime.NewHostModuleBuilder(HostModule).
+		NewFunctionBuilder().WithFunc(storeGet).Export("store_get").
+		NewFunctionBuilder().WithFunc(storePut).Export("store_put").
+		NewFunctionBuilder().WithFunc(logMessage).Export("log").
+		Instantiate(ctx)
+	return err
+}
+
+// checkModule returns an error if the module imports functions a does not
+// provide, or does not export a valid entrypoint.
+func (a *WasmAction) checkModule() error {
+	for _, imported := range a.module.ImportedFunctions() {
+		module, name, _ := imported.Import()
+		switch {
+		case module == HostModule && !hostFunctions[name]:
+			return fmt.Errorf("imports unknown host function %s.%s", module, name)
+		case module != HostModule && module != wasi_snapshot_preview1.ModuleName:
+			return fmt.Errorf("imports function %s.%s of unknown module %q", module, name, module)
+		}
+	}
+
+	entrypoint, ok := a.module.ExportedFunctions()[a.entrypoint]
+	if !ok {
+		return fmt.Errorf("exports no function %q", a.entrypoint)
+	}
+	results := entrypoint.ResultTypes()
+	if len(entrypoint.ParamTypes()) > 0 || len(results) > 1 || (len(results) == 1 && results[0] != api.ValueTypeI32) {
+		return fmt.Errorf("function %q must take no parameters and return nothing or an i32", a.entrypoint)
+	}
+	return nil
+}
+
+// Close releases the compiled module and its runtime. The action cannot run
+// once closed.
+func (a *WasmAction) Close() error {
+	return a.runtime.Close(context.Background())
+}
+
+// Execute runs the module in a new instance, discarded once it returns.
+func (a *WasmAction) Execute(ctx *gostage.ActionContext) error {
+	runCtx := ctx.GoContext
+	if runCtx == nil {
+		runCtx = context.Background()
+	}
+	if a.timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(runCtx, a.timeout)
+		defer cancel()
+	}
+	callCtx := context.WithValue(runCtx, hostKey{}, &host{store: ctx.Store(), logger: ctx.Logger})
+
+	config := wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions().
+		WithStdout(&logWriter{log: ctx.Logger.Info}).
+		WithStderr(&logWriter{log: ctx.Logger.Error})
+	instance, err := a.runtime.InstantiateModule(callCtx, a.module, config)
+	if err != nil {
+		return a.failure(runCtx, err)
+	}
+	defer instance.Close(context.Background())
+
+	results, err := instance.ExportedFunction(a.entrypoint).Call(callCtx)
+	if err != nil {
+		return a.failure(runCtx, err)
+	}
+	if len(results) == 1 && api.DecodeI32(results[0]) != 0 {
+		return fmt.Errorf("wasm module '%s' failed with code %d", a.Name(), api.DecodeI32(results[0]))
+	}
+	return nil
+}
+
+// failure returns the error of a module that failed with err while running
+// under runCtx. Modules exiting through WASI with code 0 succeed.
+func (a *WasmAction) failure(runCtx context.Context, err error) error {
+	if runCtx.Err() != nil {
+		return fmt.Errorf("wasm module '%s' was cancelled: %w", a.Name(), context.Cause(runCtx))
+	}
+	var exit *sys.ExitError
+	if errors.As(err, &exit) {
+		if exit.ExitCode() == 0 {
+			return nil
+		}
+		return fmt.Errorf("wasm module '%s' exited with code %d", a.Name(), exit.ExitCode())
+	}
+	return fmt.Errorf("wasm module '%s' failed: %w", a.Name(), err)
+}
+
+// hostKey is the context key of the host of a call into a module
+type hostKey struct{}
+
+// host is what the host functions reach during a call into a module: the
+// store, as the action sees it, and the logger of the action.
+type host struct {
+	store  *store.KVStore
+	logger gostage.Logger
+}
+
+// hostOf returns the host of the call ctx belongs to.
+func hostOf(ctx context.Context) *host {
+	return ctx.Value(hostKey{}).(*host)
+}
+
+// Host functions fail by panicking: wazero turns the panic into a trap of
+// the module, and the error into the error of the call.
+
+func storeGet(ctx context.Context, m api.Module, keyPtr, keyLen, bufPtr, bufCap uint32) int32 {
+	key := readString(m, "store_get", keyPtr, keyLen)
+	value, err := hostOf(ctx).store.GetValue(key)
+	if errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrExpired) {
+		return -1
+	}
+	if err != nil {
+		panic(fmt.Errorf("store_get: %w", err))
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		panic(fmt.Errorf("store_get: key '%s': %w", key, err))
+	}
+	if len(data) > math.MaxInt32 {
+		panic(fmt.Errorf("store_get: key '%s': the value is too large", key))
+	}
+	if uint32(len(data)) <= bufCap && !m.Memory().Write(bufPtr, data) {
+		panic(fmt.Errorf("store_get: buffer out of memory bounds"))
+	}
+	return int32(len(data))
+}
+
+func storePut(ctx context.Context, m api.Module, keyPtr, keyLen, valuePtr, valueLen uint32) {
+	key := readString(m, "store_put", keyPtr, keyLen)
+	value, err := decodeValue(read(m, "store_put", valuePtr, valueLen))
+	if err != nil {
+		panic(fmt.Errorf("store_put: key '%s': %w", key, err))
+	}
+	if err := hostOf(ctx).store.Put(key, value); err != nil {
+		panic(fmt.Errorf("store_put: %w", err))
+	}
+}
+
+func logMessage(ctx context.Context, m api.Module, level, msgPtr, msgLen uint32) {
+	logger := hostOf(ctx).logger
+	levels := []func(format string, args ...interface{}){logger.Debug, logger.Info, logger.Warn, logger.Error}
+	if level >= uint32(len(levels)) {
+		panic(fmt.Errorf("log: unknown level %d", level))
+	}
+	levels[level]("%s", readString(m, "log", msgPtr, msgLen))
+}
+
+// read returns the bytes of the memory of m at ptr, failing the host
+// function fn if they are out of bounds. They are only valid until the
+// module runs again.
+func read(m api.Module, fn string, ptr, length uint32) []byte {
+	data, ok := m.Memory().Read(ptr, length)
+	if !ok {
+		panic(fmt.Errorf("%s: memory range out of bounds", fn))
+	}
+	return data
+}
+
+// readString returns a copy of the string in the memory of m at ptr.
+func readString(m api.Module, fn string, ptr, length uint32) string {
+	return string(read(m, fn, ptr, length))
+}
+
+// decodeValue decodes the JSON value in data into a store value, with
+// integers as int rather than float64.
+func decodeValue(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("invalid JSON value: %w", err)
+	}
+	return fromJSON(value), nil
+}
+
+// fromJSON converts the numbers of a value decoded with UseNumber.
+func fromJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil && i >= math.MinInt && i <= math.MaxInt {
+			return int(i)
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = fromJSON(elem)
+		}
+	case map[string]interface{}:
+		for key, elem := range v {
+			v[key] = fromJSON(elem)
+		}
+	}
+	return value
+}
+
+// logWriter logs what a module writes to a standard stream, one message per write.
+type logWriter struct {
+	log func(format string, args ...interface{})
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	if msg := strings.TrimRight(string(p), "\n"); msg != "" {
+		w.log("%s", msg)
+	}
+	return len(p), nil
+}
+
+// Params configure a wasm.module action in a workflow definition.
+type Params struct {
+	// Path is the path of the .wasm file of the module
+	Path string `json:"path"`
+	// Entrypoint is the exported function to call, DefaultEntrypoint if empty
+	Entrypoint string `json:"entrypoint,omitempty"`
+	// MaxMemoryPages bounds the memory of the module, DefaultMaxMemoryPages if zero
+	MaxMemoryPages uint32 `json:"maxMemoryPages,omitempty"`
+	// Timeout is a duration such as "30s"
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// Register adds the wasm action to registry under ActionID, so that
+// declarative definitions can run modules.
+func Register(registry *gostage.ActionRegistry) error {
+	return gostage.RegisterTyped(registry, ActionID, func(params Params) (gostage.Action, error) {
+		if params.Path == "" {
+			return nil, errors.New("the path parameter is required")
+		}
+		var opts []Option
+		if params.Entrypoint != "" {
+			opts = append(opts, WithEntrypoint(params.Entrypoint))
+		}
+		if params.MaxMemoryPages > 0 {
+			opts = append(opts, WithMaxMemoryPages(params.MaxMemoryPages))
+		}
+		if params.Timeout != "" {
+			timeout, err := time.ParseDuration(params.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timeout: %w", err)
+			}
+			opts = append(opts, WithTimeout(timeout))
+		}
+		binary, err := os.ReadFile(params.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read module: %w", err)
+		}
+		return New(ActionID, binary, opts...)
+	})
+}
@@ -0,0 +1,143 @@
+package wasm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/davidroman0O/gostage/gostagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newGuest creates an action running testdata/guest.wasm from entrypoint.
+func newGuest(t *testing.T, entrypoint string, opts ...Option) *WasmAction {
+	t.Helper()
+	binary, err := os.ReadFile(filepath.Join("testdata", "guest.wasm"))
+	require.NoError(t, err)
+	action, err := New(entrypoint, binary, append([]Option{WithEntrypoint(entrypoint)}, opts...)...)
+	require.NoError(t, err)
+	t.Cleanup(func() { action.Close() })
+	return action
+}
+
+func TestWasmReadsAndWritesTheStore(t *testing.T) {
+	action := newGuest(t, "run")
+
+	options := gostage.DefaultRunOptions()
+	options.InitialStore = map[string]interface{}{
+		"input": map[string]interface{}{"items": []int{3, 10}, "currency": "EUR", "total": 12.5},
+	}
+	options.CaptureLogs = true
+	result := gostagetest.New(t, gostagetest.WithRunOptions(options)).RunActions(action)
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, map[string]interface{}{"items": []interface{}{3, 10}, "currency": "EUR", "total": 12.5}, result.FinalStore["output"])
+	assert.Equal(t, false, result.FinalStore["found"])
+
+	var messages []string
+	for _, entry := range result.Logs {
+		messages = append(messages, entry.Message)
+	}
+	assert.Contains(t, messages, "copied the input")
+
+	// Without input, run returns a non-zero code
+	result = gostagetest.RunActions(t, nil, action)
+	assert.ErrorContains(t, result.Error, "wasm module 'run' failed with code 1")
+}
+
+func TestWasmRunsInAFreshInstance(t *testing.T) {
+	action := newGuest(t, "count")
+
+	for i := 0; i < 2; i++ {
+		result := gostagetest.RunActions(t, nil, action)
+		require.True(t, result.Success, "%v", result.Error)
+		assert.Equal(t, 1, result.FinalStore["runs"], "the global of the module counts from zero on every run")
+	}
+}
+
+func TestWasmFailures(t *testing.T) {
+	_, err := New("broken", []byte("not a module"))
+	assert.ErrorContains(t, err, "invalid module for action 'broken'")
+
+	binary, err := os.ReadFile(filepath.Join("testdata", "guest.wasm"))
+	require.NoError(t, err)
+	_, err = New("missing", binary, WithEntrypoint("missing"))
+	assert.ErrorContains(t, err, `exports no function "missing"`)
+	_, err = New("memory", binary, WithEntrypoint("memory"))
+	assert.ErrorContains(t, err, `exports no function "memory"`)
+
+	binary, err = os.ReadFile(filepath.Join("testdata", "unknown_import.wasm"))
+	require.NoError(t, err)
+	_, err = New("unknown", binary)
+	assert.ErrorContains(t, err, "imports unknown host function gostage.exec")
+
+	result := gostagetest.RunActions(t, nil, newGuest(t, "put_invalid"))
+	assert.ErrorContains(t, result.Error, "store_put: key 'input': invalid JSON value")
+
+	result = gostagetest.RunActions(t, nil, newGuest(t, "put_out_of_bounds"))
+	assert.ErrorContains(t, result.Error, "store_put: memory range out of bounds")
+
+	result = gostagetest.RunActions(t, nil, newGuest(t, "log_unknown"))
+	assert.ErrorContains(t, result.Error, "log: unknown level 7")
+}
+
+func TestWasmLimits(t *testing.T) {
+	result := gostagetest.RunActions(t, nil, newGuest(t, "grow"))
+	assert.ErrorContains(t, result.Error, "wasm module 'grow' failed with code 3")
+	result = gostagetest.RunActions(t, nil, newGuest(t, "grow", WithMaxMemoryPages(512)))
+	assert.NoError(t, result.Error)
+
+	started := time.Now()
+	result = gostagetest.RunActions(t, nil, newGuest(t, "spin", WithTimeout(50*time.Millisecond)))
+	assert.ErrorIs(t, result.Error, context.DeadlineExceeded)
+	assert.ErrorContains(t, result.Error, "wasm module 'spin' was cancelled")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	options := gostage.DefaultRunOptions()
+	options.Context = ctx
+	result = gostagetest.New(t, gostagetest.WithRunOptions(options)).RunActions(newGuest(t, "spin"))
+	assert.ErrorIs(t, result.Error, context.DeadlineExceeded)
+	assert.Less(t, time.Since(started), 5*time.Second)
+}
+
+func TestWasmRespectsReadOnlyTag(t *testing.T) {
+	action := newGuest(t, "run")
+	action.AddTag(gostage.TagReadOnly)
+
+	result := gostagetest.RunActions(t, map[string]interface{}{"input": 1}, action)
+	assert.ErrorContains(t, result.Error, "read-only")
+}
+
+func TestRegisteredWasm(t *testing.T) {
+	registry := gostage.NewActionRegistry()
+	require.NoError(t, Register(registry))
+
+	def := &gostage.SubWorkflowDef{
+		ID:           "defined",
+		InitialStore: map[string]interface{}{"input": "gopher"},
+		Stages: []gostage.StageDef{{
+			ID: "run",
+			Actions: []gostage.ActionDef{{
+				ID:     ActionID,
+				Params: map[string]interface{}{"path": filepath.Join("testdata", "guest.wasm"), "timeout": "10s"},
+			}},
+		}},
+	}
+	wf, err := gostage.NewWorkflowFromDefWithRegistry(def, registry)
+	require.NoError(t, err)
+
+	result := gostage.NewRunner().ExecuteWithOptions(wf, gostage.DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, "gopher", result.FinalStore["output"])
+
+	_, err = registry.Resolve(ActionID, nil)
+	assert.ErrorContains(t, err, "path parameter is required")
+	_, err = registry.Resolve(ActionID, map[string]interface{}{"path": filepath.Join("testdata", "guest.wat")})
+	assert.ErrorContains(t, err, "invalid module")
+	_, err = registry.Resolve(ActionID, map[string]interface{}{"path": filepath.Join("testdata", "guest.wasm"), "entrypoint": "count", "timeout": "soon"})
+	assert.ErrorContains(t, err, "invalid timeout")
+}
@@ -0,0 +1,139 @@
+package gostage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SetAnnotation attaches a key/value annotation to the workflow, such as an
+// owner or a runbook link. Annotations are carried into events, run reports,
+// graph exports and serialized definitions.
+func (w *Workflow) SetAnnotation(key, value string) {
+	w.annotations = setAnnotation(w.annotations, key, value)
+}
+
+// Annotation returns the value of an annotation of the workflow.
+func (w *Workflow) Annotation(key string) (string, bool) {
+	value, ok := w.annotations[key]
+	return value, ok
+}
+
+// Annotations returns a copy of the annotations of the workflow.
+func (w *Workflow) Annotations() map[string]string {
+	return copyAnnotations(w.annotations)
+}
+
+// SetAnnotation attaches a key/value annotation to the stage.
+func (s *Stage) SetAnnotation(key, value string) {
+	s.annotations = setAnnotation(s.annotations, key, value)
+}
+
+// Annotation returns the value of an annotation of the stage.
+func (s *Stage) Annotation(key string) (string, bool) {
+	value, ok := s.annotations[key]
+	return value, ok
+}
+
+// Annotations returns a copy of the annotations of the stage.
+func (s *Stage) Annotations() map[string]string {
+	return copyAnnotations(s.annotations)
+}
+
+// SetAnnotation attaches a key/value annotation to the action.
+func (a *BaseAction) SetAnnotation(key, value string) {
+	a.annotations = setAnnotation(a.annotations, key, value)
+}
+
+// Annotation returns the value of an annotation of the action.
+func (a *BaseAction) Annotation(key string) (string, bool) {
+	value, ok := a.annotations[key]
+	return value, ok
+}
+
+// Annotations returns a copy of the annotations of the action.
+func (a *BaseAction) Annotations() map[string]string {
+	return copyAnnotations(a.annotations)
+}
+
+// ActionAnnotations returns a copy of the annotations of an action, or nil if
+// it does not embed BaseAction.
+func ActionAnnotations(action Action) map[string]string {
+	if base := GetActionBaseFields(action); base != nil {
+		return base.Annotations()
+	}
+	return nil
+}
+
+// FindStagesByAnnotation returns the stages of the workflow, including the
+// stages of if and switch branches, whose annotation key holds value.
+func (w *Workflow) FindStagesByAnnotation(key, value string) []*Stage {
+	var found []*Stage
+	var find func(stages []*Stage)
+	find = func(stages []*Stage) {
+		for _, stage := range stages {
+			if current, ok := stage.annotations[key]; ok && current == value {
+				found = append(found, stage)
+			}
+			for _, branch := range stage.Branches() {
+				find(branch.Stages)
+			}
+		}
+	}
+	find(w.Stages)
+	return found
+}
+
+// setAnnotation sets an annotation, creating the map on first use.
+func setAnnotation(annotations map[string]string, key, value string) map[string]string {
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[key] = value
+	return annotations
+}
+
+// copyAnnotations copies annotations, returning nil when there are none.
+func copyAnnotations(annotations map[string]string) map[string]string {
+	if len(annotations) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(annotations))
+	for key, value := range annotations {
+		out[key] = value
+	}
+	return out
+}
+
+// mergedAnnotations merges the annotations of a workflow, stage and action,
+// the most specific winning. The stage and action may be nil.
+func mergedAnnotations(w *Workflow, stage *Stage, action Action) map[string]string {
+	var merged map[string]string
+	merge := func(annotations map[string]string) {
+		// Ranging over an empty map is not free, and runs for every action
+		if len(annotations) == 0 {
+			return
+		}
+		for key, value := range annotations {
+			merged = setAnnotation(merged, key, value)
+		}
+	}
+	merge(w.annotations)
+	if stage != nil {
+		merge(stage.annotations)
+	}
+	if base := GetActionBaseFields(action); base != nil {
+		merge(base.annotations)
+	}
+	return merged
+}
+
+// annotationLines formats annotations as sorted key=value lines.
+func annotationLines(annotations map[string]string) string {
+	lines := make([]string, 0, len(annotations))
+	for key, value := range annotations {
+		lines = append(lines, fmt.Sprintf("%s=%s", key, value))
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,100 @@
+package gostage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnotations(t *testing.T) {
+	wf := NewWorkflow("billing", "Billing", "")
+	wf.SetAnnotation("owner", "platform")
+	wf.SetAnnotation("tier", "1")
+
+	charge := NewStage("charge", "Charge", "")
+	charge.SetAnnotation("owner", "payments")
+	capture := NewActionFunc("capture", "", func(ctx *ActionContext) error {
+		ctx.Emit(EventActionRetried, nil)
+		return nil
+	})
+	GetActionBaseFields(capture).SetAnnotation("runbook", "https://runbooks.example.com/capture")
+	charge.AddAction(capture)
+	wf.AddStage(charge)
+
+	refund := NewStage("refund", "Refund", "")
+	refund.SetAnnotation("owner", "payments")
+	wf.AddStage(IfStage("audit", "Audit", func(ctx *ActionContext) (bool, error) { return false, nil },
+		[]*Stage{refund}, nil))
+	wf.AddStage(NewStage("report", "Report", ""))
+
+	owner, ok := charge.Annotation("owner")
+	assert.True(t, ok)
+	assert.Equal(t, "payments", owner)
+	_, ok = wf.Stages[2].Annotation("owner")
+	assert.False(t, ok)
+	assert.Equal(t, []*Stage{charge, refund}, wf.FindStagesByAnnotation("owner", "payments"))
+	assert.Empty(t, wf.FindStagesByAnnotation("owner", "platform"))
+
+	// Annotations returns a copy
+	wf.Annotations()["owner"] = "someone else"
+	owner, _ = wf.Annotation("owner")
+	assert.Equal(t, "platform", owner)
+
+	t.Run("events", func(t *testing.T) {
+		events := make(map[string]map[string]string)
+		runner := NewRunner()
+		runner.Events().Subscribe(EventAll, func(event Event) {
+			events[event.Type.String()+" "+event.StageID] = event.Annotations
+		})
+		require.NoError(t, runner.Execute(context.Background(), wf, NewDefaultLogger()))
+
+		assert.Equal(t, map[string]string{"owner": "platform", "tier": "1"}, events["workflow.started "])
+		assert.Equal(t, map[string]string{"owner": "payments", "tier": "1"}, events["stage.completed charge"])
+		assert.Equal(t, map[string]string{"owner": "payments", "tier": "1", "runbook": "https://runbooks.example.com/capture"}, events["action.completed charge"])
+		assert.Equal(t, events["action.completed charge"], events["action.retried charge"])
+		assert.Equal(t, map[string]string{"owner": "payments", "tier": "1"}, events["stage.skipped refund"])
+		assert.Equal(t, map[string]string{"owner": "platform", "tier": "1"}, events["stage.completed report"])
+	})
+
+	t.Run("graph", func(t *testing.T) {
+		dot := wf.ToDOT()
+		assert.Contains(t, dot, `label="Billing\nowner=platform\ntier=1";`)
+		assert.Contains(t, dot, `label="Charge\nowner=payments";`)
+		assert.Contains(t, dot, `[label="capture\nrunbook=https://runbooks.example.com/capture"]`)
+		assert.Contains(t, wf.ToMermaid(), `["Charge<br/>owner=payments"]`)
+	})
+
+	t.Run("clone", func(t *testing.T) {
+		clone := charge.Clone()
+		clone.SetAnnotation("owner", "ledger")
+		GetActionBaseFields(clone.Actions[0]).SetAnnotation("runbook", "")
+		owner, _ := charge.Annotation("owner")
+		assert.Equal(t, "payments", owner)
+		assert.Equal(t, "https://runbooks.example.com/capture", ActionAnnotations(charge.Actions[0])["runbook"])
+	})
+}
+
+func TestAnnotationsRoundTrip(t *testing.T) {
+	registry := newSerializationRegistry(t)
+
+	wf := NewWorkflow("wf", "Workflow", "")
+	wf.SetAnnotation("owner", "team-x")
+	stage := NewStage("fetch", "Fetch", "")
+	stage.SetAnnotation("oncall", "#fetch")
+	noop, err := registry.Resolve("noop", nil)
+	require.NoError(t, err)
+	GetActionBaseFields(noop).SetAnnotation("cost", "low")
+	stage.AddAction(noop)
+	wf.AddStage(stage)
+
+	data, err := wf.Marshal()
+	require.NoError(t, err)
+	restored, err := UnmarshalWorkflow(data, registry)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{"owner": "team-x"}, restored.Annotations())
+	assert.Equal(t, map[string]string{"oncall": "#fetch"}, restored.Stages[0].Annotations())
+	assert.Equal(t, map[string]string{"cost": "low"}, ActionAnnotations(restored.Stages[0].Actions[0]))
+}
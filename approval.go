@@ -0,0 +1,354 @@
+package gostage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidroman0O/gostage/store"
+)
+
+var (
+	// ErrApprovalRejected is returned by an ApprovalAction whose request was rejected.
+	ErrApprovalRejected = errors.New("approval rejected")
+	// ErrApprovalTimeout is returned by an ApprovalAction left undecided past its timeout.
+	ErrApprovalTimeout = errors.New("approval timed out")
+	// ErrNoPendingApproval is returned when deciding on an approval nobody waits for.
+	ErrNoPendingApproval = errors.New("no pending approval")
+)
+
+// ApprovalRequest describes an approval an ApprovalAction waits for.
+type ApprovalRequest struct {
+	// ID identifies the request, as "<workflow ID>/<action name>" unless set with WithApprovalID
+	ID          string    `json:"id"`
+	WorkflowID  string    `json:"workflowId"`
+	StageID     string    `json:"stageId"`
+	ActionName  string    `json:"actionName"`
+	Message     string    `json:"message,omitempty"`
+	RequestedAt time.Time `json:"requestedAt"`
+}
+
+// ApprovalDecision is the answer to an approval request.
+type ApprovalDecision struct {
+	Approved bool      `json:"approved"`
+	Approver string    `json:"approver,omitempty"`
+	Comment  string    `json:"comment,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// ApprovalSource delivers the decisions ApprovalActions wait for.
+type ApprovalSource interface {
+	// Await blocks until request is decided, or returns ctx's error once it is done.
+	Await(ctx context.Context, actionCtx *ActionContext, request ApprovalRequest) (ApprovalDecision, error)
+}
+
+// ApprovalSourceFunc adapts a function to an ApprovalSource.
+type ApprovalSourceFunc func(ctx context.Context, actionCtx *ActionContext, request ApprovalRequest) (ApprovalDecision, error)
+
+// Await calls f.
+func (f ApprovalSourceFunc) Await(ctx context.Context, actionCtx *ActionContext, request ApprovalRequest) (ApprovalDecision, error) {
+	return f(ctx, actionCtx, request)
+}
+
+// ApprovalChannel returns a source taking the next decision received from decisions.
+func ApprovalChannel(decisions <-chan ApprovalDecision) ApprovalSource {
+	return ApprovalSourceFunc(func(ctx context.Context, actionCtx *ActionContext, request ApprovalRequest) (ApprovalDecision, error) {
+		select {
+		case decision := <-decisions:
+			return decision, nil
+		case <-ctx.Done():
+			return ApprovalDecision{}, ctx.Err()
+		}
+	})
+}
+
+// ApprovalStoreKey returns a source watching key in the workflow store, checked
+// every interval. The request is decided once key holds an ApprovalDecision, a
+// bool, or one of the strings "approved" and "rejected".
+func ApprovalStoreKey(key string, interval time.Duration) ApprovalSource {
+	return ApprovalSourceFunc(func(ctx context.Context, actionCtx *ActionContext, request ApprovalRequest) (ApprovalDecision, error) {
+		clock := actionCtx.Clock()
+		for {
+			decision, decided, err := storedDecision(actionCtx.Store(), key)
+			if err != nil || decided {
+				return decision, err
+			}
+			timer := clock.NewTimer(interval)
+			select {
+			case <-timer.C():
+			case <-ctx.Done():
+				timer.Stop()
+				return ApprovalDecision{}, ctx.Err()
+			}
+		}
+	})
+}
+
+// storedDecision reads the decision held by key, if any.
+func storedDecision(s *store.KVStore, key string) (ApprovalDecision, bool, error) {
+	if decision, err := store.Get[ApprovalDecision](s, key); err == nil {
+		return decision, true, nil
+	}
+	if approved, err := store.Get[bool](s, key); err == nil {
+		return ApprovalDecision{Approved: approved, Time: time.Now()}, true, nil
+	}
+	value, err := store.Get[string](s, key)
+	if errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrExpired) {
+		return ApprovalDecision{}, false, nil
+	}
+	if err != nil {
+		return ApprovalDecision{}, false, fmt.Errorf("store key '%s' does not hold an approval decision: %w", key, err)
+	}
+	switch strings.ToLower(value) {
+	case "approved":
+		return ApprovalDecision{Approved: true, Time: time.Now()}, true, nil
+	case "rejected":
+		return ApprovalDecision{Approved: false, Time: time.Now()}, true, nil
+	case "":
+		return ApprovalDecision{}, false, nil
+	}
+	return ApprovalDecision{}, false, fmt.Errorf("store key '%s' holds '%s' instead of 'approved' or 'rejected'", key, value)
+}
+
+// ApprovalGate is an ApprovalSource whose requests are decided by calling
+// Approve, Reject or Decide, such as from the httpapi package's approval
+// endpoints. It is safe for concurrent use.
+type ApprovalGate struct {
+	mu      sync.Mutex
+	pending map[string]*pendingApproval
+}
+
+// pendingApproval is a request waiting on a gate.
+type pendingApproval struct {
+	request ApprovalRequest
+	decided chan ApprovalDecision
+}
+
+// NewApprovalGate creates a gate with no pending requests.
+func NewApprovalGate() *ApprovalGate {
+	return &ApprovalGate{pending: make(map[string]*pendingApproval)}
+}
+
+// Await registers request as pending until it is decided or ctx is done.
+func (g *ApprovalGate) Await(ctx context.Context, actionCtx *ActionContext, request ApprovalRequest) (ApprovalDecision, error) {
+	pending := &pendingApproval{request: request, decided: make(chan ApprovalDecision, 1)}
+
+	g.mu.Lock()
+	if _, exists := g.pending[request.ID]; exists {
+		g.mu.Unlock()
+		return ApprovalDecision{}, fmt.Errorf("approval '%s' is already pending", request.ID)
+	}
+	g.pending[request.ID] = pending
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		if g.pending[request.ID] == pending {
+			delete(g.pending, request.ID)
+		}
+		g.mu.Unlock()
+	}()
+
+	select {
+	case decision := <-pending.decided:
+		return decision, nil
+	case <-ctx.Done():
+		return ApprovalDecision{}, ctx.Err()
+	}
+}
+
+// Pending returns the requests waiting for a decision, oldest first.
+func (g *ApprovalGate) Pending() []ApprovalRequest {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	requests := make([]ApprovalRequest, 0, len(g.pending))
+	for _, pending := range g.pending {
+		requests = append(requests, pending.request)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].RequestedAt.Before(requests[j].RequestedAt)
+	})
+	return requests
+}
+
+// Decide answers the pending request id. It fails with ErrNoPendingApproval if
+// nothing waits for id.
+func (g *ApprovalGate) Decide(id string, decision ApprovalDecision) error {
+	if decision.Time.IsZero() {
+		decision.Time = time.Now()
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	pending, ok := g.pending[id]
+	if !ok {
+		return fmt.Errorf("%w '%s'", ErrNoPendingApproval, id)
+	}
+	delete(g.pending, id)
+	pending.decided <- decision
+	return nil
+}
+
+// Approve approves the pending request id.
+func (g *ApprovalGate) Approve(id, approver, comment string) error {
+	return g.Decide(id, ApprovalDecision{Approved: true, Approver: approver, Comment: comment})
+}
+
+// Reject rejects the pending request id.
+func (g *ApprovalGate) Reject(id, approver, comment string) error {
+	return g.Decide(id, ApprovalDecision{Approved: false, Approver: approver, Comment: comment})
+}
+
+// approvalAction pauses the workflow until a decision is made.
+type approvalAction struct {
+	BaseAction
+	source    ApprovalSource
+	id        string
+	message   string
+	timeout   time.Duration
+	recordKey string
+	onReject  func(ctx *ActionContext, decision ApprovalDecision) error
+	onTimeout func(ctx *ActionContext) error
+}
+
+// ApprovalOption configures an ApprovalAction.
+type ApprovalOption func(*approvalAction)
+
+// WithApprovalID sets the ID of the approval request, which is rendered as a
+// template against the store. It defaults to "<workflow ID>/<action name>".
+func WithApprovalID(id string) ApprovalOption {
+	return func(a *approvalAction) {
+		a.id = id
+	}
+}
+
+// WithApprovalMessage sets the message shown to approvers, rendered as a
+// template against the store.
+func WithApprovalMessage(message string) ApprovalOption {
+	return func(a *approvalAction) {
+		a.message = message
+	}
+}
+
+// WithApprovalTimeout fails the action with ErrApprovalTimeout if no decision
+// is made within timeout, unless OnApprovalTimeout handles it.
+func WithApprovalTimeout(timeout time.Duration) ApprovalOption {
+	return func(a *approvalAction) {
+		a.timeout = timeout
+	}
+}
+
+// RecordApproval stores the decision under key once it is made.
+func RecordApproval(key string) ApprovalOption {
+	return func(a *approvalAction) {
+		a.recordKey = key
+	}
+}
+
+// OnApprovalRejected handles rejections instead of failing the action with
+// ErrApprovalRejected. The handler can, for example, disable the stages that
+// needed the approval and return nil to let the workflow continue.
+func OnApprovalRejected(handler func(ctx *ActionContext, decision ApprovalDecision) error) ApprovalOption {
+	return func(a *approvalAction) {
+		a.onReject = handler
+	}
+}
+
+// OnApprovalTimeout handles timeouts instead of failing the action with ErrApprovalTimeout.
+func OnApprovalTimeout(handler func(ctx *ActionContext) error) ApprovalOption {
+	return func(a *approvalAction) {
+		a.onTimeout = handler
+	}
+}
+
+// ApprovalAction creates an action that pauses the workflow until source
+// delivers a decision, for human-in-the-loop workflows. An approval lets the
+// workflow continue. A rejection fails the action with an error wrapping
+// ErrApprovalRejected, unless OnApprovalRejected handles it.
+func ApprovalAction(name string, source ApprovalSource, opts ...ApprovalOption) Action {
+	a := &approvalAction{
+		BaseAction: NewBaseAction(name, "Waits for approval"),
+		source:     source,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+func (a *approvalAction) Execute(ctx *ActionContext) error {
+	request := ApprovalRequest{
+		ID:          ctx.Workflow.ID + "/" + a.Name(),
+		WorkflowID:  ctx.Workflow.ID,
+		ActionName:  a.Name(),
+		RequestedAt: ctx.Now(),
+	}
+	if ctx.Stage != nil {
+		request.StageID = ctx.Stage.ID
+	}
+	var err error
+	if a.id != "" {
+		if request.ID, err = ctx.Render(a.id); err != nil {
+			return fmt.Errorf("failed to render approval ID: %w", err)
+		}
+	}
+	if request.Message, err = ctx.Render(a.message); err != nil {
+		return fmt.Errorf("failed to render approval message: %w", err)
+	}
+
+	waitCtx := ctx.GoContext
+	if waitCtx == nil {
+		waitCtx = context.Background()
+	}
+	if a.timeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = withClockTimeout(waitCtx, ctx.Clock(), a.timeout)
+		defer cancel()
+	}
+
+	ctx.Logger.Info("Waiting for approval %s", request.ID)
+	decision, err := a.source.Await(waitCtx, ctx, request)
+	if err != nil {
+		// Only the approval's own deadline is a timeout; a cancelled run stays cancelled
+		if a.timeout > 0 && errors.Is(context.Cause(waitCtx), context.DeadlineExceeded) && (ctx.GoContext == nil || ctx.GoContext.Err() == nil) {
+			if a.onTimeout != nil {
+				return a.onTimeout(ctx)
+			}
+			return fmt.Errorf("approval '%s': %w after %s", request.ID, ErrApprovalTimeout, a.timeout)
+		}
+		return fmt.Errorf("failed to wait for approval '%s': %w", request.ID, err)
+	}
+
+	if a.recordKey != "" {
+		if err := ctx.Store().Put(a.recordKey, decision); err != nil {
+			return fmt.Errorf("failed to record approval decision: %w", err)
+		}
+	}
+
+	if decision.Approved {
+		ctx.Logger.Info("Approval %s granted by %s", request.ID, approverName(decision))
+		return nil
+	}
+	ctx.Logger.Warn("Approval %s rejected by %s", request.ID, approverName(decision))
+	if a.onReject != nil {
+		return a.onReject(ctx, decision)
+	}
+	if decision.Comment != "" {
+		return fmt.Errorf("approval '%s' by %s: %w: %s", request.ID, approverName(decision), ErrApprovalRejected, decision.Comment)
+	}
+	return fmt.Errorf("approval '%s' by %s: %w", request.ID, approverName(decision), ErrApprovalRejected)
+}
+
+// approverName returns who made a decision, for messages.
+func approverName(decision ApprovalDecision) string {
+	if decision.Approver == "" {
+		return "an unknown approver"
+	}
+	return decision.Approver
+}
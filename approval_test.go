@@ -0,0 +1,149 @@
+package gostage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newApprovalWorkflow runs approval and then records that the workflow went on.
+func newApprovalWorkflow(approval Action) *Workflow {
+	wf := NewWorkflow("release", "Release", "")
+	stage := NewStage("gate", "Gate", "")
+	stage.AddAction(approval)
+	stage.AddAction(NewTestAction("ship", "", func(ctx *ActionContext) error {
+		return ctx.Store().Put("shipped", true)
+	}))
+	wf.AddStage(stage)
+	return wf
+}
+
+// awaitPending waits until gate has a pending request and returns it.
+func awaitPending(t *testing.T, gate *ApprovalGate) ApprovalRequest {
+	t.Helper()
+	var pending []ApprovalRequest
+	require.Eventually(t, func() bool {
+		pending = gate.Pending()
+		return len(pending) == 1
+	}, 5*time.Second, time.Millisecond)
+	return pending[0]
+}
+
+func TestApprovalGateApprove(t *testing.T) {
+	gate := NewApprovalGate()
+	wf := newApprovalWorkflow(ApprovalAction("sign-off", gate,
+		WithApprovalMessage("Ship {{ .store.version }}?"),
+		RecordApproval("signoff"),
+	))
+
+	results := make(chan RunResult, 1)
+	go func() {
+		options := DefaultRunOptions()
+		options.InitialStore = map[string]interface{}{"version": "1.2.0"}
+		results <- NewRunner().ExecuteWithOptions(wf, options)
+	}()
+
+	request := awaitPending(t, gate)
+	assert.Equal(t, "release/sign-off", request.ID)
+	assert.Equal(t, "gate", request.StageID)
+	assert.Equal(t, "Ship 1.2.0?", request.Message)
+	require.NoError(t, gate.Approve(request.ID, "alice", "looks good"))
+
+	result := <-results
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, true, result.FinalStore["shipped"])
+	decision := result.FinalStore["signoff"].(ApprovalDecision)
+	assert.True(t, decision.Approved)
+	assert.Equal(t, "alice", decision.Approver)
+	assert.Empty(t, gate.Pending())
+
+	assert.ErrorIs(t, gate.Approve(request.ID, "alice", ""), ErrNoPendingApproval)
+}
+
+func TestApprovalRejected(t *testing.T) {
+	gate := NewApprovalGate()
+	results := make(chan RunResult, 1)
+	go func() {
+		results <- NewRunner().ExecuteWithOptions(newApprovalWorkflow(ApprovalAction("sign-off", gate)), DefaultRunOptions())
+	}()
+
+	require.NoError(t, gate.Reject(awaitPending(t, gate).ID, "bob", "not on a Friday"))
+
+	result := <-results
+	assert.ErrorIs(t, result.Error, ErrApprovalRejected)
+	assert.Contains(t, result.Error.Error(), "by bob")
+	assert.Contains(t, result.Error.Error(), "not on a Friday")
+	assert.NotContains(t, result.FinalStore, "shipped")
+}
+
+func TestApprovalRejectionHandler(t *testing.T) {
+	decisions := make(chan ApprovalDecision, 1)
+	decisions <- ApprovalDecision{Approved: false, Approver: "carol"}
+
+	wf := newApprovalWorkflow(ApprovalAction("sign-off", ApprovalChannel(decisions),
+		OnApprovalRejected(func(ctx *ActionContext, decision ApprovalDecision) error {
+			ctx.DisableAction("ship")
+			return ctx.Store().Put("rejectedBy", decision.Approver)
+		}),
+	))
+
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, "carol", result.FinalStore["rejectedBy"])
+	assert.NotContains(t, result.FinalStore, "shipped")
+}
+
+func TestApprovalTimeout(t *testing.T) {
+	gate := NewApprovalGate()
+	result := NewRunner().ExecuteWithOptions(newApprovalWorkflow(ApprovalAction("sign-off", gate,
+		WithApprovalTimeout(20*time.Millisecond),
+	)), DefaultRunOptions())
+	assert.ErrorIs(t, result.Error, ErrApprovalTimeout)
+	assert.Empty(t, gate.Pending())
+
+	result = NewRunner().ExecuteWithOptions(newApprovalWorkflow(ApprovalAction("sign-off", gate,
+		WithApprovalTimeout(20*time.Millisecond),
+		OnApprovalTimeout(func(ctx *ActionContext) error {
+			return ctx.Store().Put("autoApproved", true)
+		}),
+	)), DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, true, result.FinalStore["autoApproved"])
+	assert.Equal(t, true, result.FinalStore["shipped"])
+}
+
+func TestApprovalCancelledRunIsNotATimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	options := DefaultRunOptions()
+	options.Context = ctx
+	result := NewRunner().ExecuteWithOptions(newApprovalWorkflow(ApprovalAction("sign-off", NewApprovalGate(),
+		WithApprovalTimeout(time.Minute),
+	)), options)
+	assert.ErrorIs(t, result.Error, context.DeadlineExceeded)
+	assert.NotErrorIs(t, result.Error, ErrApprovalTimeout)
+}
+
+func TestApprovalStoreKey(t *testing.T) {
+	for value, approved := range map[interface{}]bool{"approved": true, "REJECTED": false, true: true} {
+		wf := newApprovalWorkflow(ApprovalAction("sign-off", ApprovalStoreKey("approval", 5*time.Millisecond)))
+		time.AfterFunc(20*time.Millisecond, func() { wf.Store.Put("approval", value) })
+
+		result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+		if approved {
+			require.True(t, result.Success, "%v: %v", value, result.Error)
+		} else {
+			assert.ErrorIs(t, result.Error, ErrApprovalRejected, "%v", value)
+		}
+	}
+
+	wf := newApprovalWorkflow(ApprovalAction("sign-off", ApprovalStoreKey("approval", 5*time.Millisecond)))
+	wf.Store.Put("approval", "maybe")
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.Error(t, result.Error)
+	assert.Contains(t, result.Error.Error(), "instead of 'approved' or 'rejected'")
+}
@@ -0,0 +1,319 @@
+package gostage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ArtifactBackend stores the content of the artifacts attached by actions,
+// such as in a directory or a bucket.
+type ArtifactBackend interface {
+	// Upload stores content, the content of artifact attached during run
+	// runID, and returns the URI of the stored content
+	Upload(ctx context.Context, runID string, artifact Artifact, content io.Reader) (uri string, err error)
+}
+
+// DirArtifactBackend stores artifacts as files under a directory, in a
+// sub-directory per run.
+type DirArtifactBackend struct {
+	dir string
+}
+
+// NewDirArtifactBackend creates a backend storing artifacts under dir,
+// creating it if needed.
+func NewDirArtifactBackend(dir string) (*DirArtifactBackend, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create artifact directory: %w", err)
+	}
+	return &DirArtifactBackend{dir: dir}, nil
+}
+
+// Upload writes content to <dir>/<runID>/<name> and returns its file URI.
+func (b *DirArtifactBackend) Upload(ctx context.Context, runID string, artifact Artifact, content io.Reader) (string, error) {
+	if runID == "" {
+		runID = "unknown-run"
+	}
+	path, err := writeArtifactFile(filepath.Join(b.dir, runID), artifact.Name, content)
+	if err != nil {
+		return "", err
+	}
+	return fileURI(path)
+}
+
+// fileURI returns the file URI of path.
+func fileURI(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String(), nil
+}
+
+// writeArtifactFile writes content to the file name of dir and returns its path.
+func writeArtifactFile(dir, name string, content io.Reader) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create artifact directory: %w", err)
+	}
+	path := filepath.Join(dir, name)
+	file, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create artifact file: %w", err)
+	}
+	if _, err := io.Copy(file, content); err != nil {
+		file.Close()
+		return "", fmt.Errorf("failed to write artifact file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to write artifact file: %w", err)
+	}
+	return path, nil
+}
+
+// WithArtifactBackend stores the artifacts attached by actions with backend.
+// Without a backend, attached files stay where they are and attached
+// content is written to a temporary directory.
+func WithArtifactBackend(backend ArtifactBackend) RunnerOption {
+	return func(r *Runner) {
+		r.artifacts = backend
+	}
+}
+
+// contextRunArtifacts collects the artifacts of the run in progress, set by ExecuteWithOptions
+const contextRunArtifacts = "runArtifacts"
+
+// artifactLog collects the artifacts of a run.
+type artifactLog struct {
+	mu        sync.Mutex
+	artifacts []Artifact
+	// dir holds the content attached without a backend, created when needed
+	dir string
+}
+
+// startArtifactLog starts collecting the artifacts of a run.
+func startArtifactLog(w *Workflow) {
+	w.Context[contextRunArtifacts] = &artifactLog{}
+}
+
+// finishArtifactLog returns the artifacts of the run and stops collecting them.
+func finishArtifactLog(w *Workflow) []Artifact {
+	log, ok := w.Context[contextRunArtifacts].(*artifactLog)
+	delete(w.Context, contextRunArtifacts)
+	if !ok {
+		return nil
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	return log.artifacts
+}
+
+// add records artifact, failing if the run already has one of the same name.
+func (l *artifactLog) add(artifact Artifact) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, existing := range l.artifacts {
+		if existing.Name == artifact.Name {
+			return fmt.Errorf("artifact '%s' is already attached by action '%s'", artifact.Name, existing.Action)
+		}
+	}
+	l.artifacts = append(l.artifacts, artifact)
+	return nil
+}
+
+// contains reports whether the run has an artifact called name.
+func (l *artifactLog) contains(name string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, existing := range l.artifacts {
+		if existing.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// tempDir returns the directory of the content attached without a backend.
+func (l *artifactLog) tempDir() (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.dir == "" {
+		dir, err := os.MkdirTemp("", "gostage-artifacts-")
+		if err != nil {
+			return "", fmt.Errorf("failed to create artifact directory: %w", err)
+		}
+		l.dir = dir
+	}
+	return l.dir, nil
+}
+
+// AttachArtifact attaches content as an artifact of the run, collected in
+// RunResult.Artifacts. The content is stored by the artifact backend of the
+// runner or, without one, written to a temporary directory. Names must be
+// file names, unique within the run. An empty media type is guessed from the
+// extension of the name.
+func (ctx *ActionContext) AttachArtifact(name string, content io.Reader, mediaType string) (Artifact, error) {
+	artifact, err := ctx.newArtifact(name, mediaType)
+	if err != nil {
+		return Artifact{}, err
+	}
+	counted := &countingReader{Reader: content}
+	if r := ctx.runner(); r != nil && r.artifacts != nil {
+		artifact.URI, err = r.artifacts.Upload(actionGoContext(ctx), ctx.RunID(), artifact, counted)
+		if err != nil {
+			return Artifact{}, fmt.Errorf("failed to upload artifact '%s': %w", name, err)
+		}
+	} else {
+		dir, err := ctx.artifactDir()
+		if err != nil {
+			return Artifact{}, err
+		}
+		path, err := writeArtifactFile(dir, name, counted)
+		if err != nil {
+			return Artifact{}, err
+		}
+		if artifact.URI, err = fileURI(path); err != nil {
+			return Artifact{}, err
+		}
+	}
+	artifact.Size = counted.n
+	return artifact, ctx.recordArtifact(artifact)
+}
+
+// AttachArtifactFile attaches the file at path as an artifact of the run, as
+// AttachArtifact does. Without an artifact backend, the file is not copied:
+// the artifact refers to it, so it must outlive the run.
+func (ctx *ActionContext) AttachArtifactFile(name, path, mediaType string) (Artifact, error) {
+	if r := ctx.runner(); r != nil && r.artifacts != nil {
+		file, err := os.Open(path)
+		if err != nil {
+			return Artifact{}, fmt.Errorf("failed to open artifact '%s': %w", name, err)
+		}
+		defer file.Close()
+		return ctx.AttachArtifact(name, file, mediaType)
+	}
+
+	artifact, err := ctx.newArtifact(name, mediaType)
+	if err != nil {
+		return Artifact{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return Artifact{}, fmt.Errorf("failed to open artifact '%s': %w", name, err)
+	}
+	if info.IsDir() {
+		return Artifact{}, fmt.Errorf("artifact '%s' is a directory: %s", name, path)
+	}
+	if artifact.URI, err = fileURI(path); err != nil {
+		return Artifact{}, err
+	}
+	artifact.Size = info.Size()
+	return artifact, ctx.recordArtifact(artifact)
+}
+
+// newArtifact validates the name of an artifact and describes it.
+func (ctx *ActionContext) newArtifact(name, mediaType string) (Artifact, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return Artifact{}, fmt.Errorf("invalid artifact name '%s': artifact names must be file names", name)
+	}
+	if log, ok := ctx.Workflow.Context[contextRunArtifacts].(*artifactLog); ok && log.contains(name) {
+		return Artifact{}, fmt.Errorf("artifact '%s' is already attached", name)
+	}
+	if mediaType == "" {
+		mediaType = mime.TypeByExtension(filepath.Ext(name))
+	}
+	if mediaType == "" {
+		mediaType = "application/octet-stream"
+	}
+
+	artifact := Artifact{Name: name, MediaType: mediaType}
+	if ctx.Stage != nil {
+		artifact.StageID = ctx.Stage.ID
+	}
+	if ctx.Action != nil {
+		artifact.Action = ctx.Action.Name()
+	}
+	return artifact, nil
+}
+
+// artifactDir returns the directory of the content attached without a backend.
+func (ctx *ActionContext) artifactDir() (string, error) {
+	if log, ok := ctx.Workflow.Context[contextRunArtifacts].(*artifactLog); ok {
+		return log.tempDir()
+	}
+	dir, err := os.MkdirTemp("", "gostage-artifacts-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create artifact directory: %w", err)
+	}
+	return dir, nil
+}
+
+// recordArtifact adds artifact to the artifacts of the run and publishes an
+// EventArtifactAttached event.
+func (ctx *ActionContext) recordArtifact(artifact Artifact) error {
+	if log, ok := ctx.Workflow.Context[contextRunArtifacts].(*artifactLog); ok {
+		if err := log.add(artifact); err != nil {
+			return err
+		}
+	}
+	ctx.Logger.Debug("Attached artifact %s (%s, %d bytes) at %s", artifact.Name, artifact.MediaType, artifact.Size, artifact.URI)
+	ctx.Emit(EventArtifactAttached, artifactPayload(artifact))
+	return nil
+}
+
+// runner returns the runner executing the action, or nil.
+func (ctx *ActionContext) runner() *Runner {
+	if ctx.Workflow == nil {
+		return nil
+	}
+	r, _ := ctx.Workflow.Context["runner"].(*Runner)
+	return r
+}
+
+// artifactPayload describes artifact in the payload of its event.
+func artifactPayload(artifact Artifact) map[string]interface{} {
+	return map[string]interface{}{
+		"name":      artifact.Name,
+		"mediaType": artifact.MediaType,
+		"size":      artifact.Size,
+		"uri":       artifact.URI,
+	}
+}
+
+// forwardChildArtifact records the artifact of an EventArtifactAttached
+// event sent by a child process running a stage of w.
+func forwardChildArtifact(w *Workflow, stageID, action string, payload map[string]interface{}) {
+	log, ok := w.Context[contextRunArtifacts].(*artifactLog)
+	if !ok {
+		return
+	}
+	artifact := Artifact{StageID: stageID, Action: action}
+	artifact.Name, _ = payload["name"].(string)
+	artifact.MediaType, _ = payload["mediaType"].(string)
+	artifact.URI, _ = payload["uri"].(string)
+	// Payloads decoded from JSON hold numbers as float64
+	switch size := payload["size"].(type) {
+	case int64:
+		artifact.Size = size
+	case float64:
+		artifact.Size = int64(size)
+	}
+	log.add(artifact)
+}
+
+// countingReader counts the bytes read from a reader.
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,140 @@
+package gostage
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// artifactPath returns the path of a file URI.
+func artifactPath(t *testing.T, uri string) string {
+	t.Helper()
+	parsed, err := url.Parse(uri)
+	require.NoError(t, err)
+	require.Equal(t, "file", parsed.Scheme)
+	return filepath.FromSlash(parsed.Path)
+}
+
+// newArtifactWorkflow creates a workflow whose action attaches a report from
+// a reader and the file at path.
+func newArtifactWorkflow(path string) *Workflow {
+	wf := NewWorkflow("build", "Build", "")
+	stage := NewStage("package", "Package", "")
+	stage.AddAction(NewActionFunc("attach", "", func(ctx *ActionContext) error {
+		if _, err := ctx.AttachArtifact("report.html", strings.NewReader("<h1>ok</h1>"), ""); err != nil {
+			return err
+		}
+		_, err := ctx.AttachArtifactFile("app", path, "application/x-executable")
+		return err
+	}))
+	wf.AddStage(stage)
+	return wf
+}
+
+func TestAttachArtifact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app")
+	require.NoError(t, os.WriteFile(path, []byte("binary"), 0o644))
+
+	runner := NewRunner()
+	var attached []string
+	runner.Subscribe(EventArtifactAttached, func(event Event) {
+		attached = append(attached, event.Payload["name"].(string))
+	})
+
+	result := runner.ExecuteWithOptions(newArtifactWorkflow(path), DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	require.Len(t, result.Artifacts, 2)
+	assert.Equal(t, []string{"report.html", "app"}, attached)
+
+	report := result.Artifacts[0]
+	assert.Equal(t, "report.html", report.Name)
+	assert.Equal(t, "text/html; charset=utf-8", report.MediaType)
+	assert.Equal(t, int64(11), report.Size)
+	assert.Equal(t, "package", report.StageID)
+	assert.Equal(t, "attach", report.Action)
+	content, err := os.ReadFile(artifactPath(t, report.URI))
+	require.NoError(t, err)
+	assert.Equal(t, "<h1>ok</h1>", string(content))
+	os.RemoveAll(filepath.Dir(artifactPath(t, report.URI)))
+
+	// Without a backend, files are referred to where they are
+	app := result.Artifacts[1]
+	assert.Equal(t, "application/x-executable", app.MediaType)
+	assert.Equal(t, int64(6), app.Size)
+	assert.Equal(t, path, artifactPath(t, app.URI))
+}
+
+func TestAttachArtifactBackend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app")
+	require.NoError(t, os.WriteFile(path, []byte("binary"), 0o644))
+	dir := t.TempDir()
+	backend, err := NewDirArtifactBackend(dir)
+	require.NoError(t, err)
+
+	result := NewRunner(WithArtifactBackend(backend)).ExecuteWithOptions(newArtifactWorkflow(path), DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	require.Len(t, result.Artifacts, 2)
+	for _, artifact := range result.Artifacts {
+		assert.Equal(t, filepath.Join(dir, result.RunID, artifact.Name), artifactPath(t, artifact.URI))
+	}
+	content, err := os.ReadFile(filepath.Join(dir, result.RunID, "app"))
+	require.NoError(t, err)
+	assert.Equal(t, "binary", string(content))
+	assert.Equal(t, int64(6), result.Artifacts[1].Size)
+}
+
+func TestAttachArtifactErrors(t *testing.T) {
+	var errs []error
+	wf := NewWorkflow("build", "Build", "")
+	stage := NewStage("package", "Package", "")
+	stage.AddAction(NewActionFunc("attach", "", func(ctx *ActionContext) error {
+		_, err := ctx.AttachArtifact("../escape", strings.NewReader(""), "")
+		errs = append(errs, err)
+		_, err = ctx.AttachArtifact("notes", strings.NewReader("first"), "")
+		errs = append(errs, err)
+		_, err = ctx.AttachArtifact("notes", strings.NewReader("second"), "")
+		errs = append(errs, err)
+		_, err = ctx.AttachArtifactFile("missing", filepath.Join(t.TempDir(), "missing"), "")
+		errs = append(errs, err)
+		return nil
+	}))
+	wf.AddStage(stage)
+
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	require.Len(t, errs, 4)
+	assert.EqualError(t, errs[0], "invalid artifact name '../escape': artifact names must be file names")
+	assert.NoError(t, errs[1])
+	assert.EqualError(t, errs[2], "artifact 'notes' is already attached")
+	assert.ErrorIs(t, errs[3], os.ErrNotExist)
+	require.Len(t, result.Artifacts, 1)
+	assert.Equal(t, "application/octet-stream", result.Artifacts[0].MediaType)
+	os.RemoveAll(filepath.Dir(artifactPath(t, result.Artifacts[0].URI)))
+}
+
+func TestForwardChildArtifact(t *testing.T) {
+	wf := NewWorkflow("build", "Build", "")
+	stage := NewStage("package", "Package", "")
+	wf.AddStage(stage)
+	startArtifactLog(wf)
+
+	// Payloads of child processes are decoded from JSON
+	NewRunner().forwardChildEvent(wf, stage, childEvent{
+		Type:       EventArtifactAttached,
+		ActionName: "attach",
+		Payload:    map[string]interface{}{"name": "app", "mediaType": "application/octet-stream", "size": float64(6), "uri": "file:///tmp/app"},
+	})
+	assert.Equal(t, []Artifact{{
+		Name:      "app",
+		URI:       "file:///tmp/app",
+		MediaType: "application/octet-stream",
+		Size:      6,
+		StageID:   "package",
+		Action:    "attach",
+	}}, finishArtifactLog(wf))
+}
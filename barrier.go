@@ -0,0 +1,144 @@
+package gostage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// MergeFunc merges the outputs of the upstream stages of a barrier stage.
+// outputs maps the ID of every upstream stage to its namespaced outputs: the
+// store keys starting with the stage ID and a dot, such as "build.image", with
+// that prefix removed.
+type MergeFunc func(ctx *ActionContext, outputs map[string]map[string]interface{}) error
+
+// NewBarrierStage creates a stage joining the upstream stages. With
+// StrategyParallel the barrier starts once every upstream stage finished,
+// while the stages it does not wait for keep running, and stages can wait
+// for the barrier in turn. It then calls merge, if not nil, with the
+// namespaced outputs of the upstream stages. With StrategySequential the
+// upstream stages must come before the barrier. The pipeline strategy does
+// not support barriers.
+func NewBarrierStage(id, name string, upstream []string, merge MergeFunc) *Stage {
+	stage := NewStage(id, name, "Waits for "+strings.Join(upstream, ", "))
+	stage.DependsOn(upstream...)
+	stage.barrier = true
+	stage.AddAction(&mergeAction{
+		BaseAction: NewBaseAction("merge", "Merges the outputs of the upstream stages"),
+		merge:      merge,
+	})
+	return stage
+}
+
+// mergeAction passes the namespaced outputs of the upstream stages of its
+// barrier stage to a merge function.
+type mergeAction struct {
+	BaseAction
+	merge MergeFunc
+}
+
+func (a *mergeAction) Execute(ctx *ActionContext) error {
+	upstream := ctx.Stage.Dependencies()
+	if ctx.Workflow.strategy == StrategySequential {
+		if err := checkUpstreamRan(ctx.Workflow, ctx.Stage); err != nil {
+			return err
+		}
+	}
+
+	outputs := make(map[string]map[string]interface{}, len(upstream))
+	for _, id := range upstream {
+		prefix := id + "."
+		values := make(map[string]interface{})
+		ctx.Store().Range(prefix, func(key string, value any) bool {
+			values[strings.TrimPrefix(key, prefix)] = value
+			return true
+		})
+		outputs[id] = values
+	}
+	ctx.Logger.Debug("Merging the outputs of %d upstream stages", len(upstream))
+	if a.merge == nil {
+		return nil
+	}
+	return a.merge(ctx, outputs)
+}
+
+// checkUpstreamRan returns an error unless every upstream stage of the
+// barrier comes before it in w, as stages run in order with StrategySequential.
+func checkUpstreamRan(w *Workflow, barrier *Stage) error {
+	position := make(map[string]int, len(w.Stages))
+	for i, stage := range w.Stages {
+		position[stage.ID] = i
+	}
+	for _, id := range barrier.dependencies {
+		at, ok := position[id]
+		if !ok {
+			return fmt.Errorf("barrier stage '%s' waits for stage '%s', which is not part of the workflow", barrier.ID, id)
+		}
+		if at >= position[barrier.ID] {
+			return fmt.Errorf("barrier stage '%s' waits for stage '%s', which does not run before it", barrier.ID, id)
+		}
+	}
+	return nil
+}
+
+// checkBarriers returns an error if a barrier stage among stages waits for a
+// stage that is not among them, or for itself through other barriers, as it
+// would then wait forever.
+func checkBarriers(stages []*Stage) error {
+	byID := make(map[string]*Stage, len(stages))
+	for _, stage := range stages {
+		byID[stage.ID] = stage
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(stages))
+	var visit func(stage *Stage) error
+	visit = func(stage *Stage) error {
+		switch state[stage.ID] {
+		case visiting:
+			return fmt.Errorf("barrier stage '%s' waits for itself", stage.ID)
+		case visited:
+			return nil
+		}
+		state[stage.ID] = visiting
+		if stage.barrier {
+			for _, id := range stage.dependencies {
+				upstream, ok := byID[id]
+				if !ok {
+					return fmt.Errorf("barrier stage '%s' waits for stage '%s', which is not part of the workflow", stage.ID, id)
+				}
+				if err := visit(upstream); err != nil {
+					return err
+				}
+			}
+		}
+		state[stage.ID] = visited
+		return nil
+	}
+
+	for _, stage := range stages {
+		if err := visit(stage); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitForUpstream blocks a barrier stage until the stages it waits for have
+// finished, as reported by closing their channel in done.
+func waitForUpstream(ctx context.Context, stage *Stage, done map[string]chan struct{}) error {
+	if !stage.barrier {
+		return nil
+	}
+	for _, id := range stage.dependencies {
+		select {
+		case <-done[id]:
+		case <-ctx.Done():
+			return fmt.Errorf("barrier stage '%s' stopped waiting for stage '%s': %w", stage.ID, id, context.Cause(ctx))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package gostage
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBarrierStage(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, event)
+	}
+	stage := func(id string, fn func(*ActionContext) error) *Stage {
+		stage := NewStage(id, id, "")
+		stage.AddAction(NewActionFunc(id, "", fn))
+		return stage
+	}
+
+	wf := NewWorkflow("barrier", "Barrier", "")
+	wf.SetExecutionStrategy(StrategyParallel)
+	joined := make(chan struct{})
+	// The barrier does not wait for this stage, which waits for the barrier
+	wf.AddStage(stage("report", func(ctx *ActionContext) error {
+		select {
+		case <-joined:
+		case <-time.After(5 * time.Second):
+		}
+		record("report")
+		return nil
+	}))
+	wf.AddStage(NewBarrierStage("join", "Join", []string{"build", "lint"}, func(ctx *ActionContext, outputs map[string]map[string]interface{}) error {
+		record("join")
+		defer close(joined)
+		assert.Equal(t, map[string]map[string]interface{}{
+			"build": {"image": "api:1.2.0", "digest": "sha256:abc"},
+			"lint":  {"warnings": 2},
+		}, outputs)
+		return ctx.Store().Put("release", outputs["build"]["image"])
+	}))
+	wf.AddStage(stage("build", func(ctx *ActionContext) error {
+		time.Sleep(50 * time.Millisecond)
+		record("build")
+		ctx.Store().Put("build.digest", "sha256:abc")
+		return ctx.Store().Put("build.image", "api:1.2.0")
+	}))
+	wf.AddStage(stage("lint", func(ctx *ActionContext) error {
+		record("lint")
+		return ctx.Store().Put("lint.warnings", 2)
+	}))
+	// Another barrier waits for the first one
+	wf.AddStage(NewBarrierStage("publish", "Publish", []string{"join"}, func(ctx *ActionContext, outputs map[string]map[string]interface{}) error {
+		record("publish")
+		return nil
+	}))
+
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, "api:1.2.0", result.FinalStore["release"])
+	assert.Equal(t, []string{"lint", "build", "join"}, order[:3])
+	assert.ElementsMatch(t, []string{"report", "publish"}, order[3:])
+	for _, id := range []string{"report", "join", "build", "lint", "publish"} {
+		assert.Equal(t, StatusCompleted, result.StageStatuses[id])
+	}
+}
+
+func TestBarrierStageSequential(t *testing.T) {
+	build := NewStage("build", "Build", "")
+	build.AddAction(NewActionFunc("build", "", func(ctx *ActionContext) error {
+		return ctx.Store().Put("build.image", "api:1.2.0")
+	}))
+	merge := func(ctx *ActionContext, outputs map[string]map[string]interface{}) error {
+		return ctx.Store().Put("merged", outputs)
+	}
+
+	wf := NewWorkflow("sequential", "Sequential", "")
+	wf.AddStage(build)
+	wf.AddStage(NewBarrierStage("join", "Join", []string{"build"}, merge))
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, map[string]map[string]interface{}{"build": {"image": "api:1.2.0"}}, result.FinalStore["merged"])
+
+	wf = NewWorkflow("sequential", "Sequential", "")
+	wf.AddStage(NewBarrierStage("join", "Join", []string{"build"}, merge))
+	wf.AddStage(build.Clone())
+	result = NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	assert.ErrorContains(t, result.Error, "barrier stage 'join' waits for stage 'build', which does not run before it")
+}
+
+func TestBarrierStageErrors(t *testing.T) {
+	run := func(strategy ExecutionStrategy, stages ...*Stage) error {
+		wf := NewWorkflow("barrier", "Barrier", "")
+		wf.SetExecutionStrategy(strategy)
+		for _, stage := range stages {
+			wf.AddStage(stage)
+		}
+		return NewRunner().ExecuteWithOptions(wf, DefaultRunOptions()).Error
+	}
+
+	err := run(StrategyParallel, NewBarrierStage("join", "Join", []string{"missing"}, nil))
+	assert.ErrorContains(t, err, "barrier stage 'join' waits for stage 'missing', which is not part of the workflow")
+
+	err = run(StrategyParallel,
+		NewBarrierStage("a", "A", []string{"b"}, nil),
+		NewBarrierStage("b", "B", []string{"a"}, nil))
+	assert.ErrorContains(t, err, "waits for itself")
+
+	err = run(StrategyPipeline, NewStage("build", "Build", ""), NewBarrierStage("join", "Join", []string{"build"}, nil))
+	assert.ErrorContains(t, err, "barrier stage 'join' cannot run with the pipeline strategy")
+
+	// A failed upstream stage stops the barrier before it merges
+	failing := NewStage("build", "Build", "")
+	failing.AddAction(NewActionFunc("build", "", func(ctx *ActionContext) error {
+		return assert.AnError
+	}))
+	merged := false
+	err = run(StrategyParallel, failing, NewBarrierStage("join", "Join", []string{"build"}, func(ctx *ActionContext, outputs map[string]map[string]interface{}) error {
+		merged = true
+		return nil
+	}))
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.False(t, merged)
+}
@@ -0,0 +1,218 @@
+package gostage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"sync"
+
+	"github.com/davidroman0O/gostage/store"
+)
+
+// BatchFunc processes one batch of items. ctx is cancelled when another batch
+// fails, unless errors are collected.
+type BatchFunc[T any] func(ctx *ActionContext, batch []T) error
+
+// BatchFailure describes a batch that failed.
+type BatchFailure struct {
+	// Batch is the index of the batch
+	Batch int `json:"batch"`
+	// Start and End delimit the items of the batch, End being excluded
+	Start int `json:"start"`
+	End   int `json:"end"`
+	// Error is the message of the error the batch failed with
+	Error string `json:"error"`
+}
+
+// BatchReport is what a BatchAction stores once its batches ran, so that
+// later actions can tell which items were processed.
+type BatchReport struct {
+	// Items is the number of items read
+	Items int `json:"items"`
+	// Batches is the number of batches started
+	Batches int `json:"batches"`
+	// Processed is the number of items of the batches that succeeded
+	Processed int `json:"processed"`
+	// Failures lists the batches that failed, in batch order
+	Failures []BatchFailure `json:"failures,omitempty"`
+}
+
+// BatchError is returned by a BatchAction whose batches failed. It wraps the
+// errors of the failed batches.
+type BatchError struct {
+	Report BatchReport
+	errs   []error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d of %d batches failed: %v", len(e.Report.Failures), e.Report.Batches, errors.Join(e.errs...))
+}
+
+// Unwrap returns the errors of the failed batches.
+func (e *BatchError) Unwrap() []error {
+	return e.errs
+}
+
+// BatchAction splits the items read from the workflow store into batches and
+// calls a function per batch, as bulk APIs usually take many items per call.
+//
+// The items are either a []T, converted as ForEachAction does, or a stream
+// put with store.PutStream, whose items are batched as they are received. A
+// BatchReport is stored once the batches ran, even if some failed, so that
+// the failed items can be retried. Batches run one after the other unless
+// WithParallelism is set. The first failing batch cancels the others unless
+// CollectErrors is set. Dynamic actions and stages added by the function are
+// dropped.
+type BatchAction[T any] struct {
+	BaseAction
+	itemsKey string
+	size     int
+	process  BatchFunc[T]
+	options  forEachOptions
+}
+
+// NewBatchAction creates an action calling process for every batch of up to
+// size items read from itemsKey. Sizes below 1 are treated as 1. The report
+// is stored under the name of the action followed by ".report" unless
+// WithResultsKey sets another key.
+func NewBatchAction[T any](name, itemsKey string, size int, process BatchFunc[T], opts ...ForEachOption) *BatchAction[T] {
+	a := &BatchAction[T]{
+		BaseAction: NewBaseAction(name, fmt.Sprintf("Processes the items of '%s' in batches of %d", itemsKey, size)),
+		itemsKey:   itemsKey,
+		size:       max(size, 1),
+		process:    process,
+		options:    forEachOptions{parallelism: 1, resultsKey: name + ".report"},
+	}
+	for _, opt := range opts {
+		opt(&a.options)
+	}
+	if a.options.parallelism < 1 {
+		a.options.parallelism = 1
+	}
+	return a
+}
+
+// Clone returns a copy of the action.
+func (a *BatchAction[T]) Clone() Action {
+	clone := *a
+	clone.BaseAction.cloneState()
+	return &clone
+}
+
+func (a *BatchAction[T]) Execute(ctx *ActionContext) error {
+	parent := ctx.GoContext
+	if parent == nil {
+		parent = context.Background()
+	}
+	runCtx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	batches, err := a.batches(ctx, runCtx)
+	if err != nil {
+		return err
+	}
+	ctx.Logger.Debug("Processing the items of '%s' in batches of %d with parallelism %d", a.itemsKey, a.size, a.options.parallelism)
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		report   BatchReport
+		errs     = make(map[int]error)
+		failures = make(map[int]BatchFailure)
+	)
+	sem := make(chan struct{}, a.options.parallelism)
+	index := 0
+	for batch := range batches {
+		select {
+		case sem <- struct{}{}:
+		case <-runCtx.Done():
+		}
+		if runCtx.Err() != nil {
+			break
+		}
+
+		failure := BatchFailure{Batch: index, Start: report.Items, End: report.Items + len(batch)}
+		report.Items += len(batch)
+		report.Batches++
+		index++
+
+		wg.Add(1)
+		go func(batch []T, failure BatchFailure) {
+			defer func() { <-sem; wg.Done() }()
+			batchCtx := ctx.attemptContext(runCtx)
+			batchCtx.Logger = LoggerWith(ctx.Logger, "batch", failure.Batch)
+			err := a.process(batchCtx, batch)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				report.Processed += len(batch)
+				return
+			}
+			err = fmt.Errorf("batch %d failed: %w", failure.Batch, err)
+			failure.Error = err.Error()
+			failures[failure.Batch] = failure
+			errs[failure.Batch] = err
+			// Batches cancelled as a result are reported too, as their items were not processed
+			if !a.options.collectErrors {
+				cancel()
+			}
+		}(batch, failure)
+	}
+	wg.Wait()
+
+	batchErr := &BatchError{}
+	for i := 0; i < report.Batches; i++ {
+		if failure, ok := failures[i]; ok {
+			report.Failures = append(report.Failures, failure)
+			batchErr.errs = append(batchErr.errs, errs[i])
+		}
+	}
+	batchErr.Report = report
+	if err := ctx.Store().Put(a.options.resultsKey, report); err != nil {
+		return fmt.Errorf("failed to store the batch report: %w", err)
+	}
+
+	if len(batchErr.errs) > 0 {
+		return batchErr
+	}
+	// Items left unprocessed because the run was cancelled
+	return parent.Err()
+}
+
+// batches returns the batches of the items under the items key, reading a
+// stream until runCtx is done.
+func (a *BatchAction[T]) batches(ctx *ActionContext, runCtx context.Context) (iter.Seq[[]T], error) {
+	if _, receive, err := store.GetStream[T](ctx.Store(), a.itemsKey); err == nil {
+		return func(yield func([]T) bool) {
+			// Release the sender if the batches stop before the stream ends
+			defer receive.Close()
+			batch := make([]T, 0, a.size)
+			for item := range receive.Items(runCtx) {
+				batch = append(batch, item)
+				if len(batch) == a.size {
+					if !yield(batch) {
+						return
+					}
+					batch = make([]T, 0, a.size)
+				}
+			}
+			if len(batch) > 0 && runCtx.Err() == nil {
+				yield(batch)
+			}
+		}, nil
+	}
+
+	items, err := readItems[T](ctx.Store(), a.itemsKey)
+	if err != nil {
+		return nil, err
+	}
+	return func(yield func([]T) bool) {
+		for start := 0; start < len(items); start += a.size {
+			if !yield(items[start:min(start+a.size, len(items))]) {
+				return
+			}
+		}
+	}, nil
+}
@@ -0,0 +1,111 @@
+package gostage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/davidroman0O/gostage/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchAction(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]int
+	var running, peak atomic.Int32
+	process := func(ctx *ActionContext, batch []int) error {
+		defer running.Add(-1)
+		if n := running.Add(1); n > peak.Load() {
+			peak.Store(n)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		batches = append(batches, batch)
+		return nil
+	}
+
+	action := NewBatchAction("upload", "ids", 3, process, WithParallelism(2))
+	result := runSingleAction(t, context.Background(), action, func(w *Workflow) {
+		w.Store.Put("ids", []interface{}{1, 2, 3, 4, 5, 6, 7})
+	})
+	require.True(t, result.Success, "%v", result.Error)
+	assert.ElementsMatch(t, [][]int{{1, 2, 3}, {4, 5, 6}, {7}}, batches)
+	assert.LessOrEqual(t, peak.Load(), int32(2))
+	assert.Equal(t, BatchReport{Items: 7, Batches: 3, Processed: 7}, result.FinalStore["upload.report"])
+}
+
+func TestBatchActionFailures(t *testing.T) {
+	process := func(ctx *ActionContext, batch []string) error {
+		if batch[0] == "c" {
+			return errors.New("rate limited")
+		}
+		return nil
+	}
+	items := []string{"a", "b", "c", "d", "e"}
+
+	// Every batch runs when errors are collected
+	action := NewBatchAction("bulk", "items", 2, process, CollectErrors(), WithResultsKey("bulk.status"))
+	result := runSingleAction(t, context.Background(), action, func(w *Workflow) {
+		w.Store.Put("items", items)
+	})
+	require.Error(t, result.Error)
+	var batchErr *BatchError
+	require.ErrorAs(t, result.Error, &batchErr)
+	expected := BatchReport{
+		Items:     5,
+		Batches:   3,
+		Processed: 3,
+		Failures:  []BatchFailure{{Batch: 1, Start: 2, End: 4, Error: "batch 1 failed: rate limited"}},
+	}
+	assert.Equal(t, expected, batchErr.Report)
+	assert.Equal(t, expected, result.FinalStore["bulk.status"])
+	assert.Contains(t, result.Error.Error(), "1 of 3 batches failed: batch 1 failed: rate limited")
+
+	// By default the first failure stops the batches
+	action = NewBatchAction("bulk", "items", 2, process)
+	result = runSingleAction(t, context.Background(), action, func(w *Workflow) {
+		w.Store.Put("items", items)
+	})
+	require.ErrorAs(t, result.Error, &batchErr)
+	assert.Equal(t, 2, batchErr.Report.Batches)
+	assert.Equal(t, 2, batchErr.Report.Processed)
+
+	result = runSingleAction(t, context.Background(), action, nil)
+	assert.ErrorIs(t, result.Error, store.ErrNotFound)
+}
+
+func TestBatchActionStream(t *testing.T) {
+	var batches [][]int
+	process := func(ctx *ActionContext, batch []int) error {
+		batches = append(batches, batch)
+		return nil
+	}
+
+	wf := NewWorkflow("stream", "Stream", "")
+	wf.SetExecutionStrategy(StrategyParallel)
+	send, _, err := store.PutStream[int](wf.Store, "ids", 0)
+	require.NoError(t, err)
+
+	producer := NewStage("produce", "Produce", "")
+	producer.AddAction(NewActionFunc("list", "", func(ctx *ActionContext) error {
+		defer send.Close()
+		for i := 1; i <= 5; i++ {
+			if err := send.Send(ctx.GoContext, i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	consumer := NewStage("consume", "Consume", "")
+	consumer.AddAction(NewBatchAction("upload", "ids", 2, process))
+	wf.AddStage(producer)
+	wf.AddStage(consumer)
+
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, [][]int{{1, 2}, {3, 4}, {5}}, batches)
+	assert.Equal(t, BatchReport{Items: 5, Batches: 3, Processed: 5}, result.FinalStore["upload.report"])
+}
@@ -0,0 +1,79 @@
+package gostage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+// noopAction does nothing, to measure the cost of dispatching actions.
+type noopAction struct {
+	BaseAction
+}
+
+func (a *noopAction) Execute(ctx *ActionContext) error {
+	return nil
+}
+
+// newBenchWorkflow builds a workflow of stages no-op actions each.
+func newBenchWorkflow(stages, actions int) *Workflow {
+	wf := NewWorkflow("bench", "Bench", "")
+	for s := 0; s < stages; s++ {
+		stage := NewStage(fmt.Sprintf("stage-%d", s), "", "")
+		for a := 0; a < actions; a++ {
+			stage.AddAction(&noopAction{BaseAction: NewBaseAction(fmt.Sprintf("action-%d", a), "")})
+		}
+		wf.AddStage(stage)
+	}
+	return wf
+}
+
+func benchmarkDispatch(b *testing.B, runner *Runner, stages, actions int) {
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		wf := newBenchWorkflow(stages, actions)
+		b.StartTimer()
+		if err := runner.Execute(ctx, wf, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*stages*actions), "ns/action")
+}
+
+// BenchmarkDispatch measures the overhead of the runner for each action.
+func BenchmarkDispatch(b *testing.B) {
+	b.Run("1x10000", func(b *testing.B) { benchmarkDispatch(b, NewRunner(), 1, 10000) })
+	b.Run("100x100", func(b *testing.B) { benchmarkDispatch(b, NewRunner(), 100, 100) })
+	b.Run("100x100/events", func(b *testing.B) {
+		runner := NewRunner()
+		runner.Subscribe(EventAll, func(Event) {})
+		benchmarkDispatch(b, runner, 100, 100)
+	})
+	b.Run("100x100/middleware", func(b *testing.B) {
+		passthrough := func(next ActionRunnerFunc) ActionRunnerFunc { return next }
+		benchmarkDispatch(b, NewRunner(WithActionMiddleware(passthrough, passthrough)), 100, 100)
+	})
+}
+
+// BenchmarkEventPublish measures publishing events with and without subscribers.
+func BenchmarkEventPublish(b *testing.B) {
+	b.Run("unsubscribed", func(b *testing.B) {
+		bus := NewEventBus()
+		bus.Subscribe(EventWorkflowFailed, func(Event) {})
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			bus.Publish(Event{Type: EventActionStarted})
+		}
+	})
+	b.Run("subscribed", func(b *testing.B) {
+		bus := NewEventBus()
+		bus.Subscribe(EventActionStarted, func(Event) {})
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			bus.Publish(Event{Type: EventActionStarted})
+		}
+	})
+}
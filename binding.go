@@ -0,0 +1,264 @@
+package gostage
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BindingSource is where the value of a Binding is read from.
+type BindingSource string
+
+const (
+	// BindingEnv reads the value from an environment variable
+	BindingEnv BindingSource = "env"
+	// BindingFlag reads the value from a command line flag
+	BindingFlag BindingSource = "flag"
+)
+
+// Binding maps an environment variable or a command line flag to a store key.
+// Bindings are resolved when a run starts, before any stage runs, so that
+// runtime configuration lands in the store without setup actions.
+type Binding struct {
+	// Source is where the value is read from
+	Source BindingSource
+	// Name is the environment variable or the flag name
+	Name string
+	// Key is the store key the value is written to
+	Key string
+	// Required bindings fail the run when the value is not set, unless they have a default
+	Required bool
+	// Default is used when the value is not set
+	Default interface{}
+	// HasDefault reports whether Default was set
+	HasDefault bool
+
+	// convert turns the raw value into the type the binding stores
+	convert func(raw string) (interface{}, error)
+	// flags is the flag set of flag bindings
+	flags *flag.FlagSet
+}
+
+// BindOption configures a Binding declared with BindEnv, BindFlag or BindFlags.
+type BindOption func(*Binding)
+
+// BindRequired fails the run when the bound value is not set and the binding
+// has no default.
+func BindRequired(b *Binding) {
+	b.Required = true
+}
+
+// BindDefault sets the value stored when the bound value is not set. Unless
+// BindAs is used, the raw value is converted to the type of the default, if
+// it is one of the types BindAs supports.
+func BindDefault(value interface{}) BindOption {
+	return func(b *Binding) {
+		b.Default = value
+		b.HasDefault = true
+		if b.convert == nil {
+			b.convert = converterFor(value)
+		}
+	}
+}
+
+// BindAs converts the raw value to T before storing it. T must be string,
+// bool, int, int64, uint, float64, time.Duration or []string, the latter
+// read as a comma separated list. It panics for other types.
+func BindAs[T any]() BindOption {
+	var zero T
+	convert := converterFor(zero)
+	if convert == nil {
+		panic(fmt.Sprintf("gostage: cannot bind values as %T", zero))
+	}
+	return func(b *Binding) {
+		b.convert = convert
+	}
+}
+
+// converterFor returns the conversion of raw values to the type of example,
+// or nil if the type is not supported.
+func converterFor(example interface{}) func(raw string) (interface{}, error) {
+	switch example.(type) {
+	case string:
+		return func(raw string) (interface{}, error) { return raw, nil }
+	case bool:
+		return func(raw string) (interface{}, error) { return strconv.ParseBool(raw) }
+	case int:
+		return func(raw string) (interface{}, error) { return strconv.Atoi(raw) }
+	case int64:
+		return func(raw string) (interface{}, error) { return strconv.ParseInt(raw, 10, 64) }
+	case uint:
+		return func(raw string) (interface{}, error) {
+			value, err := strconv.ParseUint(raw, 10, 0)
+			return uint(value), err
+		}
+	case float64:
+		return func(raw string) (interface{}, error) { return strconv.ParseFloat(raw, 64) }
+	case time.Duration:
+		return func(raw string) (interface{}, error) { return time.ParseDuration(raw) }
+	case []string:
+		return func(raw string) (interface{}, error) {
+			values := strings.Split(raw, ",")
+			for i := range values {
+				values[i] = strings.TrimSpace(values[i])
+			}
+			return values, nil
+		}
+	default:
+		return nil
+	}
+}
+
+// BindEnv writes the value of the environment variable envVar to the store
+// key when a run starts. An unset or empty variable leaves the key untouched,
+// or sets it to the default of the binding if the store does not hold it.
+// Binding a key again replaces the previous binding.
+func (w *Workflow) BindEnv(envVar, key string, opts ...BindOption) {
+	w.bind(Binding{Source: BindingEnv, Name: envVar, Key: key}, opts)
+}
+
+// BindFlag writes the value of the flag name of flags to the store key when a
+// run starts, once the flags are parsed. A flag that was not set on the
+// command line leaves a key the store holds untouched, and otherwise stores
+// the default of the binding or, without one, the default of the flag.
+// Required flags must be set unless the binding has a default. Without BindAs
+// or BindDefault, the values of flags defined with the flag package keep
+// their type.
+func (w *Workflow) BindFlag(flags *flag.FlagSet, name, key string, opts ...BindOption) {
+	w.bind(Binding{Source: BindingFlag, Name: name, Key: key, flags: flags}, opts)
+}
+
+// BindFlags binds every flag defined in flags to the store key of the same
+// name, as BindFlag does. The options apply to every binding.
+func (w *Workflow) BindFlags(flags *flag.FlagSet, opts ...BindOption) {
+	flags.VisitAll(func(f *flag.Flag) {
+		w.BindFlag(flags, f.Name, f.Name, opts...)
+	})
+}
+
+// bind declares a binding, replacing the binding of the same key.
+func (w *Workflow) bind(binding Binding, opts []BindOption) {
+	for _, opt := range opts {
+		opt(&binding)
+	}
+
+	for i, existing := range w.bindings {
+		if existing.Key == binding.Key {
+			w.bindings[i] = binding
+			return
+		}
+	}
+	w.bindings = append(w.bindings, binding)
+}
+
+// Bindings returns the bindings declared on the workflow in declaration order.
+func (w *Workflow) Bindings() []Binding {
+	return append([]Binding{}, w.bindings...)
+}
+
+// String describes the source of the binding, such as "env DB_URL".
+func (b Binding) String() string {
+	if b.Source == BindingFlag {
+		return "flag -" + b.Name
+	}
+	return string(b.Source) + " " + b.Name
+}
+
+// lookup returns the raw value of the binding and whether it was set, in
+// the environment or on the command line.
+func (b Binding) lookup() (string, bool, error) {
+	if b.Source == BindingEnv {
+		raw := os.Getenv(b.Name)
+		return raw, raw != "", nil
+	}
+
+	f := b.flags.Lookup(b.Name)
+	if f == nil {
+		return "", false, fmt.Errorf("flag -%s is not defined", b.Name)
+	}
+	set := false
+	b.flags.Visit(func(visited *flag.Flag) {
+		set = set || visited.Name == b.Name
+	})
+	return f.Value.String(), set, nil
+}
+
+// flagValue returns the value of a flag binding, typed when the flag is
+// defined with the flag package and the binding converts nothing.
+func (b Binding) flagValue(raw string) (interface{}, error) {
+	if getter, ok := b.flags.Lookup(b.Name).Value.(flag.Getter); ok && b.convert == nil {
+		return getter.Get(), nil
+	}
+	return b.value(raw)
+}
+
+// value converts a raw value with the conversion of the binding, if any.
+func (b Binding) value(raw string) (interface{}, error) {
+	if b.convert == nil {
+		return raw, nil
+	}
+	return b.convert(raw)
+}
+
+// holds reports whether the store holds key.
+func (w *Workflow) holds(key string) bool {
+	_, err := w.Store.GetValue(key)
+	return err == nil
+}
+
+// resolveBindings writes the values of the workflow's bindings into the
+// store. Values that are not set fall back, in order, to the value the store
+// already holds, the default of the binding and the default of the flag. It
+// returns an error, without modifying the store, if a required value is
+// missing or a value cannot be converted.
+func (w *Workflow) resolveBindings() error {
+	resolved := make(map[string]interface{}, len(w.bindings))
+	var missing []string
+	for _, b := range w.bindings {
+		raw, set, err := b.lookup()
+		if err != nil {
+			return fmt.Errorf("failed to bind %s to '%s': %w", b, b.Key, err)
+		}
+
+		var value interface{}
+		switch {
+		case set && b.Source == BindingFlag:
+			value, err = b.flagValue(raw)
+		case set:
+			value, err = b.value(raw)
+		case w.holds(b.Key):
+			continue
+		case b.HasDefault:
+			resolved[b.Key] = b.Default
+			continue
+		case b.Required:
+			missing = append(missing, b.String())
+			continue
+		case b.Source == BindingFlag:
+			value, err = b.flagValue(raw)
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to bind %s to '%s': %w", b, b.Key, err)
+		}
+		resolved[b.Key] = value
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("workflow '%s' is missing required configuration: %s", w.ID, strings.Join(missing, ", "))
+	}
+
+	for _, b := range w.bindings {
+		value, ok := resolved[b.Key]
+		if !ok {
+			continue
+		}
+		if err := w.Store.Put(b.Key, value); err != nil {
+			return fmt.Errorf("failed to set '%s' from %s: %w", b.Key, b, err)
+		}
+	}
+	return nil
+}
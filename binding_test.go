@@ -0,0 +1,111 @@
+package gostage
+
+import (
+	"context"
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/davidroman0O/gostage/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newBindingWorkflow creates a workflow whose only action copies the given
+// store keys into seen.
+func newBindingWorkflow(seen map[string]interface{}, keys ...string) *Workflow {
+	wf := NewWorkflow("configured", "Configured", "")
+	stage := NewStage("s", "S", "")
+	stage.AddAction(NewActionFunc("read", "", func(ctx *ActionContext) error {
+		for _, key := range keys {
+			if value, err := ctx.Store().GetValue(key); err == nil {
+				seen[key] = value
+			}
+		}
+		return nil
+	}))
+	wf.AddStage(stage)
+	return wf
+}
+
+func TestBindEnv(t *testing.T) {
+	t.Setenv("TEST_DB_URL", "postgres://db")
+	t.Setenv("TEST_DB_POOL", "25")
+	t.Setenv("TEST_HOSTS", "a.example.com, b.example.com")
+	t.Setenv("TEST_EMPTY", "")
+
+	seen := make(map[string]interface{})
+	wf := newBindingWorkflow(seen, "db.url", "db.pool", "hosts", "timeout", "region", "unset")
+	wf.BindEnv("TEST_DB_URL", "db.url", BindRequired)
+	wf.BindEnv("TEST_DB_POOL", "db.pool", BindDefault(10))
+	wf.BindEnv("TEST_HOSTS", "hosts", BindAs[[]string]())
+	wf.BindEnv("TEST_EMPTY", "timeout", BindDefault(5*time.Second))
+	wf.BindEnv("TEST_UNSET", "region", BindRequired)
+	wf.BindEnv("TEST_UNSET", "unset")
+	require.NoError(t, wf.Store.Put("region", "eu-west-1"))
+	require.Len(t, wf.Bindings(), 6)
+
+	require.NoError(t, NewRunner().Execute(context.Background(), wf, nil))
+	assert.Equal(t, map[string]interface{}{
+		"db.url":  "postgres://db",
+		"db.pool": 25,
+		"hosts":   []string{"a.example.com", "b.example.com"},
+		"timeout": 5 * time.Second,
+		"region":  "eu-west-1",
+	}, seen)
+}
+
+func TestBindEnvErrors(t *testing.T) {
+	t.Setenv("TEST_DB_POOL", "many")
+
+	wf := newBindingWorkflow(map[string]interface{}{})
+	wf.BindEnv("TEST_DB_URL", "db.url", BindRequired)
+	wf.BindEnv("TEST_TOKEN", "token", BindRequired)
+	err := NewRunner().Execute(context.Background(), wf, nil)
+	assert.EqualError(t, err, "workflow 'configured' is missing required configuration: env TEST_DB_URL, env TEST_TOKEN")
+
+	wf = newBindingWorkflow(map[string]interface{}{})
+	wf.BindEnv("TEST_DB_POOL", "db.pool", BindAs[int]())
+	err = NewRunner().Execute(context.Background(), wf, nil)
+	assert.ErrorContains(t, err, "failed to bind env TEST_DB_POOL to 'db.pool'")
+	_, getErr := wf.Store.GetValue("db.pool")
+	assert.ErrorIs(t, getErr, store.ErrNotFound)
+
+	assert.Panics(t, func() { BindAs[struct{}]() })
+}
+
+func TestBindFlags(t *testing.T) {
+	fs := flag.NewFlagSet("deploy", flag.ContinueOnError)
+	fs.Duration("timeout", time.Minute, "")
+	fs.Int("replicas", 1, "")
+	fs.String("region", "us-east-1", "")
+	fs.String("env", "", "")
+	require.NoError(t, fs.Parse([]string{"-timeout", "90s", "-env", "staging"}))
+
+	seen := make(map[string]interface{})
+	wf := newBindingWorkflow(seen, "timeout", "replicas", "region", "env", "deploy.env")
+	wf.BindFlags(fs)
+	wf.BindFlag(fs, "env", "deploy.env", BindAs[[]string]())
+	require.NoError(t, wf.Store.Put("region", "eu-west-1"))
+
+	require.NoError(t, NewRunner().Execute(context.Background(), wf, nil))
+	assert.Equal(t, map[string]interface{}{
+		"timeout":    90 * time.Second,
+		"replicas":   1,
+		"region":     "eu-west-1",
+		"env":        "staging",
+		"deploy.env": []string{"staging"},
+	}, seen)
+
+	// Required flags must be set on the command line
+	wf = newBindingWorkflow(map[string]interface{}{})
+	wf.BindFlag(fs, "replicas", "replicas", BindRequired)
+	wf.BindFlag(fs, "missing", "missing")
+	err := NewRunner().Execute(context.Background(), wf, nil)
+	assert.EqualError(t, err, "failed to bind flag -missing to 'missing': flag -missing is not defined")
+
+	wf = newBindingWorkflow(map[string]interface{}{})
+	wf.BindFlag(fs, "replicas", "replicas", BindRequired)
+	err = NewRunner().Execute(context.Background(), wf, nil)
+	assert.EqualError(t, err, "workflow 'configured' is missing required configuration: flag -replicas")
+}
@@ -0,0 +1,175 @@
+package gostage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// SwitchDefault is the case of a switch stage run when no other case matches.
+const SwitchDefault = "default"
+
+// Names of the branches of an if stage
+const (
+	BranchThen = "then"
+	BranchElse = "else"
+)
+
+// StageBranch is one of the alternative lists of stages of an if or switch stage.
+type StageBranch struct {
+	// Name is BranchThen or BranchElse for an if stage, and the case for a switch stage
+	Name   string
+	Stages []*Stage
+}
+
+// SwitchSelector returns the case of a switch stage to run.
+type SwitchSelector func(ctx *ActionContext) (string, error)
+
+// stageBranches holds the branches of an if or switch stage.
+type stageBranches struct {
+	kind     string
+	selector SwitchSelector
+	branches []StageBranch
+}
+
+// IfStage creates a stage running thenStages if cond is satisfied when the
+// stage is reached, and elseStages otherwise. The stages of the other branch
+// are marked as skipped.
+//
+// Branch stages run like the stages of the workflow, with workflow and
+// runner middleware, statuses and events, but are not part of
+// Workflow.Stages. They are rendered inside the if stage in graphs.
+func IfStage(id, name string, cond PollPredicate, thenStages, elseStages []*Stage) *Stage {
+	stage := NewStage(id, name, "Runs the then or else stages depending on a condition")
+	stage.branches = &stageBranches{
+		kind: "if",
+		selector: func(ctx *ActionContext) (string, error) {
+			ok, err := cond(ctx)
+			if err != nil || !ok {
+				return BranchElse, err
+			}
+			return BranchThen, nil
+		},
+		branches: []StageBranch{{Name: BranchThen, Stages: thenStages}, {Name: BranchElse, Stages: elseStages}},
+	}
+	return stage
+}
+
+// SwitchStage creates a stage running the stages of the case returned by
+// selector when the stage is reached, or those of the SwitchDefault case if
+// no case matches. Nothing runs if neither exists. The stages of the other
+// cases are marked as skipped. Branch stages run as described for IfStage.
+func SwitchStage(id, name string, selector SwitchSelector, cases map[string][]*Stage) *Stage {
+	keys := make([]string, 0, len(cases))
+	for key := range cases {
+		if key != SwitchDefault {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if _, ok := cases[SwitchDefault]; ok {
+		keys = append(keys, SwitchDefault)
+	}
+
+	branches := make([]StageBranch, len(keys))
+	for i, key := range keys {
+		branches[i] = StageBranch{Name: key, Stages: cases[key]}
+	}
+
+	stage := NewStage(id, name, "Runs the stages of the selected case")
+	stage.branches = &stageBranches{kind: "switch", selector: selector, branches: branches}
+	return stage
+}
+
+// StoreKeySelector returns a selector choosing the case named after the value
+// stored under key, formatted with fmt.Sprint. A missing key selects the
+// SwitchDefault case.
+func StoreKeySelector(key string) SwitchSelector {
+	return func(ctx *ActionContext) (string, error) {
+		value, ok := ctx.Store().ExportAll()[key]
+		if !ok {
+			return SwitchDefault, nil
+		}
+		return fmt.Sprint(value), nil
+	}
+}
+
+// Branches returns the branches of an if or switch stage, in the order they
+// are rendered, or nil for other stages.
+func (s *Stage) Branches() []StageBranch {
+	if s.branches == nil {
+		return nil
+	}
+	return s.branches.branches
+}
+
+// executeBranches runs the stages of the branch selected for an if or switch
+// stage through runStage and marks the stages of the other branches as skipped.
+func (r *Runner) executeBranches(ctx context.Context, s *Stage, workflow *Workflow, logger Logger, runStage func(context.Context, *Stage) error) error {
+	selectorCtx := &ActionContext{
+		GoContext:       ctx,
+		Workflow:        workflow,
+		Stage:           s,
+		Logger:          AsFieldLogger(logger),
+		disabledActions: make(map[string]bool),
+		disabledStages:  make(map[string]bool),
+	}
+	if disabled, ok := workflow.Context["disabledActions"].(map[string]bool); ok {
+		selectorCtx.disabledActions = disabled
+	}
+	if disabled, ok := workflow.Context["disabledStages"].(map[string]bool); ok {
+		selectorCtx.disabledStages = disabled
+	}
+
+	selected, err := s.branches.selector(selectorCtx)
+	if err != nil {
+		return fmt.Errorf("%s condition failed: %w", s.branches.kind, err)
+	}
+	index := -1
+	for i, branch := range s.branches.branches {
+		if branch.Name == selected {
+			index = i
+		}
+	}
+	if index < 0 && s.branches.kind == "switch" {
+		for i, branch := range s.branches.branches {
+			if branch.Name == SwitchDefault {
+				index = i
+			}
+		}
+	}
+
+	for i, branch := range s.branches.branches {
+		if i == index {
+			continue
+		}
+		for _, stage := range branch.Stages {
+			skipBranch(r, workflow, stage)
+		}
+	}
+	if index < 0 {
+		logger.Debug("No case matches '%s'", selected)
+		return nil
+	}
+
+	branch := s.branches.branches[index]
+	logger.Debug("Running %s branch '%s' with %d stages", s.branches.kind, branch.Name, len(branch.Stages))
+	for _, stage := range branch.Stages {
+		if err := runStage(ctx, stage); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipBranch marks a stage of a branch that was not selected, and the stages
+// of its own branches, as skipped.
+func skipBranch(r *Runner, workflow *Workflow, stage *Stage) {
+	workflow.setStageStatus(stage.ID, StatusSkipped)
+	r.publish(workflow, Event{Type: EventStageSkipped, WorkflowID: workflow.ID, StageID: stage.ID, Annotations: mergedAnnotations(workflow, stage, nil)})
+	for _, branch := range stage.Branches() {
+		for _, nested := range branch.Stages {
+			skipBranch(r, workflow, nested)
+		}
+	}
+}
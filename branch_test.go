@@ -0,0 +1,131 @@
+package gostage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingStage returns a stage with a single action appending its ID to ran.
+func recordingStage(id string, ran *[]string) *Stage {
+	stage := NewStage(id, id, "")
+	stage.AddAction(NewActionFunc(id+"-action", "", func(ctx *ActionContext) error {
+		*ran = append(*ran, id)
+		return nil
+	}))
+	return stage
+}
+
+func TestIfStage(t *testing.T) {
+	for _, tc := range []struct {
+		env     string
+		ran     []string
+		skipped string
+	}{
+		{"prod", []string{"approve", "deploy", "after"}, "preview"},
+		{"dev", []string{"preview", "after"}, "approve"},
+	} {
+		t.Run(tc.env, func(t *testing.T) {
+			var ran []string
+			wf := NewWorkflow("release", "Release", "")
+			wf.AddStage(IfStage("is-prod", "Production?", StoreKeyEquals("env", "prod"),
+				[]*Stage{recordingStage("approve", &ran), recordingStage("deploy", &ran)},
+				[]*Stage{recordingStage("preview", &ran)}))
+			wf.AddStage(recordingStage("after", &ran))
+			wf.Store.Put("env", tc.env)
+
+			result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+			require.True(t, result.Success, "%v", result.Error)
+			assert.Equal(t, tc.ran, ran)
+			assert.Equal(t, StatusCompleted, result.StageStatuses["is-prod"])
+			assert.Equal(t, StatusSkipped, result.StageStatuses[tc.skipped])
+			assert.Len(t, wf.Stages, 2)
+		})
+	}
+}
+
+func TestSwitchStage(t *testing.T) {
+	newWorkflow := func(ran *[]string) *Workflow {
+		wf := NewWorkflow("provision", "Provision", "")
+		wf.AddStage(SwitchStage("cloud", "Cloud", StoreKeySelector("cloud"), map[string][]*Stage{
+			"aws":         {recordingStage("aws", ran)},
+			"gcp":         {recordingStage("gcp", ran)},
+			SwitchDefault: {recordingStage("local", ran)},
+		}))
+		return wf
+	}
+
+	var ran []string
+	wf := newWorkflow(&ran)
+	wf.Store.Put("cloud", "gcp")
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, []string{"gcp"}, ran)
+	assert.Equal(t, StatusSkipped, result.StageStatuses["aws"])
+	assert.Equal(t, StatusSkipped, result.StageStatuses["local"])
+
+	ran = nil
+	wf = newWorkflow(&ran)
+	wf.Store.Put("cloud", "azure")
+	result = NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, []string{"local"}, ran)
+
+	ran = nil
+	wf = NewWorkflow("provision", "Provision", "")
+	wf.AddStage(SwitchStage("cloud", "Cloud", StoreKeySelector("cloud"), map[string][]*Stage{
+		"1": {recordingStage("one", &ran)},
+	}))
+	wf.Store.Put("cloud", 2)
+	result = NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Empty(t, ran)
+	assert.Equal(t, StatusSkipped, result.StageStatuses["one"])
+}
+
+func TestBranchStageFailure(t *testing.T) {
+	failing := NewStage("failing", "Failing", "")
+	failing.AddAction(NewActionFunc("boom", "", func(ctx *ActionContext) error { return assert.AnError }))
+	var ran []string
+
+	wf := NewWorkflow("fail", "Fail", "")
+	wf.AddStage(IfStage("check", "Check", func(ctx *ActionContext) (bool, error) { return true, nil },
+		[]*Stage{failing, recordingStage("never", &ran)}, nil))
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	assert.ErrorIs(t, result.Error, assert.AnError)
+	assert.Equal(t, StatusFailed, result.StageStatuses["failing"])
+	assert.Equal(t, StatusFailed, result.StageStatuses["check"])
+	assert.Empty(t, ran)
+
+	wf = NewWorkflow("fail", "Fail", "")
+	wf.AddStage(IfStage("check", "Check", StoreKeyEquals("count", 1), nil, nil))
+	wf.Store.Put("count", "one")
+	result = NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	assert.ErrorContains(t, result.Error, "if condition failed")
+}
+
+func TestBranchStageGraph(t *testing.T) {
+	var ran []string
+	wf := NewWorkflow("release", "Release", "")
+	wf.AddStage(recordingStage("build", &ran))
+	wf.AddStage(IfStage("is-prod", "Production?", StoreKeyEquals("env", "prod"),
+		[]*Stage{recordingStage("deploy", &ran)}, nil))
+	wf.AddStage(recordingStage("notify", &ran))
+
+	dot := wf.ToDOT()
+	assert.Contains(t, dot, `n1 [label="if"];`)
+	assert.Contains(t, dot, `label="then";`)
+	assert.Contains(t, dot, `n3 [label="(no stages)"];`)
+	for _, edge := range []string{"n0 -> n1;", "n1 -> n2;", "n1 -> n3;", "n2 -> n4;", "n3 -> n4;"} {
+		assert.Contains(t, dot, edge)
+	}
+
+	wf.Store.Put("env", "dev")
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	mermaid := wf.ToMermaidWithResult(result)
+	assert.Contains(t, mermaid, `subgraph s2["then"]`)
+	assert.Contains(t, mermaid, "class s3 skipped")
+	assert.Contains(t, mermaid, "n1 --> n3")
+}
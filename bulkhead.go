@@ -0,0 +1,117 @@
+package gostage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// concurrencyPools is the registry of the named concurrency pools of a runner.
+type concurrencyPools struct {
+	mu     sync.RWMutex
+	byName map[string]chan struct{}
+}
+
+// WithConcurrencyPool declares a named pool of size slots. An action tagged
+// with the name of a pool holds one of its slots while it executes, so at
+// most size such actions run at once across the parallel items, branches and
+// concurrent runs of the runner. Actions tagged with several pools hold a slot
+// of each.
+func WithConcurrencyPool(name string, size int) RunnerOption {
+	return func(r *Runner) {
+		r.SetConcurrencyPool(name, size)
+	}
+}
+
+// SetConcurrencyPool declares or replaces a named concurrency pool of the
+// runner. Executions holding a slot of a replaced pool release it to the old pool.
+func (r *Runner) SetConcurrencyPool(name string, size int) {
+	if size < 1 {
+		size = 1
+	}
+	r.pools.mu.Lock()
+	defer r.pools.mu.Unlock()
+	if r.pools.byName == nil {
+		r.pools.byName = make(map[string]chan struct{})
+	}
+	r.pools.byName[name] = make(chan struct{}, size)
+}
+
+// ConcurrencyPool returns the number of slots in use and the size of a named pool.
+func (r *Runner) ConcurrencyPool(name string) (inUse, size int, ok bool) {
+	r.pools.mu.RLock()
+	defer r.pools.mu.RUnlock()
+	slots, ok := r.pools.byName[name]
+	return len(slots), cap(slots), ok
+}
+
+// acquirePools waits for a slot in each pool the action is tagged with and
+// returns the function releasing them. Slots are taken in name order, so
+// actions sharing several pools cannot deadlock.
+func (r *Runner) acquirePools(ctx context.Context, action Action) (func(), error) {
+	r.pools.mu.RLock()
+	if len(r.pools.byName) == 0 {
+		r.pools.mu.RUnlock()
+		return func() {}, nil
+	}
+	var names []string
+	var pools []chan struct{}
+	for _, tag := range action.Tags() {
+		if slots, ok := r.pools.byName[tag]; ok {
+			names = append(names, tag)
+			pools = append(pools, slots)
+		}
+	}
+	r.pools.mu.RUnlock()
+	sort.Sort(poolsByName{names, pools})
+
+	var held []chan struct{}
+	release := func() {
+		for i := len(held) - 1; i >= 0; i-- {
+			<-held[i]
+		}
+	}
+	for i, slots := range pools {
+		select {
+		case slots <- struct{}{}:
+			held = append(held, slots)
+		case <-ctx.Done():
+			release()
+			return nil, fmt.Errorf("failed to wait for concurrency pool '%s': %w", names[i], ctx.Err())
+		}
+	}
+	return release, nil
+}
+
+// poolsByName sorts pools by name, keeping the names and channels aligned.
+type poolsByName struct {
+	names []string
+	pools []chan struct{}
+}
+
+func (p poolsByName) Len() int           { return len(p.names) }
+func (p poolsByName) Less(i, j int) bool { return p.names[i] < p.names[j] }
+func (p poolsByName) Swap(i, j int) {
+	p.names[i], p.names[j] = p.names[j], p.names[i]
+	p.pools[i], p.pools[j] = p.pools[j], p.pools[i]
+}
+
+// executeInPools executes an action while holding a slot in each pool of the
+// runner executing the workflow that the action is tagged with.
+func executeInPools(ctx *ActionContext, action Action, execute func() error) error {
+	r, ok := ctx.Workflow.Context["runner"].(*Runner)
+	if !ok {
+		return execute()
+	}
+	goCtx := ctx.GoContext
+	if goCtx == nil {
+		goCtx = context.Background()
+	}
+	release, err := r.acquirePools(goCtx, action)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return execute()
+}
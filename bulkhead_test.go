@@ -0,0 +1,92 @@
+package gostage
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// concurrencyProbe records the highest number of concurrent executions.
+type concurrencyProbe struct {
+	current, max atomic.Int32
+}
+
+func (p *concurrencyProbe) action(name string, tags ...string) Action {
+	action := NewActionFunc(name, "", func(ctx *ActionContext) error {
+		n := p.current.Add(1)
+		defer p.current.Add(-1)
+		for {
+			max := p.max.Load()
+			if n <= max || p.max.CompareAndSwap(max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+	for _, tag := range tags {
+		GetActionBaseFields(action).AddTag(tag)
+	}
+	return action
+}
+
+func TestConcurrencyPools(t *testing.T) {
+	runner := NewRunner(WithConcurrencyPool("db", 2), WithConcurrencyPool("network", 10))
+	inUse, size, ok := runner.ConcurrencyPool("db")
+	require.True(t, ok)
+	assert.Equal(t, 0, inUse)
+	assert.Equal(t, 2, size)
+
+	var db, network concurrencyProbe
+	wf := NewWorkflow("import", "Import", "")
+	wf.Store.Put("rows", []int{1, 2, 3, 4, 5, 6, 7, 8})
+	stage := NewStage("load", "Load", "")
+	stage.AddAction(NewForEachAction[int]("insert", "rows", []Action{
+		network.action("download", "network"),
+		db.action("insert-row", "db", "network"),
+	}, WithParallelism(8)))
+	wf.AddStage(stage)
+
+	require.NoError(t, runner.Execute(context.Background(), wf, NewDefaultLogger()))
+	assert.Equal(t, int32(2), db.max.Load())
+	assert.Greater(t, network.max.Load(), int32(2))
+}
+
+func TestConcurrencyPoolsAcrossRuns(t *testing.T) {
+	runner := NewRunner(WithConcurrencyPool("db", 1))
+
+	var probe concurrencyProbe
+	newWorkflow := func() *Workflow {
+		wf := NewWorkflow("migrate", "Migrate", "")
+		stage := NewStage("schema", "Schema", "")
+		stage.AddAction(probe.action("migrate", "db"))
+		wf.AddStage(stage)
+		return wf
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, runner.Execute(context.Background(), newWorkflow(), NewDefaultLogger()))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), probe.max.Load())
+
+	// Waiting for a slot stops when the run is cancelled
+	release, err := runner.acquirePools(context.Background(), probe.action("holder", "db"))
+	require.NoError(t, err)
+	defer release()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = runner.Execute(ctx, newWorkflow(), NewDefaultLogger())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "failed to wait for concurrency pool 'db'")
+}
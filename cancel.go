@@ -0,0 +1,41 @@
+package gostage
+
+import (
+	"context"
+	"time"
+)
+
+// contextCancelGrace holds the RunOptions.CancelGracePeriod of the current run
+const contextCancelGrace = "cancelGracePeriod"
+
+// cancelled reports whether the run's context was cancelled or timed out, as
+// opposed to interrupted by a signal or by Shutdown.
+func cancelled(ctx context.Context) bool {
+	return ctx.Err() != nil && interruption(ctx) == nil
+}
+
+// cleanupContext returns the context the always-run stages execute with once
+// the run stopped. It ignores the cancellation of ctx, but when ctx is done
+// and the run has a CancelGracePeriod, it expires after that period.
+func cleanupContext(ctx context.Context, w *Workflow) (context.Context, context.CancelFunc) {
+	cleanupCtx := context.WithoutCancel(ctx)
+	if grace, ok := w.Context[contextCancelGrace].(time.Duration); ok && grace > 0 && ctx.Err() != nil {
+		return context.WithTimeout(cleanupCtx, grace)
+	}
+	return cleanupCtx, func() {}
+}
+
+// markActionsCancelled gives StatusCancelled to the actions of the stage from
+// index on, none of which will run.
+func (w *Workflow) markActionsCancelled(stage *Stage, from int) {
+	for _, action := range stage.Actions[from:] {
+		w.setActionStatus(stage.ID, action.Name(), StatusCancelled)
+	}
+}
+
+// markStageCancelled gives StatusCancelled to a stage that will not run and to
+// all of its actions.
+func (w *Workflow) markStageCancelled(stage *Stage) {
+	w.setStageStatus(stage.ID, StatusCancelled)
+	w.markActionsCancelled(stage, 0)
+}
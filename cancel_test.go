@@ -0,0 +1,107 @@
+package gostage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunnerStopsBetweenActionsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	secondRan := false
+	wf := NewWorkflow("cancel", "Cancel", "")
+	first := NewStage("first", "First", "")
+	// The action ignores the cancellation it causes, like a non-cooperative action would
+	first.AddAction(NewActionFunc("cancel", "", func(*ActionContext) error {
+		cancel()
+		return nil
+	}))
+	first.AddAction(NewActionFunc("after", "", func(*ActionContext) error {
+		secondRan = true
+		return nil
+	}))
+	wf.AddStage(first)
+	second := NewStage("second", "Second", "")
+	second.AddAction(NewActionFunc("never", "", func(*ActionContext) error {
+		secondRan = true
+		return nil
+	}))
+	wf.AddStage(second)
+
+	options := DefaultRunOptions()
+	options.Context = ctx
+	result := NewRunner().ExecuteWithOptions(wf, options)
+
+	assert.ErrorIs(t, result.Error, context.Canceled)
+	assert.True(t, result.Cancelled)
+	assert.False(t, result.Interrupted)
+	assert.False(t, secondRan)
+	assert.Equal(t, map[string]string{"first": StatusCancelled, "second": StatusCancelled}, result.StageStatuses)
+	assert.Equal(t, map[string]string{
+		ActionStatusKey("first", "cancel"): StatusCompleted,
+		ActionStatusKey("first", "after"):  StatusCancelled,
+		ActionStatusKey("second", "never"): StatusCancelled,
+	}, result.ActionStatuses)
+}
+
+func TestRunnerDoesNotStartStagesOnceCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ran := false
+	result := runSingleAction(t, ctx, NewActionFunc("noop", "", func(*ActionContext) error {
+		ran = true
+		return nil
+	}), nil)
+
+	assert.ErrorIs(t, result.Error, context.Canceled)
+	assert.True(t, result.Cancelled)
+	assert.False(t, ran)
+	assert.Equal(t, StatusCancelled, result.StageStatuses["wait"])
+	assert.Equal(t, StatusCancelled, result.ActionStatuses[ActionStatusKey("wait", "noop")])
+}
+
+func TestCancelGracePeriod(t *testing.T) {
+	run := func(grace time.Duration) (deadline time.Time, hasDeadline bool, result RunResult) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		wf := NewWorkflow("grace", "Grace", "")
+		work := NewStage("work", "Work", "")
+		work.AddAction(NewActionFunc("cancel", "", func(*ActionContext) error {
+			cancel()
+			return nil
+		}))
+		work.AddAction(NewActionFunc("more", "", func(*ActionContext) error { return nil }))
+		wf.AddStage(work)
+		cleanup := NewStageWithTags("cleanup", "Cleanup", "", []string{TagAlwaysRun})
+		cleanup.AddAction(NewActionFunc("release", "", func(ctx *ActionContext) error {
+			deadline, hasDeadline = ctx.GoContext.Deadline()
+			return ctx.GoContext.Err()
+		}))
+		wf.AddStage(cleanup)
+
+		options := DefaultRunOptions()
+		options.Context = ctx
+		options.CancelGracePeriod = grace
+		result = NewRunner().ExecuteWithOptions(wf, options)
+		return deadline, hasDeadline, result
+	}
+
+	started := time.Now()
+	deadline, hasDeadline, result := run(time.Minute)
+	require.True(t, hasDeadline, "cleanup should be bounded by the grace period")
+	assert.WithinDuration(t, started.Add(time.Minute), deadline, 5*time.Second)
+	assert.Equal(t, StatusCompleted, result.StageStatuses["cleanup"])
+	assert.Equal(t, StatusCancelled, result.StageStatuses["work"])
+	assert.True(t, result.Cancelled)
+
+	_, hasDeadline, result = run(0)
+	assert.False(t, hasDeadline, "cleanup is unbounded without a grace period")
+	assert.Equal(t, StatusCompleted, result.StageStatuses["cleanup"])
+}
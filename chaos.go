@@ -0,0 +1,165 @@
+package gostage
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrChaos is the error of the failures injected by Chaos without an error of their own.
+var ErrChaos = errors.New("chaos: injected failure")
+
+// ChaosFault is a kind of fault injected by Chaos.
+type ChaosFault string
+
+// Faults injected by Chaos
+const (
+	// ChaosFailure makes the execution fail without running the action
+	ChaosFailure ChaosFault = "failure"
+	// ChaosDelay delays the execution of the action
+	ChaosDelay ChaosFault = "delay"
+	// ChaosPanic panics instead of running the action
+	ChaosPanic ChaosFault = "panic"
+)
+
+// InjectedFault records a fault injected into an action execution.
+type InjectedFault struct {
+	StageID string
+	Action  string
+	Fault   ChaosFault
+}
+
+// chaosRule injects a fault with a probability.
+type chaosRule struct {
+	fault       ChaosFault
+	probability float64
+	err         error
+	delay       time.Duration
+}
+
+// Chaos injects failures, delays and panics into action executions, to check
+// in tests that retries, fallbacks and compensations really cope with them.
+// Faults are drawn from a random generator seeded by the caller, so a failing
+// test can be reproduced with the same seed as long as actions run in the
+// same order.
+type Chaos struct {
+	mu    sync.Mutex
+	rng   *rand.Rand
+	rules []chaosRule
+	// targets holds the action names and "stageID:actionName" keys to inject
+	// faults into; empty targets every action
+	targets  map[string]bool
+	injected []InjectedFault
+}
+
+// ChaosOption configures a Chaos.
+type ChaosOption func(*Chaos)
+
+// WithChaosFailure makes executions fail with err with the given probability,
+// between 0 and 1. A nil err fails with ErrChaos.
+func WithChaosFailure(probability float64, err error) ChaosOption {
+	return func(c *Chaos) {
+		c.rules = append(c.rules, chaosRule{fault: ChaosFailure, probability: probability, err: err})
+	}
+}
+
+// WithChaosDelay delays executions by delay with the given probability.
+// The delay ends early when the run is cancelled.
+func WithChaosDelay(probability float64, delay time.Duration) ChaosOption {
+	return func(c *Chaos) {
+		c.rules = append(c.rules, chaosRule{fault: ChaosDelay, probability: probability, delay: delay})
+	}
+}
+
+// WithChaosPanic makes executions panic with the given probability.
+func WithChaosPanic(probability float64) ChaosOption {
+	return func(c *Chaos) {
+		c.rules = append(c.rules, chaosRule{fault: ChaosPanic, probability: probability})
+	}
+}
+
+// WithChaosTargets injects faults only into the actions with these names or
+// "stageID:actionName" keys.
+func WithChaosTargets(actions ...string) ChaosOption {
+	return func(c *Chaos) {
+		if c.targets == nil {
+			c.targets = make(map[string]bool)
+		}
+		for _, action := range actions {
+			c.targets[action] = true
+		}
+	}
+}
+
+// NewChaos creates a fault injector drawing faults from a generator seeded
+// with seed. Rules are tried in the order they are given: a delay can precede
+// a failure or a panic of the same execution.
+func NewChaos(seed int64, opts ...ChaosOption) *Chaos {
+	c := &Chaos{rng: rand.New(rand.NewSource(seed))}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Middleware returns action middleware injecting the faults. Retry middleware
+// placed before it sees every injected failure.
+func (c *Chaos) Middleware() ActionMiddleware {
+	return func(next ActionRunnerFunc) ActionRunnerFunc {
+		return func(ctx *ActionContext, action Action, index int, isLast bool) error {
+			stageID := ""
+			if ctx.Stage != nil {
+				stageID = ctx.Stage.ID
+			}
+
+			for _, rule := range c.draw(stageID, action.Name()) {
+				switch rule.fault {
+				case ChaosDelay:
+					if err := ctx.Sleep(rule.delay); err != nil {
+						return err
+					}
+				case ChaosFailure:
+					if rule.err != nil {
+						return rule.err
+					}
+					return fmt.Errorf("%w into action '%s'", ErrChaos, action.Name())
+				case ChaosPanic:
+					panic(fmt.Sprintf("chaos: injected panic into action '%s'", action.Name()))
+				}
+			}
+			return next(ctx, action, index, isLast)
+		}
+	}
+}
+
+// draw returns the rules hit by an execution and records their faults.
+func (c *Chaos) draw(stageID, actionName string) []chaosRule {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.targets) > 0 && !c.targets[actionName] && !c.targets[ActionStatusKey(stageID, actionName)] {
+		return nil
+	}
+
+	var hit []chaosRule
+	for _, rule := range c.rules {
+		if c.rng.Float64() >= rule.probability {
+			continue
+		}
+		hit = append(hit, rule)
+		c.injected = append(c.injected, InjectedFault{StageID: stageID, Action: actionName, Fault: rule.fault})
+		if rule.fault != ChaosDelay {
+			break
+		}
+	}
+	return hit
+}
+
+// Injected returns the faults injected so far, in order.
+func (c *Chaos) Injected() []InjectedFault {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]InjectedFault(nil), c.injected...)
+}
@@ -0,0 +1,126 @@
+package gostage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newChaosWorkflow builds a workflow with a stage of actions counting their calls.
+func newChaosWorkflow(calls map[string]int, names ...string) *Workflow {
+	wf := NewWorkflow("orders", "Orders", "")
+	stage := NewStage("process", "Process", "")
+	for _, name := range names {
+		stage.AddAction(NewActionFunc(name, "", func(ctx *ActionContext) error {
+			calls[name]++
+			return nil
+		}))
+	}
+	wf.AddStage(stage)
+	return wf
+}
+
+// retryUntil retries executions until they succeed or attempts runs out.
+func retryUntil(attempts int) ActionMiddleware {
+	return func(next ActionRunnerFunc) ActionRunnerFunc {
+		return func(ctx *ActionContext, action Action, index int, isLast bool) error {
+			var err error
+			for i := 0; i < attempts; i++ {
+				if err = next(ctx, action, index, isLast); err == nil {
+					return nil
+				}
+			}
+			return err
+		}
+	}
+}
+
+func TestChaosFailuresAreRetried(t *testing.T) {
+	chaos := NewChaos(42, WithChaosFailure(0.5, nil))
+	calls := map[string]int{}
+	runner := NewRunner(WithActionMiddleware(retryUntil(20), chaos.Middleware()))
+
+	names := []string{"validate", "reserve", "charge", "ship", "notify"}
+	require.NoError(t, runner.Execute(context.Background(), newChaosWorkflow(calls, names...), nil))
+	for _, name := range names {
+		assert.Equal(t, 1, calls[name], name)
+	}
+
+	injected := chaos.Injected()
+	require.NotEmpty(t, injected)
+	for _, fault := range injected {
+		assert.Equal(t, ChaosFailure, fault.Fault)
+		assert.Equal(t, "process", fault.StageID)
+	}
+
+	// Without retries an injected failure fails the run
+	always := NewChaos(1, WithChaosFailure(1, nil))
+	err := NewRunner(WithActionMiddleware(always.Middleware())).Execute(context.Background(), newChaosWorkflow(map[string]int{}, "validate"), nil)
+	assert.ErrorIs(t, err, ErrChaos)
+}
+
+func TestChaosIsDeterministic(t *testing.T) {
+	run := func(seed int64) []InjectedFault {
+		chaos := NewChaos(seed, WithChaosFailure(0.3, errors.New("connection reset")))
+		runner := NewRunner(WithActionMiddleware(retryUntil(10), chaos.Middleware()))
+		var names []string
+		for i := 0; i < 10; i++ {
+			names = append(names, fmt.Sprintf("step-%d", i))
+		}
+		require.NoError(t, runner.Execute(context.Background(), newChaosWorkflow(map[string]int{}, names...), nil))
+		return chaos.Injected()
+	}
+
+	assert.Equal(t, run(7), run(7))
+	assert.NotEqual(t, run(7), run(8))
+}
+
+func TestChaosTargets(t *testing.T) {
+	targetErr := errors.New("gateway timeout")
+	chaos := NewChaos(3, WithChaosFailure(1, targetErr), WithChaosTargets("process:charge"))
+	calls := map[string]int{}
+
+	err := NewRunner(WithActionMiddleware(chaos.Middleware())).Execute(context.Background(), newChaosWorkflow(calls, "reserve", "charge", "ship"), nil)
+	assert.ErrorIs(t, err, targetErr)
+	assert.Equal(t, map[string]int{"reserve": 1}, calls)
+	assert.Equal(t, []InjectedFault{{StageID: "process", Action: "charge", Fault: ChaosFailure}}, chaos.Injected())
+}
+
+func TestChaosDelaysAndPanics(t *testing.T) {
+	chaos := NewChaos(5, WithChaosDelay(1, 20*time.Millisecond), WithChaosTargets("reserve"))
+	calls := map[string]int{}
+	start := time.Now()
+	require.NoError(t, NewRunner(WithActionMiddleware(chaos.Middleware())).Execute(context.Background(), newChaosWorkflow(calls, "reserve"), nil))
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	assert.Equal(t, 1, calls["reserve"])
+
+	// Cancelling the run ends a delay early
+	slow := NewChaos(5, WithChaosDelay(1, time.Minute))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := NewRunner(WithActionMiddleware(slow.Middleware())).Execute(ctx, newChaosWorkflow(map[string]int{}, "reserve"), nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Panics reach recovery middleware placed before the chaos
+	var recovered interface{}
+	recovering := func(next ActionRunnerFunc) ActionRunnerFunc {
+		return func(ctx *ActionContext, action Action, index int, isLast bool) (err error) {
+			defer func() {
+				if recovered = recover(); recovered != nil {
+					err = fmt.Errorf("action '%s' panicked: %v", action.Name(), recovered)
+				}
+			}()
+			return next(ctx, action, index, isLast)
+		}
+	}
+	panicking := NewChaos(5, WithChaosPanic(1))
+	err = NewRunner(WithActionMiddleware(recovering, panicking.Middleware())).Execute(context.Background(), newChaosWorkflow(map[string]int{}, "ship"), nil)
+	require.Error(t, err)
+	assert.Equal(t, "chaos: injected panic into action 'ship'", recovered)
+	assert.Equal(t, []InjectedFault{{StageID: "process", Action: "ship", Fault: ChaosPanic}}, panicking.Injected())
+}
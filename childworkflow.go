@@ -0,0 +1,213 @@
+package gostage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/davidroman0O/gostage/store"
+)
+
+// SpawnMode selects how SpawnWorkflow runs a child workflow.
+type SpawnMode int
+
+const (
+	// SpawnInline runs the child workflow within the calling action, which
+	// waits for it to finish
+	SpawnInline SpawnMode = iota
+	// SpawnDetached submits the child workflow to the runner's worker pool and
+	// returns at once, leaving a handle to join it later
+	SpawnDetached
+)
+
+// SpawnOptions configures SpawnWorkflow.
+type SpawnOptions struct {
+	// Mode selects whether the child runs inline or detached
+	Mode SpawnMode
+
+	// StoreMapping maps keys of the parent store to keys of the child store.
+	// Each mapped parent value is put in the child store before the child
+	// starts, keys missing from the parent being outputs of the child. Once the child is joined, inline ones right away, its final value
+	// of each mapped key is put back under the parent key
+	StoreMapping map[string]string
+
+	// Handle names a detached child for JoinWorkflow. It defaults to the ID
+	// of the child workflow
+	Handle string
+
+	// Options are the run options of the child. Without them the child uses
+	// the runner's default options. The context of the action is used when
+	// Options.Context is nil, detached from its cancellation for detached children
+	Options *RunOptions
+}
+
+// ChildWorkflow is a workflow spawned by an action with SpawnWorkflow.
+type ChildWorkflow struct {
+	// Workflow is the child workflow
+	Workflow *Workflow
+	// Handle names the child for JoinWorkflow
+	Handle string
+
+	mapping map[string]string
+	done    <-chan struct{}
+	result  func() RunResult
+}
+
+// Done returns a channel that is closed once the child workflow has finished.
+func (c *ChildWorkflow) Done() <-chan struct{} {
+	return c.done
+}
+
+// Wait blocks until the child workflow has finished and returns its result.
+func (c *ChildWorkflow) Wait() RunResult {
+	<-c.done
+	return c.result()
+}
+
+// childWorkflows holds the detached children of a workflow, keyed by handle.
+type childWorkflows struct {
+	mu       sync.Mutex
+	children map[string]*ChildWorkflow
+}
+
+// contextChildWorkflows holds the *childWorkflows of a workflow
+const contextChildWorkflows = "childWorkflows"
+
+// childWorkflowsMu guards the creation of the childWorkflows of a workflow
+var childWorkflowsMu sync.Mutex
+
+// childrenOf returns the detached children of w.
+func childrenOf(w *Workflow) *childWorkflows {
+	childWorkflowsMu.Lock()
+	defer childWorkflowsMu.Unlock()
+
+	children, ok := w.Context[contextChildWorkflows].(*childWorkflows)
+	if !ok {
+		children = &childWorkflows{children: make(map[string]*ChildWorkflow)}
+		w.Context[contextChildWorkflows] = children
+	}
+	return children
+}
+
+// SpawnWorkflow starts a child workflow on the runner executing the current
+// action, after copying the parent values of options.StoreMapping into its store.
+//
+// An inline child runs before SpawnWorkflow returns. Its mapped values are put
+// back in the parent store when it succeeds, and its failure is returned. A
+// detached child runs on the runner's worker pool; JoinWorkflow waits for it
+// and puts its mapped values back.
+func (ctx *ActionContext) SpawnWorkflow(wf *Workflow, options SpawnOptions) (*ChildWorkflow, error) {
+	if wf == nil {
+		return nil, fmt.Errorf("cannot spawn a nil workflow")
+	}
+	r, ok := ctx.Workflow.Context["runner"].(*Runner)
+	if !ok {
+		return nil, fmt.Errorf("cannot spawn workflow '%s': the workflow is not run by a Runner", wf.ID)
+	}
+
+	// Hand the mapped values over to the child; keys the parent lacks are outputs
+	for parentKey, childKey := range options.StoreMapping {
+		value, err := ctx.Store().GetValue(parentKey)
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot spawn workflow '%s': %w", wf.ID, err)
+		}
+		if err := wf.Store.Put(childKey, value); err != nil {
+			return nil, fmt.Errorf("cannot spawn workflow '%s': %w", wf.ID, err)
+		}
+	}
+
+	runOptions := r.options
+	if options.Options != nil {
+		runOptions = *options.Options
+	}
+	child := &ChildWorkflow{Workflow: wf, Handle: options.Handle, mapping: options.StoreMapping}
+	if child.Handle == "" {
+		child.Handle = wf.ID
+	}
+
+	switch options.Mode {
+	case SpawnInline:
+		if runOptions.Context == nil {
+			runOptions.Context = ctx.GoContext
+		}
+		ctx.Logger.Info("Running child workflow %s", wf.ID)
+		result := r.ExecuteWithOptions(wf, runOptions)
+		done := make(chan struct{})
+		close(done)
+		child.done = done
+		child.result = func() RunResult { return result }
+		return child, ctx.joinChild(child)
+
+	case SpawnDetached:
+		if runOptions.Context == nil {
+			runOptions.Context = context.WithoutCancel(ctx.GoContext)
+		}
+		job, err := r.SubmitWithOptions(wf, runOptions)
+		if err != nil {
+			return nil, fmt.Errorf("cannot spawn workflow '%s': %w", wf.ID, err)
+		}
+		ctx.Logger.Info("Submitted child workflow %s as %s", wf.ID, child.Handle)
+		child.done = job.Done()
+		child.result = job.Wait
+
+		children := childrenOf(ctx.Workflow)
+		children.mu.Lock()
+		children.children[child.Handle] = child
+		children.mu.Unlock()
+		return child, nil
+
+	default:
+		return nil, fmt.Errorf("cannot spawn workflow '%s': unknown spawn mode %d", wf.ID, options.Mode)
+	}
+}
+
+// ChildWorkflow returns the detached child spawned under handle by an action
+// of the workflow, if any.
+func (ctx *ActionContext) ChildWorkflow(handle string) (*ChildWorkflow, bool) {
+	children := childrenOf(ctx.Workflow)
+	children.mu.Lock()
+	defer children.mu.Unlock()
+
+	child, ok := children.children[handle]
+	return child, ok
+}
+
+// JoinWorkflow waits for the detached child spawned under handle, or until the
+// action's context is done. When the child succeeded, its mapped values are put
+// back in the parent store. It returns the child's result, and its error if it failed.
+func (ctx *ActionContext) JoinWorkflow(handle string) (RunResult, error) {
+	child, ok := ctx.ChildWorkflow(handle)
+	if !ok {
+		return RunResult{}, fmt.Errorf("no child workflow spawned as '%s'", handle)
+	}
+
+	select {
+	case <-child.Done():
+	case <-ctx.GoContext.Done():
+		return RunResult{}, fmt.Errorf("joining child workflow '%s': %w", handle, ctx.GoContext.Err())
+	}
+	return child.Wait(), ctx.joinChild(child)
+}
+
+// joinChild puts the mapped values of a finished child back in the parent
+// store, or returns the error of a failed child.
+func (ctx *ActionContext) joinChild(child *ChildWorkflow) error {
+	result := child.Wait()
+	if !result.Success {
+		return fmt.Errorf("child workflow '%s' failed: %w", child.Workflow.ID, result.Error)
+	}
+	for parentKey, childKey := range child.mapping {
+		value, err := child.Workflow.Store.GetValue(childKey)
+		if err != nil {
+			continue
+		}
+		if err := ctx.Store().Put(parentKey, value); err != nil {
+			return fmt.Errorf("child workflow '%s': %w", child.Workflow.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package gostage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/davidroman0O/gostage/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newPricingWorkflow builds a child workflow doubling the "amount" key into "total".
+func newPricingWorkflow(fail error) *Workflow {
+	wf := NewWorkflow("pricing", "Pricing", "")
+	stage := NewStage("price", "Price", "")
+	stage.AddAction(NewActionFunc("double", "", func(ctx *ActionContext) error {
+		if fail != nil {
+			return fail
+		}
+		amount, err := store.Get[int](ctx.Store(), "amount")
+		if err != nil {
+			return err
+		}
+		return ctx.Store().Put("total", amount*2)
+	}))
+	wf.AddStage(stage)
+	return wf
+}
+
+func TestSpawnWorkflowInline(t *testing.T) {
+	var child *ChildWorkflow
+	result := runSingleAction(t, context.Background(), NewActionFunc("spawn", "", func(ctx *ActionContext) error {
+		var err error
+		child, err = ctx.SpawnWorkflow(newPricingWorkflow(nil), SpawnOptions{
+			StoreMapping: map[string]string{"order.amount": "amount", "order.total": "total"},
+		})
+		return err
+	}), func(wf *Workflow) {
+		wf.Store.Put("order.amount", 21)
+	})
+
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, 42, result.FinalStore["order.total"])
+	require.NotNil(t, child)
+	assert.True(t, child.Wait().Success)
+	assert.NotEmpty(t, child.Wait().RunID)
+}
+
+func TestSpawnWorkflowInlineFailure(t *testing.T) {
+	result := runSingleAction(t, context.Background(), NewActionFunc("spawn", "", func(ctx *ActionContext) error {
+		_, err := ctx.SpawnWorkflow(newPricingWorkflow(errors.New("no price list")), SpawnOptions{})
+		return err
+	}), nil)
+
+	require.Error(t, result.Error)
+	assert.Contains(t, result.Error.Error(), "child workflow 'pricing' failed")
+	assert.Contains(t, result.Error.Error(), "no price list")
+}
+
+func TestSpawnWorkflowDetached(t *testing.T) {
+	release := make(chan struct{})
+	child := newPricingWorkflow(nil)
+	child.Stages[0].Actions = append([]Action{NewActionFunc("hold", "", func(*ActionContext) error {
+		<-release
+		return nil
+	})}, child.Stages[0].Actions...)
+
+	wf := NewWorkflow("parent", "Parent", "")
+	stage := NewStage("orchestrate", "Orchestrate", "")
+	stage.AddAction(NewActionFunc("spawn", "", func(ctx *ActionContext) error {
+		spawned, err := ctx.SpawnWorkflow(child, SpawnOptions{
+			Mode:         SpawnDetached,
+			Handle:       "pricing-run",
+			StoreMapping: map[string]string{"order.amount": "amount", "order.total": "total"},
+		})
+		if err != nil {
+			return err
+		}
+		// The child is still held, so spawning did not wait for it
+		select {
+		case <-spawned.Done():
+			return errors.New("detached child finished before it was released")
+		default:
+		}
+		close(release)
+		return nil
+	}))
+	stage.AddAction(NewActionFunc("join", "", func(ctx *ActionContext) error {
+		result, err := ctx.JoinWorkflow("pricing-run")
+		if err != nil {
+			return err
+		}
+		return ctx.Store().Put("child.run", result.RunID)
+	}))
+	wf.AddStage(stage)
+	require.NoError(t, wf.Store.Put("order.amount", 5))
+
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, 10, result.FinalStore["order.total"])
+	assert.NotEmpty(t, result.FinalStore["child.run"])
+}
+
+func TestJoinWorkflowUnknownHandle(t *testing.T) {
+	result := runSingleAction(t, context.Background(), NewActionFunc("join", "", func(ctx *ActionContext) error {
+		_, err := ctx.JoinWorkflow("missing")
+		return err
+	}), nil)
+	assert.ErrorContains(t, result.Error, "no child workflow spawned as 'missing'")
+}
@@ -0,0 +1,232 @@
+package gostage
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned instead of executing an action whose circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is the state of a circuit of a CircuitBreaker.
+type CircuitState string
+
+// Circuit states
+const (
+	// CircuitClosed lets executions through
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen rejects executions until the cool-down period is over
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets a single trial execution through after the cool-down period
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+// CircuitStatus describes a circuit. It is written to the workflow store
+// under PrefixCircuit followed by the circuit key after every execution.
+type CircuitStatus struct {
+	Key   string       `json:"key"`
+	State CircuitState `json:"state"`
+	// Failures is the number of consecutive failures
+	Failures int `json:"failures"`
+	// OpenUntil is the end of the cool-down period of an open circuit
+	OpenUntil time.Time `json:"openUntil,omitempty"`
+}
+
+// CircuitKeyFunc returns the key of the circuit guarding an action execution.
+type CircuitKeyFunc func(ctx *ActionContext, action Action) string
+
+// CircuitBreakerOption configures a CircuitBreaker.
+type CircuitBreakerOption func(*CircuitBreaker)
+
+// WithCircuitKey groups executions into circuits by the given key instead of
+// by action name, for example to share a circuit between the actions calling
+// the same API.
+func WithCircuitKey(key CircuitKeyFunc) CircuitBreakerOption {
+	return func(b *CircuitBreaker) {
+		b.key = key
+	}
+}
+
+// circuit is the state of a single key of a CircuitBreaker.
+type circuit struct {
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	// trial reports whether the trial execution of a half-open circuit is running
+	trial bool
+}
+
+// CircuitBreaker stops executing actions that keep failing. A circuit trips
+// open after a number of consecutive failures and rejects executions with
+// ErrCircuitOpen for a cool-down period. It then lets one trial execution
+// through: success closes the circuit, failure opens it again. The state is
+// kept by the breaker, so it spans every run of the runners using it.
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	key       CircuitKeyFunc
+	circuits  map[string]*circuit
+	listeners []func(key string, from, to CircuitState)
+}
+
+// NewCircuitBreaker creates a circuit breaker tripping after threshold
+// consecutive failures and staying open for cooldown. Attach it to a runner
+// with UseActionMiddleware(breaker.Middleware()).
+func NewCircuitBreaker(threshold int, cooldown time.Duration, opts ...CircuitBreakerOption) *CircuitBreaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	b := &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		key: func(ctx *ActionContext, action Action) string {
+			return action.Name()
+		},
+		circuits: make(map[string]*circuit),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// OnStateChange registers a function called whenever a circuit changes state.
+func (b *CircuitBreaker) OnStateChange(fn func(key string, from, to CircuitState)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.listeners = append(b.listeners, fn)
+}
+
+// Middleware returns action middleware guarding executions with the breaker.
+func (b *CircuitBreaker) Middleware() ActionMiddleware {
+	return func(next ActionRunnerFunc) ActionRunnerFunc {
+		return func(ctx *ActionContext, action Action, index int, isLast bool) error {
+			key := b.key(ctx, action)
+			if err := b.allow(key, ctx.Now()); err != nil {
+				b.publish(ctx, key)
+				return err
+			}
+
+			err := next(ctx, action, index, isLast)
+			b.record(key, err, ctx.Now())
+			b.publish(ctx, key)
+			return err
+		}
+	}
+}
+
+// Status returns the status of a circuit. Unknown keys are closed.
+func (b *CircuitBreaker) Status(key string) CircuitStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := CircuitStatus{Key: key, State: CircuitClosed}
+	if c, ok := b.circuits[key]; ok {
+		status.State = c.state
+		status.Failures = c.failures
+		if c.state == CircuitOpen {
+			status.OpenUntil = c.openedAt.Add(b.cooldown)
+		}
+	}
+	return status
+}
+
+// Reset closes a circuit and clears its failures.
+func (b *CircuitBreaker) Reset(key string) {
+	b.mu.Lock()
+	c, ok := b.circuits[key]
+	delete(b.circuits, key)
+	b.mu.Unlock()
+
+	if ok && c.state != CircuitClosed {
+		b.notify(key, c.state, CircuitClosed)
+	}
+}
+
+// allow reports whether an execution may go through the circuit at now.
+func (b *CircuitBreaker) allow(key string, now time.Time) error {
+	b.mu.Lock()
+	c := b.circuit(key)
+	from := c.state
+	switch c.state {
+	case CircuitOpen:
+		openUntil := c.openedAt.Add(b.cooldown)
+		if now.Before(openUntil) {
+			b.mu.Unlock()
+			return fmt.Errorf("%w for '%s' until %s", ErrCircuitOpen, key, openUntil.Format(time.RFC3339))
+		}
+		c.state = CircuitHalfOpen
+		c.trial = true
+	case CircuitHalfOpen:
+		if c.trial {
+			b.mu.Unlock()
+			return fmt.Errorf("%w for '%s' while a trial execution is running", ErrCircuitOpen, key)
+		}
+		c.trial = true
+	}
+	to := c.state
+	b.mu.Unlock()
+
+	if from != to {
+		b.notify(key, from, to)
+	}
+	return nil
+}
+
+// record updates the circuit with the outcome of an execution finished at now.
+func (b *CircuitBreaker) record(key string, err error, now time.Time) {
+	b.mu.Lock()
+	c := b.circuit(key)
+	from := c.state
+	c.trial = false
+	if err == nil {
+		c.failures = 0
+		c.state = CircuitClosed
+	} else {
+		c.failures++
+		if c.state == CircuitHalfOpen || c.failures >= b.threshold {
+			c.state = CircuitOpen
+			c.openedAt = now
+		}
+	}
+	to := c.state
+	b.mu.Unlock()
+
+	if from != to {
+		b.notify(key, from, to)
+	}
+}
+
+// circuit returns the circuit of a key, creating it closed. The lock must be held.
+func (b *CircuitBreaker) circuit(key string) *circuit {
+	c, ok := b.circuits[key]
+	if !ok {
+		c = &circuit{state: CircuitClosed}
+		b.circuits[key] = c
+	}
+	return c
+}
+
+// notify calls the state change listeners.
+func (b *CircuitBreaker) notify(key string, from, to CircuitState) {
+	b.mu.Lock()
+	listeners := append([]func(string, CircuitState, CircuitState){}, b.listeners...)
+	b.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener(key, from, to)
+	}
+}
+
+// publish writes the status of a circuit to the workflow store.
+func (b *CircuitBreaker) publish(ctx *ActionContext, key string) {
+	if ctx.Workflow == nil || ctx.Workflow.Store == nil {
+		return
+	}
+	if err := ctx.Workflow.Store.Put(PrefixCircuit+key, b.Status(key)); err != nil {
+		ctx.Logger.Warn("Failed to record circuit breaker status of '%s': %v", key, err)
+	}
+}
@@ -0,0 +1,113 @@
+package gostage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/davidroman0O/gostage/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	breaker := NewCircuitBreaker(2, 50*time.Millisecond)
+	var changes []string
+	breaker.OnStateChange(func(key string, from, to CircuitState) {
+		changes = append(changes, key+": "+string(from)+" -> "+string(to))
+	})
+	runner := NewRunner()
+	runner.UseActionMiddleware(breaker.Middleware())
+
+	errUnavailable := errors.New("service unavailable")
+	failing := true
+	calls := 0
+	newWorkflow := func() *Workflow {
+		wf := NewWorkflow("sync", "Sync", "")
+		stage := NewStage("pull", "Pull", "")
+		stage.AddAction(NewActionFunc("fetch", "", func(ctx *ActionContext) error {
+			calls++
+			if failing {
+				return errUnavailable
+			}
+			return nil
+		}))
+		wf.AddStage(stage)
+		return wf
+	}
+	run := func() RunResult {
+		return runner.ExecuteWithOptions(newWorkflow(), DefaultRunOptions())
+	}
+
+	// Failures are counted across runs until the circuit trips
+	assert.ErrorIs(t, run().Error, errUnavailable)
+	assert.Equal(t, CircuitClosed, breaker.Status("fetch").State)
+	assert.ErrorIs(t, run().Error, errUnavailable)
+	assert.Equal(t, CircuitOpen, breaker.Status("fetch").State)
+
+	// An open circuit short-circuits the action and records its status in the store
+	result := run()
+	assert.ErrorIs(t, result.Error, ErrCircuitOpen)
+	assert.Equal(t, 2, calls)
+	status, ok := result.FinalStore[PrefixCircuit+"fetch"].(CircuitStatus)
+	require.True(t, ok)
+	assert.Equal(t, CircuitOpen, status.State)
+	assert.Equal(t, 2, status.Failures)
+	assert.False(t, status.OpenUntil.IsZero())
+
+	// After the cool-down a failed trial opens the circuit again
+	time.Sleep(60 * time.Millisecond)
+	assert.ErrorIs(t, run().Error, errUnavailable)
+	assert.Equal(t, 3, calls)
+	assert.ErrorIs(t, run().Error, ErrCircuitOpen)
+
+	// A successful trial closes it
+	time.Sleep(60 * time.Millisecond)
+	failing = false
+	wf := newWorkflow()
+	require.True(t, runner.ExecuteWithOptions(wf, DefaultRunOptions()).Success)
+	status, err := store.Get[CircuitStatus](wf.Store, PrefixCircuit+"fetch")
+	require.NoError(t, err)
+	assert.Equal(t, CircuitStatus{Key: "fetch", State: CircuitClosed}, status)
+
+	assert.Equal(t, []string{
+		"fetch: closed -> open",
+		"fetch: open -> half-open",
+		"fetch: half-open -> open",
+		"fetch: open -> half-open",
+		"fetch: half-open -> closed",
+	}, changes)
+}
+
+func TestCircuitBreakerKey(t *testing.T) {
+	breaker := NewCircuitBreaker(1, time.Hour, WithCircuitKey(func(ctx *ActionContext, action Action) string {
+		return "payments-api"
+	}))
+	runner := NewRunner()
+	runner.UseActionMiddleware(breaker.Middleware())
+
+	wf := NewWorkflow("billing", "Billing", "")
+	stage := NewStage("charge", "Charge", "")
+	stage.AddAction(NewActionFunc("authorize", "", func(ctx *ActionContext) error { return errors.New("timeout") }))
+	wf.AddStage(stage)
+	require.Error(t, runner.Execute(context.Background(), wf, NewDefaultLogger()))
+
+	// Actions sharing the key share the circuit
+	captured := false
+	wf = NewWorkflow("billing", "Billing", "")
+	stage = NewStage("charge", "Charge", "")
+	stage.AddAction(NewActionFunc("capture", "", func(ctx *ActionContext) error {
+		captured = true
+		return nil
+	}))
+	wf.AddStage(stage)
+	err := runner.Execute(context.Background(), wf, NewDefaultLogger())
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.ErrorContains(t, err, "circuit breaker is open for 'payments-api' until")
+	assert.False(t, captured)
+
+	breaker.Reset("payments-api")
+	require.NoError(t, runner.Execute(context.Background(), wf, NewDefaultLogger()))
+	assert.True(t, captured)
+}
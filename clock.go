@@ -0,0 +1,148 @@
+package gostage
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock tells the runner the time and measures its waits: WaitAction and
+// PollAction, loop intervals and timeouts, approval timeouts, hedging delays,
+// the watchdog, delayed runs and schedules. Tests replace the system clock
+// with a fake one, such as gostagetest.FakeClock, to run them instantly.
+type Clock interface {
+	Now() time.Time
+	// NewTimer creates a timer sending the time on its channel once d has
+	// passed on the clock
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a single event of a Clock.
+type Timer interface {
+	// C returns the channel the time is sent on when the timer fires
+	C() <-chan time.Time
+	// Stop prevents the timer from firing. It returns false if the timer
+	// already fired or was stopped.
+	Stop() bool
+}
+
+// systemClock is the Clock of the system time.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) NewTimer(d time.Duration) Timer { return systemTimer{time.NewTimer(d)} }
+
+// systemTimer adapts a time.Timer to Timer.
+type systemTimer struct{ timer *time.Timer }
+
+func (t systemTimer) C() <-chan time.Time { return t.timer.C }
+
+func (t systemTimer) Stop() bool { return t.timer.Stop() }
+
+// SystemClock returns the Clock of the system time, used by runners without WithClock.
+func SystemClock() Clock {
+	return systemClock{}
+}
+
+// WithClock makes the runner tell the time with clock instead of the system clock.
+func WithClock(clock Clock) RunnerOption {
+	return func(r *Runner) {
+		r.clock = clock
+	}
+}
+
+// Clock returns the clock of the runner.
+func (r *Runner) Clock() Clock {
+	if r.clock == nil {
+		return systemClock{}
+	}
+	return r.clock
+}
+
+// now returns the time of the runner's clock.
+func (r *Runner) now() time.Time {
+	return r.Clock().Now()
+}
+
+// Clock returns the clock of the runner executing the workflow, or the system
+// clock when the workflow is not run by a Runner.
+func (ctx *ActionContext) Clock() Clock {
+	if ctx.Workflow != nil {
+		if r, ok := ctx.Workflow.Context["runner"].(*Runner); ok {
+			return r.Clock()
+		}
+	}
+	return systemClock{}
+}
+
+// Now returns the time of the clock of the runner executing the workflow.
+// Actions use it rather than time.Now so that tests can control the time they see.
+func (ctx *ActionContext) Now() time.Time {
+	return ctx.Clock().Now()
+}
+
+// Sleep waits for d on the clock of the runner, as retry middleware does
+// between attempts. It returns the context's error early if the run is cancelled.
+func (ctx *ActionContext) Sleep(d time.Duration) error {
+	timer := ctx.Clock().NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+		return nil
+	case <-actionDone(ctx):
+		return ctx.GoContext.Err()
+	}
+}
+
+// withClockTimeout returns a copy of parent cancelled with the cause
+// context.DeadlineExceeded once timeout has passed on clock.
+func withClockTimeout(parent context.Context, clock Clock, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := clock.(systemClock); ok {
+		return context.WithTimeout(parent, timeout)
+	}
+
+	ctx, cancel := context.WithCancelCause(parent)
+	timer := clock.NewTimer(timeout)
+	go func() {
+		select {
+		case <-timer.C():
+			cancel(context.DeadlineExceeded)
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}()
+	return ctx, func() { cancel(context.Canceled) }
+}
+
+// afterFunc calls f in its own goroutine once d has passed on clock, unless
+// the returned timer is stopped first.
+func afterFunc(clock Clock, d time.Duration, f func()) Timer {
+	if _, ok := clock.(systemClock); ok {
+		return systemTimer{time.AfterFunc(d, f)}
+	}
+
+	t := &funcTimer{Timer: clock.NewTimer(d), stopped: make(chan struct{})}
+	go func() {
+		select {
+		case <-t.Timer.C():
+			f()
+		case <-t.stopped:
+		}
+	}()
+	return t
+}
+
+// funcTimer is a timer of afterFunc.
+type funcTimer struct {
+	Timer
+	stopped chan struct{}
+	once    sync.Once
+}
+
+func (t *funcTimer) Stop() bool {
+	stopped := t.Timer.Stop()
+	t.once.Do(func() { close(t.stopped) })
+	return stopped
+}
@@ -0,0 +1,132 @@
+package gostage
+
+import (
+	"reflect"
+
+	"github.com/davidroman0O/gostage/store"
+)
+
+// Cloner is implemented by actions that know how to copy themselves, for
+// example because they hold channels, mutexes or other state that must not
+// be copied field by field.
+type Cloner interface {
+	// Clone returns a copy of the action that shares no state with it
+	Clone() Action
+}
+
+// CloneAction returns a copy of action to be used in another stage or
+// workflow. Actions implementing Cloner copy themselves. Other actions
+// implemented as pointers to structs are copied field by field, with their
+// tags, registry parameters and embedded actions copied too so that changing
+// the copy does not change the original. Any other field still points to the
+// same values as the original, so actions holding state of their own should
+// implement Cloner. Actions of other kinds are returned as they are.
+func CloneAction(action Action) Action {
+	if action == nil {
+		return nil
+	}
+	if cloner, ok := action.(Cloner); ok {
+		return cloner.Clone()
+	}
+
+	val := reflect.ValueOf(action)
+	if val.Kind() != reflect.Ptr || val.IsNil() || val.Elem().Kind() != reflect.Struct {
+		return action
+	}
+	copied := reflect.New(val.Elem().Type())
+	copied.Elem().Set(val.Elem())
+	cloneFields(copied.Elem())
+
+	clone, ok := copied.Interface().(Action)
+	if !ok {
+		return action
+	}
+	return clone
+}
+
+// cloneFields replaces the BaseAction and embedded actions of a copied
+// struct with copies of their own.
+func cloneFields(val reflect.Value) {
+	typ := val.Type()
+	for i := 0; i < val.NumField(); i++ {
+		field := val.Field(i)
+		fieldType := typ.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+
+		switch {
+		case fieldType.Type == reflect.TypeOf(BaseAction{}):
+			base := field.Addr().Interface().(*BaseAction)
+			base.cloneState()
+		case fieldType.Type == reflect.TypeOf(&BaseAction{}) && !field.IsNil():
+			base := *field.Interface().(*BaseAction)
+			base.cloneState()
+			field.Set(reflect.ValueOf(&base))
+		case fieldType.Anonymous && fieldType.Type == reflect.TypeOf((*Action)(nil)).Elem() && !field.IsNil():
+			field.Set(reflect.ValueOf(CloneAction(field.Interface().(Action))))
+		}
+	}
+}
+
+// cloneState replaces the tags, params and annotations of a copied BaseAction with copies.
+func (a *BaseAction) cloneState() {
+	a.tags = append([]string{}, a.tags...)
+	a.annotations = copyAnnotations(a.annotations)
+	if a.params != nil {
+		params := make(map[string]interface{}, len(a.params))
+		for key, value := range a.params {
+			params[key] = value
+		}
+		a.params = params
+	}
+}
+
+// Clone returns a copy of the stage, to add the same stage several times, for
+// example once per environment after changing its ID. The copy has its own
+// tags, annotations, middleware list, initial data and a copy of every action
+// made with CloneAction. Stages of if and switch branches are cloned too.
+// Dynamic placements are not copied.
+func (s *Stage) Clone() *Stage {
+	clone := &Stage{
+		ID:             s.ID,
+		Name:           s.Name,
+		Description:    s.Description,
+		Actions:        make([]Action, len(s.Actions)),
+		Tags:           append([]string{}, s.Tags...),
+		initialStore:   store.NewKVStore(),
+		initialSources: append([]initialDataSource(nil), s.initialSources...),
+		middleware:     append([]StageMiddleware{}, s.middleware...),
+		limits:         s.limits,
+		mergePolicy:    s.mergePolicy,
+		dependencies:   append([]string(nil), s.dependencies...),
+		barrier:        s.barrier,
+		annotations:    copyAnnotations(s.annotations),
+		consumes:       append([]keySchema(nil), s.consumes...),
+		produces:       append([]keySchema(nil), s.produces...),
+	}
+	if s.initialStore != nil {
+		clone.initialStore = s.initialStore.Clone()
+	}
+	for i, action := range s.Actions {
+		clone.Actions[i] = CloneAction(action)
+	}
+
+	if s.loop != nil {
+		loop := *s.loop
+		clone.loop = &loop
+	}
+	if s.branches != nil {
+		branches := *s.branches
+		branches.branches = make([]StageBranch, len(s.branches.branches))
+		for i, branch := range s.branches.branches {
+			stages := make([]*Stage, len(branch.Stages))
+			for j, stage := range branch.Stages {
+				stages[j] = stage.Clone()
+			}
+			branches.branches[i] = StageBranch{Name: branch.Name, Stages: stages}
+		}
+		clone.branches = &branches
+	}
+	return clone
+}
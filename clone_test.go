@@ -0,0 +1,107 @@
+package gostage
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/davidroman0O/gostage/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// counterAction counts its runs and copies itself with a fresh counter.
+type counterAction struct {
+	BaseAction
+	runs *int
+}
+
+func (a *counterAction) Execute(ctx *ActionContext) error {
+	*a.runs++
+	return nil
+}
+
+func (a *counterAction) Clone() Action {
+	runs := 0
+	return &counterAction{BaseAction: a.BaseAction, runs: &runs}
+}
+
+// wrappedAction embeds another action like action wrappers do.
+type wrappedAction struct {
+	Action
+}
+
+func TestStageClone(t *testing.T) {
+	template := NewStageWithTags("deploy", "Deploy", "Deploys the service", []string{"deploy"})
+	require.NoError(t, template.SetInitialData("replicas", 2))
+	apply := NewActionFunc("apply", "", func(ctx *ActionContext) error {
+		env, err := store.Get[string](ctx.Store(), "env")
+		if err != nil {
+			return err
+		}
+		return ctx.Store().Put("deployed."+env, true)
+	})
+	GetActionBaseFields(apply).AddTag("kubectl")
+	template.AddAction(apply)
+
+	wf := NewWorkflow("deploy", "Deploy", "")
+	for _, env := range []string{"staging", "prod"} {
+		stage := template.Clone()
+		stage.ID = "deploy-" + env
+		stage.AddTag(env)
+		require.NoError(t, stage.SetInitialData("env", env))
+		GetActionBaseFields(stage.Actions[0]).AddTag(env)
+		wf.AddStage(stage)
+	}
+
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, true, result.FinalStore["deployed.staging"])
+	assert.Equal(t, true, result.FinalStore["deployed.prod"])
+	assert.Equal(t, 2, result.FinalStore["replicas"])
+
+	assert.Equal(t, []string{"deploy", "prod"}, wf.Stages[1].Tags)
+	assert.Equal(t, []string{"kubectl", "prod"}, wf.Stages[1].Actions[0].Tags())
+	assert.Equal(t, []string{"deploy"}, template.Tags)
+	assert.Equal(t, []string{"kubectl"}, template.Actions[0].Tags())
+	assert.NotContains(t, template.getInitialStore().ListKeys(), "env")
+	assert.NotSame(t, template.Actions[0], wf.Stages[0].Actions[0])
+}
+
+func TestCloneAction(t *testing.T) {
+	runs := 0
+	counter := &counterAction{BaseAction: NewBaseAction("count", ""), runs: &runs}
+	clone := CloneAction(counter).(*counterAction)
+	require.NoError(t, clone.Execute(nil))
+	assert.Equal(t, 0, runs)
+	assert.Equal(t, 1, *clone.runs)
+
+	inner := NewActionFunc("inner", "", nil)
+	GetActionBaseFields(inner).AddTag("a")
+	wrapped := &wrappedAction{inner}
+	wrappedClone := CloneAction(wrapped).(*wrappedAction)
+	GetActionBaseFields(wrappedClone).AddTag("b")
+	assert.Equal(t, []string{"a"}, wrapped.Tags())
+	assert.Equal(t, []string{"a", "b"}, wrappedClone.Tags())
+
+	forEach := NewForEachAction[int]("each", "items", []Action{counter})
+	forEachClone := CloneAction(forEach).(*ForEachAction[int])
+	assert.NotSame(t, counter, forEachClone.body[0])
+	assert.Equal(t, "each", forEachClone.Name())
+
+	assert.Nil(t, CloneAction(nil))
+}
+
+func TestStageCloneComposite(t *testing.T) {
+	then := NewStage("then", "Then", "")
+	stage := IfStage("check", "Check", StoreKeyExists("flag"), []*Stage{then}, nil)
+	clone := stage.Clone()
+	clone.Branches()[0].Stages[0].ID = "then-copy"
+	assert.Equal(t, "then", stage.Branches()[0].Stages[0].ID)
+
+	loop := LoopStage("loop", "Loop", "", StoreKeyExists("done"), MaxIterations(3))
+	loopClone := loop.Clone()
+	require.True(t, loopClone.IsLoop())
+	MaxIterations(5)(loopClone.loop)
+	assert.Equal(t, 3, loop.loop.maxIterations)
+	assert.Equal(t, fmt.Sprint(loop.Tags), fmt.Sprint(loopClone.Tags))
+}
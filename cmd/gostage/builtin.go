@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/davidroman0O/gostage"
+	execaction "github.com/davidroman0O/gostage/actions/exec"
+	fsaction "github.com/davidroman0O/gostage/actions/fs"
+	gitaction "github.com/davidroman0O/gostage/actions/git"
+	k8saction "github.com/davidroman0O/gostage/actions/k8s"
+	notifyaction "github.com/davidroman0O/gostage/actions/notify"
+	terraformaction "github.com/davidroman0O/gostage/actions/terraform"
+)
+
+// shellParams configures the built-in "shell" action.
+type shellParams struct {
+	// Command is run with "sh -c"
+	Command string `json:"command"`
+	// Dir is the working directory, defaulting to the current one
+	Dir string `json:"dir"`
+	// Env holds extra environment variables
+	Env map[string]string `json:"env"`
+	// Output is the store key the trimmed standard output is saved to, if set
+	Output string `json:"output"`
+}
+
+// shellAction runs a shell command.
+type shellAction struct {
+	gostage.BaseAction
+}
+
+func (a *shellAction) Execute(ctx *gostage.ActionContext) error {
+	params, err := gostage.ActionParams[shellParams](ctx)
+	if err != nil {
+		return err
+	}
+	if params.Command == "" {
+		return fmt.Errorf("shell action '%s' has no command", a.Name())
+	}
+
+	cmd := exec.CommandContext(ctx.GoContext, "sh", "-c", params.Command)
+	cmd.Dir = params.Dir
+	cmd.Env = os.Environ()
+	for key, value := range params.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	ctx.Logger.Info("Running: %s", params.Command)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("command failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	if params.Output != "" {
+		return ctx.Store().Put(params.Output, strings.TrimSpace(stdout.String()))
+	}
+	return nil
+}
+
+// setParams configures the built-in "set" action.
+type setParams struct {
+	// Values are written to the workflow store
+	Values map[string]interface{} `json:"values"`
+}
+
+// setAction writes values to the workflow store.
+type setAction struct {
+	gostage.BaseAction
+}
+
+func (a *setAction) Execute(ctx *gostage.ActionContext) error {
+	params, err := gostage.ActionParams[setParams](ctx)
+	if err != nil {
+		return err
+	}
+	for key, value := range params.Values {
+		if err := ctx.Store().Put(key, value); err != nil {
+			return fmt.Errorf("failed to set '%s': %w", key, err)
+		}
+	}
+	return nil
+}
+
+// logParams configures the built-in "log" action.
+type logParams struct {
+	Message string `json:"message"`
+}
+
+// logAction logs a message.
+type logAction struct {
+	gostage.BaseAction
+}
+
+func (a *logAction) Execute(ctx *gostage.ActionContext) error {
+	params, err := gostage.ActionParams[logParams](ctx)
+	if err != nil {
+		return err
+	}
+	ctx.Logger.Info("%s", params.Message)
+	return nil
+}
+
+// newBuiltinRegistry returns a registry with the actions available to definitions.
+func newBuiltinRegistry() *gostage.ActionRegistry {
+	registry := gostage.NewActionRegistry()
+	registry.Register("shell", func() gostage.Action {
+		return &shellAction{BaseAction: gostage.NewBaseAction("shell", "Run a shell command")}
+	})
+	registry.Register("set", func() gostage.Action {
+		return &setAction{BaseAction: gostage.NewBaseAction("set", "Write values to the store")}
+	})
+	registry.Register("log", func() gostage.Action {
+		return &logAction{BaseAction: gostage.NewBaseAction("log", "Log a message")}
+	})
+	execaction.Register(registry)
+	fsaction.Register(registry)
+	gitaction.Register(registry)
+	k8saction.Register(registry)
+	notifyaction.Register(registry)
+	terraformaction.Register(registry)
+	return registry
+}
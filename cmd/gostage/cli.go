@@ -0,0 +1,494 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/davidroman0O/gostage/definition"
+	"github.com/davidroman0O/gostage/store"
+)
+
+// Exit codes
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+const usage = `usage:
+  gostage validate <file|name>
+  gostage describe <file|name>
+  gostage plan [flags] <file|name>
+  gostage run [flags] [--profile name] <file|name>
+
+plan and run also accept the parameters of the workflow as flags, such as
+-channel stable, and list them with -h.
+`
+
+// runReport is the JSON report emitted after a run.
+type runReport struct {
+	WorkflowID string                 `json:"workflowId"`
+	Version    string                 `json:"version,omitempty"`
+	Success    bool                   `json:"success"`
+	DryRun     bool                   `json:"dryRun,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	StartedAt  time.Time              `json:"startedAt"`
+	DurationMs int64                  `json:"durationMs"`
+	Stages     map[string]string      `json:"stages"`
+	Actions    map[string]string      `json:"actions"`
+	Store      map[string]interface{} `json:"store,omitempty"`
+	StoreStats []store.KeyStats       `json:"storeStats,omitempty"`
+	// Conflicts lists the store values that stage initial data found already set
+	Conflicts []gostage.InitialDataConflict `json:"initialDataConflicts,omitempty"`
+	// Artifacts lists the artifacts attached by the actions
+	Artifacts []gostage.Artifact `json:"artifacts,omitempty"`
+
+	// Annotations of the workflow, its stages and its actions, keyed like Stages and Actions
+	Annotations       map[string]string            `json:"annotations,omitempty"`
+	StageAnnotations  map[string]map[string]string `json:"stageAnnotations,omitempty"`
+	ActionAnnotations map[string]map[string]string `json:"actionAnnotations,omitempty"`
+}
+
+// options holds the flags shared by plan and run.
+type options struct {
+	tags     listFlag
+	skipTags listFlag
+	params   paramsFlag
+	report   string
+	trace    string
+	stats    bool
+	verbose  bool
+	redact   listFlag
+	profile  string
+	profiles string
+}
+
+// profileFiles are the profile files looked up in the working directory
+// when --profile is used without --profile-file.
+var profileFiles = []string{"gostage.toml", "gostage.yaml", "gostage.yml"}
+
+// run executes the CLI and returns the process exit code.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	command := args[0]
+	var opts options
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	if command == "plan" || command == "run" {
+		fs.Var(&opts.tags, "tags", "only run stages tagged with any of these comma-separated tags")
+		fs.Var(&opts.skipTags, "skip-tags", "skip stages and actions tagged with any of these comma-separated tags")
+		fs.Var(&opts.params, "param", "workflow parameter as key=value (repeatable)")
+	}
+	if command == "run" {
+		fs.StringVar(&opts.report, "report", "", "write the JSON run report to this file instead of stdout")
+		fs.StringVar(&opts.trace, "trace", "", "write the run timeline to this file in the Chrome trace event format")
+		fs.BoolVar(&opts.stats, "store-stats", false, "include the reads and writes of each store key in the report")
+		fs.BoolVar(&opts.verbose, "v", false, "log debug messages")
+		fs.Var(&opts.redact, "redact", "mask the values of store keys matching these comma-separated patterns in logs and the report")
+		fs.StringVar(&opts.profile, "profile", "", "apply the run settings of this named profile")
+		fs.StringVar(&opts.profiles, "profile-file", "", "read profiles from this TOML or YAML file instead of gostage.toml or gostage.yaml")
+	}
+
+	switch command {
+	case "validate", "describe", "plan", "run":
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n%s", command, usage)
+		return exitUsage
+	}
+
+	// The workflow is the last argument. Its parameters are defined as flags
+	// before parsing, and errors building it are reported once parsed.
+	if (command == "plan" || command == "run") && len(args) > 1 {
+		if wf, err := buildWorkflow(args[len(args)-1]); err == nil {
+			wf.DefineParamFlags(fs)
+		}
+	}
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return exitUsage
+	}
+	for name, value := range gostage.ParamFlagValues(fs) {
+		if opts.params == nil {
+			opts.params = make(paramsFlag)
+		}
+		opts.params[name] = value
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	if command == "describe" {
+		return describe(fs.Arg(0), stdout, stderr)
+	}
+
+	profile, err := loadProfile(opts)
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitFailure
+	}
+
+	wf, err := loadWorkflow(fs.Arg(0), opts)
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitFailure
+	}
+
+	switch command {
+	case "validate":
+		fmt.Fprintf(stdout, "%s: ok\n", fs.Arg(0))
+		return exitOK
+	case "plan":
+		printPlan(stdout, wf)
+		return exitOK
+	}
+
+	return execute(wf, opts, profile, stdout, stderr)
+}
+
+// loadProfile reads the profile selected with --profile, if any.
+func loadProfile(opts options) (gostage.RunProfile, error) {
+	if opts.profile == "" {
+		if opts.profiles != "" {
+			return gostage.RunProfile{}, errors.New("--profile-file requires --profile")
+		}
+		return gostage.RunProfile{}, nil
+	}
+
+	path := opts.profiles
+	if path == "" {
+		for _, name := range profileFiles {
+			if _, err := os.Stat(name); err == nil {
+				path = name
+				break
+			}
+		}
+		if path == "" {
+			return gostage.RunProfile{}, fmt.Errorf("no profile file found, expected one of %s", strings.Join(profileFiles, ", "))
+		}
+	}
+	return gostage.LoadRunProfile(path, opts.profile)
+}
+
+// loadWorkflow builds the workflow at path, applying parameters and tag filters.
+// When no file exists at path, it is looked up by name in the default
+// workflow registry, which programs embedding the CLI fill with RegisterWorkflow.
+func loadWorkflow(path string, opts options) (*gostage.Workflow, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) && gostage.DefaultWorkflowRegistry().Has(path) {
+		wf, err := gostage.DefaultWorkflowRegistry().Build(path, opts.params)
+		if err != nil {
+			return nil, err
+		}
+		applyTagFilters(wf, opts.tags, opts.skipTags)
+		return wf, nil
+	}
+
+	doc, err := definition.ParseFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	wf, err := doc.BuildWithRegistry(newBuiltinRegistry())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := wf.Instantiate(opts.params); err != nil {
+		return nil, err
+	}
+
+	applyTagFilters(wf, opts.tags, opts.skipTags)
+	return wf, nil
+}
+
+// buildWorkflow builds the workflow at path, or registered under that name,
+// without instantiating its parameters.
+func buildWorkflow(path string) (*gostage.Workflow, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) && gostage.DefaultWorkflowRegistry().Has(path) {
+		builder, _ := gostage.DefaultWorkflowRegistry().Builder(path)
+		wf, err := builder()
+		if err == nil && wf == nil {
+			err = fmt.Errorf("builder of workflow '%s' returned nil", path)
+		}
+		return wf, err
+	}
+	doc, err := definition.ParseFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return doc.BuildWithRegistry(newBuiltinRegistry())
+}
+
+// describe writes the JSON description of the workflow at path, or registered
+// under that name, without instantiating its parameters.
+func describe(path string, stdout, stderr io.Writer) int {
+	wf, err := buildWorkflow(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitFailure
+	}
+
+	data, err := json.MarshalIndent(wf.Describe(), "", "  ")
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitFailure
+	}
+	fmt.Fprintln(stdout, string(data))
+	return exitOK
+}
+
+// applyTagFilters disables the stages and actions excluded by the tag filters.
+func applyTagFilters(wf *gostage.Workflow, tags, skipTags []string) {
+	for _, stage := range wf.Stages {
+		if len(tags) > 0 && !stage.HasAnyTag(tags) {
+			wf.DisableStage(stage.ID)
+		}
+		if len(skipTags) > 0 && stage.HasAnyTag(skipTags) {
+			wf.DisableStage(stage.ID)
+		}
+
+		for _, action := range stage.Actions {
+			for _, tag := range skipTags {
+				if hasTag(action.Tags(), tag) {
+					wf.DisableAction(action.Name())
+					break
+				}
+			}
+		}
+	}
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// printPlan writes the stages and actions that a run would execute.
+func printPlan(w io.Writer, wf *gostage.Workflow) {
+	fmt.Fprintf(w, "workflow %s", wf.ID)
+	if wf.Version != "" {
+		fmt.Fprintf(w, " (version %s)", wf.Version)
+	}
+	fmt.Fprintln(w)
+
+	for i, stage := range wf.Stages {
+		fmt.Fprintf(w, "%d. %s%s%s\n", i+1, stage.ID, formatTags(stage.Tags), formatSkipped(!wf.IsStageEnabled(stage.ID)))
+		for _, action := range stage.Actions {
+			fmt.Fprintf(w, "   - %s%s%s\n", action.Name(), formatTags(action.Tags()), formatSkipped(!wf.IsActionEnabled(action.Name())))
+		}
+	}
+}
+
+func formatTags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	return " [" + strings.Join(tags, ", ") + "]"
+}
+
+func formatSkipped(skipped bool) string {
+	if skipped {
+		return " (skipped)"
+	}
+	return ""
+}
+
+// execute runs the workflow with the settings of the profile and writes the
+// JSON run report. The -v flag wins over the log level of the profile.
+func execute(wf *gostage.Workflow, opts options, profile gostage.RunProfile, stdout, stderr io.Writer) int {
+	if opts.verbose {
+		profile.LogLevel = gostage.LogLevelDebug
+	}
+	logger := &writerLogger{w: stderr, verbose: strings.EqualFold(profile.LogLevel, gostage.LogLevelDebug)}
+	startedAt := time.Now()
+
+	redactor := gostage.NewRedactor().DenyKeys(opts.redact...)
+	runner := gostage.NewRunner(append(profile.RunnerOptions(), gostage.WithLogger(logger), gostage.WithRedactor(redactor))...)
+	result := runner.ExecuteWithOptions(wf, profile.Apply(gostage.RunOptions{
+		Logger:     logger,
+		Context:    context.Background(),
+		Trace:      opts.trace != "",
+		StoreStats: opts.stats,
+	}))
+
+	if opts.trace != "" {
+		data, err := json.Marshal(result.Trace)
+		if err == nil {
+			err = os.WriteFile(opts.trace, data, 0644)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "error: failed to write run trace: %v\n", err)
+			return exitFailure
+		}
+	}
+
+	report := runReport{
+		WorkflowID: wf.ID,
+		Version:    wf.Version,
+		Success:    result.Success,
+		DryRun:     profile.DryRun,
+		StartedAt:  startedAt,
+		DurationMs: result.ExecutionTime.Milliseconds(),
+		Stages:     result.StageStatuses,
+		Actions:    result.ActionStatuses,
+		Store:      userData(result.FinalStore),
+		StoreStats: result.StoreStats,
+		Conflicts:  result.InitialDataConflicts,
+		Artifacts:  result.Artifacts,
+
+		Annotations: wf.Annotations(),
+	}
+	collectAnnotations(&report, wf.Stages)
+	if result.Error != nil {
+		report.Error = result.Error.Error()
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		fmt.Fprintf(stderr, "error: failed to encode run report: %v\n", err)
+		return exitFailure
+	}
+
+	if opts.report != "" {
+		if err := os.WriteFile(opts.report, append(data, '\n'), 0644); err != nil {
+			fmt.Fprintf(stderr, "error: failed to write run report: %v\n", err)
+			return exitFailure
+		}
+	} else {
+		fmt.Fprintln(stdout, string(data))
+	}
+
+	if !result.Success {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// collectAnnotations adds the annotations of the stages and their actions to
+// the report, including the stages of if and switch branches.
+func collectAnnotations(report *runReport, stages []*gostage.Stage) {
+	for _, stage := range stages {
+		if annotations := stage.Annotations(); annotations != nil {
+			if report.StageAnnotations == nil {
+				report.StageAnnotations = make(map[string]map[string]string)
+			}
+			report.StageAnnotations[stage.ID] = annotations
+		}
+		for _, action := range stage.Actions {
+			if annotations := gostage.ActionAnnotations(action); annotations != nil {
+				if report.ActionAnnotations == nil {
+					report.ActionAnnotations = make(map[string]map[string]string)
+				}
+				report.ActionAnnotations[gostage.ActionStatusKey(stage.ID, action.Name())] = annotations
+			}
+		}
+		for _, branch := range stage.Branches() {
+			collectAnnotations(report, branch.Stages)
+		}
+	}
+}
+
+// userData drops the keys managed by gostage itself from the final store.
+func userData(data map[string]interface{}) map[string]interface{} {
+	prefixes := []string{gostage.PrefixWorkflow, gostage.PrefixStage, gostage.PrefixAction, gostage.PrefixParam, gostage.PrefixTemp}
+	out := make(map[string]interface{})
+
+	for key, value := range data {
+		system := false
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key, prefix) {
+				system = true
+				break
+			}
+		}
+		if !system {
+			out[key] = value
+		}
+	}
+	return out
+}
+
+// listFlag is a comma-separated list flag.
+type listFlag []string
+
+func (f *listFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *listFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*f = append(*f, item)
+		}
+	}
+	return nil
+}
+
+// paramsFlag collects key=value workflow parameters.
+// Values are decoded as JSON when possible and kept as strings otherwise.
+type paramsFlag map[string]interface{}
+
+func (f *paramsFlag) String() string {
+	return fmt.Sprint(map[string]interface{}(*f))
+}
+
+func (f *paramsFlag) Set(value string) error {
+	key, raw, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return errors.New("expected key=value")
+	}
+	if *f == nil {
+		*f = make(paramsFlag)
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(raw), &decoded); err != nil {
+		decoded = raw
+	}
+	(*f)[key] = decoded
+	return nil
+}
+
+// writerLogger writes log lines to a writer.
+type writerLogger struct {
+	w       io.Writer
+	verbose bool
+}
+
+func (l *writerLogger) Debug(format string, args ...interface{}) {
+	if l.verbose {
+		l.log("DEBUG", format, args...)
+	}
+}
+
+func (l *writerLogger) Info(format string, args ...interface{}) {
+	l.log("INFO", format, args...)
+}
+
+func (l *writerLogger) Warn(format string, args ...interface{}) {
+	l.log("WARN", format, args...)
+}
+
+func (l *writerLogger) Error(format string, args ...interface{}) {
+	l.log("ERROR", format, args...)
+}
+
+func (l *writerLogger) log(level, format string, args ...interface{}) {
+	fmt.Fprintf(l.w, "[%s] %s\n", level, fmt.Sprintf(format, args...))
+}
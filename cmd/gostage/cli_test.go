@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/davidroman0O/gostage/definition"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDefinition = `
+id: release
+version: "3"
+annotations:
+  owner: release-team
+params:
+  - name: channel
+    default: beta
+stages:
+  - id: build
+    tags: [ci]
+    actions:
+      - action: shell
+        name: describe
+        params:
+          command: echo built for {{ .store.channel }}
+          output: summary
+  - id: publish
+    tags: [deploy]
+    annotations:
+      owner: team-x
+    actions:
+      - action: set
+        name: mark
+        params:
+          values:
+            published: true
+      - action: log
+        name: announce
+        tags: [noisy]
+        annotations:
+          runbook: https://runbooks.example.com/announce
+        params:
+          message: published {{ .store.summary }}
+`
+
+func writeDefinition(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "workflow.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestValidateCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	path := writeDefinition(t, testDefinition)
+
+	assert.Equal(t, exitOK, run([]string{"validate", path}, &stdout, &stderr))
+	assert.Contains(t, stdout.String(), "ok")
+
+	bad := writeDefinition(t, "id: broken\nstages:\n  - id: s\n    actions:\n      - action: missing\n")
+	stderr.Reset()
+	assert.Equal(t, exitFailure, run([]string{"validate", bad}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "action with id 'missing' not found")
+
+	assert.Equal(t, exitUsage, run([]string{"deploy", path}, &stdout, &stderr))
+	assert.Equal(t, exitUsage, run(nil, &stdout, &stderr))
+}
+
+func TestPlanCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	path := writeDefinition(t, testDefinition)
+
+	code := run([]string{"plan", "-tags", "deploy", "-skip-tags", "noisy", path}, &stdout, &stderr)
+	require.Equal(t, exitOK, code, stderr.String())
+
+	assert.Equal(t, `workflow release (version 3)
+1. build [ci] (skipped)
+   - describe
+2. publish [deploy]
+   - mark
+   - announce [noisy] (skipped)
+`, stdout.String())
+}
+
+func TestDescribeCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	path := writeDefinition(t, testDefinition)
+
+	code := run([]string{"describe", path}, &stdout, &stderr)
+	require.Equal(t, exitOK, code, stderr.String())
+
+	var description gostage.WorkflowDescription
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &description))
+	assert.Equal(t, "release", description.ID)
+	assert.Equal(t, []gostage.ParamDescription{{Name: "channel", Type: "string", ParamType: gostage.ParamString, Default: "beta"}}, description.Params)
+	require.Len(t, description.Stages, 2)
+	assert.Equal(t, "build", description.Stages[0].ID)
+	assert.Equal(t, []string{"mark", "announce"}, []string{description.Stages[1].Actions[0].Name, description.Stages[1].Actions[1].Name})
+}
+
+func TestRunCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	path := writeDefinition(t, testDefinition)
+	reportPath := filepath.Join(t.TempDir(), "report.json")
+
+	code := run([]string{"run", "-param", "channel=stable", "-report", reportPath, path}, &stdout, &stderr)
+	require.Equal(t, exitOK, code, stderr.String())
+	assert.Contains(t, stderr.String(), "published built for stable")
+
+	data, err := os.ReadFile(reportPath)
+	require.NoError(t, err)
+	var report runReport
+	require.NoError(t, json.Unmarshal(data, &report))
+
+	assert.True(t, report.Success)
+	assert.Equal(t, "3", report.Version)
+	assert.Equal(t, gostage.StatusCompleted, report.Stages["publish"])
+	assert.Equal(t, gostage.StatusCompleted, report.Actions[gostage.ActionStatusKey("build", "describe")])
+	assert.Equal(t, "built for stable", report.Store["summary"])
+	assert.Equal(t, true, report.Store["published"])
+	assert.Equal(t, map[string]string{"owner": "release-team"}, report.Annotations)
+	assert.Equal(t, map[string]map[string]string{"publish": {"owner": "team-x"}}, report.StageAnnotations)
+	assert.Equal(t, "https://runbooks.example.com/announce", report.ActionAnnotations[gostage.ActionStatusKey("publish", "announce")]["runbook"])
+}
+
+func TestRunCommandByName(t *testing.T) {
+	doc, err := definition.Parse([]byte(testDefinition))
+	require.NoError(t, err)
+	gostage.RegisterWorkflow("test-release", func() (*gostage.Workflow, error) {
+		return doc.BuildWithRegistry(newBuiltinRegistry())
+	})
+
+	var stdout, stderr bytes.Buffer
+	reportPath := filepath.Join(t.TempDir(), "report.json")
+	code := run([]string{"run", "-param", "channel=stable", "-report", reportPath, "test-release"}, &stdout, &stderr)
+	require.Equal(t, exitOK, code, stderr.String())
+	assert.Contains(t, stderr.String(), "published built for stable")
+
+	code = run([]string{"validate", "unknown-release"}, &stdout, &stderr)
+	assert.Equal(t, exitFailure, code)
+}
+
+func TestRunCommandParamFlags(t *testing.T) {
+	path := writeDefinition(t, `
+id: scale
+params:
+  - name: replicas
+    description: number of replicas
+    type: int
+    required: true
+  - name: channel
+    default: beta
+stages:
+  - id: scale
+    actions:
+      - action: log
+        name: announce
+        params:
+          message: "{{ .store.replicas }} replicas on {{ .store.channel }}"
+`)
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"run", "-replicas", "3", "-channel", "stable", path}, &stdout, &stderr)
+	require.Equal(t, exitOK, code, stderr.String())
+	assert.Contains(t, stderr.String(), "3 replicas on stable")
+
+	stderr.Reset()
+	assert.Equal(t, exitUsage, run([]string{"run", "-replicas", "many", path}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), `invalid value "many" for flag -replicas: expected int`)
+
+	stderr.Reset()
+	assert.Equal(t, exitFailure, run([]string{"run", path}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "missing required parameters: replicas")
+
+	stderr.Reset()
+	assert.Equal(t, exitUsage, run([]string{"plan", "-h", path}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "-replicas int")
+	assert.Contains(t, stderr.String(), "number of replicas (int, required)")
+	assert.Contains(t, stderr.String(), "(default beta)")
+}
+
+func TestRunCommandTrace(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	path := writeDefinition(t, testDefinition)
+	tracePath := filepath.Join(t.TempDir(), "trace.json")
+
+	code := run([]string{"run", "-param", "channel=stable", "-trace", tracePath, path}, &stdout, &stderr)
+	require.Equal(t, exitOK, code, stderr.String())
+
+	data, err := os.ReadFile(tracePath)
+	require.NoError(t, err)
+	var trace gostage.Trace
+	require.NoError(t, json.Unmarshal(data, &trace))
+
+	var slices []string
+	for _, event := range trace.TraceEvents {
+		if event.Phase == "X" {
+			slices = append(slices, event.Category+":"+event.Name)
+		}
+	}
+	assert.Contains(t, slices, "workflow:release")
+	assert.Contains(t, slices, "stage:publish")
+	assert.Contains(t, slices, "action:mark")
+}
+
+func TestRunCommandStoreStats(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	path := writeDefinition(t, testDefinition)
+
+	code := run([]string{"run", "-store-stats", path}, &stdout, &stderr)
+	require.Equal(t, exitOK, code, stderr.String())
+
+	var report runReport
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &report))
+	keys := map[string]bool{}
+	for _, stats := range report.StoreStats {
+		keys[stats.Key] = true
+	}
+	assert.True(t, keys["summary"], "%v", report.StoreStats)
+	assert.True(t, keys["published"], "%v", report.StoreStats)
+}
+
+func TestRunCommandFailure(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	path := writeDefinition(t, "id: failing\nstages:\n  - id: s\n    actions:\n      - action: shell\n        params:\n          command: exit 3\n")
+
+	assert.Equal(t, exitFailure, run([]string{"run", path}, &stdout, &stderr))
+
+	var report runReport
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &report))
+	assert.False(t, report.Success)
+	assert.Contains(t, report.Error, "command failed")
+	assert.Equal(t, gostage.StatusFailed, report.Stages["s"])
+}
+
+func TestRunCommandRedact(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	path := writeDefinition(t, testDefinition)
+
+	code := run([]string{"run", "-param", "channel=stable", "-redact", "chan*", path}, &stdout, &stderr)
+	require.Equal(t, exitOK, code, stderr.String())
+	assert.Contains(t, stderr.String(), "published built for [REDACTED]")
+	assert.NotContains(t, stderr.String(), "stable")
+
+	var report runReport
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &report))
+	assert.Equal(t, gostage.DefaultRedactionMask, report.Store["channel"])
+	assert.Equal(t, "built for [REDACTED]", report.Store["summary"])
+}
+
+func TestRunCommandReportsInitialDataConflicts(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	path := writeDefinition(t, `
+id: conflicts
+params:
+  - name: channel
+    default: beta
+stages:
+  - id: pin
+    initialData:
+      channel: stable
+    actions:
+      - action: log
+        params:
+          message: releasing to {{ .store.channel }}
+  - id: guard
+    merge: errorOnConflict
+    initialData:
+      channel: canary
+    actions:
+      - action: log
+        params:
+          message: unreachable
+`)
+
+	code := run([]string{"run", "-redact", "chan*", path}, &stdout, &stderr)
+	require.Equal(t, exitFailure, code, stderr.String())
+	assert.Contains(t, stderr.String(), "overrides store key 'channel'")
+
+	var report runReport
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &report))
+	assert.Contains(t, report.Error, "stage 'guard': initial data conflicts with the workflow store: 'channel'")
+	require.Len(t, report.Conflicts, 2)
+	assert.Equal(t, gostage.InitialDataConflict{
+		StageID: "pin", Key: "channel", Existing: gostage.DefaultRedactionMask, Initial: gostage.DefaultRedactionMask, Policy: gostage.MergeOverride,
+	}, report.Conflicts[0])
+	assert.Equal(t, "guard", report.Conflicts[1].StageID)
+	assert.Equal(t, gostage.MergeErrorOnConflict, report.Conflicts[1].Policy)
+}
+
+func TestRunCommandProfile(t *testing.T) {
+	path := writeDefinition(t, testDefinition)
+	profiles := filepath.Join(t.TempDir(), "profiles.toml")
+	require.NoError(t, os.WriteFile(profiles, []byte(`
+[profiles.ci]
+skipTags = ["noisy"]
+logLevel = "warn"
+timeout = "1m"
+
+[profiles.preview]
+dryRun = true
+`), 0644))
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"run", "-profile", "ci", "-profile-file", profiles, path}, &stdout, &stderr)
+	require.Equal(t, exitOK, code, stderr.String())
+	assert.NotContains(t, stderr.String(), "[INFO]")
+	var report runReport
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &report))
+	assert.Equal(t, gostage.StatusCompleted, report.Actions[gostage.ActionStatusKey("publish", "mark")])
+	assert.Equal(t, gostage.StatusSkipped, report.Actions[gostage.ActionStatusKey("publish", "announce")])
+
+	stdout.Reset()
+	stderr.Reset()
+	code = run([]string{"run", "-profile", "preview", "-profile-file", profiles, path}, &stdout, &stderr)
+	require.Equal(t, exitOK, code, stderr.String())
+	assert.Contains(t, stderr.String(), "Dry run: would execute action announce")
+	report = runReport{}
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &report))
+	assert.True(t, report.DryRun)
+	assert.Equal(t, gostage.StatusSkipped, report.Actions[gostage.ActionStatusKey("publish", "mark")])
+	assert.NotContains(t, report.Store, "published")
+
+	stderr.Reset()
+	assert.Equal(t, exitFailure, run([]string{"run", "-profile", "nightly", "-profile-file", profiles, path}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "run profile not found: 'nightly'")
+}
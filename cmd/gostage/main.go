@@ -0,0 +1,29 @@
+// Command gostage validates, plans and runs declarative workflow definitions.
+//
+// Usage:
+//
+//	gostage validate <file|name>
+//	gostage plan [flags] <file|name>
+//	gostage run [flags] <file|name>
+//
+// Flags for plan and run:
+//
+//	-tags a,b         only run stages tagged with any of the given tags
+//	-skip-tags a,b    skip stages and actions tagged with any of the given tags
+//	-param key=value  set a workflow parameter (repeatable); values are parsed as JSON when possible
+//	-report path      write the JSON run report to path instead of stdout (run only)
+//
+// Workflow definitions reference the built-in actions "shell", "set" and "log".
+// An argument that is not a file names a workflow of the default workflow
+// registry, for programs that register workflows and embed the CLI.
+// The exit code is 0 on success, 1 when validation or execution fails and 2 on
+// usage errors.
+package main
+
+import (
+	"os"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
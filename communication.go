@@ -25,6 +25,8 @@ const (
 	MessageTypeWorkflowResult MessageType = "workflow_result"
 	// MessageTypeFinalStore is sent from child to parent with the complete final store state.
 	MessageTypeFinalStore MessageType = "final_store"
+	// MessageTypeEvent is sent from child to parent for each lifecycle event of the child's run.
+	MessageTypeEvent MessageType = "event"
 )
 
 // Message is the standard unit of communication between a parent and child process.
@@ -39,6 +41,7 @@ type MessageHandler func(msgType MessageType, payload json.RawMessage) error
 // RunnerBroker handles message sending, receiving, and routing between processes
 type RunnerBroker struct {
 	mu               sync.RWMutex
+	writeMu          sync.Mutex // Serializes writes so concurrent messages never interleave
 	output           io.Writer
 	handlers         map[MessageType]MessageHandler
 	defaultHandler   MessageHandler
@@ -122,7 +125,9 @@ func (b *RunnerBroker) Send(msgType MessageType, payload interface{}) error {
 
 	data = append(data, '\n')
 
+	b.writeMu.Lock()
 	_, err = b.output.Write(data)
+	b.writeMu.Unlock()
 	if err != nil {
 		return fmt.Errorf("failed to write message: %w", err)
 	}
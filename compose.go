@@ -0,0 +1,149 @@
+package gostage
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/davidroman0O/gostage/store"
+)
+
+// ComposeOption configures how a workflow is appended to another.
+type ComposeOption func(*composeOptions)
+
+type composeOptions struct {
+	stages        MergeStrategy
+	store         MergeStrategy
+	prefixStageID bool
+}
+
+// WithStageMerge sets how stages whose ID is already used are handled. Error,
+// the default, fails; Skip keeps the existing stage; Overwrite replaces the
+// existing stage in place.
+func WithStageMerge(strategy MergeStrategy) ComposeOption {
+	return func(o *composeOptions) {
+		o.stages = strategy
+	}
+}
+
+// WithStoreMerge sets how store keys already present are handled. Error, the
+// default, fails; Skip keeps the existing value; Overwrite takes the appended
+// workflow's value.
+func WithStoreMerge(strategy MergeStrategy) ComposeOption {
+	return func(o *composeOptions) {
+		o.store = strategy
+	}
+}
+
+// PrefixStageIDs prefixes the IDs of appended stages with the ID of their
+// workflow and a dot, as in "build.test", so that workflows reusing stage IDs
+// can be composed.
+func PrefixStageIDs() ComposeOption {
+	return func(o *composeOptions) {
+		o.prefixStageID = true
+	}
+}
+
+// Append adds copies of the stages of other after the stages of the workflow,
+// and merges the user data of other's store into the workflow's store. The
+// stages and actions other disabled stay disabled. Middleware, parameters and
+// tags of other are not appended. Nothing changes if a collision fails the
+// merge.
+func (w *Workflow) Append(other *Workflow, opts ...ComposeOption) error {
+	options := composeOptions{stages: Error, store: Error}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	stageID := func(id string) string {
+		if options.prefixStageID {
+			return other.ID + "." + id
+		}
+		return id
+	}
+
+	// Plan the stages before changing anything so a collision leaves the workflow untouched
+	var appended []*Stage
+	replaced := make(map[int]*Stage)
+	for _, stage := range other.Stages {
+		clone := stage.Clone()
+		clone.ID = stageID(stage.ID)
+		for i, dependency := range clone.dependencies {
+			clone.dependencies[i] = stageID(dependency)
+		}
+
+		index, err := w.stageIndex(clone.ID)
+		if err != nil {
+			appended = append(appended, clone)
+			continue
+		}
+		switch options.stages {
+		case Skip:
+		case Overwrite:
+			replaced[index] = clone
+		default:
+			return fmt.Errorf("stage '%s' of workflow '%s' already exists in workflow '%s'", clone.ID, other.ID, w.ID)
+		}
+	}
+
+	data := other.Store.Clone()
+	for _, key := range data.ListKeys() {
+		if hasSystemPrefix(key) {
+			data.Delete(key)
+		}
+	}
+	if options.store == Error {
+		if collisions := w.Store.FindKeyCollisions(data); len(collisions) > 0 {
+			sort.Strings(collisions)
+			return fmt.Errorf("store keys %v of workflow '%s' already exist in workflow '%s'", collisions, other.ID, w.ID)
+		}
+	}
+	strategy := store.Skip
+	if options.store == Overwrite {
+		strategy = store.Overwrite
+	}
+	if _, err := w.Store.Merge(data, strategy); err != nil {
+		return fmt.Errorf("failed to merge the store of workflow '%s': %w", other.ID, err)
+	}
+
+	for index, stage := range replaced {
+		w.forgetStage(w.Stages[index].ID)
+		w.Stages[index] = stage
+		w.storeStage(stage, index)
+	}
+	for _, stage := range appended {
+		w.Stages = append(w.Stages, stage)
+		w.storeStage(stage, len(w.Stages)-1)
+	}
+
+	for id, disabled := range contextFlags(other, "disabledStages") {
+		if disabled {
+			w.DisableStage(stageID(id))
+		}
+	}
+	for name, disabled := range contextFlags(other, "disabledActions") {
+		if disabled {
+			w.DisableAction(name)
+		}
+	}
+
+	w.saveToStore()
+	return nil
+}
+
+// contextFlags returns the map stored under key in the workflow context.
+func contextFlags(w *Workflow, key string) map[string]bool {
+	flags, _ := w.Context[key].(map[string]bool)
+	return flags
+}
+
+// Compose creates a workflow running the stages of workflows one after the
+// other, appending each of them in order as Append does.
+func Compose(id, name string, workflows []*Workflow, opts ...ComposeOption) (*Workflow, error) {
+	composed := NewWorkflow(id, name, "")
+	for _, workflow := range workflows {
+		if err := composed.Append(workflow, opts...); err != nil {
+			return nil, err
+		}
+	}
+	return composed, nil
+}
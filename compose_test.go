@@ -0,0 +1,78 @@
+package gostage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newComposableWorkflow returns a workflow whose stages append their ID to ran.
+func newComposableWorkflow(id string, ran *[]string, stageIDs ...string) *Workflow {
+	wf := NewWorkflow(id, id, "")
+	for _, stageID := range stageIDs {
+		wf.AddStage(recordingStage(stageID, ran))
+	}
+	return wf
+}
+
+func TestCompose(t *testing.T) {
+	var ran []string
+	build := newComposableWorkflow("build", &ran, "compile", "test")
+	build.Store.Put("image", "app:1.0")
+	deploy := newComposableWorkflow("deploy", &ran, "apply", "verify")
+	deploy.Store.Put("replicas", 3)
+	deploy.DisableStage("verify")
+
+	wf, err := Compose("pipeline", "Pipeline", []*Workflow{build, deploy})
+	require.NoError(t, err)
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, []string{"compile", "test", "apply"}, ran)
+	assert.Equal(t, "app:1.0", result.FinalStore["image"])
+	assert.Equal(t, 3, result.FinalStore["replicas"])
+	assert.Equal(t, StatusSkipped, result.StageStatuses["verify"])
+
+	// Composed stages are copies
+	assert.NotSame(t, build.Stages[0], wf.Stages[0])
+	assert.Equal(t, []string{"compile", "test", "apply", "verify"}, wf.getStageIDs())
+}
+
+func TestAppendCollisions(t *testing.T) {
+	var ran []string
+	newBase := func() *Workflow {
+		base := newComposableWorkflow("base", &ran, "setup", "test")
+		base.Store.Put("env", "dev")
+		return base
+	}
+	other := newComposableWorkflow("other", &ran, "test", "report")
+	other.Store.Put("env", "prod")
+	other.Store.Put("region", "eu")
+
+	base := newBase()
+	assert.ErrorContains(t, base.Append(other), "stage 'test' of workflow 'other' already exists in workflow 'base'")
+	assert.ErrorContains(t, base.Append(other, WithStageMerge(Skip)), "store keys [env] of workflow 'other' already exist in workflow 'base'")
+	assert.Equal(t, []string{"setup", "test"}, base.getStageIDs())
+	assert.NotContains(t, base.Store.ListKeys(), "region")
+
+	base = newBase()
+	require.NoError(t, base.Append(other, WithStageMerge(Skip), WithStoreMerge(Skip)))
+	assert.Equal(t, []string{"setup", "test", "report"}, base.getStageIDs())
+	assert.NotSame(t, other.Stages[0], base.Stages[1])
+	assert.Equal(t, "dev", base.Store.ExportAll()["env"])
+
+	base = newBase()
+	require.NoError(t, base.Append(other, WithStageMerge(Overwrite), WithStoreMerge(Overwrite)))
+	assert.Equal(t, []string{"setup", "test", "report"}, base.getStageIDs())
+	result := NewRunner().ExecuteWithOptions(base, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, "prod", result.FinalStore["env"])
+	assert.Equal(t, "eu", result.FinalStore["region"])
+
+	base = newBase()
+	other.DisableStage("report")
+	require.NoError(t, base.Append(other, PrefixStageIDs(), WithStoreMerge(Overwrite)))
+	assert.Equal(t, []string{"setup", "test", "other.test", "other.report"}, base.getStageIDs())
+	assert.False(t, base.IsStageEnabled("other.report"))
+	assert.True(t, base.IsStageEnabled("report"))
+}
@@ -101,7 +101,7 @@ func TestComprehensiveMiddleware(t *testing.T) {
 					GoContext:     ctx,
 					Workflow:      w,
 					Stage:         s,
-					Logger:        logger,
+					Logger:        AsFieldLogger(logger),
 					dynamicStages: []*Stage{dynStage},
 				}
 				w.Context["dynamicStages"] = actionCtx.dynamicStages
@@ -19,6 +19,12 @@ const (
 
 	// PrefixTemp is used for temporary data that shouldn't persist between executions
 	PrefixTemp = "temp:"
+
+	// PrefixParam is used for action parameters published from a definition
+	PrefixParam = "param:"
+
+	// PrefixCircuit is used for the circuit breaker statuses of the actions
+	PrefixCircuit = "circuit:"
 )
 
 // Common tags used across the workflow system
@@ -37,6 +43,22 @@ const (
 
 	// TagTemporary identifies temporary components
 	TagTemporary = "temporary"
+
+	// TagSecret marks store keys whose values must be redacted from logs, events and exports
+	TagSecret = "secret"
+
+	// TagAlwaysRun marks stages that run even after an earlier stage failed or the run was interrupted
+	TagAlwaysRun = "always-run"
+
+	// TagSpawn marks stages executed in a child process
+	TagSpawn = "spawn"
+
+	// TagRemote marks stages executed by a remote worker through the runner's stage dispatcher
+	TagRemote = "remote"
+
+	// TagReadOnly marks actions whose ctx.Store() is a read-only view of the
+	// workflow store, such as third-party actions that must not change it
+	TagReadOnly = "read-only"
 )
 
 // Common property keys used in metadata
@@ -73,4 +95,11 @@ const (
 
 	// StatusSkipped means execution was skipped
 	StatusSkipped = "skipped"
+
+	// StatusInterrupted means execution was stopped by a signal or a shutdown
+	StatusInterrupted = "interrupted"
+
+	// StatusCancelled means execution was abandoned because the context of the
+	// run was cancelled or its deadline passed
+	StatusCancelled = "cancelled"
 )
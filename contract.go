@@ -0,0 +1,234 @@
+package gostage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+)
+
+// ErrStoreContract is wrapped by the error of a stage whose store data does not
+// match the schemas it declared with Consumes or Produces.
+var ErrStoreContract = errors.New("store data does not match the stage contract")
+
+// ContractViolation describes one store value that does not match its schema.
+type ContractViolation struct {
+	// Key is the store key holding the value
+	Key string
+	// Path is the JSON pointer of the offending value within the key's value,
+	// empty when the value itself is at fault
+	Path string
+	// Message explains why the value does not match
+	Message string
+}
+
+// String renders the violation as "key/path: message".
+func (v ContractViolation) String() string {
+	return v.Key + v.Path + ": " + v.Message
+}
+
+// ContractError reports the store keys of a stage that do not match the schemas
+// the stage declared. It is returned, wrapped, by Runner.Execute when a stage
+// starts with invalid consumed data or completes with invalid produced data.
+type ContractError struct {
+	// StageID identifies the stage that declared the schemas
+	StageID string
+	// Boundary is "consumes" when the check ran before the stage and "produces"
+	// when it ran after the stage completed
+	Boundary string
+	// Violations lists every mismatch, ordered by key and path
+	Violations []ContractViolation
+}
+
+// Error implements the error interface.
+func (e *ContractError) Error() string {
+	details := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		details[i] = violation.String()
+	}
+	return fmt.Sprintf("stage '%s' %s invalid store data: %s", e.StageID, e.Boundary, strings.Join(details, "; "))
+}
+
+// Unwrap lets callers match contract failures with errors.Is(err, ErrStoreContract).
+func (e *ContractError) Unwrap() error {
+	return ErrStoreContract
+}
+
+const (
+	boundaryConsumes = "consumes"
+	boundaryProduces = "produces"
+)
+
+// keySchema is the compiled JSON Schema a store key must match.
+type keySchema struct {
+	key    string
+	source json.RawMessage
+	schema *jsonschema.Schema
+}
+
+// Consumes declares that the stage reads key, which must be present in the store
+// and match schema when the stage starts. schema is a JSON Schema given as JSON
+// bytes, a json.RawMessage, or any value that encodes to one, such as a map or the
+// result of store.TypeToSchema. Declaring a key again replaces its schema.
+func (s *Stage) Consumes(key string, schema any) error {
+	compiled, err := compileKeySchema(key, schema)
+	if err != nil {
+		return fmt.Errorf("stage '%s' consumes '%s': %w", s.ID, key, err)
+	}
+	s.consumes = setKeySchema(s.consumes, compiled)
+	return nil
+}
+
+// Produces declares that the stage writes key, which must be present in the store
+// and match schema when the stage completes. schema is accepted in the same forms
+// as for Consumes.
+func (s *Stage) Produces(key string, schema any) error {
+	compiled, err := compileKeySchema(key, schema)
+	if err != nil {
+		return fmt.Errorf("stage '%s' produces '%s': %w", s.ID, key, err)
+	}
+	s.produces = setKeySchema(s.produces, compiled)
+	return nil
+}
+
+// ConsumedSchemas returns the schemas declared with Consumes, keyed by store key.
+func (s *Stage) ConsumedSchemas() map[string]json.RawMessage {
+	return schemaSources(s.consumes)
+}
+
+// ProducedSchemas returns the schemas declared with Produces, keyed by store key.
+func (s *Stage) ProducedSchemas() map[string]json.RawMessage {
+	return schemaSources(s.produces)
+}
+
+// compileKeySchema encodes schema to JSON and compiles it.
+func compileKeySchema(key string, schema any) (keySchema, error) {
+	var source []byte
+	switch v := schema.(type) {
+	case json.RawMessage:
+		source = v
+	case []byte:
+		source = v
+	case string:
+		source = []byte(v)
+	default:
+		encoded, err := json.Marshal(schema)
+		if err != nil {
+			return keySchema{}, fmt.Errorf("failed to encode schema: %w", err)
+		}
+		source = encoded
+	}
+
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(source))
+	if err != nil {
+		return keySchema{}, fmt.Errorf("invalid schema: %w", err)
+	}
+	location := "gostage:///store/" + url.PathEscape(key) + ".json"
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(location, doc); err != nil {
+		return keySchema{}, fmt.Errorf("invalid schema: %w", err)
+	}
+	compiled, err := compiler.Compile(location)
+	if err != nil {
+		return keySchema{}, fmt.Errorf("invalid schema: %w", err)
+	}
+	return keySchema{key: key, source: append(json.RawMessage(nil), source...), schema: compiled}, nil
+}
+
+// setKeySchema adds schema to schemas, replacing an earlier schema for the same key.
+func setKeySchema(schemas []keySchema, schema keySchema) []keySchema {
+	for i, existing := range schemas {
+		if existing.key == schema.key {
+			schemas[i] = schema
+			return schemas
+		}
+	}
+	return append(schemas, schema)
+}
+
+// schemaSources returns the JSON source of each schema, or nil when there are none.
+func schemaSources(schemas []keySchema) map[string]json.RawMessage {
+	if len(schemas) == 0 {
+		return nil
+	}
+	sources := make(map[string]json.RawMessage, len(schemas))
+	for _, schema := range schemas {
+		sources[schema.key] = append(json.RawMessage(nil), schema.source...)
+	}
+	return sources
+}
+
+// checkContract validates the store of workflow against the schemas the stage
+// declared for boundary and returns a *ContractError listing every mismatch.
+func checkContract(workflow *Workflow, stage *Stage, boundary string) error {
+	schemas := stage.consumes
+	if boundary == boundaryProduces {
+		schemas = stage.produces
+	}
+	if len(schemas) == 0 {
+		return nil
+	}
+
+	var violations []ContractViolation
+	for _, schema := range schemas {
+		violations = append(violations, validateKey(workflow, schema)...)
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	sort.SliceStable(violations, func(i, j int) bool {
+		if violations[i].Key != violations[j].Key {
+			return violations[i].Key < violations[j].Key
+		}
+		return violations[i].Path < violations[j].Path
+	})
+	return &ContractError{StageID: stage.ID, Boundary: boundary, Violations: violations}
+}
+
+// validateKey checks the value stored under the key of schema. Values are
+// validated in their JSON form, the same form they take when a stage is spawned.
+func validateKey(workflow *Workflow, schema keySchema) []ContractViolation {
+	value, err := workflow.Store.GetValue(schema.key)
+	if err != nil {
+		return []ContractViolation{{Key: schema.key, Message: "missing from the store"}}
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return []ContractViolation{{Key: schema.key, Message: fmt.Sprintf("not JSON-serializable: %v", err)}}
+	}
+	instance, err := jsonschema.UnmarshalJSON(bytes.NewReader(encoded))
+	if err != nil {
+		return []ContractViolation{{Key: schema.key, Message: fmt.Sprintf("not JSON-serializable: %v", err)}}
+	}
+
+	err = schema.schema.Validate(instance)
+	if err == nil {
+		return nil
+	}
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return []ContractViolation{{Key: schema.key, Message: err.Error()}}
+	}
+
+	var violations []ContractViolation
+	for _, unit := range validationErr.BasicOutput().Errors {
+		// Group units only announce that nested values failed
+		if unit.Error == nil {
+			continue
+		}
+		if _, ok := unit.Error.Kind.(*kind.Group); ok {
+			continue
+		}
+		violations = append(violations, ContractViolation{Key: schema.key, Path: unit.InstanceLocation, Message: unit.Error.String()})
+	}
+	if len(violations) == 0 {
+		violations = append(violations, ContractViolation{Key: schema.key, Message: err.Error()})
+	}
+	return violations
+}
@@ -0,0 +1,131 @@
+package gostage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/davidroman0O/gostage/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const orderSchema = `{
+	"type": "object",
+	"required": ["id", "items"],
+	"properties": {
+		"id": {"type": "string"},
+		"items": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"properties": {"price": {"type": "number", "minimum": 0}}
+			}
+		}
+	}
+}`
+
+type contractOrder struct {
+	ID    string  `json:"id"`
+	Total float64 `json:"total"`
+}
+
+func TestStageConsumesContract(t *testing.T) {
+	ran := false
+	result := runSingleAction(t, context.Background(), NewActionFunc("price", "", func(ctx *ActionContext) error {
+		ran = true
+		return nil
+	}), func(wf *Workflow) {
+		require.NoError(t, wf.Stages[0].Consumes("order", orderSchema))
+		wf.Store.Put("order", map[string]interface{}{
+			"items": []interface{}{
+				map[string]interface{}{"price": "free"},
+				map[string]interface{}{"price": -1},
+			},
+		})
+	})
+
+	require.ErrorIs(t, result.Error, ErrStoreContract)
+	assert.False(t, ran, "the stage must not run with invalid input")
+	assert.Equal(t, StatusFailed, result.StageStatuses["wait"])
+
+	var contractErr *ContractError
+	require.True(t, errors.As(result.Error, &contractErr))
+	assert.Equal(t, "wait", contractErr.StageID)
+	assert.Equal(t, "consumes", contractErr.Boundary)
+	require.Len(t, contractErr.Violations, 3)
+	assert.Equal(t, ContractViolation{Key: "order", Path: "", Message: "missing property 'id'"}, contractErr.Violations[0])
+	assert.Equal(t, "/items/0/price", contractErr.Violations[1].Path)
+	assert.Equal(t, "/items/1/price", contractErr.Violations[2].Path)
+	assert.Contains(t, result.Error.Error(), "order/items/0/price: got string, want number")
+}
+
+func TestStageConsumesMissingKey(t *testing.T) {
+	result := runSingleAction(t, context.Background(), NewActionFunc("noop", "", func(ctx *ActionContext) error {
+		return nil
+	}), func(wf *Workflow) {
+		require.NoError(t, wf.Stages[0].Consumes("order", orderSchema))
+	})
+
+	var contractErr *ContractError
+	require.True(t, errors.As(result.Error, &contractErr))
+	assert.Equal(t, []ContractViolation{{Key: "order", Message: "missing from the store"}}, contractErr.Violations)
+}
+
+func TestStageProducesContract(t *testing.T) {
+	produce := func(total interface{}) RunResult {
+		return runSingleAction(t, context.Background(), NewActionFunc("checkout", "", func(ctx *ActionContext) error {
+			return ctx.Store().Put("order", map[string]interface{}{"id": "A-1", "total": total})
+		}), func(wf *Workflow) {
+			require.NoError(t, wf.Stages[0].Produces("order", store.TypeToSchema(reflect.TypeOf(contractOrder{}))))
+		})
+	}
+
+	result := produce(42.5)
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, StatusCompleted, result.StageStatuses["wait"])
+
+	result = produce("a lot")
+	var contractErr *ContractError
+	require.True(t, errors.As(result.Error, &contractErr))
+	assert.Equal(t, "produces", contractErr.Boundary)
+	require.Len(t, contractErr.Violations, 1)
+	assert.Equal(t, "/total", contractErr.Violations[0].Path)
+	assert.Equal(t, StatusFailed, result.StageStatuses["wait"])
+}
+
+func TestStageContractInvalidSchema(t *testing.T) {
+	stage := NewStage("s", "S", "")
+	assert.Error(t, stage.Consumes("order", `{"type": 12}`))
+	assert.Error(t, stage.Produces("order", `not json`))
+	assert.Nil(t, stage.ConsumedSchemas())
+	assert.Nil(t, stage.ProducedSchemas())
+}
+
+func TestStageContractSerialization(t *testing.T) {
+	registry := newSerializationRegistry(t)
+
+	wf := NewWorkflow("wf", "Workflow", "")
+	stage := NewStage("fetch", "Fetch", "")
+	noop, err := registry.Resolve("noop", nil)
+	require.NoError(t, err)
+	stage.AddAction(noop)
+	require.NoError(t, stage.Consumes("order", json.RawMessage(orderSchema)))
+	require.NoError(t, stage.Produces("total", map[string]interface{}{"type": "number"}))
+	wf.AddStage(stage)
+
+	data, err := wf.Marshal()
+	require.NoError(t, err)
+	restored, err := UnmarshalWorkflow(data, registry)
+	require.NoError(t, err)
+
+	assert.JSONEq(t, orderSchema, string(restored.Stages[0].ConsumedSchemas()["order"]))
+	assert.JSONEq(t, `{"type":"number"}`, string(restored.Stages[0].ProducedSchemas()["total"]))
+	assert.Equal(t, stage.ConsumedSchemas(), stage.Clone().ConsumedSchemas())
+
+	// The restored workflow enforces the same contract
+	result := RunWorkflow(restored, DefaultRunOptions())
+	assert.ErrorIs(t, result.Error, ErrStoreContract)
+}
@@ -0,0 +1,110 @@
+package gostage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrWorkflowDeadline is the cause of the cancellation of a run that outlived
+// the deadline or the maximum duration of its workflow. The errors of such runs
+// wrap it, and through it context.DeadlineExceeded.
+var ErrWorkflowDeadline = fmt.Errorf("workflow deadline exceeded: %w", context.DeadlineExceeded)
+
+// contextRunDeadline holds the time the current run must finish by
+const contextRunDeadline = "runDeadline"
+
+// contextRunMaxDuration holds RunOptions.MaxDuration for the run in progress, set by ExecuteWithOptions
+const contextRunMaxDuration = "runMaxDuration"
+
+// SetDeadline makes the Runner stop the workflow at t, wherever it is. Stages
+// and actions not finished by then get StatusCancelled. The zero time removes
+// the deadline.
+func (w *Workflow) SetDeadline(t time.Time) {
+	w.deadline = t
+}
+
+// Deadline returns the deadline set with SetDeadline, or the zero time.
+func (w *Workflow) Deadline() time.Time {
+	return w.deadline
+}
+
+// SetMaxDuration makes the Runner stop the workflow once a run has lasted d,
+// counted on the runner's clock from the start of its first stage. When a
+// deadline is also set, the earliest of the two applies. Zero removes the limit.
+func (w *Workflow) SetMaxDuration(d time.Duration) {
+	w.maxDuration = d
+}
+
+// MaxDuration returns the limit set with SetMaxDuration, or zero.
+func (w *Workflow) MaxDuration() time.Duration {
+	return w.maxDuration
+}
+
+// startDeadline bounds the run of w by its deadline and maximum duration, and
+// the maximum duration of the run's options. The returned function stops the
+// bound and makes err wrap ErrWorkflowDeadline if the run went over its budget.
+func (r *Runner) startDeadline(ctx context.Context, w *Workflow) (context.Context, func(err error) error) {
+	deadline := w.deadline
+	maxDuration := w.maxDuration
+	if d, ok := w.Context[contextRunMaxDuration].(time.Duration); ok && (maxDuration <= 0 || d < maxDuration) {
+		maxDuration = d
+	}
+	if maxDuration > 0 {
+		if end := r.now().Add(maxDuration); deadline.IsZero() || end.Before(deadline) {
+			deadline = end
+		}
+	}
+	if deadline.IsZero() {
+		return ctx, func(err error) error { return err }
+	}
+
+	w.Context[contextRunDeadline] = deadline
+	ctx, cancel := context.WithCancelCause(ctx)
+	var timer Timer
+	if budget := deadline.Sub(r.now()); budget > 0 {
+		timer = afterFunc(r.Clock(), budget, func() { cancel(ErrWorkflowDeadline) })
+	} else {
+		cancel(ErrWorkflowDeadline)
+	}
+	return ctx, func(err error) error {
+		if timer != nil {
+			timer.Stop()
+		}
+		cancel(nil)
+		delete(w.Context, contextRunDeadline)
+
+		// Actions returning the context's error do not say why it was cancelled
+		if err != nil && !errors.Is(err, ErrWorkflowDeadline) && errors.Is(context.Cause(ctx), ErrWorkflowDeadline) {
+			err = fmt.Errorf("%w: %w", ErrWorkflowDeadline, err)
+		}
+		return err
+	}
+}
+
+// runDeadline returns the time the current run of w must finish by, if any.
+func runDeadline(w *Workflow) (time.Time, bool) {
+	deadline, ok := w.Context[contextRunDeadline].(time.Time)
+	return deadline, ok
+}
+
+// TimeRemaining returns how long the action has left before the deadline of
+// the run, the earliest of the workflow's deadline or maximum duration and the
+// deadline of GoContext. Actions size their own timeouts with it. It returns
+// false when the run has no deadline, and never a negative duration.
+func (ctx *ActionContext) TimeRemaining() (time.Duration, bool) {
+	var deadline time.Time
+	if ctx.Workflow != nil {
+		deadline, _ = runDeadline(ctx.Workflow)
+	}
+	if ctx.GoContext != nil {
+		if goDeadline, ok := ctx.GoContext.Deadline(); ok && (deadline.IsZero() || goDeadline.Before(deadline)) {
+			deadline = goDeadline
+		}
+	}
+	if deadline.IsZero() {
+		return 0, false
+	}
+	return max(deadline.Sub(ctx.Now()), 0), true
+}
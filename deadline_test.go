@@ -0,0 +1,117 @@
+package gostage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkflowMaxDuration(t *testing.T) {
+	wf := NewWorkflow("budget", "Budget", "")
+	wf.SetMaxDuration(30 * time.Millisecond)
+	slow := NewStage("slow", "Slow", "")
+	slow.AddAction(NewActionFunc("sleep", "", func(ctx *ActionContext) error {
+		return ctx.Sleep(time.Minute)
+	}))
+	wf.AddStage(slow)
+	next := NewStage("next", "Next", "")
+	next.AddAction(NewActionFunc("never", "", func(*ActionContext) error { return nil }))
+	wf.AddStage(next)
+
+	started := time.Now()
+	result := RunWorkflow(wf, DefaultRunOptions())
+	assert.Less(t, time.Since(started), 5*time.Second)
+	assert.ErrorIs(t, result.Error, ErrWorkflowDeadline)
+	assert.ErrorIs(t, result.Error, context.DeadlineExceeded)
+	assert.True(t, result.Cancelled)
+	assert.Equal(t, StatusCancelled, result.StageStatuses["slow"])
+	assert.Equal(t, StatusCancelled, result.StageStatuses["next"])
+}
+
+func TestWorkflowDeadlineStopsNonCooperativeActions(t *testing.T) {
+	ran := false
+	result := runSingleAction(t, context.Background(), NewActionFunc("busy", "", func(*ActionContext) error {
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	}), func(wf *Workflow) {
+		wf.SetDeadline(time.Now().Add(10 * time.Millisecond))
+		wf.Stages[0].AddAction(NewActionFunc("after", "", func(*ActionContext) error {
+			ran = true
+			return nil
+		}))
+	})
+
+	assert.ErrorIs(t, result.Error, ErrWorkflowDeadline)
+	assert.False(t, ran)
+	assert.Equal(t, StatusCompleted, result.ActionStatuses[ActionStatusKey("wait", "busy")])
+	assert.Equal(t, StatusCancelled, result.ActionStatuses[ActionStatusKey("wait", "after")])
+}
+
+func TestWorkflowDeadlinePassed(t *testing.T) {
+	ran := false
+	result := runSingleAction(t, context.Background(), NewActionFunc("noop", "", func(*ActionContext) error {
+		ran = true
+		return nil
+	}), func(wf *Workflow) {
+		wf.SetDeadline(time.Now().Add(-time.Second))
+	})
+
+	assert.ErrorIs(t, result.Error, ErrWorkflowDeadline)
+	assert.False(t, ran)
+	assert.Equal(t, StatusCancelled, result.StageStatuses["wait"])
+}
+
+func TestActionTimeRemaining(t *testing.T) {
+	var remaining time.Duration
+	var limited bool
+	action := NewActionFunc("measure", "", func(ctx *ActionContext) error {
+		remaining, limited = ctx.TimeRemaining()
+		return nil
+	})
+
+	result := runSingleAction(t, context.Background(), action, nil)
+	require.True(t, result.Success, "%v", result.Error)
+	assert.False(t, limited)
+
+	// The earliest of the deadline and the maximum duration applies
+	result = runSingleAction(t, context.Background(), action, func(wf *Workflow) {
+		wf.SetDeadline(time.Now().Add(time.Hour))
+		wf.SetMaxDuration(time.Minute)
+	})
+	require.True(t, result.Success, "%v", result.Error)
+	assert.True(t, limited)
+	assert.InDelta(t, time.Minute, remaining, float64(5*time.Second))
+
+	// So does the deadline of the run's context
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	result = runSingleAction(t, ctx, action, func(wf *Workflow) {
+		wf.SetMaxDuration(time.Minute)
+	})
+	require.True(t, result.Success, "%v", result.Error)
+	assert.InDelta(t, 10*time.Second, remaining, float64(5*time.Second))
+}
+
+func TestWorkflowDeadlineSerialization(t *testing.T) {
+	registry := newSerializationRegistry(t)
+	wf := NewWorkflow("wf", "Workflow", "")
+	stage := NewStage("s", "S", "")
+	noop, err := registry.Resolve("noop", nil)
+	require.NoError(t, err)
+	stage.AddAction(noop)
+	wf.AddStage(stage)
+
+	deadline := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	wf.SetDeadline(deadline)
+	wf.SetMaxDuration(90 * time.Second)
+
+	data, err := wf.Marshal()
+	require.NoError(t, err)
+	restored, err := UnmarshalWorkflow(data, registry)
+	require.NoError(t, err)
+	assert.True(t, deadline.Equal(restored.Deadline()))
+	assert.Equal(t, 90*time.Second, restored.MaxDuration())
+}
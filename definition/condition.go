@@ -0,0 +1,97 @@
+package definition
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/davidroman0O/gostage/store"
+)
+
+// Condition gates a stage or action on a value in the workflow store.
+// Exactly one of Equals, NotEquals or Exists must be set.
+type Condition struct {
+	// Key is the store key the condition looks at.
+	Key string `json:"key" yaml:"key"`
+	// Equals holds when the stored value equals this value.
+	Equals interface{} `json:"equals,omitempty" yaml:"equals,omitempty"`
+	// NotEquals holds when the stored value is missing or differs from this value.
+	NotEquals interface{} `json:"notEquals,omitempty" yaml:"notEquals,omitempty"`
+	// Exists holds when the key's presence in the store matches this flag.
+	Exists *bool `json:"exists,omitempty" yaml:"exists,omitempty"`
+}
+
+// validate checks that the condition is well formed. A nil condition is valid.
+func (c *Condition) validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.Key == "" {
+		return fmt.Errorf("condition is missing a key")
+	}
+
+	set := 0
+	if c.Equals != nil {
+		set++
+	}
+	if c.NotEquals != nil {
+		set++
+	}
+	if c.Exists != nil {
+		set++
+	}
+	if set != 1 {
+		return fmt.Errorf("condition on '%s' must set exactly one of equals, notEquals or exists", c.Key)
+	}
+	return nil
+}
+
+// Evaluate reports whether the condition holds against the given store.
+// Values are compared by their formatted representation so that numbers decoded
+// from a document match numbers stored by Go code.
+func (c *Condition) Evaluate(s *store.KVStore) bool {
+	if c == nil {
+		return true
+	}
+
+	value, exists := s.ExportAll()[c.Key]
+
+	switch {
+	case c.Exists != nil:
+		return exists == *c.Exists
+	case c.Equals != nil:
+		return exists && fmt.Sprint(value) == fmt.Sprint(c.Equals)
+	case c.NotEquals != nil:
+		return !exists || fmt.Sprint(value) != fmt.Sprint(c.NotEquals)
+	}
+	return true
+}
+
+// stageCondition creates a stage middleware that skips the stage's actions
+// when the condition does not hold.
+func stageCondition(cond *Condition) gostage.StageMiddleware {
+	return func(next gostage.StageRunnerFunc) gostage.StageRunnerFunc {
+		return func(ctx context.Context, stage *gostage.Stage, workflow *gostage.Workflow, logger gostage.Logger) error {
+			if !cond.Evaluate(workflow.Store) {
+				logger.Info("Skipping stage %s: condition on '%s' not met", stage.ID, cond.Key)
+				return nil
+			}
+			return next(ctx, stage, workflow, logger)
+		}
+	}
+}
+
+// conditionalAction wraps an action so it only runs when its condition holds.
+type conditionalAction struct {
+	gostage.Action
+	when *Condition
+}
+
+// Execute runs the wrapped action if the condition holds.
+func (a *conditionalAction) Execute(ctx *gostage.ActionContext) error {
+	if !a.when.Evaluate(ctx.Store()) {
+		ctx.Logger.Info("Skipping action %s: condition on '%s' not met", a.Name(), a.when.Key)
+		return nil
+	}
+	return a.Action.Execute(ctx)
+}
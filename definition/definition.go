@@ -0,0 +1,285 @@
+package definition
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/davidroman0O/gostage"
+	"gopkg.in/yaml.v3"
+)
+
+// Document is the declarative description of a workflow.
+type Document struct {
+	// ID is the unique identifier for the workflow.
+	ID string `json:"id" yaml:"id"`
+	// Name is a human-readable name for the workflow.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Description provides details about the workflow's purpose.
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	// Version identifies the revision of the workflow definition.
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+	// Tags for organization and filtering.
+	Tags []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	// Annotations are key/value metadata, such as an owner or a runbook link.
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+	// InitialData is loaded into the workflow store before execution.
+	InitialData map[string]interface{} `json:"initialData,omitempty" yaml:"initialData,omitempty"`
+	// Params declares the parameters accepted by the workflow.
+	Params []Param `json:"params,omitempty" yaml:"params,omitempty"`
+	// Strategy runs the stages one after the other, the default, at the same
+	// time, or as a pipeline.
+	Strategy gostage.ExecutionStrategy `json:"strategy,omitempty" yaml:"strategy,omitempty"`
+	// Stages contains the stage definitions in execution order.
+	Stages []Stage `json:"stages" yaml:"stages"`
+}
+
+// Param is the declarative description of a workflow parameter.
+type Param struct {
+	// Name is the parameter name.
+	Name string `json:"name" yaml:"name"`
+	// Description explains what the parameter controls.
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	// Required parameters must be supplied unless they have a default.
+	Required bool `json:"required,omitempty" yaml:"required,omitempty"`
+	// Default is used when the parameter is not supplied.
+	Default interface{} `json:"default,omitempty" yaml:"default,omitempty"`
+	// Type is the type of the values: string, int, float, bool, duration or list.
+	// Untyped parameters accept any value.
+	Type gostage.ParamType `json:"type,omitempty" yaml:"type,omitempty"`
+}
+
+// Stage is the declarative description of a stage.
+type Stage struct {
+	// ID is the unique identifier for the stage.
+	ID string `json:"id" yaml:"id"`
+	// Name is a human-readable name for the stage.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Description provides details about the stage's purpose.
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	// Tags for organization and filtering.
+	Tags []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	// Annotations are key/value metadata, such as an owner or a runbook link.
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+	// When skips the stage if the condition does not hold.
+	When *Condition `json:"when,omitempty" yaml:"when,omitempty"`
+	// InitialData is merged into the workflow store when the stage starts.
+	InitialData map[string]interface{} `json:"initialData,omitempty" yaml:"initialData,omitempty"`
+	// Merge decides how InitialData is merged into a store already holding
+	// some of its keys: override (the default), skipIfExists, errorOnConflict
+	// or deepMergeMaps.
+	Merge gostage.MergePolicy `json:"merge,omitempty" yaml:"merge,omitempty"`
+	// Actions is the ordered list of actions for this stage.
+	Actions []Action `json:"actions" yaml:"actions"`
+}
+
+// Action is the declarative description of an action.
+type Action struct {
+	// Action is the ID the action was registered with.
+	Action string `json:"action" yaml:"action"`
+	// Name overrides the default name of the registered action, if provided.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Description overrides the default description of the registered action, if provided.
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	// Tags are merged with the default tags of the registered action.
+	Tags []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	// Annotations are key/value metadata, such as an owner or a runbook link.
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+	// When skips the action if the condition does not hold.
+	When *Condition `json:"when,omitempty" yaml:"when,omitempty"`
+	// Params are passed to the action.
+	Params map[string]interface{} `json:"params,omitempty" yaml:"params,omitempty"`
+}
+
+// Parse decodes a YAML or JSON document.
+// JSON is a subset of YAML, so both formats are accepted.
+func Parse(data []byte) (*Document, error) {
+	var doc Document
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse workflow definition: %w", err)
+	}
+	if err := doc.Validate(); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// ParseJSON decodes a JSON document.
+func ParseJSON(data []byte) (*Document, error) {
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse workflow definition: %w", err)
+	}
+	if err := doc.Validate(); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// ParseFile reads and decodes the document at path.
+// Files with a .json extension are decoded as JSON, anything else as YAML.
+func ParseFile(path string) (*Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workflow definition: %w", err)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return ParseJSON(data)
+	}
+	return Parse(data)
+}
+
+// Load parses a YAML or JSON document and builds the workflow it describes.
+func Load(data []byte) (*gostage.Workflow, error) {
+	doc, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Build()
+}
+
+// LoadFile parses the document at path and builds the workflow it describes.
+func LoadFile(path string) (*gostage.Workflow, error) {
+	doc, err := ParseFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Build()
+}
+
+// Validate checks the document for structural errors.
+func (d *Document) Validate() error {
+	if d.ID == "" {
+		return fmt.Errorf("workflow definition is missing an id")
+	}
+
+	params := make(map[string]bool, len(d.Params))
+	for i, param := range d.Params {
+		if param.Name == "" {
+			return fmt.Errorf("parameter %d is missing a name", i)
+		}
+		if params[param.Name] {
+			return fmt.Errorf("duplicate parameter '%s'", param.Name)
+		}
+		params[param.Name] = true
+	}
+
+	seen := make(map[string]bool, len(d.Stages))
+	for i, stage := range d.Stages {
+		if stage.ID == "" {
+			return fmt.Errorf("stage %d is missing an id", i)
+		}
+		if seen[stage.ID] {
+			return fmt.Errorf("duplicate stage id '%s'", stage.ID)
+		}
+		seen[stage.ID] = true
+
+		if err := stage.When.validate(); err != nil {
+			return fmt.Errorf("stage '%s': %w", stage.ID, err)
+		}
+		for j, action := range stage.Actions {
+			if action.Action == "" {
+				return fmt.Errorf("stage '%s': action %d is missing an action id", stage.ID, j)
+			}
+			if err := action.When.validate(); err != nil {
+				return fmt.Errorf("stage '%s': action '%s': %w", stage.ID, action.Action, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Build creates the workflow described by the document.
+// Actions are instantiated from the default action registry.
+func (d *Document) Build() (*gostage.Workflow, error) {
+	return d.BuildWithRegistry(gostage.DefaultActionRegistry())
+}
+
+// BuildWithRegistry creates the workflow described by the document,
+// resolving actions and their typed parameters through the given registry.
+func (d *Document) BuildWithRegistry(registry *gostage.ActionRegistry) (*gostage.Workflow, error) {
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+
+	wf, err := gostage.NewWorkflowFromDefWithRegistry(d.toSubWorkflowDef(), registry)
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply what SubWorkflowDef cannot express: conditions
+	for i, stageDoc := range d.Stages {
+		stage := wf.Stages[i]
+
+		if stageDoc.When != nil {
+			stage.Use(stageCondition(stageDoc.When))
+		}
+
+		for j, actionDoc := range stageDoc.Actions {
+			if actionDoc.When != nil {
+				stage.Actions[j] = &conditionalAction{Action: stage.Actions[j], when: actionDoc.When}
+			}
+		}
+	}
+
+	return wf, nil
+}
+
+// toSubWorkflowDef converts the document to the core serializable definition.
+func (d *Document) toSubWorkflowDef() *gostage.SubWorkflowDef {
+	def := &gostage.SubWorkflowDef{
+		ID:           d.ID,
+		Name:         d.Name,
+		Description:  d.Description,
+		Version:      d.Version,
+		Tags:         d.Tags,
+		Annotations:  d.Annotations,
+		InitialStore: d.InitialData,
+		Strategy:     d.Strategy,
+		Stages:       make([]gostage.StageDef, len(d.Stages)),
+	}
+	if def.Tags == nil {
+		def.Tags = []string{}
+	}
+
+	for _, param := range d.Params {
+		def.Params = append(def.Params, gostage.ParamDef{
+			Name:        param.Name,
+			Description: param.Description,
+			Required:    param.Required,
+			Default:     param.Default,
+			Type:        param.Type,
+		})
+	}
+
+	for i, stage := range d.Stages {
+		stageDef := gostage.StageDef{
+			ID:           stage.ID,
+			Name:         stage.Name,
+			Description:  stage.Description,
+			Tags:         stage.Tags,
+			Annotations:  stage.Annotations,
+			Actions:      make([]gostage.ActionDef, len(stage.Actions)),
+			InitialStore: stage.InitialData,
+			MergePolicy:  stage.Merge,
+		}
+		if stageDef.Tags == nil {
+			stageDef.Tags = []string{}
+		}
+		for j, action := range stage.Actions {
+			stageDef.Actions[j] = gostage.ActionDef{
+				ID:          action.Action,
+				Name:        action.Name,
+				Description: action.Description,
+				Tags:        action.Tags,
+				Annotations: action.Annotations,
+				Params:      action.Params,
+			}
+		}
+		def.Stages[i] = stageDef
+	}
+
+	return def
+}
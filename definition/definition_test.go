@@ -0,0 +1,209 @@
+package definition
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/davidroman0O/gostage/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordAction appends its name to the "ran" list in the store.
+type recordAction struct{ gostage.BaseAction }
+
+func (a *recordAction) Execute(ctx *gostage.ActionContext) error {
+	ran, _ := store.GetOrDefault(ctx.Store(), "ran", []string{})
+	return ctx.Store().Put("ran", append(ran, a.Name()))
+}
+
+var registerOnce sync.Once
+
+func registerTestActions() {
+	registerOnce.Do(func() {
+		gostage.RegisterAction("definition-record", func() gostage.Action {
+			return &recordAction{BaseAction: gostage.NewBaseAction("definition-record", "Records its execution")}
+		})
+	})
+}
+
+const yamlDoc = `
+id: deploy
+name: Deploy
+tags: [ops]
+initialData:
+  approved: false
+  region: us-east-1
+stages:
+  - id: build
+    initialData:
+      target: linux
+    actions:
+      - action: definition-record
+        name: compile
+      - action: definition-record
+        name: only-in-eu
+        when:
+          key: region
+          equals: eu-west-1
+  - id: release
+    when:
+      key: approved
+      equals: true
+    actions:
+      - action: definition-record
+        name: publish
+`
+
+func TestLoadYAML(t *testing.T) {
+	registerTestActions()
+
+	wf, err := Load([]byte(yamlDoc))
+	require.NoError(t, err)
+
+	assert.Equal(t, "deploy", wf.ID)
+	assert.True(t, wf.HasTag("ops"))
+	require.Len(t, wf.Stages, 2)
+	assert.Equal(t, "compile", wf.Stages[0].Actions[0].Name())
+
+	result := gostage.RunWorkflow(wf, gostage.DefaultRunOptions())
+	require.NoError(t, result.Error)
+
+	ran, err := store.Get[[]string](wf.Store, "ran")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"compile"}, ran)
+
+	target, err := store.Get[string](wf.Store, "target")
+	require.NoError(t, err)
+	assert.Equal(t, "linux", target)
+}
+
+func TestLoadJSONFile(t *testing.T) {
+	registerTestActions()
+
+	path := filepath.Join(t.TempDir(), "wf.json")
+	json := `{"id":"json-wf","stages":[{"id":"s1","actions":[{"action":"definition-record","name":"a"}]}]}`
+	require.NoError(t, os.WriteFile(path, []byte(json), 0o644))
+
+	wf, err := LoadFile(path)
+	require.NoError(t, err)
+	result := gostage.RunWorkflow(wf, gostage.DefaultRunOptions())
+	require.NoError(t, result.Error)
+
+	ran, _ := store.Get[[]string](wf.Store, "ran")
+	assert.Equal(t, []string{"a"}, ran)
+}
+
+func TestValidation(t *testing.T) {
+	registerTestActions()
+
+	_, err := Parse([]byte(`stages: []`))
+	assert.ErrorContains(t, err, "missing an id")
+
+	_, err = Parse([]byte(`
+id: dup
+stages:
+  - id: s
+    actions: []
+  - id: s
+    actions: []
+`))
+	assert.ErrorContains(t, err, "duplicate stage id")
+
+	_, err = Parse([]byte(`
+id: bad-cond
+stages:
+  - id: s
+    when:
+      key: x
+    actions: []
+`))
+	assert.ErrorContains(t, err, "exactly one")
+
+	_, err = Load([]byte(`
+id: unknown
+stages:
+  - id: s
+    actions:
+      - action: not-registered
+`))
+	assert.ErrorContains(t, err, "not found in registry")
+}
+
+func TestLoadParams(t *testing.T) {
+	registerTestActions()
+
+	wf, err := Load([]byte(`
+id: parametrized
+params:
+  - name: region
+    required: true
+    default: us-east-1
+  - name: replicas
+    required: true
+stages:
+  - id: s
+    actions:
+      - action: definition-record
+`))
+	require.NoError(t, err)
+
+	assert.ErrorContains(t, wf.Instantiate(nil), "replicas")
+	require.NoError(t, wf.Instantiate(map[string]interface{}{"replicas": 3}))
+
+	region, err := store.Get[string](wf.Store, "region")
+	require.NoError(t, err)
+	assert.Equal(t, "us-east-1", region)
+}
+
+func TestLoadMergePolicy(t *testing.T) {
+	registerTestActions()
+
+	wf, err := Load([]byte(`
+id: merge
+initialData:
+  region: us-east-1
+stages:
+  - id: configure
+    merge: skipIfExists
+    initialData:
+      region: eu-west-1
+    actions:
+      - action: definition-record
+`))
+	require.NoError(t, err)
+	assert.Equal(t, gostage.MergeSkipIfExists, wf.Stages[0].MergePolicy())
+
+	result := gostage.RunWorkflow(wf, gostage.DefaultRunOptions())
+	require.NoError(t, result.Error)
+	assert.Equal(t, "us-east-1", result.FinalStore["region"])
+	require.Len(t, result.InitialDataConflicts, 1)
+	assert.Equal(t, "region", result.InitialDataConflicts[0].Key)
+
+	_, err = Load([]byte("id: merge\nstages:\n  - id: s\n    merge: sometimes\n    actions: []\n"))
+	assert.ErrorContains(t, err, "unknown merge policy 'sometimes'")
+}
+
+func TestLoadStrategy(t *testing.T) {
+	registerTestActions()
+
+	wf, err := Load([]byte(`
+id: streamed
+strategy: parallel
+stages:
+  - id: a
+    actions:
+      - action: definition-record
+  - id: b
+    actions:
+      - action: definition-record
+`))
+	require.NoError(t, err)
+	assert.Equal(t, gostage.StrategyParallel, wf.ExecutionStrategy())
+
+	_, err = Load([]byte("id: streamed\nstrategy: fanout\nstages: []\n"))
+	assert.ErrorContains(t, err, "unknown execution strategy 'fanout'")
+}
@@ -0,0 +1,29 @@
+// Package definition loads declarative workflow documents into gostage workflows.
+//
+// A definition document describes a workflow, its stages and their actions in
+// YAML or JSON, so workflows can be edited by non-Go users and stored alongside
+// the rest of a project's configuration. Actions are referenced by the ID they
+// were registered with through gostage.RegisterAction.
+//
+// A minimal document looks like:
+//
+//	id: deploy
+//	name: Deploy service
+//	initialData:
+//	  region: us-east-1
+//	stages:
+//	  - id: build
+//	    actions:
+//	      - action: compile
+//	  - id: release
+//	    when:
+//	      key: approved
+//	      equals: true
+//	    actions:
+//	      - action: publish
+//	        params:
+//	          channel: stable
+//
+// Stages and actions may carry a "when" condition evaluated against the workflow
+// store at execution time; when the condition does not hold they are skipped.
+package definition
@@ -0,0 +1,295 @@
+package gostage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/davidroman0O/gostage/store"
+)
+
+// pendingRunsBlobID is the blob holding the pending delayed runs of a runner.
+const pendingRunsBlobID = "gostage-pending-runs"
+
+// DelayedRun is a workflow scheduled to run once at a later time.
+type DelayedRun struct {
+	// ID identifies the delayed run
+	ID string
+	// Workflow is the workflow to run
+	Workflow *Workflow
+	// At is when the workflow is due to start
+	At time.Time
+
+	runner *Runner
+	timer  Timer
+	done   chan struct{}
+	result RunResult
+}
+
+// Done returns a channel that is closed once the workflow has finished or the
+// run was cancelled.
+func (d *DelayedRun) Done() <-chan struct{} {
+	return d.done
+}
+
+// Wait blocks until the workflow has finished and returns its result.
+// A cancelled run returns a result with ErrDelayedRunCancelled.
+func (d *DelayedRun) Wait() RunResult {
+	<-d.done
+	return d.result
+}
+
+// Cancel removes the run from the schedule. It reports whether the run was
+// still pending.
+func (d *DelayedRun) Cancel() bool {
+	return d.runner.delayed.cancel(d)
+}
+
+// ErrDelayedRunCancelled is the error of a delayed run cancelled before it started.
+var ErrDelayedRunCancelled = errors.New("delayed run cancelled")
+
+// pendingRun is the persisted form of a DelayedRun.
+type pendingRun struct {
+	ID         string          `json:"id"`
+	At         time.Time       `json:"at"`
+	Definition *SubWorkflowDef `json:"definition"`
+}
+
+// delayedRuns tracks the pending delayed runs of a runner and persists them
+// to the schedule backend, if any.
+type delayedRuns struct {
+	mu      sync.Mutex
+	runs    map[string]*DelayedRun
+	defs    map[string]*SubWorkflowDef
+	backend store.BlobBackend
+}
+
+func newDelayedRuns() *delayedRuns {
+	return &delayedRuns{
+		runs: make(map[string]*DelayedRun),
+		defs: make(map[string]*SubWorkflowDef),
+	}
+}
+
+// persist writes the pending runs to the backend. It must be called with mu held.
+func (d *delayedRuns) persist() error {
+	if d.backend == nil {
+		return nil
+	}
+
+	pending := make([]pendingRun, 0, len(d.defs))
+	for id, def := range d.defs {
+		pending = append(pending, pendingRun{ID: id, At: d.runs[id].At, Definition: def})
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].At.Before(pending[j].At) })
+
+	data, err := json.Marshal(pending)
+	if err != nil {
+		return fmt.Errorf("failed to serialize pending runs: %w", err)
+	}
+	if _, err := d.backend.Write(pendingRunsBlobID, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to persist pending runs: %w", err)
+	}
+	return nil
+}
+
+// cancel removes a pending run and completes it as cancelled.
+func (d *delayedRuns) cancel(run *DelayedRun) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.runs[run.ID]; !ok {
+		return false
+	}
+	run.timer.Stop()
+	delete(d.runs, run.ID)
+	delete(d.defs, run.ID)
+	if err := d.persist(); err != nil {
+		run.runner.defaultLogger.Warn("%v", err)
+	}
+
+	run.result = RunResult{WorkflowID: run.Workflow.ID, Error: ErrDelayedRunCancelled}
+	close(run.done)
+	return true
+}
+
+// WithScheduleBackend persists the pending runs of ExecuteAt and ExecuteAfter
+// in backend, so they can be restored with RestorePending after a restart.
+// Delayed workflows must then be serializable with ToDef.
+func WithScheduleBackend(backend store.BlobBackend) RunnerOption {
+	return func(r *Runner) {
+		r.delayed.backend = backend
+	}
+}
+
+// ExecuteAfter runs the workflow on the runner's worker pool once delay has elapsed.
+func (r *Runner) ExecuteAfter(delay time.Duration, workflow *Workflow) (*DelayedRun, error) {
+	return r.ExecuteAt(r.now().Add(delay), workflow)
+}
+
+// ExecuteAt runs the workflow on the runner's worker pool at the given time.
+// A time in the past runs the workflow right away.
+func (r *Runner) ExecuteAt(at time.Time, workflow *Workflow) (*DelayedRun, error) {
+	if workflow == nil {
+		return nil, fmt.Errorf("cannot schedule a nil workflow")
+	}
+
+	var def *SubWorkflowDef
+	if r.delayed.backend != nil {
+		var err error
+		if def, err = workflow.ToDef(); err != nil {
+			return nil, fmt.Errorf("failed to schedule workflow '%s': %w", workflow.ID, err)
+		}
+	}
+
+	return r.scheduleDelayed(newRunID(), at, workflow, def)
+}
+
+// scheduleDelayed registers a delayed run, persists it and arms its timer.
+func (r *Runner) scheduleDelayed(id string, at time.Time, workflow *Workflow, def *SubWorkflowDef) (*DelayedRun, error) {
+	run := &DelayedRun{
+		ID:       id,
+		Workflow: workflow,
+		At:       at,
+		runner:   r,
+		done:     make(chan struct{}),
+	}
+
+	r.delayed.mu.Lock()
+	defer r.delayed.mu.Unlock()
+
+	r.delayed.runs[id] = run
+	if def != nil {
+		r.delayed.defs[id] = def
+	}
+	if err := r.delayed.persist(); err != nil {
+		delete(r.delayed.runs, id)
+		delete(r.delayed.defs, id)
+		return nil, fmt.Errorf("failed to schedule workflow '%s': %w", workflow.ID, err)
+	}
+
+	run.timer = afterFunc(r.Clock(), at.Sub(r.now()), func() { r.fireDelayed(run) })
+	return run, nil
+}
+
+// fireDelayed submits a due run to the worker pool.
+func (r *Runner) fireDelayed(run *DelayedRun) {
+	r.delayed.mu.Lock()
+	if _, ok := r.delayed.runs[run.ID]; !ok {
+		r.delayed.mu.Unlock()
+		return
+	}
+	delete(r.delayed.runs, run.ID)
+	delete(r.delayed.defs, run.ID)
+	if err := r.delayed.persist(); err != nil {
+		r.defaultLogger.Warn("%v", err)
+	}
+	r.delayed.mu.Unlock()
+
+	job, err := r.Submit(run.Workflow)
+	if err != nil {
+		run.result = RunResult{WorkflowID: run.Workflow.ID, Error: err}
+		close(run.done)
+		return
+	}
+	go func() {
+		run.result = job.Wait()
+		close(run.done)
+	}()
+}
+
+// PendingRuns returns the delayed runs that have not started yet, soonest first.
+func (r *Runner) PendingRuns() []*DelayedRun {
+	r.delayed.mu.Lock()
+	defer r.delayed.mu.Unlock()
+
+	runs := make([]*DelayedRun, 0, len(r.delayed.runs))
+	for _, run := range r.delayed.runs {
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].At.Before(runs[j].At) })
+	return runs
+}
+
+// RestorePending reschedules the delayed runs persisted in the schedule
+// backend, rebuilding their workflows from the default action registry.
+// Runs that fell due while the runner was down start right away.
+func (r *Runner) RestorePending() ([]*DelayedRun, error) {
+	return r.RestorePendingWithRegistry(defaultActionRegistry)
+}
+
+// RestorePendingWithRegistry reschedules the persisted delayed runs, rebuilding
+// their workflows from the given registry.
+func (r *Runner) RestorePendingWithRegistry(registry *ActionRegistry) ([]*DelayedRun, error) {
+	if r.delayed.backend == nil {
+		return nil, fmt.Errorf("no schedule backend configured")
+	}
+
+	reader, err := r.delayed.backend.Open(pendingRunsBlobID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read pending runs: %w", err)
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pending runs: %w", err)
+	}
+
+	var pending []pendingRun
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return nil, fmt.Errorf("failed to parse pending runs: %w", err)
+	}
+
+	runs := make([]*DelayedRun, 0, len(pending))
+	for _, p := range pending {
+		r.delayed.mu.Lock()
+		_, exists := r.delayed.runs[p.ID]
+		r.delayed.mu.Unlock()
+		if exists {
+			continue
+		}
+
+		workflow, err := NewWorkflowFromDefWithRegistry(p.Definition, registry)
+		if err != nil {
+			return runs, fmt.Errorf("failed to restore pending run '%s': %w", p.ID, err)
+		}
+		run, err := r.scheduleDelayed(p.ID, p.At, workflow, p.Definition)
+		if err != nil {
+			return runs, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// stopDelayed disarms the timers of the pending runs without removing them
+// from the schedule backend, so they can be restored by the next runner.
+func (r *Runner) stopDelayed() {
+	r.delayed.mu.Lock()
+	defer r.delayed.mu.Unlock()
+
+	for _, run := range r.delayed.runs {
+		run.timer.Stop()
+		run.result = RunResult{WorkflowID: run.Workflow.ID, Error: ErrRunnerClosed}
+		close(run.done)
+	}
+	r.delayed.runs = make(map[string]*DelayedRun)
+	r.delayed.defs = make(map[string]*SubWorkflowDef)
+}
+
+// newRunID returns a random hexadecimal run ID.
+func newRunID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,120 @@
+package gostage
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/davidroman0O/gostage/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteAfter(t *testing.T) {
+	runner := NewRunner()
+	defer runner.Close()
+
+	var ran int32
+	start := time.Now()
+	run, err := runner.ExecuteAfter(20*time.Millisecond, newPoolWorkflow("later", func(ctx *ActionContext) error {
+		atomic.AddInt32(&ran, 1)
+		return nil
+	}))
+	require.NoError(t, err)
+	assert.NotEmpty(t, run.ID)
+	assert.Equal(t, []*DelayedRun{run}, runner.PendingRuns())
+
+	result := run.Wait()
+	assert.True(t, result.Success)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&ran))
+	assert.Empty(t, runner.PendingRuns())
+
+	past, err := runner.ExecuteAt(time.Now().Add(-time.Hour), newPoolWorkflow("overdue", func(ctx *ActionContext) error { return nil }))
+	require.NoError(t, err)
+	assert.True(t, past.Wait().Success)
+}
+
+func TestDelayedRunCancel(t *testing.T) {
+	runner := NewRunner()
+	defer runner.Close()
+
+	var ran int32
+	run, err := runner.ExecuteAfter(time.Hour, newPoolWorkflow("never", func(ctx *ActionContext) error {
+		atomic.AddInt32(&ran, 1)
+		return nil
+	}))
+	require.NoError(t, err)
+
+	assert.True(t, run.Cancel())
+	assert.False(t, run.Cancel())
+	assert.ErrorIs(t, run.Wait().Error, ErrDelayedRunCancelled)
+	assert.Empty(t, runner.PendingRuns())
+	assert.Equal(t, int32(0), atomic.LoadInt32(&ran))
+}
+
+func TestDelayedRunsSurviveRestart(t *testing.T) {
+	registry := NewActionRegistry()
+	var ran int32
+	require.NoError(t, registry.Register("count", func() Action {
+		return NewTestAction("count", "", func(ctx *ActionContext) error {
+			atomic.AddInt32(&ran, 1)
+			return nil
+		})
+	}))
+	newWorkflow := func(id string) *Workflow {
+		wf := NewWorkflow(id, id, "")
+		stage := NewStage("stage", "Stage", "")
+		action, err := registry.Resolve("count", nil)
+		require.NoError(t, err)
+		stage.AddAction(action)
+		wf.AddStage(stage)
+		return wf
+	}
+
+	backend, err := store.NewFileBlobBackend(t.TempDir())
+	require.NoError(t, err)
+
+	first := NewRunner(WithScheduleBackend(backend))
+	soon, err := first.ExecuteAfter(30*time.Millisecond, newWorkflow("soon"))
+	require.NoError(t, err)
+	later, err := first.ExecuteAfter(time.Hour, newWorkflow("later"))
+	require.NoError(t, err)
+	cancelled, err := first.ExecuteAfter(time.Hour, newWorkflow("cancelled"))
+	require.NoError(t, err)
+	require.True(t, cancelled.Cancel())
+
+	_, err = first.ExecuteAfter(time.Hour, newPoolWorkflow("unregistered", func(ctx *ActionContext) error { return nil }))
+	assert.Error(t, err)
+
+	first.Close()
+	assert.ErrorIs(t, soon.Wait().Error, ErrRunnerClosed)
+	time.Sleep(40 * time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&ran))
+
+	second := NewRunner(WithScheduleBackend(backend))
+	defer second.Close()
+	restored, err := second.RestorePendingWithRegistry(registry)
+	require.NoError(t, err)
+	require.Len(t, restored, 2)
+	assert.Equal(t, soon.ID, restored[0].ID)
+	assert.Equal(t, "soon", restored[0].Workflow.ID)
+	assert.Equal(t, later.ID, restored[1].ID)
+	assert.True(t, later.At.Equal(restored[1].At))
+
+	assert.True(t, restored[0].Wait().Success)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&ran))
+	require.Len(t, second.PendingRuns(), 1)
+	assert.Equal(t, "later", second.PendingRuns()[0].Workflow.ID)
+}
+
+func TestRestorePendingWithoutBackend(t *testing.T) {
+	_, err := NewRunner().RestorePending()
+	assert.Error(t, err)
+
+	backend, err := store.NewFileBlobBackend(t.TempDir())
+	require.NoError(t, err)
+	runs, err := NewRunner(WithScheduleBackend(backend)).RestorePending()
+	require.NoError(t, err)
+	assert.Empty(t, runs)
+}
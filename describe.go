@@ -0,0 +1,259 @@
+package gostage
+
+import "reflect"
+
+// ParamDescription describes a parameter of a workflow.
+type ParamDescription struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Type is the JSON type of the parameter: "string", "integer", "number",
+	// "boolean", "array" or "object". It is inferred from the default value,
+	// or from the type of parameters without one, and is empty for untyped
+	// parameters without a default.
+	Type string `json:"type,omitempty"`
+	// ParamType is the type of the parameter or, for untyped parameters, the
+	// type of its default value
+	ParamType ParamType   `json:"paramType,omitempty"`
+	Required  bool        `json:"required,omitempty"`
+	Default   interface{} `json:"default,omitempty"`
+}
+
+// ActionDescription describes what an action does and which store keys it
+// reads and writes.
+type ActionDescription struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	// Params are the parameters the action expects to find in the store,
+	// under their names
+	Params []ParamDescription `json:"params,omitempty"`
+	// Requires are the store keys the action reads
+	Requires []string `json:"requires,omitempty"`
+	// Produces are the store keys the action writes
+	Produces []string `json:"produces,omitempty"`
+}
+
+// DescribedAction is implemented by actions that describe themselves, so that
+// tools can document a workflow and generate forms for its inputs without
+// running it. Fields left empty are filled in by DescribeAction.
+type DescribedAction interface {
+	Describe() ActionDescription
+}
+
+// DescribeAction returns the description of action, taken from its Describe
+// method if it has one, with the name, description and tags of the action
+// filling in the fields it left empty.
+func DescribeAction(action Action) ActionDescription {
+	var d ActionDescription
+	if described, ok := action.(DescribedAction); ok {
+		d = described.Describe()
+	}
+	if d.Name == "" {
+		d.Name = action.Name()
+	}
+	if d.Description == "" {
+		d.Description = action.Description()
+	}
+	if len(d.Tags) == 0 && len(action.Tags()) > 0 {
+		d.Tags = action.Tags()
+	}
+	return d
+}
+
+// StageDescription describes a stage and its actions.
+type StageDescription struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	// Consumes and Produces are the keys of the store contracts of the stage
+	Consumes []string            `json:"consumes,omitempty"`
+	Produces []string            `json:"produces,omitempty"`
+	Actions  []ActionDescription `json:"actions,omitempty"`
+}
+
+// WorkflowDescription describes a workflow, its parameters and its stages.
+type WorkflowDescription struct {
+	ID          string             `json:"id"`
+	Name        string             `json:"name,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Version     string             `json:"version,omitempty"`
+	Tags        []string           `json:"tags,omitempty"`
+	Params      []ParamDescription `json:"params,omitempty"`
+	Stages      []StageDescription `json:"stages,omitempty"`
+	// Requires are the store keys read by stages or actions that no
+	// parameter, binding, initial data or earlier stage or action provides,
+	// in the order they are first read. The caller must put them in the store
+	// before running the workflow.
+	Requires []string `json:"requires,omitempty"`
+	// Produces are the store keys written by the stages and actions
+	Produces []string `json:"produces,omitempty"`
+}
+
+// Describe returns the description of the workflow, aggregating the
+// parameters it declares and the descriptions of its stages and actions.
+// Parameters of actions that the workflow does not declare, and whose key
+// nothing else provides, are added to its parameters.
+// Actions describe the store keys they use by implementing DescribedAction;
+// typed function actions, ForEachAction and BatchAction do so out of the box.
+func (w *Workflow) Describe() WorkflowDescription {
+	d := WorkflowDescription{
+		ID:          w.ID,
+		Name:        w.Name,
+		Description: w.Description,
+		Version:     w.Version,
+		Tags:        w.Tags,
+	}
+
+	provided := make(map[string]bool)
+	for _, key := range w.Store.ListKeys() {
+		provided[key] = true
+	}
+	for _, p := range w.params {
+		d.Params = append(d.Params, describeParam(p))
+		provided[p.Name] = true
+	}
+	for _, b := range w.bindings {
+		provided[b.Key] = true
+	}
+
+	produced := make(map[string]bool)
+	require := func(keys []string) {
+		for _, key := range keys {
+			if !provided[key] {
+				provided[key] = true
+				d.Requires = append(d.Requires, key)
+			}
+		}
+	}
+	produce := func(keys []string) {
+		for _, key := range keys {
+			provided[key] = true
+			if !produced[key] {
+				produced[key] = true
+				d.Produces = append(d.Produces, key)
+			}
+		}
+	}
+
+	for _, stage := range w.Stages {
+		sd := StageDescription{
+			ID:          stage.ID,
+			Name:        stage.Name,
+			Description: stage.Description,
+			Tags:        stage.Tags,
+			Consumes:    schemaKeys(stage.consumes),
+			Produces:    schemaKeys(stage.produces),
+		}
+		if stage.initialStore != nil {
+			for _, key := range stage.initialStore.ListKeys() {
+				provided[key] = true
+			}
+		}
+		require(sd.Consumes)
+		for _, action := range stage.Actions {
+			ad := DescribeAction(action)
+			for _, param := range ad.Params {
+				if !provided[param.Name] {
+					provided[param.Name] = true
+					d.Params = append(d.Params, param)
+				}
+			}
+			require(ad.Requires)
+			produce(ad.Produces)
+			sd.Actions = append(sd.Actions, ad)
+		}
+		produce(sd.Produces)
+		d.Stages = append(d.Stages, sd)
+	}
+	return d
+}
+
+// describeParam describes a parameter declared with AddParam.
+func describeParam(p Param) ParamDescription {
+	d := ParamDescription{Name: p.Name, Description: p.Description, Required: p.Required, ParamType: p.valueType()}
+	if p.HasDefault {
+		d.Default = p.Default
+		d.Type = jsonType(p.Default)
+	}
+	if d.Type == "" {
+		d.Type = d.ParamType.jsonType()
+	}
+	return d
+}
+
+// jsonType returns the JSON type of the values of the type, or "" for ParamAny.
+func (t ParamType) jsonType() string {
+	switch t {
+	case ParamString, ParamDuration:
+		return "string"
+	case ParamInt:
+		return "integer"
+	case ParamFloat:
+		return "number"
+	case ParamBool:
+		return "boolean"
+	case ParamList:
+		return "array"
+	}
+	return ""
+}
+
+// jsonType returns the JSON type of value, or "" if it has none.
+func jsonType(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	switch reflect.TypeOf(value).Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+	return ""
+}
+
+// schemaKeys returns the keys of a stage contract in declaration order.
+func schemaKeys(schemas []keySchema) []string {
+	var keys []string
+	for _, schema := range schemas {
+		keys = append(keys, schema.key)
+	}
+	return keys
+}
+
+// Describe reports the input and output keys of the action.
+func (a *typedFuncAction[I, O]) Describe() ActionDescription {
+	var d ActionDescription
+	if a.inputKey != "" {
+		d.Requires = []string{a.inputKey}
+	}
+	if a.outputKey != "" {
+		d.Produces = []string{a.outputKey}
+	}
+	return d
+}
+
+// Describe reports the items key and the results key of the action.
+func (a *ForEachAction[T]) Describe() ActionDescription {
+	return ActionDescription{Requires: []string{a.itemsKey}, Produces: []string{a.options.resultsKey}}
+}
+
+// Describe reports the results key of the action.
+func (a *MapAction) Describe() ActionDescription {
+	return ActionDescription{Produces: []string{a.options.resultsKey}}
+}
+
+// Describe reports the items key and the report key of the action.
+func (a *BatchAction[T]) Describe() ActionDescription {
+	return ActionDescription{Requires: []string{a.itemsKey}, Produces: []string{a.options.resultsKey}}
+}
@@ -0,0 +1,76 @@
+package gostage
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chargeAction describes the parameters and keys it uses.
+type chargeAction struct {
+	BaseAction
+}
+
+func (a *chargeAction) Execute(ctx *ActionContext) error { return nil }
+
+func (a *chargeAction) Describe() ActionDescription {
+	return ActionDescription{
+		Params:   []ParamDescription{{Name: "currency", Type: "string", ParamType: ParamString, Default: "EUR"}, {Name: "region"}},
+		Requires: []string{"invoice", "batch"},
+		Produces: []string{"receipt"},
+	}
+}
+
+func TestWorkflowDescribe(t *testing.T) {
+	wf := NewWorkflow("billing", "Billing", "Bills customers")
+	wf.Version = "1.2.0"
+	wf.AddParam("region", Required, Describe("Region to bill"))
+	wf.AddParam("retries", Default(3))
+	wf.AddParam("ratio", OfType(ParamFloat))
+
+	load := NewStage("load", "Load", "")
+	require.NoError(t, load.Consumes("customer", `{"type": "object"}`))
+	require.NoError(t, load.SetInitialData("batch", 10))
+	load.AddAction(NewFuncAction("invoice", func(ctx *ActionContext, customer map[string]interface{}) (string, error) {
+		return "", nil
+	}, WithInputKey("customer"), WithOutputKey("invoice")))
+	bill := NewStage("bill", "Bill", "")
+	bill.AddAction(&chargeAction{BaseAction: NewBaseAction("charge", "Charges the invoice")})
+	bill.AddAction(NewBatchAction("notify", "recipients", 10, func(ctx *ActionContext, batch []string) error {
+		return nil
+	}))
+	wf.AddStage(load)
+	wf.AddStage(bill)
+
+	d := wf.Describe()
+	assert.Equal(t, "billing", d.ID)
+	assert.Equal(t, "1.2.0", d.Version)
+	assert.Equal(t, []ParamDescription{
+		{Name: "region", Description: "Region to bill", Required: true},
+		{Name: "retries", Type: "integer", ParamType: ParamInt, Default: 3},
+		{Name: "ratio", Type: "number", ParamType: ParamFloat},
+		{Name: "currency", Type: "string", ParamType: ParamString, Default: "EUR"},
+	}, d.Params)
+	assert.Equal(t, []string{"customer", "recipients"}, d.Requires)
+	assert.Equal(t, []string{"invoice", "receipt", "notify.report"}, d.Produces)
+
+	require.Len(t, d.Stages, 2)
+	assert.Equal(t, []string{"customer"}, d.Stages[0].Consumes)
+	assert.Equal(t, ActionDescription{Name: "invoice", Requires: []string{"customer"}, Produces: []string{"invoice"}}, d.Stages[0].Actions[0])
+	assert.Equal(t, "Charges the invoice", d.Stages[1].Actions[0].Description)
+
+	encoded, err := json.Marshal(d.Params[1])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name": "retries", "type": "integer", "paramType": "int", "default": 3}`, string(encoded))
+
+	encoded, err = json.Marshal(d.Stages[1].Actions[1])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name": "notify", "description": "Processes the items of 'recipients' in batches of 10", "requires": ["recipients"], "produces": ["notify.report"]}`, string(encoded))
+}
+
+func TestDescribeAction(t *testing.T) {
+	action := NewTestActionWithTags("plain", "Does nothing", []string{"noop"}, nil)
+	assert.Equal(t, ActionDescription{Name: "plain", Description: "Does nothing", Tags: []string{"noop"}}, DescribeAction(action))
+}
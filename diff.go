@@ -0,0 +1,211 @@
+package gostage
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ChangeType describes how a stage or action differs between two definitions.
+type ChangeType string
+
+// Change types reported by Diff
+const (
+	// ChangeAdded indicates the item only exists in the new definition
+	ChangeAdded ChangeType = "added"
+	// ChangeRemoved indicates the item only exists in the old definition
+	ChangeRemoved ChangeType = "removed"
+	// ChangeRenamed indicates the item exists in both definitions under a different name
+	ChangeRenamed ChangeType = "renamed"
+)
+
+// DefChange is a single structural difference between two workflow definitions.
+type DefChange struct {
+	// Type is the kind of change.
+	Type ChangeType
+	// StageID is the ID of the stage the change applies to.
+	StageID string
+	// ActionID is the registered ID of the action, empty for stage changes.
+	ActionID string
+	// OldName is the name in the old definition, empty for additions.
+	OldName string
+	// NewName is the name in the new definition, empty for removals.
+	NewName string
+}
+
+// DefDiff reports the structural differences between two workflow definitions.
+type DefDiff struct {
+	// OldVersion is the version of the old definition.
+	OldVersion string
+	// NewVersion is the version of the new definition.
+	NewVersion string
+	// Stages lists the added, removed and renamed stages.
+	Stages []DefChange
+	// Actions lists the added, removed and renamed actions within stages
+	// present in both definitions.
+	Actions []DefChange
+}
+
+// Diff compares two workflow definitions and reports the stages and actions
+// that were added, removed or renamed.
+//
+// Stages are matched by ID, so a stage keeps its identity as long as its ID is
+// unchanged. Actions are matched by name within a stage; an action that was
+// removed and an action that was added with the same registered ID are reported
+// as a rename. Actions of added or removed stages are not listed individually.
+func Diff(oldDef, newDef *SubWorkflowDef) *DefDiff {
+	if oldDef == nil {
+		oldDef = &SubWorkflowDef{}
+	}
+	if newDef == nil {
+		newDef = &SubWorkflowDef{}
+	}
+
+	diff := &DefDiff{
+		OldVersion: oldDef.Version,
+		NewVersion: newDef.Version,
+	}
+
+	oldStages := make(map[string]StageDef, len(oldDef.Stages))
+	for _, stage := range oldDef.Stages {
+		oldStages[stage.ID] = stage
+	}
+	newStages := make(map[string]StageDef, len(newDef.Stages))
+	for _, stage := range newDef.Stages {
+		newStages[stage.ID] = stage
+	}
+
+	for _, stage := range oldDef.Stages {
+		if _, ok := newStages[stage.ID]; !ok {
+			diff.Stages = append(diff.Stages, DefChange{Type: ChangeRemoved, StageID: stage.ID, OldName: stage.Name})
+		}
+	}
+
+	for _, stage := range newDef.Stages {
+		old, ok := oldStages[stage.ID]
+		if !ok {
+			diff.Stages = append(diff.Stages, DefChange{Type: ChangeAdded, StageID: stage.ID, NewName: stage.Name})
+			continue
+		}
+		if old.Name != stage.Name {
+			diff.Stages = append(diff.Stages, DefChange{Type: ChangeRenamed, StageID: stage.ID, OldName: old.Name, NewName: stage.Name})
+		}
+		diff.Actions = append(diff.Actions, diffActions(stage.ID, old.Actions, stage.Actions)...)
+	}
+
+	return diff
+}
+
+// diffActions compares the actions of a stage present in both definitions.
+func diffActions(stageID string, oldActions, newActions []ActionDef) []DefChange {
+	oldNames := make(map[string]bool, len(oldActions))
+	for _, action := range oldActions {
+		oldNames[actionDefName(action)] = true
+	}
+	newNames := make(map[string]bool, len(newActions))
+	for _, action := range newActions {
+		newNames[actionDefName(action)] = true
+	}
+
+	var removed, added []ActionDef
+	for _, action := range oldActions {
+		if !newNames[actionDefName(action)] {
+			removed = append(removed, action)
+		}
+	}
+	for _, action := range newActions {
+		if !oldNames[actionDefName(action)] {
+			added = append(added, action)
+		}
+	}
+
+	var changes []DefChange
+
+	// Pair removed and added actions of the same type, in order, as renames
+	for i := 0; i < len(removed); i++ {
+		for j := 0; j < len(added); j++ {
+			if removed[i].ID != added[j].ID {
+				continue
+			}
+			changes = append(changes, DefChange{
+				Type:     ChangeRenamed,
+				StageID:  stageID,
+				ActionID: added[j].ID,
+				OldName:  actionDefName(removed[i]),
+				NewName:  actionDefName(added[j]),
+			})
+			removed = append(removed[:i], removed[i+1:]...)
+			added = append(added[:j], added[j+1:]...)
+			i--
+			break
+		}
+	}
+
+	for _, action := range removed {
+		changes = append(changes, DefChange{Type: ChangeRemoved, StageID: stageID, ActionID: action.ID, OldName: actionDefName(action)})
+	}
+	for _, action := range added {
+		changes = append(changes, DefChange{Type: ChangeAdded, StageID: stageID, ActionID: action.ID, NewName: actionDefName(action)})
+	}
+	return changes
+}
+
+// actionDefName returns the name an action definition resolves to.
+// Definitions without a name override use the registered ID.
+func actionDefName(action ActionDef) string {
+	if action.Name != "" {
+		return action.Name
+	}
+	return action.ID
+}
+
+// HasChanges reports whether the definitions differ structurally.
+func (d *DefDiff) HasChanges() bool {
+	return len(d.Stages) > 0 || len(d.Actions) > 0
+}
+
+// String renders the diff as a human-readable summary, one change per line.
+func (d *DefDiff) String() string {
+	var b strings.Builder
+	if d.OldVersion != "" || d.NewVersion != "" {
+		fmt.Fprintf(&b, "version %s -> %s\n", versionLabel(d.OldVersion), versionLabel(d.NewVersion))
+	}
+	for _, change := range d.Stages {
+		b.WriteString(change.String())
+		b.WriteString("\n")
+	}
+	for _, change := range d.Actions {
+		b.WriteString(change.String())
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// String renders the change as a single line.
+func (c DefChange) String() string {
+	subject := "stage " + c.StageID
+	if c.ActionID != "" {
+		subject = fmt.Sprintf("action %s (%s)", c.StageID, c.ActionID)
+	}
+
+	switch c.Type {
+	case ChangeAdded:
+		if c.ActionID != "" {
+			return fmt.Sprintf("+ %s: %s", subject, c.NewName)
+		}
+		return "+ " + subject
+	case ChangeRemoved:
+		if c.ActionID != "" {
+			return fmt.Sprintf("- %s: %s", subject, c.OldName)
+		}
+		return "- " + subject
+	default:
+		return fmt.Sprintf("~ %s: %q -> %q", subject, c.OldName, c.NewName)
+	}
+}
+
+func versionLabel(version string) string {
+	if version == "" {
+		return "(none)"
+	}
+	return version
+}
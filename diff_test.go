@@ -0,0 +1,75 @@
+package gostage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	oldDef := &SubWorkflowDef{
+		ID:      "deploy",
+		Version: "1",
+		Stages: []StageDef{
+			{ID: "build", Name: "Build", Actions: []ActionDef{
+				{ID: "compile"},
+				{ID: "http-get", Name: "fetch-deps"},
+				{ID: "noop", Name: "lint"},
+			}},
+			{ID: "test", Name: "Test", Actions: []ActionDef{{ID: "noop"}}},
+		},
+	}
+	newDef := &SubWorkflowDef{
+		ID:      "deploy",
+		Version: "2",
+		Stages: []StageDef{
+			{ID: "build", Name: "Compile", Actions: []ActionDef{
+				{ID: "compile"},
+				{ID: "http-get", Name: "download-deps"},
+				{ID: "vet"},
+			}},
+			{ID: "release", Name: "Release", Actions: []ActionDef{{ID: "noop"}}},
+		},
+	}
+
+	diff := Diff(oldDef, newDef)
+	assert.True(t, diff.HasChanges())
+	assert.Equal(t, "1", diff.OldVersion)
+	assert.Equal(t, "2", diff.NewVersion)
+
+	assert.Equal(t, []DefChange{
+		{Type: ChangeRemoved, StageID: "test", OldName: "Test"},
+		{Type: ChangeRenamed, StageID: "build", OldName: "Build", NewName: "Compile"},
+		{Type: ChangeAdded, StageID: "release", NewName: "Release"},
+	}, diff.Stages)
+
+	assert.Equal(t, []DefChange{
+		{Type: ChangeRenamed, StageID: "build", ActionID: "http-get", OldName: "fetch-deps", NewName: "download-deps"},
+		{Type: ChangeRemoved, StageID: "build", ActionID: "noop", OldName: "lint"},
+		{Type: ChangeAdded, StageID: "build", ActionID: "vet", NewName: "vet"},
+	}, diff.Actions)
+
+	assert.Equal(t, `version 1 -> 2
+- stage test
+~ stage build: "Build" -> "Compile"
++ stage release
+~ action build (http-get): "fetch-deps" -> "download-deps"
+- action build (noop): lint
++ action build (vet): vet
+`, diff.String())
+}
+
+func TestDiffIdentical(t *testing.T) {
+	def := &SubWorkflowDef{
+		ID:     "wf",
+		Stages: []StageDef{{ID: "s1", Actions: []ActionDef{{ID: "noop"}, {ID: "noop", Name: "second"}}}},
+	}
+
+	diff := Diff(def, def)
+	assert.False(t, diff.HasChanges())
+	assert.Empty(t, diff.String())
+
+	added := Diff(nil, def)
+	assert.Equal(t, []DefChange{{Type: ChangeAdded, StageID: "s1"}}, added.Stages)
+	assert.Empty(t, added.Actions)
+}
@@ -0,0 +1,93 @@
+package gostage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// StageDispatcher executes stages outside of the runner's process, such as on
+// remote workers. The runner hands it the stages tagged with TagRemote.
+//
+// Dispatch runs def, a workflow holding the single stage to execute, and
+// feeds the IPC messages written by RunDefinition on the executing side to
+// broker.Listen. It returns once the executor has reported the outcome of the
+// stage, or with an error if the stage could not be delivered or its executor
+// was lost. The stage's own failure is reported through the streamed messages.
+type StageDispatcher interface {
+	Dispatch(ctx context.Context, def SubWorkflowDef, broker *RunnerBroker) error
+}
+
+// WithStageDispatcher makes the runner execute the stages tagged with TagRemote
+// through dispatcher. Their store changes, logs and action events are applied
+// to the workflow as the dispatcher streams them back, as for spawned stages.
+func WithStageDispatcher(dispatcher StageDispatcher) RunnerOption {
+	return func(r *Runner) {
+		r.dispatcher = dispatcher
+	}
+}
+
+// DispatchAction runs the action registered as id with params through
+// dispatcher, as the only action of a stage, on behalf of the action of ctx.
+// It is how actions delegate their work to another process, such as a plugin.
+//
+// The executor starts from the data the action of ctx may read from the store.
+// The logs it streams back go to ctx.Logger and its store changes to
+// ctx.Store(), so the tags restricting the action restrict them too. The
+// failure of the dispatched action is returned.
+func DispatchAction(ctx *ActionContext, dispatcher StageDispatcher, id string, params map[string]interface{}) error {
+	s := ctx.Store()
+	def := SubWorkflowDef{
+		ID:           ctx.Workflow.ID,
+		Name:         ctx.Workflow.Name,
+		Stages:       []StageDef{{ID: ctx.Stage.ID, Name: ctx.Stage.Name, Actions: []ActionDef{{ID: id, Params: params}}}},
+		InitialStore: userData(s.ExportAll()),
+	}
+
+	broker := NewRunnerBroker(io.Discard)
+	var result *childResult
+	var syncErr error
+	broker.RegisterHandler(MessageTypeLog, relayLog(ctx.Logger))
+	broker.RegisterHandler(MessageTypeStorePut, func(_ MessageType, payload json.RawMessage) error {
+		var msg storePutMessage
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			return err
+		}
+		if err := putRecorded(s, map[string]json.RawMessage{msg.Key: msg.Value}, nil); err != nil && syncErr == nil {
+			syncErr = err
+		}
+		return nil
+	})
+	broker.RegisterHandler(MessageTypeStoreDelete, func(_ MessageType, payload json.RawMessage) error {
+		var msg storeDeleteMessage
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			return err
+		}
+		s.Delete(msg.Key)
+		return nil
+	})
+	broker.RegisterHandler(MessageTypeWorkflowResult, func(_ MessageType, payload json.RawMessage) error {
+		result = &childResult{}
+		return json.Unmarshal(payload, result)
+	})
+
+	goCtx := ctx.GoContext
+	if goCtx == nil {
+		goCtx = context.Background()
+	}
+	dispatchErr := dispatcher.Dispatch(goCtx, def, broker)
+
+	switch {
+	case result != nil && !result.Success:
+		return errors.New(result.Error)
+	case dispatchErr != nil:
+		return dispatchErr
+	case syncErr != nil:
+		return fmt.Errorf("failed to apply the store changes of action '%s': %w", id, syncErr)
+	case result == nil:
+		return fmt.Errorf("action '%s' ended without reporting its outcome", id)
+	}
+	return nil
+}
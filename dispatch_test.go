@@ -0,0 +1,127 @@
+package gostage
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/davidroman0O/gostage/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// inProcessDispatcher runs dispatched stages in the current process, the way a
+// remote worker would on its side of the connection.
+type inProcessDispatcher struct {
+	dispatched []SubWorkflowDef
+}
+
+func (d *inProcessDispatcher) Dispatch(ctx context.Context, def SubWorkflowDef, broker *RunnerBroker) error {
+	d.dispatched = append(d.dispatched, def)
+	data, err := json.Marshal(def)
+	if err != nil {
+		return err
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		RunDefinition(ctx, data, writer, nil)
+		writer.Close()
+	}()
+	return broker.Listen(reader)
+}
+
+func newRemoteStageWorkflow(t *testing.T, actionIDs ...string) *Workflow {
+	wf := newSpawnedStageWorkflow(t, actionIDs...)
+	isolated := wf.Stages[1]
+	isolated.Tags = []string{TagRemote}
+	return wf
+}
+
+func TestRemoteStageThroughDispatcher(t *testing.T) {
+	wf := newRemoteStageWorkflow(t, orderEchoActionID, storeModifierActionID)
+	dispatcher := &inProcessDispatcher{}
+
+	result := NewRunner(WithStageDispatcher(dispatcher)).ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+
+	require.Len(t, dispatcher.dispatched, 1)
+	def := dispatcher.dispatched[0]
+	assert.Equal(t, "orders", def.ID)
+	require.Len(t, def.Stages, 1)
+	assert.Equal(t, "isolated", def.Stages[0].ID)
+	assert.NotContains(t, def.Stages[0].Tags, TagRemote, "the executor must not dispatch the stage again")
+
+	assert.Equal(t, "o-1", result.FinalStore["echo"])
+	assert.Equal(t, "o-1", result.FinalStore["finished"])
+	assert.Equal(t, StatusCompleted, result.StageStatuses["isolated"])
+}
+
+func TestRemoteStageFailureThroughDispatcher(t *testing.T) {
+	wf := newRemoteStageWorkflow(t, errorTestActionID)
+
+	result := NewRunner(WithStageDispatcher(&inProcessDispatcher{})).ExecuteWithOptions(wf, DefaultRunOptions())
+	require.Error(t, result.Error)
+	assert.Contains(t, result.Error.Error(), "remote worker: ")
+	assert.Contains(t, result.Error.Error(), "intentional action failure")
+	assert.Equal(t, StatusFailed, result.StageStatuses["isolated"])
+}
+
+func TestRemoteStageWithoutDispatcher(t *testing.T) {
+	wf := newRemoteStageWorkflow(t, orderEchoActionID)
+
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.Error(t, result.Error)
+	assert.Contains(t, result.Error.Error(), "no stage dispatcher")
+	assert.NotContains(t, result.FinalStore, "echo")
+}
+
+func TestDispatchAction(t *testing.T) {
+	registerSpawnTestActions()
+	dispatcher := &inProcessDispatcher{}
+	delegate := NewActionFunc("delegate", "Runs the echo action through a dispatcher", func(ctx *ActionContext) error {
+		return DispatchAction(ctx, dispatcher, orderEchoActionID, nil)
+	})
+
+	result := runSingleAction(t, context.Background(), delegate, func(wf *Workflow) {
+		require.NoError(t, wf.Store.Put("orderId", "o-7"))
+		require.NoError(t, wf.Store.Put("draft", true))
+	})
+	require.True(t, result.Success, "%v", result.Error)
+
+	require.Len(t, dispatcher.dispatched, 1)
+	def := dispatcher.dispatched[0]
+	require.Len(t, def.Stages, 1)
+	require.Len(t, def.Stages[0].Actions, 1)
+	assert.Equal(t, orderEchoActionID, def.Stages[0].Actions[0].ID)
+	assert.Equal(t, "o-7", def.InitialStore["orderId"])
+
+	assert.Equal(t, "o-7", result.FinalStore["echo"])
+	assert.NotContains(t, result.FinalStore, "draft")
+}
+
+func TestDispatchActionFailure(t *testing.T) {
+	registerSpawnTestActions()
+	delegate := NewActionFunc("delegate", "Runs a failing action through a dispatcher", func(ctx *ActionContext) error {
+		return DispatchAction(ctx, &inProcessDispatcher{}, errorTestActionID, nil)
+	})
+
+	result := runSingleAction(t, context.Background(), delegate, nil)
+	require.Error(t, result.Error)
+	assert.Contains(t, result.Error.Error(), "intentional action failure")
+}
+
+func TestDispatchActionKeepsStoreRestrictions(t *testing.T) {
+	registerSpawnTestActions()
+	delegate := NewTestActionWithTags("delegate", "Runs the echo action through a dispatcher", []string{TagReadOnly}, func(ctx *ActionContext) error {
+		return DispatchAction(ctx, &inProcessDispatcher{}, orderEchoActionID, nil)
+	})
+
+	result := runSingleAction(t, context.Background(), delegate, func(wf *Workflow) {
+		require.NoError(t, wf.Store.Put("orderId", "o-7"))
+	})
+	require.Error(t, result.Error)
+	assert.ErrorIs(t, result.Error, store.ErrReadOnly)
+	assert.NotContains(t, result.FinalStore, "echo")
+}
@@ -0,0 +1,39 @@
+package gostage
+
+// contextDryRun marks a dry run in progress, set by ExecuteWithOptions
+const contextDryRun = "dryRun"
+
+// isDryRun reports whether the run in progress of w is a dry run.
+func isDryRun(w *Workflow) bool {
+	dryRun, _ := w.Context[contextDryRun].(bool)
+	return dryRun
+}
+
+// dryRunStage logs the stage and the actions a run would execute instead of
+// executing them, and marks them skipped. Initial data and branch conditions
+// are not evaluated, so every branch of if and switch stages is reported.
+func (r *Runner) dryRunStage(stage *Stage, w *Workflow, logger Logger) {
+	logger.Info("Dry run: would execute stage %s", stage.Name)
+
+	disabledActions, _ := w.Context["disabledActions"].(map[string]bool)
+	selection := runSelectionOf(w)
+	for _, action := range stage.Actions {
+		if disabledActions[action.Name()] || (selection != nil && !selection.selectsAction(stage, action)) {
+			continue
+		}
+		logger.Info("Dry run: would execute action %s", action.Name())
+		w.setActionStatus(stage.ID, action.Name(), StatusSkipped)
+		r.publish(w, Event{Type: EventActionSkipped, WorkflowID: w.ID, StageID: stage.ID, ActionName: action.Name(), Annotations: mergedAnnotations(w, stage, action)})
+	}
+	disabledStages, _ := w.Context["disabledStages"].(map[string]bool)
+	for _, branch := range stage.Branches() {
+		for _, nested := range branch.Stages {
+			if !disabledStages[nested.ID] && (selection == nil || selection.selectsStage(nested)) {
+				r.dryRunStage(nested, w, logger)
+			}
+		}
+	}
+
+	w.setStageStatus(stage.ID, StatusSkipped)
+	r.publish(w, Event{Type: EventStageSkipped, WorkflowID: w.ID, StageID: stage.ID, Annotations: mergedAnnotations(w, stage, nil)})
+}
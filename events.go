@@ -0,0 +1,233 @@
+package gostage
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventType identifies a workflow lifecycle event.
+// Event types are bit flags, so several can be combined with | when subscribing.
+type EventType uint32
+
+// Lifecycle events emitted by the runner
+const (
+	EventWorkflowStarted EventType = 1 << iota
+	EventWorkflowCompleted
+	EventWorkflowFailed
+	EventStageStarted
+	EventStageCompleted
+	EventStageFailed
+	EventStageSkipped
+	EventActionStarted
+	EventActionCompleted
+	EventActionFailed
+	EventActionSkipped
+	// EventActionRetried is emitted by components that retry actions
+	EventActionRetried
+	// EventActionHedged is emitted when a hedged action starts a duplicate attempt
+	EventActionHedged
+	// EventActionStuck is emitted by the watchdog for actions without recent heartbeats
+	EventActionStuck
+	// EventArtifactAttached is emitted when an action attaches an artifact to the run
+	EventArtifactAttached
+
+	// EventAll matches every event type
+	EventAll EventType = 1<<iota - 1
+)
+
+var eventTypeNames = []string{
+	"workflow.started",
+	"workflow.completed",
+	"workflow.failed",
+	"stage.started",
+	"stage.completed",
+	"stage.failed",
+	"stage.skipped",
+	"action.started",
+	"action.completed",
+	"action.failed",
+	"action.skipped",
+	"action.retried",
+	"action.hedged",
+	"action.stuck",
+	"artifact.attached",
+}
+
+// String returns the dotted name of the event type, such as "stage.started".
+// Combined types are joined with "|".
+func (t EventType) String() string {
+	var names []string
+	for i, name := range eventTypeNames {
+		if t&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// Event is a structured lifecycle event.
+type Event struct {
+	// ID uniquely identifies the event
+	ID string
+	// Type is the kind of event
+	Type EventType
+	// Time is when the event was emitted
+	Time time.Time
+	// WorkflowID is the workflow the event belongs to
+	WorkflowID string
+	// RunID is the run of the workflow the event belongs to
+	RunID string
+	// Tenant is the tenant of the runner that emitted the event, if any
+	Tenant string
+	// Labels are the labels of the run the event belongs to, if any
+	Labels map[string]string
+	// StageID is the stage the event belongs to, if any
+	StageID string
+	// ActionName is the action the event belongs to, if any
+	ActionName string
+	// Error is the failure reported by failed events
+	Error error
+	// Payload carries additional event-specific data
+	Payload map[string]interface{}
+	// Annotations are the annotations of the workflow, stage and action the
+	// event belongs to, the most specific winning
+	Annotations map[string]string
+}
+
+// EventHandler receives the events it subscribed to.
+type EventHandler func(event Event)
+
+// eventSubscription is a handler registered on an EventBus.
+type eventSubscription struct {
+	id      int
+	types   EventType
+	handler EventHandler
+}
+
+// EventBus dispatches events to subscribed handlers.
+// Handlers are called synchronously, in subscription order, on the goroutine
+// that publishes the event, so they should return quickly.
+type EventBus struct {
+	mu            sync.RWMutex
+	subscriptions []eventSubscription
+	nextID        int
+	// subscribed holds the event types with at least one handler, so that
+	// events nobody listens to cost nothing to publish
+	subscribed atomic.Uint32
+}
+
+// NewEventBus creates an empty event bus.
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// Subscribe registers a handler for the given event types and returns a
+// function that removes the subscription.
+func (b *EventBus) Subscribe(types EventType, handler EventHandler) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	id := b.nextID
+	b.subscriptions = append(b.subscriptions, eventSubscription{id: id, types: types, handler: handler})
+	b.updateSubscribed()
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for i, sub := range b.subscriptions {
+			if sub.id == id {
+				b.subscriptions = append(b.subscriptions[:i:i], b.subscriptions[i+1:]...)
+				b.updateSubscribed()
+				return
+			}
+		}
+	}
+}
+
+// updateSubscribed recomputes the subscribed event types. The lock must be held.
+func (b *EventBus) updateSubscribed() {
+	var types EventType
+	for _, sub := range b.subscriptions {
+		types |= sub.types
+	}
+	b.subscribed.Store(uint32(types))
+}
+
+// wants reports whether a handler is subscribed to the event type.
+func (b *EventBus) wants(eventType EventType) bool {
+	return EventType(b.subscribed.Load())&eventType != 0
+}
+
+// Publish sends an event to the matching handlers.
+// The event ID and time are filled in if they are not set.
+func (b *EventBus) Publish(event Event) {
+	if !b.wants(event.Type) {
+		return
+	}
+	if event.ID == "" {
+		event.ID = newEventID()
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	handlers := make([]EventHandler, 0, len(b.subscriptions))
+	for _, sub := range b.subscriptions {
+		if sub.types&event.Type != 0 {
+			handlers = append(handlers, sub.handler)
+		}
+	}
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// eventIDs generates event IDs: a random prefix identifying the process,
+// followed by a counter
+var eventIDs struct {
+	prefix  [8]byte
+	counter atomic.Uint64
+}
+
+func init() {
+	rand.Read(eventIDs.prefix[:])
+}
+
+// newEventID returns a unique hexadecimal event ID.
+func newEventID() string {
+	var buf [16]byte
+	copy(buf[:8], eventIDs.prefix[:])
+	binary.BigEndian.PutUint64(buf[8:], eventIDs.counter.Add(1))
+	return hex.EncodeToString(buf[:])
+}
+
+// Emit publishes an event for the current action through the runner executing
+// the workflow. It is a no-op when the workflow is not run by a Runner.
+func (ctx *ActionContext) Emit(eventType EventType, payload map[string]interface{}) {
+	r, ok := ctx.Workflow.Context["runner"].(*Runner)
+	if !ok {
+		return
+	}
+
+	event := Event{Type: eventType, WorkflowID: ctx.Workflow.ID, Payload: payload}
+	if ctx.Stage != nil {
+		event.StageID = ctx.Stage.ID
+	}
+	if ctx.Action != nil {
+		event.ActionName = ctx.Action.Name()
+	}
+	event.Annotations = mergedAnnotations(ctx.Workflow, ctx.Stage, ctx.Action)
+	r.publish(ctx.Workflow, event)
+}
@@ -0,0 +1,95 @@
+package gostage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventTypeString(t *testing.T) {
+	assert.Equal(t, "stage.started", EventStageStarted.String())
+	assert.Equal(t, "action.failed|action.retried", (EventActionFailed | EventActionRetried).String())
+	assert.Equal(t, "none", EventType(0).String())
+	assert.Contains(t, EventAll.String(), "workflow.started")
+	assert.Contains(t, EventAll.String(), "action.retried")
+}
+
+func TestEventBusSubscribe(t *testing.T) {
+	bus := NewEventBus()
+
+	var received []EventType
+	unsubscribe := bus.Subscribe(EventStageStarted|EventStageFailed, func(e Event) {
+		assert.NotEmpty(t, e.ID)
+		assert.False(t, e.Time.IsZero())
+		received = append(received, e.Type)
+	})
+
+	bus.Publish(Event{Type: EventStageStarted})
+	bus.Publish(Event{Type: EventActionStarted})
+	bus.Publish(Event{Type: EventStageFailed})
+	unsubscribe()
+	bus.Publish(Event{Type: EventStageStarted})
+
+	assert.Equal(t, []EventType{EventStageStarted, EventStageFailed}, received)
+}
+
+func TestRunnerEvents(t *testing.T) {
+	wf := NewWorkflow("events", "Events", "")
+	first := NewStage("first", "First", "")
+	first.AddAction(NewTestAction("work", "", func(ctx *ActionContext) error {
+		ctx.Emit(EventActionRetried, map[string]interface{}{"attempt": 2})
+		return nil
+	}))
+	first.AddAction(NewTestAction("optional", "", func(ctx *ActionContext) error { return nil }))
+	wf.AddStage(first)
+	second := NewStage("second", "Second", "")
+	second.AddAction(NewTestAction("explode", "", func(ctx *ActionContext) error {
+		return errors.New("boom")
+	}))
+	wf.AddStage(second)
+	wf.DisableAction("optional")
+
+	runner := NewRunner()
+	var events []Event
+	runner.Subscribe(EventAll, func(e Event) {
+		events = append(events, e)
+	})
+
+	var failures int
+	runner.Subscribe(EventActionFailed|EventWorkflowFailed, func(e Event) {
+		require.Error(t, e.Error)
+		failures++
+	})
+
+	require.Error(t, runner.Execute(context.Background(), wf, &TestLogger{t: t}))
+
+	var types []EventType
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	assert.Equal(t, []EventType{
+		EventWorkflowStarted,
+		EventStageStarted,
+		EventActionStarted,
+		EventActionRetried,
+		EventActionCompleted,
+		EventActionSkipped,
+		EventStageCompleted,
+		EventStageStarted,
+		EventActionStarted,
+		EventActionFailed,
+		EventStageFailed,
+		EventWorkflowFailed,
+	}, types)
+	assert.Equal(t, 2, failures)
+
+	retried := events[3]
+	assert.Equal(t, "events", retried.WorkflowID)
+	assert.Equal(t, "first", retried.StageID)
+	assert.Equal(t, "work", retried.ActionName)
+	assert.Equal(t, 2, retried.Payload["attempt"])
+	assert.NotEqual(t, events[2].ID, retried.ID)
+}
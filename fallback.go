@@ -0,0 +1,60 @@
+package gostage
+
+import "fmt"
+
+// fallbackAction runs a fallback action when an existing action fails.
+type fallbackAction struct {
+	Action
+	fallback Action
+}
+
+// WithFallback runs fallback in place of action when action fails, for a
+// degraded but successful outcome such as serving cached data. When the
+// runner executes the action, the fallback runs once the action middleware,
+// including any retries, has given up. The fallback finds the error of the
+// action in ActionContext.PrimaryError. The fallback does not run when the
+// run was cancelled. Apply WithFallback last, around the other wrappers.
+func WithFallback(action, fallback Action) Action {
+	return &fallbackAction{Action: action, fallback: fallback}
+}
+
+func (a *fallbackAction) Execute(ctx *ActionContext) error {
+	return runFallback(ctx, a, executeAction(ctx, a.Action))
+}
+
+// Clone copies both the action and its fallback.
+func (a *fallbackAction) Clone() Action {
+	return &fallbackAction{Action: CloneAction(a.Action), fallback: CloneAction(a.fallback)}
+}
+
+// primaryAction returns the action a fallback wrapper runs first, or the action itself.
+func primaryAction(action Action) Action {
+	if wrapper, ok := action.(*fallbackAction); ok {
+		return wrapper.Action
+	}
+	return action
+}
+
+// runFallback runs the fallback of action if err is the error of its primary
+// action, returning the outcome of the fallback.
+func runFallback(ctx *ActionContext, action Action, err error) error {
+	wrapper, ok := action.(*fallbackAction)
+	if !ok || err == nil || (ctx.GoContext != nil && ctx.GoContext.Err() != nil) {
+		return err
+	}
+
+	ctx.Logger.Warn("Action %s failed, running fallback %s: %v", action.Name(), wrapper.fallback.Name(), err)
+	previous := ctx.Action
+	ctx.Action = wrapper.fallback
+	ctx.PrimaryError = err
+	defer func() {
+		ctx.Action = previous
+		ctx.PrimaryError = nil
+	}()
+
+	fallback := wrapper.fallback
+	if fallbackErr := executeInPools(ctx, fallback, func() error { return executeAction(ctx, fallback) }); fallbackErr != nil {
+		return fmt.Errorf("fallback '%s' failed: %w, after: %w", fallback.Name(), fallbackErr, err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package gostage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/davidroman0O/gostage/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithFallback(t *testing.T) {
+	errUnavailable := errors.New("pricing service unavailable")
+	attempts := 0
+	primary := NewActionFunc("fetch-prices", "", func(ctx *ActionContext) error {
+		attempts++
+		return errUnavailable
+	})
+
+	var primaryErr error
+	fallback := NewActionFunc("cached-prices", "", func(ctx *ActionContext) error {
+		primaryErr = ctx.PrimaryError
+		return ctx.Store().Put("prices", "cached")
+	})
+
+	// Retry every action three times
+	runner := NewRunner(WithActionMiddleware(func(next ActionRunnerFunc) ActionRunnerFunc {
+		return func(ctx *ActionContext, action Action, index int, isLast bool) error {
+			var err error
+			for attempt := 0; attempt < 3; attempt++ {
+				if err = next(ctx, action, index, isLast); err == nil {
+					return nil
+				}
+			}
+			return err
+		}
+	}))
+
+	wf := NewWorkflow("pricing", "Pricing", "")
+	stage := NewStage("prices", "Prices", "")
+	stage.AddAction(WithFallback(primary, fallback))
+	wf.AddStage(stage)
+
+	result := runner.ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, errUnavailable, primaryErr)
+	assert.Equal(t, "cached", result.FinalStore["prices"])
+	assert.Equal(t, StatusCompleted, result.ActionStatuses[ActionStatusKey("prices", "fetch-prices")])
+}
+
+func TestWithFallbackFailures(t *testing.T) {
+	errPrimary := errors.New("primary failed")
+	errFallback := errors.New("cache empty")
+	failing := func(name string, err error) Action {
+		return NewActionFunc(name, "", func(ctx *ActionContext) error { return err })
+	}
+
+	result := runSingleAction(t, context.Background(), WithFallback(failing("fetch", errPrimary), failing("cache", errFallback)), nil)
+	assert.ErrorIs(t, result.Error, errPrimary)
+	assert.ErrorIs(t, result.Error, errFallback)
+	assert.ErrorContains(t, result.Error, "action 'fetch' failed: fallback 'cache' failed: cache empty, after: primary failed")
+
+	// A cancelled run does not fall back
+	ctx, cancel := context.WithCancel(context.Background())
+	ran := false
+	result = runSingleAction(t, ctx, WithFallback(NewActionFunc("fetch", "", func(*ActionContext) error {
+		cancel()
+		return context.Canceled
+	}), NewActionFunc("cache", "", func(*ActionContext) error {
+		ran = true
+		return nil
+	})), nil)
+	assert.ErrorIs(t, result.Error, context.Canceled)
+	assert.False(t, ran)
+}
+
+func TestWithFallbackInForEach(t *testing.T) {
+	body := WithFallback(NewActionFunc("parse", "", func(ctx *ActionContext) error {
+		item, err := store.Get[string](ctx.Store(), ForEachItemKey)
+		if err != nil {
+			return err
+		}
+		if item == "bad" {
+			return errors.New("malformed record")
+		}
+		return ctx.Store().Put(ForEachResultKey, item)
+	}), NewActionFunc("quarantine", "", func(ctx *ActionContext) error {
+		return ctx.Store().Put(ForEachResultKey, "quarantined: "+ctx.PrimaryError.Error())
+	}))
+
+	var wf *Workflow
+	result := runSingleAction(t, context.Background(), NewForEachAction[string]("records", "records", []Action{body}), func(w *Workflow) {
+		w.Store.Put("records", []string{"ok", "bad"})
+		wf = w
+	})
+	require.True(t, result.Success, "%v", result.Error)
+	results, err := store.Get[[]interface{}](wf.Store, "records.results")
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"ok", "quarantined: malformed record"}, results)
+
+	clone := CloneAction(body).(*fallbackAction)
+	assert.NotSame(t, body.(*fallbackAction).fallback, clone.fallback)
+}
@@ -0,0 +1,284 @@
+package gostage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/davidroman0O/gostage/store"
+)
+
+// Store keys of the item-scoped store a ForEachAction runs its body against.
+const (
+	// ForEachItemKey holds the current item
+	ForEachItemKey = "item"
+	// ForEachIndexKey holds the index of the current item
+	ForEachIndexKey = "index"
+	// ForEachResultKey is read back once the body ran and aggregated into the results
+	ForEachResultKey = "result"
+)
+
+// ForEachOption configures a ForEachAction.
+type ForEachOption func(*forEachOptions)
+
+type forEachOptions struct {
+	parallelism   int
+	collectErrors bool
+	resultsKey    string
+}
+
+// WithParallelism runs up to n items at the same time. Items run one after
+// the other by default.
+func WithParallelism(n int) ForEachOption {
+	return func(o *forEachOptions) {
+		o.parallelism = n
+	}
+}
+
+// CollectErrors runs every item even after one failed, and then fails with
+// the errors of all failed items. By default the first failure stops the
+// items that did not start yet and cancels the running ones.
+func CollectErrors() ForEachOption {
+	return func(o *forEachOptions) {
+		o.collectErrors = true
+	}
+}
+
+// WithResultsKey sets the store key the aggregated results are written to,
+// which defaults to the name of the action followed by ".results".
+func WithResultsKey(key string) ForEachOption {
+	return func(o *forEachOptions) {
+		o.resultsKey = key
+	}
+}
+
+// ForEachAction runs a list of actions once per item of a slice read from the
+// workflow store.
+//
+// Each item runs against its own scope of the workflow store, see
+// store.KVStore.Scope, holding the item under ForEachItemKey and its index
+// under ForEachIndexKey, so templates can render "{{ .store.item.name }}"
+// and parallel items do not see each other's writes. The other keys of the
+// workflow store are read through the scope without being copied. Writes to
+// the item store are dropped once the item finished, except for the value
+// the body wrote under ForEachResultKey: the results of all items are written
+// to the workflow store, in item order, as a []interface{} holding nil for
+// items without a result.
+//
+// Body actions are executed directly: runner middleware, action statuses and
+// dynamic actions or stages do not apply to them. The results of body actions
+// implementing ResultAction are recorded as those of other actions, the
+// latest item to finish an action replacing the result of the others.
+type ForEachAction[T any] struct {
+	BaseAction
+	itemsKey string
+	body     []Action
+	options  forEachOptions
+}
+
+// NewForEachAction creates an action running body, in order, for every item
+// of the []T stored under itemsKey. A []interface{} whose elements are not T,
+// as decoded from JSON, is converted element by element through JSON.
+func NewForEachAction[T any](name, itemsKey string, body []Action, opts ...ForEachOption) *ForEachAction[T] {
+	a := &ForEachAction[T]{
+		BaseAction: NewBaseAction(name, fmt.Sprintf("Runs %d actions for each item of '%s'", len(body), itemsKey)),
+		itemsKey:   itemsKey,
+		body:       body,
+		options:    forEachOptions{parallelism: 1, resultsKey: name + ".results"},
+	}
+	for _, opt := range opts {
+		opt(&a.options)
+	}
+	if a.options.parallelism < 1 {
+		a.options.parallelism = 1
+	}
+	return a
+}
+
+// ForEachStage creates a ForEachAction running the actions of stage for every
+// item. The stage itself is not added to the workflow.
+func ForEachStage[T any](name, itemsKey string, stage *Stage, opts ...ForEachOption) *ForEachAction[T] {
+	return NewForEachAction[T](name, itemsKey, stage.Actions, opts...)
+}
+
+// Clone returns a copy of the action running copies of its body actions.
+func (a *ForEachAction[T]) Clone() Action {
+	clone := *a
+	clone.BaseAction.cloneState()
+	clone.body = make([]Action, len(a.body))
+	for i, action := range a.body {
+		clone.body[i] = CloneAction(action)
+	}
+	return &clone
+}
+
+func (a *ForEachAction[T]) Execute(ctx *ActionContext) error {
+	items, err := readItems[T](ctx.Store(), a.itemsKey)
+	if err != nil {
+		return err
+	}
+
+	ctx.Logger.Debug("Running %d items of '%s' with parallelism %d", len(items), a.itemsKey, a.options.parallelism)
+	base := stageCopy(ctx.Workflow)
+	results, err := fanOut(ctx, len(items), a.options, func(runCtx context.Context, index int) (interface{}, error) {
+		result, err := runScoped(runCtx, ctx, base, LoggerWith(ctx.Logger, "item", index), index, items[index], a.body)
+		if err != nil {
+			return nil, fmt.Errorf("item %d failed: %w", index, err)
+		}
+		return result, nil
+	})
+	if storeErr := ctx.Store().Put(a.options.resultsKey, results); storeErr != nil {
+		return fmt.Errorf("failed to store results: %w", storeErr)
+	}
+	return err
+}
+
+// fanOut calls run for indexes 0 to n-1 with up to options.parallelism calls
+// at the same time, and returns their results in index order. Unless errors
+// are collected, the first failure cancels the context of the running calls
+// and no further call starts. The context error of the run is only returned
+// when it left calls unstarted.
+func fanOut(ctx *ActionContext, n int, options forEachOptions, run func(runCtx context.Context, index int) (interface{}, error)) ([]interface{}, error) {
+	parent := ctx.GoContext
+	if parent == nil {
+		parent = context.Background()
+	}
+	runCtx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	parallelism := options.parallelism
+	if parallelism < 1 {
+		parallelism = n
+	}
+	results := make([]interface{}, n)
+	errs := make([]error, n)
+	sem := make(chan struct{}, max(parallelism, 1))
+	var wg sync.WaitGroup
+	var failOnce sync.Once
+	var failed error
+	started := 0
+
+	for i := 0; i < n; i++ {
+		select {
+		case sem <- struct{}{}:
+		case <-runCtx.Done():
+		}
+		if runCtx.Err() != nil {
+			break
+		}
+
+		started++
+		wg.Add(1)
+		go func(index int) {
+			defer func() { <-sem; wg.Done() }()
+			result, err := run(runCtx, index)
+			results[index] = result
+			if err != nil {
+				errs[index] = err
+				// Report the failure that stopped the items, not the cancellations it caused
+				failOnce.Do(func() {
+					failed = errs[index]
+					if !options.collectErrors {
+						cancel()
+					}
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Items left unstarted because the run was cancelled
+	var skipped error
+	if started < n {
+		skipped = parent.Err()
+	}
+	if options.collectErrors {
+		return results, errors.Join(append(errs, skipped)...)
+	}
+	if failed != nil {
+		return results, failed
+	}
+	return results, skipped
+}
+
+// runScoped runs body against a scope of the workflow store holding input
+// under ForEachItemKey and index under ForEachIndexKey, and returns the value
+// the body wrote under ForEachResultKey. base is the workflow the items copy,
+// prepared by the caller with stageCopy before the items start, so that
+// items running at the same time do not share a context.
+func runScoped(runCtx context.Context, ctx *ActionContext, base *Workflow, logger Logger, index int, input interface{}, body []Action) (interface{}, error) {
+	scoped := ctx.Store().Scope()
+	if err := scoped.Put(ForEachItemKey, input); err != nil {
+		return nil, err
+	}
+	if err := scoped.Put(ForEachIndexKey, index); err != nil {
+		return nil, err
+	}
+
+	workflow := stageCopy(base)
+	workflow.Store = scoped
+
+	for i, action := range body {
+		if err := runCtx.Err(); err != nil {
+			return nil, err
+		}
+		actionCtx := &ActionContext{
+			GoContext:       runCtx,
+			Workflow:        workflow,
+			Stage:           ctx.Stage,
+			Action:          action,
+			Logger:          LoggerWith(logger, "action", action.Name()),
+			disabledActions: make(map[string]bool),
+			disabledStages:  make(map[string]bool),
+			ActionIndex:     i,
+			IsLastAction:    i == len(body)-1,
+			watch:           ctx.watch,
+		}
+		if err := executeInPools(actionCtx, action, func() error { return executeAction(actionCtx, action) }); err != nil {
+			return nil, fmt.Errorf("action '%s' failed: %w", action.Name(), err)
+		}
+		if actionCtx.result != nil && ctx.Stage != nil {
+			workflow.setActionResult(ctx.Stage.ID, action.Name(), *actionCtx.result)
+		}
+	}
+
+	// Only a result the body wrote counts, not one of the workflow store
+	if !scoped.Owns(ForEachResultKey) {
+		return nil, nil
+	}
+	return scoped.GetValue(ForEachResultKey)
+}
+
+// readItems reads the []T stored under key, converting the elements of a
+// []interface{} to T.
+func readItems[T any](s *store.KVStore, key string) ([]T, error) {
+	items, err := store.Get[[]T](s, key)
+	if err == nil || !errors.Is(err, store.ErrTypeMismatch) {
+		if err != nil {
+			return nil, fmt.Errorf("failed to read items from '%s': %w", key, err)
+		}
+		return items, nil
+	}
+
+	raw, rawErr := store.Get[[]interface{}](s, key)
+	if rawErr != nil {
+		return nil, fmt.Errorf("failed to read items from '%s': %w", key, err)
+	}
+	items = make([]T, len(raw))
+	for i, value := range raw {
+		if item, ok := value.(T); ok {
+			items[i] = item
+			continue
+		}
+		data, err := json.Marshal(value)
+		if err == nil {
+			err = json.Unmarshal(data, &items[i])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert item %d of '%s': %w", i, key, err)
+		}
+	}
+	return items, nil
+}
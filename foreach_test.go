@@ -0,0 +1,207 @@
+package gostage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/davidroman0O/gostage/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type forEachHost struct {
+	Name string `json:"name"`
+	Port int    `json:"port"`
+}
+
+func TestForEachAction(t *testing.T) {
+	hosts := []forEachHost{{"api", 80}, {"web", 443}, {"db", 5432}}
+	body := []Action{
+		NewActionFunc("address", "", func(ctx *ActionContext) error {
+			address, err := ctx.Render("{{ .store.item.Name }}.{{ .store.domain }}")
+			if err != nil {
+				return err
+			}
+			return ctx.Store().Put("address", address)
+		}),
+		NewActionFunc("result", "", func(ctx *ActionContext) error {
+			host, err := store.Get[forEachHost](ctx.Store(), ForEachItemKey)
+			if err != nil {
+				return err
+			}
+			index, err := store.Get[int](ctx.Store(), ForEachIndexKey)
+			if err != nil {
+				return err
+			}
+			address, err := store.Get[string](ctx.Store(), "address")
+			if err != nil {
+				return err
+			}
+			return ctx.Store().Put(ForEachResultKey, fmt.Sprintf("%d:%s:%d", index, address, host.Port))
+		}),
+	}
+
+	var wf *Workflow
+	result := runSingleAction(t, context.Background(), NewForEachAction[forEachHost]("hosts", "hosts", body), func(w *Workflow) {
+		wf = w
+		w.Store.Put("hosts", hosts)
+		w.Store.Put("domain", "example.com")
+	})
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, []interface{}{"0:api.example.com:80", "1:web.example.com:443", "2:db.example.com:5432"}, result.FinalStore["hosts.results"])
+
+	// Item-scoped writes stay out of the workflow store
+	assert.NotContains(t, result.FinalStore, "address")
+	assert.NotContains(t, result.FinalStore, ForEachItemKey)
+	assert.Equal(t, StatusCompleted, wf.StageStatuses()["wait"])
+}
+
+func TestForEachActionConvertsDecodedItems(t *testing.T) {
+	var seen []forEachHost
+	body := []Action{NewActionFunc("collect", "", func(ctx *ActionContext) error {
+		host, err := store.Get[forEachHost](ctx.Store(), ForEachItemKey)
+		seen = append(seen, host)
+		return err
+	})}
+
+	result := runSingleAction(t, context.Background(), NewForEachAction[forEachHost]("hosts", "hosts", body, WithResultsKey("out")), func(w *Workflow) {
+		w.Store.Put("hosts", []interface{}{map[string]interface{}{"name": "api", "port": 80}})
+	})
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, []forEachHost{{"api", 80}}, seen)
+	assert.Equal(t, []interface{}{nil}, result.FinalStore["out"])
+
+	result = runSingleAction(t, context.Background(), NewForEachAction[forEachHost]("hosts", "hosts", body), func(w *Workflow) {
+		w.Store.Put("hosts", []interface{}{"api"})
+	})
+	assert.ErrorContains(t, result.Error, "failed to convert item 0 of 'hosts'")
+
+	result = runSingleAction(t, context.Background(), NewForEachAction[forEachHost]("hosts", "missing", body), nil)
+	assert.ErrorIs(t, result.Error, store.ErrNotFound)
+}
+
+func TestForEachActionParallelism(t *testing.T) {
+	var running, peak int32
+	body := []Action{NewActionFunc("work", "", func(ctx *ActionContext) error {
+		current := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if current <= old || atomic.CompareAndSwapInt32(&peak, old, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		item, _ := store.Get[int](ctx.Store(), ForEachItemKey)
+		return ctx.Store().Put(ForEachResultKey, item*item)
+	})}
+
+	result := runSingleAction(t, context.Background(), NewForEachAction[int]("square", "numbers", body, WithParallelism(3)), func(w *Workflow) {
+		w.Store.Put("numbers", []int{1, 2, 3, 4, 5, 6})
+	})
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, []interface{}{1, 4, 9, 16, 25, 36}, result.FinalStore["square.results"])
+	assert.Equal(t, int32(3), atomic.LoadInt32(&peak))
+}
+
+func TestForEachActionScopes(t *testing.T) {
+	body := []Action{
+		&countAction{BaseAction: NewBaseAction("count", "")},
+		NewActionFunc("mark", "", func(ctx *ActionContext) error {
+			// Items have their own context, so parallel items can write to it
+			item, _ := store.Get[int](ctx.Store(), ForEachItemKey)
+			ctx.Workflow.Context["item"] = item
+			if item%2 == 0 {
+				return ctx.Store().Put(ForEachResultKey, item)
+			}
+			return nil
+		}),
+	}
+
+	result := runSingleAction(t, context.Background(), NewForEachAction[int]("items", "numbers", body, WithParallelism(4)), func(w *Workflow) {
+		w.Store.Put("numbers", []int{1, 2, 3, 4, 5, 6, 7, 8})
+		w.Store.Put("items", []string{"a", "b", "c"})
+		w.Store.Put(ForEachResultKey, "stale")
+	})
+	require.True(t, result.Success, "%v", result.Error)
+
+	// Only the results the items wrote are collected, not the one of the workflow store
+	assert.Equal(t, []interface{}{nil, 2, nil, 4, nil, 6, nil, 8}, result.FinalStore["items.results"])
+	assert.Equal(t, "stale", result.FinalStore[ForEachResultKey])
+	assert.Equal(t, 3, result.ActionResults[ActionStatusKey("wait", "count")].Output)
+}
+
+func TestForEachActionFailFast(t *testing.T) {
+	errBoom := errors.New("boom")
+	var started int32
+	stage := NewStage("body", "Body", "")
+	stage.AddAction(NewActionFunc("work", "", func(ctx *ActionContext) error {
+		atomic.AddInt32(&started, 1)
+		item, _ := store.Get[int](ctx.Store(), ForEachItemKey)
+		if item == 2 {
+			return errBoom
+		}
+		select {
+		case <-ctx.GoContext.Done():
+			return ctx.GoContext.Err()
+		case <-time.After(time.Second):
+			return nil
+		}
+	}))
+
+	started0 := time.Now()
+	result := runSingleAction(t, context.Background(), ForEachStage[int]("items", "numbers", stage, WithParallelism(2)), func(w *Workflow) {
+		w.Store.Put("numbers", []int{1, 2, 3, 4, 5})
+	})
+	assert.ErrorIs(t, result.Error, errBoom)
+	assert.ErrorContains(t, result.Error, "item 1 failed: action 'work' failed: boom")
+	assert.Less(t, time.Since(started0), 900*time.Millisecond)
+	assert.LessOrEqual(t, atomic.LoadInt32(&started), int32(2))
+}
+
+func TestFanOutCancellation(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	ctx := &ActionContext{GoContext: parent}
+	item := func(runCtx context.Context, index int) (interface{}, error) {
+		return index, nil
+	}
+
+	// Cancelling the run while the last item runs does not fail items that all finished
+	results, err := fanOut(ctx, 3, forEachOptions{parallelism: 1}, func(runCtx context.Context, index int) (interface{}, error) {
+		if index == 2 {
+			cancel()
+		}
+		return index, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{0, 1, 2}, results)
+
+	results, err = fanOut(ctx, 3, forEachOptions{parallelism: 1}, item)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []interface{}{nil, nil, nil}, results)
+
+	_, err = fanOut(ctx, 3, forEachOptions{parallelism: 1, collectErrors: true}, item)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestForEachActionCollectErrors(t *testing.T) {
+	body := []Action{NewActionFunc("check", "", func(ctx *ActionContext) error {
+		item, _ := store.Get[int](ctx.Store(), ForEachItemKey)
+		if item%2 == 0 {
+			return fmt.Errorf("%d is even", item)
+		}
+		return ctx.Store().Put(ForEachResultKey, "ok")
+	})}
+
+	result := runSingleAction(t, context.Background(), NewForEachAction[int]("check", "numbers", body, CollectErrors(), WithParallelism(4)), func(w *Workflow) {
+		w.Store.Put("numbers", []int{1, 2, 3, 4, 5})
+	})
+	require.False(t, result.Success)
+	assert.ErrorContains(t, result.Error, "item 1 failed: action 'check' failed: 2 is even")
+	assert.ErrorContains(t, result.Error, "item 3 failed: action 'check' failed: 4 is even")
+	assert.Equal(t, []interface{}{"ok", nil, "ok", nil, "ok"}, result.FinalStore["check.results"])
+}
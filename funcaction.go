@@ -0,0 +1,97 @@
+package gostage
+
+import (
+	"fmt"
+
+	"github.com/davidroman0O/gostage/store"
+)
+
+// funcActionConfig holds the options of an action created with NewFuncAction.
+type funcActionConfig struct {
+	description string
+	inputKey    string
+	outputKey   string
+}
+
+// FuncActionOption configures an action created with NewFuncAction.
+type FuncActionOption func(*funcActionConfig)
+
+// WithInputKey reads the input of the function from key in the workflow
+// store. The action fails if the key is missing or does not hold an I.
+func WithInputKey(key string) FuncActionOption {
+	return func(c *funcActionConfig) {
+		c.inputKey = key
+	}
+}
+
+// WithOutputKey writes the output of the function to key in the workflow store.
+func WithOutputKey(key string) FuncActionOption {
+	return func(c *funcActionConfig) {
+		c.outputKey = key
+	}
+}
+
+// WithFuncDescription sets the description of the action.
+func WithFuncDescription(description string) FuncActionOption {
+	return func(c *funcActionConfig) {
+		c.description = description
+	}
+}
+
+// typedFuncAction runs a typed function between two store keys.
+type typedFuncAction[I, O any] struct {
+	BaseAction
+	fn        func(ctx *ActionContext, in I) (O, error)
+	inputKey  string
+	outputKey string
+}
+
+// NewFuncAction creates an action from a typed function. The input is read
+// from the store key set with WithInputKey, or is the zero I without one.
+// The output is written to the store key set with WithOutputKey, and is
+// always recorded as the output of the action result, so later actions can
+// read it with ResultOutput[O].
+func NewFuncAction[I, O any](name string, fn func(ctx *ActionContext, in I) (O, error), opts ...FuncActionOption) Action {
+	config := funcActionConfig{}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return &typedFuncAction[I, O]{
+		BaseAction: NewBaseAction(name, config.description),
+		fn:         fn,
+		inputKey:   config.inputKey,
+		outputKey:  config.outputKey,
+	}
+}
+
+func (a *typedFuncAction[I, O]) Execute(ctx *ActionContext) error {
+	result, err := a.ExecuteWithResult(ctx)
+	if err != nil {
+		return err
+	}
+	ctx.SetResult(result)
+	return nil
+}
+
+func (a *typedFuncAction[I, O]) ExecuteWithResult(ctx *ActionContext) (ActionResult, error) {
+	var in I
+	if a.inputKey != "" {
+		var err error
+		in, err = store.Get[I](ctx.Store(), a.inputKey)
+		if err != nil {
+			return ActionResult{}, fmt.Errorf("failed to read input key '%s': %w", a.inputKey, err)
+		}
+	}
+
+	out, err := a.fn(ctx, in)
+	if err != nil {
+		return ActionResult{}, err
+	}
+
+	if a.outputKey != "" {
+		if err := ctx.Store().Put(a.outputKey, out); err != nil {
+			return ActionResult{}, fmt.Errorf("failed to write output key '%s': %w", a.outputKey, err)
+		}
+	}
+	return ActionResult{Output: out}, nil
+}
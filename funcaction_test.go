@@ -0,0 +1,70 @@
+package gostage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/davidroman0O/gostage/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type order struct {
+	ID    string
+	Items int
+}
+
+func TestFuncAction(t *testing.T) {
+	wf := NewWorkflow("orders", "Orders", "")
+	wf.Store.Put("order", order{ID: "ORD-1", Items: 3})
+
+	var label string
+	stage := NewStage("process", "Process", "")
+	stage.AddAction(NewFuncAction("price", func(ctx *ActionContext, in order) (float64, error) {
+		return float64(in.Items) * 2.5, nil
+	}, WithInputKey("order"), WithOutputKey("total"), WithFuncDescription("Prices the order")))
+	stage.AddAction(NewFuncAction("label", func(ctx *ActionContext, _ struct{}) (string, error) {
+		total, err := ResultOutput[float64](ctx, "price")
+		return strings.Repeat("$", int(total)), err
+	}))
+	stage.AddAction(NewActionFunc("read", "", func(ctx *ActionContext) error {
+		var err error
+		label, err = ResultOutput[string](ctx, "label")
+		return err
+	}))
+	wf.AddStage(stage)
+
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, "Prices the order", stage.Actions[0].Description())
+
+	total, err := store.Get[float64](wf.Store, "total")
+	require.NoError(t, err)
+	assert.Equal(t, 7.5, total)
+	assert.Equal(t, "$$$$$$$", label)
+	assert.Equal(t, 7.5, result.ActionResults[ActionStatusKey("process", "price")].Output)
+}
+
+func TestFuncActionErrors(t *testing.T) {
+	run := func(action Action, setup func(wf *Workflow)) error {
+		return runSingleAction(t, context.Background(), action, setup).Error
+	}
+
+	double := func(ctx *ActionContext, in int) (int, error) { return in * 2, nil }
+	err := run(NewFuncAction("double", double, WithInputKey("n")), nil)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	assert.ErrorContains(t, err, "failed to read input key 'n'")
+
+	err = run(NewFuncAction("double", double, WithInputKey("n")), func(wf *Workflow) { wf.Store.Put("n", "two") })
+	assert.ErrorContains(t, err, "failed to read input key 'n'")
+
+	errBroken := errors.New("broken")
+	var wf *Workflow
+	err = run(NewFuncAction("broken", func(ctx *ActionContext, in int) (int, error) {
+		return 0, errBroken
+	}, WithOutputKey("out")), func(w *Workflow) { wf = w })
+	assert.ErrorIs(t, err, errBroken)
+	assert.NotContains(t, wf.Store.ExportAll(), "out")
+}
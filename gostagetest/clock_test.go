@@ -0,0 +1,148 @@
+package gostagetest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var epoch = time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+
+func TestFakeClockTimers(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	minute := clock.NewTimer(time.Minute)
+	hour := clock.NewTimer(time.Hour)
+	stopped := clock.NewTimer(time.Second)
+	assert.Equal(t, 3, clock.Timers())
+	assert.True(t, stopped.Stop())
+	assert.False(t, stopped.Stop())
+
+	clock.Advance(59 * time.Second)
+	select {
+	case <-minute.C():
+		t.Fatal("timer fired early")
+	default:
+	}
+
+	clock.Advance(time.Second)
+	assert.Equal(t, epoch.Add(time.Minute), <-minute.C())
+	assert.False(t, minute.Stop())
+	assert.Equal(t, 1, clock.Timers())
+
+	clock.Set(epoch.Add(2 * time.Hour))
+	assert.Equal(t, epoch.Add(2*time.Hour), <-hour.C())
+	assert.Equal(t, 0, clock.Timers())
+
+	// Timers of no duration fire right away
+	assert.Equal(t, clock.Now(), <-clock.NewTimer(0).C())
+}
+
+// runAsync runs workflow on the harness in the background.
+func runAsync(h *Harness, wf *gostage.Workflow) <-chan gostage.RunResult {
+	done := make(chan gostage.RunResult, 1)
+	go func() { done <- h.Run(wf) }()
+	return done
+}
+
+func singleActionWorkflow(action gostage.Action) *gostage.Workflow {
+	wf := gostage.NewWorkflow("clocked", "Clocked", "")
+	stage := gostage.NewStage("wait", "Wait", "")
+	stage.AddAction(action)
+	wf.AddStage(stage)
+	return wf
+}
+
+func TestWaitsFollowTheFakeClock(t *testing.T) {
+	h := New(t, WithFakeClock(epoch))
+	done := runAsync(h, singleActionWorkflow(gostage.WaitAction("cool-down", 6*time.Hour)))
+	h.Clock.BlockUntilTimers(1)
+	h.Clock.Advance(6 * time.Hour)
+
+	result := <-done
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, 6*time.Hour, result.ExecutionTime)
+
+	// A poll times out after its timeout on the clock
+	polls := 0
+	done = runAsync(h, singleActionWorkflow(gostage.PollAction("ready", time.Minute, 10*time.Minute, func(ctx *gostage.ActionContext) (bool, error) {
+		polls++
+		return false, nil
+	})))
+	for i := 0; i < 10; i++ {
+		h.Clock.BlockUntilTimers(2)
+		h.Clock.Advance(time.Minute)
+	}
+	result = <-done
+	assert.ErrorIs(t, result.Error, gostage.ErrPollTimeout)
+	assert.GreaterOrEqual(t, polls, 10)
+}
+
+func TestApprovalTimeoutFollowsTheFakeClock(t *testing.T) {
+	h := New(t, WithFakeClock(epoch))
+	done := runAsync(h, singleActionWorkflow(gostage.ApprovalAction("sign-off", gostage.NewApprovalGate(), gostage.WithApprovalTimeout(24*time.Hour))))
+	h.Clock.BlockUntilTimers(1)
+	h.Clock.Advance(24 * time.Hour)
+
+	result := <-done
+	assert.ErrorIs(t, result.Error, gostage.ErrApprovalTimeout)
+}
+
+func TestWorkflowMaxDurationFollowsTheFakeClock(t *testing.T) {
+	h := New(t, WithFakeClock(epoch))
+	var remaining time.Duration
+	wf := singleActionWorkflow(gostage.NewFuncAction("measure", func(ctx *gostage.ActionContext, _ struct{}) (struct{}, error) {
+		remaining, _ = ctx.TimeRemaining()
+		return struct{}{}, ctx.Sleep(24 * time.Hour)
+	}))
+	wf.SetMaxDuration(time.Hour)
+	done := runAsync(h, wf)
+
+	// The budget timer and the action's sleep
+	h.Clock.BlockUntilTimers(2)
+	h.Clock.Advance(time.Hour)
+
+	result := <-done
+	assert.ErrorIs(t, result.Error, gostage.ErrWorkflowDeadline)
+	assert.Equal(t, time.Hour, remaining)
+}
+
+func TestRetryBackoffWithTheFakeClock(t *testing.T) {
+	// Retry middleware sleeping with ctx.Sleep backs off on the runner's clock
+	retry := func(next gostage.ActionRunnerFunc) gostage.ActionRunnerFunc {
+		return func(ctx *gostage.ActionContext, action gostage.Action, index int, isLast bool) error {
+			backoff := time.Second
+			for attempt := 1; ; attempt++ {
+				err := next(ctx, action, index, isLast)
+				if err == nil || attempt == 4 {
+					return err
+				}
+				if err := ctx.Sleep(backoff); err != nil {
+					return err
+				}
+				backoff *= 2
+			}
+		}
+	}
+	h := New(t, WithFakeClock(epoch), WithRunnerOptions(gostage.WithActionMiddleware(retry)))
+
+	var attempts []time.Time
+	done := runAsync(h, singleActionWorkflow(newTestAction("flaky", func(ctx *gostage.ActionContext) error {
+		attempts = append(attempts, ctx.Now())
+		if len(attempts) < 4 {
+			return errors.New("unavailable")
+		}
+		return nil
+	})))
+	for _, backoff := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		h.Clock.BlockUntilTimers(1)
+		h.Clock.Advance(backoff)
+	}
+
+	result := <-done
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, []time.Time{epoch, epoch.Add(time.Second), epoch.Add(3 * time.Second), epoch.Add(7 * time.Second)}, attempts)
+}
@@ -0,0 +1,214 @@
+package gostagetest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/davidroman0O/gostage"
+)
+
+// UpdateGoldenEnv is the environment variable that makes AssertGolden rewrite
+// golden files with the current runs instead of comparing them:
+//
+//	GOSTAGE_UPDATE_GOLDEN=1 go test ./...
+const UpdateGoldenEnv = "GOSTAGE_UPDATE_GOLDEN"
+
+// GoldenRun is what a golden file records of a run: its outcome, its events
+// in order and its final store. Times and IDs, which change from run to run,
+// are left out, and so are the workflow, stage and action descriptions the
+// runner keeps in the store.
+type GoldenRun struct {
+	WorkflowID string                 `json:"workflowId"`
+	Success    bool                   `json:"success"`
+	Error      string                 `json:"error,omitempty"`
+	Events     []GoldenEvent          `json:"events"`
+	Store      map[string]interface{} `json:"store"`
+}
+
+// GoldenEvent is a lifecycle event of a GoldenRun.
+type GoldenEvent struct {
+	Type    string                 `json:"type"`
+	StageID string                 `json:"stageId,omitempty"`
+	Action  string                 `json:"action,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+	Payload map[string]interface{} `json:"payload,omitempty"`
+}
+
+// String describes the event in diffs.
+func (e GoldenEvent) String() string {
+	s := e.Type
+	if e.StageID != "" || e.Action != "" {
+		s += " " + strings.TrimSuffix(gostage.ActionStatusKey(e.StageID, e.Action), ":")
+	}
+	if e.Error != "" {
+		s += fmt.Sprintf(" (%s)", e.Error)
+	}
+	if len(e.Payload) > 0 {
+		s += fmt.Sprintf(" %v", e.Payload)
+	}
+	return s
+}
+
+// Golden returns the GoldenRun of the last run.
+func (h *Harness) Golden() (GoldenRun, error) {
+	h.mu.Lock()
+	result := h.result
+	events := append([]gostage.Event(nil), h.events...)
+	h.mu.Unlock()
+	if result == nil {
+		return GoldenRun{}, errors.New("gostagetest: no workflow was run")
+	}
+
+	run := GoldenRun{WorkflowID: result.WorkflowID, Success: result.Success, Events: []GoldenEvent{}, Store: make(map[string]interface{})}
+	if result.Error != nil {
+		run.Error = result.Error.Error()
+	}
+	for key, value := range result.FinalStore {
+		if !strings.HasPrefix(key, gostage.PrefixWorkflow) && !strings.HasPrefix(key, gostage.PrefixStage) && !strings.HasPrefix(key, gostage.PrefixAction) {
+			run.Store[key] = value
+		}
+	}
+	for _, event := range events {
+		golden := GoldenEvent{Type: event.Type.String(), StageID: event.StageID, Action: event.ActionName, Payload: event.Payload}
+		if event.Error != nil {
+			golden.Error = event.Error.Error()
+		}
+		run.Events = append(run.Events, golden)
+	}
+
+	// Compare runs in their JSON form, as read back from golden files
+	data, err := json.Marshal(run)
+	if err != nil {
+		return GoldenRun{}, fmt.Errorf("failed to serialize run of workflow '%s': %w", run.WorkflowID, err)
+	}
+	var normalized GoldenRun
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return GoldenRun{}, fmt.Errorf("failed to serialize run of workflow '%s': %w", run.WorkflowID, err)
+	}
+	return normalized, nil
+}
+
+// ReadGolden reads a golden file.
+func ReadGolden(path string) (GoldenRun, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return GoldenRun{}, fmt.Errorf("failed to read golden file: %w", err)
+	}
+	var run GoldenRun
+	if err := json.Unmarshal(data, &run); err != nil {
+		return GoldenRun{}, fmt.Errorf("failed to parse golden file '%s': %w", path, err)
+	}
+	return run, nil
+}
+
+// WriteGolden writes run to a golden file, creating its directory.
+func WriteGolden(path string, run GoldenRun) error {
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize golden run: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to write golden file: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write golden file: %w", err)
+	}
+	return nil
+}
+
+// DiffGolden lists the differences of got from want, none if the runs match.
+func DiffGolden(want, got GoldenRun) []string {
+	var diffs []string
+	if got.WorkflowID != want.WorkflowID {
+		diffs = append(diffs, fmt.Sprintf("workflow: got '%s', want '%s'", got.WorkflowID, want.WorkflowID))
+	}
+	if got.Success != want.Success || got.Error != want.Error {
+		diffs = append(diffs, fmt.Sprintf("outcome: got %s, want %s", outcome(got), outcome(want)))
+	}
+
+	for i := 0; i < len(got.Events) || i < len(want.Events); i++ {
+		switch {
+		case i >= len(want.Events):
+			diffs = append(diffs, fmt.Sprintf("event %d: unexpected %s", i, got.Events[i]))
+		case i >= len(got.Events):
+			diffs = append(diffs, fmt.Sprintf("event %d: missing %s", i, want.Events[i]))
+		case !reflect.DeepEqual(got.Events[i], want.Events[i]):
+			diffs = append(diffs, fmt.Sprintf("event %d: got %s, want %s", i, got.Events[i], want.Events[i]))
+		}
+	}
+
+	keys := make(map[string]bool)
+	for key := range got.Store {
+		keys[key] = true
+	}
+	for key := range want.Store {
+		keys[key] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	for _, key := range sorted {
+		gotValue, inGot := got.Store[key]
+		wantValue, inWant := want.Store[key]
+		switch {
+		case !inWant:
+			diffs = append(diffs, fmt.Sprintf("store key '%s': unexpected %v", key, gotValue))
+		case !inGot:
+			diffs = append(diffs, fmt.Sprintf("store key '%s': missing %v", key, wantValue))
+		case !reflect.DeepEqual(gotValue, wantValue):
+			diffs = append(diffs, fmt.Sprintf("store key '%s': got %v, want %v", key, gotValue, wantValue))
+		}
+	}
+	return diffs
+}
+
+// outcome describes the outcome of a run in diffs.
+func outcome(run GoldenRun) string {
+	if run.Success {
+		return "success"
+	}
+	return fmt.Sprintf("failure (%s)", run.Error)
+}
+
+// AssertGolden checks that the last run matches the golden file at path. When
+// UpdateGoldenEnv is set, the file is written instead, to be reviewed and
+// committed with the test.
+func (h *Harness) AssertGolden(path string) bool {
+	h.t.Helper()
+	got, err := h.Golden()
+	if err != nil {
+		h.t.Errorf("%v", err)
+		return false
+	}
+
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		if err := WriteGolden(path, got); err != nil {
+			h.t.Errorf("%v", err)
+			return false
+		}
+		return true
+	}
+
+	want, err := ReadGolden(path)
+	if errors.Is(err, os.ErrNotExist) {
+		h.t.Errorf("golden file %s does not exist, set %s=1 to create it", path, UpdateGoldenEnv)
+		return false
+	}
+	if err != nil {
+		h.t.Errorf("%v", err)
+		return false
+	}
+	if diffs := DiffGolden(want, got); len(diffs) > 0 {
+		h.t.Errorf("run differs from golden file %s (set %s=1 to update it):\n  %s", path, UpdateGoldenEnv, strings.Join(diffs, "\n  "))
+		return false
+	}
+	return true
+}
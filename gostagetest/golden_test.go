@@ -0,0 +1,68 @@
+package gostagetest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoldenFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "golden", "orders.json")
+
+	rt := &recordingT{}
+	h := New(rt)
+	h.Run(newOrderWorkflow(false))
+	assert.False(t, h.AssertGolden(path))
+	require.Len(t, rt.failures, 1)
+	assert.Contains(t, rt.failures[0], "does not exist")
+
+	t.Setenv(UpdateGoldenEnv, "1")
+	require.True(t, h.AssertGolden(path))
+	golden, err := ReadGolden(path)
+	require.NoError(t, err)
+	assert.True(t, golden.Success)
+	assert.Equal(t, map[string]interface{}{"order.status": "shipped", "order.total": 42.0}, golden.Store)
+	assert.Contains(t, golden.Events, GoldenEvent{Type: "stage.skipped", StageID: "survey"})
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "time")
+
+	// The same run matches its golden file
+	t.Setenv(UpdateGoldenEnv, "")
+	rt.failures = nil
+	h = New(rt)
+	h.Run(newOrderWorkflow(false))
+	assert.True(t, h.AssertGolden(path))
+	assert.Empty(t, rt.failures)
+
+	// A run behaving differently does not
+	h.Run(newOrderWorkflow(true))
+	assert.False(t, h.AssertGolden(path))
+	require.Len(t, rt.failures, 1)
+	failure := rt.failures[0]
+	assert.Contains(t, failure, "outcome: got failure (")
+	assert.Contains(t, failure, "want action.completed checkout:charge")
+	assert.Contains(t, failure, "missing stage.started shipping")
+	assert.Contains(t, failure, "store key 'order.status': missing shipped")
+	assert.True(t, strings.HasPrefix(failure, "run differs from golden file "+path))
+}
+
+func TestDiffGolden(t *testing.T) {
+	want := GoldenRun{WorkflowID: "w", Success: true, Events: []GoldenEvent{{Type: "stage.started", StageID: "s"}}, Store: map[string]interface{}{"a": 1.0}}
+	assert.Empty(t, DiffGolden(want, want))
+
+	got := GoldenRun{WorkflowID: "v", Success: true, Events: []GoldenEvent{
+		{Type: "stage.started", StageID: "s"},
+		{Type: "action.failed", StageID: "s", Action: "x", Error: "boom"},
+	}, Store: map[string]interface{}{"a": 2.0, "b": true}}
+	assert.Equal(t, []string{
+		"workflow: got 'v', want 'w'",
+		"event 1: unexpected action.failed s:x (boom)",
+		"store key 'a': got 2, want 1",
+		"store key 'b': unexpected true",
+	}, DiffGolden(want, got))
+}
@@ -0,0 +1,308 @@
+// Package gostagetest helps testing workflows.
+//
+// A Harness runs workflows on a runner recording their lifecycle events, then
+// asserts what the run executed, skipped and stored, instead of counting calls
+// by hand in every action:
+//
+//	h := gostagetest.New(t, gostagetest.WithFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)))
+//	h.Run(workflow)
+//
+//	h.AssertSucceeded()
+//	h.AssertExecutedInOrder("validate", "charge", "ship")
+//	h.AssertSkipped("refund")
+//	gostagetest.AssertStoreEquals(h, "order.status", "shipped")
+//
+// Action names and "stageID:actionName" keys are accepted wherever an
+// action is expected.
+package gostagetest
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/davidroman0O/gostage/store"
+)
+
+// Harness runs workflows in a test and records what they did. A harness runs
+// one workflow at a time; assertions are about the last run.
+type Harness struct {
+	t testing.TB
+	// Runner executes the workflows of the harness
+	Runner *gostage.Runner
+	// Clock is the fake clock of the runner when WithFakeClock is used, nil otherwise
+	Clock *FakeClock
+
+	runnerOptions []gostage.RunnerOption
+	runOptions    gostage.RunOptions
+
+	mu       sync.Mutex
+	events   []gostage.Event
+	workflow *gostage.Workflow
+	result   *gostage.RunResult
+}
+
+// Option configures a Harness.
+type Option func(*Harness)
+
+// WithRunnerOptions configures the runner of the harness.
+func WithRunnerOptions(opts ...gostage.RunnerOption) Option {
+	return func(h *Harness) {
+		h.runnerOptions = append(h.runnerOptions, opts...)
+	}
+}
+
+// WithRunOptions sets the options of the runs, such as their initial store.
+// Without a logger, runs log nothing.
+func WithRunOptions(options gostage.RunOptions) Option {
+	return func(h *Harness) {
+		h.runOptions = options
+	}
+}
+
+// WithFakeClock gives the runner a fake clock starting at start, available
+// as Harness.Clock.
+func WithFakeClock(start time.Time) Option {
+	return func(h *Harness) {
+		h.Clock = NewFakeClock(start)
+		h.runnerOptions = append(h.runnerOptions, gostage.WithClock(h.Clock))
+	}
+}
+
+// New creates a harness reporting to t.
+func New(t testing.TB, opts ...Option) *Harness {
+	h := &Harness{t: t}
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.Runner = gostage.NewRunner(h.runnerOptions...)
+	h.Runner.Subscribe(gostage.EventAll, func(event gostage.Event) {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.events = append(h.events, event)
+	})
+	return h
+}
+
+// Run executes workflow and returns its result, forgetting the previous run.
+func (h *Harness) Run(workflow *gostage.Workflow) gostage.RunResult {
+	h.mu.Lock()
+	h.events = nil
+	h.workflow = workflow
+	h.mu.Unlock()
+
+	options := h.runOptions
+	if options.Logger == nil {
+		options.Logger = gostage.NewDefaultLogger()
+	}
+	result := h.Runner.ExecuteWithOptions(workflow, options)
+
+	h.mu.Lock()
+	h.result = &result
+	h.mu.Unlock()
+	return result
+}
+
+// RunStages executes the stages, in order, in a workflow of their own and
+// returns its result.
+func (h *Harness) RunStages(stages ...*gostage.Stage) gostage.RunResult {
+	workflow := gostage.NewWorkflow("test", "Test", "")
+	for _, stage := range stages {
+		workflow.AddStage(stage)
+	}
+	return h.Run(workflow)
+}
+
+// RunActions executes the actions, in order, in a single-stage workflow and
+// returns its result.
+func (h *Harness) RunActions(actions ...gostage.Action) gostage.RunResult {
+	stage := gostage.NewStage("run", "Run", "")
+	for _, action := range actions {
+		stage.AddAction(action)
+	}
+	return h.RunStages(stage)
+}
+
+// RunStages executes the stages in a workflow whose store starts with
+// initial, for tests that only look at the result.
+func RunStages(t testing.TB, initial map[string]interface{}, stages ...*gostage.Stage) gostage.RunResult {
+	t.Helper()
+	return New(t, withInitialStore(initial)).RunStages(stages...)
+}
+
+// RunActions executes the actions in a single-stage workflow whose store
+// starts with initial, for tests of actions that only look at the result.
+func RunActions(t testing.TB, initial map[string]interface{}, actions ...gostage.Action) gostage.RunResult {
+	t.Helper()
+	return New(t, withInitialStore(initial)).RunActions(actions...)
+}
+
+// withInitialStore runs workflows with the default options and initial as
+// their initial store.
+func withInitialStore(initial map[string]interface{}) Option {
+	options := gostage.DefaultRunOptions()
+	options.InitialStore = initial
+	return WithRunOptions(options)
+}
+
+// Events returns the lifecycle events of the last run, in order.
+func (h *Harness) Events() []gostage.Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]gostage.Event(nil), h.events...)
+}
+
+// Executed returns the ActionStatusKey of the actions the last run started, in order.
+func (h *Harness) Executed() []string {
+	var executed []string
+	for _, event := range h.Events() {
+		if event.Type == gostage.EventActionStarted {
+			executed = append(executed, gostage.ActionStatusKey(event.StageID, event.ActionName))
+		}
+	}
+	return executed
+}
+
+// lastRun returns the result of the last run, failing the test if there is none.
+func (h *Harness) lastRun() (*gostage.RunResult, bool) {
+	h.t.Helper()
+	h.mu.Lock()
+	result := h.result
+	h.mu.Unlock()
+	if result == nil {
+		h.t.Errorf("gostagetest: no workflow was run")
+		return nil, false
+	}
+	return result, true
+}
+
+// AssertSucceeded checks that the last run succeeded.
+func (h *Harness) AssertSucceeded() bool {
+	h.t.Helper()
+	result, ok := h.lastRun()
+	if !ok {
+		return false
+	}
+	if !result.Success {
+		h.t.Errorf("workflow '%s' failed: %v", result.WorkflowID, result.Error)
+		return false
+	}
+	return true
+}
+
+// AssertFailed checks that the last run failed.
+func (h *Harness) AssertFailed() bool {
+	h.t.Helper()
+	result, ok := h.lastRun()
+	if !ok {
+		return false
+	}
+	if result.Success {
+		h.t.Errorf("workflow '%s' succeeded, expected a failure", result.WorkflowID)
+		return false
+	}
+	return true
+}
+
+// AssertExecutedInOrder checks that the last run started the actions in this
+// order. Other actions may run before, between and after them.
+func (h *Harness) AssertExecutedInOrder(actions ...string) bool {
+	h.t.Helper()
+	if _, ok := h.lastRun(); !ok {
+		return false
+	}
+	executed := h.Executed()
+	next := 0
+	for _, key := range executed {
+		if next < len(actions) && matchesAction(key, actions[next]) {
+			next++
+		}
+	}
+	if next < len(actions) {
+		h.t.Errorf("action '%s' was not executed in order %v, executed: %v", actions[next], actions, executed)
+		return false
+	}
+	return true
+}
+
+// AssertNotExecuted checks that the last run started none of the actions.
+func (h *Harness) AssertNotExecuted(actions ...string) bool {
+	h.t.Helper()
+	if _, ok := h.lastRun(); !ok {
+		return false
+	}
+	ok := true
+	for _, key := range h.Executed() {
+		for _, action := range actions {
+			if matchesAction(key, action) {
+				h.t.Errorf("action '%s' was executed", key)
+				ok = false
+			}
+		}
+	}
+	return ok
+}
+
+// AssertSkipped checks that the last run skipped each stage ID or action.
+func (h *Harness) AssertSkipped(ids ...string) bool {
+	h.t.Helper()
+	if _, ok := h.lastRun(); !ok {
+		return false
+	}
+	skipped := make(map[string]bool)
+	var names []string
+	for _, event := range h.Events() {
+		switch event.Type {
+		case gostage.EventStageSkipped:
+			skipped[event.StageID] = true
+			names = append(names, event.StageID)
+		case gostage.EventActionSkipped:
+			key := gostage.ActionStatusKey(event.StageID, event.ActionName)
+			skipped[key] = true
+			skipped[event.ActionName] = true
+			names = append(names, key)
+		}
+	}
+
+	ok := true
+	for _, id := range ids {
+		if !skipped[id] {
+			h.t.Errorf("'%s' was not skipped, skipped: %v", id, names)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// AssertStoreEquals checks that the store of the last run workflow holds want,
+// of type T, under key.
+func AssertStoreEquals[T any](h *Harness, key string, want T) bool {
+	h.t.Helper()
+	if _, ok := h.lastRun(); !ok {
+		return false
+	}
+	h.mu.Lock()
+	workflow := h.workflow
+	h.mu.Unlock()
+
+	got, err := store.Get[T](workflow.Store, key)
+	if err != nil {
+		h.t.Errorf("store key '%s': %v", key, err)
+		return false
+	}
+	if !reflect.DeepEqual(got, want) {
+		h.t.Errorf("store key '%s' is %#v, expected %#v", key, got, want)
+		return false
+	}
+	return true
+}
+
+// matchesAction reports whether the ActionStatusKey key designates action,
+// given as a name or a key.
+func matchesAction(key, action string) bool {
+	_, name, _ := strings.Cut(key, ":")
+	return key == action || name == action
+}
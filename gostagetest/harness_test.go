@@ -0,0 +1,152 @@
+package gostagetest
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/davidroman0O/gostage/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingT records the failures reported by the assertions.
+type recordingT struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recordingT) Helper() {}
+
+func (r *recordingT) Errorf(format string, args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+// testAction is an action running a function.
+type testAction struct {
+	gostage.BaseAction
+	fn func(ctx *gostage.ActionContext) error
+}
+
+func newTestAction(name string, fn func(ctx *gostage.ActionContext) error) *testAction {
+	return &testAction{BaseAction: gostage.NewBaseAction(name, ""), fn: fn}
+}
+
+func (a *testAction) Execute(ctx *gostage.ActionContext) error {
+	return a.fn(ctx)
+}
+
+func newOrderWorkflow(failCharge bool) *gostage.Workflow {
+	wf := gostage.NewWorkflow("orders", "Orders", "")
+	checkout := gostage.NewStage("checkout", "Checkout", "")
+	checkout.AddAction(newTestAction("validate", func(ctx *gostage.ActionContext) error {
+		ctx.DisableAction("refund")
+		return nil
+	}))
+	checkout.AddAction(newTestAction("charge", func(ctx *gostage.ActionContext) error {
+		if failCharge {
+			return errors.New("card declined")
+		}
+		return ctx.Store().Put("order.total", 42)
+	}))
+	checkout.AddAction(newTestAction("refund", func(ctx *gostage.ActionContext) error { return nil }))
+	wf.AddStage(checkout)
+
+	shipping := gostage.NewStage("shipping", "Shipping", "")
+	shipping.AddAction(newTestAction("ship", func(ctx *gostage.ActionContext) error {
+		return ctx.Store().Put("order.status", "shipped")
+	}))
+	wf.AddStage(shipping)
+	survey := gostage.NewStage("survey", "Survey", "")
+	survey.AddAction(newTestAction("ask", func(ctx *gostage.ActionContext) error { return nil }))
+	wf.AddStage(survey)
+	wf.DisableStage("survey")
+	return wf
+}
+
+func TestHarnessAssertions(t *testing.T) {
+	h := New(t)
+	result := h.Run(newOrderWorkflow(false))
+	require.True(t, result.Success, "%v", result.Error)
+
+	assert.Equal(t, []string{"checkout:validate", "checkout:charge", "shipping:ship"}, h.Executed())
+	assert.True(t, h.AssertSucceeded())
+	assert.True(t, h.AssertExecutedInOrder("validate", "shipping:ship"))
+	assert.True(t, h.AssertNotExecuted("refund", "ask"))
+	assert.True(t, h.AssertSkipped("survey", "refund", "checkout:refund"))
+	assert.True(t, AssertStoreEquals(h, "order.status", "shipped"))
+	assert.True(t, AssertStoreEquals(h, "order.total", 42))
+}
+
+func TestHarnessReportsFailures(t *testing.T) {
+	rt := &recordingT{}
+	h := New(rt)
+	assert.False(t, h.AssertSucceeded())
+	assert.Equal(t, []string{"gostagetest: no workflow was run"}, rt.failures)
+
+	rt.failures = nil
+	h.Run(newOrderWorkflow(true))
+	assert.False(t, h.AssertSucceeded())
+	assert.True(t, h.AssertFailed())
+	assert.False(t, h.AssertExecutedInOrder("charge", "validate"))
+	assert.False(t, h.AssertNotExecuted("charge"))
+	assert.False(t, h.AssertSkipped("shipping"))
+	assert.False(t, AssertStoreEquals(h, "order.status", "shipped"))
+	assert.False(t, AssertStoreEquals(h, "order.total", "42"))
+	require.Len(t, rt.failures, 6)
+	assert.Contains(t, rt.failures[0], "card declined")
+	assert.Contains(t, rt.failures[1], "action 'validate' was not executed in order")
+	assert.Equal(t, "action 'checkout:charge' was executed", rt.failures[2])
+	assert.Contains(t, rt.failures[3], "'shipping' was not skipped")
+	assert.Contains(t, rt.failures[4], "store key 'order.status'")
+	assert.Contains(t, rt.failures[5], "store key 'order.total'")
+}
+
+func TestHarnessFakeClock(t *testing.T) {
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	h := New(t, WithFakeClock(start))
+
+	var seen time.Time
+	wf := gostage.NewWorkflow("report", "Report", "")
+	stage := gostage.NewStage("build", "Build", "")
+	stage.AddAction(newTestAction("render", func(ctx *gostage.ActionContext) error {
+		seen = ctx.Now()
+		h.Clock.Advance(90 * time.Minute)
+		return nil
+	}))
+	wf.AddStage(stage)
+
+	result := h.Run(wf)
+	require.True(t, result.Success)
+	assert.Equal(t, start, seen)
+	assert.Equal(t, 90*time.Minute, result.ExecutionTime)
+
+	events := h.Events()
+	require.NotEmpty(t, events)
+	assert.Equal(t, start, events[0].Time)
+	assert.Equal(t, start.Add(90*time.Minute), events[len(events)-1].Time)
+}
+
+func TestRunActionsAndStages(t *testing.T) {
+	double := newTestAction("double", func(ctx *gostage.ActionContext) error {
+		n, err := store.Get[int](ctx.Store(), "n")
+		if err != nil {
+			return err
+		}
+		return ctx.Store().Put("n", n*2)
+	})
+
+	result := RunActions(t, map[string]interface{}{"n": 2}, double, double)
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, 8, result.FinalStore["n"])
+
+	h := New(t, WithRunOptions(gostage.RunOptions{InitialStore: map[string]interface{}{"n": 5}}))
+	first := gostage.NewStage("first", "First", "")
+	first.AddAction(double)
+	h.RunStages(first, gostage.NewStage("second", "Second", ""))
+	h.AssertSucceeded()
+	h.AssertExecutedInOrder("first:double")
+	AssertStoreEquals(h, "n", 10)
+}
@@ -0,0 +1,326 @@
+package gostage
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Fill colors used when a run result is overlaid on a rendered graph
+var graphStatusColors = map[string]string{
+	StatusCompleted: "#c8e6c9",
+	StatusFailed:    "#ffcdd2",
+	StatusSkipped:   "#eeeeee",
+	StatusRunning:   "#fff9c4",
+}
+
+// graphNode is a single action (or empty stage placeholder) in a rendered graph.
+type graphNode struct {
+	id       string
+	label    string
+	disabled bool
+	status   string
+}
+
+// graphStage groups the nodes of a stage in a rendered graph.
+type graphStage struct {
+	index    int
+	label    string
+	disabled bool
+	status   string
+	nodes    []graphNode
+	// children are the branches of an if or switch stage, or the stages of a branch
+	children []graphStage
+	// alternatives reports whether only one of the children runs
+	alternatives bool
+}
+
+// ToDOT renders the workflow as a Graphviz DOT digraph.
+// Each stage becomes a cluster containing its actions in execution order,
+// and disabled stages and actions are drawn dashed.
+func (w *Workflow) ToDOT() string {
+	return w.renderDOT(nil)
+}
+
+// ToDOTWithResult renders the workflow as a Graphviz DOT digraph, coloring
+// stages and actions by the statuses recorded in the given run result.
+func (w *Workflow) ToDOTWithResult(result RunResult) string {
+	return w.renderDOT(&result)
+}
+
+// ToMermaid renders the workflow as a Mermaid flowchart.
+// Each stage becomes a subgraph containing its actions in execution order,
+// and disabled stages and actions are styled as disabled.
+func (w *Workflow) ToMermaid() string {
+	return w.renderMermaid(nil)
+}
+
+// ToMermaidWithResult renders the workflow as a Mermaid flowchart, styling
+// stages and actions by the statuses recorded in the given run result.
+func (w *Workflow) ToMermaidWithResult(result RunResult) string {
+	return w.renderMermaid(&result)
+}
+
+// graphBuilder numbers the stages and nodes of a rendered graph.
+type graphBuilder struct {
+	w      *Workflow
+	result *RunResult
+	stages int
+	nodes  int
+}
+
+// graphStages collects the stages and actions to render, with their state.
+func (w *Workflow) graphStages(result *RunResult) []graphStage {
+	b := &graphBuilder{w: w, result: result}
+	stages := make([]graphStage, 0, len(w.Stages))
+	for _, stage := range w.Stages {
+		stages = append(stages, b.stage(stage, false))
+	}
+	return stages
+}
+
+// node adds a node to the graph.
+func (b *graphBuilder) node(label string, disabled bool, status string) graphNode {
+	node := graphNode{id: fmt.Sprintf("n%d", b.nodes), label: label, disabled: disabled, status: status}
+	b.nodes++
+	return node
+}
+
+// group numbers a new cluster of the graph.
+func (b *graphBuilder) group(label string, disabled bool, status string) graphStage {
+	gs := graphStage{index: b.stages, label: label, disabled: disabled, status: status}
+	b.stages++
+	return gs
+}
+
+// stage renders a stage, disabled when a stage containing it is.
+func (b *graphBuilder) stage(stage *Stage, parentDisabled bool) graphStage {
+	status := ""
+	if b.result != nil {
+		status = b.result.StageStatuses[stage.ID]
+	}
+	gs := b.group(graphLabel(stage.Name, stage.ID, stage.Tags, stage.annotations), parentDisabled || !b.w.IsStageEnabled(stage.ID), status)
+
+	// If and switch stages render a decision node followed by their branches
+	if stage.branches != nil {
+		gs.nodes = append(gs.nodes, b.node(stage.branches.kind, gs.disabled, gs.status))
+		gs.alternatives = true
+		for _, branch := range stage.branches.branches {
+			bs := b.group(branch.Name, gs.disabled, "")
+			for _, nested := range branch.Stages {
+				bs.children = append(bs.children, b.stage(nested, gs.disabled))
+			}
+			if len(bs.children) == 0 {
+				bs.nodes = append(bs.nodes, b.node("(no stages)", gs.disabled, ""))
+			}
+			gs.children = append(gs.children, bs)
+		}
+		return gs
+	}
+
+	for _, action := range stage.Actions {
+		actionStatus := ""
+		if b.result != nil {
+			actionStatus = b.result.ActionStatuses[ActionStatusKey(stage.ID, action.Name())]
+		}
+		gs.nodes = append(gs.nodes, b.node(graphLabel(action.Name(), "", action.Tags(), ActionAnnotations(action)),
+			gs.disabled || !b.w.IsActionEnabled(action.Name()), actionStatus))
+	}
+
+	// Empty stages still need a node so they can be linked into the flow
+	if len(gs.nodes) == 0 {
+		gs.nodes = append(gs.nodes, b.node("(no actions)", gs.disabled, gs.status))
+	}
+	return gs
+}
+
+// graphEdges returns the execution edges between nodes.
+func graphEdges(stages []graphStage) [][2]string {
+	var edges [][2]string
+	var tails []string
+	for _, stage := range stages {
+		tails = stage.link(tails, &edges)
+	}
+	return edges
+}
+
+// link adds the edges from the tails, the nodes executed last before the
+// stage, through the stage, and returns the nodes executed last in it.
+func (s graphStage) link(tails []string, edges *[][2]string) []string {
+	for _, node := range s.nodes {
+		for _, tail := range tails {
+			*edges = append(*edges, [2]string{tail, node.id})
+		}
+		tails = []string{node.id}
+	}
+	if !s.alternatives {
+		for _, child := range s.children {
+			tails = child.link(tails, edges)
+		}
+		return tails
+	}
+
+	var joined []string
+	for _, child := range s.children {
+		joined = append(joined, child.link(tails, edges)...)
+	}
+	return joined
+}
+
+// graphLabel builds a node label from a name, falling back to the id,
+// followed by tags and one key=value line per annotation.
+func graphLabel(name, id string, tags []string, annotations map[string]string) string {
+	if name == "" {
+		name = id
+	}
+	if len(tags) > 0 {
+		name = fmt.Sprintf("%s\n[%s]", name, strings.Join(tags, ", "))
+	}
+	if len(annotations) > 0 {
+		name += "\n" + annotationLines(annotations)
+	}
+	return name
+}
+
+func (w *Workflow) renderDOT(result *RunResult) string {
+	var b strings.Builder
+	stages := w.graphStages(result)
+
+	fmt.Fprintf(&b, "digraph %s {\n", dotQuote(w.ID))
+	b.WriteString("  rankdir=LR;\n")
+	fmt.Fprintf(&b, "  label=%s;\n", dotQuote(graphLabel(w.Name, w.ID, w.Tags, w.annotations)))
+	b.WriteString("  node [shape=box, style=\"rounded,filled\", fillcolor=\"#ffffff\"];\n")
+
+	for _, stage := range stages {
+		writeDOTCluster(&b, stage, "  ")
+	}
+
+	for _, edge := range graphEdges(stages) {
+		fmt.Fprintf(&b, "  %s -> %s;\n", edge[0], edge[1])
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// writeDOTCluster writes a stage and the stages it contains as nested clusters.
+func writeDOTCluster(b *strings.Builder, stage graphStage, indent string) {
+	fmt.Fprintf(b, "%ssubgraph cluster_%d {\n", indent, stage.index)
+	fmt.Fprintf(b, "%s  label=%s;\n", indent, dotQuote(stage.label))
+	for _, attr := range dotStyle(stage.disabled, stage.status) {
+		fmt.Fprintf(b, "%s  %s;\n", indent, attr)
+	}
+	for _, node := range stage.nodes {
+		attrs := append([]string{"label=" + dotQuote(node.label)}, dotStyle(node.disabled, node.status)...)
+		fmt.Fprintf(b, "%s  %s [%s];\n", indent, node.id, strings.Join(attrs, ", "))
+	}
+	for _, child := range stage.children {
+		writeDOTCluster(b, child, indent+"  ")
+	}
+	fmt.Fprintf(b, "%s}\n", indent)
+}
+
+// dotStyle returns the DOT attributes for the given state.
+func dotStyle(disabled bool, status string) []string {
+	var attrs []string
+	if disabled {
+		attrs = append(attrs, `style="rounded,filled,dashed"`, `color="#9e9e9e"`, `fontcolor="#9e9e9e"`)
+	}
+	if color, ok := graphStatusColors[status]; ok {
+		if !disabled {
+			attrs = append(attrs, `style="rounded,filled"`)
+		}
+		attrs = append(attrs, fmt.Sprintf("fillcolor=%q", color))
+	}
+	return attrs
+}
+
+// dotQuote quotes a string for use as a DOT identifier or label.
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
+
+func (w *Workflow) renderMermaid(result *RunResult) string {
+	var b strings.Builder
+	stages := w.graphStages(result)
+	classes := make(map[string][]string)
+	var classOrder []string
+	addClass := func(class, id string) {
+		if _, ok := classes[class]; !ok {
+			classOrder = append(classOrder, class)
+		}
+		classes[class] = append(classes[class], id)
+	}
+
+	b.WriteString("flowchart LR\n")
+	var writeSubgraph func(stage graphStage, indent string)
+	writeSubgraph = func(stage graphStage, indent string) {
+		stageID := fmt.Sprintf("s%d", stage.index)
+		fmt.Fprintf(&b, "%ssubgraph %s[%s]\n", indent, stageID, mermaidQuote(stage.label))
+		for _, node := range stage.nodes {
+			fmt.Fprintf(&b, "%s  %s[%s]\n", indent, node.id, mermaidQuote(node.label))
+			if class := mermaidClass(node.disabled, node.status); class != "" {
+				addClass(class, node.id)
+			}
+		}
+		for _, child := range stage.children {
+			writeSubgraph(child, indent+"  ")
+		}
+		fmt.Fprintf(&b, "%send\n", indent)
+		if class := mermaidClass(stage.disabled, stage.status); class != "" {
+			addClass(class, stageID)
+		}
+	}
+	for _, stage := range stages {
+		writeSubgraph(stage, "  ")
+	}
+
+	for _, edge := range graphEdges(stages) {
+		fmt.Fprintf(&b, "  %s --> %s\n", edge[0], edge[1])
+	}
+
+	for _, class := range classOrder {
+		fmt.Fprintf(&b, "  classDef %s %s\n", class, mermaidClassDefs[class])
+	}
+	for _, class := range classOrder {
+		fmt.Fprintf(&b, "  class %s %s\n", strings.Join(classes[class], ","), class)
+	}
+	return b.String()
+}
+
+// Mermaid class definitions for each rendered state
+var mermaidClassDefs = map[string]string{
+	"disabled":  "fill:#f5f5f5,stroke:#9e9e9e,color:#9e9e9e,stroke-dasharray:5 5",
+	"completed": "fill:" + graphStatusColors[StatusCompleted],
+	"failed":    "fill:" + graphStatusColors[StatusFailed],
+	"skipped":   "fill:" + graphStatusColors[StatusSkipped],
+	"running":   "fill:" + graphStatusColors[StatusRunning],
+}
+
+// mermaidClass returns the class for the given state, or an empty string.
+// A recorded status takes precedence over the disabled state.
+func mermaidClass(disabled bool, status string) string {
+	switch status {
+	case StatusCompleted:
+		return "completed"
+	case StatusFailed:
+		return "failed"
+	case StatusSkipped:
+		return "skipped"
+	case StatusRunning:
+		return "running"
+	}
+	if disabled {
+		return "disabled"
+	}
+	return ""
+}
+
+// mermaidQuote quotes a string for use as a Mermaid node label.
+func mermaidQuote(s string) string {
+	s = strings.ReplaceAll(s, `"`, "#quot;")
+	s = strings.ReplaceAll(s, "\n", "<br/>")
+	return `"` + s + `"`
+}
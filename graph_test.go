@@ -0,0 +1,86 @@
+package gostage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newGraphWorkflow() *Workflow {
+	wf := NewWorkflow("deploy", "Deploy", "deploys the service")
+
+	build := NewStageWithTags("build", "Build", "", []string{"ci"})
+	build.AddAction(NewTestActionWithTags("compile", "", []string{"go"}, func(ctx *ActionContext) error { return nil }))
+	build.AddAction(NewTestAction("lint \"strict\"", "", func(ctx *ActionContext) error { return nil }))
+	wf.AddStage(build)
+
+	release := NewStage("release", "Release", "")
+	release.AddAction(NewTestAction("publish", "", func(ctx *ActionContext) error {
+		return errors.New("registry unavailable")
+	}))
+	release.AddAction(NewTestAction("notify", "", func(ctx *ActionContext) error { return nil }))
+	wf.AddStage(release)
+
+	wf.AddStage(NewStage("cleanup", "Cleanup", ""))
+	return wf
+}
+
+func TestWorkflowToDOT(t *testing.T) {
+	wf := newGraphWorkflow()
+	wf.DisableAction("notify")
+
+	dot := wf.ToDOT()
+	assert.Contains(t, dot, `digraph "deploy" {`)
+	assert.Contains(t, dot, "rankdir=LR;")
+	assert.Contains(t, dot, `label="Build\n[ci]";`)
+	assert.Contains(t, dot, `n0 [label="compile\n[go]"];`)
+	assert.Contains(t, dot, `n1 [label="lint \"strict\""];`)
+	assert.Contains(t, dot, `n3 [label="notify", style="rounded,filled,dashed"`)
+	assert.Contains(t, dot, `n4 [label="(no actions)"];`)
+	for _, edge := range []string{"n0 -> n1;", "n1 -> n2;", "n2 -> n3;", "n3 -> n4;"} {
+		assert.Contains(t, dot, edge)
+	}
+	assert.NotContains(t, dot, "fillcolor=\"#c8e6c9\"")
+}
+
+func TestWorkflowToMermaid(t *testing.T) {
+	wf := newGraphWorkflow()
+	wf.DisableStage("cleanup")
+
+	mermaid := wf.ToMermaid()
+	assert.Contains(t, mermaid, "flowchart LR\n")
+	assert.Contains(t, mermaid, `subgraph s0["Build<br/>[ci]"]`)
+	assert.Contains(t, mermaid, `n1["lint #quot;strict#quot;"]`)
+	assert.Contains(t, mermaid, "n3 --> n4")
+	assert.Contains(t, mermaid, "class n4,s2 disabled")
+}
+
+func TestWorkflowGraphWithResult(t *testing.T) {
+	wf := newGraphWorkflow()
+	wf.DisableAction("lint \"strict\"")
+
+	runner := NewRunner()
+	result := runner.ExecuteWithOptions(wf, RunOptions{Logger: &TestLogger{t: t}, Context: context.Background()})
+	require.False(t, result.Success)
+
+	assert.Equal(t, StatusCompleted, result.StageStatuses["build"])
+	assert.Equal(t, StatusFailed, result.StageStatuses["release"])
+	assert.Equal(t, StatusCompleted, result.ActionStatuses[ActionStatusKey("build", "compile")])
+	assert.Equal(t, StatusSkipped, result.ActionStatuses[ActionStatusKey("build", "lint \"strict\"")])
+	assert.Equal(t, StatusFailed, result.ActionStatuses[ActionStatusKey("release", "publish")])
+	assert.NotContains(t, result.ActionStatuses, ActionStatusKey("release", "notify"))
+
+	dot := wf.ToDOTWithResult(result)
+	assert.Contains(t, dot, `n0 [label="compile\n[go]", style="rounded,filled", fillcolor="#c8e6c9"];`)
+	assert.Contains(t, dot, `fillcolor="#eeeeee"`)
+	assert.Contains(t, dot, `n2 [label="publish", style="rounded,filled", fillcolor="#ffcdd2"];`)
+	assert.Contains(t, dot, `n3 [label="notify"];`)
+
+	mermaid := wf.ToMermaidWithResult(result)
+	assert.Contains(t, mermaid, "class n0,s0 completed")
+	assert.Contains(t, mermaid, "class n1 skipped")
+	assert.Contains(t, mermaid, "class n2,s1 failed")
+}
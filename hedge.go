@@ -0,0 +1,117 @@
+package gostage
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"time"
+)
+
+// hedgedAction starts a duplicate attempt of an existing action when it is slow.
+type hedgedAction struct {
+	Action
+	delay time.Duration
+}
+
+// WithHedging starts a duplicate attempt of action when it has not finished
+// after delay, and keeps whichever attempt succeeds first. The other attempt
+// is cancelled through its GoContext and not waited for. When an attempt
+// fails, the action waits for the other one and fails only if both do.
+//
+// Both attempts may change the store and reach external systems, so only
+// hedge idempotent actions. The duplicate runs a copy of the action made with
+// CloneAction. An EventActionHedged event is published when it starts.
+func WithHedging(action Action, delay time.Duration) Action {
+	return &hedgedAction{Action: action, delay: delay}
+}
+
+// hedgeOutcome is the outcome of one attempt of a hedged action.
+type hedgeOutcome struct {
+	attempt *ActionContext
+	err     error
+}
+
+func (a *hedgedAction) Execute(ctx *ActionContext) error {
+	parent := ctx.GoContext
+	if parent == nil {
+		parent = context.Background()
+	}
+	attemptCtx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	outcomes := make(chan hedgeOutcome, 2)
+	start := func(action Action) {
+		attempt := ctx.attemptContext(attemptCtx)
+		go func() {
+			outcomes <- hedgeOutcome{attempt: attempt, err: executeAction(attempt, action)}
+		}()
+	}
+
+	start(a.Action)
+	running := 1
+	timer := ctx.Clock().NewTimer(a.delay)
+	defer timer.Stop()
+
+	var firstErr error
+	for {
+		select {
+		case <-timer.C():
+			ctx.Logger.Info("Action %s is slower than %s, starting a hedged attempt", a.Name(), a.delay)
+			ctx.Emit(EventActionHedged, map[string]interface{}{"delay": a.delay.String()})
+			start(CloneAction(a.Action))
+			running++
+		case outcome := <-outcomes:
+			running--
+			if outcome.err == nil {
+				ctx.adoptAttempt(outcome.attempt)
+				return nil
+			}
+			if firstErr == nil {
+				firstErr = outcome.err
+			}
+			if running == 0 {
+				return firstErr
+			}
+		}
+	}
+}
+
+// Clone copies the hedged action.
+func (a *hedgedAction) Clone() Action {
+	return &hedgedAction{Action: CloneAction(a.Action), delay: a.delay}
+}
+
+// attemptContext returns a copy of ctx for a concurrent attempt of its
+// action, running under goCtx and recording its dynamic changes separately.
+func (ctx *ActionContext) attemptContext(goCtx context.Context) *ActionContext {
+	attempt := *ctx
+	attempt.GoContext = goCtx
+	attempt.dynamicActions = slices.Clone(ctx.dynamicActions)
+	attempt.dynamicActionPlacements = slices.Clone(ctx.dynamicActionPlacements)
+	attempt.dynamicStages = slices.Clone(ctx.dynamicStages)
+	attempt.disabledActions = maps.Clone(ctx.disabledActions)
+	attempt.disabledStages = maps.Clone(ctx.disabledStages)
+	attempt.result = nil
+	return &attempt
+}
+
+// adoptAttempt keeps the dynamic changes and result of the winning attempt.
+// The disabled maps are updated in place as the runner shares them.
+func (ctx *ActionContext) adoptAttempt(attempt *ActionContext) {
+	ctx.dynamicActions = attempt.dynamicActions
+	ctx.dynamicActionPlacements = attempt.dynamicActionPlacements
+	ctx.dynamicStages = attempt.dynamicStages
+	ctx.disabledActions = replaceFlags(ctx.disabledActions, attempt.disabledActions)
+	ctx.disabledStages = replaceFlags(ctx.disabledStages, attempt.disabledStages)
+	ctx.result = attempt.result
+}
+
+// replaceFlags replaces the content of flags with that of values.
+func replaceFlags(flags, values map[string]bool) map[string]bool {
+	if flags == nil {
+		return values
+	}
+	clear(flags)
+	maps.Copy(flags, values)
+	return flags
+}
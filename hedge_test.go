@@ -0,0 +1,104 @@
+package gostage
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithHedging(t *testing.T) {
+	var attempts atomic.Int32
+	lostCancelled := make(chan struct{})
+	lookup := NewActionFunc("lookup", "", func(ctx *ActionContext) error {
+		if attempts.Add(1) == 1 {
+			<-ctx.GoContext.Done()
+			close(lostCancelled)
+			return ctx.GoContext.Err()
+		}
+		ctx.SetResult(ActionResult{Output: "replica"})
+		ctx.AddDynamicAction(NewActionFunc("audit", "", func(ctx *ActionContext) error {
+			return ctx.Store().Put("audited", true)
+		}))
+		return nil
+	})
+
+	wf := NewWorkflow("hedging", "Hedging", "")
+	stage := NewStage("query", "Query", "")
+	stage.AddAction(WithHedging(lookup, 10*time.Millisecond))
+	wf.AddStage(stage)
+
+	runner := NewRunner()
+	var hedged []Event
+	runner.Subscribe(EventActionHedged, func(event Event) { hedged = append(hedged, event) })
+
+	result := runner.ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, int32(2), attempts.Load())
+	assert.Equal(t, "replica", result.ActionResults[ActionStatusKey("query", "lookup")].Output)
+	assert.Equal(t, true, result.FinalStore["audited"])
+
+	require.Len(t, hedged, 1)
+	assert.Equal(t, "lookup", hedged[0].ActionName)
+	assert.Equal(t, "10ms", hedged[0].Payload["delay"])
+
+	select {
+	case <-lostCancelled:
+	case <-time.After(time.Second):
+		t.Fatal("the slow attempt was not cancelled")
+	}
+}
+
+func TestWithHedgingFastAction(t *testing.T) {
+	var attempts atomic.Int32
+	action := NewActionFunc("lookup", "", func(ctx *ActionContext) error {
+		attempts.Add(1)
+		return nil
+	})
+
+	result := runSingleAction(t, context.Background(), WithHedging(action, time.Minute), nil)
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, int32(1), attempts.Load())
+}
+
+func TestWithHedgingFailures(t *testing.T) {
+	errTimeout := errors.New("upstream timeout")
+	errRefused := errors.New("connection refused")
+
+	// A failure before the delay is not hedged
+	var attempts atomic.Int32
+	result := runSingleAction(t, context.Background(), WithHedging(NewActionFunc("lookup", "", func(*ActionContext) error {
+		attempts.Add(1)
+		return errRefused
+	}), time.Minute), nil)
+	assert.ErrorIs(t, result.Error, errRefused)
+	assert.Equal(t, int32(1), attempts.Load())
+
+	// A slow attempt that fails leaves the other attempt a chance
+	attempts.Store(0)
+	result = runSingleAction(t, context.Background(), WithHedging(NewActionFunc("lookup", "", func(*ActionContext) error {
+		if attempts.Add(1) == 1 {
+			time.Sleep(30 * time.Millisecond)
+			return errTimeout
+		}
+		return nil
+	}), 10*time.Millisecond), nil)
+	require.True(t, result.Success, "%v", result.Error)
+
+	// Both attempts failing fail the action with the first error
+	attempts.Store(0)
+	result = runSingleAction(t, context.Background(), WithHedging(NewActionFunc("lookup", "", func(*ActionContext) error {
+		if attempts.Add(1) == 1 {
+			time.Sleep(30 * time.Millisecond)
+			return errTimeout
+		}
+		time.Sleep(60 * time.Millisecond)
+		return errRefused
+	}), 10*time.Millisecond), nil)
+	assert.ErrorIs(t, result.Error, errTimeout)
+	assert.Equal(t, int32(2), attempts.Load())
+}
@@ -0,0 +1,121 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileStore is a Store that keeps each run in its own JSON file.
+type FileStore struct {
+	mu  sync.RWMutex
+	dir string
+}
+
+// NewFileStore creates a file-backed store rooted at dir.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Dir returns the directory where runs are written.
+func (s *FileStore) Dir() string {
+	return s.dir
+}
+
+// SaveRun implements Store.SaveRun. The file is replaced atomically.
+func (s *FileStore) SaveRun(run Run) error {
+	if run.ID == "" || strings.ContainsAny(run.ID, `/\`) {
+		return fmt.Errorf("invalid run ID '%s'", run.ID)
+	}
+	data, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("failed to encode run: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmp, err := os.CreateTemp(s.dir, ".run-*")
+	if err != nil {
+		return fmt.Errorf("failed to write run: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write run: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write run: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path(run.ID)); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write run: %w", err)
+	}
+	return nil
+}
+
+// GetRun implements Store.GetRun.
+func (s *FileStore) GetRun(runID string) (*Run, error) {
+	if strings.ContainsAny(runID, `/\`) {
+		return nil, ErrNotFound
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	run, err := readRun(s.path(runID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return run, err
+}
+
+// ListRuns implements Store.ListRuns. Every run file is read.
+func (s *FileStore) ListRuns(workflowID, status string, since time.Time) ([]Run, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+
+	runs := []Run{}
+	for _, path := range paths {
+		run, err := readRun(path)
+		if err != nil {
+			return nil, err
+		}
+		if matches(*run, workflowID, status, since) {
+			runs = append(runs, *run)
+		}
+	}
+	sortRuns(runs)
+	return runs, nil
+}
+
+func (s *FileStore) path(runID string) string {
+	return filepath.Join(s.dir, runID+".json")
+}
+
+// readRun reads the run stored in a file.
+func readRun(path string) (*Run, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run %s: %w", filepath.Base(path), err)
+	}
+	var run Run
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("failed to parse run %s: %w", filepath.Base(path), err)
+	}
+	return &run, nil
+}
@@ -0,0 +1,204 @@
+// Package history keeps the outcome of past workflow runs.
+//
+// A Store persists one Run per execution and answers queries about them, to
+// power dashboards and the HTTP API. Runners record every run they execute
+// once given a store:
+//
+//	store, err := history.NewFileStore("/var/lib/gostage/history")
+//	runner := gostage.NewRunner(gostage.WithHistory(store))
+//
+//	failed, err := store.ListRuns("deploy", history.StatusFailed, time.Now().Add(-24*time.Hour))
+//
+// MemoryStore keeps runs in memory, FileStore writes one JSON file per run
+// and SQLiteStore uses a SQLite database.
+package history
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned when a run is not in the store
+var ErrNotFound = errors.New("run not found")
+
+// Final statuses of a run
+const (
+	StatusCompleted   = "completed"
+	StatusFailed      = "failed"
+	StatusInterrupted = "interrupted"
+)
+
+// Run is the outcome of a workflow execution.
+type Run struct {
+	ID         string    `json:"id"`
+	WorkflowID string    `json:"workflowId"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	// StageStatuses holds the status of each stage reached, keyed by stage ID
+	StageStatuses map[string]string `json:"stageStatuses,omitempty"`
+	// ActionStatuses holds the status of each action reached, keyed by "stageID:actionName"
+	ActionStatuses map[string]string `json:"actionStatuses,omitempty"`
+	// Tenant is the tenant of the runner that executed the run, if any
+	Tenant string `json:"tenant,omitempty"`
+	// Labels are the labels the run was submitted with, such as its caller or cost center
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Duration returns how long the run took.
+func (r Run) Duration() time.Duration {
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+// Usage is the share of runs and run time attributed to a label value.
+type Usage struct {
+	Runs     int           `json:"runs"`
+	Failures int           `json:"failures"`
+	Duration time.Duration `json:"duration"`
+}
+
+// UsageByLabel adds up the runs, failures and durations of runs by the value
+// of their label key, such as the team or caller that started them. Runs
+// without the label are counted under "".
+func UsageByLabel(runs []Run, key string) map[string]Usage {
+	usage := make(map[string]Usage)
+	for _, run := range runs {
+		value := run.Labels[key]
+		u := usage[value]
+		u.Runs++
+		if run.Status == StatusFailed {
+			u.Failures++
+		}
+		u.Duration += run.Duration()
+		usage[value] = u
+	}
+	return usage
+}
+
+// Store persists runs and queries them.
+type Store interface {
+	// SaveRun records a run, replacing any run with the same ID
+	SaveRun(run Run) error
+
+	// GetRun returns the run with the given ID, or ErrNotFound
+	GetRun(runID string) (*Run, error)
+
+	// ListRuns returns the runs of a workflow with a status that started at
+	// or after since, most recent first. An empty workflow ID or status and a
+	// zero since match every run.
+	ListRuns(workflowID, status string, since time.Time) ([]Run, error)
+}
+
+// matches reports whether a run matches the filters of ListRuns.
+func matches(run Run, workflowID, status string, since time.Time) bool {
+	return (workflowID == "" || run.WorkflowID == workflowID) &&
+		(status == "" || run.Status == status) &&
+		!run.StartedAt.Before(since)
+}
+
+// sortRuns orders runs most recent first.
+func sortRuns(runs []Run) {
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+}
+
+// MemoryStore is a Store kept in memory.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	runs map[string]Run
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{runs: make(map[string]Run)}
+}
+
+// SaveRun implements Store.SaveRun.
+func (s *MemoryStore) SaveRun(run Run) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runs[run.ID] = run
+	return nil
+}
+
+// GetRun implements Store.GetRun.
+func (s *MemoryStore) GetRun(runID string) (*Run, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	run, ok := s.runs[runID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &run, nil
+}
+
+// ListRuns implements Store.ListRuns.
+func (s *MemoryStore) ListRuns(workflowID, status string, since time.Time) ([]Run, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	runs := []Run{}
+	for _, run := range s.runs {
+		if matches(run, workflowID, status, since) {
+			runs = append(runs, run)
+		}
+	}
+	sortRuns(runs)
+	return runs, nil
+}
+
+// TenantStore is a Store shared by several tenants that only sees the runs of one.
+type TenantStore struct {
+	store  Store
+	tenant string
+}
+
+// ForTenant scopes store to tenant. Saved runs are recorded as the tenant's,
+// and runs of other tenants are neither listed nor found. Give it to the
+// handlers serving a tenant, such as the HTTP API.
+func ForTenant(store Store, tenant string) *TenantStore {
+	return &TenantStore{store: store, tenant: tenant}
+}
+
+// Tenant returns the tenant the store is scoped to.
+func (s *TenantStore) Tenant() string {
+	return s.tenant
+}
+
+// SaveRun implements Store.SaveRun.
+func (s *TenantStore) SaveRun(run Run) error {
+	run.Tenant = s.tenant
+	return s.store.SaveRun(run)
+}
+
+// GetRun implements Store.GetRun.
+func (s *TenantStore) GetRun(runID string) (*Run, error) {
+	run, err := s.store.GetRun(runID)
+	if err != nil {
+		return nil, err
+	}
+	if run.Tenant != s.tenant {
+		return nil, ErrNotFound
+	}
+	return run, nil
+}
+
+// ListRuns implements Store.ListRuns.
+func (s *TenantStore) ListRuns(workflowID, status string, since time.Time) ([]Run, error) {
+	runs, err := s.store.ListRuns(workflowID, status, since)
+	if err != nil {
+		return nil, err
+	}
+	owned := runs[:0]
+	for _, run := range runs {
+		if run.Tenant == s.tenant {
+			owned = append(owned, run)
+		}
+	}
+	return owned, nil
+}
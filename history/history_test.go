@@ -0,0 +1,130 @@
+package history
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testStore(t *testing.T, store Store) {
+	t.Helper()
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	runs := []Run{
+		{ID: "a1", WorkflowID: "deploy", Status: StatusCompleted, StartedAt: base, FinishedAt: base.Add(time.Minute)},
+		{ID: "a2", WorkflowID: "deploy", Status: StatusFailed, Error: "action 'push' failed", StartedAt: base.Add(time.Hour), FinishedAt: base.Add(time.Hour + time.Second)},
+		{ID: "b1", WorkflowID: "backup", Status: StatusCompleted, StartedAt: base.Add(2 * time.Hour), FinishedAt: base.Add(3 * time.Hour),
+			StageStatuses: map[string]string{"dump": StatusCompleted}, ActionStatuses: map[string]string{"dump:pg_dump": StatusCompleted}},
+	}
+	for _, run := range runs {
+		require.NoError(t, store.SaveRun(run))
+	}
+
+	run, err := store.GetRun("b1")
+	require.NoError(t, err)
+	assert.Equal(t, "backup", run.WorkflowID)
+	assert.True(t, run.StartedAt.Equal(runs[2].StartedAt))
+	assert.Equal(t, time.Hour, run.Duration())
+	assert.Equal(t, StatusCompleted, run.ActionStatuses["dump:pg_dump"])
+
+	_, err = store.GetRun("missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	ids := func(workflowID, status string, since time.Time) []string {
+		runs, err := store.ListRuns(workflowID, status, since)
+		require.NoError(t, err)
+		out := []string{}
+		for _, run := range runs {
+			out = append(out, run.ID)
+		}
+		return out
+	}
+	assert.Equal(t, []string{"b1", "a2", "a1"}, ids("", "", time.Time{}))
+	assert.Equal(t, []string{"a2", "a1"}, ids("deploy", "", time.Time{}))
+	assert.Equal(t, []string{"a2"}, ids("deploy", StatusFailed, time.Time{}))
+	assert.Equal(t, []string{"b1", "a2"}, ids("", "", base.Add(time.Hour)))
+	assert.Equal(t, []string{}, ids("cleanup", "", time.Time{}))
+
+	// Saving a run again replaces it
+	runs[1].Status = StatusCompleted
+	require.NoError(t, store.SaveRun(runs[1]))
+	assert.Equal(t, []string{"b1", "a2", "a1"}, ids("", StatusCompleted, time.Time{}))
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "history")
+	store, err := NewFileStore(dir)
+	require.NoError(t, err)
+	assert.Equal(t, dir, store.Dir())
+	testStore(t, store)
+
+	assert.Error(t, store.SaveRun(Run{ID: "../escape"}))
+	_, err = store.GetRun("../a1")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestSQLiteStore(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "history.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	store, err := NewSQLiteStore(db)
+	require.NoError(t, err)
+	testStore(t, store)
+
+	// Opening an existing database keeps its runs
+	reopened, err := NewSQLiteStore(db)
+	require.NoError(t, err)
+	run, err := reopened.GetRun("a1")
+	require.NoError(t, err)
+	assert.Equal(t, "deploy", run.WorkflowID)
+}
+
+func TestTenantStore(t *testing.T) {
+	shared := NewMemoryStore()
+	teamA := ForTenant(shared, "team-a")
+	teamB := ForTenant(shared, "team-b")
+	testStore(t, teamA)
+
+	started := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, teamB.SaveRun(Run{ID: "c1", WorkflowID: "deploy", Status: StatusCompleted, StartedAt: started, FinishedAt: started}))
+
+	run, err := shared.GetRun("a1")
+	require.NoError(t, err)
+	assert.Equal(t, "team-a", run.Tenant)
+
+	_, err = teamB.GetRun("a1")
+	assert.ErrorIs(t, err, ErrNotFound)
+	runs, err := teamB.ListRuns("deploy", "", time.Time{})
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, "c1", runs[0].ID)
+
+	runs, err = shared.ListRuns("deploy", "", time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, runs, 3)
+}
+
+func TestUsageByLabel(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	runs := []Run{
+		{ID: "1", Status: StatusCompleted, StartedAt: start, FinishedAt: start.Add(time.Minute), Labels: map[string]string{"team": "payments"}},
+		{ID: "2", Status: StatusFailed, StartedAt: start, FinishedAt: start.Add(2 * time.Minute), Labels: map[string]string{"team": "payments"}},
+		{ID: "3", Status: StatusCompleted, StartedAt: start, FinishedAt: start.Add(time.Second), Labels: map[string]string{"team": "search"}},
+		{ID: "4", Status: StatusCompleted, StartedAt: start, FinishedAt: start.Add(time.Second)},
+	}
+
+	assert.Equal(t, map[string]Usage{
+		"payments": {Runs: 2, Failures: 1, Duration: 3 * time.Minute},
+		"search":   {Runs: 1, Duration: time.Second},
+		"":         {Runs: 1, Duration: time.Second},
+	}, UsageByLabel(runs, "team"))
+}
@@ -0,0 +1,113 @@
+package history
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SQLiteStore is a Store kept in a SQLite database, in a runs table it
+// creates if needed. The application opens the database with the SQLite
+// driver of its choice:
+//
+//	db, err := sql.Open("sqlite3", "history.db")
+//	store, err := history.NewSQLiteStore(db)
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS runs (
+	id TEXT PRIMARY KEY,
+	workflow_id TEXT NOT NULL,
+	status TEXT NOT NULL,
+	started_at INTEGER NOT NULL,
+	run TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS runs_workflow_started ON runs (workflow_id, started_at)`
+
+// NewSQLiteStore creates a store in db, creating its table if needed.
+func NewSQLiteStore(db *sql.DB) (*SQLiteStore, error) {
+	for _, statement := range strings.Split(sqliteSchema, ";") {
+		if _, err := db.Exec(statement); err != nil {
+			return nil, fmt.Errorf("failed to create history table: %w", err)
+		}
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// SaveRun implements Store.SaveRun.
+func (s *SQLiteStore) SaveRun(run Run) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("failed to encode run: %w", err)
+	}
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO runs (id, workflow_id, status, started_at, run) VALUES (?, ?, ?, ?, ?)`,
+		run.ID, run.WorkflowID, run.Status, run.StartedAt.UnixNano(), string(data))
+	if err != nil {
+		return fmt.Errorf("failed to save run: %w", err)
+	}
+	return nil
+}
+
+// GetRun implements Store.GetRun.
+func (s *SQLiteStore) GetRun(runID string) (*Run, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT run FROM runs WHERE id = ?`, runID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get run: %w", err)
+	}
+
+	var run Run
+	if err := json.Unmarshal([]byte(data), &run); err != nil {
+		return nil, fmt.Errorf("failed to parse run %s: %w", runID, err)
+	}
+	return &run, nil
+}
+
+// ListRuns implements Store.ListRuns.
+func (s *SQLiteStore) ListRuns(workflowID, status string, since time.Time) ([]Run, error) {
+	query := `SELECT run FROM runs WHERE 1 = 1`
+	var args []interface{}
+	if workflowID != "" {
+		query += ` AND workflow_id = ?`
+		args = append(args, workflowID)
+	}
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	if !since.IsZero() {
+		query += ` AND started_at >= ?`
+		args = append(args, since.UnixNano())
+	}
+	query += ` ORDER BY started_at DESC`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []Run{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to list runs: %w", err)
+		}
+		var run Run
+		if err := json.Unmarshal([]byte(data), &run); err != nil {
+			return nil, fmt.Errorf("failed to parse run: %w", err)
+		}
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+	return runs, nil
+}
@@ -0,0 +1,83 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/davidroman0O/gostage"
+)
+
+// DecisionRequest is the body of a request deciding on a pending approval.
+type DecisionRequest struct {
+	Approved bool   `json:"approved"`
+	Approver string `json:"approver,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// WithApprovals exposes the pending requests of gate and lets clients decide
+// on them:
+//
+//	GET  /approvals        list pending approvals
+//	POST /approvals/{id}   decide, with {"approved": true, "approver": "...", "comment": "..."}
+//
+// With WithAuth, the approver is the authenticated caller.
+func WithApprovals(gate *gostage.ApprovalGate) Option {
+	return func(h *Handler) {
+		h.approvals = gate
+	}
+}
+
+func (h *Handler) listApprovals(w http.ResponseWriter, r *http.Request) {
+	pending := []gostage.ApprovalRequest{}
+	for _, request := range h.approvals.Pending() {
+		if h.allowed(r, PermissionView, request.WorkflowID) {
+			pending = append(pending, request)
+		}
+	}
+	writeJSON(w, http.StatusOK, pending)
+}
+
+// pendingApproval returns the pending approval request with the given ID.
+func (h *Handler) pendingApproval(id string) (gostage.ApprovalRequest, bool) {
+	for _, request := range h.approvals.Pending() {
+		if request.ID == id {
+			return request, true
+		}
+	}
+	return gostage.ApprovalRequest{}, false
+}
+
+func (h *Handler) decideApproval(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	request, ok := h.pendingApproval(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "approval '%s' not found", id)
+		return
+	}
+	if !h.authorizeFound(w, r, PermissionApprove, request.WorkflowID, "approval", id) {
+		return
+	}
+
+	var req DecisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, "invalid request body: %v", err)
+		return
+	}
+
+	decision := gostage.ApprovalDecision{Approved: req.Approved, Approver: req.Approver, Comment: req.Comment}
+	// Authenticated callers cannot decide on behalf of someone else
+	if principal, ok := PrincipalFromContext(r.Context()); ok {
+		decision.Approver = principal.Subject
+	}
+	if err := h.approvals.Decide(id, decision); err != nil {
+		if errors.Is(err, gostage.ErrNoPendingApproval) {
+			writeError(w, http.StatusNotFound, "approval '%s' not found", id)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,344 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+)
+
+// ErrUnauthenticated is returned by authenticators when a request carries no
+// valid credentials.
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// Permission is an operation a caller may be granted on a workflow.
+type Permission string
+
+const (
+	// PermissionView lets callers see a workflow, its runs and its history
+	PermissionView Permission = "view"
+	// PermissionViewLogs lets callers stream the events of the workflow's runs
+	PermissionViewLogs Permission = "logs"
+	// PermissionTrigger lets callers start runs of the workflow
+	PermissionTrigger Permission = "trigger"
+	// PermissionCancel lets callers cancel runs of the workflow
+	PermissionCancel Permission = "cancel"
+	// PermissionApprove lets callers decide on the approvals of the workflow
+	PermissionApprove Permission = "approve"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	// Subject identifies the caller, such as a service name or a user ID
+	Subject string
+	// Roles are the roles or groups of the caller, which policies grant permissions to
+	Roles []string
+	// Claims holds the claims of the caller's token, when authenticated by OIDC
+	Claims map[string]interface{}
+}
+
+// Authenticator identifies the caller of a request. It returns an error
+// wrapping ErrUnauthenticated when the request has no valid credentials.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// AuthenticatorFunc adapts a function to an Authenticator.
+type AuthenticatorFunc func(r *http.Request) (*Principal, error)
+
+// Authenticate implements Authenticator.
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (*Principal, error) {
+	return f(r)
+}
+
+// Authorizer decides whether a principal holds a permission on a workflow.
+type Authorizer interface {
+	Authorize(principal *Principal, permission Permission, workflowID string) bool
+}
+
+// AuthorizerFunc adapts a function to an Authorizer.
+type AuthorizerFunc func(principal *Principal, permission Permission, workflowID string) bool
+
+// Authorize implements Authorizer.
+func (f AuthorizerFunc) Authorize(principal *Principal, permission Permission, workflowID string) bool {
+	return f(principal, permission, workflowID)
+}
+
+// WithAuth makes the handler authenticate every request with authn and check
+// the permissions of its caller with authz. Requests without valid credentials
+// get 401 Unauthorized and operations the caller is not granted 403 Forbidden,
+// except on the runs and approvals of workflows the caller may not view, which
+// get 404 Not Found as if they did not exist.
+// Lists only hold the workflows, runs and approvals the caller may view.
+//
+// A nil authz grants every permission to authenticated callers. Without
+// WithAuth, the API is open to anyone who can reach it.
+func WithAuth(authn Authenticator, authz Authorizer) Option {
+	return func(h *Handler) {
+		h.authn = authn
+		h.authz = authz
+	}
+}
+
+// principalKey is the context key of the authenticated caller
+type principalKey struct{}
+
+// PrincipalFromContext returns the caller authenticated by the handler, for
+// instance in handlers mounted next to it behind the same authentication.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok
+}
+
+// authenticate identifies the caller of r and returns r carrying its
+// principal. It writes the error response and returns nil if authentication fails.
+func (h *Handler) authenticate(w http.ResponseWriter, r *http.Request) *http.Request {
+	if h.authn == nil {
+		return r
+	}
+	principal, err := h.authn.Authenticate(r)
+	if err != nil || principal == nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "unauthenticated")
+		return nil
+	}
+	return r.WithContext(context.WithValue(r.Context(), principalKey{}, principal))
+}
+
+// allowed reports whether the caller of r holds permission on workflowID.
+func (h *Handler) allowed(r *http.Request, permission Permission, workflowID string) bool {
+	if h.authn == nil || h.authz == nil {
+		return true
+	}
+	principal, _ := PrincipalFromContext(r.Context())
+	return h.authz.Authorize(principal, permission, workflowID)
+}
+
+// authorize checks that the caller of r holds permission on workflowID, and
+// writes a 403 response if not.
+func (h *Handler) authorize(w http.ResponseWriter, r *http.Request, permission Permission, workflowID string) bool {
+	if h.allowed(r, permission, workflowID) {
+		return true
+	}
+	writeError(w, http.StatusForbidden, "not allowed to %s workflow '%s'", permission, workflowID)
+	return false
+}
+
+// authorizeFound checks that the caller of r holds permission on workflowID,
+// the workflow of the resource of the given kind and ID that was looked up.
+// Callers who may not view the workflow get the 404 response of a missing
+// resource, so that they cannot probe which IDs exist, and other callers
+// without permission a 403 response.
+func (h *Handler) authorizeFound(w http.ResponseWriter, r *http.Request, permission Permission, workflowID, kind, id string) bool {
+	if !h.allowed(r, PermissionView, workflowID) {
+		writeError(w, http.StatusNotFound, "%s '%s' not found", kind, id)
+		return false
+	}
+	return h.authorize(w, r, permission, workflowID)
+}
+
+// bearerToken returns the token of the Authorization header of r, if any.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+// APIKeys authenticates requests carrying a known API key, as a bearer token
+// or in the X-API-Key header. It is safe for concurrent use.
+type APIKeys struct {
+	mu   sync.RWMutex
+	keys map[[sha256.Size]byte]Principal
+}
+
+// NewAPIKeys creates an authenticator without keys.
+func NewAPIKeys() *APIKeys {
+	return &APIKeys{keys: make(map[[sha256.Size]byte]Principal)}
+}
+
+// Add accepts key as the credentials of principal. Only a hash of the key is kept.
+func (k *APIKeys) Add(key string, principal Principal) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys[sha256.Sum256([]byte(key))] = principal
+}
+
+// Revoke stops accepting key.
+func (k *APIKeys) Revoke(key string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.keys, sha256.Sum256([]byte(key)))
+}
+
+// Authenticate implements Authenticator.
+func (k *APIKeys) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		key, _ = bearerToken(r)
+	}
+	if key == "" {
+		return nil, fmt.Errorf("no API key: %w", ErrUnauthenticated)
+	}
+
+	k.mu.RLock()
+	principal, ok := k.keys[sha256.Sum256([]byte(key))]
+	k.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown API key: %w", ErrUnauthenticated)
+	}
+	return &principal, nil
+}
+
+// OIDC authenticates requests carrying an ID token of an OpenID Connect
+// provider as a bearer token. The roles of the principal are read from the
+// "groups" claim unless set with WithRolesClaim.
+type OIDC struct {
+	verifier     *oidc.IDTokenVerifier
+	rolesClaim   string
+	subjectClaim string
+}
+
+// OIDCOption configures an OIDC authenticator.
+type OIDCOption func(*OIDC)
+
+// WithRolesClaim sets the claim holding the roles of the caller, either a
+// list of strings or a single string.
+func WithRolesClaim(claim string) OIDCOption {
+	return func(o *OIDC) {
+		o.rolesClaim = claim
+	}
+}
+
+// WithSubjectClaim sets the claim identifying the caller, such as "email".
+// The default is the "sub" claim.
+func WithSubjectClaim(claim string) OIDCOption {
+	return func(o *OIDC) {
+		o.subjectClaim = claim
+	}
+}
+
+// NewOIDC creates an authenticator accepting the ID tokens issued by the
+// provider at issuerURL for clientID. It discovers the provider's keys, so it
+// fails if the provider cannot be reached.
+func NewOIDC(ctx context.Context, issuerURL, clientID string, opts ...OIDCOption) (*OIDC, error) {
+	provider, err := oidc.NewProvider(ctx, issuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC provider '%s': %w", issuerURL, err)
+	}
+	return NewOIDCWithVerifier(provider.Verifier(&oidc.Config{ClientID: clientID}), opts...), nil
+}
+
+// NewOIDCWithVerifier creates an authenticator accepting the tokens verified
+// by verifier, for providers configured by hand.
+func NewOIDCWithVerifier(verifier *oidc.IDTokenVerifier, opts ...OIDCOption) *OIDC {
+	o := &OIDC{verifier: verifier, rolesClaim: "groups"}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Authenticate implements Authenticator.
+func (o *OIDC) Authenticate(r *http.Request) (*Principal, error) {
+	raw, ok := bearerToken(r)
+	if !ok {
+		return nil, fmt.Errorf("no bearer token: %w", ErrUnauthenticated)
+	}
+	token, err := o.verifier.Verify(r.Context(), raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnauthenticated, err)
+	}
+	var claims map[string]interface{}
+	if err := token.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnauthenticated, err)
+	}
+
+	principal := &Principal{Subject: token.Subject, Claims: claims}
+	if o.subjectClaim != "" {
+		principal.Subject, _ = claims[o.subjectClaim].(string)
+	}
+	switch roles := claims[o.rolesClaim].(type) {
+	case string:
+		principal.Roles = []string{roles}
+	case []interface{}:
+		for _, role := range roles {
+			if role, ok := role.(string); ok {
+				principal.Roles = append(principal.Roles, role)
+			}
+		}
+	}
+	return principal, nil
+}
+
+// Authenticators combines authenticators, such as API keys for services and
+// OIDC for people. The first one to identify the caller wins.
+func Authenticators(authenticators ...Authenticator) Authenticator {
+	return AuthenticatorFunc(func(r *http.Request) (*Principal, error) {
+		for _, authn := range authenticators {
+			if principal, err := authn.Authenticate(r); err == nil && principal != nil {
+				return principal, nil
+			}
+		}
+		return nil, ErrUnauthenticated
+	})
+}
+
+// Policy is an Authorizer granting permissions on workflows to roles. It is
+// safe for concurrent use.
+type Policy struct {
+	mu     sync.RWMutex
+	grants map[string]map[string]map[Permission]bool
+}
+
+// NewPolicy creates a policy granting nothing.
+func NewPolicy() *Policy {
+	return &Policy{grants: make(map[string]map[string]map[Permission]bool)}
+}
+
+// Allow grants permissions on workflowID to the callers holding role, or to
+// every caller when role is "*". The workflow ID "*" stands for every
+// workflow. It returns the policy so that grants can be chained.
+func (p *Policy) Allow(role, workflowID string, permissions ...Permission) *Policy {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	workflows, ok := p.grants[role]
+	if !ok {
+		workflows = make(map[string]map[Permission]bool)
+		p.grants[role] = workflows
+	}
+	granted, ok := workflows[workflowID]
+	if !ok {
+		granted = make(map[Permission]bool)
+		workflows[workflowID] = granted
+	}
+	for _, permission := range permissions {
+		granted[permission] = true
+	}
+	return p
+}
+
+// Authorize implements Authorizer.
+func (p *Policy) Authorize(principal *Principal, permission Permission, workflowID string) bool {
+	if principal == nil {
+		return false
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, role := range append([]string{"*"}, principal.Roles...) {
+		workflows := p.grants[role]
+		if workflows[workflowID][permission] || workflows["*"][permission] {
+			return true
+		}
+	}
+	return false
+}
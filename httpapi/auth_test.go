@@ -0,0 +1,253 @@
+package httpapi
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/davidroman0O/gostage"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// request sends a request to the server with the given API key, if any.
+func request(t *testing.T, method, url, key, body string) *http.Response {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	return resp
+}
+
+// status sends a request and returns the status code of its response.
+func status(t *testing.T, method, url, key, body string) int {
+	resp := request(t, method, url, key, body)
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func newAuthTestServer(t *testing.T) *httptest.Server {
+	keys := NewAPIKeys()
+	keys.Add("viewer-key", Principal{Subject: "dashboard", Roles: []string{"viewer"}})
+	keys.Add("ops-key", Principal{Subject: "alice", Roles: []string{"ops"}})
+	keys.Add("revoked-key", Principal{Subject: "mallory", Roles: []string{"ops"}})
+	keys.Revoke("revoked-key")
+
+	policy := NewPolicy().
+		Allow("viewer", "greet", PermissionView).
+		Allow("ops", "*", PermissionView, PermissionViewLogs, PermissionTrigger, PermissionCancel)
+
+	h := newTestHandler(t, WithAuth(keys, policy))
+	require.NoError(t, h.Register("internal", func() (*gostage.Workflow, error) {
+		wf := gostage.NewWorkflow("internal", "Internal", "")
+		stage := gostage.NewStage("s", "S", "")
+		stage.AddAction(&funcAction{BaseAction: gostage.NewBaseAction("noop", ""), fn: func(*gostage.ActionContext) error { return nil }})
+		wf.AddStage(stage)
+		return wf, nil
+	}))
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestAuthRequiresCredentials(t *testing.T) {
+	server := newAuthTestServer(t)
+
+	resp := request(t, http.MethodGet, server.URL+"/workflows", "", "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, "Bearer", resp.Header.Get("WWW-Authenticate"))
+
+	assert.Equal(t, http.StatusUnauthorized, status(t, http.MethodGet, server.URL+"/workflows", "wrong-key", ""))
+	assert.Equal(t, http.StatusUnauthorized, status(t, http.MethodGet, server.URL+"/workflows", "revoked-key", ""))
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/workflows", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-API-Key", "viewer-key")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestAuthPerWorkflowPermissions(t *testing.T) {
+	server := newAuthTestServer(t)
+
+	// The viewer only sees the workflow it is granted
+	workflows := decode[[]WorkflowInfo](t, request(t, http.MethodGet, server.URL+"/workflows", "viewer-key", ""))
+	require.Len(t, workflows, 1)
+	assert.Equal(t, "greet", workflows[0].ID)
+	workflows = decode[[]WorkflowInfo](t, request(t, http.MethodGet, server.URL+"/workflows", "ops-key", ""))
+	assert.Len(t, workflows, 2)
+
+	assert.Equal(t, http.StatusForbidden, status(t, http.MethodPost, server.URL+"/workflows/greet/runs", "viewer-key", `{"params":{"name":"ada"}}`))
+
+	// Workflows are authorized before they are looked up, so that existing and
+	// unknown workflows cannot be told apart
+	assert.Equal(t, http.StatusForbidden, status(t, http.MethodGet, server.URL+"/workflows/internal", "viewer-key", ""))
+	assert.Equal(t, http.StatusForbidden, status(t, http.MethodGet, server.URL+"/workflows/unknown", "viewer-key", ""))
+	assert.Equal(t, http.StatusForbidden, status(t, http.MethodPost, server.URL+"/workflows/internal/runs", "viewer-key", ""))
+	assert.Equal(t, http.StatusForbidden, status(t, http.MethodPost, server.URL+"/workflows/unknown/runs", "viewer-key", ""))
+	assert.Equal(t, http.StatusNotFound, status(t, http.MethodGet, server.URL+"/workflows/unknown", "ops-key", ""))
+
+	resp := request(t, http.MethodPost, server.URL+"/workflows/greet/runs", "ops-key", `{"params":{"name":"ada"},"labels":{"team":"growth","triggeredBy":"bob"}}`)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	started := decode[RunInfo](t, resp)
+	assert.Equal(t, "alice", started.TriggeredBy)
+	assert.Equal(t, map[string]string{"team": "growth", "triggeredBy": "alice"}, started.Labels)
+	resp = request(t, http.MethodPost, server.URL+"/workflows/internal/runs", "ops-key", "")
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	internal := decode[RunInfo](t, resp)
+
+	assert.Equal(t, http.StatusOK, status(t, http.MethodGet, server.URL+"/runs/"+started.ID, "viewer-key", ""))
+	// Runs of workflows the caller may not view look missing
+	assert.Equal(t, http.StatusNotFound, status(t, http.MethodGet, server.URL+"/runs/"+internal.ID, "viewer-key", ""))
+	assert.Equal(t, http.StatusNotFound, status(t, http.MethodGet, server.URL+"/runs/unknown", "viewer-key", ""))
+	assert.Equal(t, http.StatusNotFound, status(t, http.MethodPost, server.URL+"/runs/"+internal.ID+"/cancel", "viewer-key", ""))
+	assert.Equal(t, http.StatusNotFound, status(t, http.MethodGet, server.URL+"/runs/"+internal.ID+"/events", "viewer-key", ""))
+	assert.Equal(t, http.StatusForbidden, status(t, http.MethodGet, server.URL+"/runs/"+started.ID+"/events", "viewer-key", ""))
+	assert.Equal(t, http.StatusForbidden, status(t, http.MethodPost, server.URL+"/runs/"+started.ID+"/cancel", "viewer-key", ""))
+	assert.Equal(t, http.StatusOK, status(t, http.MethodGet, server.URL+"/runs/"+started.ID+"/events", "ops-key", ""))
+
+	runs := decode[[]RunInfo](t, request(t, http.MethodGet, server.URL+"/runs", "viewer-key", ""))
+	require.Len(t, runs, 1)
+	assert.Equal(t, started.ID, runs[0].ID)
+}
+
+func TestAuthApprovals(t *testing.T) {
+	gate := gostage.NewApprovalGate()
+	decided := make(chan gostage.ApprovalDecision, 1)
+	keys := NewAPIKeys()
+	keys.Add("release-key", Principal{Subject: "bob", Roles: []string{"release"}})
+	keys.Add("dev-key", Principal{Subject: "carol", Roles: []string{"dev"}})
+	policy := NewPolicy().
+		Allow("*", "release", PermissionView, PermissionTrigger).
+		Allow("release", "release", PermissionApprove)
+
+	h := New(WithApprovals(gate), WithAuth(keys, policy))
+	require.NoError(t, h.Register("release", func() (*gostage.Workflow, error) {
+		wf := gostage.NewWorkflow("release", "Release", "")
+		stage := gostage.NewStage("gate", "Gate", "")
+		stage.AddAction(gostage.ApprovalAction("sign-off", gate, gostage.OnApprovalRejected(func(_ *gostage.ActionContext, decision gostage.ApprovalDecision) error {
+			decided <- decision
+			return nil
+		})))
+		wf.AddStage(stage)
+		return wf, nil
+	}))
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	resp := request(t, http.MethodPost, server.URL+"/workflows/release/runs", "dev-key", "")
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	run := decode[RunInfo](t, resp)
+	require.Eventually(t, func() bool {
+		return len(decode[[]gostage.ApprovalRequest](t, request(t, http.MethodGet, server.URL+"/approvals", "dev-key", ""))) == 1
+	}, 5*time.Second, 5*time.Millisecond)
+
+	assert.Equal(t, http.StatusForbidden, status(t, http.MethodPost, server.URL+"/approvals/release/sign-off", "dev-key", `{"approved": true}`))
+
+	// The decision is made by the caller, whoever it claims to decide for
+	assert.Equal(t, http.StatusNoContent, status(t, http.MethodPost, server.URL+"/approvals/release/sign-off", "release-key", `{"approved": false, "approver": "alice"}`))
+	assert.Equal(t, "bob", (<-decided).Approver)
+
+	require.Eventually(t, func() bool {
+		return decode[RunInfo](t, request(t, http.MethodGet, server.URL+"/runs/"+run.ID, "dev-key", "")).Status == gostage.StatusCompleted
+	}, 5*time.Second, 5*time.Millisecond)
+}
+
+func TestCancelRun(t *testing.T) {
+	h := New()
+	require.NoError(t, h.Register("wait", func() (*gostage.Workflow, error) {
+		wf := gostage.NewWorkflow("wait", "Wait", "")
+		stage := gostage.NewStage("s", "S", "")
+		stage.AddAction(&funcAction{BaseAction: gostage.NewBaseAction("sleep", ""), fn: func(ctx *gostage.ActionContext) error {
+			return ctx.Sleep(time.Minute)
+		}})
+		wf.AddStage(stage)
+		return wf, nil
+	}))
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/workflows/wait/runs", "application/json", nil)
+	require.NoError(t, err)
+	started := decode[RunInfo](t, resp)
+
+	assert.Equal(t, http.StatusNotFound, status(t, http.MethodPost, server.URL+"/runs/unknown/cancel", "", ""))
+	assert.Equal(t, http.StatusAccepted, status(t, http.MethodPost, server.URL+"/runs/"+started.ID+"/cancel", "", ""))
+
+	info := waitForRun(t, server, started.ID)
+	assert.Equal(t, gostage.StatusCancelled, info.Status)
+	assert.Equal(t, http.StatusConflict, status(t, http.MethodPost, server.URL+"/runs/"+started.ID+"/cancel", "", ""))
+}
+
+func TestOIDCAuthenticator(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key}, nil)
+	require.NoError(t, err)
+
+	const issuer = "https://id.example.com"
+	verifier := oidc.NewVerifier(issuer, &oidc.StaticKeySet{PublicKeys: []crypto.PublicKey{&key.PublicKey}}, &oidc.Config{ClientID: "gostage"})
+	authn := NewOIDCWithVerifier(verifier, WithSubjectClaim("email"))
+
+	token := func(audience string, expiry time.Time) string {
+		raw, err := jwt.Signed(signer).Claims(jwt.Claims{
+			Issuer:   issuer,
+			Subject:  "u-42",
+			Audience: jwt.Audience{audience},
+			Expiry:   jwt.NewNumericDate(expiry),
+		}).Claims(map[string]interface{}{
+			"email":  "dana@example.com",
+			"groups": []string{"ops", "dev"},
+		}).Serialize()
+		require.NoError(t, err)
+		return raw
+	}
+	authenticate := func(raw string) (*Principal, error) {
+		req := httptest.NewRequest(http.MethodGet, "/workflows", nil)
+		req.Header.Set("Authorization", "Bearer "+raw)
+		return authn.Authenticate(req)
+	}
+
+	principal, err := authenticate(token("gostage", time.Now().Add(time.Hour)))
+	require.NoError(t, err)
+	assert.Equal(t, "dana@example.com", principal.Subject)
+	assert.Equal(t, []string{"ops", "dev"}, principal.Roles)
+	assert.Equal(t, "u-42", principal.Claims["sub"])
+
+	_, err = authenticate(token("another-client", time.Now().Add(time.Hour)))
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+	_, err = authenticate(token("gostage", time.Now().Add(-time.Hour)))
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+	_, err = authenticate("not-a-token")
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+
+	// API keys and OIDC tokens are both accepted once combined
+	keys := NewAPIKeys()
+	keys.Add("ci-key", Principal{Subject: "ci"})
+	combined := Authenticators(keys, authn)
+	req := httptest.NewRequest(http.MethodGet, "/workflows", nil)
+	req.Header.Set("Authorization", "Bearer ci-key")
+	principal, err = combined.Authenticate(req)
+	require.NoError(t, err)
+	assert.Equal(t, "ci", principal.Subject)
+	req.Header.Set("Authorization", "Bearer "+token("gostage", time.Now().Add(time.Hour)))
+	principal, err = combined.Authenticate(req)
+	require.NoError(t, err)
+	assert.Equal(t, "dana@example.com", principal.Subject)
+}
@@ -0,0 +1,35 @@
+// Package httpapi provides an embeddable HTTP management API for gostage.
+//
+// A Handler exposes registered workflows over REST so they can be triggered
+// and monitored from dashboards or other services:
+//
+//	GET  /workflows              list registered workflows and their parameters
+//	GET  /workflows/{id}         describe a workflow, its stages, actions and store keys
+//	POST /workflows/{id}/runs    start a run, with {"params": {...}, "labels": {...}} as the body
+//	GET  /runs                   list runs, optionally filtered by ?workflow=
+//	GET  /runs/{id}              get the status of a run, or of a past run by its RunID with WithHistory
+//	GET  /runs/{id}/events       stream run progress as server-sent events
+//	POST /runs/{id}/cancel       cancel a run in progress
+//	GET  /approvals              list pending approvals, with WithApprovals
+//	POST /approvals/{id}         approve or reject, with {"approved": true}
+//	GET  /history                list past runs, with WithHistory
+//	GET  /history/{id}           get a past run, with WithHistory
+//
+// Workflows are registered as factories because a workflow instance holds the
+// state of a single execution; every run gets a fresh instance. The handler can
+// be mounted under any prefix with http.StripPrefix:
+//
+//	api := httpapi.New()
+//	api.Register("deploy", newDeployWorkflow)
+//	http.Handle("/gostage/", http.StripPrefix("/gostage", api))
+//
+// WithAuth puts the API behind authentication, with API keys, OIDC tokens or
+// any Authenticator, and grants callers permissions per workflow:
+//
+//	keys := httpapi.NewAPIKeys()
+//	keys.Add(os.Getenv("CI_API_KEY"), httpapi.Principal{Subject: "ci", Roles: []string{"deployer"}})
+//	policy := httpapi.NewPolicy().
+//		Allow("deployer", "deploy", httpapi.PermissionView, httpapi.PermissionTrigger).
+//		Allow("oncall", "*", httpapi.PermissionView, httpapi.PermissionViewLogs, httpapi.PermissionCancel)
+//	api := httpapi.New(httpapi.WithAuth(keys, policy))
+package httpapi
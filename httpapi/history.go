@@ -0,0 +1,91 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/davidroman0O/gostage/history"
+)
+
+// WithHistory exposes the runs saved in store, usually the store the runner
+// was given with gostage.WithHistory:
+//
+//	GET /history        list runs, filtered by ?workflow=, ?status= and ?since= (RFC 3339)
+//	GET /history/{id}   get a run by the ID of its RunResult
+func WithHistory(store history.Store) Option {
+	return func(h *Handler) {
+		h.history = store
+	}
+}
+
+func (h *Handler) listHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var since time.Time
+	if value := query.Get("since"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid since '%s': %v", value, err)
+			return
+		}
+		since = parsed
+	}
+
+	runs, err := h.history.ListRuns(query.Get("workflow"), query.Get("status"), since)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	visible := runs[:0]
+	for _, run := range runs {
+		if h.allowed(r, PermissionView, run.WorkflowID) {
+			visible = append(visible, run)
+		}
+	}
+	writeJSON(w, http.StatusOK, visible)
+}
+
+func (h *Handler) getHistoryRun(w http.ResponseWriter, r *http.Request) {
+	run, err := h.history.GetRun(r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, history.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "run '%s' not found", r.PathValue("id"))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	if !h.authorizeFound(w, r, PermissionView, run.WorkflowID, "run", r.PathValue("id")) {
+		return
+	}
+	writeJSON(w, http.StatusOK, run)
+}
+
+// historyRun returns the information of the run saved in the history store
+// under runID, for runs the handler no longer keeps. It writes the error
+// response and returns false if the run cannot be found.
+func (h *Handler) historyRun(w http.ResponseWriter, runID string) (RunInfo, bool) {
+	run, err := h.history.GetRun(runID)
+	if err != nil {
+		if errors.Is(err, history.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "run '%s' not found", runID)
+			return RunInfo{}, false
+		}
+		writeError(w, http.StatusInternalServerError, "%v", err)
+		return RunInfo{}, false
+	}
+	finished := run.FinishedAt
+	return RunInfo{
+		ID:             run.ID,
+		WorkflowID:     run.WorkflowID,
+		RunID:          run.ID,
+		Status:         run.Status,
+		Labels:         run.Labels,
+		Error:          run.Error,
+		StartedAt:      run.StartedAt,
+		FinishedAt:     &finished,
+		StageStatuses:  run.StageStatuses,
+		ActionStatuses: run.ActionStatuses,
+	}, true
+}
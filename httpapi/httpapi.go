@@ -0,0 +1,231 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/davidroman0O/gostage/history"
+)
+
+// WorkflowFactory creates a fresh workflow instance for a run.
+type WorkflowFactory func() (*gostage.Workflow, error)
+
+// WorkflowInfo describes a registered workflow.
+type WorkflowInfo struct {
+	ID          string      `json:"id"`
+	Name        string      `json:"name,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Version     string      `json:"version,omitempty"`
+	Tags        []string    `json:"tags,omitempty"`
+	Params      []ParamInfo `json:"params,omitempty"`
+}
+
+// ParamInfo describes a parameter accepted by a registered workflow.
+type ParamInfo struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Required    bool        `json:"required,omitempty"`
+	Default     interface{} `json:"default,omitempty"`
+}
+
+// Handler serves the management API. It is safe for concurrent use.
+type Handler struct {
+	runner *gostage.Runner
+	logger gostage.Logger
+	mux    *http.ServeMux
+
+	mu        sync.RWMutex
+	factories map[string]WorkflowFactory
+	workflows map[string]WorkflowInfo
+	// descriptions holds the description of each registered workflow
+	descriptions map[string]gostage.WorkflowDescription
+	runs         map[string]*run
+	runOrder     []string
+	nextRun      int
+	// maxRuns and runTTL bound the finished runs kept, see WithRunRetention
+	maxRuns int
+	runTTL  time.Duration
+
+	approvals *gostage.ApprovalGate
+	history   history.Store
+
+	authn Authenticator
+	authz Authorizer
+}
+
+// Option configures a Handler.
+type Option func(*Handler)
+
+// WithRunner sets the runner used to execute workflows.
+func WithRunner(runner *gostage.Runner) Option {
+	return func(h *Handler) {
+		h.runner = runner
+	}
+}
+
+// WithLogger sets the logger passed to workflow executions.
+func WithLogger(logger gostage.Logger) Option {
+	return func(h *Handler) {
+		h.logger = logger
+	}
+}
+
+// New creates a Handler with the given options.
+func New(opts ...Option) *Handler {
+	h := &Handler{
+		runner:       gostage.NewRunner(),
+		logger:       gostage.NewDefaultLogger(),
+		mux:          http.NewServeMux(),
+		factories:    make(map[string]WorkflowFactory),
+		workflows:    make(map[string]WorkflowInfo),
+		descriptions: make(map[string]gostage.WorkflowDescription),
+		runs:         make(map[string]*run),
+		maxRuns:      defaultMaxRuns,
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	h.mux.HandleFunc("GET /workflows", h.listWorkflows)
+	h.mux.HandleFunc("GET /workflows/{id}", h.describeWorkflow)
+	h.mux.HandleFunc("POST /workflows/{id}/runs", h.startRun)
+	h.mux.HandleFunc("GET /runs", h.listRuns)
+	h.mux.HandleFunc("GET /runs/{id}", h.getRun)
+	h.mux.HandleFunc("GET /runs/{id}/events", h.streamEvents)
+	h.mux.HandleFunc("POST /runs/{id}/cancel", h.cancelRun)
+	if h.approvals != nil {
+		h.mux.HandleFunc("GET /approvals", h.listApprovals)
+		h.mux.HandleFunc("POST /approvals/{id...}", h.decideApproval)
+	}
+	if h.history != nil {
+		h.mux.HandleFunc("GET /history", h.listHistory)
+		h.mux.HandleFunc("GET /history/{id}", h.getHistoryRun)
+	}
+
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r = h.authenticate(w, r); r == nil {
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+// Register makes a workflow available under the given ID.
+// The factory is called once to describe the workflow and again for every run.
+func (h *Handler) Register(id string, factory WorkflowFactory) error {
+	if id == "" {
+		return fmt.Errorf("workflow id cannot be empty")
+	}
+
+	wf, err := factory()
+	if err != nil {
+		return fmt.Errorf("failed to create workflow '%s': %w", id, err)
+	}
+
+	info := WorkflowInfo{
+		ID:          id,
+		Name:        wf.Name,
+		Description: wf.Description,
+		Version:     wf.Version,
+		Tags:        wf.Tags,
+	}
+	for _, p := range wf.Params() {
+		param := ParamInfo{Name: p.Name, Description: p.Description, Required: p.Required}
+		if p.HasDefault {
+			param.Default = p.Default
+		}
+		info.Params = append(info.Params, param)
+	}
+	description := wf.Describe()
+	description.ID = id
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, exists := h.factories[id]; exists {
+		return fmt.Errorf("workflow '%s' is already registered", id)
+	}
+	h.factories[id] = factory
+	h.workflows[id] = info
+	h.descriptions[id] = description
+	return nil
+}
+
+// RegisterDef makes a serialized workflow definition available under its ID.
+// Actions are resolved through the given registry, or the default registry if nil.
+func (h *Handler) RegisterDef(def *gostage.SubWorkflowDef, registry *gostage.ActionRegistry) error {
+	return h.Register(def.ID, func() (*gostage.Workflow, error) {
+		return gostage.NewWorkflowFromDefWithRegistry(def, registry)
+	})
+}
+
+// RegisterWorkflows makes every workflow of a gostage.WorkflowRegistry
+// available under its registered name. Runs supply the workflow parameters.
+func (h *Handler) RegisterWorkflows(registry *gostage.WorkflowRegistry) error {
+	for _, name := range registry.Names() {
+		builder, ok := registry.Builder(name)
+		if !ok {
+			continue
+		}
+		if err := h.Register(name, WorkflowFactory(builder)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *Handler) listWorkflows(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	workflows := make([]WorkflowInfo, 0, len(h.workflows))
+	for _, info := range h.workflows {
+		if h.allowed(r, PermissionView, info.ID) {
+			workflows = append(workflows, info)
+		}
+	}
+	h.mu.RUnlock()
+
+	sort.Slice(workflows, func(i, j int) bool {
+		return workflows[i].ID < workflows[j].ID
+	})
+	writeJSON(w, http.StatusOK, workflows)
+}
+
+// describeWorkflow returns the description of a registered workflow, with its
+// stages, its actions and the store keys they use.
+func (h *Handler) describeWorkflow(w http.ResponseWriter, r *http.Request) {
+	// Authorize before the lookup, so that callers cannot probe which workflows exist
+	if !h.authorize(w, r, PermissionView, r.PathValue("id")) {
+		return
+	}
+
+	h.mu.RLock()
+	description, ok := h.descriptions[r.PathValue("id")]
+	h.mu.RUnlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "workflow '%s' not found", r.PathValue("id"))
+		return
+	}
+	writeJSON(w, http.StatusOK, description)
+}
+
+// writeJSON writes value as a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeError writes an error response in the API's JSON error format.
+func writeError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	writeJSON(w, status, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
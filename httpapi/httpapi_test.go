@@ -0,0 +1,362 @@
+package httpapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/davidroman0O/gostage/history"
+	"github.com/davidroman0O/gostage/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type funcAction struct {
+	gostage.BaseAction
+	fn func(ctx *gostage.ActionContext) error
+}
+
+func (a *funcAction) Execute(ctx *gostage.ActionContext) error {
+	return a.fn(ctx)
+}
+
+func newTestHandler(t *testing.T, opts ...Option) *Handler {
+	h := New(opts...)
+	require.NoError(t, h.Register("greet", func() (*gostage.Workflow, error) {
+		wf := gostage.NewWorkflow("greet", "Greet", "says hello")
+		wf.Version = "1"
+		wf.AddParam("name", gostage.Required, gostage.Describe("who to greet"))
+		stage := gostage.NewStage("hello", "Hello", "")
+		stage.AddAction(&funcAction{
+			BaseAction: gostage.NewBaseAction("say", ""),
+			fn: func(ctx *gostage.ActionContext) error {
+				name, err := store.Get[string](ctx.Store(), "name")
+				if err != nil {
+					return err
+				}
+				if name == "fail" {
+					return errors.New("refusing to greet")
+				}
+				return nil
+			},
+		})
+		wf.AddStage(stage)
+		return wf, nil
+	}))
+	return h
+}
+
+func decode[T any](t *testing.T, resp *http.Response) T {
+	defer resp.Body.Close()
+	var value T
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&value))
+	return value
+}
+
+func waitForRun(t *testing.T, server *httptest.Server, id string) RunInfo {
+	var info RunInfo
+	require.Eventually(t, func() bool {
+		resp, err := http.Get(server.URL + "/runs/" + id)
+		require.NoError(t, err)
+		info = decode[RunInfo](t, resp)
+		return info.FinishedAt != nil
+	}, 2*time.Second, 10*time.Millisecond)
+	return info
+}
+
+func TestListWorkflows(t *testing.T) {
+	server := httptest.NewServer(newTestHandler(t))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/workflows")
+	require.NoError(t, err)
+	workflows := decode[[]WorkflowInfo](t, resp)
+
+	require.Len(t, workflows, 1)
+	assert.Equal(t, "greet", workflows[0].ID)
+	assert.Equal(t, "1", workflows[0].Version)
+	assert.Equal(t, []ParamInfo{{Name: "name", Description: "who to greet", Required: true}}, workflows[0].Params)
+}
+
+func TestDescribeWorkflow(t *testing.T) {
+	server := httptest.NewServer(newTestHandler(t))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/workflows/greet")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	description := decode[gostage.WorkflowDescription](t, resp)
+	assert.Equal(t, "greet", description.ID)
+	assert.Equal(t, []gostage.ParamDescription{{Name: "name", Description: "who to greet", Required: true}}, description.Params)
+	require.Len(t, description.Stages, 1)
+	assert.Equal(t, "say", description.Stages[0].Actions[0].Name)
+
+	resp, err = http.Get(server.URL + "/workflows/unknown")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestStartRun(t *testing.T) {
+	server := httptest.NewServer(newTestHandler(t))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/workflows/greet/runs", "application/json", strings.NewReader(`{"params":{"name":"ada"}}`))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	started := decode[RunInfo](t, resp)
+	assert.Equal(t, "greet", started.WorkflowID)
+
+	info := waitForRun(t, server, started.ID)
+	assert.Equal(t, gostage.StatusCompleted, info.Status)
+	assert.Equal(t, gostage.StatusCompleted, info.StageStatuses["hello"])
+	assert.Equal(t, gostage.StatusCompleted, info.ActionStatuses[gostage.ActionStatusKey("hello", "say")])
+
+	resp, err = http.Post(server.URL+"/workflows/greet/runs", "application/json", strings.NewReader(`{"params":{"name":"fail"}}`))
+	require.NoError(t, err)
+	failed := waitForRun(t, server, decode[RunInfo](t, resp).ID)
+	assert.Equal(t, gostage.StatusFailed, failed.Status)
+	assert.Contains(t, failed.Error, "refusing to greet")
+
+	resp, err = http.Get(server.URL + "/runs?workflow=greet")
+	require.NoError(t, err)
+	history := decode[[]RunInfo](t, resp)
+	require.Len(t, history, 2)
+	assert.Equal(t, started.ID, history[0].ID)
+}
+
+func TestStartRunErrors(t *testing.T) {
+	server := httptest.NewServer(newTestHandler(t))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/workflows/missing/runs", "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = http.Post(server.URL+"/workflows/greet/runs", "application/json", nil)
+	require.NoError(t, err)
+	body := decode[map[string]string](t, resp)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, body["error"], "missing required parameters")
+
+	resp, err = http.Get(server.URL + "/runs/run-404")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestStreamEvents(t *testing.T) {
+	server := httptest.NewServer(newTestHandler(t))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/workflows/greet/runs", "application/json", strings.NewReader(`{"params":{"name":"ada"}}`))
+	require.NoError(t, err)
+	started := decode[RunInfo](t, resp)
+
+	stream, err := http.Get(server.URL + "/runs/" + started.ID + "/events")
+	require.NoError(t, err)
+	defer stream.Body.Close()
+	assert.Equal(t, "text/event-stream", stream.Header.Get("Content-Type"))
+
+	var events []Event
+	scanner := bufio.NewScanner(stream.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			var event Event
+			require.NoError(t, json.Unmarshal([]byte(data), &event))
+			events = append(events, event)
+		}
+	}
+
+	require.Len(t, events, 3)
+	assert.Equal(t, Event{Type: EventStage, StageID: "hello", Status: gostage.StatusRunning}, withoutTime(events[0]))
+	assert.Equal(t, Event{Type: EventStage, StageID: "hello", Status: gostage.StatusCompleted}, withoutTime(events[1]))
+	assert.Equal(t, Event{Type: EventRun, Status: gostage.StatusCompleted}, withoutTime(events[2]))
+}
+
+func withoutTime(event Event) Event {
+	event.Time = time.Time{}
+	return event
+}
+
+func TestApprovalEndpoints(t *testing.T) {
+	gate := gostage.NewApprovalGate()
+	h := New(WithApprovals(gate))
+	require.NoError(t, h.Register("release", func() (*gostage.Workflow, error) {
+		wf := gostage.NewWorkflow("release", "Release", "")
+		stage := gostage.NewStage("gate", "Gate", "")
+		stage.AddAction(gostage.ApprovalAction("sign-off", gate, gostage.WithApprovalMessage("Ship it?")))
+		wf.AddStage(stage)
+		return wf, nil
+	}))
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/workflows/release/runs", "application/json", nil)
+	require.NoError(t, err)
+	run := decode[RunInfo](t, resp)
+
+	var pending []gostage.ApprovalRequest
+	require.Eventually(t, func() bool {
+		resp, err := http.Get(server.URL + "/approvals")
+		if err != nil {
+			return false
+		}
+		pending = decode[[]gostage.ApprovalRequest](t, resp)
+		return len(pending) == 1
+	}, 5*time.Second, 5*time.Millisecond)
+	assert.Equal(t, "release/sign-off", pending[0].ID)
+	assert.Equal(t, "Ship it?", pending[0].Message)
+
+	resp, err = http.Post(server.URL+"/approvals/unknown", "application/json", strings.NewReader(`{"approved": true}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = http.Post(server.URL+"/approvals/"+pending[0].ID, "application/json", strings.NewReader(`{"approved": true, "approver": "alice"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	require.Eventually(t, func() bool {
+		resp, err := http.Get(server.URL + "/runs/" + run.ID)
+		if err != nil {
+			return false
+		}
+		return decode[RunInfo](t, resp).Status == gostage.StatusCompleted
+	}, 5*time.Second, 5*time.Millisecond)
+}
+
+func TestHistoryEndpoints(t *testing.T) {
+	runs := history.NewMemoryStore()
+	runner := gostage.NewRunner(gostage.WithHistory(runs))
+	server := httptest.NewServer(newTestHandler(t, WithRunner(runner), WithHistory(runs)))
+	defer server.Close()
+
+	var infos []RunInfo
+	for _, name := range []string{"bob", "fail"} {
+		resp, err := http.Post(server.URL+"/workflows/greet/runs", "application/json", strings.NewReader(`{"params": {"name": "`+name+`"}}`))
+		require.NoError(t, err)
+		infos = append(infos, waitForRun(t, server, decode[RunInfo](t, resp).ID))
+	}
+	require.NotEmpty(t, infos[0].RunID)
+
+	resp, err := http.Get(server.URL + "/history/" + infos[0].RunID)
+	require.NoError(t, err)
+	run := decode[history.Run](t, resp)
+	assert.Equal(t, "greet", run.WorkflowID)
+	assert.Equal(t, history.StatusCompleted, run.Status)
+
+	resp, err = http.Get(server.URL + "/history?workflow=greet&status=failed&since=" + time.Now().Add(-time.Hour).Format(time.RFC3339))
+	require.NoError(t, err)
+	failed := decode[[]history.Run](t, resp)
+	require.Len(t, failed, 1)
+	assert.Equal(t, infos[1].RunID, failed[0].ID)
+	assert.Contains(t, failed[0].Error, "refusing to greet")
+
+	resp, err = http.Get(server.URL + "/history/unknown")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + "/history?since=yesterday")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestRegisterWorkflows(t *testing.T) {
+	registry := gostage.NewWorkflowRegistry()
+	require.NoError(t, registry.Register("nightly-cleanup", func() (*gostage.Workflow, error) {
+		wf := gostage.NewWorkflow("cleanup", "Cleanup", "")
+		wf.AddParam("days", gostage.Default(7))
+		stage := gostage.NewStage("purge", "Purge", "")
+		stage.AddAction(&funcAction{
+			BaseAction: gostage.NewBaseAction("delete", ""),
+			fn:         func(*gostage.ActionContext) error { return nil },
+		})
+		wf.AddStage(stage)
+		return wf, nil
+	}))
+
+	h := New()
+	require.NoError(t, h.RegisterWorkflows(registry))
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/workflows")
+	require.NoError(t, err)
+	workflows := decode[[]WorkflowInfo](t, resp)
+	require.Len(t, workflows, 1)
+	assert.Equal(t, "nightly-cleanup", workflows[0].ID)
+	assert.Equal(t, []ParamInfo{{Name: "days", Default: float64(7)}}, workflows[0].Params)
+
+	resp, err = http.Post(server.URL+"/workflows/nightly-cleanup/runs", "application/json", strings.NewReader(`{"params":{"days":30}}`))
+	require.NoError(t, err)
+	info := waitForRun(t, server, decode[RunInfo](t, resp).ID)
+	assert.Equal(t, gostage.StatusCompleted, info.Status)
+}
+
+func TestRunRetention(t *testing.T) {
+	runs := history.NewMemoryStore()
+	runner := gostage.NewRunner(gostage.WithHistory(runs))
+	server := httptest.NewServer(newTestHandler(t, WithRunner(runner), WithHistory(runs), WithRunRetention(2, 0)))
+	defer server.Close()
+
+	var infos []RunInfo
+	for _, name := range []string{"alice", "bob", "carol"} {
+		resp, err := http.Post(server.URL+"/workflows/greet/runs", "application/json", strings.NewReader(`{"params": {"name": "`+name+`"}}`))
+		require.NoError(t, err)
+		infos = append(infos, waitForRun(t, server, decode[RunInfo](t, resp).ID))
+	}
+
+	// Only the two most recent finished runs are kept
+	resp, err := http.Get(server.URL + "/runs")
+	require.NoError(t, err)
+	listed := decode[[]RunInfo](t, resp)
+	require.Len(t, listed, 2)
+	assert.Equal(t, infos[1].ID, listed[0].ID)
+	assert.Equal(t, infos[2].ID, listed[1].ID)
+
+	resp, err = http.Get(server.URL + "/runs/" + infos[0].ID)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// The dropped run is served from the history store by its RunID
+	resp, err = http.Get(server.URL + "/runs/" + infos[0].RunID)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	old := decode[RunInfo](t, resp)
+	assert.Equal(t, infos[0].RunID, old.RunID)
+	assert.Equal(t, "greet", old.WorkflowID)
+	assert.Equal(t, gostage.StatusCompleted, old.Status)
+	assert.NotNil(t, old.FinishedAt)
+}
+
+func TestRunRetentionTTL(t *testing.T) {
+	server := httptest.NewServer(newTestHandler(t, WithRunRetention(0, time.Millisecond)))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/workflows/greet/runs", "application/json", strings.NewReader(`{"params": {"name": "bob"}}`))
+	require.NoError(t, err)
+	first := decode[RunInfo](t, resp)
+	require.Eventually(t, func() bool {
+		resp, err := http.Get(server.URL + "/runs/" + first.ID)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusNotFound
+	}, 2*time.Second, 10*time.Millisecond)
+
+	resp, err = http.Get(server.URL + "/runs")
+	require.NoError(t, err)
+	assert.Empty(t, decode[[]RunInfo](t, resp))
+}
@@ -0,0 +1,397 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+)
+
+// Event types streamed while a run progresses
+const (
+	// EventStage is emitted when a stage starts or finishes
+	EventStage = "stage"
+	// EventRun is emitted when the run finishes
+	EventRun = "run"
+)
+
+// RunInfo describes a triggered run and its current state.
+type RunInfo struct {
+	ID             string                 `json:"id"`
+	WorkflowID     string                 `json:"workflowId"`
+	RunID          string                 `json:"runId,omitempty"`
+	Status         string                 `json:"status"`
+	Params         map[string]interface{} `json:"params,omitempty"`
+	TriggeredBy    string                 `json:"triggeredBy,omitempty"`
+	Labels         map[string]string      `json:"labels,omitempty"`
+	Error          string                 `json:"error,omitempty"`
+	StartedAt      time.Time              `json:"startedAt"`
+	FinishedAt     *time.Time             `json:"finishedAt,omitempty"`
+	StageStatuses  map[string]string      `json:"stageStatuses,omitempty"`
+	ActionStatuses map[string]string      `json:"actionStatuses,omitempty"`
+}
+
+// Event is a progress update of a run.
+type Event struct {
+	Type    string    `json:"type"`
+	StageID string    `json:"stageId,omitempty"`
+	Status  string    `json:"status"`
+	Error   string    `json:"error,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// StartRunRequest is the body accepted when triggering a run.
+type StartRunRequest struct {
+	Params map[string]interface{} `json:"params,omitempty"`
+	// Labels attribute the run, see gostage.WithRunLabels. The "triggeredBy"
+	// label is set to the authenticated caller
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// defaultMaxRuns is the number of finished runs a handler keeps by default
+const defaultMaxRuns = 1000
+
+// WithRunRetention bounds the finished runs the handler keeps in memory, with
+// their events, to the max most recent ones, and drops those finished more
+// than ttl ago. Zero disables either bound. By default the handler keeps the
+// 1000 most recent finished runs. Runs in progress are always kept.
+//
+// Dropped runs are no longer listed by GET /runs. With WithHistory, GET
+// /runs/{id} still serves them by the RunID of their result from the history
+// store.
+func WithRunRetention(max int, ttl time.Duration) Option {
+	return func(h *Handler) {
+		h.maxRuns = max
+		h.runTTL = ttl
+	}
+}
+
+// run tracks the state and events of a single execution.
+// All fields are guarded by the handler's mutex.
+type run struct {
+	info     RunInfo
+	events   []Event
+	watchers map[chan struct{}]bool
+	cancel   context.CancelFunc
+}
+
+func (h *Handler) startRun(w http.ResponseWriter, r *http.Request) {
+	workflowID := r.PathValue("id")
+	// Authorize before the lookup, so that callers cannot probe which workflows exist
+	if !h.authorize(w, r, PermissionTrigger, workflowID) {
+		return
+	}
+
+	h.mu.RLock()
+	factory, ok := h.factories[workflowID]
+	h.mu.RUnlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "workflow '%s' not found", workflowID)
+		return
+	}
+
+	var req StartRunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, "invalid request body: %v", err)
+		return
+	}
+
+	wf, err := factory()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to create workflow '%s': %v", workflowID, err)
+		return
+	}
+	if err := wf.Instantiate(req.Params); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h.mu.Lock()
+	h.pruneRuns(time.Now())
+	h.nextRun++
+	rn := &run{
+		info: RunInfo{
+			ID:         fmt.Sprintf("run-%d", h.nextRun),
+			WorkflowID: workflowID,
+			Status:     gostage.StatusRunning,
+			Params:     req.Params,
+			Labels:     req.Labels,
+			StartedAt:  time.Now(),
+		},
+		watchers: make(map[chan struct{}]bool),
+		cancel:   cancel,
+	}
+	if principal, ok := PrincipalFromContext(r.Context()); ok {
+		rn.info.TriggeredBy = principal.Subject
+		if rn.info.Labels == nil {
+			rn.info.Labels = make(map[string]string)
+		}
+		rn.info.Labels["triggeredBy"] = principal.Subject
+	}
+	h.runs[rn.info.ID] = rn
+	h.runOrder = append(h.runOrder, rn.info.ID)
+	info := rn.info
+	h.mu.Unlock()
+
+	wf.Use(h.progressMiddleware(rn))
+	go h.execute(ctx, rn, wf)
+
+	writeJSON(w, http.StatusAccepted, info)
+}
+
+// progressMiddleware publishes stage events for a run.
+func (h *Handler) progressMiddleware(rn *run) gostage.WorkflowMiddleware {
+	return func(next gostage.WorkflowStageRunnerFunc) gostage.WorkflowStageRunnerFunc {
+		return func(ctx context.Context, stage *gostage.Stage, wf *gostage.Workflow, logger gostage.Logger) error {
+			if wf.IsStageEnabled(stage.ID) {
+				h.publish(rn, Event{Type: EventStage, StageID: stage.ID, Status: gostage.StatusRunning})
+			}
+
+			err := next(ctx, stage, wf, logger)
+
+			event := Event{Type: EventStage, StageID: stage.ID, Status: wf.StageStatuses()[stage.ID]}
+			if err != nil {
+				event.Status = gostage.StatusFailed
+				event.Error = err.Error()
+			} else if event.Status == "" {
+				event.Status = gostage.StatusCompleted
+			}
+			h.publish(rn, event)
+			return err
+		}
+	}
+}
+
+// execute runs the workflow and records the outcome of the run.
+func (h *Handler) execute(ctx context.Context, rn *run, wf *gostage.Workflow) {
+	defer rn.cancel()
+	result := h.runner.ExecuteWithOptions(wf, gostage.RunOptions{
+		Logger:  h.logger,
+		Context: ctx,
+		Labels:  rn.info.Labels,
+	})
+
+	finished := time.Now()
+	event := Event{Type: EventRun, Status: gostage.StatusCompleted, Time: finished}
+
+	h.mu.Lock()
+	rn.info.FinishedAt = &finished
+	rn.info.RunID = result.RunID
+	rn.info.StageStatuses = result.StageStatuses
+	rn.info.ActionStatuses = result.ActionStatuses
+	rn.info.Status = gostage.StatusCompleted
+	if !result.Success {
+		rn.info.Status = gostage.StatusFailed
+		if result.Cancelled {
+			rn.info.Status = gostage.StatusCancelled
+		}
+		event.Status = rn.info.Status
+		if result.Error != nil {
+			rn.info.Error = result.Error.Error()
+			event.Error = rn.info.Error
+		}
+	}
+	h.pruneRuns(finished)
+	h.mu.Unlock()
+
+	h.publish(rn, event)
+}
+
+// pruneRuns drops the oldest finished runs beyond the retention limit and
+// those that expired at now. The caller must hold the handler's mutex.
+// Clients streaming the events of a dropped run keep receiving them.
+func (h *Handler) pruneRuns(now time.Time) {
+	excess := -h.maxRuns
+	for _, id := range h.runOrder {
+		if h.runs[id].info.FinishedAt != nil {
+			excess++
+		}
+	}
+	if h.maxRuns <= 0 {
+		excess = 0
+	}
+
+	kept := h.runOrder[:0]
+	for _, id := range h.runOrder {
+		info := h.runs[id].info
+		if info.FinishedAt != nil && (excess > 0 || h.expired(info, now)) {
+			if excess > 0 {
+				excess--
+			}
+			delete(h.runs, id)
+			continue
+		}
+		kept = append(kept, id)
+	}
+	clear(h.runOrder[len(kept):])
+	h.runOrder = kept
+}
+
+// expired reports whether a run finished longer than the retention TTL ago.
+// Expired runs are hidden until the next run starts or finishes drops them.
+func (h *Handler) expired(info RunInfo, now time.Time) bool {
+	return h.runTTL > 0 && info.FinishedAt != nil && now.Sub(*info.FinishedAt) > h.runTTL
+}
+
+// publish records an event and wakes up the run's watchers.
+func (h *Handler) publish(rn *run, event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	rn.events = append(rn.events, event)
+	for watcher := range rn.watchers {
+		select {
+		case watcher <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (h *Handler) listRuns(w http.ResponseWriter, r *http.Request) {
+	workflowID := r.URL.Query().Get("workflow")
+
+	now := time.Now()
+	h.mu.RLock()
+	runs := make([]RunInfo, 0, len(h.runOrder))
+	for _, id := range h.runOrder {
+		info := h.runs[id].info
+		if (workflowID == "" || info.WorkflowID == workflowID) && !h.expired(info, now) && h.allowed(r, PermissionView, info.WorkflowID) {
+			runs = append(runs, info)
+		}
+	}
+	h.mu.RUnlock()
+
+	writeJSON(w, http.StatusOK, runs)
+}
+
+func (h *Handler) getRun(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	rn, ok := h.runs[r.PathValue("id")]
+	var info RunInfo
+	if ok {
+		info = rn.info
+		ok = !h.expired(info, time.Now())
+	}
+	h.mu.RUnlock()
+
+	if !ok && h.history != nil {
+		info, ok = h.historyRun(w, r.PathValue("id"))
+		if !ok {
+			return
+		}
+	} else if !ok {
+		writeError(w, http.StatusNotFound, "run '%s' not found", r.PathValue("id"))
+		return
+	}
+	if !h.authorizeFound(w, r, PermissionView, info.WorkflowID, "run", r.PathValue("id")) {
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// cancelRun cancels a run in progress. The run stops before its next action
+// and finishes with the cancelled status.
+func (h *Handler) cancelRun(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	rn, ok := h.runs[r.PathValue("id")]
+	var info RunInfo
+	if ok {
+		info = rn.info
+	}
+	h.mu.RUnlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "run '%s' not found", r.PathValue("id"))
+		return
+	}
+	if !h.authorizeFound(w, r, PermissionCancel, info.WorkflowID, "run", r.PathValue("id")) {
+		return
+	}
+	if info.FinishedAt != nil {
+		writeError(w, http.StatusConflict, "run '%s' already finished", info.ID)
+		return
+	}
+	rn.cancel()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// streamEvents replays the events of a run and streams new ones as
+// server-sent events until the run finishes or the client disconnects.
+func (h *Handler) streamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	h.mu.RLock()
+	rn, ok := h.runs[r.PathValue("id")]
+	var workflowID string
+	if ok {
+		workflowID = rn.info.WorkflowID
+	}
+	h.mu.RUnlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "run '%s' not found", r.PathValue("id"))
+		return
+	}
+	if !h.authorizeFound(w, r, PermissionViewLogs, workflowID, "run", r.PathValue("id")) {
+		return
+	}
+
+	watcher := make(chan struct{}, 1)
+	h.mu.Lock()
+	rn.watchers[watcher] = true
+	h.mu.Unlock()
+
+	defer func() {
+		h.mu.Lock()
+		delete(rn.watchers, watcher)
+		h.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	sent := 0
+	for {
+		h.mu.RLock()
+		pending := append([]Event{}, rn.events[sent:]...)
+		h.mu.RUnlock()
+
+		for _, event := range pending {
+			data, err := json.Marshal(event)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			sent++
+
+			// The run event is always the last one published
+			if event.Type == EventRun {
+				flusher.Flush()
+				return
+			}
+		}
+		flusher.Flush()
+
+		select {
+		case <-watcher:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package gostage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidroman0O/gostage/store"
+)
+
+// IdempotentAction is implemented by actions whose side effects must happen
+// only once. When the runner has an IdempotencyStore, an action whose key was
+// already recorded as completed is not executed again; the store changes it
+// made the first time are replayed instead.
+type IdempotentAction interface {
+	Action
+
+	// IdempotencyKey returns the key identifying the side effect of this
+	// execution, usually derived from the store. An empty key disables the check.
+	IdempotencyKey(ctx *ActionContext) (string, error)
+}
+
+// IdempotencyKeyFunc derives the idempotency key of an action execution.
+type IdempotencyKeyFunc func(ctx *ActionContext) (string, error)
+
+// IdempotencyRecord is the completion record of an idempotency key.
+type IdempotencyRecord struct {
+	Key         string    `json:"key"`
+	WorkflowID  string    `json:"workflowId"`
+	StageID     string    `json:"stageId"`
+	Action      string    `json:"action"`
+	CompletedAt time.Time `json:"completedAt"`
+	// Puts and Deletes are the store changes made by the completed action
+	Puts    map[string]json.RawMessage `json:"puts,omitempty"`
+	Deletes []string                   `json:"deletes,omitempty"`
+}
+
+// IdempotencyStore records the completed idempotency keys.
+type IdempotencyStore interface {
+	// Get returns the record of a key, or nil if the key has not completed
+	Get(key string) (*IdempotencyRecord, error)
+
+	// Put records a completed key
+	Put(record IdempotencyRecord) error
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore kept in memory. It protects
+// against re-execution within a process, such as retries.
+type MemoryIdempotencyStore struct {
+	mu      sync.RWMutex
+	records map[string]IdempotencyRecord
+}
+
+// NewMemoryIdempotencyStore creates an empty in-memory idempotency store.
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{records: make(map[string]IdempotencyRecord)}
+}
+
+// Get implements IdempotencyStore.Get.
+func (s *MemoryIdempotencyStore) Get(key string) (*IdempotencyRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.records[key]
+	if !ok {
+		return nil, nil
+	}
+	return &record, nil
+}
+
+// Put implements IdempotencyStore.Put.
+func (s *MemoryIdempotencyStore) Put(record IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[record.Key] = record
+	return nil
+}
+
+// BlobIdempotencyStore is an IdempotencyStore persisted in a blob backend,
+// so completed keys survive restarts and are honoured by recovered runs.
+type BlobIdempotencyStore struct {
+	backend store.BlobBackend
+}
+
+// NewBlobIdempotencyStore creates an idempotency store persisted in backend.
+func NewBlobIdempotencyStore(backend store.BlobBackend) *BlobIdempotencyStore {
+	return &BlobIdempotencyStore{backend: backend}
+}
+
+// Get implements IdempotencyStore.Get.
+func (s *BlobIdempotencyStore) Get(key string) (*IdempotencyRecord, error) {
+	reader, err := s.backend.Open(idempotencyBlobID(key))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read idempotency record: %w", err)
+	}
+	var record IdempotencyRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to parse idempotency record: %w", err)
+	}
+	return &record, nil
+}
+
+// Put implements IdempotencyStore.Put.
+func (s *BlobIdempotencyStore) Put(record IdempotencyRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to serialize idempotency record: %w", err)
+	}
+	if _, err := s.backend.Write(idempotencyBlobID(record.Key), bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to persist idempotency record: %w", err)
+	}
+	return nil
+}
+
+// idempotencyBlobID maps a key of any length and alphabet to a blob ID.
+func idempotencyBlobID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "idempotency-" + hex.EncodeToString(sum[:])
+}
+
+// idempotentAction attaches an idempotency key to an existing action.
+type idempotentAction struct {
+	Action
+	keyFunc IdempotencyKeyFunc
+}
+
+func (a *idempotentAction) IdempotencyKey(ctx *ActionContext) (string, error) {
+	return a.keyFunc(ctx)
+}
+
+// WithIdempotencyKey makes an action idempotent using keyFunc to derive its key.
+func WithIdempotencyKey(action Action, keyFunc IdempotencyKeyFunc) Action {
+	return &idempotentAction{Action: action, keyFunc: keyFunc}
+}
+
+// StoreIdempotencyKey derives the key from the action name and the values of
+// the given store keys, such as an order ID. Missing store keys are an error.
+func StoreIdempotencyKey(keys ...string) IdempotencyKeyFunc {
+	return func(ctx *ActionContext) (string, error) {
+		data := ctx.Workflow.Store.ExportAll()
+
+		parts := []string{ctx.Action.Name()}
+		for _, key := range keys {
+			value, ok := data[key]
+			if !ok {
+				return "", fmt.Errorf("store key '%s' of the idempotency key not found", key)
+			}
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return "", fmt.Errorf("store key '%s' of the idempotency key is not serializable: %w", key, err)
+			}
+			parts = append(parts, key+"="+string(encoded))
+		}
+		return strings.Join(parts, ":"), nil
+	}
+}
+
+// WithIdempotencyStore records the completed keys of idempotent actions in
+// idempotency, and skips actions whose key already completed.
+func WithIdempotencyStore(idempotency IdempotencyStore) RunnerOption {
+	return func(r *Runner) {
+		r.idempotency = idempotency
+	}
+}
+
+// idempotent wraps the execution of an action with the idempotency check.
+func (r *Runner) idempotent(stageID string, next ActionRunnerFunc) ActionRunnerFunc {
+	if r.idempotency == nil {
+		return next
+	}
+
+	return func(ctx *ActionContext, action Action, index int, isLast bool) error {
+		keyed, ok := action.(IdempotentAction)
+		if !ok {
+			return next(ctx, action, index, isLast)
+		}
+
+		key, err := keyed.IdempotencyKey(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to derive idempotency key: %w", err)
+		}
+		if key == "" {
+			return next(ctx, action, index, isLast)
+		}
+
+		record, err := r.idempotency.Get(key)
+		if err != nil {
+			return fmt.Errorf("failed to look up idempotency key '%s': %w", key, err)
+		}
+		if record != nil {
+			ctx.Logger.Info("Skipping action %s: idempotency key %s already completed", action.Name(), key)
+			return applyStoreDelta(ctx.Workflow, record.Puts, record.Deletes)
+		}
+
+		before, err := encodeUserStore(ctx.Workflow)
+		if err != nil {
+			return err
+		}
+		if err := next(ctx, action, index, isLast); err != nil {
+			return err
+		}
+		after, err := encodeUserStore(ctx.Workflow)
+		if err != nil {
+			return err
+		}
+
+		record = &IdempotencyRecord{
+			Key:         key,
+			WorkflowID:  ctx.Workflow.ID,
+			StageID:     stageID,
+			Action:      action.Name(),
+			CompletedAt: time.Now(),
+		}
+		record.Puts, record.Deletes = storeDelta(before, after)
+		if err := r.idempotency.Put(*record); err != nil {
+			return fmt.Errorf("failed to record idempotency key '%s': %w", key, err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,107 @@
+package gostage
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/davidroman0O/gostage/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newChargeWorkflow builds a workflow charging the order in its store once per
+// order ID. When consume is set, the charge also removes the order ID from the store.
+func newChargeWorkflow(orderID string, charges *int32, consume bool) *Workflow {
+	wf := NewWorkflow("billing", "Billing", "")
+	wf.Store.Put("orderId", orderID)
+	stage := NewStage("pay", "Pay", "")
+	stage.AddAction(WithIdempotencyKey(NewTestAction("charge", "", func(ctx *ActionContext) error {
+		n := atomic.AddInt32(charges, 1)
+		if consume {
+			ctx.Store().Delete("orderId")
+		}
+		return ctx.Store().Put("chargeId", int(n))
+	}), StoreIdempotencyKey("orderId")))
+	wf.AddStage(stage)
+	return wf
+}
+
+func TestIdempotentActionRunsOnce(t *testing.T) {
+	var charges int32
+	runner := NewRunner(WithIdempotencyStore(NewMemoryIdempotencyStore()))
+
+	first := runner.ExecuteWithOptions(newChargeWorkflow("o-1", &charges, true), DefaultRunOptions())
+	require.True(t, first.Success, "%v", first.Error)
+	second := runner.ExecuteWithOptions(newChargeWorkflow("o-1", &charges, true), DefaultRunOptions())
+	require.True(t, second.Success, "%v", second.Error)
+	other := runner.ExecuteWithOptions(newChargeWorkflow("o-2", &charges, true), DefaultRunOptions())
+	require.True(t, other.Success, "%v", other.Error)
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&charges))
+	assert.Equal(t, 1.0, second.FinalStore["chargeId"])
+	assert.NotContains(t, second.FinalStore, "orderId")
+	assert.Equal(t, StatusCompleted, second.ActionStatuses[ActionStatusKey("pay", "charge")])
+	assert.Equal(t, 2, other.FinalStore["chargeId"])
+}
+
+func TestIdempotentActionSkippedOnRetry(t *testing.T) {
+	var charges int32
+	retryTwice := func(next ActionRunnerFunc) ActionRunnerFunc {
+		return func(ctx *ActionContext, action Action, index int, isLast bool) error {
+			if err := next(ctx, action, index, isLast); err != nil {
+				return err
+			}
+			return next(ctx, action, index, isLast)
+		}
+	}
+	runner := NewRunner(
+		WithIdempotencyStore(NewMemoryIdempotencyStore()),
+		WithActionMiddleware(retryTwice),
+	)
+
+	require.NoError(t, runner.Execute(context.Background(), newChargeWorkflow("o-1", &charges, false), nil))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&charges))
+}
+
+func TestIdempotencyKeysPersist(t *testing.T) {
+	backend, err := store.NewFileBlobBackend(t.TempDir())
+	require.NoError(t, err)
+
+	var charges int32
+	first := NewRunner(WithIdempotencyStore(NewBlobIdempotencyStore(backend)))
+	require.True(t, first.ExecuteWithOptions(newChargeWorkflow("o-1", &charges, true), DefaultRunOptions()).Success)
+
+	record, err := NewBlobIdempotencyStore(backend).Get("charge:orderId=\"o-1\"")
+	require.NoError(t, err)
+	require.NotNil(t, record)
+	assert.Equal(t, "billing", record.WorkflowID)
+	assert.Equal(t, "pay", record.StageID)
+	assert.Equal(t, []string{"orderId"}, record.Deletes)
+
+	second := NewRunner(WithIdempotencyStore(NewBlobIdempotencyStore(backend)))
+	result := second.ExecuteWithOptions(newChargeWorkflow("o-1", &charges, true), DefaultRunOptions())
+	require.True(t, result.Success)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&charges))
+	assert.Equal(t, 1.0, result.FinalStore["chargeId"])
+
+	missing, err := NewBlobIdempotencyStore(backend).Get("unknown")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+}
+
+func TestIdempotencyKeyErrors(t *testing.T) {
+	var charges int32
+	wf := newChargeWorkflow("o-1", &charges, true)
+	wf.Store.Delete("orderId")
+
+	result := NewRunner(WithIdempotencyStore(NewMemoryIdempotencyStore())).ExecuteWithOptions(wf, DefaultRunOptions())
+	require.Error(t, result.Error)
+	assert.Contains(t, result.Error.Error(), "store key 'orderId' of the idempotency key not found")
+	assert.Equal(t, int32(0), atomic.LoadInt32(&charges))
+
+	// Without an idempotency store the key is never evaluated
+	wf = newChargeWorkflow("o-1", &charges, true)
+	wf.Store.Delete("orderId")
+	assert.True(t, NewRunner().ExecuteWithOptions(wf, DefaultRunOptions()).Success)
+}
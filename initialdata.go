@@ -0,0 +1,89 @@
+package gostage
+
+import (
+	"fmt"
+	"os"
+)
+
+// InitialDataProvider produces a value of a stage's initial data when the
+// stage starts. The context has no action; it reads the workflow store as it
+// is once the static initial data of the stage is applied.
+type InitialDataProvider func(ctx *ActionContext) (any, error)
+
+// initialDataSource is an initial data key loaded by a provider.
+type initialDataSource struct {
+	key      string
+	provider InitialDataProvider
+}
+
+// SetInitialDataFrom sets the initial data key to the value returned by
+// provider, called every time the stage starts rather than when the workflow
+// is built. This lets initial data come from files, the environment or APIs
+// at run time. Providers run in the order they were set, after the values set
+// with SetInitialData, and their values are merged according to the stage's
+// MergePolicy. A provider error fails the stage before any of its actions
+// runs. Setting a provider for a key replaces its previous provider.
+//
+// Providers are Go-only state: they are not part of the workflow definition,
+// except for spawned and remote stages: their providers run in the parent
+// process, before the static initial data is applied in the child, and the
+// values they return are sent with the stage.
+func (s *Stage) SetInitialDataFrom(key string, provider InitialDataProvider) {
+	for i, source := range s.initialSources {
+		if source.key == key {
+			s.initialSources[i].provider = provider
+			return
+		}
+	}
+	s.initialSources = append(s.initialSources, initialDataSource{key: key, provider: provider})
+}
+
+// applyInitialData calls the initial data providers of the stage in order,
+// merging each value into the workflow store before calling the next provider.
+// It returns the values by key.
+func (s *Stage) applyInitialData(ctx *ActionContext) (map[string]any, error) {
+	if len(s.initialSources) == 0 || ctx.Workflow.Store == nil {
+		return nil, nil
+	}
+	values := make(map[string]any, len(s.initialSources))
+	var conflicts []InitialDataConflict
+	defer func() { recordConflicts(ctx.Workflow, ctx.Logger, conflicts) }()
+	for _, source := range s.initialSources {
+		value, err := source.provider(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("stage '%s': failed to load initial data '%s': %w", s.ID, source.key, err)
+		}
+		conflict, err := s.mergeInitialValue(ctx.Workflow, source.key, value)
+		if conflict != nil {
+			conflicts = append(conflicts, *conflict)
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[source.key] = value
+	}
+	return values, nil
+}
+
+// InitialDataFromEnv provides the value of the environment variable name. It
+// fails if the variable is not set.
+func InitialDataFromEnv(name string) InitialDataProvider {
+	return func(ctx *ActionContext) (any, error) {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value, nil
+	}
+}
+
+// InitialDataFromFile provides the content of the file at path as a string.
+func InitialDataFromFile(path string) InitialDataProvider {
+	return func(ctx *ActionContext) (any, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	}
+}
@@ -0,0 +1,133 @@
+package gostage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/davidroman0O/gostage/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetInitialDataFromRunsAtStageStart(t *testing.T) {
+	calls := 0
+	var seen []string
+
+	wf := NewWorkflow("report", "Report", "")
+	prepare := NewStage("prepare", "Prepare", "")
+	prepare.AddAction(NewActionFunc("prepare", "", func(ctx *ActionContext) error {
+		return ctx.Store().Put("region", "eu")
+	}))
+	wf.AddStage(prepare)
+
+	stage := NewStage("load", "Load", "")
+	require.NoError(t, stage.SetInitialData("bucket", "reports"))
+	stage.SetInitialDataFrom("path", func(ctx *ActionContext) (any, error) {
+		calls++
+		// The store already holds the earlier stages' output and the static initial data
+		region, err := store.Get[string](ctx.Store(), "region")
+		if err != nil {
+			return nil, err
+		}
+		bucket, err := store.Get[string](ctx.Store(), "bucket")
+		if err != nil {
+			return nil, err
+		}
+		return bucket + "/" + region, nil
+	})
+	stage.SetInitialDataFrom("url", func(ctx *ActionContext) (any, error) {
+		path, err := store.Get[string](ctx.Store(), "path")
+		return "s3://" + path, err
+	})
+	stage.AddAction(NewActionFunc("read", "", func(ctx *ActionContext) error {
+		url, err := store.Get[string](ctx.Store(), "url")
+		seen = append(seen, url)
+		return err
+	}))
+	wf.AddStage(stage)
+	assert.Equal(t, 0, calls)
+
+	runner := NewRunner()
+	require.NoError(t, runner.Execute(context.Background(), wf, nil))
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, []string{"s3://reports/eu"}, seen)
+
+	// Each run calls the providers again, and so do the runs of clones
+	require.NoError(t, runner.Execute(context.Background(), wf, nil))
+	assert.Equal(t, 2, calls)
+	copied := NewWorkflow("copy", "Copy", "")
+	copied.AddStage(prepare.Clone())
+	copied.AddStage(stage.Clone())
+	require.NoError(t, runner.Execute(context.Background(), copied, nil))
+	assert.Equal(t, 3, calls)
+}
+
+func TestSetInitialDataFromFailure(t *testing.T) {
+	executed := false
+	wf := NewWorkflow("report", "Report", "")
+	stage := NewStage("load", "Load", "")
+	stage.SetInitialDataFrom("token", func(ctx *ActionContext) (any, error) {
+		return nil, errors.New("vault sealed")
+	})
+	stage.AddAction(NewActionFunc("read", "", func(ctx *ActionContext) error {
+		executed = true
+		return nil
+	}))
+	wf.AddStage(stage)
+
+	err := NewRunner().Execute(context.Background(), wf, nil)
+	assert.ErrorContains(t, err, "stage 'load': failed to load initial data 'token': vault sealed")
+	assert.False(t, executed)
+}
+
+func TestSetInitialDataFromReplacesProvider(t *testing.T) {
+	stage := NewStage("load", "Load", "")
+	stage.SetInitialDataFrom("value", func(ctx *ActionContext) (any, error) { return 1, nil })
+	stage.SetInitialDataFrom("value", func(ctx *ActionContext) (any, error) { return 2, nil })
+	require.Len(t, stage.initialSources, 1)
+
+	var value int
+	stage.AddAction(NewActionFunc("read", "", func(ctx *ActionContext) error {
+		var err error
+		value, err = store.Get[int](ctx.Store(), "value")
+		return err
+	}))
+	wf := NewWorkflow("replace", "Replace", "")
+	wf.AddStage(stage)
+	require.NoError(t, NewRunner().Execute(context.Background(), wf, nil))
+	assert.Equal(t, 2, value)
+}
+
+func TestInitialDataFromEnvAndFile(t *testing.T) {
+	t.Setenv("GOSTAGE_TEST_REGION", "eu-west-1")
+	path := filepath.Join(t.TempDir(), "motd.txt")
+	require.NoError(t, os.WriteFile(path, []byte("hello"), 0o644))
+
+	region, err := InitialDataFromEnv("GOSTAGE_TEST_REGION")(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "eu-west-1", region)
+	_, err = InitialDataFromEnv("GOSTAGE_TEST_UNSET")(nil)
+	assert.ErrorContains(t, err, "GOSTAGE_TEST_UNSET is not set")
+
+	motd, err := InitialDataFromFile(path)(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", motd)
+	_, err = InitialDataFromFile(filepath.Join(t.TempDir(), "missing"))(nil)
+	assert.Error(t, err)
+}
+
+func TestSetInitialDataFromOnSpawnedStage(t *testing.T) {
+	wf := newSpawnedStageWorkflow(t, orderEchoActionID)
+	isolated := wf.Stages[1]
+	require.NoError(t, isolated.SetInitialData("orderId", "static"))
+	isolated.SetInitialDataFrom("orderId", func(ctx *ActionContext) (any, error) {
+		return "o-2", nil
+	})
+
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, "o-2", result.FinalStore["echo"])
+}
@@ -0,0 +1,274 @@
+package gostage
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrInitialDataConflict is returned when the initial data of a stage with
+// the MergeErrorOnConflict policy would change a value of the workflow store.
+var ErrInitialDataConflict = errors.New("initial data conflicts with the workflow store")
+
+// MergePolicy decides what happens when the initial data of a stage sets a key
+// the workflow store already holds with another value.
+type MergePolicy int
+
+const (
+	// MergeOverride replaces the store value with the initial data. It is the default
+	MergeOverride MergePolicy = iota
+	// MergeSkipIfExists keeps the store value
+	MergeSkipIfExists
+	// MergeErrorOnConflict fails the stage before any of its actions runs
+	MergeErrorOnConflict
+	// MergeDeepMaps merges maps key by key, the initial data winning on the
+	// keys both maps hold, and replaces other values
+	MergeDeepMaps
+)
+
+// mergePolicyNames are the names of the policies in definitions and reports
+var mergePolicyNames = map[MergePolicy]string{
+	MergeOverride:        "override",
+	MergeSkipIfExists:    "skipIfExists",
+	MergeErrorOnConflict: "errorOnConflict",
+	MergeDeepMaps:        "deepMergeMaps",
+}
+
+// String returns the name of the policy.
+func (p MergePolicy) String() string {
+	if name, ok := mergePolicyNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("MergePolicy(%d)", int(p))
+}
+
+// ParseMergePolicy returns the policy with the given name, as returned by String.
+func ParseMergePolicy(name string) (MergePolicy, error) {
+	for policy, policyName := range mergePolicyNames {
+		if strings.EqualFold(name, policyName) {
+			return policy, nil
+		}
+	}
+	return MergeOverride, fmt.Errorf("unknown merge policy '%s'", name)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (p MergePolicy) MarshalText() ([]byte, error) {
+	if _, ok := mergePolicyNames[p]; !ok {
+		return nil, fmt.Errorf("unknown merge policy %d", int(p))
+	}
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (p *MergePolicy) UnmarshalText(text []byte) error {
+	policy, err := ParseMergePolicy(string(text))
+	if err != nil {
+		return err
+	}
+	*p = policy
+	return nil
+}
+
+// SetMergePolicy sets how the initial data of the stage, static or from
+// providers, is merged into the workflow store when the stage starts.
+func (s *Stage) SetMergePolicy(policy MergePolicy) {
+	s.mergePolicy = policy
+}
+
+// MergePolicy returns the merge policy of the stage's initial data.
+func (s *Stage) MergePolicy() MergePolicy {
+	return s.mergePolicy
+}
+
+// InitialDataConflict is a key of a stage's initial data that the workflow
+// store already held with another value when the stage started.
+type InitialDataConflict struct {
+	// StageID is the stage the initial data belongs to
+	StageID string `json:"stageId"`
+	// Key is the conflicting store key
+	Key string `json:"key"`
+	// Existing is the value the store held
+	Existing any `json:"existing"`
+	// Initial is the value of the initial data
+	Initial any `json:"initial"`
+	// Policy is the merge policy that resolved the conflict
+	Policy MergePolicy `json:"policy"`
+}
+
+// contextInitialDataConflicts collects the conflicts of the run in progress, set by ExecuteWithOptions
+const contextInitialDataConflicts = "initialDataConflicts"
+
+// conflictLog collects the initial data conflicts of a run.
+type conflictLog struct {
+	mu        sync.Mutex
+	conflicts []InitialDataConflict
+}
+
+// recordConflicts logs the conflicts of a stage and adds them to the report of the run.
+func recordConflicts(w *Workflow, logger Logger, conflicts []InitialDataConflict) {
+	for _, conflict := range conflicts {
+		switch conflict.Policy {
+		case MergeOverride:
+			logger.Warn("Initial data of stage '%s' overrides store key '%s'", conflict.StageID, conflict.Key)
+		case MergeDeepMaps:
+			logger.Debug("Initial data of stage '%s' is merged into store key '%s'", conflict.StageID, conflict.Key)
+		case MergeSkipIfExists:
+			logger.Debug("Initial data of stage '%s' skips existing store key '%s'", conflict.StageID, conflict.Key)
+		}
+	}
+	if log, ok := w.Context[contextInitialDataConflicts].(*conflictLog); ok {
+		log.mu.Lock()
+		log.conflicts = append(log.conflicts, conflicts...)
+		log.mu.Unlock()
+	}
+}
+
+// findConflict returns the conflict of setting key to value in the workflow
+// store, or nil if the store does not hold the key or holds the same value.
+func (s *Stage) findConflict(w *Workflow, key string, value any) *InitialDataConflict {
+	existing, err := w.Store.GetValue(key)
+	if err != nil || reflect.DeepEqual(existing, value) {
+		return nil
+	}
+	return &InitialDataConflict{StageID: s.ID, Key: key, Existing: existing, Initial: value, Policy: s.mergePolicy}
+}
+
+// conflictError returns the error failing a stage with the MergeErrorOnConflict policy.
+func conflictError(stageID string, conflicts []InitialDataConflict) error {
+	keys := make([]string, len(conflicts))
+	for i, conflict := range conflicts {
+		keys[i] = "'" + conflict.Key + "'"
+	}
+	return fmt.Errorf("stage '%s': %w: %s", stageID, ErrInitialDataConflict, strings.Join(keys, ", "))
+}
+
+// mergeInitialData merges the static initial data of the stage into the
+// workflow store according to its merge policy, rendering templated values.
+func (s *Stage) mergeInitialData(w *Workflow, logger Logger) error {
+	initial := s.initialStore.ExportAll()
+	var conflicts []InitialDataConflict
+	for key, value := range initial {
+		if conflict := s.findConflict(w, key, value); conflict != nil {
+			conflicts = append(conflicts, *conflict)
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Key < conflicts[j].Key })
+
+	if len(conflicts) > 0 && s.mergePolicy == MergeErrorOnConflict {
+		recordConflicts(w, logger, conflicts)
+		return conflictError(s.ID, conflicts)
+	}
+
+	logger.Debug("Merging stage's initialStore into workflow store. Stage: %s, Keys in initialStore: %d, Policy: %s",
+		s.ID, len(initial), s.mergePolicy)
+	skipped := make(map[string]bool)
+	if s.mergePolicy == MergeSkipIfExists {
+		for _, key := range w.Store.FindKeyCollisions(s.initialStore) {
+			skipped[key] = true
+		}
+		copied, err := w.Store.CopyFrom(s.initialStore)
+		if err != nil {
+			logger.Error("Failed to copy stage's initialStore: %v", err)
+		} else {
+			logger.Debug("Copied %d keys from stage's initialStore", copied)
+		}
+	} else {
+		copied, overwritten, err := w.Store.CopyFromWithOverwrite(s.initialStore)
+		if err != nil {
+			logger.Error("Failed to copy stage's initialStore: %v", err)
+		} else {
+			logger.Debug("Copied %d keys, overwrote %d keys from stage's initialStore", copied, overwritten)
+		}
+	}
+
+	// Render templated initial data against the live store
+	if err := renderInitialData(s.initialStore, w.Store, skipped); err != nil {
+		return fmt.Errorf("stage '%s': %w", s.ID, err)
+	}
+
+	if s.mergePolicy == MergeDeepMaps {
+		for _, conflict := range conflicts {
+			rendered, err := w.Store.GetValue(conflict.Key)
+			if err != nil {
+				continue
+			}
+			if merged, ok := deepMergeMaps(conflict.Existing, rendered); ok {
+				if err := w.Store.Put(conflict.Key, merged); err != nil {
+					return fmt.Errorf("stage '%s': failed to merge initial data '%s': %w", s.ID, conflict.Key, err)
+				}
+			}
+		}
+	}
+
+	recordConflicts(w, logger, conflicts)
+	return nil
+}
+
+// mergeInitialValue sets key to a value of the initial data according to the
+// merge policy of the stage, returning the conflict it caused, if any.
+func (s *Stage) mergeInitialValue(w *Workflow, key string, value any) (*InitialDataConflict, error) {
+	conflict := s.findConflict(w, key, value)
+	if conflict != nil {
+		switch s.mergePolicy {
+		case MergeErrorOnConflict:
+			return conflict, conflictError(s.ID, []InitialDataConflict{*conflict})
+		case MergeSkipIfExists:
+			return conflict, nil
+		case MergeDeepMaps:
+			if merged, ok := deepMergeMaps(conflict.Existing, value); ok {
+				value = merged
+			}
+		}
+	}
+	if err := w.Store.Put(key, value); err != nil {
+		return conflict, fmt.Errorf("stage '%s': failed to set initial data '%s': %w", s.ID, key, err)
+	}
+	return conflict, nil
+}
+
+// deepMergeMaps merges overlay into a copy of base when both are maps, the
+// values of overlay winning except for maps held by both, which are merged.
+func deepMergeMaps(base, overlay any) (map[string]interface{}, bool) {
+	baseMap, ok := base.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	overlayMap, ok := overlay.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	merged := make(map[string]interface{}, len(baseMap)+len(overlayMap))
+	for key, value := range baseMap {
+		merged[key] = value
+	}
+	for key, value := range overlayMap {
+		if nested, ok := deepMergeMaps(merged[key], value); ok {
+			merged[key] = nested
+			continue
+		}
+		merged[key] = value
+	}
+	return merged, true
+}
+
+// startConflictLog starts collecting the initial data conflicts of a run.
+func startConflictLog(w *Workflow) {
+	w.Context[contextInitialDataConflicts] = &conflictLog{}
+}
+
+// finishConflictLog returns the initial data conflicts of the run and stops collecting them.
+func finishConflictLog(w *Workflow) []InitialDataConflict {
+	log, ok := w.Context[contextInitialDataConflicts].(*conflictLog)
+	delete(w.Context, contextInitialDataConflicts)
+	if !ok {
+		return nil
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	return log.conflicts
+}
@@ -0,0 +1,167 @@
+package gostage
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/davidroman0O/gostage/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMergeWorkflow returns a workflow whose store holds the config map and
+// the region, and whose "configure" stage sets initial data over them.
+func newMergeWorkflow(t *testing.T, policy MergePolicy, executed *bool) (*Workflow, *Stage) {
+	wf := NewWorkflow("merge", "Merge", "")
+	require.NoError(t, wf.Store.Put("region", "us-east-1"))
+	require.NoError(t, wf.Store.Put("config", map[string]interface{}{
+		"db":      map[string]interface{}{"host": "db.internal", "port": 5432},
+		"retries": 3,
+	}))
+
+	stage := NewStage("configure", "Configure", "")
+	stage.SetMergePolicy(policy)
+	require.NoError(t, stage.SetInitialData("region", "eu-west-1"))
+	require.NoError(t, stage.SetInitialData("config", map[string]interface{}{
+		"db": map[string]interface{}{"port": 6432},
+	}))
+	require.NoError(t, stage.SetInitialData("owner", "payments"))
+	stage.AddAction(NewActionFunc("run", "", func(ctx *ActionContext) error {
+		*executed = true
+		return nil
+	}))
+	wf.AddStage(stage)
+	return wf, stage
+}
+
+func TestMergePolicies(t *testing.T) {
+	tests := []struct {
+		policy MergePolicy
+		region string
+		config map[string]interface{}
+	}{
+		{
+			policy: MergeOverride,
+			region: "eu-west-1",
+			config: map[string]interface{}{"db": map[string]interface{}{"port": 6432}},
+		},
+		{
+			policy: MergeSkipIfExists,
+			region: "us-east-1",
+			config: map[string]interface{}{"db": map[string]interface{}{"host": "db.internal", "port": 5432}, "retries": 3},
+		},
+		{
+			policy: MergeDeepMaps,
+			region: "eu-west-1",
+			config: map[string]interface{}{"db": map[string]interface{}{"host": "db.internal", "port": 6432}, "retries": 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			var executed bool
+			wf, _ := newMergeWorkflow(t, tt.policy, &executed)
+			result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+			require.True(t, result.Success, "%v", result.Error)
+			assert.True(t, executed)
+
+			assert.Equal(t, tt.region, result.FinalStore["region"])
+			assert.Equal(t, tt.config, result.FinalStore["config"])
+			assert.Equal(t, "payments", result.FinalStore["owner"])
+
+			require.Len(t, result.InitialDataConflicts, 2)
+			assert.Equal(t, "config", result.InitialDataConflicts[0].Key)
+			region := result.InitialDataConflicts[1]
+			assert.Equal(t, InitialDataConflict{
+				StageID: "configure", Key: "region", Existing: "us-east-1", Initial: "eu-west-1", Policy: tt.policy,
+			}, region)
+		})
+	}
+}
+
+func TestMergeErrorOnConflict(t *testing.T) {
+	var executed bool
+	wf, _ := newMergeWorkflow(t, MergeErrorOnConflict, &executed)
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.False(t, result.Success)
+	assert.ErrorIs(t, result.Error, ErrInitialDataConflict)
+	assert.ErrorContains(t, result.Error, "'config', 'region'")
+	assert.False(t, executed)
+	assert.Equal(t, "us-east-1", result.FinalStore["region"])
+	assert.NotContains(t, result.FinalStore, "owner")
+	assert.Len(t, result.InitialDataConflicts, 2)
+
+	// Setting a key to the value it already holds is not a conflict
+	wf, stage := newMergeWorkflow(t, MergeErrorOnConflict, &executed)
+	require.NoError(t, wf.Store.Put("region", "eu-west-1"))
+	require.NoError(t, wf.Store.Put("config", map[string]interface{}{"db": map[string]interface{}{"port": 6432}}))
+	stage.SetInitialDataFrom("owner", func(ctx *ActionContext) (any, error) { return "payments", nil })
+	result = NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Empty(t, result.InitialDataConflicts)
+}
+
+func TestMergePolicyAppliesToProviders(t *testing.T) {
+	var executed bool
+	wf, stage := newMergeWorkflow(t, MergeSkipIfExists, &executed)
+	stage.SetInitialDataFrom("region", func(ctx *ActionContext) (any, error) { return "ap-south-1", nil })
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, "us-east-1", result.FinalStore["region"])
+	assert.Len(t, result.InitialDataConflicts, 3)
+
+	wf, stage = newMergeWorkflow(t, MergeErrorOnConflict, &executed)
+	require.NoError(t, wf.Store.Put("region", "eu-west-1"))
+	require.NoError(t, wf.Store.Put("config", map[string]interface{}{"db": map[string]interface{}{"port": 6432}}))
+	stage.SetInitialDataFrom("region", func(ctx *ActionContext) (any, error) { return "ap-south-1", nil })
+	err := NewRunner().Execute(context.Background(), wf, nil)
+	assert.ErrorIs(t, err, ErrInitialDataConflict)
+	region, _ := store.Get[string](wf.Store, "region")
+	assert.Equal(t, "eu-west-1", region)
+}
+
+func TestSkipIfExistsDoesNotRenderSkippedKeys(t *testing.T) {
+	wf := NewWorkflow("render", "Render", "")
+	require.NoError(t, wf.Store.Put("env", "prod"))
+	require.NoError(t, wf.Store.Put("url", "https://fixed.example.com"))
+	stage := NewStage("s", "S", "")
+	stage.SetMergePolicy(MergeSkipIfExists)
+	require.NoError(t, stage.SetInitialData("url", "https://{{ .store.env }}.example.com"))
+	stage.AddAction(NewActionFunc("noop", "", func(ctx *ActionContext) error { return nil }))
+	wf.AddStage(stage)
+
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, "https://fixed.example.com", result.FinalStore["url"])
+}
+
+func TestMergePolicySerialization(t *testing.T) {
+	for policy := MergeOverride; policy <= MergeDeepMaps; policy++ {
+		parsed, err := ParseMergePolicy(policy.String())
+		require.NoError(t, err)
+		assert.Equal(t, policy, parsed)
+	}
+	_, err := ParseMergePolicy("sometimes")
+	assert.Error(t, err)
+
+	registry := newSerializationRegistry(t)
+	wf := NewWorkflow("merge", "Merge", "")
+	stage := NewStage("s", "S", "")
+	stage.SetMergePolicy(MergeDeepMaps)
+	noop, err := registry.Resolve("noop", nil)
+	require.NoError(t, err)
+	stage.AddAction(noop)
+	wf.AddStage(stage)
+
+	data, err := wf.Marshal()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"mergePolicy":"deepMergeMaps"`)
+	restored, err := UnmarshalWorkflow(data, registry)
+	require.NoError(t, err)
+	assert.Equal(t, MergeDeepMaps, restored.Stages[0].MergePolicy())
+	assert.Equal(t, MergeDeepMaps, stage.Clone().MergePolicy())
+
+	var def StageDef
+	require.NoError(t, json.Unmarshal([]byte(`{"id":"s","actions":[]}`), &def))
+	assert.Equal(t, MergeOverride, def.MergePolicy)
+}
@@ -0,0 +1,61 @@
+package gostage
+
+// contextRunLabels holds the labels of the run in progress, set by ExecuteWithOptions
+const contextRunLabels = "runLabels"
+
+// SubmitOption adjusts the options of a single submitted run.
+type SubmitOption func(*RunOptions)
+
+// WithRunLabels attaches labels to the run, such as the team, caller or cost
+// center it is executed for. Labels are added to those of the runner's default
+// options, replacing the values of the same keys. They are carried by the
+// RunResult, the events and the history of the run, and by the metrics that
+// are configured to break down by them, so that executions and their duration
+// can be attributed.
+func WithRunLabels(labels map[string]string) SubmitOption {
+	return func(options *RunOptions) {
+		merged := make(map[string]string, len(options.Labels)+len(labels))
+		for key, value := range options.Labels {
+			merged[key] = value
+		}
+		for key, value := range labels {
+			merged[key] = value
+		}
+		options.Labels = merged
+	}
+}
+
+// WithRunPriority sets the RunOptions.Priority of the run.
+func WithRunPriority(priority int) SubmitOption {
+	return func(options *RunOptions) {
+		options.Priority = priority
+	}
+}
+
+// startRunLabels makes the labels of a run available to its actions, events
+// and middleware.
+func startRunLabels(w *Workflow, labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+	copied := make(map[string]string, len(labels))
+	for key, value := range labels {
+		copied[key] = value
+	}
+	w.Context[contextRunLabels] = copied
+}
+
+// RunLabels returns the labels of the run in progress, or nil outside of a
+// run or if it has none. The map must not be modified.
+func (w *Workflow) RunLabels() map[string]string {
+	labels, _ := w.Context[contextRunLabels].(map[string]string)
+	return labels
+}
+
+// RunLabels returns the labels of the run executing the action, or nil.
+func (ctx *ActionContext) RunLabels() map[string]string {
+	if ctx.Workflow == nil {
+		return nil
+	}
+	return ctx.Workflow.RunLabels()
+}
@@ -0,0 +1,83 @@
+package gostage
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/davidroman0O/gostage/history"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLabelledWorkflow(seen *map[string]string) *Workflow {
+	wf := NewWorkflow("report", "Report", "")
+	stage := NewStage("s", "S", "")
+	stage.AddAction(NewActionFunc("read", "", func(ctx *ActionContext) error {
+		*seen = ctx.RunLabels()
+		return nil
+	}))
+	wf.AddStage(stage)
+	return wf
+}
+
+func TestSubmitWithRunLabels(t *testing.T) {
+	runs := history.NewMemoryStore()
+	defaults := DefaultRunOptions()
+	defaults.Labels = map[string]string{"env": "prod", "team": "platform"}
+	runner := NewRunner(WithHistory(runs), WithOptions(defaults))
+	defer runner.Close()
+
+	var mu sync.Mutex
+	var events []Event
+	runner.Subscribe(EventWorkflowStarted|EventActionCompleted, func(event Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	})
+
+	var seen map[string]string
+	labels := map[string]string{"team": "payments", "caller": "billing-api"}
+	job, err := runner.Submit(newLabelledWorkflow(&seen), WithRunLabels(labels), WithRunPriority(3))
+	require.NoError(t, err)
+	result := job.Wait()
+	require.True(t, result.Success, "%v", result.Error)
+
+	expected := map[string]string{"env": "prod", "team": "payments", "caller": "billing-api"}
+	assert.Equal(t, expected, seen)
+	assert.Equal(t, expected, result.Labels)
+	assert.Equal(t, expected, job.Labels)
+	assert.Equal(t, 3, job.Priority)
+
+	mu.Lock()
+	require.Len(t, events, 2)
+	for _, event := range events {
+		assert.Equal(t, expected, event.Labels)
+	}
+	mu.Unlock()
+
+	run, err := runs.GetRun(result.RunID)
+	require.NoError(t, err)
+	assert.Equal(t, expected, run.Labels)
+
+	// The options of the runner and of the caller are left untouched
+	assert.Equal(t, map[string]string{"env": "prod", "team": "platform"}, defaults.Labels)
+	assert.Equal(t, map[string]string{"team": "payments", "caller": "billing-api"}, labels)
+}
+
+func TestRunLabelsEndWithTheRun(t *testing.T) {
+	runner := NewRunner()
+	var seen map[string]string
+	wf := newLabelledWorkflow(&seen)
+
+	options := DefaultRunOptions()
+	options.Labels = map[string]string{"caller": "cron"}
+	result := runner.ExecuteWithOptions(wf, options)
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, map[string]string{"caller": "cron"}, seen)
+	assert.Nil(t, wf.RunLabels())
+
+	// Runs without labels have none, even when the workflow is reused
+	require.NoError(t, runner.Execute(context.Background(), wf, nil))
+	assert.Nil(t, seen)
+}
@@ -0,0 +1,108 @@
+package gostage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/davidroman0O/gostage/lock"
+)
+
+// DefaultLockTTL is the duration of workflow leases when WithLockTTL is not used.
+const DefaultLockTTL = 30 * time.Second
+
+// WithLockProvider makes the runner lease the workflow ID from provider before
+// executing a workflow, so that several instances of a service sharing the
+// provider never run the same workflow concurrently. A workflow whose lease is
+// held elsewhere fails with an error wrapping lock.ErrNotAcquired.
+//
+// The lease is refreshed while the workflow runs. If it is lost, the context
+// of the run is cancelled with lock.ErrLeaseLost as its cause. Refreshes
+// failing for other reasons, such as an unreachable provider, are retried
+// until the lease expires, which also cancels the run.
+func WithLockProvider(provider lock.Provider) RunnerOption {
+	return func(r *Runner) {
+		r.locks = provider
+	}
+}
+
+// MinLockTTL is the shortest duration of workflow leases.
+const MinLockTTL = 3 * time.Millisecond
+
+// WithLockTTL sets the duration of workflow leases. A lease is refreshed every
+// third of ttl, on the clock of the runner, and expires after ttl if its
+// runner dies. It panics if ttl is shorter than MinLockTTL.
+func WithLockTTL(ttl time.Duration) RunnerOption {
+	if ttl < MinLockTTL {
+		panic(fmt.Sprintf("invalid lock TTL %s: it must be at least %s", ttl, MinLockTTL))
+	}
+	return func(r *Runner) {
+		r.lockTTL = ttl
+	}
+}
+
+// acquireWorkflowLock leases the workflow ID and keeps the lease alive until the
+// returned release function is called. Without a lock provider it does nothing.
+func (r *Runner) acquireWorkflowLock(ctx context.Context, w *Workflow, logger Logger) (context.Context, func(), error) {
+	if r.locks == nil {
+		return ctx, func() {}, nil
+	}
+
+	ttl := r.lockTTL
+	if ttl <= 0 {
+		ttl = DefaultLockTTL
+	}
+
+	clock := r.Clock()
+	expires := clock.Now().Add(ttl)
+	lease, err := r.locks.Acquire(ctx, w.ID, ttl)
+	if err != nil {
+		return ctx, nil, fmt.Errorf("failed to lock workflow '%s': %w", w.ID, err)
+	}
+	logger.Debug("Acquired lease on workflow %s", w.ID)
+
+	runCtx, cancel := context.WithCancelCause(ctx)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		for {
+			timer := clock.NewTimer(ttl / 3)
+			select {
+			case <-stop:
+				timer.Stop()
+				return
+			case <-timer.C():
+			}
+
+			attempted := clock.Now()
+			err := lease.Refresh(runCtx, ttl)
+			switch {
+			case err == nil:
+				expires = attempted.Add(ttl)
+			case errors.Is(err, lock.ErrLeaseLost):
+				logger.Error("Lost lease on workflow %s: %v", w.ID, err)
+				cancel(fmt.Errorf("workflow '%s': %w", w.ID, err))
+				return
+			case !clock.Now().Before(expires):
+				logger.Error("Lease on workflow %s expired, failed to refresh it: %v", w.ID, err)
+				cancel(fmt.Errorf("workflow '%s': %w: %w", w.ID, lock.ErrLeaseLost, err))
+				return
+			default:
+				logger.Warn("Failed to refresh lease on workflow %s, retrying: %v", w.ID, err)
+			}
+		}
+	}()
+
+	release := func() {
+		close(stop)
+		<-done
+		cancel(nil)
+		if err := lease.Release(context.Background()); err != nil {
+			logger.Warn("Failed to release lease on workflow %s: %v", w.ID, err)
+		}
+	}
+	return runCtx, release, nil
+}
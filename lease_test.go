@@ -0,0 +1,179 @@
+package gostage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davidroman0O/gostage/lock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkflowLockPreventsConcurrentRuns(t *testing.T) {
+	provider := lock.NewMemoryProvider()
+	first := NewRunner(WithLockProvider(provider))
+	second := NewRunner(WithLockProvider(provider))
+
+	started := make(chan struct{})
+	proceed := make(chan struct{})
+	blocking := NewWorkflow("nightly", "Nightly", "")
+	stage := NewStage("work", "Work", "")
+	stage.AddAction(NewTestAction("block", "", func(ctx *ActionContext) error {
+		close(started)
+		<-proceed
+		return nil
+	}))
+	blocking.AddStage(stage)
+
+	done := make(chan error, 1)
+	go func() { done <- first.Execute(context.Background(), blocking, nil) }()
+	<-started
+
+	err := second.Execute(context.Background(), newLockedWorkflow(), nil)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, lock.ErrNotAcquired)
+	assert.Contains(t, err.Error(), "failed to lock workflow 'nightly'")
+
+	close(proceed)
+	require.NoError(t, <-done)
+
+	// The lease is released once the first run is over
+	require.NoError(t, second.Execute(context.Background(), newLockedWorkflow(), nil))
+}
+
+func TestWorkflowLockRefreshedDuringRun(t *testing.T) {
+	provider := lock.NewMemoryProvider()
+	runner := NewRunner(WithLockProvider(provider), WithLockTTL(30*time.Millisecond))
+
+	wf := NewWorkflow("nightly", "Nightly", "")
+	stage := NewStage("work", "Work", "")
+	stage.AddAction(NewTestAction("slow", "", func(ctx *ActionContext) error {
+		time.Sleep(100 * time.Millisecond)
+		_, err := provider.Acquire(context.Background(), "nightly", time.Minute)
+		assert.ErrorIs(t, err, lock.ErrNotAcquired)
+		return ctx.GoContext.Err()
+	}))
+	wf.AddStage(stage)
+
+	require.NoError(t, runner.Execute(context.Background(), wf, nil))
+}
+
+func TestWorkflowLockLostCancelsRun(t *testing.T) {
+	runner := NewRunner(WithLockProvider(losingProvider{}), WithLockTTL(30*time.Millisecond))
+
+	var cause error
+	wf := NewWorkflow("nightly", "Nightly", "")
+	stage := NewStage("work", "Work", "")
+	stage.AddAction(NewTestAction("wait", "", func(ctx *ActionContext) error {
+		<-ctx.GoContext.Done()
+		cause = context.Cause(ctx.GoContext)
+		return ctx.GoContext.Err()
+	}))
+	wf.AddStage(stage)
+
+	require.Error(t, runner.Execute(context.Background(), wf, nil))
+	assert.ErrorIs(t, cause, lock.ErrLeaseLost)
+}
+
+func TestWorkflowLockRetriesFailedRefreshes(t *testing.T) {
+	errUnreachable := errors.New("provider unreachable")
+
+	// A refresh failing once is retried before the lease expires
+	flaky := &flakyProvider{failures: 1, err: errUnreachable}
+	runner := NewRunner(WithLockProvider(flaky), WithLockTTL(30*time.Millisecond))
+	wf := NewWorkflow("nightly", "Nightly", "")
+	stage := NewStage("work", "Work", "")
+	stage.AddAction(NewTestAction("slow", "", func(ctx *ActionContext) error {
+		time.Sleep(100 * time.Millisecond)
+		return ctx.GoContext.Err()
+	}))
+	wf.AddStage(stage)
+	require.NoError(t, runner.Execute(context.Background(), wf, nil))
+	assert.Greater(t, flaky.refreshes(), 1)
+
+	// Refreshes failing until the lease expires cancel the run
+	runner = NewRunner(WithLockProvider(&flakyProvider{failures: -1, err: errUnreachable}), WithLockTTL(30*time.Millisecond))
+	var cause error
+	wf = NewWorkflow("nightly", "Nightly", "")
+	stage = NewStage("work", "Work", "")
+	stage.AddAction(NewTestAction("wait", "", func(ctx *ActionContext) error {
+		<-ctx.GoContext.Done()
+		cause = context.Cause(ctx.GoContext)
+		return ctx.GoContext.Err()
+	}))
+	wf.AddStage(stage)
+	started := time.Now()
+	require.Error(t, runner.Execute(context.Background(), wf, nil))
+	assert.ErrorIs(t, cause, lock.ErrLeaseLost)
+	assert.ErrorIs(t, cause, errUnreachable)
+	assert.GreaterOrEqual(t, time.Since(started), 30*time.Millisecond)
+}
+
+func TestWithLockTTLRejectsShortTTLs(t *testing.T) {
+	assert.Panics(t, func() { WithLockTTL(time.Nanosecond) })
+	assert.Panics(t, func() { WithLockTTL(0) })
+	assert.NotPanics(t, func() { WithLockTTL(MinLockTTL) })
+}
+
+func newLockedWorkflow() *Workflow {
+	wf := NewWorkflow("nightly", "Nightly", "")
+	stage := NewStage("work", "Work", "")
+	stage.AddAction(NewTestAction("noop", "", func(ctx *ActionContext) error { return nil }))
+	wf.AddStage(stage)
+	return wf
+}
+
+// losingProvider grants leases that cannot be refreshed.
+type losingProvider struct{}
+
+func (losingProvider) Acquire(ctx context.Context, key string, ttl time.Duration) (lock.Lease, error) {
+	return losingLease{key: key}, nil
+}
+
+type losingLease struct{ key string }
+
+func (l losingLease) Key() string                                          { return l.key }
+func (l losingLease) Refresh(ctx context.Context, ttl time.Duration) error { return lock.ErrLeaseLost }
+func (l losingLease) Release(ctx context.Context) error                    { return nil }
+
+// flakyProvider grants leases whose first refreshes fail with err, or all of
+// them if failures is negative.
+type flakyProvider struct {
+	mu       sync.Mutex
+	failures int
+	err      error
+	count    int
+}
+
+func (p *flakyProvider) Acquire(ctx context.Context, key string, ttl time.Duration) (lock.Lease, error) {
+	return &flakyLease{provider: p, key: key}, nil
+}
+
+func (p *flakyProvider) refreshes() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.count
+}
+
+type flakyLease struct {
+	provider *flakyProvider
+	key      string
+}
+
+func (l *flakyLease) Key() string { return l.key }
+
+func (l *flakyLease) Refresh(ctx context.Context, ttl time.Duration) error {
+	p := l.provider
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.count++
+	if p.failures < 0 || p.count <= p.failures {
+		return p.err
+	}
+	return nil
+}
+
+func (l *flakyLease) Release(ctx context.Context) error { return nil }
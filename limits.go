@@ -0,0 +1,145 @@
+package gostage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"time"
+)
+
+// childLimitsEnv passes the resource limits of a spawned child process to RunChild.
+const childLimitsEnv = "GOSTAGE_CHILD_LIMITS"
+
+// ResourceLimits constrains the child process that runs a spawned workflow or
+// stage, so that untrusted or resource-hungry actions cannot take down the
+// orchestrating process. Zero fields are not limited.
+//
+// The limits are enforced by the operating system on Linux and macOS. The
+// child applies them to itself as hard limits before running any action, so
+// the actions cannot raise them again.
+type ResourceLimits struct {
+	// CPUTime is the processor time after which the child is killed
+	CPUTime time.Duration `json:"cpuTime,omitempty"`
+	// Memory is the largest address space of the child, in bytes. The child's
+	// garbage collector also aims to stay below it.
+	Memory uint64 `json:"memory,omitempty"`
+	// OpenFiles is the largest number of file descriptors the child can open
+	OpenFiles uint64 `json:"openFiles,omitempty"`
+	// FileSize is the largest file the child can write, in bytes
+	FileSize uint64 `json:"fileSize,omitempty"`
+	// User is the name or numeric ID of the user the child runs as. Switching
+	// users requires the parent to have the privilege to do so.
+	User string `json:"user,omitempty"`
+}
+
+// IsZero reports whether no limit is set.
+func (l ResourceLimits) IsZero() bool {
+	return l == ResourceLimits{}
+}
+
+// Merge combines two sets of limits, keeping the strictest value of each. It
+// fails if both name a different user.
+func (l ResourceLimits) Merge(other ResourceLimits) (ResourceLimits, error) {
+	if l.User != "" && other.User != "" && l.User != other.User {
+		return l, fmt.Errorf("conflicting users '%s' and '%s' in resource limits", l.User, other.User)
+	}
+	if l.User == "" {
+		l.User = other.User
+	}
+	if other.CPUTime > 0 && (l.CPUTime == 0 || other.CPUTime < l.CPUTime) {
+		l.CPUTime = other.CPUTime
+	}
+	l.Memory = minLimit(l.Memory, other.Memory)
+	l.OpenFiles = minLimit(l.OpenFiles, other.OpenFiles)
+	l.FileSize = minLimit(l.FileSize, other.FileSize)
+	return l, nil
+}
+
+// minLimit returns the smallest of two limits, where zero means unlimited.
+func minLimit(a, b uint64) uint64 {
+	if a == 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// WithSpawnLimits sets the resource limits of every child process started by
+// the runner. Stages and actions can tighten them with their own limits.
+func WithSpawnLimits(limits ResourceLimits) RunnerOption {
+	return func(r *Runner) {
+		r.spawnLimits = limits
+	}
+}
+
+// SetResourceLimits sets the limits of the child process running the stage
+// when it is tagged with TagSpawn. They have no effect on stages that run in
+// the runner's process.
+func (s *Stage) SetResourceLimits(limits ResourceLimits) {
+	s.limits = limits
+}
+
+// ResourceLimits returns the limits set with SetResourceLimits.
+func (s *Stage) ResourceLimits() ResourceLimits {
+	return s.limits
+}
+
+// SetResourceLimits sets the limits of the child process running the action.
+// They apply when the action's stage is tagged with TagSpawn, together with
+// the limits of the other actions of the stage.
+func (a *BaseAction) SetResourceLimits(limits ResourceLimits) {
+	a.limits = limits
+}
+
+// ResourceLimits returns the limits set with SetResourceLimits.
+func (a *BaseAction) ResourceLimits() ResourceLimits {
+	return a.limits
+}
+
+// stageLimits combines the runner's spawn limits with those of a stage and of its actions.
+func (r *Runner) stageLimits(s *Stage) (ResourceLimits, error) {
+	limits, err := r.spawnLimits.Merge(s.limits)
+	if err != nil {
+		return limits, fmt.Errorf("stage '%s': %w", s.ID, err)
+	}
+	for _, action := range s.Actions {
+		base := GetActionBaseFields(action)
+		if base == nil {
+			continue
+		}
+		if limits, err = limits.Merge(base.limits); err != nil {
+			return limits, fmt.Errorf("action '%s' in stage '%s': %w", action.Name(), s.ID, err)
+		}
+	}
+	return limits, nil
+}
+
+// limitsEnv returns the environment entry passing limits to a child process.
+func limitsEnv(limits ResourceLimits) (string, error) {
+	data, err := json.Marshal(limits)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode resource limits: %w", err)
+	}
+	return childLimitsEnv + "=" + string(data), nil
+}
+
+// applyChildLimits applies the limits the parent passed to this child process.
+func applyChildLimits() error {
+	value := os.Getenv(childLimitsEnv)
+	if value == "" {
+		return nil
+	}
+	var limits ResourceLimits
+	if err := json.Unmarshal([]byte(value), &limits); err != nil {
+		return fmt.Errorf("failed to decode resource limits: %w", err)
+	}
+
+	if limits.Memory > 0 {
+		// Collect harder before the operating system refuses to allocate
+		debug.SetMemoryLimit(int64(limits.Memory / 10 * 9))
+	}
+	if err := setResourceLimits(limits); err != nil {
+		return fmt.Errorf("failed to apply resource limits: %w", err)
+	}
+	return nil
+}
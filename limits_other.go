@@ -0,0 +1,25 @@
+//go:build !linux && !darwin
+
+package gostage
+
+import (
+	"errors"
+	"os/exec"
+	"runtime"
+)
+
+// errLimitsUnsupported is returned when resource limits are used on a platform that cannot enforce them.
+var errLimitsUnsupported = errors.New("resource limits are not supported on " + runtime.GOOS)
+
+// setResourceLimits fails because the platform cannot enforce limits.
+func setResourceLimits(limits ResourceLimits) error {
+	if limits.CPUTime > 0 || limits.Memory > 0 || limits.OpenFiles > 0 || limits.FileSize > 0 {
+		return errLimitsUnsupported
+	}
+	return nil
+}
+
+// runAsUser fails because the platform cannot switch users.
+func runAsUser(cmd *exec.Cmd, name string) error {
+	return errLimitsUnsupported
+}
@@ -0,0 +1,48 @@
+package gostage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourceLimitsMerge(t *testing.T) {
+	base := ResourceLimits{CPUTime: 10 * time.Second, Memory: 512 << 20, User: "worker"}
+
+	merged, err := base.Merge(ResourceLimits{CPUTime: time.Minute, Memory: 256 << 20, OpenFiles: 128})
+	require.NoError(t, err)
+	assert.Equal(t, ResourceLimits{
+		CPUTime:   10 * time.Second,
+		Memory:    256 << 20,
+		OpenFiles: 128,
+		User:      "worker",
+	}, merged)
+
+	merged, err = ResourceLimits{}.Merge(ResourceLimits{})
+	require.NoError(t, err)
+	assert.True(t, merged.IsZero())
+
+	_, err = base.Merge(ResourceLimits{User: "root"})
+	assert.Error(t, err)
+}
+
+func TestStageLimitsCombineRunnerStageAndActions(t *testing.T) {
+	stage := NewStage("render", "Render", "")
+	stage.SetResourceLimits(ResourceLimits{Memory: 1 << 30})
+	hungry := NewTestAction("hungry", "", func(ctx *ActionContext) error { return nil })
+	hungry.SetResourceLimits(ResourceLimits{CPUTime: 5 * time.Second, OpenFiles: 64})
+	stage.AddAction(hungry)
+	stage.AddAction(NewTestAction("plain", "", func(ctx *ActionContext) error { return nil }))
+
+	runner := NewRunner(WithSpawnLimits(ResourceLimits{CPUTime: time.Minute, Memory: 2 << 30, User: "nobody"}))
+	limits, err := runner.stageLimits(stage)
+	require.NoError(t, err)
+	assert.Equal(t, ResourceLimits{CPUTime: 5 * time.Second, Memory: 1 << 30, OpenFiles: 64, User: "nobody"}, limits)
+
+	hungry.SetResourceLimits(ResourceLimits{User: "root"})
+	_, err = runner.stageLimits(stage)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "action 'hungry' in stage 'render'")
+}
@@ -0,0 +1,62 @@
+//go:build linux || darwin
+
+package gostage
+
+import (
+	"fmt"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// setResourceLimits applies limits to the current process as hard limits.
+func setResourceLimits(limits ResourceLimits) error {
+	set := func(resource int, name string, value uint64) error {
+		if value == 0 {
+			return nil
+		}
+		if err := syscall.Setrlimit(resource, &syscall.Rlimit{Cur: value, Max: value}); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return nil
+	}
+
+	// CPU time is limited in whole seconds, rounded up
+	cpu := uint64((limits.CPUTime + time.Second - 1) / time.Second)
+	if err := set(syscall.RLIMIT_CPU, "cpu time", cpu); err != nil {
+		return err
+	}
+	if err := set(syscall.RLIMIT_AS, "memory", limits.Memory); err != nil {
+		return err
+	}
+	if err := set(syscall.RLIMIT_NOFILE, "open files", limits.OpenFiles); err != nil {
+		return err
+	}
+	return set(syscall.RLIMIT_FSIZE, "file size", limits.FileSize)
+}
+
+// runAsUser makes cmd run as the user named by name, a user name or numeric ID.
+func runAsUser(cmd *exec.Cmd, name string) error {
+	account, err := user.Lookup(name)
+	if err != nil {
+		if account, err = user.LookupId(name); err != nil {
+			return fmt.Errorf("unknown user '%s'", name)
+		}
+	}
+	uid, err := strconv.ParseUint(account.Uid, 10, 32)
+	if err != nil {
+		return fmt.Errorf("user '%s' has a non-numeric ID: %w", name, err)
+	}
+	gid, err := strconv.ParseUint(account.Gid, 10, 32)
+	if err != nil {
+		return fmt.Errorf("user '%s' has a non-numeric group ID: %w", name, err)
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	return nil
+}
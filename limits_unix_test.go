@@ -0,0 +1,50 @@
+//go:build linux || darwin
+
+package gostage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLimitedSpawnWorkflow(t *testing.T, limits ResourceLimits) *Workflow {
+	registerSpawnTestActions()
+
+	wf := NewWorkflow("files", "Files", "")
+	stage := NewStage("open", "Open", "")
+	stage.AddTag(TagSpawn)
+	stage.SetResourceLimits(limits)
+	action, err := NewActionFromRegistry(openFilesActionID)
+	require.NoError(t, err)
+	stage.AddAction(action)
+	wf.AddStage(stage)
+	return wf
+}
+
+func TestSpawnStageResourceLimits(t *testing.T) {
+	result := NewRunner().ExecuteWithOptions(newLimitedSpawnWorkflow(t, ResourceLimits{
+		CPUTime:   10 * time.Second,
+		Memory:    512 << 20,
+		OpenFiles: 256,
+		FileSize:  1 << 20,
+	}), DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, float64(64), result.FinalStore["opened"])
+
+	// The child cannot exceed its limit, and the parent is unaffected
+	result = NewRunner().ExecuteWithOptions(newLimitedSpawnWorkflow(t, ResourceLimits{OpenFiles: 32}), DefaultRunOptions())
+	require.Error(t, result.Error)
+	assert.Contains(t, result.Error.Error(), "too many open files")
+	assert.Equal(t, StatusFailed, result.StageStatuses["open"])
+}
+
+func TestSpawnStageUnknownUser(t *testing.T) {
+	wf := newLimitedSpawnWorkflow(t, ResourceLimits{User: "gostage-no-such-user"})
+
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.Error(t, result.Error)
+	assert.Contains(t, result.Error.Error(), "unknown user 'gostage-no-such-user'")
+}
@@ -0,0 +1,138 @@
+package lock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileProvider is a Provider backed by lock files in a shared directory, for
+// instances running on the same host or sharing a file system.
+type FileProvider struct {
+	dir string
+}
+
+// fileLock is the content of a lock file.
+type fileLock struct {
+	Token   string    `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+// NewFileProvider creates a lock provider keeping its lock files in dir.
+func NewFileProvider(dir string) (*FileProvider, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+	return &FileProvider{dir: dir}, nil
+}
+
+// Acquire implements Provider.Acquire. The lock file is created exclusively;
+// an expired lock file is moved aside first so that only one contender can
+// take it over.
+func (p *FileProvider) Acquire(ctx context.Context, key string, ttl time.Duration) (Lease, error) {
+	path := p.path(key)
+	token := newToken()
+
+	for attempt := 0; attempt < 2; attempt++ {
+		err := writeLockFile(path, fileLock{Token: token, Expires: time.Now().Add(ttl)}, os.O_CREATE|os.O_EXCL|os.O_WRONLY)
+		if err == nil {
+			return &fileLease{path: path, key: key, token: token}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		current, err := readLockFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if err == nil && time.Now().Before(current.Expires) {
+			return nil, ErrNotAcquired
+		}
+
+		// Move the expired lock aside; losing this race means another contender took it
+		stale := fmt.Sprintf("%s.%s.stale", path, token)
+		if err := os.Rename(path, stale); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to take over expired lock: %w", err)
+		}
+		os.Remove(stale)
+	}
+	return nil, ErrNotAcquired
+}
+
+func (p *FileProvider) path(key string) string {
+	return filepath.Join(p.dir, url.PathEscape(key)+".lock")
+}
+
+func readLockFile(path string) (fileLock, error) {
+	var current fileLock
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return current, err
+	}
+	if err := json.Unmarshal(data, &current); err != nil {
+		// A lock file being written by another contender; treat it as held
+		return fileLock{Expires: time.Now().Add(time.Second)}, nil
+	}
+	return current, nil
+}
+
+func writeLockFile(path string, content fileLock, flag int) error {
+	data, err := json.Marshal(content)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, flag, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write lock file: %w", err)
+	}
+	return f.Close()
+}
+
+type fileLease struct {
+	path  string
+	key   string
+	token string
+}
+
+func (l *fileLease) Key() string {
+	return l.key
+}
+
+func (l *fileLease) Refresh(ctx context.Context, ttl time.Duration) error {
+	current, err := readLockFile(l.path)
+	if err != nil || current.Token != l.token {
+		return ErrLeaseLost
+	}
+
+	// Replace the lock file atomically so contenders never read a partial write
+	tmp := fmt.Sprintf("%s.%s.tmp", l.path, l.token)
+	if err := writeLockFile(tmp, fileLock{Token: l.token, Expires: time.Now().Add(ttl)}, os.O_CREATE|os.O_TRUNC|os.O_WRONLY); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to refresh lock: %w", err)
+	}
+	return nil
+}
+
+func (l *fileLease) Release(ctx context.Context) error {
+	current, err := readLockFile(l.path)
+	if err != nil || current.Token != l.token {
+		return nil
+	}
+	if err := os.Remove(l.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to release lock: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+// Package lock provides leases that keep a workflow from running on several
+// runners at once.
+//
+// A Provider grants a Lease on a key for a limited time. The holder refreshes
+// the lease while it works and releases it when done; if the holder dies, the
+// lease expires and another instance can take over:
+//
+//	provider := lock.NewRedisProvider("localhost:6379")
+//	runner := gostage.NewRunner(gostage.WithLockProvider(provider))
+//
+// Leases are identified by a random token, so only their holder can refresh or
+// release them.
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotAcquired is returned when the key is leased by another holder
+	ErrNotAcquired = errors.New("lock is held by another owner")
+	// ErrLeaseLost is returned when a lease expired or was taken over
+	ErrLeaseLost = errors.New("lease lost")
+)
+
+// Provider grants leases on keys.
+type Provider interface {
+	// Acquire leases key for ttl. It returns ErrNotAcquired if the key is
+	// already leased and does not wait for it to become free.
+	Acquire(ctx context.Context, key string, ttl time.Duration) (Lease, error)
+}
+
+// Lease is a time-limited hold on a key.
+type Lease interface {
+	// Key returns the leased key
+	Key() string
+
+	// Refresh extends the lease to ttl from now. It returns ErrLeaseLost if
+	// the lease expired and the key was taken by another holder.
+	Refresh(ctx context.Context, ttl time.Duration) error
+
+	// Release gives up the lease
+	Release(ctx context.Context) error
+}
+
+// newToken returns a random token identifying a lease holder.
+func newToken() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// MemoryProvider is a Provider for runners sharing a process.
+type MemoryProvider struct {
+	mu     sync.Mutex
+	leases map[string]memoryEntry
+}
+
+type memoryEntry struct {
+	token   string
+	expires time.Time
+}
+
+// NewMemoryProvider creates an in-process lock provider.
+func NewMemoryProvider() *MemoryProvider {
+	return &MemoryProvider{leases: make(map[string]memoryEntry)}
+}
+
+// Acquire implements Provider.Acquire.
+func (p *MemoryProvider) Acquire(ctx context.Context, key string, ttl time.Duration) (Lease, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if entry, ok := p.leases[key]; ok && time.Now().Before(entry.expires) {
+		return nil, ErrNotAcquired
+	}
+	token := newToken()
+	p.leases[key] = memoryEntry{token: token, expires: time.Now().Add(ttl)}
+	return &memoryLease{provider: p, key: key, token: token}, nil
+}
+
+type memoryLease struct {
+	provider *MemoryProvider
+	key      string
+	token    string
+}
+
+func (l *memoryLease) Key() string {
+	return l.key
+}
+
+func (l *memoryLease) Refresh(ctx context.Context, ttl time.Duration) error {
+	l.provider.mu.Lock()
+	defer l.provider.mu.Unlock()
+
+	entry, ok := l.provider.leases[l.key]
+	if !ok || entry.token != l.token {
+		return ErrLeaseLost
+	}
+	l.provider.leases[l.key] = memoryEntry{token: l.token, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+func (l *memoryLease) Release(ctx context.Context) error {
+	l.provider.mu.Lock()
+	defer l.provider.mu.Unlock()
+
+	if entry, ok := l.provider.leases[l.key]; ok && entry.token == l.token {
+		delete(l.provider.leases, l.key)
+	}
+	return nil
+}
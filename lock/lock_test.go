@@ -0,0 +1,234 @@
+package lock
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRedis serves the subset of Redis used by RedisProvider.
+type fakeRedis struct {
+	mu       sync.Mutex
+	values   map[string]string
+	expires  map[string]time.Time
+	password string
+	listener net.Listener
+}
+
+func startFakeRedis(t *testing.T, password string) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	f := &fakeRedis{
+		values:   make(map[string]string),
+		expires:  make(map[string]time.Time),
+		password: password,
+		listener: listener,
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) addr() string {
+	return f.listener.Addr().String()
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authenticated := f.password == ""
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		if strings.ToUpper(args[0]) == "AUTH" {
+			if args[1] != f.password {
+				io.WriteString(conn, "-WRONGPASS invalid password\r\n")
+				continue
+			}
+			authenticated = true
+			io.WriteString(conn, "+OK\r\n")
+			continue
+		}
+		if !authenticated {
+			io.WriteString(conn, "-NOAUTH Authentication required.\r\n")
+			continue
+		}
+		io.WriteString(conn, f.handle(args))
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	count, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, count)
+	for i := range args {
+		if _, err := r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+	return args, nil
+}
+
+func (f *fakeRedis) handle(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	get := func(key string) (string, bool) {
+		if exp, ok := f.expires[key]; ok && time.Now().After(exp) {
+			delete(f.values, key)
+			delete(f.expires, key)
+		}
+		value, ok := f.values[key]
+		return value, ok
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "SELECT":
+		return "+OK\r\n"
+	case "SET":
+		if _, ok := get(args[1]); ok {
+			return "$-1\r\n"
+		}
+		ttl, _ := strconv.Atoi(args[4])
+		unit := time.Millisecond
+		if strings.ToUpper(args[3]) == "EX" {
+			unit = time.Second
+		}
+		f.values[args[1]] = args[2]
+		f.expires[args[1]] = time.Now().Add(time.Duration(ttl) * unit)
+		return "+OK\r\n"
+	case "EVAL":
+		key, token := args[3], args[4]
+		if value, ok := get(key); !ok || value != token {
+			return ":0\r\n"
+		}
+		if args[1] == redisRefreshScript {
+			ms, _ := strconv.Atoi(args[5])
+			f.expires[key] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		} else {
+			delete(f.values, key)
+			delete(f.expires, key)
+		}
+		return ":1\r\n"
+	default:
+		return "-ERR unknown command\r\n"
+	}
+}
+
+func providers(t *testing.T) map[string]Provider {
+	files, err := NewFileProvider(t.TempDir())
+	require.NoError(t, err)
+	redis := NewRedisProvider(startFakeRedis(t, "").addr())
+	t.Cleanup(func() { redis.Close() })
+	return map[string]Provider{
+		"memory": NewMemoryProvider(),
+		"file":   files,
+		"redis":  redis,
+	}
+}
+
+func TestProviders(t *testing.T) {
+	ctx := context.Background()
+	for name, provider := range providers(t) {
+		t.Run(name, func(t *testing.T) {
+			lease, err := provider.Acquire(ctx, "billing", time.Minute)
+			require.NoError(t, err)
+			assert.Equal(t, "billing", lease.Key())
+
+			_, err = provider.Acquire(ctx, "billing", time.Minute)
+			assert.ErrorIs(t, err, ErrNotAcquired)
+
+			other, err := provider.Acquire(ctx, "reports", time.Minute)
+			require.NoError(t, err)
+			require.NoError(t, other.Release(ctx))
+
+			require.NoError(t, lease.Refresh(ctx, time.Minute))
+			require.NoError(t, lease.Release(ctx))
+
+			again, err := provider.Acquire(ctx, "billing", time.Minute)
+			require.NoError(t, err)
+			require.NoError(t, again.Release(ctx))
+		})
+	}
+}
+
+func TestProvidersExpiry(t *testing.T) {
+	ctx := context.Background()
+	for name, provider := range providers(t) {
+		t.Run(name, func(t *testing.T) {
+			expired, err := provider.Acquire(ctx, "billing", 20*time.Millisecond)
+			require.NoError(t, err)
+			time.Sleep(50 * time.Millisecond)
+
+			lease, err := provider.Acquire(ctx, "billing", time.Minute)
+			require.NoError(t, err)
+
+			// The previous holder can neither refresh nor release the new lease
+			assert.ErrorIs(t, expired.Refresh(ctx, time.Minute), ErrLeaseLost)
+			require.NoError(t, expired.Release(ctx))
+			_, err = provider.Acquire(ctx, "billing", time.Minute)
+			assert.ErrorIs(t, err, ErrNotAcquired)
+
+			require.NoError(t, lease.Release(ctx))
+		})
+	}
+}
+
+func TestRedisProviderAuth(t *testing.T) {
+	ctx := context.Background()
+	server := startFakeRedis(t, "secret")
+
+	_, err := NewRedisProvider(server.addr()).Acquire(ctx, "billing", time.Minute)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "NOAUTH")
+
+	_, err = NewRedisProvider(server.addr(), WithPassword("wrong")).Acquire(ctx, "billing", time.Minute)
+	require.Error(t, err)
+
+	provider := NewRedisProvider(server.addr(), WithPassword("secret"), WithDB(2), WithKeyPrefix("app:"))
+	lease, err := provider.Acquire(ctx, "billing", time.Minute)
+	require.NoError(t, err)
+	assert.Contains(t, server.values, "app:billing")
+	require.NoError(t, lease.Release(ctx))
+	assert.NotContains(t, server.values, "app:billing")
+}
+
+func TestRedisProviderUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+
+	_, err = NewRedisProvider(addr, WithDialTimeout(time.Second)).Acquire(context.Background(), "billing", time.Minute)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to connect to redis")
+}
@@ -0,0 +1,132 @@
+package lock
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Lua scripts that only touch the key while it still holds the caller's token.
+const (
+	redisReleaseScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+	redisRefreshScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`
+)
+
+// RedisProvider is a Provider backed by Redis, for instances on different hosts.
+// Leases are keys set with SET NX and their TTL, and removed with a compare-and-delete script.
+type RedisProvider struct {
+	client      *redis.Client
+	addr        string
+	password    string
+	db          int
+	prefix      string
+	dialTimeout time.Duration
+}
+
+// RedisOption configures a RedisProvider.
+type RedisOption func(*RedisProvider)
+
+// WithPassword authenticates to Redis with password.
+func WithPassword(password string) RedisOption {
+	return func(p *RedisProvider) {
+		p.password = password
+	}
+}
+
+// WithDB selects the Redis database.
+func WithDB(db int) RedisOption {
+	return func(p *RedisProvider) {
+		p.db = db
+	}
+}
+
+// WithKeyPrefix sets the prefix of the Redis keys. The default is "gostage:lock:".
+func WithKeyPrefix(prefix string) RedisOption {
+	return func(p *RedisProvider) {
+		p.prefix = prefix
+	}
+}
+
+// WithDialTimeout bounds the time to connect to Redis. The default is 5 seconds.
+func WithDialTimeout(timeout time.Duration) RedisOption {
+	return func(p *RedisProvider) {
+		p.dialTimeout = timeout
+	}
+}
+
+// NewRedisProvider creates a lock provider using the Redis server at addr.
+// Connections are pooled by a go-redis client until Close is called.
+func NewRedisProvider(addr string, opts ...RedisOption) *RedisProvider {
+	p := &RedisProvider{
+		addr:        addr,
+		prefix:      "gostage:lock:",
+		dialTimeout: 5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	p.client = redis.NewClient(&redis.Options{
+		Addr:        p.addr,
+		Password:    p.password,
+		DB:          p.db,
+		DialTimeout: p.dialTimeout,
+		Dialer:      p.dial,
+	})
+	return p
+}
+
+// dial connects to the Redis server, naming it in the error.
+func (p *RedisProvider) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: p.dialTimeout}
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	return conn, nil
+}
+
+// Close closes the connections to Redis. Leases still held expire with their TTL.
+func (p *RedisProvider) Close() error {
+	return p.client.Close()
+}
+
+// Acquire implements Provider.Acquire.
+func (p *RedisProvider) Acquire(ctx context.Context, key string, ttl time.Duration) (Lease, error) {
+	token := newToken()
+	acquired, err := p.client.SetNX(ctx, p.prefix+key, token, ttl).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		return nil, ErrNotAcquired
+	}
+	return &redisLease{provider: p, key: key, token: token}, nil
+}
+
+type redisLease struct {
+	provider *RedisProvider
+	key      string
+	token    string
+}
+
+func (l *redisLease) Key() string {
+	return l.key
+}
+
+func (l *redisLease) Refresh(ctx context.Context, ttl time.Duration) error {
+	n, err := l.provider.client.Eval(ctx, redisRefreshScript, []string{l.provider.prefix + l.key}, l.token, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (l *redisLease) Release(ctx context.Context) error {
+	return l.provider.client.Eval(ctx, redisReleaseScript, []string{l.provider.prefix + l.key}, l.token).Err()
+}
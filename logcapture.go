@@ -0,0 +1,129 @@
+package gostage
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Log levels recorded in captured log entries
+const (
+	LogLevelDebug = "debug"
+	LogLevelInfo  = "info"
+	LogLevelWarn  = "warn"
+	LogLevelError = "error"
+)
+
+// LogEntry is a log line captured during a run.
+type LogEntry struct {
+	// Time is when the line was logged
+	Time time.Time `json:"time"`
+	// Level is one of the LogLevel constants
+	Level string `json:"level"`
+	// Message is the formatted message
+	Message string `json:"message"`
+	// Fields holds the structured fields attached to the logger,
+	// including "workflow", "stage" and "action" when known
+	Fields map[string]interface{} `json:"fields,omitempty"`
+}
+
+// ActionLogs returns the captured log entries written while the given action ran.
+func (r RunResult) ActionLogs(stageID, actionName string) []LogEntry {
+	var entries []LogEntry
+	for _, entry := range r.Logs {
+		if entry.Fields["stage"] == stageID && entry.Fields["action"] == actionName {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// logBuffer collects the entries of a single run.
+type logBuffer struct {
+	mu      sync.Mutex
+	entries []LogEntry
+}
+
+func (b *logBuffer) add(entry LogEntry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries = append(b.entries, entry)
+}
+
+func (b *logBuffer) snapshot() []LogEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]LogEntry{}, b.entries...)
+}
+
+// captureLogger records every log line in a buffer and forwards it to the wrapped logger.
+type captureLogger struct {
+	logger Logger
+	buffer *logBuffer
+	fields map[string]interface{}
+}
+
+// newCaptureLogger wraps logger so that its output is also recorded.
+func newCaptureLogger(logger Logger) *captureLogger {
+	return &captureLogger{logger: logger, buffer: &logBuffer{}}
+}
+
+// Debug implements Logger.Debug
+func (l *captureLogger) Debug(format string, args ...interface{}) {
+	l.record(LogLevelDebug, format, args)
+	l.logger.Debug(format, args...)
+}
+
+// Info implements Logger.Info
+func (l *captureLogger) Info(format string, args ...interface{}) {
+	l.record(LogLevelInfo, format, args)
+	l.logger.Info(format, args...)
+}
+
+// Warn implements Logger.Warn
+func (l *captureLogger) Warn(format string, args ...interface{}) {
+	l.record(LogLevelWarn, format, args)
+	l.logger.Warn(format, args...)
+}
+
+// Error implements Logger.Error
+func (l *captureLogger) Error(format string, args ...interface{}) {
+	l.record(LogLevelError, format, args)
+	l.logger.Error(format, args...)
+}
+
+// With implements FieldLogger.With
+func (l *captureLogger) With(args ...interface{}) FieldLogger {
+	fields := make(map[string]interface{}, len(l.fields)+len(args)/2)
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	for i := 0; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			fields["!BADKEY"] = args[i]
+			break
+		}
+		fields[fmt.Sprint(args[i])] = args[i+1]
+	}
+
+	return &captureLogger{
+		logger: LoggerWith(l.logger, args...),
+		buffer: l.buffer,
+		fields: fields,
+	}
+}
+
+func (l *captureLogger) record(level, format string, args []interface{}) {
+	entry := LogEntry{
+		Time:    time.Now(),
+		Level:   level,
+		Message: fmt.Sprintf(format, args...),
+	}
+	if len(l.fields) > 0 {
+		entry.Fields = make(map[string]interface{}, len(l.fields))
+		for k, v := range l.fields {
+			entry.Fields[k] = v
+		}
+	}
+	l.buffer.add(entry)
+}
@@ -0,0 +1,60 @@
+package gostage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCaptureLogs(t *testing.T) {
+	wf := NewWorkflow("captured", "Captured", "")
+	stage := NewStage("build", "Build", "")
+	stage.AddAction(NewTestAction("compile", "", func(ctx *ActionContext) error {
+		ctx.Logger.Info("compiling %d packages", 4)
+		return nil
+	}))
+	stage.AddAction(NewTestAction("link", "", func(ctx *ActionContext) error {
+		LoggerWith(ctx.Logger, "target", "linux").Warn("missing symbols")
+		return errors.New("link failed")
+	}))
+	wf.AddStage(stage)
+
+	forwarded := &recordingLogger{}
+	result := NewRunner().ExecuteWithOptions(wf, RunOptions{
+		Logger:      forwarded,
+		Context:     context.Background(),
+		CaptureLogs: true,
+	})
+	require.False(t, result.Success)
+	require.NotEmpty(t, result.Logs)
+	assert.Len(t, result.Logs, len(forwarded.messages))
+
+	compile := result.ActionLogs("build", "compile")
+	require.Len(t, compile, 1)
+	assert.Equal(t, LogLevelInfo, compile[0].Level)
+	assert.Equal(t, "compiling 4 packages", compile[0].Message)
+	assert.Equal(t, "captured", compile[0].Fields["workflow"])
+
+	link := result.ActionLogs("build", "link")
+	require.Len(t, link, 1)
+	assert.Equal(t, LogLevelWarn, link[0].Level)
+	assert.Equal(t, "linux", link[0].Fields["target"])
+	assert.Contains(t, forwarded.messages, "WARN missing symbols workflow=captured run="+result.RunID+" stage=build action=link target=linux")
+}
+
+func TestLogsNotCapturedByDefault(t *testing.T) {
+	wf := NewWorkflow("quiet", "Quiet", "")
+	stage := NewStage("s", "S", "")
+	stage.AddAction(NewTestAction("a", "", func(ctx *ActionContext) error {
+		ctx.Logger.Info("hello")
+		return nil
+	}))
+	wf.AddStage(stage)
+
+	result := NewRunner().ExecuteWithOptions(wf, RunOptions{Context: context.Background()})
+	require.True(t, result.Success)
+	assert.Nil(t, result.Logs)
+}
@@ -1,5 +1,12 @@
 package gostage
 
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
 // Logger provides a simple interface for workflow logging
 type Logger interface {
 	// Debug logs a message at debug level
@@ -30,7 +37,222 @@ func (l *DefaultLogger) Warn(format string, args ...interface{}) {}
 // Error implements Logger.Error
 func (l *DefaultLogger) Error(format string, args ...interface{}) {}
 
+// With implements FieldLogger.With
+func (l *DefaultLogger) With(args ...interface{}) FieldLogger { return l }
+
 // NewDefaultLogger creates a new default no-op logger
-func NewDefaultLogger() Logger {
+func NewDefaultLogger() FieldLogger {
 	return &DefaultLogger{}
 }
+
+// FieldLogger is a Logger that can carry structured fields.
+// ActionContext.Logger is one, with the workflow ID, stage ID and action name
+// already attached, so actions call ctx.Logger.With("key", value).
+type FieldLogger interface {
+	Logger
+
+	// With returns a logger that adds the given key-value pairs to every message
+	With(args ...interface{}) FieldLogger
+}
+
+// AsFieldLogger returns logger as a FieldLogger. Loggers that do not
+// implement FieldLogger are wrapped to append fields to their messages as
+// key=value pairs.
+func AsFieldLogger(logger Logger) FieldLogger {
+	if fl, ok := logger.(FieldLogger); ok {
+		return fl
+	}
+	return &fieldLogger{logger: logger}
+}
+
+// LoggerWith returns a logger that adds the given key-value pairs to every message.
+// Loggers implementing FieldLogger attach the fields natively; any other logger
+// gets them appended to the message as key=value pairs.
+func LoggerWith(logger Logger, args ...interface{}) FieldLogger {
+	if len(args) == 0 || discardsLogs(logger) {
+		return AsFieldLogger(logger)
+	}
+	if fl, ok := logger.(FieldLogger); ok {
+		return fl.With(args...)
+	}
+	return &fieldLogger{logger: logger, fields: formatFields(args)}
+}
+
+// discardsLogs reports whether logger drops every message, as the default
+// logger does, so that hot paths can skip building messages and fields.
+func discardsLogs(logger Logger) bool {
+	_, ok := logger.(*DefaultLogger)
+	return ok
+}
+
+// fieldLogger appends fields to the messages of a plain Logger.
+type fieldLogger struct {
+	logger Logger
+	fields string
+}
+
+// Debug implements Logger.Debug
+func (l *fieldLogger) Debug(format string, args ...interface{}) {
+	l.logger.Debug("%s", l.message(format, args))
+}
+
+// Info implements Logger.Info
+func (l *fieldLogger) Info(format string, args ...interface{}) {
+	l.logger.Info("%s", l.message(format, args))
+}
+
+// Warn implements Logger.Warn
+func (l *fieldLogger) Warn(format string, args ...interface{}) {
+	l.logger.Warn("%s", l.message(format, args))
+}
+
+// Error implements Logger.Error
+func (l *fieldLogger) Error(format string, args ...interface{}) {
+	l.logger.Error("%s", l.message(format, args))
+}
+
+// With implements FieldLogger.With
+func (l *fieldLogger) With(args ...interface{}) FieldLogger {
+	if len(args) == 0 {
+		return l
+	}
+	if l.fields == "" {
+		return &fieldLogger{logger: l.logger, fields: formatFields(args)}
+	}
+	return &fieldLogger{logger: l.logger, fields: l.fields + " " + formatFields(args)}
+}
+
+func (l *fieldLogger) message(format string, args []interface{}) string {
+	if l.fields == "" {
+		return fmt.Sprintf(format, args...)
+	}
+	return fmt.Sprintf(format, args...) + " " + l.fields
+}
+
+// formatFields renders key-value pairs as "key=value" separated by spaces.
+// A trailing value without a key is rendered under "!BADKEY", as slog does.
+func formatFields(args []interface{}) string {
+	parts := make([]string, 0, (len(args)+1)/2)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			parts = append(parts, fmt.Sprintf("!BADKEY=%v", args[i]))
+			break
+		}
+		parts = append(parts, fmt.Sprintf("%v=%v", args[i], args[i+1]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// logLevelRanks orders the LogLevel constants by severity
+var logLevelRanks = map[string]int{
+	LogLevelDebug: 0,
+	LogLevelInfo:  1,
+	LogLevelWarn:  2,
+	LogLevelError: 3,
+}
+
+// levelLogger drops the messages below a level.
+type levelLogger struct {
+	logger Logger
+	min    int
+}
+
+// filterLogLevel returns a logger dropping the messages of logger below
+// level, one of the LogLevel constants. An empty level keeps every message.
+func filterLogLevel(logger Logger, level string) (Logger, error) {
+	if level == "" {
+		return logger, nil
+	}
+	min, ok := logLevelRanks[strings.ToLower(level)]
+	if !ok {
+		return logger, fmt.Errorf("unknown log level '%s'", level)
+	}
+	if min == 0 || discardsLogs(logger) {
+		return logger, nil
+	}
+	return &levelLogger{logger: logger, min: min}, nil
+}
+
+// Debug implements Logger.Debug
+func (l *levelLogger) Debug(format string, args ...interface{}) {
+	if l.min <= 0 {
+		l.logger.Debug(format, args...)
+	}
+}
+
+// Info implements Logger.Info
+func (l *levelLogger) Info(format string, args ...interface{}) {
+	if l.min <= 1 {
+		l.logger.Info(format, args...)
+	}
+}
+
+// Warn implements Logger.Warn
+func (l *levelLogger) Warn(format string, args ...interface{}) {
+	if l.min <= 2 {
+		l.logger.Warn(format, args...)
+	}
+}
+
+// Error implements Logger.Error
+func (l *levelLogger) Error(format string, args ...interface{}) {
+	l.logger.Error(format, args...)
+}
+
+// With implements FieldLogger.With
+func (l *levelLogger) With(args ...interface{}) FieldLogger {
+	return &levelLogger{logger: LoggerWith(l.logger, args...), min: l.min}
+}
+
+// SlogLogger adapts a *slog.Logger to the Logger interface.
+// Messages are formatted with fmt.Sprintf and fields are passed to slog as attributes.
+type SlogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger creates a Logger backed by the given slog logger.
+// If logger is nil, slog.Default() is used.
+func NewSlogLogger(logger *slog.Logger) *SlogLogger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &SlogLogger{logger: logger}
+}
+
+// Slog returns the underlying slog logger
+func (l *SlogLogger) Slog() *slog.Logger {
+	return l.logger
+}
+
+// Debug implements Logger.Debug
+func (l *SlogLogger) Debug(format string, args ...interface{}) {
+	l.log(slog.LevelDebug, format, args)
+}
+
+// Info implements Logger.Info
+func (l *SlogLogger) Info(format string, args ...interface{}) {
+	l.log(slog.LevelInfo, format, args)
+}
+
+// Warn implements Logger.Warn
+func (l *SlogLogger) Warn(format string, args ...interface{}) {
+	l.log(slog.LevelWarn, format, args)
+}
+
+// Error implements Logger.Error
+func (l *SlogLogger) Error(format string, args ...interface{}) {
+	l.log(slog.LevelError, format, args)
+}
+
+// With implements FieldLogger.With
+func (l *SlogLogger) With(args ...interface{}) FieldLogger {
+	return &SlogLogger{logger: l.logger.With(args...)}
+}
+
+func (l *SlogLogger) log(level slog.Level, format string, args []interface{}) {
+	ctx := context.Background()
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+	l.logger.Log(ctx, level, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,75 @@
+package gostage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingLogger records formatted messages.
+type recordingLogger struct {
+	messages []string
+}
+
+func (l *recordingLogger) Debug(format string, args ...interface{}) { l.record("DEBUG", format, args) }
+func (l *recordingLogger) Info(format string, args ...interface{})  { l.record("INFO", format, args) }
+func (l *recordingLogger) Warn(format string, args ...interface{})  { l.record("WARN", format, args) }
+func (l *recordingLogger) Error(format string, args ...interface{}) { l.record("ERROR", format, args) }
+
+func (l *recordingLogger) record(level, format string, args []interface{}) {
+	l.messages = append(l.messages, level+" "+fmt.Sprintf(format, args...))
+}
+
+func TestLoggerWithPlainLogger(t *testing.T) {
+	base := &recordingLogger{}
+
+	logger := LoggerWith(base, "workflow", "wf", "attempt", 2)
+	logger.Info("hello %s", "world")
+	LoggerWith(logger, "orphan").Warn("100%% done")
+
+	LoggerWith(base).Error("plain")
+	AsFieldLogger(base).With("stage", "build").With("action", "compile").Debug("chained")
+
+	assert.Equal(t, []string{
+		"INFO hello world workflow=wf attempt=2",
+		"WARN 100% done workflow=wf attempt=2 !BADKEY=orphan",
+		"ERROR plain",
+		"DEBUG chained stage=build action=compile",
+	}, base.messages)
+}
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewSlogLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})))
+
+	logger.Debug("hidden")
+	LoggerWith(logger, "stage", "build").Info("compiled %d files", 3)
+
+	assert.NotContains(t, buf.String(), "hidden")
+	assert.Contains(t, buf.String(), `msg="compiled 3 files" stage=build`)
+}
+
+func TestRunnerEnrichesLogs(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewSlogLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	wf := NewWorkflow("enriched", "Enriched", "")
+	stage := NewStage("build", "Build", "")
+	var runID string
+	stage.AddAction(NewTestAction("compile", "", func(ctx *ActionContext) error {
+		runID = ctx.RunID()
+		ctx.Logger.With("files", 3).Info("compiling")
+		return nil
+	}))
+	wf.AddStage(stage)
+
+	require.NoError(t, NewRunner().Execute(context.Background(), wf, logger))
+	require.NotEmpty(t, runID)
+	assert.Contains(t, buf.String(), `"msg":"compiling","workflow":"enriched","run":"`+runID+`","stage":"build","action":"compile","files":3`)
+	assert.Contains(t, buf.String(), `"msg":"Completed stage: Build","workflow":"enriched","run":"`+runID+`"`)
+}
@@ -0,0 +1,143 @@
+package gostage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrLoopLimit is returned by a loop stage that reached its maximum number of
+// iterations or its timeout before its condition was met.
+var ErrLoopLimit = errors.New("loop condition not met")
+
+// LoopOption configures a loop stage.
+type LoopOption func(*loopConfig)
+
+type loopConfig struct {
+	until           PollPredicate
+	maxIterations   int
+	timeout         time.Duration
+	interval        time.Duration
+	continueOnLimit bool
+}
+
+// MaxIterations stops the loop after n iterations.
+func MaxIterations(n int) LoopOption {
+	return func(c *loopConfig) {
+		c.maxIterations = n
+	}
+}
+
+// LoopTimeout stops the loop once timeout elapsed since its first iteration.
+// The timeout is checked between iterations, so a running iteration is not
+// interrupted.
+func LoopTimeout(timeout time.Duration) LoopOption {
+	return func(c *loopConfig) {
+		c.timeout = timeout
+	}
+}
+
+// LoopInterval waits interval between two iterations.
+func LoopInterval(interval time.Duration) LoopOption {
+	return func(c *loopConfig) {
+		c.interval = interval
+	}
+}
+
+// ContinueOnLimit completes the stage when the loop reaches its maximum number
+// of iterations or its timeout, instead of failing with ErrLoopLimit.
+func ContinueOnLimit() LoopOption {
+	return func(c *loopConfig) {
+		c.continueOnLimit = true
+	}
+}
+
+// LoopStage creates a stage repeating its actions until the until predicate
+// is satisfied, as when reconciling a system until it converged. The
+// predicate is evaluated before every iteration, so the actions do not run
+// at all if it is satisfied right away. Without MaxIterations or LoopTimeout
+// the loop only ends with its condition, a failing action or the run being
+// cancelled.
+//
+// ActionContext.Iteration holds the number of the current iteration, starting
+// at zero, and the number of completed iterations when the predicate is
+// evaluated. Actions generated dynamically during an iteration are dropped
+// before the next one. Loops only apply to stages run by the runner itself,
+// not to spawned or remote stages.
+func LoopStage(id, name, description string, until PollPredicate, opts ...LoopOption) *Stage {
+	stage := NewStage(id, name, description)
+	stage.loop = &loopConfig{until: until}
+	for _, opt := range opts {
+		opt(stage.loop)
+	}
+	return stage
+}
+
+// WhileStage creates a loop stage repeating its actions as long as the while
+// predicate is satisfied. It takes the same options as LoopStage.
+func WhileStage(id, name, description string, while PollPredicate, opts ...LoopOption) *Stage {
+	return LoopStage(id, name, description, func(ctx *ActionContext) (bool, error) {
+		ok, err := while(ctx)
+		return !ok, err
+	}, opts...)
+}
+
+// IsLoop reports whether the stage repeats its actions.
+func (s *Stage) IsLoop() bool {
+	return s.loop != nil
+}
+
+// wrap returns a stage runner calling next once per iteration with the
+// actions of the stage as they were before the loop started.
+func (c *loopConfig) wrap(actionCtx *ActionContext, next StageRunnerFunc) StageRunnerFunc {
+	return func(ctx context.Context, stage *Stage, wf *Workflow, logger Logger) error {
+		actions := stage.Actions
+		defer func() { stage.Actions = actions }()
+		clock := actionCtx.Clock()
+		started := clock.Now()
+
+		for iteration := 0; ; iteration++ {
+			actionCtx.Action = nil
+			actionCtx.Iteration = iteration
+			done, err := c.until(actionCtx)
+			if err != nil {
+				return fmt.Errorf("loop condition failed after %d iterations: %w", iteration, err)
+			}
+			if done {
+				logger.Debug("Loop condition met after %d iterations", iteration)
+				return nil
+			}
+
+			var limit error
+			if c.maxIterations > 0 && iteration >= c.maxIterations {
+				limit = fmt.Errorf("%w after %d iterations", ErrLoopLimit, iteration)
+			} else if c.timeout > 0 && clock.Now().Sub(started) >= c.timeout {
+				limit = fmt.Errorf("%w after %s and %d iterations", ErrLoopLimit, c.timeout, iteration)
+			}
+			if limit != nil {
+				if c.continueOnLimit {
+					logger.Warn("Stopping loop: %v", limit)
+					return nil
+				}
+				return limit
+			}
+
+			if iteration > 0 && c.interval > 0 {
+				timer := clock.NewTimer(c.interval)
+				select {
+				case <-timer.C():
+				case <-ctx.Done():
+					timer.Stop()
+					return ctx.Err()
+				}
+			}
+
+			logger.Debug("Starting loop iteration %d", iteration)
+			stage.Actions = actions
+			if err := next(ctx, stage, wf, logger); err != nil {
+				return fmt.Errorf("iteration %d: %w", iteration, err)
+			}
+		}
+	}
+}
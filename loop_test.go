@@ -0,0 +1,120 @@
+package gostage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/davidroman0O/gostage/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runLoop(t *testing.T, ctx context.Context, stage *Stage) RunResult {
+	t.Helper()
+	wf := NewWorkflow("loop", "Loop", "")
+	wf.AddStage(stage)
+	wf.Store.Put("replicas", 0)
+	options := DefaultRunOptions()
+	options.Context = ctx
+	return NewRunner().ExecuteWithOptions(wf, options)
+}
+
+// scaleUp adds a replica and records the iteration it ran in.
+func scaleUp(iterations *[]int) Action {
+	return NewActionFunc("scale-up", "", func(ctx *ActionContext) error {
+		*iterations = append(*iterations, ctx.Iteration)
+		replicas, err := store.Get[int](ctx.Store(), "replicas")
+		if err != nil {
+			return err
+		}
+		return ctx.Store().Put("replicas", replicas+1)
+	})
+}
+
+func replicasAtLeast(n int) PollPredicate {
+	return func(ctx *ActionContext) (bool, error) {
+		replicas, err := store.Get[int](ctx.Store(), "replicas")
+		return replicas >= n, err
+	}
+}
+
+func TestLoopStage(t *testing.T) {
+	var iterations []int
+	var checked []int
+	stage := LoopStage("reconcile", "Reconcile", "", func(ctx *ActionContext) (bool, error) {
+		checked = append(checked, ctx.Iteration)
+		return replicasAtLeast(3)(ctx)
+	})
+	stage.AddAction(scaleUp(&iterations))
+	stage.AddAction(NewActionFunc("add", "", func(ctx *ActionContext) error {
+		ctx.AddDynamicAction(NewActionFunc("dynamic", "", func(ctx *ActionContext) error { return nil }))
+		return nil
+	}))
+	require.True(t, stage.IsLoop())
+
+	result := runLoop(t, context.Background(), stage)
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, 3, result.FinalStore["replicas"])
+	assert.Equal(t, []int{0, 1, 2}, iterations)
+	assert.Equal(t, []int{0, 1, 2, 3}, checked)
+	assert.Len(t, stage.Actions, 2)
+	assert.Equal(t, StatusCompleted, result.StageStatuses["reconcile"])
+}
+
+func TestWhileStage(t *testing.T) {
+	var iterations []int
+	stage := WhileStage("grow", "Grow", "", func(ctx *ActionContext) (bool, error) {
+		ok, err := replicasAtLeast(2)(ctx)
+		return !ok, err
+	}, LoopInterval(10*time.Millisecond))
+	stage.AddAction(scaleUp(&iterations))
+
+	started := time.Now()
+	result := runLoop(t, context.Background(), stage)
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, []int{0, 1}, iterations)
+	assert.GreaterOrEqual(t, time.Since(started), 10*time.Millisecond)
+}
+
+func TestLoopStageLimits(t *testing.T) {
+	var iterations []int
+	stage := LoopStage("reconcile", "Reconcile", "", replicasAtLeast(10), MaxIterations(2))
+	stage.AddAction(scaleUp(&iterations))
+	result := runLoop(t, context.Background(), stage)
+	assert.ErrorIs(t, result.Error, ErrLoopLimit)
+	assert.ErrorContains(t, result.Error, "loop condition not met after 2 iterations")
+
+	stage = LoopStage("reconcile", "Reconcile", "", replicasAtLeast(10), MaxIterations(2), ContinueOnLimit())
+	stage.AddAction(scaleUp(&iterations))
+	result = runLoop(t, context.Background(), stage)
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, 2, result.FinalStore["replicas"])
+
+	stage = LoopStage("reconcile", "Reconcile", "", replicasAtLeast(1000), LoopTimeout(30*time.Millisecond), LoopInterval(5*time.Millisecond))
+	stage.AddAction(scaleUp(&iterations))
+	result = runLoop(t, context.Background(), stage)
+	assert.ErrorIs(t, result.Error, ErrLoopLimit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	stage = LoopStage("reconcile", "Reconcile", "", replicasAtLeast(1000), LoopInterval(time.Second))
+	stage.AddAction(scaleUp(&iterations))
+	started := time.Now()
+	result = runLoop(t, ctx, stage)
+	assert.False(t, result.Success)
+	assert.Less(t, time.Since(started), time.Second)
+}
+
+func TestLoopStageFailingAction(t *testing.T) {
+	stage := LoopStage("reconcile", "Reconcile", "", replicasAtLeast(10))
+	stage.AddAction(NewActionFunc("fail", "", func(ctx *ActionContext) error {
+		if ctx.Iteration == 1 {
+			return assert.AnError
+		}
+		return nil
+	}))
+	result := runLoop(t, context.Background(), stage)
+	assert.ErrorIs(t, result.Error, assert.AnError)
+	assert.ErrorContains(t, result.Error, "iteration 1: action 'fail' failed")
+}
@@ -0,0 +1,156 @@
+package gostage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/davidroman0O/gostage/store"
+)
+
+// Branch is one of the parallel branches a map action fans out to.
+type Branch struct {
+	// Name identifies the branch in logs, errors and outputs
+	Name string
+	// Input is stored under ForEachItemKey in the store of the branch
+	Input interface{}
+	// Actions run in order against the store of the branch
+	Actions []Action
+}
+
+// BranchOutput is the value a branch left under ForEachResultKey, nil if none.
+type BranchOutput struct {
+	Name   string
+	Output interface{}
+}
+
+// BranchFunc generates the branches of a map action when it runs, usually
+// from data in the store.
+type BranchFunc func(ctx *ActionContext) ([]Branch, error)
+
+// ReduceFunc combines the outputs of all branches, in branch order.
+type ReduceFunc func(ctx *ActionContext, outputs []BranchOutput) error
+
+// BranchPerItem generates one branch per item of the []T stored under
+// itemsKey, with the item as input. Branches without a name are named after
+// their index.
+func BranchPerItem[T any](itemsKey string, branch func(index int, item T) Branch) BranchFunc {
+	return func(ctx *ActionContext) ([]Branch, error) {
+		items, err := readItems[T](ctx.Store(), itemsKey)
+		if err != nil {
+			return nil, err
+		}
+		branches := make([]Branch, len(items))
+		for i, item := range items {
+			branches[i] = branch(i, item)
+			if branches[i].Input == nil {
+				branches[i].Input = item
+			}
+		}
+		return branches, nil
+	}
+}
+
+// MapAction runs the branches generated when it executes in parallel and
+// stores their outputs, as a []BranchOutput, for a ReduceAction.
+//
+// Branches run like the items of a ForEachAction: each against its own scope
+// of the workflow store holding its input under ForEachItemKey, and only the
+// value left under ForEachResultKey is kept. All branches run at the same
+// time unless WithParallelism limits them. The first failing branch cancels
+// the others unless CollectErrors is set.
+type MapAction struct {
+	BaseAction
+	branches BranchFunc
+	options  forEachOptions
+}
+
+// NewMapAction creates an action fanning out to the branches generated by
+// branches. Outputs are stored under the name of the action followed by
+// ".results" unless WithResultsKey sets another key.
+func NewMapAction(name string, branches BranchFunc, opts ...ForEachOption) *MapAction {
+	a := &MapAction{
+		BaseAction: NewBaseAction(name, "Runs branches in parallel"),
+		branches:   branches,
+		options:    forEachOptions{resultsKey: name + ".results"},
+	}
+	for _, opt := range opts {
+		opt(&a.options)
+	}
+	return a
+}
+
+// ResultsKey returns the store key the outputs are written to.
+func (a *MapAction) ResultsKey() string {
+	return a.options.resultsKey
+}
+
+func (a *MapAction) Execute(ctx *ActionContext) error {
+	branches, err := a.branches(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to generate branches: %w", err)
+	}
+	for i := range branches {
+		if branches[i].Name == "" {
+			branches[i].Name = fmt.Sprintf("branch-%d", i)
+		}
+	}
+
+	ctx.Logger.Debug("Fanning out to %d branches", len(branches))
+	base := stageCopy(ctx.Workflow)
+	results, err := fanOut(ctx, len(branches), a.options, func(runCtx context.Context, index int) (interface{}, error) {
+		branch := branches[index]
+		result, err := runScoped(runCtx, ctx, base, LoggerWith(ctx.Logger, "branch", branch.Name), index, branch.Input, branch.Actions)
+		if err != nil {
+			return nil, fmt.Errorf("branch '%s' failed: %w", branch.Name, err)
+		}
+		return result, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	outputs := make([]BranchOutput, len(branches))
+	for i, branch := range branches {
+		outputs[i] = BranchOutput{Name: branch.Name, Output: results[i]}
+	}
+	if err := ctx.Store().Put(a.options.resultsKey, outputs); err != nil {
+		return fmt.Errorf("failed to store branch outputs: %w", err)
+	}
+	return nil
+}
+
+// ReduceAction passes the outputs stored by a MapAction to a ReduceFunc.
+type ReduceAction struct {
+	BaseAction
+	outputsKey string
+	reduce     ReduceFunc
+}
+
+// NewReduceAction creates an action reducing the branch outputs stored under
+// outputsKey.
+func NewReduceAction(name, outputsKey string, reduce ReduceFunc) *ReduceAction {
+	return &ReduceAction{
+		BaseAction: NewBaseAction(name, fmt.Sprintf("Reduces the branch outputs of '%s'", outputsKey)),
+		outputsKey: outputsKey,
+		reduce:     reduce,
+	}
+}
+
+func (a *ReduceAction) Execute(ctx *ActionContext) error {
+	outputs, err := store.Get[[]BranchOutput](ctx.Store(), a.outputsKey)
+	if err != nil {
+		return fmt.Errorf("failed to read branch outputs from '%s': %w", a.outputsKey, err)
+	}
+	return a.reduce(ctx, outputs)
+}
+
+// NewMapReduceStage creates a stage with a "map" action fanning out to the
+// branches generated by branches, followed by a "reduce" action receiving all
+// their outputs. The reduce action does not run if a branch failed.
+func NewMapReduceStage(id, name string, branches BranchFunc, reduce ReduceFunc, opts ...ForEachOption) *Stage {
+	stage := NewStage(id, name, "Fans out to parallel branches and reduces their outputs")
+	mapAction := NewMapAction("map", branches, append([]ForEachOption{WithResultsKey(id + ".outputs")}, opts...)...)
+	stage.AddAction(mapAction)
+	stage.AddAction(NewReduceAction("reduce", mapAction.ResultsKey(), reduce))
+	return stage
+}
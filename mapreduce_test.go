@@ -0,0 +1,127 @@
+package gostage
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davidroman0O/gostage/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapReduceStage(t *testing.T) {
+	var mu sync.Mutex
+	running, peak := 0, 0
+	count := NewActionFunc("count", "", func(ctx *ActionContext) error {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+
+		words, err := store.Get[[]string](ctx.Store(), ForEachItemKey)
+		if err != nil {
+			return err
+		}
+		return ctx.Store().Put(ForEachResultKey, len(words))
+	})
+
+	var reduced []BranchOutput
+	stage := NewMapReduceStage("wordcount", "Word count",
+		func(ctx *ActionContext) ([]Branch, error) {
+			documents, err := store.Get[map[string][]string](ctx.Store(), "documents")
+			if err != nil {
+				return nil, err
+			}
+			var branches []Branch
+			for _, name := range []string{"a", "b", "c"} {
+				branches = append(branches, Branch{Name: name, Input: documents[name], Actions: []Action{count}})
+			}
+			return branches, nil
+		},
+		func(ctx *ActionContext, outputs []BranchOutput) error {
+			reduced = outputs
+			total := 0
+			for _, output := range outputs {
+				total += output.Output.(int)
+			}
+			return ctx.Store().Put("total", total)
+		})
+
+	wf := NewWorkflow("wc", "Word count", "")
+	wf.AddStage(stage)
+	wf.Store.Put("documents", map[string][]string{"a": {"x", "y"}, "b": {"z"}, "c": {"x", "y", "z"}})
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+
+	assert.Equal(t, []BranchOutput{{"a", 2}, {"b", 1}, {"c", 3}}, reduced)
+	assert.Equal(t, 6, result.FinalStore["total"])
+	assert.Equal(t, 3, peak)
+	assert.NotContains(t, result.FinalStore, ForEachItemKey)
+}
+
+func TestMapReduceBranchPerItem(t *testing.T) {
+	double := NewActionFunc("double", "", func(ctx *ActionContext) error {
+		n, err := store.Get[int](ctx.Store(), ForEachItemKey)
+		if err != nil {
+			return err
+		}
+		return ctx.Store().Put(ForEachResultKey, n*2)
+	})
+
+	var reduced []BranchOutput
+	stage := NewMapReduceStage("double", "Double",
+		BranchPerItem("numbers", func(index int, n int) Branch {
+			return Branch{Name: fmt.Sprintf("n%d", n), Actions: []Action{double}}
+		}),
+		func(ctx *ActionContext, outputs []BranchOutput) error {
+			reduced = outputs
+			return nil
+		}, WithParallelism(1))
+
+	wf := NewWorkflow("double", "Double", "")
+	wf.AddStage(stage)
+	wf.Store.Put("numbers", []int{1, 2, 3})
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, []BranchOutput{{"n1", 2}, {"n2", 4}, {"n3", 6}}, reduced)
+	assert.Equal(t, reduced, result.FinalStore["double.outputs"])
+}
+
+func TestMapReduceBranchFailure(t *testing.T) {
+	errBoom := errors.New("boom")
+	reduced := false
+	stage := NewMapReduceStage("fail", "Fail",
+		func(ctx *ActionContext) ([]Branch, error) {
+			return []Branch{
+				{Actions: []Action{NewActionFunc("ok", "", func(ctx *ActionContext) error { return nil })}},
+				{Actions: []Action{NewActionFunc("broken", "", func(ctx *ActionContext) error { return errBoom })}},
+			}, nil
+		},
+		func(ctx *ActionContext, outputs []BranchOutput) error {
+			reduced = true
+			return nil
+		}, CollectErrors())
+
+	wf := NewWorkflow("fail", "Fail", "")
+	wf.AddStage(stage)
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.False(t, result.Success)
+	assert.ErrorIs(t, result.Error, errBoom)
+	assert.ErrorContains(t, result.Error, "branch 'branch-1' failed: action 'broken' failed: boom")
+	assert.False(t, reduced)
+
+	generateErr := NewMapReduceStage("generate", "Generate",
+		func(ctx *ActionContext) ([]Branch, error) { return nil, errBoom },
+		func(ctx *ActionContext, outputs []BranchOutput) error { return nil })
+	wf = NewWorkflow("generate", "Generate", "")
+	wf.AddStage(generateErr)
+	result = NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	assert.ErrorContains(t, result.Error, "failed to generate branches: boom")
+}
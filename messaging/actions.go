@@ -0,0 +1,231 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+)
+
+// ErrNoMessage is returned by a consume action when no message arrived in time.
+var ErrNoMessage = errors.New("no message received")
+
+// MessageAction publishes or consumes messages through a broker.
+type MessageAction struct {
+	gostage.BaseAction
+
+	broker  Broker
+	subject string
+	body    string
+	key     string
+	headers map[string]string
+	group   string
+	timeout time.Duration
+	count   int
+	consume bool
+}
+
+// ActionOption configures a MessageAction.
+type ActionOption func(*MessageAction)
+
+// WithHeader adds a header to published messages. The value is rendered as a template.
+func WithHeader(key, value string) ActionOption {
+	return func(a *MessageAction) {
+		a.headers[key] = value
+	}
+}
+
+// WithConsumerGroup makes a consume action share the messages of its subject
+// with the other members of group.
+func WithConsumerGroup(group string) ActionOption {
+	return func(a *MessageAction) {
+		a.group = group
+	}
+}
+
+// WithTimeout bounds how long the action may take. A consume action that
+// times out fails with ErrNoMessage.
+func WithTimeout(timeout time.Duration) ActionOption {
+	return func(a *MessageAction) {
+		a.timeout = timeout
+	}
+}
+
+// WithCount makes a consume action wait for count messages and store them as
+// a list instead of a single message.
+func WithCount(count int) ActionOption {
+	return func(a *MessageAction) {
+		a.count = count
+	}
+}
+
+// Publish creates an action publishing body on subject. Both are rendered as
+// templates, as are header values.
+func Publish(name string, broker Broker, subject, body string, opts ...ActionOption) *MessageAction {
+	return newMessageAction(name, "Publishes on "+subject, broker, subject, opts, func(a *MessageAction) {
+		a.body = body
+	})
+}
+
+// Consume creates an action subscribing to subject and storing the next
+// message under key, in the form returned by Message.StoreValue. The subject
+// is rendered as a template. Only messages published after the action starts
+// are received.
+func Consume(name string, broker Broker, subject, key string, opts ...ActionOption) *MessageAction {
+	return newMessageAction(name, "Consumes from "+subject, broker, subject, opts, func(a *MessageAction) {
+		a.key = key
+		a.consume = true
+	})
+}
+
+func newMessageAction(name, description string, broker Broker, subject string, opts []ActionOption, init func(*MessageAction)) *MessageAction {
+	a := &MessageAction{
+		BaseAction: gostage.NewBaseAction(name, description),
+		broker:     broker,
+		subject:    subject,
+		headers:    make(map[string]string),
+	}
+	init(a)
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Execute publishes or consumes the message.
+func (a *MessageAction) Execute(ctx *gostage.ActionContext) error {
+	subject, err := ctx.Render(a.subject)
+	if err != nil {
+		return fmt.Errorf("failed to render subject: %w", err)
+	}
+
+	parent := ctx.GoContext
+	if parent == nil {
+		parent = context.Background()
+	}
+	runCtx := parent
+	if a.timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(parent, a.timeout)
+		defer cancel()
+	}
+
+	if a.consume {
+		return a.receive(ctx, parent, runCtx, subject)
+	}
+	return a.send(ctx, runCtx, subject)
+}
+
+// send renders and publishes the message.
+func (a *MessageAction) send(ctx *gostage.ActionContext, runCtx context.Context, subject string) error {
+	body, err := ctx.Render(a.body)
+	if err != nil {
+		return fmt.Errorf("failed to render message: %w", err)
+	}
+	msg := Message{Subject: subject, Data: []byte(body)}
+	if len(a.headers) > 0 {
+		msg.Headers = make(map[string]string, len(a.headers))
+		for key, value := range a.headers {
+			if msg.Headers[key], err = ctx.Render(value); err != nil {
+				return fmt.Errorf("failed to render header %s: %w", key, err)
+			}
+		}
+	}
+
+	ctx.Logger.Debug("Publishing %d bytes on %s", len(msg.Data), subject)
+	return a.broker.Publish(runCtx, msg)
+}
+
+// receive waits for the messages to consume and stores them.
+func (a *MessageAction) receive(ctx *gostage.ActionContext, parent, runCtx context.Context, subject string) error {
+	sub, err := a.broker.Subscribe(runCtx, subject, a.group)
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	count := max(a.count, 1)
+	messages := make([]interface{}, 0, count)
+	for len(messages) < count {
+		msg, err := sub.Next(runCtx)
+		if err != nil {
+			if a.timeout > 0 && errors.Is(err, context.DeadlineExceeded) && parent.Err() == nil {
+				return fmt.Errorf("%w on '%s' within %s", ErrNoMessage, subject, a.timeout)
+			}
+			return fmt.Errorf("failed to consume from '%s': %w", subject, err)
+		}
+		ctx.Logger.Debug("Received %d bytes on %s", len(msg.Data), msg.Subject)
+		messages = append(messages, msg.StoreValue())
+	}
+
+	if a.count > 0 {
+		return ctx.Store().Put(a.key, messages)
+	}
+	return ctx.Store().Put(a.key, messages[0])
+}
+
+// Action IDs under which Register adds the messaging actions to a registry.
+const (
+	PublishID = "messaging.publish"
+	ConsumeID = "messaging.consume"
+)
+
+// Params configure the messaging actions in a workflow definition. Both
+// actions use the broker given to Register.
+// Publish sends body with headers on subject. Consume stores the messages of
+// subject under key.
+type Params struct {
+	Subject string            `json:"subject"`
+	Body    string            `json:"body,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Key     string            `json:"key,omitempty"`
+	Group   string            `json:"group,omitempty"`
+	Count   int               `json:"count,omitempty"`
+	// Timeout is a duration such as "30s"
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// Register adds the messaging actions to registry, bound to broker, so that
+// declarative definitions can use them.
+func Register(registry *gostage.ActionRegistry, broker Broker) error {
+	options := func(p Params) ([]ActionOption, error) {
+		if p.Subject == "" {
+			return nil, errors.New("the subject parameter is required")
+		}
+		var opts []ActionOption
+		if p.Timeout != "" {
+			timeout, err := time.ParseDuration(p.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timeout: %w", err)
+			}
+			opts = append(opts, WithTimeout(timeout))
+		}
+		return opts, nil
+	}
+
+	return errors.Join(
+		gostage.RegisterTyped(registry, PublishID, func(p Params) (gostage.Action, error) {
+			opts, err := options(p)
+			if err != nil {
+				return nil, err
+			}
+			for key, value := range p.Headers {
+				opts = append(opts, WithHeader(key, value))
+			}
+			return Publish(PublishID, broker, p.Subject, p.Body, opts...), nil
+		}),
+		gostage.RegisterTyped(registry, ConsumeID, func(p Params) (gostage.Action, error) {
+			opts, err := options(p)
+			if err != nil {
+				return nil, err
+			}
+			if p.Key == "" {
+				return nil, errors.New("the key parameter is required")
+			}
+			opts = append(opts, WithConsumerGroup(p.Group), WithCount(p.Count))
+			return Consume(ConsumeID, broker, p.Subject, p.Key, opts...), nil
+		}),
+	)
+}
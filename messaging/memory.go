@@ -0,0 +1,188 @@
+package messaging
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryBroker is a Broker delivering messages within the process. Messages
+// published while nobody subscribes to their subject are dropped, as with NATS.
+type MemoryBroker struct {
+	mu     sync.Mutex
+	subs   []*memorySubscription
+	next   map[string]int
+	closed bool
+}
+
+// NewMemoryBroker creates an in-memory broker.
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{next: make(map[string]int)}
+}
+
+// Publish implements Broker.Publish.
+func (b *MemoryBroker) Publish(ctx context.Context, msg Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+
+	groups := make(map[string][]*memorySubscription)
+	var order []string
+	for _, sub := range b.subs {
+		if !MatchSubject(sub.subject, msg.Subject) {
+			continue
+		}
+		if sub.group == "" {
+			sub.push(msg)
+			continue
+		}
+		key := sub.subject + "\x00" + sub.group
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], sub)
+	}
+
+	// Each group receives the message once, on its members in turn
+	for _, key := range order {
+		members := groups[key]
+		members[b.next[key]%len(members)].push(msg)
+		b.next[key]++
+	}
+	return nil
+}
+
+// Subscribe implements Broker.Subscribe.
+func (b *MemoryBroker) Subscribe(ctx context.Context, subject, group string) (Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+	sub := &memorySubscription{
+		broker:  b,
+		subject: subject,
+		group:   group,
+		queue:   newQueue(),
+	}
+	b.subs = append(b.subs, sub)
+	return sub, nil
+}
+
+// Close closes every subscription and refuses further use of the broker.
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	subs := b.subs
+	b.subs = nil
+	b.closed = true
+	b.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.queue.stop()
+	}
+	return nil
+}
+
+// remove drops a subscription from the broker.
+func (b *MemoryBroker) remove(sub *memorySubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, s := range b.subs {
+		if s == sub {
+			b.subs = append(b.subs[:i], b.subs[i+1:]...)
+			return
+		}
+	}
+}
+
+// memorySubscription is a subscription to a MemoryBroker.
+type memorySubscription struct {
+	broker  *MemoryBroker
+	subject string
+	group   string
+	*queue
+}
+
+func (s *memorySubscription) Close() error {
+	s.broker.remove(s)
+	s.queue.stop()
+	return nil
+}
+
+// queue buffers the messages of a subscription without bounds, so that a slow
+// consumer never blocks the delivery to others.
+type queue struct {
+	mu       sync.Mutex
+	messages []Message
+	err      error
+	ready    chan struct{}
+}
+
+func newQueue() *queue {
+	return &queue{ready: make(chan struct{}, 1)}
+}
+
+// push appends a message, unless the queue is closed.
+func (q *queue) push(msg Message) {
+	q.mu.Lock()
+	if q.err == nil {
+		q.messages = append(q.messages, msg)
+	}
+	q.mu.Unlock()
+	q.signal()
+}
+
+// close makes Next return err once the buffered messages are consumed.
+func (q *queue) close(err error) {
+	q.mu.Lock()
+	if q.err == nil {
+		q.err = err
+	}
+	q.mu.Unlock()
+	q.signal()
+}
+
+// stop drops the buffered messages and makes Next return ErrClosed.
+func (q *queue) stop() {
+	q.mu.Lock()
+	q.messages = nil
+	q.mu.Unlock()
+	q.close(ErrClosed)
+}
+
+func (q *queue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Next returns the next buffered message, waiting for one if needed.
+func (q *queue) Next(ctx context.Context) (Message, error) {
+	for {
+		q.mu.Lock()
+		if len(q.messages) > 0 {
+			msg := q.messages[0]
+			q.messages = q.messages[1:]
+			if len(q.messages) > 0 {
+				q.signal()
+			}
+			q.mu.Unlock()
+			return msg, nil
+		}
+		err := q.err
+		q.mu.Unlock()
+		if err != nil {
+			return Message{}, err
+		}
+
+		select {
+		case <-q.ready:
+		case <-ctx.Done():
+			return Message{}, ctx.Err()
+		}
+	}
+}
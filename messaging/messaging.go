@@ -0,0 +1,102 @@
+// Package messaging connects workflows to message brokers: actions publish and
+// consume messages, and triggers start a workflow whenever a message arrives on
+// a subject.
+//
+// Brokers implement the small Broker interface. The package ships a NATS broker
+// built on nats.go and an in-memory broker for tests and single-process use;
+// Kafka and other systems plug in by adapting their client to Broker, with
+// topics as subjects and consumer groups as groups:
+//
+//	broker := messaging.NewNATS("nats://localhost:4222")
+//	defer broker.Close()
+//
+//	stage.AddAction(messaging.Publish("announce", broker, "builds.{{ .store.project }}",
+//		`{"version":"{{ .store.version }}"}`))
+//
+//	triggers := messaging.NewTriggers(runner, broker)
+//	triggers.On("deploy", "builds.*", newDeployWorkflow, messaging.WithGroup("deployers"))
+//	triggers.Start(ctx)
+//	defer triggers.Stop()
+//
+// The triggered workflow finds the message in its initial store under
+// "message", so "{{ .store.message.data.version }}" renders a field of a JSON
+// payload.
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ErrClosed is returned by subscriptions and brokers that were closed.
+var ErrClosed = errors.New("messaging: closed")
+
+// Message is a message published on a subject.
+type Message struct {
+	// Subject is the subject, or topic, the message was published on
+	Subject string
+	// Data is the payload of the message
+	Data []byte
+	// Headers holds optional metadata, for brokers that support it
+	Headers map[string]string
+}
+
+// Value returns the payload decoded from JSON, or as a string when it is not JSON.
+func (m Message) Value() interface{} {
+	var value interface{}
+	if err := json.Unmarshal(m.Data, &value); err == nil {
+		return value
+	}
+	return string(m.Data)
+}
+
+// StoreValue returns the message as it is written to workflow stores: a map
+// holding the subject, the decoded payload under "data" and the headers.
+func (m Message) StoreValue() map[string]interface{} {
+	headers := make(map[string]interface{}, len(m.Headers))
+	for key, value := range m.Headers {
+		headers[key] = value
+	}
+	return map[string]interface{}{
+		"subject": m.Subject,
+		"data":    m.Value(),
+		"headers": headers,
+	}
+}
+
+// Broker publishes messages and subscribes to subjects.
+type Broker interface {
+	// Publish sends a message on its subject.
+	Publish(ctx context.Context, msg Message) error
+	// Subscribe starts receiving the messages published on subject, which may
+	// contain the broker's wildcards. Subscriptions sharing a non-empty group
+	// split the messages between them instead of each receiving all of them.
+	Subscribe(ctx context.Context, subject, group string) (Subscription, error)
+}
+
+// Subscription receives the messages of a subject.
+type Subscription interface {
+	// Next returns the next message, waiting until one arrives or ctx is done.
+	Next(ctx context.Context) (Message, error)
+	// Close stops the subscription. Next returns ErrClosed afterwards.
+	Close() error
+}
+
+// MatchSubject reports whether subject matches pattern, using the NATS
+// wildcards: "*" matches one token and a final ">" matches one or more tokens.
+// Tokens are separated by dots.
+func MatchSubject(pattern, subject string) bool {
+	patterns := strings.Split(pattern, ".")
+	tokens := strings.Split(subject, ".")
+	for i, p := range patterns {
+		if p == ">" && i == len(patterns)-1 {
+			return len(tokens) > i
+		}
+		if i >= len(tokens) || (p != "*" && p != tokens[i]) {
+			return false
+		}
+	}
+	return len(tokens) == len(patterns)
+}
@@ -0,0 +1,194 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/davidroman0O/gostage/gostagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// publishUntil publishes msg repeatedly until done is closed, for consumers
+// that only receive messages published after they subscribed.
+func publishUntil(t *testing.T, broker Broker, msg Message, done <-chan struct{}) {
+	t.Helper()
+	go func() {
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				broker.Publish(context.Background(), msg)
+			}
+		}
+	}()
+}
+
+func TestMatchSubject(t *testing.T) {
+	tests := []struct {
+		pattern, subject string
+		match            bool
+	}{
+		{"builds.api", "builds.api", true},
+		{"builds.api", "builds.web", false},
+		{"builds.*", "builds.api", true},
+		{"builds.*", "builds.api.v2", false},
+		{"builds.>", "builds.api.v2", true},
+		{"builds.>", "builds", false},
+		{"*.api", "builds.api", true},
+		{"builds", "builds.api", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.match, MatchSubject(tt.pattern, tt.subject), "%s against %s", tt.subject, tt.pattern)
+	}
+}
+
+func TestMessageStoreValue(t *testing.T) {
+	msg := Message{Subject: "builds", Data: []byte(`{"version":"v1"}`), Headers: map[string]string{"Trace": "abc"}}
+	assert.Equal(t, map[string]interface{}{
+		"subject": "builds",
+		"data":    map[string]interface{}{"version": "v1"},
+		"headers": map[string]interface{}{"Trace": "abc"},
+	}, msg.StoreValue())
+
+	assert.Equal(t, "plain text", Message{Data: []byte("plain text")}.Value())
+}
+
+func TestMemoryBrokerGroups(t *testing.T) {
+	broker := NewMemoryBroker()
+	ctx := context.Background()
+
+	all, err := broker.Subscribe(ctx, "jobs.*", "")
+	require.NoError(t, err)
+	first, err := broker.Subscribe(ctx, "jobs.*", "workers")
+	require.NoError(t, err)
+	second, err := broker.Subscribe(ctx, "jobs.*", "workers")
+	require.NoError(t, err)
+
+	for _, subject := range []string{"jobs.a", "jobs.b", "other"} {
+		require.NoError(t, broker.Publish(ctx, Message{Subject: subject}))
+	}
+
+	next := func(sub Subscription) string {
+		ctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		msg, err := sub.Next(ctx)
+		require.NoError(t, err)
+		return msg.Subject
+	}
+	assert.Equal(t, "jobs.a", next(all))
+	assert.Equal(t, "jobs.b", next(all))
+	assert.Equal(t, "jobs.a", next(first))
+	assert.Equal(t, "jobs.b", next(second))
+
+	require.NoError(t, first.Close())
+	_, err = first.Next(ctx)
+	assert.ErrorIs(t, err, ErrClosed)
+
+	require.NoError(t, broker.Close())
+	_, err = all.Next(ctx)
+	assert.ErrorIs(t, err, ErrClosed)
+	assert.ErrorIs(t, broker.Publish(ctx, Message{Subject: "jobs.a"}), ErrClosed)
+}
+
+func TestPublishAndConsumeActions(t *testing.T) {
+	broker := NewMemoryBroker()
+	received, err := broker.Subscribe(context.Background(), "builds.>", "")
+	require.NoError(t, err)
+
+	result := gostagetest.RunActions(t, map[string]interface{}{"project": "api", "version": "v1.4.0"},
+		Publish("announce", broker, "builds.{{ .store.project }}", `{"version":"{{ .store.version }}"}`,
+			WithHeader("Workflow", "{{ .run.WorkflowID }}")),
+	)
+	require.True(t, result.Success, "%v", result.Error)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, err := received.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "builds.api", msg.Subject)
+	assert.JSONEq(t, `{"version":"v1.4.0"}`, string(msg.Data))
+	assert.Equal(t, map[string]string{"Workflow": "test"}, msg.Headers)
+
+	done := make(chan struct{})
+	defer close(done)
+	publishUntil(t, broker, Message{Subject: "approvals.api", Data: []byte(`{"approved":true}`)}, done)
+
+	result = gostagetest.RunActions(t, map[string]interface{}{"project": "api"},
+		Consume("single", broker, "approvals.{{ .store.project }}", "approval", WithTimeout(5*time.Second)),
+		Consume("batch", broker, "approvals.*", "approvals", WithCount(2), WithTimeout(5*time.Second)),
+	)
+	require.True(t, result.Success, "%v", result.Error)
+	approval := result.FinalStore["approval"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"approved": true}, approval["data"])
+	assert.Len(t, result.FinalStore["approvals"], 2)
+}
+
+func TestConsumeTimeout(t *testing.T) {
+	broker := NewMemoryBroker()
+
+	started := time.Now()
+	result := gostagetest.RunActions(t, nil, Consume("wait", broker, "silence", "msg", WithTimeout(50*time.Millisecond)))
+	assert.ErrorIs(t, result.Error, ErrNoMessage)
+	assert.Less(t, time.Since(started), 5*time.Second)
+}
+
+func TestRegisteredMessageActions(t *testing.T) {
+	broker := NewMemoryBroker()
+	registry := gostage.NewActionRegistry()
+	require.NoError(t, Register(registry, broker))
+
+	received, err := broker.Subscribe(context.Background(), "out", "")
+	require.NoError(t, err)
+	done := make(chan struct{})
+	defer close(done)
+	publishUntil(t, broker, Message{Subject: "in", Data: []byte("ping")}, done)
+
+	def := &gostage.SubWorkflowDef{
+		ID:           "defined",
+		InitialStore: map[string]interface{}{"reply": "pong"},
+		Stages: []gostage.StageDef{{
+			ID: "run",
+			Actions: []gostage.ActionDef{
+				{ID: ConsumeID, Params: map[string]interface{}{"subject": "in", "key": "request", "timeout": "5s"}},
+				{ID: PublishID, Params: map[string]interface{}{
+					"subject": "out",
+					"body":    "{{ .store.request.data }} {{ .store.reply }}",
+					"headers": map[string]interface{}{"Kind": "reply"},
+				}},
+			},
+		}},
+	}
+	wf, err := gostage.NewWorkflowFromDefWithRegistry(def, registry)
+	require.NoError(t, err)
+	result := gostage.NewRunner().ExecuteWithOptions(wf, gostage.DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, err := received.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "ping pong", string(msg.Data))
+	assert.Equal(t, "reply", msg.Headers["Kind"])
+
+	_, err = registry.Resolve(PublishID, map[string]interface{}{"body": "x"})
+	assert.ErrorContains(t, err, "the subject parameter is required")
+	_, err = registry.Resolve(ConsumeID, map[string]interface{}{"subject": "in"})
+	assert.ErrorContains(t, err, "the key parameter is required")
+	_, err = registry.Resolve(ConsumeID, map[string]interface{}{"subject": "in", "key": "k", "timeout": "soon"})
+	assert.ErrorContains(t, err, "invalid timeout")
+}
+
+func TestPublishFailure(t *testing.T) {
+	broker := NewMemoryBroker()
+	require.NoError(t, broker.Close())
+
+	result := gostagetest.RunActions(t, nil, Publish("announce", broker, "builds", "{}"))
+	assert.True(t, errors.Is(result.Error, ErrClosed), "%v", result.Error)
+}
@@ -0,0 +1,283 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATS is a Broker backed by a nats.go connection to a single server.
+// It connects on first use and reconnects on the next use after losing the
+// connection; subscriptions do not survive a lost connection, their Next
+// returns an error instead so that callers can subscribe again.
+type NATS struct {
+	addr        string
+	user        string
+	password    string
+	token       string
+	name        string
+	dialTimeout time.Duration
+
+	mu     sync.Mutex
+	conn   *nats.Conn
+	subs   map[*natsSubscription]bool
+	closed bool
+}
+
+// NATSOption configures a NATS broker.
+type NATSOption func(*NATS)
+
+// WithNATSUser authenticates with a user name and password. Credentials in
+// the server URL take precedence.
+func WithNATSUser(user, password string) NATSOption {
+	return func(n *NATS) {
+		n.user = user
+		n.password = password
+	}
+}
+
+// WithNATSToken authenticates with a token.
+func WithNATSToken(token string) NATSOption {
+	return func(n *NATS) {
+		n.token = token
+	}
+}
+
+// WithNATSName sets the client name shown in the server's monitoring.
+func WithNATSName(name string) NATSOption {
+	return func(n *NATS) {
+		n.name = name
+	}
+}
+
+// WithNATSDialTimeout bounds the time to connect to the server. The default is 5 seconds.
+func WithNATSDialTimeout(timeout time.Duration) NATSOption {
+	return func(n *NATS) {
+		n.dialTimeout = timeout
+	}
+}
+
+// NewNATS creates a broker for the NATS server at addr, given as "host:port"
+// or as a "nats://[user:password@]host:port" URL.
+func NewNATS(addr string, opts ...NATSOption) *NATS {
+	n := &NATS{
+		addr:        addr,
+		name:        "gostage",
+		dialTimeout: 5 * time.Second,
+		subs:        make(map[*natsSubscription]bool),
+	}
+	for _, opt := range opts {
+		opt(n)
+	}
+	return n
+}
+
+// Publish implements Broker.Publish. It returns once the server has processed
+// the message, so that permission errors are reported.
+func (n *NATS) Publish(ctx context.Context, msg Message) error {
+	if err := checkSubject(msg.Subject); err != nil {
+		return err
+	}
+	if err := n.publish(ctx, msg); err != nil {
+		return fmt.Errorf("failed to publish on '%s': %w", msg.Subject, err)
+	}
+	return nil
+}
+
+func (n *NATS) publish(ctx context.Context, msg Message) error {
+	conn, err := n.connect()
+	if err != nil {
+		return err
+	}
+
+	out := nats.NewMsg(msg.Subject)
+	out.Data = msg.Data
+	for key, value := range msg.Headers {
+		out.Header.Set(key, value)
+	}
+	// The server reports a rejected message with an asynchronous error, which
+	// the connection records before the reply to the flush.
+	before := conn.LastError()
+	if err := conn.PublishMsg(out); err != nil {
+		return err
+	}
+	if err := conn.FlushWithContext(ctx); err != nil {
+		return err
+	}
+	if err := conn.LastError(); err != nil && err != before {
+		return err
+	}
+	return nil
+}
+
+// Subscribe implements Broker.Subscribe. Groups are NATS queue groups.
+func (n *NATS) Subscribe(ctx context.Context, subject, group string) (Subscription, error) {
+	if err := checkSubject(subject); err != nil {
+		return nil, err
+	}
+	sub, err := n.subscribe(ctx, subject, group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to '%s': %w", subject, err)
+	}
+	return sub, nil
+}
+
+func (n *NATS) subscribe(ctx context.Context, subject, group string) (*natsSubscription, error) {
+	conn, err := n.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	sub := &natsSubscription{nats: n, queue: newQueue()}
+	handler := func(msg *nats.Msg) {
+		sub.queue.push(natsMessage(msg))
+	}
+	if group == "" {
+		sub.sub, err = conn.Subscribe(subject, handler)
+	} else {
+		sub.sub, err = conn.QueueSubscribe(subject, group, handler)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	n.mu.Lock()
+	if n.conn != conn {
+		n.mu.Unlock()
+		sub.queue.stop()
+		return nil, fmt.Errorf("NATS connection lost: %w", nats.ErrConnectionClosed)
+	}
+	n.subs[sub] = true
+	n.mu.Unlock()
+
+	// Wait for the server to register the subscription, so that messages
+	// published once Subscribe returns are delivered
+	if err := conn.FlushWithContext(ctx); err != nil {
+		sub.Close()
+		return nil, err
+	}
+	return sub, nil
+}
+
+// Close closes the connection and every subscription.
+func (n *NATS) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.closed = true
+	for sub := range n.subs {
+		sub.queue.stop()
+		delete(n.subs, sub)
+	}
+	if n.conn != nil {
+		n.conn.Close()
+		n.conn = nil
+	}
+	return nil
+}
+
+// connect returns the current connection, establishing it if needed.
+func (n *NATS) connect() (*nats.Conn, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.closed {
+		return nil, ErrClosed
+	}
+	if n.conn != nil && !n.conn.IsClosed() {
+		return n.conn, nil
+	}
+
+	opts := []nats.Option{
+		nats.Name(n.name),
+		nats.Timeout(n.dialTimeout),
+		nats.NoReconnect(),
+		nats.ClosedHandler(n.lost),
+		// Errors are reported by the calls that cause them
+		nats.ErrorHandler(func(*nats.Conn, *nats.Subscription, error) {}),
+	}
+	if n.user != "" {
+		opts = append(opts, nats.UserInfo(n.user, n.password))
+	}
+	if n.token != "" {
+		opts = append(opts, nats.Token(n.token))
+	}
+	conn, err := nats.Connect(n.addr, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	n.conn = conn
+	return conn, nil
+}
+
+// lost drops a closed connection, ending its subscriptions with the error
+// that closed it. Connections closed by Close have already been dropped.
+func (n *NATS) lost(conn *nats.Conn) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.conn != conn {
+		return
+	}
+	n.conn = nil
+
+	err := conn.LastError()
+	if err == nil {
+		err = nats.ErrConnectionClosed
+	}
+	lost := fmt.Errorf("NATS connection lost: %w", err)
+	for sub := range n.subs {
+		sub.queue.close(lost)
+		delete(n.subs, sub)
+	}
+}
+
+// natsSubscription is a subscription to a NATS subject.
+type natsSubscription struct {
+	nats *NATS
+	sub  *nats.Subscription
+	*queue
+}
+
+func (s *natsSubscription) Close() error {
+	n := s.nats
+	n.mu.Lock()
+	_, active := n.subs[s]
+	delete(n.subs, s)
+	n.mu.Unlock()
+
+	s.queue.stop()
+	if !active {
+		return nil
+	}
+	if err := s.sub.Unsubscribe(); err != nil && !errors.Is(err, nats.ErrConnectionClosed) {
+		return err
+	}
+	return nil
+}
+
+// natsMessage converts a received message, keeping the first value of each header.
+func natsMessage(msg *nats.Msg) Message {
+	out := Message{Subject: msg.Subject, Data: msg.Data}
+	if len(msg.Header) > 0 {
+		out.Headers = make(map[string]string, len(msg.Header))
+		for key, values := range msg.Header {
+			if len(values) > 0 {
+				out.Headers[key] = values[0]
+			}
+		}
+	}
+	return out
+}
+
+// checkSubject rejects subjects that would break the protocol line.
+func checkSubject(subject string) error {
+	if subject == "" || strings.ContainsAny(subject, " \t\r\n") {
+		return fmt.Errorf("invalid subject %q", subject)
+	}
+	return nil
+}
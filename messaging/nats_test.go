@@ -0,0 +1,299 @@
+package messaging
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// natsServer is a minimal NATS server routing messages between its clients.
+type natsServer struct {
+	lis      net.Listener
+	password string
+
+	mu      sync.Mutex
+	clients map[*natsClient]bool
+	groups  map[string]int
+}
+
+type natsClient struct {
+	conn net.Conn
+	mu   sync.Mutex
+	subs map[string][2]string // sid to subject and group
+}
+
+func (c *natsClient) send(format string, args ...interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(c.conn, format, args...)
+}
+
+// startNATSServer starts a server requiring password for the user "gostage" when set.
+func startNATSServer(t *testing.T, password string) *natsServer {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &natsServer{lis: lis, password: password, clients: make(map[*natsClient]bool), groups: make(map[string]int)}
+	t.Cleanup(s.close)
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *natsServer) addr() string {
+	return s.lis.Addr().String()
+}
+
+// close stops the server and drops every client connection.
+func (s *natsServer) close() {
+	s.lis.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		c.conn.Close()
+	}
+}
+
+func (s *natsServer) serve(conn net.Conn) {
+	c := &natsClient{conn: conn, subs: make(map[string][2]string)}
+	s.mu.Lock()
+	s.clients[c] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, c)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	c.send("INFO {\"server_id\":\"test\",\"headers\":true,\"max_payload\":1048576}\r\n")
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "CONNECT":
+			var options struct {
+				User string `json:"user"`
+				Pass string `json:"pass"`
+			}
+			json.Unmarshal([]byte(strings.TrimPrefix(line, "CONNECT ")), &options)
+			if s.password != "" && (options.User != "gostage" || options.Pass != s.password) {
+				c.send("-ERR 'Authorization Violation'\r\n")
+				return
+			}
+		case "PING":
+			c.send("PONG\r\n")
+		case "SUB":
+			group := ""
+			if len(fields) == 4 {
+				group = fields[2]
+			}
+			c.mu.Lock()
+			c.subs[fields[len(fields)-1]] = [2]string{fields[1], group}
+			c.mu.Unlock()
+		case "UNSUB":
+			c.mu.Lock()
+			delete(c.subs, fields[1])
+			c.mu.Unlock()
+		case "PUB", "HPUB":
+			total, _ := strconv.Atoi(fields[len(fields)-1])
+			payload := make([]byte, total+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			headerSize := 0
+			if fields[0] == "HPUB" {
+				headerSize, _ = strconv.Atoi(fields[2])
+			}
+			if fields[1] == "forbidden" {
+				c.send("-ERR 'Permissions Violation for Publish to \"forbidden\"'\r\n")
+				continue
+			}
+			s.route(fields[1], headerSize, payload[:total])
+		}
+	}
+}
+
+// readLine reads a protocol line without its line ending.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// route delivers a published message to the matching subscriptions, once per group.
+func (s *natsServer) route(subject string, headerSize int, payload []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deliver := func(c *natsClient, sid string) {
+		if headerSize > 0 {
+			c.send("HMSG %s %s %d %d\r\n%s\r\n", subject, sid, headerSize, len(payload), payload)
+		} else {
+			c.send("MSG %s %s %d\r\n%s\r\n", subject, sid, len(payload), payload)
+		}
+	}
+
+	type member struct {
+		client *natsClient
+		sid    string
+	}
+	groups := make(map[string][]member)
+	for c := range s.clients {
+		c.mu.Lock()
+		subs := make(map[string][2]string, len(c.subs))
+		for sid, sub := range c.subs {
+			subs[sid] = sub
+		}
+		c.mu.Unlock()
+		for sid, sub := range subs {
+			if !MatchSubject(sub[0], subject) {
+				continue
+			}
+			if sub[1] == "" {
+				deliver(c, sid)
+				continue
+			}
+			groups[sub[1]] = append(groups[sub[1]], member{c, sid})
+		}
+	}
+	for group, members := range groups {
+		sort.Slice(members, func(i, j int) bool { return members[i].sid < members[j].sid })
+		m := members[s.groups[group]%len(members)]
+		s.groups[group]++
+		deliver(m.client, m.sid)
+	}
+}
+
+func TestNATSPublishSubscribe(t *testing.T) {
+	server := startNATSServer(t, "secret")
+	broker := NewNATS("nats://gostage:secret@" + server.addr())
+	defer broker.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sub, err := broker.Subscribe(ctx, "builds.*", "")
+	require.NoError(t, err)
+
+	require.NoError(t, broker.Publish(ctx, Message{Subject: "builds.api", Data: []byte("plain")}))
+	require.NoError(t, broker.Publish(ctx, Message{Subject: "builds.web", Data: []byte("{}"), Headers: map[string]string{"Trace": "abc"}}))
+	require.NoError(t, broker.Publish(ctx, Message{Subject: "deploys.api", Data: []byte("ignored")}))
+
+	msg, err := sub.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Message{Subject: "builds.api", Data: []byte("plain")}, msg)
+
+	msg, err = sub.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "builds.web", msg.Subject)
+	assert.Equal(t, "{}", string(msg.Data))
+	assert.Equal(t, map[string]string{"Trace": "abc"}, msg.Headers)
+
+	require.NoError(t, sub.Close())
+	_, err = sub.Next(ctx)
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestNATSQueueGroups(t *testing.T) {
+	server := startNATSServer(t, "")
+	broker := NewNATS(server.addr())
+	defer broker.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	first, err := broker.Subscribe(ctx, "jobs", "workers")
+	require.NoError(t, err)
+	second, err := broker.Subscribe(ctx, "jobs", "workers")
+	require.NoError(t, err)
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, broker.Publish(ctx, Message{Subject: "jobs", Data: []byte(strconv.Itoa(i))}))
+	}
+
+	var got []string
+	for _, sub := range []Subscription{first, second, first, second} {
+		msg, err := sub.Next(ctx)
+		require.NoError(t, err)
+		got = append(got, string(msg.Data))
+	}
+	assert.ElementsMatch(t, []string{"0", "1", "2", "3"}, got)
+}
+
+func TestNATSErrors(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	server := startNATSServer(t, "secret")
+
+	t.Run("authorization", func(t *testing.T) {
+		broker := NewNATS(server.addr(), WithNATSUser("gostage", "wrong"))
+		defer broker.Close()
+		err := broker.Publish(ctx, Message{Subject: "builds"})
+		assert.ErrorIs(t, err, nats.ErrAuthorization)
+	})
+
+	t.Run("permissions", func(t *testing.T) {
+		broker := NewNATS(server.addr(), WithNATSUser("gostage", "secret"))
+		defer broker.Close()
+		err := broker.Publish(ctx, Message{Subject: "forbidden"})
+		assert.ErrorContains(t, err, "Permissions Violation")
+		assert.NoError(t, broker.Publish(ctx, Message{Subject: "allowed"}))
+	})
+
+	t.Run("invalid subject", func(t *testing.T) {
+		broker := NewNATS(server.addr())
+		_, err := broker.Subscribe(ctx, "two words", "")
+		assert.ErrorContains(t, err, "invalid subject")
+	})
+
+	t.Run("connection lost", func(t *testing.T) {
+		other := startNATSServer(t, "")
+		broker := NewNATS(other.addr())
+		defer broker.Close()
+
+		sub, err := broker.Subscribe(ctx, "builds", "")
+		require.NoError(t, err)
+		other.close()
+
+		_, err = sub.Next(ctx)
+		assert.ErrorContains(t, err, "NATS connection lost")
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		broker := NewNATS(server.addr(), WithNATSUser("gostage", "secret"))
+		require.NoError(t, broker.Close())
+		assert.ErrorIs(t, broker.Publish(ctx, Message{Subject: "builds"}), ErrClosed)
+	})
+}
@@ -0,0 +1,342 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+)
+
+// DefaultStoreKey is the initial store key a triggered workflow finds its message under.
+const DefaultStoreKey = "message"
+
+// WorkflowFactory creates a fresh workflow instance for a triggered run.
+type WorkflowFactory func() (*gostage.Workflow, error)
+
+// ResultHandler receives the result of every triggered run with the message
+// that started it.
+type ResultHandler func(id string, msg Message, result gostage.RunResult)
+
+// Route describes a registered trigger.
+type Route struct {
+	// ID identifies the route
+	ID string
+	// Subject is the subject the route listens on
+	Subject string
+	// Group is the group the route consumes as, if any
+	Group string
+	// Runs is the number of runs started so far
+	Runs int
+}
+
+// route is the state of a registered trigger.
+type route struct {
+	id         string
+	subject    string
+	group      string
+	key        string
+	factory    WorkflowFactory
+	options    gostage.RunOptions
+	runs       int
+	cancel     context.CancelFunc
+	subscribed chan struct{}
+}
+
+// Triggers starts workflows when messages arrive on subjects.
+type Triggers struct {
+	runner   *gostage.Runner
+	broker   Broker
+	logger   gostage.Logger
+	onResult ResultHandler
+	retry    time.Duration
+
+	mu      sync.Mutex
+	routes  map[string]*route
+	ctx     context.Context
+	started bool
+	wg      sync.WaitGroup
+}
+
+// TriggerOption configures Triggers.
+type TriggerOption func(*Triggers)
+
+// WithLogger sets the logger used to report received messages and failures.
+func WithLogger(logger gostage.Logger) TriggerOption {
+	return func(t *Triggers) {
+		t.logger = logger
+	}
+}
+
+// WithResultHandler registers a function called with the result of every run.
+func WithResultHandler(handler ResultHandler) TriggerOption {
+	return func(t *Triggers) {
+		t.onResult = handler
+	}
+}
+
+// WithResubscribeDelay sets how long a route waits before subscribing again
+// after losing its subscription. The default is one second.
+func WithResubscribeDelay(delay time.Duration) TriggerOption {
+	return func(t *Triggers) {
+		t.retry = delay
+	}
+}
+
+// RouteOption configures a route.
+type RouteOption func(*route)
+
+// WithGroup makes the route consume as a member of group, so that instances
+// of the same service sharing the group each start a run for only some of the
+// messages.
+func WithGroup(group string) RouteOption {
+	return func(r *route) {
+		r.group = group
+	}
+}
+
+// WithStoreKey sets the initial store key the message is written to. The
+// default is DefaultStoreKey.
+func WithStoreKey(key string) RouteOption {
+	return func(r *route) {
+		r.key = key
+	}
+}
+
+// WithRunOptions sets the options used to run the route's workflows. The
+// message is added to their initial store, and the context is replaced by one
+// derived from the context the triggers were started with.
+func WithRunOptions(options gostage.RunOptions) RouteOption {
+	return func(r *route) {
+		r.options = options
+	}
+}
+
+// NewTriggers creates triggers receiving messages from broker and submitting
+// workflows to runner. A nil runner uses a new default runner.
+func NewTriggers(runner *gostage.Runner, broker Broker, opts ...TriggerOption) *Triggers {
+	if runner == nil {
+		runner = gostage.NewRunner()
+	}
+
+	t := &Triggers{
+		runner: runner,
+		broker: broker,
+		logger: gostage.NewDefaultLogger(),
+		retry:  time.Second,
+		routes: make(map[string]*route),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// On starts a run of a fresh workflow from factory for every message
+// published on subject, with the message in its initial store in the form
+// returned by Message.StoreValue. Routes added to started triggers listen right away.
+func (t *Triggers) On(id, subject string, factory WorkflowFactory, opts ...RouteOption) error {
+	if factory == nil {
+		return fmt.Errorf("failed to add trigger '%s': factory is nil", id)
+	}
+
+	r := &route{
+		id:      id,
+		subject: subject,
+		key:     DefaultStoreKey,
+		factory: factory,
+		options: gostage.DefaultRunOptions(),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, exists := t.routes[id]; exists {
+		return fmt.Errorf("failed to add trigger '%s': route already exists", id)
+	}
+	t.routes[id] = r
+
+	if t.started {
+		t.listen(r)
+	}
+	return nil
+}
+
+// Remove stops listening on a route. Runs in progress are left to finish.
+// It reports whether the route existed.
+func (t *Triggers) Remove(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r, ok := t.routes[id]
+	if !ok {
+		return false
+	}
+	delete(t.routes, id)
+	if r.cancel != nil {
+		r.cancel()
+	}
+	return true
+}
+
+// Routes returns the registered routes sorted by ID.
+func (t *Triggers) Routes() []Route {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	routes := make([]Route, 0, len(t.routes))
+	for _, r := range t.routes {
+		routes = append(routes, Route{ID: r.id, Subject: r.subject, Group: r.group, Runs: r.runs})
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].ID < routes[j].ID })
+	return routes
+}
+
+// Ready blocks until every route of started triggers holds a subscription,
+// so that messages published afterwards start runs, or until ctx is done.
+func (t *Triggers) Ready(ctx context.Context) error {
+	t.mu.Lock()
+	var waiting []chan struct{}
+	for _, r := range t.routes {
+		if r.subscribed != nil {
+			waiting = append(waiting, r.subscribed)
+		}
+	}
+	t.mu.Unlock()
+
+	for _, ready := range waiting {
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Start subscribes the routes. Runs use contexts derived from ctx, so
+// cancelling it cancels the runs in progress and stops listening.
+func (t *Triggers) Start(ctx context.Context) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.started {
+		return
+	}
+	t.started = true
+	t.ctx = ctx
+
+	for _, r := range t.routes {
+		t.listen(r)
+	}
+}
+
+// Stop stops listening and waits for the runs in progress to finish.
+func (t *Triggers) Stop() {
+	t.mu.Lock()
+	for _, r := range t.routes {
+		if r.cancel != nil {
+			r.cancel()
+		}
+	}
+	t.mu.Unlock()
+
+	t.wg.Wait()
+}
+
+// listen starts the receive loop of a route. It must be called with mu held.
+func (t *Triggers) listen(r *route) {
+	ctx, cancel := context.WithCancel(t.ctx)
+	r.cancel = cancel
+	r.subscribed = make(chan struct{})
+
+	t.wg.Add(1)
+	go t.loop(ctx, r, r.subscribed)
+}
+
+// loop subscribes to the subject of a route and starts a run for every
+// message, subscribing again when the subscription is lost.
+func (t *Triggers) loop(ctx context.Context, r *route, ready chan struct{}) {
+	defer t.wg.Done()
+
+	var once sync.Once
+	signal := func() { once.Do(func() { close(ready) }) }
+	defer signal()
+
+	for ctx.Err() == nil {
+		sub, err := t.broker.Subscribe(ctx, r.subject, r.group)
+		if err == nil {
+			signal()
+			err = t.receive(ctx, r, sub)
+			sub.Close()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		t.logger.Warn("Trigger '%s' lost its subscription to '%s': %v", r.id, r.subject, err)
+
+		select {
+		case <-time.After(t.retry):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// receive starts a run for every message of sub until it fails.
+func (t *Triggers) receive(ctx context.Context, r *route, sub Subscription) error {
+	for {
+		msg, err := sub.Next(ctx)
+		if err != nil {
+			return err
+		}
+		t.logger.Debug("Trigger '%s' received a message on '%s'", r.id, msg.Subject)
+		t.start(r, msg)
+	}
+}
+
+// start builds a fresh workflow for msg and submits it to the runner's worker pool.
+func (t *Triggers) start(r *route, msg Message) {
+	wf, err := r.factory()
+	if err != nil {
+		t.logger.Error("Failed to create workflow for trigger '%s': %v", r.id, err)
+		return
+	}
+
+	options := r.options
+	// Runs outlive their route, so that removing it or stopping leaves them to finish
+	options.Context = t.ctx
+	options.InitialStore = make(map[string]interface{}, len(r.options.InitialStore)+1)
+	for key, value := range r.options.InitialStore {
+		options.InitialStore[key] = value
+	}
+	options.InitialStore[r.key] = msg.StoreValue()
+
+	job, err := t.runner.SubmitWithOptions(wf, options)
+	if err != nil {
+		t.logger.Error("Failed to run trigger '%s': %v", r.id, err)
+		return
+	}
+
+	t.mu.Lock()
+	r.runs++
+	t.mu.Unlock()
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		result := job.Wait()
+		if !result.Success && !errors.Is(result.Error, context.Canceled) {
+			t.logger.Warn("Triggered run of '%s' failed: %v", r.id, result.Error)
+		}
+		if t.onResult != nil {
+			t.onResult(r.id, msg, result)
+		}
+	}()
+}
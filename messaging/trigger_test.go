@@ -0,0 +1,152 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordVersion creates workflows rendering the version and subject of their message to the "deployed" key.
+func recordVersion() (*gostage.Workflow, error) {
+	wf := gostage.NewWorkflow("deploy", "Deploy", "")
+	stage := gostage.NewStage("deploy", "Deploy", "")
+	stage.AddAction(&renderAction{BaseAction: gostage.NewBaseAction("record", ""), text: "{{ .store.message.data.version }} from {{ .store.message.subject }}"})
+	wf.AddStage(stage)
+	return wf, nil
+}
+
+// renderAction stores a rendered template under "deployed".
+type renderAction struct {
+	gostage.BaseAction
+	text string
+}
+
+func (a *renderAction) Execute(ctx *gostage.ActionContext) error {
+	rendered, err := ctx.Render(a.text)
+	if err != nil {
+		return err
+	}
+	return ctx.Store().Put("deployed", rendered)
+}
+
+// results collects the results of triggered runs.
+type results struct {
+	mu   sync.Mutex
+	runs map[string][]gostage.RunResult
+}
+
+func (r *results) handle(id string, msg Message, result gostage.RunResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.runs[id] = append(r.runs[id], result)
+}
+
+func (r *results) of(id string) []gostage.RunResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]gostage.RunResult(nil), r.runs[id]...)
+}
+
+func TestTriggersStartWorkflows(t *testing.T) {
+	broker := NewMemoryBroker()
+	collected := &results{runs: make(map[string][]gostage.RunResult)}
+	triggers := NewTriggers(nil, broker, WithResultHandler(collected.handle))
+
+	options := gostage.DefaultRunOptions()
+	options.InitialStore = map[string]interface{}{"team": "platform"}
+	require.NoError(t, triggers.On("deploy", "builds.*", recordVersion, WithRunOptions(options)))
+	require.Error(t, triggers.On("deploy", "builds.*", recordVersion))
+	require.Error(t, triggers.On("nil", "builds.*", nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	triggers.Start(ctx)
+	defer triggers.Stop()
+	require.NoError(t, triggers.Ready(ctx))
+
+	require.NoError(t, broker.Publish(ctx, Message{Subject: "builds.api", Data: []byte(`{"version":"v1"}`)}))
+	require.NoError(t, broker.Publish(ctx, Message{Subject: "builds.web", Data: []byte(`{"version":"v2"}`)}))
+	require.NoError(t, broker.Publish(ctx, Message{Subject: "deploys.api", Data: []byte(`{"version":"v3"}`)}))
+
+	require.Eventually(t, func() bool { return len(collected.of("deploy")) == 2 }, 5*time.Second, 10*time.Millisecond)
+	var deployed []interface{}
+	for _, result := range collected.of("deploy") {
+		require.True(t, result.Success, "%v", result.Error)
+		deployed = append(deployed, result.FinalStore["deployed"])
+		assert.Equal(t, "platform", result.FinalStore["team"])
+	}
+	assert.ElementsMatch(t, []interface{}{"v1 from builds.api", "v2 from builds.web"}, deployed)
+	assert.Equal(t, []Route{{ID: "deploy", Subject: "builds.*", Runs: 2}}, triggers.Routes())
+	assert.Equal(t, map[string]interface{}{"team": "platform"}, options.InitialStore, "the route options are not modified")
+}
+
+func TestTriggersGroupsAndRemoval(t *testing.T) {
+	broker := NewMemoryBroker()
+	collected := &results{runs: make(map[string][]gostage.RunResult)}
+	triggers := NewTriggers(nil, broker, WithResultHandler(collected.handle))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	triggers.Start(ctx)
+	defer triggers.Stop()
+
+	require.NoError(t, triggers.On("first", "builds", recordVersion, WithGroup("deployers"), WithStoreKey("message")))
+	require.NoError(t, triggers.On("second", "builds", recordVersion, WithGroup("deployers")))
+	require.NoError(t, triggers.Ready(ctx))
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, broker.Publish(ctx, Message{Subject: "builds", Data: []byte(`{"version":"v1"}`)}))
+	}
+	require.Eventually(t, func() bool {
+		return len(collected.of("first"))+len(collected.of("second")) == 4
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Len(t, collected.of("first"), 2)
+	assert.Len(t, collected.of("second"), 2)
+
+	assert.True(t, triggers.Remove("second"))
+	assert.False(t, triggers.Remove("second"))
+	require.Eventually(t, func() bool {
+		require.NoError(t, broker.Publish(ctx, Message{Subject: "builds", Data: []byte(`{"version":"v2"}`)}))
+		return len(collected.of("first")) >= 4
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Len(t, collected.of("second"), 2)
+}
+
+// flakyBroker fails its first subscriptions.
+type flakyBroker struct {
+	*MemoryBroker
+	mu       sync.Mutex
+	failures int
+}
+
+func (b *flakyBroker) Subscribe(ctx context.Context, subject, group string) (Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures > 0 {
+		b.failures--
+		return nil, errors.New("broker unavailable")
+	}
+	return b.MemoryBroker.Subscribe(ctx, subject, group)
+}
+
+func TestTriggersResubscribe(t *testing.T) {
+	broker := &flakyBroker{MemoryBroker: NewMemoryBroker(), failures: 2}
+	collected := &results{runs: make(map[string][]gostage.RunResult)}
+	triggers := NewTriggers(nil, broker, WithResultHandler(collected.handle), WithResubscribeDelay(10*time.Millisecond))
+	require.NoError(t, triggers.On("deploy", "builds", recordVersion))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	triggers.Start(ctx)
+	defer triggers.Stop()
+	require.NoError(t, triggers.Ready(ctx))
+
+	require.NoError(t, broker.Publish(ctx, Message{Subject: "builds", Data: []byte(`{"version":"v1"}`)}))
+	require.Eventually(t, func() bool { return len(collected.of("deploy")) == 1 }, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,290 @@
+// Package metrics records Prometheus metrics for gostage workflow executions.
+//
+// Attach the collectors to a runner with Instrument:
+//
+//	m, err := metrics.New(prometheus.DefaultRegisterer)
+//	if err != nil {
+//		return err
+//	}
+//	runner := gostage.NewRunner()
+//	m.Instrument(runner)
+//
+// Workflow, stage and action durations are recorded as histograms labelled with
+// the outcome, alongside run counters and an in-flight gauge. Retries and queue
+// depth are recorded by the components that own them through RecordRetry and
+// SetQueueDepth, and circuit breakers are observed with InstrumentCircuitBreaker.
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Outcome label values
+const (
+	outcomeSuccess = "success"
+	outcomeFailure = "failure"
+	outcomeSkipped = "skipped"
+)
+
+// Metrics holds the collectors recording workflow executions.
+type Metrics struct {
+	registry  *prometheus.Registry
+	runLabels []string
+
+	workflowDuration *prometheus.HistogramVec
+	workflowRuns     *prometheus.CounterVec
+	stageDuration    *prometheus.HistogramVec
+	stageRuns        *prometheus.CounterVec
+	actionDuration   *prometheus.HistogramVec
+	actionRuns       *prometheus.CounterVec
+	retries          *prometheus.CounterVec
+	inFlight         *prometheus.GaugeVec
+	queueDepth       prometheus.Gauge
+	circuitState     *prometheus.GaugeVec
+}
+
+// config holds the settings applied by Options.
+type config struct {
+	namespace string
+	buckets   []float64
+	tenant    string
+	runLabels []string
+}
+
+// Option configures Metrics.
+type Option func(*config)
+
+// WithNamespace sets the metric namespace. The default is "gostage".
+func WithNamespace(namespace string) Option {
+	return func(c *config) {
+		c.namespace = namespace
+	}
+}
+
+// WithBuckets sets the histogram buckets, in seconds, used for durations.
+func WithBuckets(buckets ...float64) Option {
+	return func(c *config) {
+		c.buckets = buckets
+	}
+}
+
+// WithTenant labels every metric with tenant, so that the runners of several
+// tenants can be instrumented on a shared registry. Create one Metrics per
+// tenant, with the tenant of its runner.
+func WithTenant(tenant string) Option {
+	return func(c *config) {
+		c.tenant = tenant
+	}
+}
+
+// WithRunLabels breaks the workflow durations and run counts down by the
+// given run labels, set with gostage.WithRunLabels or RunOptions.Labels, so
+// that executions can be attributed to their callers. Runs without a label get
+// an empty value. Each key becomes a Prometheus label, so keep to labels with
+// few distinct values.
+func WithRunLabels(keys ...string) Option {
+	return func(c *config) {
+		c.runLabels = append(c.runLabels, keys...)
+	}
+}
+
+// New creates the collectors and registers them with reg.
+// If reg is nil, a dedicated registry is created and returned by Registry.
+func New(reg prometheus.Registerer, opts ...Option) (*Metrics, error) {
+	cfg := config{
+		namespace: "gostage",
+		buckets:   prometheus.DefBuckets,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	m := &Metrics{runLabels: cfg.runLabels}
+	if reg == nil {
+		m.registry = prometheus.NewRegistry()
+		reg = m.registry
+	}
+	if cfg.tenant != "" {
+		reg = prometheus.WrapRegistererWith(prometheus.Labels{"tenant": cfg.tenant}, reg)
+	}
+
+	m.workflowDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: cfg.namespace,
+		Name:      "workflow_duration_seconds",
+		Help:      "Duration of workflow executions.",
+		Buckets:   cfg.buckets,
+	}, append([]string{"workflow", "outcome"}, cfg.runLabels...))
+	m.workflowRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: cfg.namespace,
+		Name:      "workflow_runs_total",
+		Help:      "Number of finished workflow executions.",
+	}, append([]string{"workflow", "outcome"}, cfg.runLabels...))
+	m.stageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: cfg.namespace,
+		Name:      "stage_duration_seconds",
+		Help:      "Duration of stage executions.",
+		Buckets:   cfg.buckets,
+	}, []string{"workflow", "stage", "outcome"})
+	m.stageRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: cfg.namespace,
+		Name:      "stage_runs_total",
+		Help:      "Number of finished stage executions.",
+	}, []string{"workflow", "stage", "outcome"})
+	m.actionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: cfg.namespace,
+		Name:      "action_duration_seconds",
+		Help:      "Duration of action executions.",
+		Buckets:   cfg.buckets,
+	}, []string{"workflow", "stage", "action", "outcome"})
+	m.actionRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: cfg.namespace,
+		Name:      "action_runs_total",
+		Help:      "Number of finished action executions.",
+	}, []string{"workflow", "stage", "action", "outcome"})
+	m.retries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: cfg.namespace,
+		Name:      "action_retries_total",
+		Help:      "Number of action retries.",
+	}, []string{"workflow", "stage", "action"})
+	m.inFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: cfg.namespace,
+		Name:      "workflows_in_flight",
+		Help:      "Number of workflows currently executing.",
+	}, []string{"workflow"})
+	m.queueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: cfg.namespace,
+		Name:      "queue_depth",
+		Help:      "Number of workflows waiting to be executed.",
+	})
+	m.circuitState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: cfg.namespace,
+		Name:      "circuit_state",
+		Help:      "State of circuit breakers: 0 closed, 1 half-open, 2 open.",
+	}, []string{"circuit"})
+
+	collectors := []prometheus.Collector{
+		m.workflowDuration, m.workflowRuns,
+		m.stageDuration, m.stageRuns,
+		m.actionDuration, m.actionRuns,
+		m.retries, m.inFlight, m.queueDepth, m.circuitState,
+	}
+	for _, c := range collectors {
+		if err := reg.Register(c); err != nil {
+			return nil, fmt.Errorf("failed to register metrics: %w", err)
+		}
+	}
+
+	return m, nil
+}
+
+// Registry returns the dedicated registry created when New was called without
+// a Registerer, or nil otherwise.
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// Instrument attaches the workflow, stage and action middleware to the runner.
+func (m *Metrics) Instrument(runner *gostage.Runner) {
+	runner.Use(m.Middleware())
+	runner.UseWorkflowMiddleware(m.StageMiddleware())
+	runner.UseActionMiddleware(m.ActionMiddleware())
+}
+
+// Middleware returns runner middleware recording workflow durations,
+// outcomes and in-flight runs.
+func (m *Metrics) Middleware() gostage.Middleware {
+	return func(next gostage.RunnerFunc) gostage.RunnerFunc {
+		return func(ctx context.Context, wf *gostage.Workflow, logger gostage.Logger) error {
+			inFlight := m.inFlight.WithLabelValues(wf.ID)
+			inFlight.Inc()
+			defer inFlight.Dec()
+
+			start := time.Now()
+			err := next(ctx, wf, logger)
+
+			labels := []string{wf.ID, outcomeOf(err)}
+			runLabels := wf.RunLabels()
+			for _, key := range m.runLabels {
+				labels = append(labels, runLabels[key])
+			}
+			m.workflowDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+			m.workflowRuns.WithLabelValues(labels...).Inc()
+			return err
+		}
+	}
+}
+
+// StageMiddleware returns workflow middleware recording stage durations and outcomes.
+func (m *Metrics) StageMiddleware() gostage.WorkflowMiddleware {
+	return func(next gostage.WorkflowStageRunnerFunc) gostage.WorkflowStageRunnerFunc {
+		return func(ctx context.Context, stage *gostage.Stage, wf *gostage.Workflow, logger gostage.Logger) error {
+			start := time.Now()
+			err := next(ctx, stage, wf, logger)
+
+			outcome := outcomeOf(err)
+			if err == nil && wf.StageStatuses()[stage.ID] == gostage.StatusSkipped {
+				outcome = outcomeSkipped
+			}
+			m.stageDuration.WithLabelValues(wf.ID, stage.ID, outcome).Observe(time.Since(start).Seconds())
+			m.stageRuns.WithLabelValues(wf.ID, stage.ID, outcome).Inc()
+			return err
+		}
+	}
+}
+
+// ActionMiddleware returns action middleware recording action durations and outcomes.
+func (m *Metrics) ActionMiddleware() gostage.ActionMiddleware {
+	return func(next gostage.ActionRunnerFunc) gostage.ActionRunnerFunc {
+		return func(ctx *gostage.ActionContext, action gostage.Action, index int, isLast bool) error {
+			start := time.Now()
+			err := next(ctx, action, index, isLast)
+
+			outcome := outcomeOf(err)
+			labels := []string{ctx.Workflow.ID, ctx.Stage.ID, action.Name(), outcome}
+			m.actionDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+			m.actionRuns.WithLabelValues(labels...).Inc()
+			return err
+		}
+	}
+}
+
+// RecordRetry counts a retry of an action.
+func (m *Metrics) RecordRetry(workflowID, stageID, action string) {
+	m.retries.WithLabelValues(workflowID, stageID, action).Inc()
+}
+
+// SetQueueDepth records the number of workflows waiting to be executed.
+func (m *Metrics) SetQueueDepth(depth int) {
+	m.queueDepth.Set(float64(depth))
+}
+
+// InstrumentCircuitBreaker records the state of the circuits of a breaker
+// whenever they change.
+func (m *Metrics) InstrumentCircuitBreaker(breaker *gostage.CircuitBreaker) {
+	breaker.OnStateChange(func(key string, from, to gostage.CircuitState) {
+		m.circuitState.WithLabelValues(key).Set(circuitStateValue(to))
+	})
+}
+
+func circuitStateValue(state gostage.CircuitState) float64 {
+	switch state {
+	case gostage.CircuitHalfOpen:
+		return 1
+	case gostage.CircuitOpen:
+		return 2
+	default:
+		return 0
+	}
+}
+
+func outcomeOf(err error) string {
+	if err != nil {
+		return outcomeFailure
+	}
+	return outcomeSuccess
+}
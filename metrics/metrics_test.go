@@ -0,0 +1,154 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type funcAction struct {
+	gostage.BaseAction
+	fn func(ctx *gostage.ActionContext) error
+}
+
+func (a *funcAction) Execute(ctx *gostage.ActionContext) error {
+	return a.fn(ctx)
+}
+
+func newAction(name string, err error) gostage.Action {
+	return &funcAction{
+		BaseAction: gostage.NewBaseAction(name, ""),
+		fn:         func(ctx *gostage.ActionContext) error { return err },
+	}
+}
+
+func TestInstrumentRunner(t *testing.T) {
+	m, err := New(nil)
+	require.NoError(t, err)
+	require.NotNil(t, m.Registry())
+
+	runner := gostage.NewRunner()
+	m.Instrument(runner)
+
+	wf := gostage.NewWorkflow("deploy", "Deploy", "")
+	build := gostage.NewStage("build", "Build", "")
+	build.AddAction(newAction("compile", nil))
+	wf.AddStage(build)
+	optional := gostage.NewStage("optional", "Optional", "")
+	optional.AddAction(newAction("extra", nil))
+	wf.AddStage(optional)
+	release := gostage.NewStage("release", "Release", "")
+	release.AddAction(newAction("publish", errors.New("boom")))
+	wf.AddStage(release)
+	wf.DisableStage("optional")
+
+	require.Error(t, runner.Execute(context.Background(), wf, nil))
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.workflowRuns.WithLabelValues("deploy", outcomeFailure)))
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.inFlight.WithLabelValues("deploy")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.stageRuns.WithLabelValues("deploy", "build", outcomeSuccess)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.stageRuns.WithLabelValues("deploy", "optional", outcomeSkipped)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.stageRuns.WithLabelValues("deploy", "release", outcomeFailure)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.actionRuns.WithLabelValues("deploy", "build", "compile", outcomeSuccess)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.actionRuns.WithLabelValues("deploy", "release", "publish", outcomeFailure)))
+
+	m.RecordRetry("deploy", "release", "publish")
+	m.SetQueueDepth(4)
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.retries.WithLabelValues("deploy", "release", "publish")))
+	assert.Equal(t, 4.0, testutil.ToFloat64(m.queueDepth))
+
+	count, err := testutil.GatherAndCount(m.Registry(), "gostage_action_duration_seconds")
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestNewWithRegisterer(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := New(reg, WithNamespace("ci"))
+	require.NoError(t, err)
+	assert.Nil(t, m.Registry())
+
+	m.SetQueueDepth(2)
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP ci_queue_depth Number of workflows waiting to be executed.
+# TYPE ci_queue_depth gauge
+ci_queue_depth 2
+`), "ci_queue_depth"))
+
+	_, err = New(reg, WithNamespace("ci"))
+	assert.Error(t, err)
+}
+
+func TestInstrumentCircuitBreaker(t *testing.T) {
+	m, err := New(nil)
+	require.NoError(t, err)
+
+	breaker := gostage.NewCircuitBreaker(1, time.Hour)
+	m.InstrumentCircuitBreaker(breaker)
+	runner := gostage.NewRunner()
+	runner.UseActionMiddleware(breaker.Middleware())
+
+	wf := gostage.NewWorkflow("sync", "Sync", "")
+	stage := gostage.NewStage("pull", "Pull", "")
+	stage.AddAction(newAction("fetch", errors.New("unavailable")))
+	wf.AddStage(stage)
+
+	require.Error(t, runner.Execute(context.Background(), wf, nil))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.circuitState.WithLabelValues("fetch")))
+
+	breaker.Reset("fetch")
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.circuitState.WithLabelValues("fetch")))
+}
+
+func TestTenantsShareRegistry(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	teamA, err := New(reg, WithTenant("team-a"))
+	require.NoError(t, err)
+	teamB, err := New(reg, WithTenant("team-b"))
+	require.NoError(t, err)
+
+	teamA.SetQueueDepth(1)
+	teamB.SetQueueDepth(3)
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP gostage_queue_depth Number of workflows waiting to be executed.
+# TYPE gostage_queue_depth gauge
+gostage_queue_depth{tenant="team-a"} 1
+gostage_queue_depth{tenant="team-b"} 3
+`), "gostage_queue_depth"))
+
+	_, err = New(reg, WithTenant("team-a"))
+	assert.Error(t, err)
+}
+
+func TestRunLabels(t *testing.T) {
+	m, err := New(nil, WithRunLabels("team"))
+	require.NoError(t, err)
+	runner := gostage.NewRunner()
+	m.Instrument(runner)
+
+	newWorkflow := func() *gostage.Workflow {
+		wf := gostage.NewWorkflow("deploy", "Deploy", "")
+		stage := gostage.NewStage("build", "Build", "")
+		stage.AddAction(newAction("compile", nil))
+		wf.AddStage(stage)
+		return wf
+	}
+	for _, team := range []string{"payments", "payments", "search"} {
+		job, err := runner.Submit(newWorkflow(), gostage.WithRunLabels(map[string]string{"team": team, "caller": "ci"}))
+		require.NoError(t, err)
+		require.True(t, job.Wait().Success)
+	}
+	require.NoError(t, runner.Execute(context.Background(), newWorkflow(), nil))
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.workflowRuns.WithLabelValues("deploy", outcomeSuccess, "payments")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.workflowRuns.WithLabelValues("deploy", outcomeSuccess, "search")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.workflowRuns.WithLabelValues("deploy", outcomeSuccess, "")))
+}
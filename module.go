@@ -0,0 +1,138 @@
+package gostage
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Module is a reusable set of stages, such as the deployment steps a team
+// shares as a library. Workflows mount modules under a prefix with Mount, so
+// that modules of different teams can reuse stage IDs and action names.
+type Module struct {
+	// Name identifies the module in errors
+	Name string
+	// Description explains what the stages of the module do
+	Description string
+	// Stages are the stages of the module, in order
+	Stages []*Stage
+}
+
+// NewModule creates an empty module.
+func NewModule(name, description string) *Module {
+	return &Module{Name: name, Description: description}
+}
+
+// AddStage adds a stage at the end of the module.
+func (m *Module) AddStage(stage *Stage) {
+	m.Stages = append(m.Stages, stage)
+}
+
+// Mount adds copies of the stages of other at the end of the module, under
+// prefix as Workflow.Mount does, so that modules can be built from modules.
+func (m *Module) Mount(prefix string, other *Module) error {
+	stages, err := mountedStages(prefix, other)
+	if err != nil {
+		return err
+	}
+	for _, stage := range stages {
+		for _, existing := range m.Stages {
+			if existing.ID == stage.ID {
+				return fmt.Errorf("stage '%s' of module '%s' already exists in module '%s'", stage.ID, other.Name, m.Name)
+			}
+		}
+	}
+	m.Stages = append(m.Stages, stages...)
+	return nil
+}
+
+// Mount adds copies of the stages of module after the stages of the workflow,
+// prefixing their IDs and the names of their actions with prefix:
+//
+//	wf.Mount("deploy/", deployModule) // stage "apply" becomes "deploy/apply"
+//
+// Dependencies between stages of the module, and the stages of their
+// branches, are prefixed too. Actions that do not embed BaseAction keep
+// their name. The module is left untouched, so it can be mounted in several
+// workflows or several times under different prefixes. Mount fails, without
+// changing the workflow, if the prefix is empty or a prefixed stage ID is
+// already used.
+func (w *Workflow) Mount(prefix string, module *Module) error {
+	stages, err := mountedStages(prefix, module)
+	if err != nil {
+		return err
+	}
+	for _, stage := range stages {
+		if _, err := w.stageIndex(stage.ID); err == nil {
+			return fmt.Errorf("stage '%s' of module '%s' already exists in workflow '%s'", stage.ID, module.Name, w.ID)
+		}
+	}
+
+	for _, stage := range stages {
+		w.Stages = append(w.Stages, stage)
+		w.storeStage(stage, len(w.Stages)-1)
+	}
+	w.saveToStore()
+	return nil
+}
+
+// mountedStages returns copies of the stages of module prefixed with prefix.
+func mountedStages(prefix string, module *Module) ([]*Stage, error) {
+	if strings.TrimSpace(prefix) == "" {
+		return nil, fmt.Errorf("cannot mount module '%s' without a prefix", module.Name)
+	}
+
+	local := make(map[string]bool)
+	for _, stage := range module.Stages {
+		collectStageIDs(stage, local)
+	}
+	seen := make(map[string]bool, len(module.Stages))
+	stages := make([]*Stage, 0, len(module.Stages))
+	for _, stage := range module.Stages {
+		if seen[stage.ID] {
+			return nil, fmt.Errorf("module '%s' has several stages with ID '%s'", module.Name, stage.ID)
+		}
+		seen[stage.ID] = true
+
+		clone := stage.Clone()
+		prefixStage(clone, prefix, local)
+		stages = append(stages, clone)
+	}
+	return stages, nil
+}
+
+// collectStageIDs adds the ID of stage and of the stages of its branches to ids.
+func collectStageIDs(stage *Stage, ids map[string]bool) {
+	ids[stage.ID] = true
+	if stage.branches == nil {
+		return
+	}
+	for _, branch := range stage.branches.branches {
+		for _, s := range branch.Stages {
+			collectStageIDs(s, ids)
+		}
+	}
+}
+
+// prefixStage prefixes the ID of stage, the names of its actions, its
+// dependencies on the stages in local and the stages of its branches.
+func prefixStage(stage *Stage, prefix string, local map[string]bool) {
+	stage.ID = prefix + stage.ID
+	for i, dependency := range stage.dependencies {
+		if local[dependency] {
+			stage.dependencies[i] = prefix + dependency
+		}
+	}
+	for _, action := range stage.Actions {
+		if base := GetActionBaseFields(action); base != nil {
+			base.name = prefix + base.name
+		}
+	}
+	if stage.branches == nil {
+		return
+	}
+	for _, branch := range stage.branches.branches {
+		for _, s := range branch.Stages {
+			prefixStage(s, prefix, local)
+		}
+	}
+}
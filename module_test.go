@@ -0,0 +1,71 @@
+package gostage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRecordingModule returns a module whose stages append their ID to ran.
+func newRecordingModule(name string, ran *[]string, stageIDs ...string) *Module {
+	module := NewModule(name, "")
+	for _, stageID := range stageIDs {
+		module.AddStage(recordingStage(stageID, ran))
+	}
+	return module
+}
+
+func TestWorkflowMount(t *testing.T) {
+	var ran []string
+	deploy := newRecordingModule("deploy", &ran, "prepare", "apply")
+	deploy.Stages[1].DependsOn("prepare", "build")
+	deploy.AddStage(IfStage("gate", "Gate", StoreKeyEquals("env", "prod"),
+		[]*Stage{recordingStage("approve", &ran)}, nil))
+	notify := newRecordingModule("notify", &ran, "prepare", "send")
+
+	wf := NewWorkflow("release", "Release", "")
+	wf.AddStage(recordingStage("build", &ran))
+	require.NoError(t, wf.Mount("deploy/", deploy))
+	require.NoError(t, wf.Mount("notify/", notify))
+	wf.Store.Put("env", "prod")
+
+	assert.Equal(t, []string{"build", "deploy/prepare", "deploy/apply", "deploy/gate", "notify/prepare", "notify/send"}, wf.getStageIDs())
+	assert.Equal(t, []string{"deploy/prepare", "build"}, wf.Stages[2].dependencies)
+	assert.Equal(t, "deploy/approve", wf.Stages[3].branches.branches[0].Stages[0].ID)
+
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, []string{"build", "prepare", "apply", "approve", "prepare", "send"}, ran)
+	assert.Equal(t, StatusCompleted, result.ActionStatuses[ActionStatusKey("deploy/prepare", "deploy/prepare-action")])
+	assert.Equal(t, StatusCompleted, result.ActionStatuses[ActionStatusKey("notify/prepare", "notify/prepare-action")])
+
+	// The module is left untouched
+	assert.Equal(t, "prepare", deploy.Stages[0].ID)
+	assert.Equal(t, "prepare-action", deploy.Stages[0].Actions[0].Name())
+}
+
+func TestMountErrors(t *testing.T) {
+	var ran []string
+	deploy := newRecordingModule("deploy", &ran, "apply")
+
+	wf := NewWorkflow("release", "Release", "")
+	require.NoError(t, wf.Mount("deploy/", deploy))
+	assert.EqualError(t, wf.Mount("deploy/", deploy), "stage 'deploy/apply' of module 'deploy' already exists in workflow 'release'")
+	assert.EqualError(t, wf.Mount("", deploy), "cannot mount module 'deploy' without a prefix")
+	assert.EqualError(t, wf.Mount("again/", newRecordingModule("twice", &ran, "a", "a")), "module 'twice' has several stages with ID 'a'")
+	assert.Len(t, wf.Stages, 1)
+}
+
+func TestModuleMount(t *testing.T) {
+	var ran []string
+	canary := newRecordingModule("canary", &ran, "apply")
+	deploy := newRecordingModule("deploy", &ran, "apply")
+	require.NoError(t, deploy.Mount("canary/", canary))
+	assert.Error(t, deploy.Mount("canary/", canary))
+
+	wf := NewWorkflow("release", "Release", "")
+	require.NoError(t, wf.Mount("deploy/", deploy))
+	assert.Equal(t, []string{"deploy/apply", "deploy/canary/apply"}, wf.getStageIDs())
+	assert.Equal(t, "deploy/canary/apply-action", wf.Stages[1].Actions[0].Name())
+}
@@ -0,0 +1,207 @@
+package gostage
+
+import "fmt"
+
+// Patch is a set of changes that Overlay applies to a copy of a base
+// workflow, such as the differences of an environment-specific variant.
+// Changes are applied in the order they were added. Stages and actions
+// given to a patch are copied when it is applied, so a patch can be
+// overlaid on several workflows.
+type Patch struct {
+	changes []func(w *Workflow) error
+}
+
+// NewPatch creates an empty patch.
+func NewPatch() *Patch {
+	return &Patch{}
+}
+
+// Edit adds a change made by fn, for changes the other methods do not cover.
+func (p *Patch) Edit(fn func(w *Workflow) error) *Patch {
+	p.changes = append(p.changes, fn)
+	return p
+}
+
+// AddStage adds stage after the stages of the workflow.
+func (p *Patch) AddStage(stage *Stage) *Patch {
+	return p.Edit(func(w *Workflow) error {
+		clone := cloneStage(stage)
+		if err := w.checkNewStage(clone, ""); err != nil {
+			return err
+		}
+		w.AddStage(clone)
+		return nil
+	})
+}
+
+// InsertStageBefore inserts stage right before the stage with the given ID.
+func (p *Patch) InsertStageBefore(stageID string, stage *Stage) *Patch {
+	return p.Edit(func(w *Workflow) error {
+		return w.InsertStageBefore(stageID, cloneStage(stage))
+	})
+}
+
+// InsertStageAfter inserts stage right after the stage with the given ID.
+func (p *Patch) InsertStageAfter(stageID string, stage *Stage) *Patch {
+	return p.Edit(func(w *Workflow) error {
+		return w.InsertStageAfter(stageID, cloneStage(stage))
+	})
+}
+
+// ReplaceStage replaces the stage with the given ID by stage.
+func (p *Patch) ReplaceStage(stageID string, stage *Stage) *Patch {
+	return p.Edit(func(w *Workflow) error {
+		return w.ReplaceStage(stageID, cloneStage(stage))
+	})
+}
+
+// RemoveStage removes the stage with the given ID.
+func (p *Patch) RemoveStage(stageID string) *Patch {
+	return p.Edit(func(w *Workflow) error {
+		return w.RemoveStage(stageID)
+	})
+}
+
+// AddAction adds action at the end of the stage with the given ID.
+func (p *Patch) AddAction(stageID string, action Action) *Patch {
+	return p.Edit(func(w *Workflow) error {
+		index, err := w.stageIndex(stageID)
+		if err != nil {
+			return err
+		}
+		stage := w.Stages[index]
+		stage.AddAction(CloneAction(action))
+		w.storeStage(stage, index)
+		return nil
+	})
+}
+
+// ReplaceAction replaces the action called actionName of the stage with the
+// given ID by action, at the same position.
+func (p *Patch) ReplaceAction(stageID, actionName string, action Action) *Patch {
+	return p.Edit(func(w *Workflow) error {
+		return w.editAction(stageID, actionName, func(stage *Stage, i int) {
+			stage.Actions[i] = CloneAction(action)
+		})
+	})
+}
+
+// RemoveAction removes the action called actionName from the stage with the
+// given ID.
+func (p *Patch) RemoveAction(stageID, actionName string) *Patch {
+	return p.Edit(func(w *Workflow) error {
+		return w.editAction(stageID, actionName, func(stage *Stage, i int) {
+			stage.Actions = append(stage.Actions[:i], stage.Actions[i+1:]...)
+		})
+	})
+}
+
+// SetInitialData sets the initial data under key of the stage with the given ID.
+func (p *Patch) SetInitialData(stageID, key string, value any) *Patch {
+	return p.Edit(func(w *Workflow) error {
+		index, err := w.stageIndex(stageID)
+		if err != nil {
+			return err
+		}
+		return w.Stages[index].SetInitialData(key, value)
+	})
+}
+
+// SetData writes value under key in the store of the workflow.
+func (p *Patch) SetData(key string, value any) *Patch {
+	return p.Edit(func(w *Workflow) error {
+		if err := w.Store.Put(key, value); err != nil {
+			return fmt.Errorf("failed to set '%s': %w", key, err)
+		}
+		return nil
+	})
+}
+
+// SetParamDefault sets the default value of the parameter called name.
+func (p *Patch) SetParamDefault(name string, value interface{}) *Patch {
+	return p.Edit(func(w *Workflow) error {
+		for i, param := range w.params {
+			if param.Name == name {
+				w.params[i].Default = value
+				w.params[i].HasDefault = true
+				return nil
+			}
+		}
+		return fmt.Errorf("workflow '%s' has no parameter named '%s'", w.ID, name)
+	})
+}
+
+// DisableStage disables the stage with the given ID.
+func (p *Patch) DisableStage(stageID string) *Patch {
+	return p.Edit(func(w *Workflow) error {
+		if _, err := w.stageIndex(stageID); err != nil {
+			return err
+		}
+		w.DisableStage(stageID)
+		return nil
+	})
+}
+
+// cloneStage copies stage, keeping nil stages nil so that adding them fails.
+func cloneStage(stage *Stage) *Stage {
+	if stage == nil {
+		return nil
+	}
+	return stage.Clone()
+}
+
+// editAction calls edit with the stage with the given ID and the index of
+// its action called actionName, and then updates the stage in the store.
+func (w *Workflow) editAction(stageID, actionName string, edit func(stage *Stage, i int)) error {
+	index, err := w.stageIndex(stageID)
+	if err != nil {
+		return err
+	}
+	stage := w.Stages[index]
+	for i, action := range stage.Actions {
+		if action.Name() == actionName {
+			edit(stage, i)
+			w.storeStage(stage, index)
+			return nil
+		}
+	}
+	return fmt.Errorf("action '%s' not found in stage '%s'", actionName, stageID)
+}
+
+// Overlay creates a variant of base with the changes of patches applied, in
+// order, so that environment-specific variants share one definition:
+//
+//	prod, err := gostage.Overlay(base, gostage.NewPatch().
+//		ReplaceAction("deploy", "apply", helmApply).
+//		AddStage(smokeTests).
+//		SetInitialData("deploy", "replicas", 5))
+//
+// The variant starts as a copy of base with its stages, store data,
+// parameters, bindings, middleware, services, annotations, strategy and
+// time bounds. Base is left untouched. Overlay fails with the first change
+// that fails, naming its position.
+func Overlay(base *Workflow, patches ...*Patch) (*Workflow, error) {
+	variant := NewWorkflowWithTags(base.ID, base.Name, base.Description, append([]string{}, base.Tags...))
+	variant.Version = base.Version
+	variant.middleware = append(variant.middleware, base.middleware...)
+	variant.params = append([]Param(nil), base.params...)
+	variant.bindings = append([]Binding(nil), base.bindings...)
+	variant.strategy = base.strategy
+	variant.services = base.services.clone()
+	variant.annotations = copyAnnotations(base.annotations)
+	variant.deadline = base.deadline
+	variant.maxDuration = base.maxDuration
+	if err := variant.Append(base); err != nil {
+		return nil, fmt.Errorf("failed to copy workflow '%s': %w", base.ID, err)
+	}
+
+	for i, patch := range patches {
+		for j, change := range patch.changes {
+			if err := change(variant); err != nil {
+				return nil, fmt.Errorf("change %d of patch %d on workflow '%s' failed: %w", j+1, i+1, base.ID, err)
+			}
+		}
+	}
+	variant.saveToStore()
+	return variant, nil
+}
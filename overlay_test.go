@@ -0,0 +1,78 @@
+package gostage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverlay(t *testing.T) {
+	var ran []string
+	base := NewWorkflow("deploy", "Deploy", "")
+	base.Version = "2"
+	base.AddParam("region", Default("us-east-1"))
+	base.Store.Put("replicas", 1)
+	base.AddStage(recordingStage("build", &ran))
+	apply := recordingStage("apply", &ran)
+	require.NoError(t, apply.SetInitialData("timeout", "1m"))
+	base.AddStage(apply)
+	base.AddStage(recordingStage("cleanup", &ran))
+
+	replacement := NewActionFunc("apply-action", "", func(ctx *ActionContext) error {
+		ran = append(ran, "helm")
+		return nil
+	})
+	patch := NewPatch().
+		ReplaceAction("apply", "apply-action", replacement).
+		InsertStageAfter("apply", recordingStage("smoke", &ran)).
+		SetInitialData("apply", "timeout", "5m").
+		SetData("replicas", 5).
+		SetParamDefault("region", "eu-west-1").
+		DisableStage("cleanup")
+
+	prod, err := Overlay(base, patch)
+	require.NoError(t, err)
+	assert.Equal(t, "2", prod.Version)
+	assert.Equal(t, []string{"build", "apply", "smoke", "cleanup"}, prod.getStageIDs())
+	assert.Equal(t, "eu-west-1", prod.Params()[0].Default)
+
+	require.NoError(t, prod.Instantiate(nil))
+	result := NewRunner().ExecuteWithOptions(prod, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, []string{"build", "helm", "smoke"}, ran)
+	assert.Equal(t, 5, result.FinalStore["replicas"])
+	assert.Equal(t, "5m", result.FinalStore["timeout"])
+	assert.Equal(t, "eu-west-1", result.FinalStore["region"])
+
+	// The base is left untouched
+	ran = nil
+	require.NoError(t, base.Instantiate(nil))
+	result = NewRunner().ExecuteWithOptions(base, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, []string{"build", "apply", "cleanup"}, ran)
+	assert.Equal(t, 1, result.FinalStore["replicas"])
+	assert.Equal(t, "1m", result.FinalStore["timeout"])
+	assert.Equal(t, "us-east-1", result.FinalStore["region"])
+
+	// Patches are applied in order and can be reused
+	staging, err := Overlay(base, patch, NewPatch().RemoveStage("smoke").RemoveAction("build", "build-action"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"build", "apply", "cleanup"}, staging.getStageIDs())
+	assert.Empty(t, staging.Stages[0].Actions)
+	assert.NotSame(t, prod.Stages[2], staging.Stages[2])
+}
+
+func TestOverlayErrors(t *testing.T) {
+	var ran []string
+	base := NewWorkflow("deploy", "Deploy", "")
+	base.AddStage(recordingStage("apply", &ran))
+
+	_, err := Overlay(base, NewPatch().AddStage(recordingStage("smoke", &ran)), NewPatch().RemoveAction("apply", "missing"))
+	assert.EqualError(t, err, "change 1 of patch 2 on workflow 'deploy' failed: action 'missing' not found in stage 'apply'")
+	_, err = Overlay(base, NewPatch().AddStage(recordingStage("apply", &ran)))
+	assert.ErrorContains(t, err, "stage 'apply' already exists in workflow 'deploy'")
+	_, err = Overlay(base, NewPatch().SetParamDefault("region", "eu"))
+	assert.ErrorContains(t, err, "workflow 'deploy' has no parameter named 'region'")
+	assert.Equal(t, []string{"apply"}, base.getStageIDs())
+}
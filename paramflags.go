@@ -0,0 +1,122 @@
+package gostage
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// paramFlag is the flag of a parameter, defined by DefineParamFlags.
+type paramFlag struct {
+	param Param
+	// value is the parsed value, set when the flag is set
+	value interface{}
+	set   bool
+}
+
+func (f *paramFlag) String() string {
+	switch {
+	case f == nil:
+		return ""
+	case f.set:
+		return formatParamValue(f.value)
+	case f.param.HasDefault:
+		return formatParamValue(f.param.Default)
+	}
+	return ""
+}
+
+// Set parses the raw value with the type of the parameter. Untyped values
+// are decoded as JSON when possible and kept as strings otherwise, as
+// -param values of the gostage command are.
+func (f *paramFlag) Set(raw string) error {
+	var value interface{}
+	if t := f.param.valueType(); t != ParamAny {
+		var err error
+		if value, err = t.parse(raw); err != nil {
+			return err
+		}
+	} else if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		value = raw
+	}
+	f.value = value
+	f.set = true
+	return nil
+}
+
+func (f *paramFlag) Get() interface{} {
+	return f.value
+}
+
+// IsBoolFlag lets boolean parameters be set with -name alone.
+func (f *paramFlag) IsBoolFlag() bool {
+	return f.param.valueType() == ParamBool
+}
+
+// formatParamValue formats the value of a parameter as it is written on the
+// command line.
+func formatParamValue(value interface{}) string {
+	if list, ok := value.([]string); ok {
+		return strings.Join(list, ",")
+	}
+	return fmt.Sprint(value)
+}
+
+// DefineParamFlags defines a flag on flags for every parameter of the
+// workflow, so that a program running the workflow accepts its parameters
+// on the command line without declaring them twice:
+//
+//	flags := flag.NewFlagSet("deploy", flag.ExitOnError)
+//	wf.DefineParamFlags(flags)
+//	flags.Parse(os.Args[1:])
+//	if err := wf.Instantiate(gostage.ParamFlagValues(flags)); err != nil {
+//		log.Fatal(err)
+//	}
+//
+// Flags are named after the parameters and parse values with the type of
+// their parameter or, for untyped parameters, the type of their default, so
+// invalid values are rejected when the flags are parsed. Their usage shows
+// the description and type of the parameter and whether it is required.
+// Parameters named after a flag flags already defines get no flag.
+func (w *Workflow) DefineParamFlags(flags *flag.FlagSet) {
+	for _, p := range w.params {
+		if p.Name == "" || strings.HasPrefix(p.Name, "-") || strings.Contains(p.Name, "=") || flags.Lookup(p.Name) != nil {
+			continue
+		}
+		flags.Var(&paramFlag{param: p}, p.Name, paramUsage(p))
+	}
+}
+
+// paramUsage returns the usage of the flag of a parameter. The type is
+// quoted with back quotes, which the flag package shows as the name of the
+// value of the flag.
+func paramUsage(p Param) string {
+	var notes []string
+	if t := p.valueType(); t != ParamAny && t != ParamBool {
+		notes = append(notes, "`"+t.String()+"`")
+	}
+	if p.Required && !p.HasDefault {
+		notes = append(notes, "required")
+	}
+	if len(notes) == 0 {
+		return p.Description
+	}
+	if p.Description == "" {
+		return strings.Join(notes, ", ")
+	}
+	return p.Description + " (" + strings.Join(notes, ", ") + ")"
+}
+
+// ParamFlagValues returns the values of the parameter flags of flags, defined
+// by DefineParamFlags, that were set on the command line, keyed by parameter
+// name, to be passed to Instantiate.
+func ParamFlagValues(flags *flag.FlagSet) map[string]interface{} {
+	values := make(map[string]interface{})
+	flags.Visit(func(f *flag.Flag) {
+		if pf, ok := f.Value.(*paramFlag); ok {
+			values[pf.param.Name] = pf.value
+		}
+	})
+	return values
+}
@@ -0,0 +1,46 @@
+package gostage
+
+import (
+	"bytes"
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefineParamFlags(t *testing.T) {
+	wf := NewWorkflow("scale", "Scale", "")
+	wf.AddParam("replicas", Required, OfType(ParamInt), Describe("number of replicas"))
+	wf.AddParam("timeout", Default(time.Minute))
+	wf.AddParam("dry-run", Default(false))
+	wf.AddParam("labels")
+	wf.AddParam("v", Describe("shadowed by the flag of the program"))
+
+	flags := flag.NewFlagSet("scale", flag.ContinueOnError)
+	verbose := flags.Bool("v", false, "verbose")
+	wf.DefineParamFlags(flags)
+
+	require.NoError(t, flags.Parse([]string{"-replicas", "3", "-dry-run", "-timeout", "90s", "-labels", `{"team": "core"}`, "-v"}))
+	assert.True(t, *verbose)
+	values := ParamFlagValues(flags)
+	assert.Equal(t, map[string]interface{}{
+		"replicas": 3,
+		"timeout":  90 * time.Second,
+		"dry-run":  true,
+		"labels":   map[string]interface{}{"team": "core"},
+	}, values)
+	require.NoError(t, wf.Instantiate(values))
+
+	var usage bytes.Buffer
+	flags.SetOutput(&usage)
+	flags.PrintDefaults()
+	assert.Contains(t, usage.String(), "-replicas int\n    \tnumber of replicas (int, required)")
+	assert.Contains(t, usage.String(), "-timeout duration\n    \tduration (default 1m0s)")
+
+	flags = flag.NewFlagSet("scale", flag.ContinueOnError)
+	flags.SetOutput(&usage)
+	wf.DefineParamFlags(flags)
+	assert.ErrorContains(t, flags.Parse([]string{"-replicas", "three"}), `invalid value "three" for flag -replicas: expected int`)
+}
@@ -0,0 +1,319 @@
+package gostage
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Param declares an input parameter of a workflow.
+// Parameters are supplied at instantiation time, letting one workflow
+// definition be reused across environments.
+type Param struct {
+	// Name is the parameter name and the store key its value is written to
+	Name string
+	// Description explains what the parameter controls
+	Description string
+	// Required parameters must be supplied unless they have a default
+	Required bool
+	// Default is used when the parameter is not supplied
+	Default interface{}
+	// HasDefault reports whether Default was set
+	HasDefault bool
+	// Type is the type of the values, checked by Instantiate. Untyped
+	// parameters accept any value
+	Type ParamType
+}
+
+// ParamType is the type of the values of a parameter.
+type ParamType int
+
+const (
+	// ParamAny accepts values of any type. It is the default
+	ParamAny ParamType = iota
+	// ParamString accepts strings
+	ParamString
+	// ParamInt accepts integers, stored as int
+	ParamInt
+	// ParamFloat accepts numbers, stored as float64
+	ParamFloat
+	// ParamBool accepts booleans
+	ParamBool
+	// ParamDuration accepts durations such as "90s", stored as time.Duration
+	ParamDuration
+	// ParamList accepts lists of strings, written as comma separated values
+	// on the command line and stored as []string
+	ParamList
+)
+
+// paramTypeNames are the names of the parameter types in definitions
+var paramTypeNames = map[ParamType]string{
+	ParamAny:      "any",
+	ParamString:   "string",
+	ParamInt:      "int",
+	ParamFloat:    "float",
+	ParamBool:     "bool",
+	ParamDuration: "duration",
+	ParamList:     "list",
+}
+
+// String returns the name of the type.
+func (t ParamType) String() string {
+	if name, ok := paramTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("ParamType(%d)", int(t))
+}
+
+// ParseParamType returns the parameter type with the given name, as returned by String.
+func ParseParamType(name string) (ParamType, error) {
+	for t, typeName := range paramTypeNames {
+		if strings.EqualFold(name, typeName) {
+			return t, nil
+		}
+	}
+	return ParamAny, fmt.Errorf("unknown parameter type '%s'", name)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (t ParamType) MarshalText() ([]byte, error) {
+	if _, ok := paramTypeNames[t]; !ok {
+		return nil, fmt.Errorf("unknown parameter type %d", int(t))
+	}
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (t *ParamType) UnmarshalText(text []byte) error {
+	parsed, err := ParseParamType(string(text))
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+// paramTypeOf returns the type of value, or ParamAny if it is not one of
+// the parameter types.
+func paramTypeOf(value interface{}) ParamType {
+	switch v := value.(type) {
+	case string:
+		return ParamString
+	case bool:
+		return ParamBool
+	case time.Duration:
+		return ParamDuration
+	case []string:
+		return ParamList
+	case []interface{}:
+		for _, item := range v {
+			if _, ok := item.(string); !ok {
+				return ParamAny
+			}
+		}
+		return ParamList
+	case nil:
+		return ParamAny
+	}
+	switch reflect.TypeOf(value).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return ParamInt
+	case reflect.Float32, reflect.Float64:
+		return ParamFloat
+	}
+	return ParamAny
+}
+
+// parse converts a raw value, such as a flag value, to the type.
+func (t ParamType) parse(raw string) (interface{}, error) {
+	var example interface{}
+	switch t {
+	case ParamAny, ParamString:
+		return raw, nil
+	case ParamInt:
+		example = 0
+	case ParamFloat:
+		example = 0.0
+	case ParamBool:
+		example = false
+	case ParamDuration:
+		example = time.Duration(0)
+	case ParamList:
+		example = []string(nil)
+	}
+	value, err := converterFor(example)(raw)
+	if err != nil {
+		return nil, fmt.Errorf("expected %s", t)
+	}
+	return value, nil
+}
+
+// convert checks that value is of the type and returns it in the form the
+// type is stored as. Strings are parsed, so that values given on the
+// command line or in the environment are accepted, and numbers and lists
+// decoded from JSON are converted.
+func (t ParamType) convert(value interface{}) (interface{}, error) {
+	if raw, ok := value.(string); ok {
+		return t.parse(raw)
+	}
+	if t == ParamAny {
+		return value, nil
+	}
+
+	rv := reflect.ValueOf(value)
+	switch {
+	case t == ParamBool && rv.Kind() == reflect.Bool:
+		return rv.Bool(), nil
+	case t == ParamDuration && rv.Type() == reflect.TypeOf(time.Duration(0)):
+		return value, nil
+	case t == ParamInt && rv.CanInt():
+		return int(rv.Int()), nil
+	case t == ParamInt && rv.CanUint():
+		return int(rv.Uint()), nil
+	case t == ParamInt && rv.CanFloat() && rv.Float() == float64(int(rv.Float())):
+		return int(rv.Float()), nil
+	case t == ParamFloat && rv.CanFloat():
+		return rv.Float(), nil
+	case t == ParamFloat && rv.CanInt():
+		return float64(rv.Int()), nil
+	case t == ParamFloat && rv.CanUint():
+		return float64(rv.Uint()), nil
+	case t == ParamList && paramTypeOf(value) == ParamList:
+		if list, ok := value.([]string); ok {
+			return list, nil
+		}
+		var list []string
+		for _, item := range value.([]interface{}) {
+			list = append(list, item.(string))
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("expected %s, got %T", t, value)
+}
+
+// ParamOption configures a Param declared with AddParam.
+type ParamOption func(*Param)
+
+// Required marks a parameter as mandatory.
+func Required(p *Param) {
+	p.Required = true
+}
+
+// Default sets the value used when a parameter is not supplied.
+func Default(value interface{}) ParamOption {
+	return func(p *Param) {
+		p.Default = value
+		p.HasDefault = true
+	}
+}
+
+// Describe sets the description of a parameter.
+func Describe(description string) ParamOption {
+	return func(p *Param) {
+		p.Description = description
+	}
+}
+
+// OfType sets the type of a parameter. Instantiate fails when a value is not
+// of the type, and strings are parsed, so "3" is accepted for a ParamInt.
+func OfType(t ParamType) ParamOption {
+	return func(p *Param) {
+		p.Type = t
+	}
+}
+
+// valueType returns the type of the parameter or, for untyped parameters,
+// the type of its default.
+func (p Param) valueType() ParamType {
+	if p.Type == ParamAny && p.HasDefault {
+		return paramTypeOf(p.Default)
+	}
+	return p.Type
+}
+
+// AddParam declares a parameter on the workflow.
+// Declaring a parameter with an existing name replaces the previous declaration.
+func (w *Workflow) AddParam(name string, opts ...ParamOption) {
+	param := Param{Name: name}
+	for _, opt := range opts {
+		opt(&param)
+	}
+
+	for i, existing := range w.params {
+		if existing.Name == name {
+			w.params[i] = param
+			return
+		}
+	}
+	w.params = append(w.params, param)
+}
+
+// Params returns the parameters declared on the workflow in declaration order.
+func (w *Workflow) Params() []Param {
+	return append([]Param{}, w.params...)
+}
+
+// Instantiate validates the supplied values against the declared parameters
+// and writes them into the workflow store under the parameter names.
+// Defaults are applied for parameters that were not supplied, and values of
+// typed parameters are converted to their type. It returns an error, without
+// modifying the store, if a required parameter is missing, a value is not of
+// the type of its parameter or an undeclared parameter is supplied.
+func (w *Workflow) Instantiate(values map[string]interface{}) error {
+	declared := make(map[string]bool, len(w.params))
+	for _, p := range w.params {
+		declared[p.Name] = true
+	}
+
+	var unknown []string
+	for name := range values {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("workflow '%s' has no parameters named: %s", w.ID, strings.Join(unknown, ", "))
+	}
+
+	resolved := make(map[string]interface{}, len(w.params))
+	var missing []string
+	for _, p := range w.params {
+		if value, ok := values[p.Name]; ok {
+			resolved[p.Name] = value
+		} else if p.HasDefault {
+			resolved[p.Name] = p.Default
+		} else if p.Required {
+			missing = append(missing, p.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("workflow '%s' is missing required parameters: %s", w.ID, strings.Join(missing, ", "))
+	}
+
+	for _, p := range w.params {
+		value, ok := resolved[p.Name]
+		if !ok || p.Type == ParamAny {
+			continue
+		}
+		converted, err := p.Type.convert(value)
+		if err != nil {
+			return fmt.Errorf("workflow '%s' has an invalid value for parameter '%s': %w", w.ID, p.Name, err)
+		}
+		resolved[p.Name] = converted
+	}
+
+	for _, p := range w.params {
+		value, ok := resolved[p.Name]
+		if !ok {
+			continue
+		}
+		if err := w.Store.Put(p.Name, value); err != nil {
+			return fmt.Errorf("failed to set parameter '%s': %w", p.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package gostage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/davidroman0O/gostage/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkflowInstantiate(t *testing.T) {
+	wf := NewWorkflow("deploy", "Deploy", "")
+	wf.AddParam("region", Required, Default("us-east-1"))
+	wf.AddParam("version", Required, Describe("release to deploy"))
+	wf.AddParam("dryRun", Default(false))
+
+	err := wf.Instantiate(map[string]interface{}{})
+	assert.ErrorContains(t, err, "missing required parameters: version")
+
+	err = wf.Instantiate(map[string]interface{}{"version": "1.2.0", "zone": "a"})
+	assert.ErrorContains(t, err, "no parameters named: zone")
+	assert.Equal(t, 0, len(store.KeysByType[string](wf.Store)), "failed instantiation leaves the store untouched")
+
+	require.NoError(t, wf.Instantiate(map[string]interface{}{"version": "1.2.0"}))
+
+	region, err := store.Get[string](wf.Store, "region")
+	require.NoError(t, err)
+	assert.Equal(t, "us-east-1", region)
+
+	version, _ := store.Get[string](wf.Store, "version")
+	assert.Equal(t, "1.2.0", version)
+
+	dryRun, err := store.Get[bool](wf.Store, "dryRun")
+	require.NoError(t, err)
+	assert.False(t, dryRun)
+
+	params := wf.Params()
+	require.Len(t, params, 3)
+	assert.Equal(t, "release to deploy", params[1].Description)
+}
+
+func TestWorkflowParamsRoundTrip(t *testing.T) {
+	registry := newSerializationRegistry(t)
+
+	wf := NewWorkflow("wf", "Workflow", "")
+	wf.AddParam("region", Required, Default("us-east-1"))
+	wf.AddParam("replicas", OfType(ParamInt))
+	stage := NewStage("s", "S", "")
+	noop, _ := registry.Resolve("noop", nil)
+	stage.AddAction(noop)
+	wf.AddStage(stage)
+
+	data, err := wf.Marshal()
+	require.NoError(t, err)
+	restored, err := UnmarshalWorkflow(data, registry)
+	require.NoError(t, err)
+
+	assert.Equal(t, wf.Params(), restored.Params())
+}
+
+func TestWorkflowInstantiateTypedParams(t *testing.T) {
+	wf := NewWorkflow("scale", "Scale", "")
+	wf.AddParam("replicas", OfType(ParamInt))
+	wf.AddParam("ratio", OfType(ParamFloat))
+	wf.AddParam("timeout", OfType(ParamDuration), Default("30s"))
+	wf.AddParam("zones", OfType(ParamList))
+
+	// Strings are parsed and JSON numbers and lists converted
+	require.NoError(t, wf.Instantiate(map[string]interface{}{
+		"replicas": float64(3),
+		"ratio":    "0.5",
+		"zones":    []interface{}{"a", "b"},
+	}))
+	values := wf.Store.ExportAll()
+	assert.Equal(t, 3, values["replicas"])
+	assert.Equal(t, 0.5, values["ratio"])
+	assert.Equal(t, 30*time.Second, values["timeout"])
+	assert.Equal(t, []string{"a", "b"}, values["zones"])
+
+	err := wf.Instantiate(map[string]interface{}{"replicas": 2.5})
+	assert.EqualError(t, err, "workflow 'scale' has an invalid value for parameter 'replicas': expected int, got float64")
+	err = wf.Instantiate(map[string]interface{}{"timeout": "soon"})
+	assert.EqualError(t, err, "workflow 'scale' has an invalid value for parameter 'timeout': expected duration")
+
+	parsed, err := ParseParamType("Duration")
+	require.NoError(t, err)
+	assert.Equal(t, ParamDuration, parsed)
+	_, err = ParseParamType("date")
+	assert.Error(t, err)
+}
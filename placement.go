@@ -0,0 +1,140 @@
+package gostage
+
+import "fmt"
+
+type placementKind int
+
+const (
+	placeDefault placementKind = iota
+	placeNext
+	placeBefore
+	placeAfter
+	placeAt
+)
+
+// Placement tells where a dynamic action or stage is inserted. The zero value
+// inserts it after the current action or stage and after the dynamic ones
+// added before it, as AddDynamicAction and AddDynamicStage do.
+type Placement struct {
+	kind   placementKind
+	target string
+	index  int
+}
+
+// PlaceNext inserts right after the current action or stage, before the
+// dynamic ones added earlier.
+func PlaceNext() Placement {
+	return Placement{kind: placeNext}
+}
+
+// PlaceBefore inserts right before the action with the given name, or the
+// stage with the given ID, which must not have run yet.
+func PlaceBefore(name string) Placement {
+	return Placement{kind: placeBefore, target: name}
+}
+
+// PlaceAfter inserts right after the action with the given name, or the
+// stage with the given ID, which must be the current one or not have run yet.
+func PlaceAfter(name string) Placement {
+	return Placement{kind: placeAfter, target: name}
+}
+
+// PlaceAt inserts at index in the actions of the stage, or the stages of the
+// workflow. The index must come after the current action or stage.
+func PlaceAt(index int) Placement {
+	return Placement{kind: placeAt, index: index}
+}
+
+// AddDynamicActionAt adds an action to the current stage at the given placement.
+// An invalid placement fails the current action once it completed.
+func (ctx *ActionContext) AddDynamicActionAt(action Action, placement Placement) {
+	// Actions added without a placement keep the default one
+	for len(ctx.dynamicActionPlacements) < len(ctx.dynamicActions) {
+		ctx.dynamicActionPlacements = append(ctx.dynamicActionPlacements, Placement{})
+	}
+	ctx.dynamicActions = append(ctx.dynamicActions, action)
+	ctx.dynamicActionPlacements = append(ctx.dynamicActionPlacements, placement)
+}
+
+// AddDynamicStageAt adds a stage to the workflow at the given placement.
+// An invalid placement fails the current stage once it completed.
+func (ctx *ActionContext) AddDynamicStageAt(stage *Stage, placement Placement) {
+	stage.placement = placement
+	ctx.dynamicStages = append(ctx.dynamicStages, stage)
+}
+
+// DependsOn declares stages that must run before this stage when it is added
+// dynamically. The stage is then inserted after all of them, and adding it
+// fails if one of them is not part of the workflow.
+func (s *Stage) DependsOn(stageIDs ...string) {
+	s.dependencies = append(s.dependencies, stageIDs...)
+}
+
+// Dependencies returns the stages declared with DependsOn.
+func (s *Stage) Dependencies() []string {
+	return s.dependencies
+}
+
+// placeDynamic inserts items into list after the item at current, following
+// their placements, and returns the new list. Dependencies of an item, if
+// any, are the names of items it must be inserted after.
+func placeDynamic[T any](list []T, current int, items []T, placements []Placement, name func(T) string, dependencies func(T) []string) ([]T, error) {
+	find := func(target string) int {
+		for i, item := range list {
+			if name(item) == target {
+				return i
+			}
+		}
+		return -1
+	}
+
+	next := current + 1
+	for i, item := range items {
+		var placement Placement
+		if i < len(placements) {
+			placement = placements[i]
+		}
+
+		index := next
+		switch placement.kind {
+		case placeNext:
+			index = current + 1
+		case placeBefore, placeAfter:
+			index = find(placement.target)
+			if index < 0 {
+				return nil, fmt.Errorf("cannot place '%s': '%s' not found", name(item), placement.target)
+			}
+			if placement.kind == placeAfter {
+				index++
+			}
+		case placeAt:
+			index = placement.index
+		}
+		if index <= current || index > len(list) {
+			return nil, fmt.Errorf("cannot place '%s' at position %d: it must come after the current position %d and at most at %d",
+				name(item), index, current, len(list))
+		}
+
+		for _, dependency := range dependencies(item) {
+			at := find(dependency)
+			if at < 0 {
+				return nil, fmt.Errorf("'%s' depends on '%s' which is not part of the workflow", name(item), dependency)
+			}
+			if at < index {
+				continue
+			}
+			if placement.kind != placeDefault {
+				return nil, fmt.Errorf("'%s' depends on '%s' which comes after its placement", name(item), dependency)
+			}
+			index = at + 1
+		}
+
+		list = append(list, item)
+		copy(list[index+1:], list[index:])
+		list[index] = item
+		if index <= next {
+			next++
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,128 @@
+package gostage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordAction returns an action appending its name to ran.
+func recordAction(name string, ran *[]string) Action {
+	return NewActionFunc(name, "", func(ctx *ActionContext) error {
+		*ran = append(*ran, name)
+		return nil
+	})
+}
+
+func TestDynamicActionPlacement(t *testing.T) {
+	var ran []string
+	stage := NewStage("main", "Main", "")
+	stage.AddAction(NewActionFunc("generate", "", func(ctx *ActionContext) error {
+		ran = append(ran, "generate")
+		ctx.AddDynamicAction(recordAction("appended", &ran))
+		ctx.AddDynamicActionAt(recordAction("next", &ran), PlaceNext())
+		ctx.AddDynamicActionAt(recordAction("before-last", &ran), PlaceBefore("last"))
+		ctx.AddDynamicActionAt(recordAction("after-middle", &ran), PlaceAfter("middle"))
+		ctx.AddDynamicActionAt(recordAction("at-end", &ran), PlaceAt(7))
+		return nil
+	}))
+	stage.AddAction(recordAction("middle", &ran))
+	stage.AddAction(recordAction("last", &ran))
+
+	wf := NewWorkflow("place", "Place", "")
+	wf.AddStage(stage)
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, []string{"generate", "next", "appended", "middle", "after-middle", "before-last", "last", "at-end"}, ran)
+}
+
+func TestDynamicActionPlacementErrors(t *testing.T) {
+	for name, placement := range map[string]Placement{
+		"cannot place 'late': 'missing' not found":                                                      PlaceBefore("missing"),
+		"cannot place 'late' at position 0":                                                             PlaceBefore("first"),
+		"cannot place 'late' at position 5: it must come after the current position 1 and at most at 3": PlaceAt(5),
+	} {
+		stage := NewStage("main", "Main", "")
+		stage.AddAction(NewActionFunc("first", "", func(ctx *ActionContext) error { return nil }))
+		stage.AddAction(NewActionFunc("generate", "", func(ctx *ActionContext) error {
+			ctx.AddDynamicActionAt(NewActionFunc("late", "", func(ctx *ActionContext) error { return nil }), placement)
+			return nil
+		}))
+		stage.AddAction(NewActionFunc("last", "", func(ctx *ActionContext) error { return nil }))
+
+		wf := NewWorkflow("place", "Place", "")
+		wf.AddStage(stage)
+		result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+		assert.ErrorContains(t, result.Error, "action 'generate' failed to add dynamic actions: "+name)
+		assert.Equal(t, StatusFailed, result.ActionStatuses[ActionStatusKey("main", "generate")])
+	}
+}
+
+func TestDynamicStagePlacement(t *testing.T) {
+	var ran []string
+	stageOf := func(id string) *Stage {
+		stage := NewStage(id, id, "")
+		stage.AddAction(recordAction(id, &ran))
+		return stage
+	}
+
+	generate := NewStage("generate", "Generate", "")
+	generate.AddAction(NewActionFunc("first", "", func(ctx *ActionContext) error {
+		ctx.AddDynamicStage(stageOf("appended"))
+		ctx.AddDynamicStageAt(stageOf("before-deploy"), PlaceBefore("deploy"))
+		return nil
+	}))
+	generate.AddAction(NewActionFunc("second", "", func(ctx *ActionContext) error {
+		ctx.AddDynamicStageAt(stageOf("next"), PlaceNext())
+		verify := stageOf("verify")
+		verify.DependsOn("test", "deploy")
+		ctx.AddDynamicStage(verify)
+		return nil
+	}))
+
+	wf := NewWorkflow("place", "Place", "")
+	wf.AddStage(generate)
+	wf.AddStage(stageOf("test"))
+	wf.AddStage(stageOf("deploy"))
+	wf.AddStage(stageOf("notify"))
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, []string{"next", "appended", "test", "before-deploy", "deploy", "verify", "notify"}, ran)
+	assert.Equal(t, []string{"test", "deploy"}, wf.Stages[6].Dependencies())
+
+	order, err := wf.Store.GetProperty(PrefixStage+"verify", PropOrder)
+	require.NoError(t, err)
+	assert.Equal(t, 6, order)
+}
+
+func TestDynamicStageDependencyErrors(t *testing.T) {
+	for message, add := range map[string]func(ctx *ActionContext){
+		"'verify' depends on 'missing' which is not part of the workflow": func(ctx *ActionContext) {
+			verify := NewStage("verify", "Verify", "")
+			verify.DependsOn("missing")
+			ctx.AddDynamicStage(verify)
+		},
+		"'verify' depends on 'deploy' which comes after its placement": func(ctx *ActionContext) {
+			verify := NewStage("verify", "Verify", "")
+			verify.DependsOn("deploy")
+			ctx.AddDynamicStageAt(verify, PlaceNext())
+		},
+	} {
+		generate := NewStage("generate", "Generate", "")
+		generate.AddAction(NewActionFunc("add", "", func(ctx *ActionContext) error {
+			add(ctx)
+			return nil
+		}))
+		cleanup := NewStageWithTags("cleanup", "Cleanup", "", []string{TagAlwaysRun})
+
+		wf := NewWorkflow("place", "Place", "")
+		wf.AddStage(generate)
+		wf.AddStage(NewStage("deploy", "Deploy", ""))
+		wf.AddStage(cleanup)
+		result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+		assert.ErrorContains(t, result.Error, "failed to add dynamic stages of stage 'Generate': "+message)
+		assert.Equal(t, StatusCompleted, result.StageStatuses["cleanup"])
+		assert.NotContains(t, result.StageStatuses, "deploy")
+	}
+}
@@ -0,0 +1,36 @@
+// Package plugins extends a deployed gostage service with actions it was not
+// compiled with, registering them into an ActionRegistry.
+//
+// A Loader loads two kinds of action providers. Shared objects, built with
+// go build -buildmode=plugin, export a RegisterActions function that registers
+// their actions, which then run in the service's process:
+//
+//	func RegisterActions(registry *gostage.ActionRegistry) error {
+//		return registry.Register("resize-image", newResizeImage)
+//	}
+//
+// Shared objects must be built with the same Go toolchain and the same
+// versions of the packages they share with the service, gostage included, and
+// only load on the platforms supported by the standard plugin package.
+//
+// Plugin binaries are programs calling Serve with a registry of their own.
+// They run as separate processes managed with hashicorp/go-plugin, and their
+// actions are registered as proxies that execute them over gRPC:
+//
+//	func main() {
+//		registry := gostage.NewActionRegistry()
+//		registry.Register("resize-image", newResizeImage)
+//		plugins.Serve(registry)
+//	}
+//
+// A proxy sends its action the data of the store it may read, and applies
+// the store changes and logs of the action as they stream back, the way
+// gostage.DispatchAction does. Binaries can be built with any toolchain and
+// crash without taking the service down.
+//
+// LoadDir loads every shared object and plugin binary of a directory:
+//
+//	loader := plugins.NewLoader(gostage.DefaultActionRegistry())
+//	defer loader.Close()
+//	ids, err := loader.LoadDir("/etc/gostage/plugins")
+package plugins
@@ -0,0 +1,219 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-plugin"
+	"google.golang.org/grpc"
+)
+
+// Loader registers the actions of shared objects and plugin binaries into an
+// action registry, and manages the processes of the binaries it started.
+type Loader struct {
+	registry *gostage.ActionRegistry
+
+	mu      sync.Mutex
+	clients []*plugin.Client
+}
+
+// NewLoader creates a loader registering actions into registry, or into the
+// default registry if registry is nil.
+func NewLoader(registry *gostage.ActionRegistry) *Loader {
+	if registry == nil {
+		registry = gostage.DefaultActionRegistry()
+	}
+	return &Loader{registry: registry}
+}
+
+// LoadBinary starts the plugin binary at path with args and registers its
+// actions, returning their IDs. The actions run in the plugin process, which
+// keeps running until Close is called.
+func (l *Loader) LoadBinary(path string, args ...string) ([]string, error) {
+	client := plugin.NewClient(&plugin.ClientConfig{
+		HandshakeConfig:  Handshake,
+		Plugins:          plugin.PluginSet{pluginName: &actionsPlugin{}},
+		Cmd:              exec.Command(path, args...),
+		AllowedProtocols: []plugin.Protocol{plugin.ProtocolGRPC},
+		Logger:           hclog.New(&hclog.LoggerOptions{Name: "gostage-plugin", Level: hclog.Warn}),
+	})
+
+	provider, infos, err := connect(client)
+	if err != nil {
+		client.Kill()
+		return nil, fmt.Errorf("failed to load plugin %s: %w", path, err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.clients = append(l.clients, client)
+
+	var ids []string
+	for _, info := range infos {
+		if err := l.registry.RegisterWithParams(info.ID, provider.factory(info)); err != nil {
+			return ids, fmt.Errorf("failed to register the actions of plugin %s: %w", path, err)
+		}
+		ids = append(ids, info.ID)
+	}
+	return ids, nil
+}
+
+// connect starts the process of client and lists the actions it provides.
+func connect(client *plugin.Client) (*providerClient, []actionInfo, error) {
+	protocol, err := client.Client()
+	if err != nil {
+		return nil, nil, err
+	}
+	raw, err := protocol.Dispense(pluginName)
+	if err != nil {
+		return nil, nil, err
+	}
+	provider := raw.(*providerClient)
+
+	var resp actionsResponse
+	if err := provider.conn.Invoke(context.Background(), actionsMethod, &actionsRequest{}, &resp, grpc.CallContentSubtype(codecName)); err != nil {
+		return nil, nil, fmt.Errorf("failed to list actions: %w", err)
+	}
+	return provider, resp.Actions, nil
+}
+
+// LoadDir loads the shared objects, ending in .so, and the executable files of
+// dir as plugin binaries, in the order of their names. It returns the IDs of
+// the actions registered, including those of the plugins loaded before an
+// error stopped it.
+func (l *Loader) LoadDir(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugin directory: %w", err)
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+
+		var loaded []string
+		switch {
+		case filepath.Ext(path) == ".so":
+			loaded, err = l.LoadShared(path)
+		case info.Mode()&0o111 != 0:
+			loaded, err = l.LoadBinary(path)
+		default:
+			continue
+		}
+		ids = append(ids, loaded...)
+		if err != nil {
+			return ids, err
+		}
+	}
+	return ids, nil
+}
+
+// Close stops the plugin binaries started by the loader. Their actions stay
+// registered but fail when executed.
+func (l *Loader) Close() {
+	l.mu.Lock()
+	clients := l.clients
+	l.clients = nil
+	l.mu.Unlock()
+
+	for _, client := range clients {
+		client.Kill()
+	}
+}
+
+// providerClient is the loader's side of a connection to a plugin binary. It
+// runs definitions in the plugin as a gostage.StageDispatcher.
+type providerClient struct {
+	conn *grpc.ClientConn
+}
+
+// factory returns the factory of the proxies of the plugin action described by info.
+func (p *providerClient) factory(info actionInfo) gostage.ActionParamsFactory {
+	name := info.Name
+	if name == "" {
+		name = info.ID
+	}
+	return func(params map[string]interface{}) (gostage.Action, error) {
+		return &pluginAction{
+			BaseAction: gostage.NewBaseActionWithTags(name, info.Description, info.Tags),
+			provider:   p,
+			id:         info.ID,
+			params:     params,
+		}, nil
+	}
+}
+
+// Dispatch runs def in the plugin, feeding the output it streams back to broker.
+func (p *providerClient) Dispatch(ctx context.Context, def gostage.SubWorkflowDef, broker *gostage.RunnerBroker) error {
+	data, err := json.Marshal(def)
+	if err != nil {
+		return fmt.Errorf("failed to serialize workflow definition: %w", err)
+	}
+
+	stream, err := p.conn.NewStream(ctx, &serviceDesc.Streams[0], runMethod, grpc.CallContentSubtype(codecName))
+	if err != nil {
+		return fmt.Errorf("failed to reach plugin: %w", err)
+	}
+	if err := stream.SendMsg(&runRequest{Definition: data}); err != nil {
+		return fmt.Errorf("failed to send workflow definition to plugin: %w", err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		return fmt.Errorf("failed to send workflow definition to plugin: %w", err)
+	}
+
+	reader, writer := io.Pipe()
+	listened := make(chan struct{})
+	go func() {
+		defer close(listened)
+		if err := broker.Listen(reader); err != nil {
+			// Keep draining so that the plugin's stream is not blocked
+			io.Copy(io.Discard, reader)
+		}
+	}()
+
+	for {
+		var msg outputMessage
+		if err = stream.RecvMsg(&msg); err != nil {
+			break
+		}
+		if _, err = writer.Write(msg.Data); err != nil {
+			break
+		}
+	}
+	writer.Close()
+	<-listened
+
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return fmt.Errorf("lost connection to plugin: %w", err)
+}
+
+// pluginAction executes an action of a plugin binary.
+type pluginAction struct {
+	gostage.BaseAction
+	provider *providerClient
+	id       string
+	params   map[string]interface{}
+}
+
+// Execute implements gostage.Action
+func (a *pluginAction) Execute(ctx *gostage.ActionContext) error {
+	return gostage.DispatchAction(ctx, a.provider, a.id, a.params)
+}
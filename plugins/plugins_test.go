@@ -0,0 +1,165 @@
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/debug"
+	"testing"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/davidroman0O/gostage/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// servePluginEnv makes the test binary serve the actions of pluginRegistry,
+// so that the tests can load it as a plugin binary.
+const servePluginEnv = "GOSTAGE_TEST_SERVE_PLUGIN"
+
+type greetParams struct {
+	Greeting string `json:"greeting"`
+}
+
+type greetAction struct {
+	gostage.BaseAction
+	greeting string
+}
+
+func (a *greetAction) Execute(ctx *gostage.ActionContext) error {
+	name, err := store.Get[string](ctx.Store(), "name")
+	if err != nil {
+		return err
+	}
+	ctx.Logger.Info("Greeting %s", name)
+	if err := ctx.Store().Put("greeting", fmt.Sprintf("%s, %s", a.greeting, name)); err != nil {
+		return err
+	}
+	return ctx.Store().Put("pid", os.Getpid())
+}
+
+type failAction struct{ gostage.BaseAction }
+
+func (a *failAction) Execute(ctx *gostage.ActionContext) error {
+	return errors.New("plugin action failed")
+}
+
+func pluginRegistry() *gostage.ActionRegistry {
+	registry := gostage.NewActionRegistry()
+	gostage.RegisterTyped(registry, "greet", func(params greetParams) (gostage.Action, error) {
+		return &greetAction{BaseAction: gostage.NewBaseActionWithTags("greet", "Greets the name in the store", []string{"plugin"}), greeting: params.Greeting}, nil
+	})
+	registry.Register("fail", func() gostage.Action {
+		return &failAction{BaseAction: gostage.NewBaseAction("fail", "Always fails")}
+	})
+	return registry
+}
+
+func TestMain(m *testing.M) {
+	if os.Getenv(servePluginEnv) != "" {
+		Serve(pluginRegistry())
+		return
+	}
+	os.Exit(m.Run())
+}
+
+func runAction(t *testing.T, action gostage.Action, setup func(s *store.KVStore)) gostage.RunResult {
+	t.Helper()
+	wf := gostage.NewWorkflow("plugins", "Plugins", "")
+	stage := gostage.NewStage("main", "Main", "")
+	stage.AddAction(action)
+	wf.AddStage(stage)
+	if setup != nil {
+		setup(wf.Store)
+	}
+	return gostage.NewRunner().ExecuteWithOptions(wf, gostage.DefaultRunOptions())
+}
+
+func TestLoadBinary(t *testing.T) {
+	t.Setenv(servePluginEnv, "1")
+	registry := gostage.NewActionRegistry()
+	loader := NewLoader(registry)
+	defer loader.Close()
+
+	ids, err := loader.LoadBinary(os.Args[0])
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"greet", "fail"}, ids)
+
+	action, err := registry.Resolve("greet", map[string]interface{}{"greeting": "Hello"})
+	require.NoError(t, err)
+	assert.Equal(t, "greet", action.Name())
+	assert.Equal(t, "Greets the name in the store", action.Description())
+	assert.Contains(t, action.Tags(), "plugin")
+
+	result := runAction(t, action, func(s *store.KVStore) {
+		require.NoError(t, s.Put("name", "Ada"))
+	})
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, "Hello, Ada", result.FinalStore["greeting"])
+	assert.NotEqual(t, float64(os.Getpid()), result.FinalStore["pid"], "the action must run in the plugin process")
+
+	action, err = registry.Resolve("fail", nil)
+	require.NoError(t, err)
+	result = runAction(t, action, nil)
+	require.Error(t, result.Error)
+	assert.Contains(t, result.Error.Error(), "plugin action failed")
+
+	// Actions fail once their plugin is closed
+	loader.Close()
+	action, err = registry.Resolve("greet", nil)
+	require.NoError(t, err)
+	result = runAction(t, action, func(s *store.KVStore) {
+		require.NoError(t, s.Put("name", "Ada"))
+	})
+	assert.Error(t, result.Error)
+}
+
+func TestLoadBinaryWithoutHandshake(t *testing.T) {
+	loader := NewLoader(gostage.NewActionRegistry())
+	defer loader.Close()
+
+	_, err := loader.LoadBinary("/bin/true")
+	assert.Error(t, err)
+}
+
+func TestLoadShared(t *testing.T) {
+	dir := t.TempDir()
+	// Shared objects must be built as the binary opening them is
+	args := []string{"build", "-buildmode=plugin", "-o", filepath.Join(dir, "hello.so")}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "-race" && setting.Value == "true" {
+				args = append(args, "-race")
+			}
+		}
+	}
+	build := exec.Command("go", append(args, "./testdata/shared")...)
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Skipf("cannot build shared objects here: %v\n%s", err, out)
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README"), []byte("not a plugin"), 0o644))
+
+	registry := gostage.NewActionRegistry()
+	loader := NewLoader(registry)
+	defer loader.Close()
+
+	ids, err := loader.LoadDir(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"shared-hello"}, ids)
+
+	action, err := registry.Resolve("shared-hello", nil)
+	require.NoError(t, err)
+	result := runAction(t, action, nil)
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, "from a shared object", result.FinalStore["hello"])
+
+	_, err = loader.LoadShared(filepath.Join(dir, "README"))
+	assert.Error(t, err)
+}
+
+func TestLoadDirMissing(t *testing.T) {
+	_, err := NewLoader(nil).LoadDir(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
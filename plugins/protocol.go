@@ -0,0 +1,96 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// codecName is the content subtype of the JSON codec used between a Loader
+// and its plugin binaries.
+const codecName = "gostage-plugin-json"
+
+// jsonCodec encodes gRPC messages as JSON instead of protocol buffers.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                               { return codecName }
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// actionsRequest asks a plugin for the actions it provides.
+type actionsRequest struct{}
+
+// actionsResponse lists the actions of a plugin.
+type actionsResponse struct {
+	Actions []actionInfo `json:"actions"`
+}
+
+// actionInfo describes an action of a plugin, as built without parameters.
+type actionInfo struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+}
+
+// runRequest asks a plugin to run a serialized workflow definition.
+type runRequest struct {
+	Definition json.RawMessage `json:"definition"`
+}
+
+// outputMessage carries a chunk of the IPC stream written while running a definition.
+type outputMessage struct {
+	Data []byte `json:"data"`
+}
+
+// providerService is implemented by the plugin side to serve a Loader.
+type providerService interface {
+	actions(ctx context.Context) (*actionsResponse, error)
+	run(req *runRequest, stream grpc.ServerStream) error
+}
+
+const (
+	// actionsMethod is the full name of the call listing the actions of a plugin.
+	actionsMethod = "/gostage.plugins.Provider/Actions"
+	// runMethod is the full name of the stream running a definition in a plugin.
+	runMethod = "/gostage.plugins.Provider/Run"
+)
+
+// serviceDesc describes the provider service: a call listing the actions of
+// the plugin, and a stream per run over which the output comes back.
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "gostage.plugins.Provider",
+	HandlerType: (*providerService)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Actions",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				var req actionsRequest
+				if err := dec(&req); err != nil {
+					return nil, err
+				}
+				return srv.(providerService).actions(ctx)
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "Run",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				var req runRequest
+				if err := stream.RecvMsg(&req); err != nil {
+					return err
+				}
+				return srv.(providerService).run(&req, stream)
+			},
+			ServerStreams: true,
+		},
+	},
+	Metadata: "gostage/plugins",
+}
@@ -0,0 +1,92 @@
+package plugins
+
+import (
+	"context"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/hashicorp/go-plugin"
+	"google.golang.org/grpc"
+)
+
+// Handshake is the go-plugin handshake between a Loader and the binaries
+// calling Serve. A binary started by anything else refuses to serve.
+var Handshake = plugin.HandshakeConfig{
+	ProtocolVersion:  1,
+	MagicCookieKey:   "GOSTAGE_PLUGIN",
+	MagicCookieValue: "gostage-actions",
+}
+
+// pluginName is the name under which plugin binaries serve their actions.
+const pluginName = "actions"
+
+// Serve serves the actions of registry, or of the default registry if
+// registry is nil, to the Loader that started the binary, running them with a
+// runner configured by opts. It returns when the loader closes the plugin.
+func Serve(registry *gostage.ActionRegistry, opts ...gostage.RunnerOption) {
+	if registry == nil {
+		registry = gostage.DefaultActionRegistry()
+	}
+
+	plugin.Serve(&plugin.ServeConfig{
+		HandshakeConfig: Handshake,
+		Plugins: plugin.PluginSet{
+			pluginName: &actionsPlugin{provider: &provider{registry: registry, runnerOptions: opts}},
+		},
+		GRPCServer: plugin.DefaultGRPCServer,
+	})
+}
+
+// actionsPlugin connects both sides of a plugin binary through go-plugin.
+type actionsPlugin struct {
+	plugin.NetRPCUnsupportedPlugin
+	// provider is set on the plugin side only
+	provider *provider
+}
+
+func (p *actionsPlugin) GRPCServer(_ *plugin.GRPCBroker, s *grpc.Server) error {
+	s.RegisterService(&serviceDesc, p.provider)
+	return nil
+}
+
+func (p *actionsPlugin) GRPCClient(_ context.Context, _ *plugin.GRPCBroker, conn *grpc.ClientConn) (interface{}, error) {
+	return &providerClient{conn: conn}, nil
+}
+
+// provider runs the actions of a registry on the plugin side.
+type provider struct {
+	registry      *gostage.ActionRegistry
+	runnerOptions []gostage.RunnerOption
+}
+
+func (p *provider) actions(context.Context) (*actionsResponse, error) {
+	resp := &actionsResponse{}
+	for _, id := range p.registry.IDs() {
+		info := actionInfo{ID: id}
+		// Actions requiring parameters are described by their ID alone
+		if action, err := p.registry.Resolve(id, nil); err == nil {
+			info.Name = action.Name()
+			info.Description = action.Description()
+			info.Tags = action.Tags()
+		}
+		resp.Actions = append(resp.Actions, info)
+	}
+	return resp, nil
+}
+
+func (p *provider) run(req *runRequest, stream grpc.ServerStream) error {
+	// The outcome of the run reaches the loader through the output
+	gostage.RunDefinition(stream.Context(), req.Definition, &streamWriter{stream: stream}, p.registry, p.runnerOptions...)
+	return nil
+}
+
+// streamWriter sends what is written to it as output messages.
+type streamWriter struct {
+	stream grpc.ServerStream
+}
+
+func (w *streamWriter) Write(data []byte) (int, error) {
+	if err := w.stream.SendMsg(&outputMessage{Data: data}); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
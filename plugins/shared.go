@@ -0,0 +1,48 @@
+package plugins
+
+import (
+	"fmt"
+	"plugin"
+	"slices"
+
+	"github.com/davidroman0O/gostage"
+)
+
+// RegisterSymbol is the name of the function through which shared objects
+// register their actions. Its type must be func(*gostage.ActionRegistry) error.
+const RegisterSymbol = "RegisterActions"
+
+// LoadShared opens the shared object at path and calls its RegisterActions
+// function with the registry of the loader, returning the IDs of the actions
+// it registered. The actions run in the current process, and a shared object
+// cannot be unloaded.
+func (l *Loader) LoadShared(path string) ([]string, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open plugin %s: %w", path, err)
+	}
+	symbol, err := p.Lookup(RegisterSymbol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load plugin %s: %w", path, err)
+	}
+	register, ok := symbol.(func(*gostage.ActionRegistry) error)
+	if !ok {
+		return nil, fmt.Errorf("failed to load plugin %s: %s is a %T, not a func(*gostage.ActionRegistry) error", path, RegisterSymbol, symbol)
+	}
+
+	// The registrations of the shared object are told apart by comparing the IDs
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	before := l.registry.IDs()
+	err = register(l.registry)
+	var ids []string
+	for _, id := range l.registry.IDs() {
+		if !slices.Contains(before, id) {
+			ids = append(ids, id)
+		}
+	}
+	if err != nil {
+		return ids, fmt.Errorf("plugin %s failed to register its actions: %w", path, err)
+	}
+	return ids, nil
+}
@@ -0,0 +1,19 @@
+// Command shared is a shared object providing an action to the plugin tests.
+package main
+
+import "github.com/davidroman0O/gostage"
+
+type helloAction struct{ gostage.BaseAction }
+
+func (a *helloAction) Execute(ctx *gostage.ActionContext) error {
+	return ctx.Store().Put("hello", "from a shared object")
+}
+
+// RegisterActions registers the actions of the shared object.
+func RegisterActions(registry *gostage.ActionRegistry) error {
+	return registry.Register("shared-hello", func() gostage.Action {
+		return &helloAction{BaseAction: gostage.NewBaseAction("shared-hello", "Says hello from a shared object")}
+	})
+}
+
+func main() {}
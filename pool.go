@@ -0,0 +1,293 @@
+package gostage
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// ErrRunnerClosed is returned when a workflow is submitted to a closed runner.
+var ErrRunnerClosed = errors.New("runner is closed")
+
+// Job is a workflow submitted to the runner's worker pool.
+type Job struct {
+	// Workflow is the submitted workflow
+	Workflow *Workflow
+	// SubmittedAt is when the workflow was queued
+	SubmittedAt time.Time
+	// Priority is the scheduling priority from RunOptions.Priority
+	Priority int
+	// Labels are the labels of the run from RunOptions.Labels
+	Labels map[string]string
+
+	run    func()
+	pool   *workerPool
+	clock  Clock
+	seq    uint64
+	done   chan struct{}
+	result RunResult
+}
+
+// Done returns a channel that is closed once the workflow has finished.
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Wait blocks until the workflow has finished and returns its result.
+func (j *Job) Wait() RunResult {
+	<-j.done
+	return j.result
+}
+
+// Result returns the result of the workflow and whether it has finished.
+func (j *Job) Result() (RunResult, bool) {
+	select {
+	case <-j.done:
+		return j.result, true
+	default:
+		return RunResult{}, false
+	}
+}
+
+// jobContextKey carries the Job of a preemptible workflow in its context.
+type jobContextKey struct{}
+
+// queueEntry is a job waiting for a worker, either to start or, after
+// yielding at a preemption point, to resume.
+type queueEntry struct {
+	job    *Job
+	resume chan struct{}
+}
+
+// jobQueue is a heap of entries ordered by priority, then submission order.
+type jobQueue []*queueEntry
+
+func (q jobQueue) Len() int { return len(q) }
+
+func (q jobQueue) Less(i, j int) bool {
+	if q[i].job.Priority != q[j].job.Priority {
+		return q[i].job.Priority > q[j].job.Priority
+	}
+	return q[i].job.seq < q[j].job.seq
+}
+
+func (q jobQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *jobQueue) Push(x any) { *q = append(*q, x.(*queueEntry)) }
+
+func (q *jobQueue) Pop() any {
+	old := *q
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return entry
+}
+
+// workerPool executes submitted jobs on a bounded number of slots, highest
+// priority first and in submission order within a priority.
+type workerPool struct {
+	mu      sync.Mutex
+	queue   jobQueue
+	size    int
+	running int
+	closed  bool
+	seq     uint64
+	wg      sync.WaitGroup
+}
+
+// newWorkerPool creates a pool running at most size jobs at once.
+// A size of zero or less uses one worker per CPU.
+func newWorkerPool(size int) *workerPool {
+	if size <= 0 {
+		size = runtime.NumCPU()
+	}
+	return &workerPool{size: size}
+}
+
+// submit queues a job.
+func (p *workerPool) submit(job *Job) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return ErrRunnerClosed
+	}
+
+	p.seq++
+	job.seq = p.seq
+	job.pool = p
+	p.wg.Add(1)
+	heap.Push(&p.queue, &queueEntry{job: job})
+	p.dispatch()
+	return nil
+}
+
+// dispatch hands free slots to the queued entries. It must be called with mu held.
+func (p *workerPool) dispatch() {
+	for p.running < p.size && len(p.queue) > 0 {
+		entry := heap.Pop(&p.queue).(*queueEntry)
+		p.running++
+		if entry.resume != nil {
+			close(entry.resume)
+		} else {
+			go p.execute(entry.job)
+		}
+	}
+}
+
+// execute runs a job in its slot and hands the slot on when it finishes.
+func (p *workerPool) execute(job *Job) {
+	defer p.wg.Done()
+
+	job.run()
+
+	p.mu.Lock()
+	p.running--
+	p.dispatch()
+	p.mu.Unlock()
+}
+
+// yield gives the slot of a running job to higher-priority queued work, if
+// there is any, and blocks until the job gets a slot back. It reports whether
+// the job yielded.
+func (p *workerPool) yield(job *Job) bool {
+	p.mu.Lock()
+	if len(p.queue) == 0 || p.queue[0].job.Priority <= job.Priority {
+		p.mu.Unlock()
+		return false
+	}
+
+	resume := make(chan struct{})
+	heap.Push(&p.queue, &queueEntry{job: job, resume: resume})
+	p.running--
+	p.dispatch()
+	p.mu.Unlock()
+
+	<-resume
+	return true
+}
+
+// close stops accepting jobs and waits for the queued and running ones to finish.
+func (p *workerPool) close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
+
+// stats returns the number of queued and running jobs.
+func (p *workerPool) stats() (queued, running int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.queue), p.running
+}
+
+// WithMaxConcurrentWorkflows limits how many submitted workflows the runner
+// executes at once. Zero or less uses one worker per CPU.
+func WithMaxConcurrentWorkflows(n int) RunnerOption {
+	return func(r *Runner) {
+		r.pool = newWorkerPool(n)
+	}
+}
+
+// Submit queues a workflow for execution on the runner's worker pool with the
+// runner's default options, adjusted by opts such as WithRunLabels. Workflows
+// with a higher RunOptions.Priority start first. Workflows of equal priority
+// start in submission order.
+func (r *Runner) Submit(workflow *Workflow, opts ...SubmitOption) (*Job, error) {
+	options := r.options
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return r.SubmitWithOptions(workflow, options)
+}
+
+// SubmitWithOptions queues a workflow for execution on the runner's worker pool.
+func (r *Runner) SubmitWithOptions(workflow *Workflow, options RunOptions) (*Job, error) {
+	if workflow == nil {
+		return nil, fmt.Errorf("cannot submit a nil workflow")
+	}
+
+	job := &Job{
+		Workflow:    workflow,
+		SubmittedAt: r.now(),
+		Priority:    options.Priority,
+		Labels:      options.Labels,
+		clock:       r.Clock(),
+		done:        make(chan struct{}),
+	}
+	job.run = func() { r.runJob(job, options) }
+	if err := r.pool.submit(job); err != nil {
+		return nil, fmt.Errorf("failed to submit workflow '%s': %w", workflow.ID, err)
+	}
+	return job, nil
+}
+
+// runJob executes a job, turning a panic into a failed result so that one
+// workflow cannot bring down the pool.
+func (r *Runner) runJob(job *Job, options RunOptions) {
+	defer close(job.done)
+	defer func() {
+		if p := recover(); p != nil {
+			// The run ID is left in the context when the run panicked after it started
+			runID, _ := job.Workflow.Context[contextRunID].(string)
+			if runID == "" {
+				runID = newRunID()
+			}
+			delete(job.Workflow.Context, contextRunID)
+			job.result = RunResult{
+				RunID:      runID,
+				WorkflowID: job.Workflow.ID,
+				Error:      fmt.Errorf("workflow '%s' panicked: %v", job.Workflow.ID, p),
+			}
+		}
+	}()
+
+	if options.Preemptible {
+		ctx := options.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		options.Context = context.WithValue(ctx, jobContextKey{}, job)
+	}
+	job.result = r.ExecuteWithOptions(job.Workflow, options)
+}
+
+// preemptionPoint lets a preemptible submitted workflow hand its worker to
+// higher-priority workflows before its next stage.
+func preemptionPoint(ctx context.Context, logger Logger) {
+	job, ok := ctx.Value(jobContextKey{}).(*Job)
+	if !ok {
+		return
+	}
+
+	start := job.clock.Now()
+	if job.pool.yield(job) {
+		logger.Info("Resumed workflow after yielding to higher-priority workflows for %s", job.clock.Now().Sub(start))
+	}
+}
+
+// QueuedWorkflows returns the number of submitted workflows waiting for a worker.
+func (r *Runner) QueuedWorkflows() int {
+	queued, _ := r.pool.stats()
+	return queued
+}
+
+// RunningWorkflows returns the number of submitted workflows being executed.
+func (r *Runner) RunningWorkflows() int {
+	_, running := r.pool.stats()
+	return running
+}
+
+// Close stops accepting submissions and waits for the queued and running
+// workflows to finish. Pending delayed runs are not started; they stay in the
+// schedule backend, if any, to be restored later.
+func (r *Runner) Close() {
+	r.stopDelayed()
+	r.pool.close()
+}
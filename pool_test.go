@@ -0,0 +1,234 @@
+package gostage
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPoolWorkflow(id string, fn func(ctx *ActionContext) error) *Workflow {
+	wf := NewWorkflow(id, id, "")
+	stage := NewStage("stage", "Stage", "")
+	stage.AddAction(NewTestAction("action", "", fn))
+	wf.AddStage(stage)
+	return wf
+}
+
+func TestSubmitBoundedConcurrency(t *testing.T) {
+	runner := NewRunner(WithMaxConcurrentWorkflows(2))
+
+	var current, peak int32
+	release := make(chan struct{})
+	var jobs []*Job
+	for i := 0; i < 6; i++ {
+		job, err := runner.Submit(newPoolWorkflow(fmt.Sprintf("wf-%d", i), func(ctx *ActionContext) error {
+			n := atomic.AddInt32(&current, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			<-release
+			atomic.AddInt32(&current, -1)
+			return nil
+		}))
+		require.NoError(t, err)
+		jobs = append(jobs, job)
+	}
+
+	require.Eventually(t, func() bool { return runner.RunningWorkflows() == 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, 4, runner.QueuedWorkflows())
+	_, finished := jobs[0].Result()
+	assert.False(t, finished)
+
+	close(release)
+	for _, job := range jobs {
+		assert.True(t, job.Wait().Success)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&peak))
+	assert.Equal(t, 0, runner.QueuedWorkflows())
+}
+
+func TestSubmitFIFOOrder(t *testing.T) {
+	runner := NewRunner(WithMaxConcurrentWorkflows(1))
+
+	var mu sync.Mutex
+	var order []string
+	var jobs []*Job
+	for i := 0; i < 5; i++ {
+		id := fmt.Sprintf("wf-%d", i)
+		job, err := runner.Submit(newPoolWorkflow(id, func(ctx *ActionContext) error {
+			mu.Lock()
+			order = append(order, ctx.Workflow.ID)
+			mu.Unlock()
+			return nil
+		}))
+		require.NoError(t, err)
+		jobs = append(jobs, job)
+	}
+	runner.Close()
+
+	for _, job := range jobs {
+		_, finished := job.Result()
+		assert.True(t, finished)
+	}
+	assert.Equal(t, []string{"wf-0", "wf-1", "wf-2", "wf-3", "wf-4"}, order)
+}
+
+func TestSubmitFailuresAndPanics(t *testing.T) {
+	runner := NewRunner(WithMaxConcurrentWorkflows(1))
+
+	failing, err := runner.Submit(newPoolWorkflow("failing", func(ctx *ActionContext) error {
+		return errors.New("boom")
+	}))
+	require.NoError(t, err)
+	panicking, err := runner.Submit(newPoolWorkflow("panicking", func(ctx *ActionContext) error {
+		panic("kaboom")
+	}))
+	require.NoError(t, err)
+	healthy, err := runner.Submit(newPoolWorkflow("healthy", func(ctx *ActionContext) error {
+		return nil
+	}))
+	require.NoError(t, err)
+
+	result := failing.Wait()
+	assert.False(t, result.Success)
+	assert.Contains(t, result.Error.Error(), "boom")
+
+	result = panicking.Wait()
+	assert.False(t, result.Success)
+	assert.Equal(t, "panicking", result.WorkflowID)
+	assert.Contains(t, result.Error.Error(), "kaboom")
+	assert.NotEmpty(t, result.RunID)
+	assert.NotContains(t, panicking.Workflow.Context, contextRunID)
+
+	assert.True(t, healthy.Wait().Success)
+}
+
+// fixedClock is a clock stopped at now.
+type fixedClock struct {
+	systemClock
+	now time.Time
+}
+
+func (c fixedClock) Now() time.Time { return c.now }
+
+func TestSubmitUsesRunnerClock(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	runner := NewRunner(WithMaxConcurrentWorkflows(1), WithClock(fixedClock{now: now}))
+
+	job, err := runner.Submit(newPoolWorkflow("clocked", func(ctx *ActionContext) error {
+		return nil
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, now, job.SubmittedAt)
+	assert.True(t, job.Wait().Success)
+}
+
+func TestSubmitAfterClose(t *testing.T) {
+	runner := NewRunner()
+	runner.Close()
+
+	_, err := runner.Submit(newPoolWorkflow("late", func(ctx *ActionContext) error { return nil }))
+	assert.ErrorIs(t, err, ErrRunnerClosed)
+
+	_, err = runner.Submit(nil)
+	assert.Error(t, err)
+}
+
+func TestSubmitPriority(t *testing.T) {
+	runner := NewRunner(WithMaxConcurrentWorkflows(1))
+
+	release := make(chan struct{})
+	blocker, err := runner.Submit(newPoolWorkflow("blocker", func(ctx *ActionContext) error {
+		<-release
+		return nil
+	}))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return runner.RunningWorkflows() == 1 }, time.Second, time.Millisecond)
+
+	var mu sync.Mutex
+	var order []string
+	record := func(ctx *ActionContext) error {
+		mu.Lock()
+		order = append(order, ctx.Workflow.ID)
+		mu.Unlock()
+		return nil
+	}
+	for _, submission := range []struct {
+		id       string
+		priority int
+	}{{"bulk-1", 0}, {"urgent", 10}, {"normal", 5}, {"bulk-2", 0}} {
+		job, err := runner.SubmitWithOptions(newPoolWorkflow(submission.id, record), RunOptions{Priority: submission.priority})
+		require.NoError(t, err)
+		assert.Equal(t, submission.priority, job.Priority)
+	}
+	assert.Equal(t, 4, runner.QueuedWorkflows())
+
+	close(release)
+	assert.True(t, blocker.Wait().Success)
+	runner.Close()
+	assert.Equal(t, []string{"urgent", "normal", "bulk-1", "bulk-2"}, order)
+}
+
+func TestSubmitPreemption(t *testing.T) {
+	for _, preemptible := range []bool{true, false} {
+		t.Run(fmt.Sprintf("preemptible=%v", preemptible), func(t *testing.T) {
+			runner := NewRunner(WithMaxConcurrentWorkflows(1))
+
+			var mu sync.Mutex
+			var order []string
+			record := func(step string) {
+				mu.Lock()
+				order = append(order, step)
+				mu.Unlock()
+			}
+
+			started := make(chan struct{})
+			release := make(chan struct{})
+			batch := NewWorkflow("batch", "Batch", "")
+			first := NewStage("first", "First", "")
+			first.AddAction(NewTestAction("work", "", func(ctx *ActionContext) error {
+				record("batch:first")
+				close(started)
+				<-release
+				return nil
+			}))
+			second := NewStage("second", "Second", "")
+			second.AddAction(NewTestAction("work", "", func(ctx *ActionContext) error {
+				record("batch:second")
+				return nil
+			}))
+			batch.AddStage(first)
+			batch.AddStage(second)
+
+			batchJob, err := runner.SubmitWithOptions(batch, RunOptions{Preemptible: preemptible})
+			require.NoError(t, err)
+			<-started
+
+			urgent, err := runner.SubmitWithOptions(newPoolWorkflow("urgent", func(ctx *ActionContext) error {
+				record("urgent")
+				return nil
+			}), RunOptions{Priority: 10})
+			require.NoError(t, err)
+
+			close(release)
+			assert.True(t, batchJob.Wait().Success)
+			assert.True(t, urgent.Wait().Success)
+
+			if preemptible {
+				assert.Equal(t, []string{"batch:first", "urgent", "batch:second"}, order)
+			} else {
+				assert.Equal(t, []string{"batch:first", "batch:second", "urgent"}, order)
+			}
+			assert.Equal(t, 0, runner.RunningWorkflows())
+		})
+	}
+}
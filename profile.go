@@ -0,0 +1,203 @@
+package gostage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrRunProfileNotFound is returned when a profile file has no profile of the requested name.
+var ErrRunProfileNotFound = errors.New("run profile not found")
+
+// RunProfile holds the operational settings of runs, such as tag filters,
+// timeouts and the log level, so that they can be changed in a profile file
+// instead of in code. Unset fields leave the settings they map to untouched.
+type RunProfile struct {
+	// Tags selects the stages and actions with at least one of these tags, see TagFilter.Include
+	Tags []string `yaml:"tags" toml:"tags"`
+	// SkipTags skips the stages and actions with any of these tags, see TagFilter.Exclude
+	SkipTags []string `yaml:"skipTags" toml:"skipTags"`
+	// TagExpression selects the stages and actions by a tag expression, see TagFilter.Expression
+	TagExpression string `yaml:"tagExpression" toml:"tagExpression"`
+	// OnlyStages runs only these stages, see RunOptions.OnlyStages
+	OnlyStages []string `yaml:"onlyStages" toml:"onlyStages"`
+	// OnlyActions runs only these actions, see RunOptions.OnlyActions
+	OnlyActions []string `yaml:"onlyActions" toml:"onlyActions"`
+	// Concurrency limits how many submitted workflows run at once, see WithMaxConcurrentWorkflows
+	Concurrency int `yaml:"concurrency" toml:"concurrency"`
+	// Timeout stops runs once they have lasted this long, see RunOptions.MaxDuration
+	Timeout time.Duration `yaml:"timeout" toml:"timeout"`
+	// CancelGracePeriod bounds the clean up of cancelled runs, see RunOptions.CancelGracePeriod
+	CancelGracePeriod time.Duration `yaml:"cancelGracePeriod" toml:"cancelGracePeriod"`
+	// LogLevel drops the log messages below this level, see RunOptions.LogLevel
+	LogLevel string `yaml:"logLevel" toml:"logLevel"`
+	// DryRun reports what runs would execute without executing it, see RunOptions.DryRun
+	DryRun bool `yaml:"dryRun" toml:"dryRun"`
+	// IgnoreErrors keeps running workflows after a failure, see RunOptions.IgnoreErrors
+	IgnoreErrors bool `yaml:"ignoreErrors" toml:"ignoreErrors"`
+	// Priority orders submitted workflows, see RunOptions.Priority
+	Priority int `yaml:"priority" toml:"priority"`
+	// Labels are added to the labels of runs, see RunOptions.Labels
+	Labels map[string]string `yaml:"labels" toml:"labels"`
+}
+
+// profileFile is the layout of profile files.
+type profileFile struct {
+	Profiles map[string]RunProfile `yaml:"profiles" toml:"profiles"`
+}
+
+// Validate checks the log level, tag expression, durations and concurrency of the profile.
+func (p RunProfile) Validate() error {
+	if _, err := filterLogLevel(nil, p.LogLevel); err != nil {
+		return err
+	}
+	if _, err := (TagFilter{Expression: p.TagExpression}).compile(); err != nil {
+		return err
+	}
+	if p.Timeout < 0 || p.CancelGracePeriod < 0 {
+		return fmt.Errorf("durations cannot be negative")
+	}
+	if p.Concurrency < 0 {
+		return fmt.Errorf("concurrency cannot be negative")
+	}
+	return nil
+}
+
+// Apply returns options with the settings of the profile. Tag filters and
+// durations the profile sets replace those of options, and its labels are
+// added to them.
+func (p RunProfile) Apply(options RunOptions) RunOptions {
+	if len(p.Tags) > 0 {
+		options.TagFilter.Include = append([]string{}, p.Tags...)
+	}
+	if len(p.SkipTags) > 0 {
+		options.TagFilter.Exclude = append([]string{}, p.SkipTags...)
+	}
+	if p.TagExpression != "" {
+		options.TagFilter.Expression = p.TagExpression
+	}
+	if len(p.OnlyStages) > 0 {
+		options.OnlyStages = append([]string{}, p.OnlyStages...)
+	}
+	if len(p.OnlyActions) > 0 {
+		options.OnlyActions = append([]string{}, p.OnlyActions...)
+	}
+	if p.Timeout > 0 {
+		options.MaxDuration = p.Timeout
+	}
+	if p.CancelGracePeriod > 0 {
+		options.CancelGracePeriod = p.CancelGracePeriod
+	}
+	if p.LogLevel != "" {
+		options.LogLevel = p.LogLevel
+	}
+	if p.Priority != 0 {
+		options.Priority = p.Priority
+	}
+	options.DryRun = options.DryRun || p.DryRun
+	options.IgnoreErrors = options.IgnoreErrors || p.IgnoreErrors
+	if len(p.Labels) > 0 {
+		labels := make(map[string]string, len(options.Labels)+len(p.Labels))
+		for key, value := range options.Labels {
+			labels[key] = value
+		}
+		for key, value := range p.Labels {
+			labels[key] = value
+		}
+		options.Labels = labels
+	}
+	return options
+}
+
+// RunnerOptions returns the runner options of the profile, to pass to NewRunner.
+func (p RunProfile) RunnerOptions() []RunnerOption {
+	var opts []RunnerOption
+	if p.Concurrency > 0 {
+		opts = append(opts, WithMaxConcurrentWorkflows(p.Concurrency))
+	}
+	return opts
+}
+
+// ParseRunProfiles parses the named profiles of a profile file in the given
+// format, "toml" or "yaml". Profiles are the tables of the "profiles" key:
+//
+//	[profiles.ci]
+//	skipTags = ["slow"]
+//	timeout = "30m"
+//	logLevel = "debug"
+//
+// Unknown settings are errors, as they are most likely typos.
+func ParseRunProfiles(data []byte, format string) (map[string]RunProfile, error) {
+	var file profileFile
+	switch strings.ToLower(format) {
+	case "toml":
+		md, err := toml.Decode(string(data), &file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse run profiles: %w", err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, len(undecoded))
+			for i, key := range undecoded {
+				keys[i] = key.String()
+			}
+			return nil, fmt.Errorf("failed to parse run profiles: unknown settings %s", strings.Join(keys, ", "))
+		}
+	case "yaml", "yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to parse run profiles: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported run profile format '%s'", format)
+	}
+
+	names := make([]string, 0, len(file.Profiles))
+	for name := range file.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := file.Profiles[name].Validate(); err != nil {
+			return nil, fmt.Errorf("run profile '%s': %w", name, err)
+		}
+	}
+	return file.Profiles, nil
+}
+
+// LoadRunProfiles reads the named profiles of a TOML or YAML profile file,
+// whose format is given by its extension.
+func LoadRunProfiles(path string) (map[string]RunProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run profiles: %w", err)
+	}
+	profiles, err := ParseRunProfiles(data, strings.TrimPrefix(filepath.Ext(path), "."))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return profiles, nil
+}
+
+// LoadRunProfile reads the profile called name from a profile file. It
+// returns an error wrapping ErrRunProfileNotFound if the file has no such profile.
+func LoadRunProfile(path, name string) (RunProfile, error) {
+	profiles, err := LoadRunProfiles(path)
+	if err != nil {
+		return RunProfile{}, err
+	}
+	profile, ok := profiles[name]
+	if !ok {
+		return RunProfile{}, fmt.Errorf("%s: %w: '%s'", path, ErrRunProfileNotFound, name)
+	}
+	return profile, nil
+}
@@ -0,0 +1,171 @@
+package gostage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRunProfiles(t *testing.T) {
+	want := map[string]RunProfile{
+		"ci": {
+			SkipTags:    []string{"slow"},
+			Concurrency: 4,
+			Timeout:     30 * time.Minute,
+			LogLevel:    LogLevelDebug,
+			Labels:      map[string]string{"team": "platform"},
+		},
+		"preview": {DryRun: true, TagExpression: "deploy && !experimental"},
+	}
+
+	profiles, err := ParseRunProfiles([]byte(`
+[profiles.ci]
+skipTags = ["slow"]
+concurrency = 4
+timeout = "30m"
+logLevel = "debug"
+labels = { team = "platform" }
+
+[profiles.preview]
+dryRun = true
+tagExpression = "deploy && !experimental"
+`), "toml")
+	require.NoError(t, err)
+	assert.Equal(t, want, profiles)
+
+	profiles, err = ParseRunProfiles([]byte(`
+profiles:
+  ci:
+    skipTags: [slow]
+    concurrency: 4
+    timeout: 30m
+    logLevel: debug
+    labels:
+      team: platform
+  preview:
+    dryRun: true
+    tagExpression: deploy && !experimental
+`), "yaml")
+	require.NoError(t, err)
+	assert.Equal(t, want, profiles)
+
+	_, err = ParseRunProfiles([]byte("[profiles.ci]\nskip_tags = [\"slow\"]\n"), "toml")
+	assert.ErrorContains(t, err, "unknown settings profiles.ci.skip_tags")
+	_, err = ParseRunProfiles([]byte("profiles:\n  ci:\n    concurency: 4\n"), "yaml")
+	assert.ErrorContains(t, err, "field concurency not found")
+	_, err = ParseRunProfiles([]byte("[profiles.ci]\nlogLevel = \"loud\"\n"), "toml")
+	assert.EqualError(t, err, "run profile 'ci': unknown log level 'loud'")
+	_, err = ParseRunProfiles([]byte("[profiles.ci]\ntagExpression = \"deploy &&\"\n"), "toml")
+	assert.ErrorContains(t, err, "run profile 'ci'")
+	_, err = ParseRunProfiles(nil, "ini")
+	assert.EqualError(t, err, "unsupported run profile format 'ini'")
+}
+
+func TestLoadRunProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gostage.yml")
+	require.NoError(t, os.WriteFile(path, []byte("profiles:\n  ci:\n    tags: [ci]\n"), 0644))
+
+	profile, err := LoadRunProfile(path, "ci")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ci"}, profile.Tags)
+
+	_, err = LoadRunProfile(path, "nightly")
+	assert.ErrorIs(t, err, ErrRunProfileNotFound)
+	_, err = LoadRunProfile(filepath.Join(t.TempDir(), "missing.toml"), "ci")
+	assert.ErrorContains(t, err, "failed to read run profiles")
+}
+
+func TestRunProfileApply(t *testing.T) {
+	profile := RunProfile{
+		Tags:              []string{"ci"},
+		OnlyStages:        []string{"build"},
+		Timeout:           time.Minute,
+		CancelGracePeriod: time.Second,
+		LogLevel:          LogLevelWarn,
+		DryRun:            true,
+		Priority:          5,
+		Labels:            map[string]string{"team": "platform"},
+	}
+
+	options := profile.Apply(RunOptions{
+		TagFilter:    TagFilter{Exclude: []string{"slow"}},
+		IgnoreErrors: true,
+		Labels:       map[string]string{"team": "growth", "caller": "ci"},
+	})
+	assert.Equal(t, TagFilter{Include: []string{"ci"}, Exclude: []string{"slow"}}, options.TagFilter)
+	assert.Equal(t, []string{"build"}, options.OnlyStages)
+	assert.Equal(t, time.Minute, options.MaxDuration)
+	assert.Equal(t, time.Second, options.CancelGracePeriod)
+	assert.Equal(t, LogLevelWarn, options.LogLevel)
+	assert.True(t, options.DryRun)
+	assert.True(t, options.IgnoreErrors)
+	assert.Equal(t, 5, options.Priority)
+	assert.Equal(t, map[string]string{"team": "platform", "caller": "ci"}, options.Labels)
+
+	assert.Empty(t, RunProfile{}.RunnerOptions())
+	runner := NewRunner(RunProfile{Concurrency: 3}.RunnerOptions()...)
+	assert.Equal(t, 3, runner.pool.size)
+}
+
+func TestDryRun(t *testing.T) {
+	ran := false
+	wf := NewWorkflow("dry", "Dry", "")
+	build := NewStage("build", "Build", "")
+	build.AddAction(NewActionFunc("compile", "", func(*ActionContext) error {
+		ran = true
+		return nil
+	}))
+	build.AddAction(NewActionFunc("lint", "", func(*ActionContext) error {
+		ran = true
+		return nil
+	}))
+	wf.AddStage(build)
+	wf.DisableAction("lint")
+
+	capture := newCaptureLogger(NewDefaultLogger())
+	result := NewRunner().ExecuteWithOptions(wf, RunOptions{Logger: capture, DryRun: true})
+	require.True(t, result.Success, "%v", result.Error)
+	assert.False(t, ran)
+	assert.Equal(t, StatusSkipped, result.StageStatuses["build"])
+	assert.Equal(t, StatusSkipped, result.ActionStatuses[ActionStatusKey("build", "compile")])
+
+	var messages []string
+	for _, entry := range capture.buffer.snapshot() {
+		messages = append(messages, entry.Message)
+	}
+	assert.Contains(t, messages, "Dry run: would execute action compile")
+	assert.NotContains(t, messages, "Dry run: would execute action lint")
+}
+
+func TestRunOptionsMaxDurationAndLogLevel(t *testing.T) {
+	wf := NewWorkflow("slow", "Slow", "")
+	stage := NewStage("wait", "Wait", "")
+	stage.AddAction(NewActionFunc("sleep", "", func(ctx *ActionContext) error {
+		ctx.Logger.Info("sleeping")
+		ctx.Logger.Warn("still sleeping")
+		return ctx.Sleep(time.Minute)
+	}))
+	wf.AddStage(stage)
+
+	result := NewRunner().ExecuteWithOptions(wf, RunOptions{
+		Context:     context.Background(),
+		MaxDuration: 20 * time.Millisecond,
+		LogLevel:    LogLevelWarn,
+		CaptureLogs: true,
+	})
+	assert.ErrorIs(t, result.Error, ErrWorkflowDeadline)
+	var messages []string
+	for _, entry := range result.Logs {
+		assert.NotEqual(t, LogLevelInfo, entry.Level)
+		messages = append(messages, entry.Message)
+	}
+	assert.Contains(t, messages, "still sleeping")
+
+	result = NewRunner().ExecuteWithOptions(wf, RunOptions{LogLevel: "loud"})
+	assert.EqualError(t, result.Error, "unknown log level 'loud'")
+}
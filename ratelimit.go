@@ -0,0 +1,87 @@
+package gostage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// rateLimiters is the registry of the named rate limiters of a runner.
+type rateLimiters struct {
+	mu     sync.RWMutex
+	byName map[string]*rate.Limiter
+}
+
+// WithRateLimiter registers a named rate limiter allowing r executions per
+// second with bursts of burst, shared by every action wrapped with
+// WithSharedRateLimit(action, name) on the runner.
+func WithRateLimiter(name string, r rate.Limit, burst int) RunnerOption {
+	return func(runner *Runner) {
+		runner.SetRateLimiter(name, rate.NewLimiter(r, burst))
+	}
+}
+
+// SetRateLimiter registers or replaces a named rate limiter of the runner.
+func (r *Runner) SetRateLimiter(name string, limiter *rate.Limiter) {
+	r.limiters.mu.Lock()
+	defer r.limiters.mu.Unlock()
+	if r.limiters.byName == nil {
+		r.limiters.byName = make(map[string]*rate.Limiter)
+	}
+	r.limiters.byName[name] = limiter
+}
+
+// RateLimiter returns a named rate limiter of the runner.
+func (r *Runner) RateLimiter(name string) (*rate.Limiter, bool) {
+	r.limiters.mu.RLock()
+	defer r.limiters.mu.RUnlock()
+	limiter, ok := r.limiters.byName[name]
+	return limiter, ok
+}
+
+// rateLimitedAction waits for a rate limiter before executing an existing action.
+type rateLimitedAction struct {
+	Action
+	limiter *rate.Limiter
+	// name is the runner limiter to use when limiter is nil
+	name string
+}
+
+// WithRateLimit limits the executions of an action to r per second with
+// bursts of burst. The limit applies to the returned action only, including
+// when it runs in parallel branches or items.
+func WithRateLimit(action Action, r rate.Limit, burst int) Action {
+	return &rateLimitedAction{Action: action, limiter: rate.NewLimiter(r, burst)}
+}
+
+// WithSharedRateLimit limits the executions of an action with the rate
+// limiter registered on the runner under name, so several actions calling
+// the same API share its quota. The action fails if the runner has no such
+// limiter.
+func WithSharedRateLimit(action Action, name string) Action {
+	return &rateLimitedAction{Action: action, name: name}
+}
+
+func (a *rateLimitedAction) Execute(ctx *ActionContext) error {
+	limiter := a.limiter
+	if limiter == nil {
+		r, _ := ctx.Workflow.Context["runner"].(*Runner)
+		if r != nil {
+			limiter, _ = r.RateLimiter(a.name)
+		}
+		if limiter == nil {
+			return fmt.Errorf("rate limiter '%s' is not registered on the runner", a.name)
+		}
+	}
+
+	goCtx := ctx.GoContext
+	if goCtx == nil {
+		goCtx = context.Background()
+	}
+	if err := limiter.Wait(goCtx); err != nil {
+		return fmt.Errorf("failed to wait for rate limit: %w", err)
+	}
+	return executeAction(ctx, a.Action)
+}
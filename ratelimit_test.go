@@ -0,0 +1,71 @@
+package gostage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestWithRateLimit(t *testing.T) {
+	calls := 0
+	limited := WithRateLimit(NewActionFunc("call-api", "", func(ctx *ActionContext) error {
+		calls++
+		return nil
+	}), rate.Every(20*time.Millisecond), 1)
+
+	wf := NewWorkflow("api", "API", "")
+	stage := NewStage("calls", "Calls", "")
+	stage.AddAction(NewActionFunc("fan-out", "", func(ctx *ActionContext) error {
+		ctx.AddDynamicAction(limited)
+		ctx.AddDynamicAction(limited)
+		return nil
+	}))
+	stage.AddAction(limited)
+	wf.AddStage(stage)
+
+	started := time.Now()
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, 3, calls)
+	assert.GreaterOrEqual(t, time.Since(started), 40*time.Millisecond)
+	assert.Equal(t, "call-api", limited.Name())
+
+	// Waiting for the limiter stops when the run is cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	hourly := WithRateLimit(NewActionFunc("hourly", "", func(ctx *ActionContext) error { return nil }), rate.Every(time.Hour), 1)
+	result = runSingleAction(t, ctx, hourly, func(wf *Workflow) { wf.Stages[0].AddAction(hourly) })
+	assert.ErrorContains(t, result.Error, "action 'hourly' failed: failed to wait for rate limit")
+}
+
+func TestWithSharedRateLimit(t *testing.T) {
+	runner := NewRunner(WithRateLimiter("github", rate.Every(20*time.Millisecond), 1))
+
+	calls := 0
+	call := func(ctx *ActionContext) error {
+		calls++
+		return nil
+	}
+	wf := NewWorkflow("sync", "Sync", "")
+	stage := NewStage("github", "GitHub", "")
+	stage.AddAction(WithSharedRateLimit(NewActionFunc("issues", "", call), "github"))
+	stage.AddAction(WithSharedRateLimit(NewActionFunc("pulls", "", call), "github"))
+	stage.AddAction(WithSharedRateLimit(NewActionFunc("releases", "", call), "github"))
+	wf.AddStage(stage)
+
+	started := time.Now()
+	require.NoError(t, runner.Execute(context.Background(), wf, NewDefaultLogger()))
+	assert.Equal(t, 3, calls)
+	assert.GreaterOrEqual(t, time.Since(started), 40*time.Millisecond)
+
+	limiter, ok := runner.RateLimiter("github")
+	require.True(t, ok)
+	assert.Equal(t, rate.Every(20*time.Millisecond), limiter.Limit())
+
+	result := runSingleAction(t, context.Background(), WithSharedRateLimit(NewActionFunc("issues", "", call), "gitlab"), nil)
+	assert.EqualError(t, result.Error, "stage 'Wait' failed: action 'issues' failed: rate limiter 'gitlab' is not registered on the runner")
+}
@@ -0,0 +1,252 @@
+package gostage
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/davidroman0O/gostage/store"
+)
+
+// DefaultRedactionMask replaces redacted values.
+const DefaultRedactionMask = "[REDACTED]"
+
+// Redactor masks sensitive store values in log messages, events, exports and
+// run results. A value is sensitive when its store key is tagged with TagSecret
+// or matches a denied key pattern. Denied text patterns are masked wherever they
+// appear, whether or not they come from the store.
+type Redactor struct {
+	mu       sync.RWMutex
+	keys     []string
+	patterns []*regexp.Regexp
+	mask     string
+}
+
+// NewRedactor creates a redactor that masks values of keys tagged with TagSecret.
+func NewRedactor() *Redactor {
+	return &Redactor{mask: DefaultRedactionMask}
+}
+
+// DenyKeys marks store keys as sensitive. Keys may use path.Match patterns,
+// such as "*token*" or "db.password".
+func (r *Redactor) DenyKeys(keys ...string) *Redactor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys = append(r.keys, keys...)
+	return r
+}
+
+// DenyPattern masks every match of the regular expression, such as bearer
+// tokens embedded in error messages.
+func (r *Redactor) DenyPattern(pattern *regexp.Regexp) *Redactor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.patterns = append(r.patterns, pattern)
+	return r
+}
+
+// WithMask sets the replacement text for redacted values.
+func (r *Redactor) WithMask(mask string) *Redactor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mask = mask
+	return r
+}
+
+// PutSecret stores a value and tags its key with TagSecret.
+func PutSecret(s *store.KVStore, key string, value any) error {
+	meta := store.NewMetadata()
+	meta.AddTag(TagSecret)
+	return s.PutWithMetadata(key, value, meta)
+}
+
+// isDenied reports whether a store key is sensitive by name.
+func (r *Redactor) isDenied(key string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, pattern := range r.keys {
+		if matched, _ := path.Match(pattern, key); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// sensitiveKeys returns the set of keys in s whose values must be masked.
+func (r *Redactor) sensitiveKeys(s *store.KVStore) map[string]bool {
+	keys := make(map[string]bool)
+	if s == nil {
+		return keys
+	}
+	for _, key := range s.FindKeysByTag(TagSecret) {
+		keys[key] = true
+	}
+	for _, key := range s.ListKeys() {
+		if r.isDenied(key) {
+			keys[key] = true
+		}
+	}
+	return keys
+}
+
+// Secrets returns the sensitive values currently held in s, longest first.
+func (r *Redactor) Secrets(s *store.KVStore) []string {
+	keys := r.sensitiveKeys(s)
+	if len(keys) == 0 {
+		return nil
+	}
+
+	var secrets []string
+	for key, value := range s.ExportAll() {
+		if !keys[key] || value == nil {
+			continue
+		}
+		if text := fmt.Sprint(value); text != "" {
+			secrets = append(secrets, text)
+		}
+	}
+
+	// Replace longer secrets first so one secret containing another is fully masked
+	sort.Slice(secrets, func(i, j int) bool {
+		return len(secrets[i]) > len(secrets[j])
+	})
+	return secrets
+}
+
+// Redact masks the given secrets and the denied patterns in text.
+func (r *Redactor) Redact(text string, secrets []string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, secret := range secrets {
+		text = strings.ReplaceAll(text, secret, r.mask)
+	}
+	for _, pattern := range r.patterns {
+		text = pattern.ReplaceAllString(text, r.mask)
+	}
+	return text
+}
+
+// RedactStore returns the contents of s with sensitive values masked.
+func (r *Redactor) RedactStore(s *store.KVStore) map[string]interface{} {
+	return r.redactData(s.ExportAll(), r.sensitiveKeys(s), r.Secrets(s))
+}
+
+// redactData masks the values of sensitive keys and scrubs secrets out of the
+// remaining string values.
+func (r *Redactor) redactData(data map[string]interface{}, keys map[string]bool, secrets []string) map[string]interface{} {
+	r.mu.RLock()
+	mask := r.mask
+	r.mu.RUnlock()
+
+	out := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		if keys[key] || r.isDenied(key) {
+			out[key] = mask
+			continue
+		}
+		if text, ok := value.(string); ok {
+			value = r.Redact(text, secrets)
+		}
+		out[key] = value
+	}
+	return out
+}
+
+// redactError returns err with its message redacted, keeping the original
+// error reachable through errors.Is and errors.As.
+func (r *Redactor) redactError(err error, secrets []string) error {
+	if err == nil {
+		return nil
+	}
+	message := r.Redact(err.Error(), secrets)
+	if message == err.Error() {
+		return err
+	}
+	return &redactedError{message: message, err: err}
+}
+
+// redactedError carries a redacted message for a wrapped error.
+type redactedError struct {
+	message string
+	err     error
+}
+
+func (e *redactedError) Error() string { return e.message }
+
+func (e *redactedError) Unwrap() error { return e.err }
+
+// redactConflicts masks the values of sensitive keys in initial data conflicts
+// and scrubs secrets out of the others.
+func (r *Redactor) redactConflicts(conflicts []InitialDataConflict, s *store.KVStore) []InitialDataConflict {
+	keys := r.sensitiveKeys(s)
+	secrets := r.Secrets(s)
+	for i, conflict := range conflicts {
+		values := r.redactData(map[string]interface{}{"existing": conflict.Existing, "initial": conflict.Initial}, nil, secrets)
+		conflicts[i].Existing, conflicts[i].Initial = values["existing"], values["initial"]
+		if keys[conflict.Key] || r.isDenied(conflict.Key) {
+			r.mu.RLock()
+			conflicts[i].Existing, conflicts[i].Initial = r.mask, r.mask
+			r.mu.RUnlock()
+		}
+	}
+	return conflicts
+}
+
+// redactEvent masks secrets in the error and payload of an event.
+func (r *Redactor) redactEvent(event Event, s *store.KVStore) Event {
+	secrets := r.Secrets(s)
+	event.Error = r.redactError(event.Error, secrets)
+	if event.Payload != nil {
+		event.Payload = r.redactData(event.Payload, r.sensitiveKeys(s), secrets)
+	}
+	return event
+}
+
+// redactingLogger masks secrets of a workflow store in every log line.
+type redactingLogger struct {
+	logger   Logger
+	redactor *Redactor
+	store    *store.KVStore
+}
+
+// Debug implements Logger.Debug
+func (l *redactingLogger) Debug(format string, args ...interface{}) {
+	l.logger.Debug("%s", l.message(format, args))
+}
+
+// Info implements Logger.Info
+func (l *redactingLogger) Info(format string, args ...interface{}) {
+	l.logger.Info("%s", l.message(format, args))
+}
+
+// Warn implements Logger.Warn
+func (l *redactingLogger) Warn(format string, args ...interface{}) {
+	l.logger.Warn("%s", l.message(format, args))
+}
+
+// Error implements Logger.Error
+func (l *redactingLogger) Error(format string, args ...interface{}) {
+	l.logger.Error("%s", l.message(format, args))
+}
+
+// With implements FieldLogger.With, redacting string field values
+func (l *redactingLogger) With(args ...interface{}) FieldLogger {
+	secrets := l.redactor.Secrets(l.store)
+	redacted := make([]interface{}, len(args))
+	for i, arg := range args {
+		if text, ok := arg.(string); ok && i%2 == 1 {
+			arg = l.redactor.Redact(text, secrets)
+		}
+		redacted[i] = arg
+	}
+	return &redactingLogger{logger: LoggerWith(l.logger, redacted...), redactor: l.redactor, store: l.store}
+}
+
+func (l *redactingLogger) message(format string, args []interface{}) string {
+	return l.redactor.Redact(fmt.Sprintf(format, args...), l.redactor.Secrets(l.store))
+}
@@ -0,0 +1,162 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/davidroman0O/gostage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Agent connects to a coordinator and runs the stages it dispatches, resolving
+// their actions from a registry.
+type Agent struct {
+	id            string
+	registry      *gostage.ActionRegistry
+	dialOptions   []grpc.DialOption
+	runnerOptions []gostage.RunnerOption
+}
+
+// AgentOption configures an Agent.
+type AgentOption func(*Agent)
+
+// WithDialOptions passes options, such as transport credentials, to the
+// agent's gRPC connection. Without them the connection is unencrypted.
+func WithDialOptions(opts ...grpc.DialOption) AgentOption {
+	return func(a *Agent) {
+		a.dialOptions = append(a.dialOptions, opts...)
+	}
+}
+
+// WithRunnerOptions configures the runner executing the agent's stages.
+func WithRunnerOptions(opts ...gostage.RunnerOption) AgentOption {
+	return func(a *Agent) {
+		a.runnerOptions = append(a.runnerOptions, opts...)
+	}
+}
+
+// NewAgent creates an agent identified by id, which must be unique among the
+// agents of a coordinator. It runs the actions of registry, or of the default
+// registry if registry is nil.
+func NewAgent(id string, registry *gostage.ActionRegistry, opts ...AgentOption) *Agent {
+	if registry == nil {
+		registry = gostage.DefaultActionRegistry()
+	}
+
+	a := &Agent{id: id, registry: registry}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Run connects to the coordinator at target and runs the stages it receives,
+// several at a time, until ctx is done or the connection is lost. Stages still
+// running when Run returns are cancelled and waited for. Run returns nil when
+// it stops because ctx is done.
+func (a *Agent) Run(ctx context.Context, target string) error {
+	opts := append([]grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype(codecName)),
+	}, a.dialOptions...)
+	conn, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to connect to coordinator: %w", err)
+	}
+	defer conn.Close()
+
+	// Stages still running are cancelled before being waited for
+	var running sync.WaitGroup
+	defer running.Wait()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := conn.NewStream(ctx, &serviceDesc.Streams[0], connectMethod)
+	if err != nil {
+		return fmt.Errorf("failed to connect to coordinator: %w", err)
+	}
+	session := &agentSession{stream: stream, cancels: make(map[string]context.CancelFunc)}
+	if err := session.send(&agentMessage{Register: &registerMessage{AgentID: a.id, Actions: a.registry.IDs()}}); err != nil {
+		return fmt.Errorf("failed to register with coordinator: %w", err)
+	}
+
+	for {
+		var msg coordinatorMessage
+		if err := stream.RecvMsg(&msg); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if errors.Is(err, io.EOF) {
+				return errors.New("coordinator closed the connection")
+			}
+			return fmt.Errorf("lost connection to coordinator: %w", err)
+		}
+
+		switch {
+		case msg.Task != nil:
+			task := msg.Task
+			taskCtx, cancelTask := context.WithCancel(ctx)
+			session.mu.Lock()
+			session.cancels[task.ID] = cancelTask
+			session.mu.Unlock()
+
+			running.Add(1)
+			go func() {
+				defer running.Done()
+				a.runTask(taskCtx, session, task)
+
+				session.mu.Lock()
+				delete(session.cancels, task.ID)
+				session.mu.Unlock()
+				cancelTask()
+			}()
+		case msg.Cancel != nil:
+			session.mu.Lock()
+			if cancelTask, ok := session.cancels[msg.Cancel.TaskID]; ok {
+				cancelTask()
+			}
+			session.mu.Unlock()
+		}
+	}
+}
+
+// runTask runs a task and streams its output back to the coordinator.
+func (a *Agent) runTask(ctx context.Context, session *agentSession, task *taskMessage) {
+	// The outcome of the run reaches the coordinator through the output
+	output := &taskOutput{session: session, taskID: task.ID}
+	gostage.RunDefinition(ctx, task.Definition, output, a.registry, a.runnerOptions...)
+	session.send(&agentMessage{Done: &doneMessage{TaskID: task.ID}})
+}
+
+// agentSession is the agent's side of a connection to the coordinator.
+type agentSession struct {
+	stream grpc.ClientStream
+	sendMu sync.Mutex
+
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+}
+
+// send writes a message to the coordinator. Streams do not support concurrent sends.
+func (s *agentSession) send(msg *agentMessage) error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	return s.stream.SendMsg(msg)
+}
+
+// taskOutput sends what is written to it to the coordinator as the output of a task.
+type taskOutput struct {
+	session *agentSession
+	taskID  string
+}
+
+func (o *taskOutput) Write(p []byte) (int, error) {
+	if err := o.session.send(&agentMessage{Output: &outputMessage{TaskID: o.taskID, Data: p}}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,309 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/davidroman0O/gostage"
+	"google.golang.org/grpc"
+)
+
+var (
+	// ErrNoAgent is returned when no connected agent has every action of a stage.
+	ErrNoAgent = errors.New("no agent can run the stage")
+	// ErrAgentLost is returned when an agent disconnects while running a stage.
+	ErrAgentLost = errors.New("agent disconnected")
+)
+
+// AgentInfo describes an agent connected to a coordinator.
+type AgentInfo struct {
+	ID      string   `json:"id"`
+	Actions []string `json:"actions"`
+	Tasks   int      `json:"tasks"`
+}
+
+// Coordinator accepts agent connections and dispatches stages to them. It
+// implements gostage.StageDispatcher and is safe for concurrent use.
+type Coordinator struct {
+	server *grpc.Server
+	signer gostage.DefinitionSigner
+
+	mu       sync.Mutex
+	agents   map[string]*agentConn
+	nextTask uint64
+}
+
+// agentConn is the coordinator's side of an agent connection.
+type agentConn struct {
+	id      string
+	actions map[string]bool
+	stream  grpc.ServerStream
+	sendMu  sync.Mutex
+	// tasks are the tasks in flight on the agent, guarded by the coordinator's mutex
+	tasks map[string]*remoteTask
+}
+
+// remoteTask is a stage running on an agent.
+type remoteTask struct {
+	output *io.PipeWriter
+	done   chan struct{}
+	err    error
+}
+
+// CoordinatorOption configures a Coordinator.
+type CoordinatorOption func(*coordinatorConfig)
+
+type coordinatorConfig struct {
+	serverOptions []grpc.ServerOption
+	signer        gostage.DefinitionSigner
+}
+
+// WithServerOptions passes options, such as transport credentials, to the
+// coordinator's gRPC server.
+func WithServerOptions(opts ...grpc.ServerOption) CoordinatorOption {
+	return func(c *coordinatorConfig) {
+		c.serverOptions = append(c.serverOptions, opts...)
+	}
+}
+
+// WithSigner makes the coordinator sign the definitions it dispatches, so that
+// agents given gostage.WithTrustStore in their runner options accept them.
+func WithSigner(signer gostage.DefinitionSigner) CoordinatorOption {
+	return func(c *coordinatorConfig) {
+		c.signer = signer
+	}
+}
+
+// NewCoordinator creates a coordinator. Agents can connect once Serve is called.
+func NewCoordinator(opts ...CoordinatorOption) *Coordinator {
+	config := &coordinatorConfig{}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	c := &Coordinator{
+		server: grpc.NewServer(config.serverOptions...),
+		signer: config.signer,
+		agents: make(map[string]*agentConn),
+	}
+	c.server.RegisterService(&serviceDesc, c)
+	return c
+}
+
+// Serve accepts agent connections on lis until Stop is called.
+func (c *Coordinator) Serve(lis net.Listener) error {
+	return c.server.Serve(lis)
+}
+
+// Stop closes the listeners and every agent connection. Stages running on
+// agents fail with ErrAgentLost.
+func (c *Coordinator) Stop() {
+	c.server.Stop()
+}
+
+// Agents returns the connected agents, sorted by ID.
+func (c *Coordinator) Agents() []AgentInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	infos := make([]AgentInfo, 0, len(c.agents))
+	for _, agent := range c.agents {
+		actions := make([]string, 0, len(agent.actions))
+		for action := range agent.actions {
+			actions = append(actions, action)
+		}
+		sort.Strings(actions)
+		infos = append(infos, AgentInfo{ID: agent.id, Actions: actions, Tasks: len(agent.tasks)})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// Dispatch runs def on the least busy agent having all of its actions, feeding
+// the output the agent streams back to broker. When ctx is cancelled the agent
+// is asked to cancel the run, and Dispatch returns once it has stopped.
+func (c *Coordinator) Dispatch(ctx context.Context, def gostage.SubWorkflowDef, broker *gostage.RunnerBroker) error {
+	var data []byte
+	var err error
+	if c.signer != nil {
+		data, err = gostage.SignDefinition(&def, c.signer)
+	} else {
+		data, err = json.Marshal(def)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to serialize workflow definition: %w", err)
+	}
+
+	reader, writer := io.Pipe()
+	task := &remoteTask{output: writer, done: make(chan struct{})}
+	agent, taskID, err := c.assign(def, task)
+	if err != nil {
+		return err
+	}
+	defer c.release(agent, taskID)
+
+	listened := make(chan struct{})
+	go func() {
+		defer close(listened)
+		if err := broker.Listen(reader); err != nil {
+			// Keep draining so that the agent's stream is not blocked
+			io.Copy(io.Discard, reader)
+		}
+	}()
+
+	err = agent.send(&coordinatorMessage{Task: &taskMessage{ID: taskID, Definition: data}})
+	if err != nil {
+		err = fmt.Errorf("failed to send stage to agent '%s': %w", agent.id, err)
+	} else {
+		select {
+		case <-task.done:
+		case <-ctx.Done():
+			agent.send(&coordinatorMessage{Cancel: &cancelMessage{TaskID: taskID}})
+			<-task.done
+		}
+		err = task.err
+	}
+
+	writer.Close()
+	<-listened
+	return err
+}
+
+// assign registers task on the least busy agent able to run def.
+func (c *Coordinator) assign(def gostage.SubWorkflowDef, task *remoteTask) (*agentConn, string, error) {
+	var required []string
+	for _, stage := range def.Stages {
+		for _, action := range stage.Actions {
+			required = append(required, action.ID)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var chosen *agentConn
+	for _, agent := range c.agents {
+		if !agent.canRun(required) {
+			continue
+		}
+		if chosen == nil || len(agent.tasks) < len(chosen.tasks) ||
+			(len(agent.tasks) == len(chosen.tasks) && agent.id < chosen.id) {
+			chosen = agent
+		}
+	}
+	if chosen == nil {
+		return nil, "", fmt.Errorf("workflow '%s': %w", def.ID, ErrNoAgent)
+	}
+
+	c.nextTask++
+	taskID := def.ID + "-" + strconv.FormatUint(c.nextTask, 10)
+	chosen.tasks[taskID] = task
+	return chosen, taskID, nil
+}
+
+// release forgets a task once Dispatch is done with it.
+func (c *Coordinator) release(agent *agentConn, taskID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(agent.tasks, taskID)
+}
+
+// connect serves the stream of an agent until it disconnects.
+func (c *Coordinator) connect(stream grpc.ServerStream) error {
+	var first agentMessage
+	if err := stream.RecvMsg(&first); err != nil {
+		return err
+	}
+	if first.Register == nil || first.Register.AgentID == "" {
+		return errors.New("agents must register before anything else")
+	}
+
+	agent := &agentConn{
+		id:      first.Register.AgentID,
+		actions: make(map[string]bool, len(first.Register.Actions)),
+		stream:  stream,
+		tasks:   make(map[string]*remoteTask),
+	}
+	for _, action := range first.Register.Actions {
+		agent.actions[action] = true
+	}
+
+	c.mu.Lock()
+	if _, exists := c.agents[agent.id]; exists {
+		c.mu.Unlock()
+		return fmt.Errorf("agent '%s' is already connected", agent.id)
+	}
+	c.agents[agent.id] = agent
+	c.mu.Unlock()
+
+	err := c.receive(agent)
+
+	c.mu.Lock()
+	delete(c.agents, agent.id)
+	for taskID, task := range agent.tasks {
+		task.err = fmt.Errorf("agent '%s' running task %s: %w", agent.id, taskID, ErrAgentLost)
+		close(task.done)
+		delete(agent.tasks, taskID)
+	}
+	c.mu.Unlock()
+
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// receive routes the output and completions sent by an agent to its tasks.
+func (c *Coordinator) receive(agent *agentConn) error {
+	for {
+		var msg agentMessage
+		if err := agent.stream.RecvMsg(&msg); err != nil {
+			return err
+		}
+
+		switch {
+		case msg.Output != nil:
+			if task := c.task(agent, msg.Output.TaskID); task != nil {
+				task.output.Write(msg.Output.Data)
+			}
+		case msg.Done != nil:
+			c.mu.Lock()
+			if task, ok := agent.tasks[msg.Done.TaskID]; ok {
+				close(task.done)
+				delete(agent.tasks, msg.Done.TaskID)
+			}
+			c.mu.Unlock()
+		}
+	}
+}
+
+// task returns a task in flight on agent, or nil if it is unknown.
+func (c *Coordinator) task(agent *agentConn, taskID string) *remoteTask {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return agent.tasks[taskID]
+}
+
+// canRun reports whether the agent has every action in required.
+func (a *agentConn) canRun(required []string) bool {
+	for _, action := range required {
+		if !a.actions[action] {
+			return false
+		}
+	}
+	return true
+}
+
+// send writes a message to the agent. Streams do not support concurrent sends.
+func (a *agentConn) send(msg *coordinatorMessage) error {
+	a.sendMu.Lock()
+	defer a.sendMu.Unlock()
+	return a.stream.SendMsg(msg)
+}
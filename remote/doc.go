@@ -0,0 +1,26 @@
+// Package remote runs gostage stages on worker agents over gRPC.
+//
+// A Coordinator is embedded in the service owning the workflows. It accepts
+// connections from agents and implements gostage.StageDispatcher, so a runner
+// created with gostage.WithStageDispatcher sends it every stage tagged with
+// gostage.TagRemote:
+//
+//	coordinator := remote.NewCoordinator()
+//	go coordinator.Serve(listener)
+//	runner := gostage.NewRunner(gostage.WithStageDispatcher(coordinator))
+//
+// An Agent is a small program that connects to the coordinator, announces the
+// actions of its registry and executes the stages it receives. Stages travel
+// as serialized definitions whose actions are resolved by their registered
+// IDs, so an agent only gets the stages it has every action for:
+//
+//	agent := remote.NewAgent("worker-1", registry)
+//	err := agent.Run(ctx, "coordinator:7400")
+//
+// Store changes, logs, action events and the outcome of a stage are streamed
+// back while it runs and applied to the workflow on the coordinator, exactly
+// as for stages spawned in a child process. Messages are encoded as JSON, so
+// no generated code is needed on either side. Connections are unencrypted
+// unless transport credentials are given with WithServerOptions and
+// WithDialOptions.
+package remote
@@ -0,0 +1,89 @@
+package remote
+
+import (
+	"encoding/json"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// codecName is the content subtype of the JSON codec used by coordinators and agents.
+const codecName = "gostage-json"
+
+// jsonCodec encodes gRPC messages as JSON instead of protocol buffers.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                               { return codecName }
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// agentMessage is sent by an agent to the coordinator. Exactly one field is set.
+type agentMessage struct {
+	Register *registerMessage `json:"register,omitempty"`
+	Output   *outputMessage   `json:"output,omitempty"`
+	Done     *doneMessage     `json:"done,omitempty"`
+}
+
+// registerMessage is the first message of an agent, announcing its actions.
+type registerMessage struct {
+	AgentID string   `json:"agentId"`
+	Actions []string `json:"actions"`
+}
+
+// outputMessage carries a chunk of the IPC stream written while running a task.
+type outputMessage struct {
+	TaskID string `json:"taskId"`
+	Data   []byte `json:"data"`
+}
+
+// doneMessage tells that the agent finished running a task.
+type doneMessage struct {
+	TaskID string `json:"taskId"`
+}
+
+// coordinatorMessage is sent by the coordinator to an agent. Exactly one field is set.
+type coordinatorMessage struct {
+	Task   *taskMessage   `json:"task,omitempty"`
+	Cancel *cancelMessage `json:"cancel,omitempty"`
+}
+
+// taskMessage asks an agent to run a serialized workflow definition.
+type taskMessage struct {
+	ID         string          `json:"id"`
+	Definition json.RawMessage `json:"definition"`
+}
+
+// cancelMessage asks an agent to cancel a running task.
+type cancelMessage struct {
+	TaskID string `json:"taskId"`
+}
+
+// coordinatorService is implemented by the Coordinator to serve agent streams.
+type coordinatorService interface {
+	connect(stream grpc.ServerStream) error
+}
+
+// connectMethod is the full name of the stream opened by agents.
+const connectMethod = "/gostage.remote.Coordinator/Connect"
+
+// serviceDesc describes the coordinator service: a single bidirectional
+// stream per agent, over which tasks go out and their output comes back.
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "gostage.remote.Coordinator",
+	HandlerType: (*coordinatorService)(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "Connect",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				return srv.(coordinatorService).connect(stream)
+			},
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "gostage/remote",
+}
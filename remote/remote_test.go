@@ -0,0 +1,263 @@
+package remote
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/davidroman0O/gostage/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// funcAction is a registrable action running a function.
+type funcAction struct {
+	gostage.BaseAction
+	run func(ctx *gostage.ActionContext) error
+}
+
+func (a *funcAction) Execute(ctx *gostage.ActionContext) error {
+	return a.run(ctx)
+}
+
+func newTestRegistry(t *testing.T, release <-chan struct{}) *gostage.ActionRegistry {
+	registry := gostage.NewActionRegistry()
+	actions := map[string]func(ctx *gostage.ActionContext) error{
+		"double": func(ctx *gostage.ActionContext) error {
+			// Store values cross the wire as JSON, so numbers arrive as float64
+			count, err := store.Get[float64](ctx.Store(), "count")
+			if err != nil {
+				return err
+			}
+			ctx.Logger.Info("Doubling %v", count)
+			return ctx.Store().Put("doubled", count*2)
+		},
+		"fail": func(ctx *gostage.ActionContext) error {
+			return errors.New("disk full")
+		},
+		"block": func(ctx *gostage.ActionContext) error {
+			select {
+			case <-release:
+				return nil
+			case <-ctx.GoContext.Done():
+				return ctx.GoContext.Err()
+			}
+		},
+	}
+	for id, run := range actions {
+		id, run := id, run
+		require.NoError(t, registry.Register(id, func() gostage.Action {
+			return &funcAction{BaseAction: gostage.NewBaseAction(id, ""), run: run}
+		}))
+	}
+	return registry
+}
+
+// startCoordinator serves a coordinator on a local port and returns its address.
+func startCoordinator(t *testing.T, opts ...CoordinatorOption) (*Coordinator, string) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	coordinator := NewCoordinator(opts...)
+	go coordinator.Serve(lis)
+	t.Cleanup(coordinator.Stop)
+	return coordinator, lis.Addr().String()
+}
+
+// startAgent runs an agent until the returned stop function is called.
+func startAgent(t *testing.T, coordinator *Coordinator, target string, agent *Agent) (stop func() error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() { errs <- agent.Run(ctx, target) }()
+
+	require.Eventually(t, func() bool { return len(coordinator.Agents()) > 0 }, 5*time.Second, 10*time.Millisecond)
+
+	stopped := false
+	stop = func() error {
+		if stopped {
+			return nil
+		}
+		stopped = true
+		cancel()
+		return <-errs
+	}
+	t.Cleanup(func() { stop() })
+	return stop
+}
+
+func newRemoteWorkflow(t *testing.T, registry *gostage.ActionRegistry, actionID string) *gostage.Workflow {
+	wf := gostage.NewWorkflow("report", "Report", "")
+	prepare := gostage.NewStage("prepare", "Prepare", "")
+	prepare.AddAction(&funcAction{BaseAction: gostage.NewBaseAction("count", ""), run: func(ctx *gostage.ActionContext) error {
+		return ctx.Store().Put("count", 21)
+	}})
+	wf.AddStage(prepare)
+
+	compute := gostage.NewStage("compute", "Compute", "")
+	compute.AddTag(gostage.TagRemote)
+	action, err := registry.Resolve(actionID, nil)
+	require.NoError(t, err)
+	compute.AddAction(action)
+	wf.AddStage(compute)
+	return wf
+}
+
+func TestRemoteStageRunsOnAgent(t *testing.T) {
+	registry := newTestRegistry(t, nil)
+	coordinator, target := startCoordinator(t)
+	// The agent's runner marks the store so that the test can tell where the stage ran
+	startAgent(t, coordinator, target, NewAgent("worker-1", registry, WithRunnerOptions(
+		gostage.WithActionMiddleware(func(next gostage.ActionRunnerFunc) gostage.ActionRunnerFunc {
+			return func(ctx *gostage.ActionContext, action gostage.Action, index int, isLast bool) error {
+				ctx.Store().Put("executedBy", "worker-1")
+				return next(ctx, action, index, isLast)
+			}
+		}),
+	)))
+
+	agents := coordinator.Agents()
+	require.Len(t, agents, 1)
+	assert.Equal(t, "worker-1", agents[0].ID)
+	assert.Equal(t, []string{"block", "double", "fail"}, agents[0].Actions)
+
+	runner := gostage.NewRunner(gostage.WithStageDispatcher(coordinator))
+	var completed []gostage.Event
+	runner.Subscribe(gostage.EventActionCompleted, func(event gostage.Event) {
+		completed = append(completed, event)
+	})
+
+	options := gostage.DefaultRunOptions()
+	options.CaptureLogs = true
+	result := runner.ExecuteWithOptions(newRemoteWorkflow(t, registry, "double"), options)
+	require.True(t, result.Success, "%v", result.Error)
+
+	assert.Equal(t, float64(42), result.FinalStore["doubled"])
+	assert.Equal(t, "worker-1", result.FinalStore["executedBy"])
+	assert.Equal(t, gostage.StatusCompleted, result.StageStatuses["compute"])
+
+	var messages []string
+	for _, entry := range result.Logs {
+		messages = append(messages, entry.Message)
+	}
+	assert.Contains(t, messages, "Doubling 21")
+
+	require.Len(t, completed, 2)
+	assert.Equal(t, "compute", completed[1].StageID)
+	assert.Equal(t, "double", completed[1].ActionName)
+	assert.Equal(t, 0, coordinator.Agents()[0].Tasks)
+}
+
+func TestRemoteStageFailure(t *testing.T) {
+	registry := newTestRegistry(t, nil)
+	coordinator, target := startCoordinator(t)
+	startAgent(t, coordinator, target, NewAgent("worker-1", registry))
+
+	runner := gostage.NewRunner(gostage.WithStageDispatcher(coordinator))
+	result := runner.ExecuteWithOptions(newRemoteWorkflow(t, registry, "fail"), gostage.DefaultRunOptions())
+
+	assert.False(t, result.Success)
+	require.Error(t, result.Error)
+	assert.Contains(t, result.Error.Error(), "remote worker")
+	assert.Contains(t, result.Error.Error(), "disk full")
+	assert.Equal(t, gostage.StatusFailed, result.StageStatuses["compute"])
+}
+
+func TestRemoteStageWithoutCapableAgent(t *testing.T) {
+	coordinator, target := startCoordinator(t)
+	agentRegistry := gostage.NewActionRegistry()
+	require.NoError(t, agentRegistry.Register("other", func() gostage.Action {
+		return &funcAction{BaseAction: gostage.NewBaseAction("other", "")}
+	}))
+	startAgent(t, coordinator, target, NewAgent("worker-1", agentRegistry))
+
+	runner := gostage.NewRunner(gostage.WithStageDispatcher(coordinator))
+	result := runner.ExecuteWithOptions(newRemoteWorkflow(t, newTestRegistry(t, nil), "double"), gostage.DefaultRunOptions())
+
+	assert.False(t, result.Success)
+	assert.ErrorIs(t, result.Error, ErrNoAgent)
+}
+
+func TestRemoteStageCancellation(t *testing.T) {
+	registry := newTestRegistry(t, make(chan struct{}))
+	coordinator, target := startCoordinator(t)
+	startAgent(t, coordinator, target, NewAgent("worker-1", registry))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		assert.Eventually(t, func() bool { return coordinator.Agents()[0].Tasks == 1 }, 5*time.Second, 10*time.Millisecond)
+		cancel()
+	}()
+
+	options := gostage.DefaultRunOptions()
+	options.Context = ctx
+	runner := gostage.NewRunner(gostage.WithStageDispatcher(coordinator))
+	result := runner.ExecuteWithOptions(newRemoteWorkflow(t, registry, "block"), options)
+
+	assert.False(t, result.Success)
+	require.Error(t, result.Error)
+	assert.Contains(t, result.Error.Error(), context.Canceled.Error())
+	assert.Equal(t, 0, coordinator.Agents()[0].Tasks)
+}
+
+func TestRemoteAgentLost(t *testing.T) {
+	registry := newTestRegistry(t, make(chan struct{}))
+	coordinator, target := startCoordinator(t)
+	stop := startAgent(t, coordinator, target, NewAgent("worker-1", registry))
+
+	go func() {
+		assert.Eventually(t, func() bool {
+			agents := coordinator.Agents()
+			return len(agents) == 1 && agents[0].Tasks == 1
+		}, 5*time.Second, 10*time.Millisecond)
+		assert.NoError(t, stop())
+	}()
+
+	runner := gostage.NewRunner(gostage.WithStageDispatcher(coordinator))
+	result := runner.ExecuteWithOptions(newRemoteWorkflow(t, registry, "block"), gostage.DefaultRunOptions())
+
+	assert.False(t, result.Success)
+	assert.ErrorIs(t, result.Error, ErrAgentLost)
+	assert.Empty(t, coordinator.Agents())
+}
+
+func TestDuplicateAgentIsRejected(t *testing.T) {
+	coordinator, target := startCoordinator(t)
+	startAgent(t, coordinator, target, NewAgent("worker-1", newTestRegistry(t, nil)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := NewAgent("worker-1", newTestRegistry(t, nil)).Run(ctx, target)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "already connected")
+}
+
+func TestSignedRemoteStages(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := gostage.NewDefinitionSigner("deploy", private)
+	require.NoError(t, err)
+	trust := gostage.NewTrustStore()
+	require.NoError(t, trust.Add("deploy", public))
+
+	registry := newTestRegistry(t, nil)
+	coordinator, target := startCoordinator(t, WithSigner(signer))
+	startAgent(t, coordinator, target, NewAgent("worker-1", registry, WithRunnerOptions(gostage.WithTrustStore(trust))))
+
+	runner := gostage.NewRunner(gostage.WithStageDispatcher(coordinator))
+	result := runner.ExecuteWithOptions(newRemoteWorkflow(t, registry, "double"), gostage.DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, float64(42), result.FinalStore["doubled"])
+
+	// An agent that does not trust the coordinator's key refuses its stages
+	other, otherTarget := startCoordinator(t)
+	startAgent(t, other, otherTarget, NewAgent("worker-2", registry, WithRunnerOptions(gostage.WithTrustStore(trust))))
+	runner = gostage.NewRunner(gostage.WithStageDispatcher(other))
+	result = runner.ExecuteWithOptions(newRemoteWorkflow(t, registry, "double"), gostage.DefaultRunOptions())
+	require.False(t, result.Success)
+	assert.ErrorContains(t, result.Error, gostage.ErrUntrustedDefinition.Error())
+	assert.NotContains(t, result.FinalStore, "doubled")
+}
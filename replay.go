@@ -0,0 +1,363 @@
+package gostage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/davidroman0O/gostage/store"
+)
+
+const (
+	// contextRunRecording holds the *runRecorder of a run made with RunOptions.Record
+	contextRunRecording = "runRecording"
+	// contextRunReplay holds the *runReplay of a run made with RunOptions.Replay
+	contextRunReplay = "runReplay"
+)
+
+// RunRecording is the record of a run made with RunOptions.Record, which
+// RunOptions.Replay replays. It can be saved as JSON. Store values are kept
+// as they are, without redaction.
+type RunRecording struct {
+	WorkflowID string    `json:"workflowId"`
+	StartedAt  time.Time `json:"startedAt"`
+	// InitialStore holds the JSON encoding of the user store values when the run started
+	InitialStore map[string]json.RawMessage `json:"initialStore,omitempty"`
+	// Actions are the executions of the actions of the run, in order
+	Actions []RecordedAction `json:"actions"`
+	// Error is the failure of the run
+	Error string `json:"error,omitempty"`
+}
+
+// RecordedAction is the record of one execution of an action.
+type RecordedAction struct {
+	StageID   string        `json:"stageId"`
+	Action    string        `json:"action"`
+	Iteration int           `json:"iteration,omitempty"`
+	Duration  time.Duration `json:"duration"`
+	// Reads holds the JSON encoding of the user store values read while the
+	// action executed, as they were first read
+	Reads map[string]json.RawMessage `json:"reads,omitempty"`
+	// Puts and Deletes are the store changes made by the action
+	Puts    map[string]json.RawMessage `json:"puts,omitempty"`
+	Deletes []string                   `json:"deletes,omitempty"`
+	// Result is the result the action set
+	Result *ActionResult `json:"result,omitempty"`
+	// Error is the failure of the action
+	Error string `json:"error,omitempty"`
+}
+
+// ReplayDivergence reports an action that behaved differently when a run
+// was replayed than in the recording.
+type ReplayDivergence struct {
+	StageID string
+	Action  string
+	Reason  string
+}
+
+// ReplayableAction is implemented by actions whose recorded outcome is fed
+// back when a run is replayed, instead of executing them again. Mark the
+// actions that depend on the outside world, such as API calls or clocks, so
+// that replaying a past run reproduces it deterministically.
+type ReplayableAction interface {
+	Action
+
+	// Replayable reports whether the recorded outcome replaces the execution
+	Replayable() bool
+}
+
+// replayableAction marks an existing action as replayable.
+type replayableAction struct {
+	Action
+}
+
+func (a *replayableAction) Replayable() bool {
+	return true
+}
+
+// WithReplay marks an action as replayable: a replayed run applies the store
+// changes, result and error recorded for it instead of executing it. Dynamic
+// actions and stages it added are not replayed. Apply WithReplay last, around
+// the other wrappers.
+func WithReplay(action Action) Action {
+	return &replayableAction{Action: action}
+}
+
+// isReplayable reports whether the recorded outcome of action replaces its execution.
+func isReplayable(action Action) bool {
+	replayable, ok := action.(ReplayableAction)
+	return ok && replayable.Replayable()
+}
+
+// runRecorder collects the recording of a run.
+type runRecorder struct {
+	mu        sync.Mutex
+	recording *RunRecording
+}
+
+func (r *runRecorder) add(record RecordedAction) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recording.Actions = append(r.recording.Actions, record)
+}
+
+// runReplay tracks the progress of a replayed run through its recording.
+type runReplay struct {
+	mu sync.Mutex
+	// pending holds the records not replayed yet, keyed by ActionStatusKey
+	pending     map[string][]RecordedAction
+	divergences []ReplayDivergence
+}
+
+func newRunReplay(recording *RunRecording) *runReplay {
+	replay := &runReplay{pending: make(map[string][]RecordedAction)}
+	for _, record := range recording.Actions {
+		key := ActionStatusKey(record.StageID, record.Action)
+		replay.pending[key] = append(replay.pending[key], record)
+	}
+	return replay
+}
+
+// next returns the next recorded execution of an action, or nil if the
+// recording has no more executions of it.
+func (p *runReplay) next(stageID, actionName string) *RecordedAction {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := ActionStatusKey(stageID, actionName)
+	records := p.pending[key]
+	if len(records) == 0 {
+		return nil
+	}
+	p.pending[key] = records[1:]
+	return &records[0]
+}
+
+// compare records a divergence when an action executed during the replay
+// did not behave as recorded.
+func (p *runReplay) compare(ctx *ActionContext, record RecordedAction, recorded *RecordedAction) {
+	var reason string
+	switch {
+	case recorded == nil:
+		reason = "not in the recording"
+	case record.Error != recorded.Error:
+		reason = fmt.Sprintf("error %q, recorded %q", record.Error, recorded.Error)
+	default:
+		keys := changedKeys(record, *recorded)
+		if len(keys) == 0 {
+			return
+		}
+		reason = fmt.Sprintf("store changes differ on keys %v", keys)
+	}
+
+	ctx.Logger.Warn("Replay of action %s diverged: %s", record.Action, reason)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.divergences = append(p.divergences, ReplayDivergence{StageID: record.StageID, Action: record.Action, Reason: reason})
+}
+
+// changedKeys returns the keys put or deleted differently by two executions of an action.
+func changedKeys(a, b RecordedAction) []string {
+	var keys []string
+	for key, value := range a.Puts {
+		if other, ok := b.Puts[key]; !ok || !sameJSON(value, other) {
+			keys = append(keys, key)
+		}
+	}
+	for key := range b.Puts {
+		if _, ok := a.Puts[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range a.Deletes {
+		if !slices.Contains(b.Deletes, key) {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range b.Deletes {
+		if !slices.Contains(a.Deletes, key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return slices.Compact(keys)
+}
+
+// sameJSON reports whether two JSON encodings are equal, ignoring formatting.
+func sameJSON(a, b json.RawMessage) bool {
+	var compactA, compactB bytes.Buffer
+	if json.Compact(&compactA, a) != nil || json.Compact(&compactB, b) != nil {
+		return bytes.Equal(a, b)
+	}
+	return bytes.Equal(compactA.Bytes(), compactB.Bytes())
+}
+
+// startRecording prepares the recording and the replay requested by options.
+// A replay restores the initial store of the recording first.
+func startRecording(w *Workflow, options RunOptions) error {
+	if options.Replay != nil {
+		if err := putRecorded(w.Store, options.Replay.InitialStore, nil); err != nil {
+			return fmt.Errorf("failed to restore the recorded store: %w", err)
+		}
+		w.Context[contextRunReplay] = newRunReplay(options.Replay)
+	}
+
+	if options.Record {
+		initial, err := encodeUserStore(w)
+		if err != nil {
+			return fmt.Errorf("failed to record workflow '%s': %w", w.ID, err)
+		}
+		recording := &RunRecording{WorkflowID: w.ID, StartedAt: time.Now(), InitialStore: make(map[string]json.RawMessage, len(initial))}
+		for key, value := range initial {
+			recording.InitialStore[key] = json.RawMessage(value)
+		}
+		w.Context[contextRunRecording] = &runRecorder{recording: recording}
+	}
+	return nil
+}
+
+// finishRecording ends the recording and the replay of a run, returning the
+// recording and the divergences found.
+func finishRecording(w *Workflow, runErr error) (*RunRecording, []ReplayDivergence) {
+	var recording *RunRecording
+	if recorder, ok := w.Context[contextRunRecording].(*runRecorder); ok {
+		recording = recorder.recording
+		if runErr != nil {
+			recording.Error = runErr.Error()
+		}
+	}
+	var divergences []ReplayDivergence
+	if replay, ok := w.Context[contextRunReplay].(*runReplay); ok {
+		divergences = replay.divergences
+	}
+	delete(w.Context, contextRunRecording)
+	delete(w.Context, contextRunReplay)
+	return recording, divergences
+}
+
+// recordExecution runs execute, the execution of the current action of ctx,
+// recording it when the run is recorded. When the run is replayed, the
+// recorded outcome of replayable actions is fed back instead, and the other
+// actions are compared with their record.
+func recordExecution(ctx *ActionContext, execute func() error) error {
+	w := ctx.Workflow
+	recorder, _ := w.Context[contextRunRecording].(*runRecorder)
+	replay, _ := w.Context[contextRunReplay].(*runReplay)
+	if recorder == nil && replay == nil {
+		return execute()
+	}
+
+	record := RecordedAction{StageID: ctx.Stage.ID, Action: ctx.Action.Name(), Iteration: ctx.Iteration}
+	var recorded *RecordedAction
+	if replay != nil {
+		recorded = replay.next(record.StageID, record.Action)
+	}
+	feed := recorded != nil && isReplayable(ctx.Action)
+
+	before, err := encodeUserStore(w)
+	if err != nil {
+		return fmt.Errorf("failed to record action: %w", err)
+	}
+
+	var readsMu sync.Mutex
+	stop := w.Store.OnRead(func(key string, value any) {
+		if hasSystemPrefix(key) {
+			return
+		}
+		readsMu.Lock()
+		defer readsMu.Unlock()
+		if _, seen := record.Reads[key]; seen {
+			return
+		}
+		if data, err := json.Marshal(value); err == nil {
+			if record.Reads == nil {
+				record.Reads = make(map[string]json.RawMessage)
+			}
+			record.Reads[key] = data
+		}
+	})
+
+	started := time.Now()
+	var runErr error
+	if feed {
+		ctx.Logger.Debug("Replaying the recorded outcome of action %s", record.Action)
+		runErr = feedRecorded(ctx, *recorded)
+	} else {
+		runErr = execute()
+	}
+	stop()
+	record.Duration = time.Since(started)
+
+	after, err := encodeUserStore(w)
+	if err != nil {
+		if runErr != nil {
+			return runErr
+		}
+		return fmt.Errorf("failed to record action: %w", err)
+	}
+	record.Puts, record.Deletes = storeDelta(before, after)
+	if ctx.result != nil {
+		result := *ctx.result
+		record.Result = &result
+	}
+	if runErr != nil {
+		record.Error = runErr.Error()
+	}
+
+	if replay != nil && !feed {
+		replay.compare(ctx, record, recorded)
+	}
+	if recorder != nil {
+		recorder.add(record)
+	}
+	return runErr
+}
+
+// feedRecorded applies the recorded outcome of an action in place of its execution.
+func feedRecorded(ctx *ActionContext, recorded RecordedAction) error {
+	if err := putRecorded(ctx.Workflow.Store, recorded.Puts, recorded.Deletes); err != nil {
+		return err
+	}
+	if recorded.Result != nil {
+		ctx.SetResult(*recorded.Result)
+	}
+	if recorded.Error != "" {
+		return errors.New(recorded.Error)
+	}
+	return nil
+}
+
+// putRecorded applies recorded store changes. Values of keys already in the
+// store are decoded into the type of their current value, so that actions
+// reading them with store.Get keep working; other values are decoded as
+// generic JSON values.
+func putRecorded(s *store.KVStore, puts map[string]json.RawMessage, deletes []string) error {
+	current := s.ExportAll()
+	for key, raw := range puts {
+		var value interface{}
+		if existing, ok := current[key]; ok && existing != nil {
+			typed := reflect.New(reflect.TypeOf(existing))
+			if err := json.Unmarshal(raw, typed.Interface()); err == nil {
+				value = typed.Elem().Interface()
+			}
+		}
+		if value == nil {
+			if err := json.Unmarshal(raw, &value); err != nil {
+				return fmt.Errorf("failed to decode store key '%s': %w", key, err)
+			}
+		}
+		if err := s.Put(key, value); err != nil {
+			return fmt.Errorf("failed to restore store key '%s': %w", key, err)
+		}
+	}
+	for _, key := range deletes {
+		s.Delete(key)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package gostage
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/davidroman0O/gostage/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// conversionWorkflow fetches an exchange rate from quote and converts the
+// amount of the store with it, rounding with factor.
+func conversionWorkflow(quote func() (float64, error), factor int) *Workflow {
+	wf := NewWorkflow("conversion", "Conversion", "")
+
+	fetch := NewStage("fetch", "Fetch", "")
+	fetch.AddAction(WithReplay(NewActionFunc("quote", "", func(ctx *ActionContext) error {
+		rate, err := quote()
+		if err != nil {
+			return err
+		}
+		ctx.SetResult(ActionResult{Output: "quoted"})
+		return ctx.Store().Put("rate", rate)
+	})))
+	wf.AddStage(fetch)
+
+	convert := NewStage("convert", "Convert", "")
+	convert.AddAction(NewActionFunc("apply", "", func(ctx *ActionContext) error {
+		amount, err := store.Get[int](ctx.Store(), "amount")
+		if err != nil {
+			return err
+		}
+		rate, err := store.Get[float64](ctx.Store(), "rate")
+		if err != nil {
+			return err
+		}
+		return ctx.Store().Put("total", int(float64(amount)*rate)/factor*factor)
+	}))
+	wf.AddStage(convert)
+
+	wf.Store.Put("amount", 200)
+	return wf
+}
+
+func recordOptions() RunOptions {
+	options := DefaultRunOptions()
+	options.Record = true
+	return options
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	result := NewRunner().ExecuteWithOptions(conversionWorkflow(func() (float64, error) { return 1.5, nil }, 1), recordOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	require.NotNil(t, result.Recording)
+
+	recording := result.Recording
+	assert.Equal(t, "conversion", recording.WorkflowID)
+	assert.JSONEq(t, "200", string(recording.InitialStore["amount"]))
+	require.Len(t, recording.Actions, 2)
+	assert.Equal(t, "quote", recording.Actions[0].Action)
+	assert.JSONEq(t, "1.5", string(recording.Actions[0].Puts["rate"]))
+	assert.Equal(t, "quoted", recording.Actions[0].Result.Output)
+	assert.Equal(t, "apply", recording.Actions[1].Action)
+	assert.Len(t, recording.Actions[1].Reads, 2)
+	assert.JSONEq(t, "300", string(recording.Actions[1].Puts["total"]))
+
+	// Recordings survive a round trip through JSON
+	data, err := json.MarshalIndent(recording, "", "  ")
+	require.NoError(t, err)
+	var loaded RunRecording
+	require.NoError(t, json.Unmarshal(data, &loaded))
+
+	// The quote is not requested again: the recorded rate is fed back
+	quoted := false
+	options := DefaultRunOptions()
+	options.Replay = &loaded
+	replayed := NewRunner().ExecuteWithOptions(conversionWorkflow(func() (float64, error) {
+		quoted = true
+		return 2, nil
+	}, 1), options)
+	require.True(t, replayed.Success, "%v", replayed.Error)
+	assert.False(t, quoted)
+	assert.Equal(t, 300, replayed.FinalStore["total"])
+	assert.Equal(t, "quoted", replayed.ActionResults[ActionStatusKey("fetch", "quote")].Output)
+	assert.Empty(t, replayed.ReplayDivergences)
+	assert.Nil(t, replayed.Recording)
+
+	// Changed logic shows up as a divergence
+	replayed = NewRunner().ExecuteWithOptions(conversionWorkflow(nil, 7), options)
+	require.True(t, replayed.Success, "%v", replayed.Error)
+	assert.Equal(t, []ReplayDivergence{{StageID: "convert", Action: "apply", Reason: "store changes differ on keys [total]"}}, replayed.ReplayDivergences)
+}
+
+func TestReplayRecordedFailure(t *testing.T) {
+	result := NewRunner().ExecuteWithOptions(conversionWorkflow(func() (float64, error) {
+		return 0, errors.New("quote service unavailable")
+	}, 1), recordOptions())
+	require.Error(t, result.Error)
+	require.NotNil(t, result.Recording)
+	assert.Equal(t, "quote service unavailable", result.Recording.Actions[0].Error)
+	assert.Contains(t, result.Recording.Error, "quote service unavailable")
+
+	options := DefaultRunOptions()
+	options.Replay = result.Recording
+	replayed := NewRunner().ExecuteWithOptions(conversionWorkflow(func() (float64, error) { return 1, nil }, 1), options)
+	assert.ErrorContains(t, replayed.Error, "action 'quote' failed: quote service unavailable")
+}
+
+func TestRecordRequiresSerializableStore(t *testing.T) {
+	wf := conversionWorkflow(func() (float64, error) { return 1, nil }, 1)
+	wf.Store.Put("callback", func() {})
+
+	options := recordOptions()
+	result := NewRunner().ExecuteWithOptions(wf, options)
+	assert.ErrorContains(t, result.Error, "failed to record workflow 'conversion'")
+	assert.Nil(t, result.Recording)
+}
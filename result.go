@@ -0,0 +1,151 @@
+package gostage
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrNoResult is returned when an action did not record a result in the current run.
+var ErrNoResult = errors.New("action has no result")
+
+// ActionResult is the typed outcome of an action. It is kept by the runner
+// apart from the workflow store, so later actions can read it without the
+// action writing ad-hoc store keys.
+type ActionResult struct {
+	// Output is the value produced by the action
+	Output interface{} `json:"output,omitempty"`
+	// Artifacts lists the files or objects the action produced
+	Artifacts []Artifact `json:"artifacts,omitempty"`
+}
+
+// Artifact is a file or object produced by an action. Artifacts attached
+// with AttachArtifact or AttachArtifactFile also describe their content and
+// the action that attached them.
+type Artifact struct {
+	// Name identifies the artifact within the result, or within the run for attached artifacts
+	Name string `json:"name"`
+	// URI locates the artifact, such as a file path or an object storage URL
+	URI string `json:"uri"`
+	// MediaType is the media type of the content, such as "text/html"
+	MediaType string `json:"mediaType,omitempty"`
+	// Size is the size of the content in bytes
+	Size int64 `json:"size,omitempty"`
+	// StageID and Action identify the action that attached the artifact
+	StageID string `json:"stageId,omitempty"`
+	Action  string `json:"action,omitempty"`
+}
+
+// ResultAction is implemented by actions that return a result. The runner
+// calls ExecuteWithResult instead of Execute and records the result when the
+// action succeeds. Execute is still used when the action is wrapped by
+// another action, so it should record the result with SetResult.
+type ResultAction interface {
+	Action
+
+	// ExecuteWithResult performs the action's work and returns its result.
+	ExecuteWithResult(ctx *ActionContext) (ActionResult, error)
+}
+
+// actionResults holds the results recorded during a run.
+type actionResults struct {
+	mu sync.RWMutex
+	// byKey holds the results keyed by ActionStatusKey
+	byKey map[string]ActionResult
+	// byName holds the latest result of each action name
+	byName map[string]ActionResult
+}
+
+// SetResult sets the result of the current action. It is recorded once the
+// action succeeds, replacing any result set before.
+func (ctx *ActionContext) SetResult(result ActionResult) {
+	ctx.result = &result
+}
+
+// ResultOf returns the result recorded in the current run by the action with
+// the given name. The action of the current stage is preferred, then the
+// latest action of that name. A "stageID:actionName" key selects the action
+// of another stage.
+func (ctx *ActionContext) ResultOf(name string) (ActionResult, bool) {
+	results := ctx.Workflow.results()
+	results.mu.RLock()
+	defer results.mu.RUnlock()
+
+	if ctx.Stage != nil {
+		if result, ok := results.byKey[ActionStatusKey(ctx.Stage.ID, name)]; ok {
+			return result, true
+		}
+	}
+	if result, ok := results.byKey[name]; ok {
+		return result, true
+	}
+	result, ok := results.byName[name]
+	return result, ok
+}
+
+// ResultOutput returns the output of the result of an action, as found by
+// ResultOf, as a T. It fails with ErrNoResult if the action recorded no
+// result, or if the output is not a T.
+func ResultOutput[T any](ctx *ActionContext, name string) (T, error) {
+	var zero T
+	result, ok := ctx.ResultOf(name)
+	if !ok {
+		return zero, fmt.Errorf("%w: '%s'", ErrNoResult, name)
+	}
+	output, ok := result.Output.(T)
+	if !ok {
+		return zero, fmt.Errorf("output of action '%s' is %T, not %T", name, result.Output, zero)
+	}
+	return output, nil
+}
+
+// ActionResults returns the results recorded during the last run, keyed by ActionStatusKey.
+func (w *Workflow) ActionResults() map[string]ActionResult {
+	results := w.results()
+	results.mu.RLock()
+	defer results.mu.RUnlock()
+
+	out := make(map[string]ActionResult, len(results.byKey))
+	for key, result := range results.byKey {
+		out[key] = result
+	}
+	return out
+}
+
+// setActionResult records the result of an action in the run results.
+func (w *Workflow) setActionResult(stageID, actionName string, result ActionResult) {
+	results := w.results()
+	results.mu.Lock()
+	defer results.mu.Unlock()
+
+	if results.byKey == nil {
+		results.byKey = make(map[string]ActionResult)
+		results.byName = make(map[string]ActionResult)
+	}
+	results.byKey[ActionStatusKey(stageID, actionName)] = result
+	results.byName[actionName] = result
+}
+
+func (w *Workflow) results() *actionResults {
+	results, ok := w.Context[contextActionResults].(*actionResults)
+	if !ok {
+		results = &actionResults{}
+		w.Context[contextActionResults] = results
+	}
+	return results
+}
+
+// executeAction executes an action, calling ExecuteWithResult on actions
+// that return a result.
+func executeAction(ctx *ActionContext, action Action) error {
+	producer, ok := action.(ResultAction)
+	if !ok {
+		return action.Execute(ctx)
+	}
+	result, err := producer.ExecuteWithResult(ctx)
+	if err != nil {
+		return err
+	}
+	ctx.SetResult(result)
+	return nil
+}
@@ -0,0 +1,86 @@
+package gostage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countAction returns the number of items in the store as its result.
+type countAction struct {
+	BaseAction
+}
+
+func (a *countAction) Execute(ctx *ActionContext) error {
+	result, err := a.ExecuteWithResult(ctx)
+	ctx.SetResult(result)
+	return err
+}
+
+func (a *countAction) ExecuteWithResult(ctx *ActionContext) (ActionResult, error) {
+	items, err := readItems[string](ctx.Store(), "items")
+	if err != nil {
+		return ActionResult{}, err
+	}
+	return ActionResult{
+		Output:    len(items),
+		Artifacts: []Artifact{{Name: "report", URI: "file:///tmp/count.txt"}},
+	}, nil
+}
+
+func TestActionResults(t *testing.T) {
+	wf := NewWorkflow("results", "Results", "")
+	wf.Store.Put("items", []string{"a", "b", "c"})
+
+	var counted int
+	var fromOtherStage, missing, mismatched error
+	count := NewStage("count", "Count", "")
+	count.AddAction(&countAction{BaseAction: NewBaseAction("count", "")})
+	count.AddAction(NewActionFunc("label", "", func(ctx *ActionContext) error {
+		var err error
+		counted, err = ResultOutput[int](ctx, "count")
+		ctx.SetResult(ActionResult{Output: "count stage"})
+		return err
+	}))
+	wf.AddStage(count)
+
+	report := NewStage("report", "Report", "")
+	report.AddAction(NewActionFunc("label", "", func(ctx *ActionContext) error {
+		result, ok := ctx.ResultOf("count:label")
+		if !ok || result.Output != "count stage" {
+			fromOtherStage = errors.New("result of the count stage not found")
+		}
+		ctx.SetResult(ActionResult{Output: "report stage"})
+		return nil
+	}))
+	report.AddAction(NewActionFunc("check", "", func(ctx *ActionContext) error {
+		_, missing = ResultOutput[int](ctx, "publish")
+		_, mismatched = ResultOutput[string](ctx, "count")
+		return nil
+	}))
+	wf.AddStage(report)
+
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+
+	assert.Equal(t, 3, counted)
+	assert.NoError(t, fromOtherStage)
+	assert.ErrorIs(t, missing, ErrNoResult)
+	assert.EqualError(t, mismatched, "output of action 'count' is int, not string")
+
+	assert.Equal(t, ActionResult{
+		Output:    3,
+		Artifacts: []Artifact{{Name: "report", URI: "file:///tmp/count.txt"}},
+	}, result.ActionResults[ActionStatusKey("count", "count")])
+	assert.Equal(t, "count stage", result.ActionResults[ActionStatusKey("count", "label")].Output)
+	assert.Equal(t, "report stage", result.ActionResults[ActionStatusKey("report", "label")].Output)
+	assert.NotContains(t, result.ActionResults, ActionStatusKey("report", "check"))
+
+	// Results are not kept across runs, and failed actions record none
+	wf.Store.Put("items", "not a list")
+	result = NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.Error(t, result.Error)
+	assert.Empty(t, result.ActionResults)
+}
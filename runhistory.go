@@ -0,0 +1,68 @@
+package gostage
+
+import (
+	"time"
+
+	"github.com/davidroman0O/gostage/history"
+)
+
+// contextRunID holds the ID of the run in progress, set by ExecuteWithOptions
+const contextRunID = "runID"
+
+// WithHistory makes the runner save the outcome of every run executed with
+// ExecuteWithOptions in store, under the RunID of its RunResult. A run that
+// cannot be saved is logged and does not fail.
+func WithHistory(store history.Store) RunnerOption {
+	return func(r *Runner) {
+		r.history = store
+	}
+}
+
+// startRun assigns the ID of a run. A run recovered from the WAL keeps the ID
+// it was logged under.
+func startRun(w *Workflow) string {
+	runID := newRunID()
+	if run, ok := w.Context["walRun"].(*walRun); ok {
+		runID = run.id
+	}
+	w.Context[contextRunID] = runID
+	return runID
+}
+
+// RunID returns the ID of the run executing the action. It is the RunID of
+// the RunResult and of the events of the run, and is logged as "run".
+func (ctx *ActionContext) RunID() string {
+	if ctx.Workflow == nil {
+		return ""
+	}
+	runID, _ := ctx.Workflow.Context[contextRunID].(string)
+	return runID
+}
+
+// saveHistory saves the outcome of a run in the history of the runner.
+func (r *Runner) saveHistory(result RunResult, startedAt time.Time, logger Logger) {
+	if r.history == nil {
+		return
+	}
+
+	run := history.Run{
+		ID:             result.RunID,
+		WorkflowID:     result.WorkflowID,
+		Status:         history.StatusCompleted,
+		StartedAt:      startedAt,
+		FinishedAt:     startedAt.Add(result.ExecutionTime),
+		StageStatuses:  result.StageStatuses,
+		ActionStatuses: result.ActionStatuses,
+		Labels:         result.Labels,
+	}
+	if result.Error != nil {
+		run.Status = history.StatusFailed
+		if result.Interrupted {
+			run.Status = history.StatusInterrupted
+		}
+		run.Error = result.Error.Error()
+	}
+	if err := r.history.SaveRun(run); err != nil {
+		logger.Warn("Failed to save run %s to the history: %v", run.ID, err)
+	}
+}
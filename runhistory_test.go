@@ -0,0 +1,104 @@
+package gostage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/davidroman0O/gostage/history"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunnerSavesHistory(t *testing.T) {
+	runs := history.NewMemoryStore()
+	runner := NewRunner(WithHistory(runs))
+
+	build := func(err error) *Workflow {
+		wf := NewWorkflow("nightly", "Nightly", "")
+		stage := NewStage("export", "Export", "")
+		stage.AddAction(NewActionFunc("dump", "", func(*ActionContext) error { return err }))
+		wf.AddStage(stage)
+		return wf
+	}
+
+	started := time.Now()
+	succeeded := runner.ExecuteWithOptions(build(nil), DefaultRunOptions())
+	require.True(t, succeeded.Success, "%v", succeeded.Error)
+	failed := runner.ExecuteWithOptions(build(errors.New("disk full")), DefaultRunOptions())
+	require.Error(t, failed.Error)
+	require.NotEmpty(t, succeeded.RunID)
+	assert.NotEqual(t, succeeded.RunID, failed.RunID)
+
+	run, err := runs.GetRun(succeeded.RunID)
+	require.NoError(t, err)
+	assert.Equal(t, "nightly", run.WorkflowID)
+	assert.Equal(t, history.StatusCompleted, run.Status)
+	assert.False(t, run.StartedAt.Before(started))
+	assert.Equal(t, succeeded.ExecutionTime, run.Duration())
+	assert.Equal(t, StatusCompleted, run.ActionStatuses[ActionStatusKey("export", "dump")])
+
+	listed, err := runs.ListRuns("nightly", history.StatusFailed, started)
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.Equal(t, failed.RunID, listed[0].ID)
+	assert.Contains(t, listed[0].Error, "disk full")
+	assert.Equal(t, StatusFailed, listed[0].StageStatuses["export"])
+}
+
+func TestRunIDIsSharedWithWAL(t *testing.T) {
+	wal, err := NewFileWAL(t.TempDir())
+	require.NoError(t, err)
+
+	var logged []string
+	registry := NewActionRegistry()
+	require.NoError(t, registry.Register("inspect", func() Action {
+		return NewActionFunc("inspect", "", func(*ActionContext) error {
+			logged, err = wal.Runs()
+			return err
+		})
+	}))
+	action, err := registry.Resolve("inspect", nil)
+	require.NoError(t, err)
+
+	wf := NewWorkflow("durable", "Durable", "")
+	stage := NewStage("work", "Work", "")
+	stage.AddAction(action)
+	wf.AddStage(stage)
+
+	result := NewRunner(WithWAL(wal)).ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, []string{result.RunID}, logged)
+}
+
+func TestRunIDIsExposedToActionsAndEvents(t *testing.T) {
+	runner := NewRunner()
+	var events []Event
+	runner.Subscribe(EventAll, func(e Event) {
+		events = append(events, e)
+	})
+
+	var seen string
+	wf := NewWorkflow("traced", "Traced", "")
+	stage := NewStage("work", "Work", "")
+	stage.AddAction(NewActionFunc("inspect", "", func(ctx *ActionContext) error {
+		seen = ctx.RunID()
+		return nil
+	}))
+	wf.AddStage(stage)
+
+	result := runner.ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, result.RunID, seen)
+	require.NotEmpty(t, events)
+	for _, event := range events {
+		assert.Equal(t, result.RunID, event.RunID, "event %s", event.Type)
+	}
+
+	// Runs started with Execute get an ID of their own too
+	require.NoError(t, runner.Execute(context.Background(), wf, nil))
+	assert.NotEmpty(t, seen)
+	assert.NotEqual(t, result.RunID, seen)
+	assert.NotContains(t, wf.Context, contextRunID)
+}
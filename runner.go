@@ -3,12 +3,14 @@ package gostage
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"sync"
 	"time"
 
+	"github.com/davidroman0O/gostage/history"
+	"github.com/davidroman0O/gostage/lock"
 	"github.com/davidroman0O/gostage/store"
 )
 
@@ -33,6 +35,54 @@ type Runner struct {
 	Broker *RunnerBroker
 	// Spawn middleware for process lifecycle and communication
 	spawnMiddleware []SpawnMiddleware
+	// Workflow middleware applied around every stage of every workflow
+	workflowMiddleware []WorkflowMiddleware
+	// Action middleware applied around every action of every workflow
+	actionMiddleware []ActionMiddleware
+	// events dispatches lifecycle events to subscribers
+	events *EventBus
+	// redactor masks sensitive store values in logs, events and results
+	redactor *Redactor
+	// pool executes the workflows passed to Submit
+	pool *workerPool
+	// delayed tracks the workflows scheduled with ExecuteAt and ExecuteAfter
+	delayed *delayedRuns
+	// wal records run progress for durable execution, if enabled
+	wal WAL
+	// idempotency records the completed keys of idempotent actions
+	idempotency IdempotencyStore
+	// locks leases workflow IDs so that a single runner executes each workflow
+	locks lock.Provider
+	// lockTTL is the duration of workflow leases
+	lockTTL time.Duration
+	// runs tracks the workflows in flight for Shutdown
+	runs *runTracker
+	// dispatcher executes the stages tagged with TagRemote
+	dispatcher StageDispatcher
+	// spawnLimits constrains every child process started by the runner
+	spawnLimits ResourceLimits
+	// limiters holds the named rate limiters shared by actions
+	limiters rateLimiters
+	// pools holds the named concurrency pools that actions join by tag
+	pools concurrencyPools
+	// watchdog flags the actions that stop heartbeating, if enabled
+	watchdog *watchdog
+	// history saves the outcome of every run, if set
+	history history.Store
+	// clock tells the time, the system clock if nil
+	clock Clock
+	// workflows resolves the workflows started by name, the default registry if nil
+	workflows *WorkflowRegistry
+	// tenant partitions the backends, runs and events of the runner, if set
+	tenant string
+	// signer signs the definitions sent to child processes, if set
+	signer DefinitionSigner
+	// trust verifies the serialized definitions the runner executes, if set
+	trust *TrustStore
+	// services holds the services provided to actions
+	services serviceRegistry
+	// artifacts stores the artifacts attached by actions, if set
+	artifacts ArtifactBackend
 }
 
 // RunnerOption is a function that configures a Runner
@@ -45,6 +95,28 @@ func WithMiddleware(middleware ...Middleware) RunnerOption {
 	}
 }
 
+// WithWorkflowMiddleware adds workflow middleware that wraps every stage
+// executed by the runner, outside of the workflow's own middleware
+func WithWorkflowMiddleware(middleware ...WorkflowMiddleware) RunnerOption {
+	return func(r *Runner) {
+		r.workflowMiddleware = append(r.workflowMiddleware, middleware...)
+	}
+}
+
+// WithActionMiddleware adds action middleware that wraps every action executed by the runner
+func WithActionMiddleware(middleware ...ActionMiddleware) RunnerOption {
+	return func(r *Runner) {
+		r.actionMiddleware = append(r.actionMiddleware, middleware...)
+	}
+}
+
+// WithRedactor masks sensitive store values in the logs, events and results of every run
+func WithRedactor(redactor *Redactor) RunnerOption {
+	return func(r *Runner) {
+		r.redactor = redactor
+	}
+}
+
 // WithLogger sets the default logger for the runner
 func WithLogger(logger Logger) RunnerOption {
 	return func(r *Runner) {
@@ -74,11 +146,16 @@ func NewRunner(opts ...RunnerOption) *Runner {
 		defaultLogger:   NewDefaultLogger(),
 		options:         DefaultRunOptions(),
 		Broker:          NewRunnerBroker(os.Stdout),
+		events:          NewEventBus(),
+		pool:            newWorkerPool(0),
+		delayed:         newDelayedRuns(),
+		runs:            newRunTracker(),
 	}
 
 	for _, opt := range opts {
 		opt(r)
 	}
+	r.partitionBackends()
 
 	return r
 }
@@ -96,6 +173,27 @@ func (r *Runner) Use(middleware ...Middleware) {
 	r.middleware = append(r.middleware, middleware...)
 }
 
+// UseWorkflowMiddleware adds workflow middleware that wraps every stage executed by the runner
+func (r *Runner) UseWorkflowMiddleware(middleware ...WorkflowMiddleware) {
+	r.workflowMiddleware = append(r.workflowMiddleware, middleware...)
+}
+
+// UseActionMiddleware adds action middleware that wraps every action executed by the runner
+func (r *Runner) UseActionMiddleware(middleware ...ActionMiddleware) {
+	r.actionMiddleware = append(r.actionMiddleware, middleware...)
+}
+
+// Subscribe registers a handler for lifecycle events of the given types,
+// which can be combined with |. It returns a function that removes the subscription.
+func (r *Runner) Subscribe(types EventType, handler EventHandler) func() {
+	return r.events.Subscribe(types, handler)
+}
+
+// Events returns the runner's event bus
+func (r *Runner) Events() *EventBus {
+	return r.events
+}
+
 // Execute runs a workflow and its stages/actions.
 // It applies any configured middleware.
 func (r *Runner) Execute(ctx context.Context, workflow *Workflow, logger Logger) error {
@@ -104,6 +202,24 @@ func (r *Runner) Execute(ctx context.Context, workflow *Workflow, logger Logger)
 		logger = r.defaultLogger
 	}
 
+	// Every execution gets a run ID, including those not started by ExecuteWithOptions
+	if _, ok := workflow.Context[contextRunID].(string); !ok {
+		startRun(workflow)
+		defer delete(workflow.Context, contextRunID)
+	}
+
+	// Refuse new work once the runner is shutting down
+	ctx, untrack, err := r.runs.track(ctx, workflow)
+	if err != nil {
+		return fmt.Errorf("cannot execute workflow '%s': %w", workflow.ID, err)
+	}
+	defer untrack()
+
+	// Mask secrets before any middleware gets to log
+	if r.redactor != nil {
+		logger = &redactingLogger{logger: logger, redactor: r.redactor, store: workflow.Store}
+	}
+
 	// Build the middleware chain and the core execution function
 	chain := r.executeWorkflow
 	for i := len(r.middleware) - 1; i >= 0; i-- {
@@ -114,60 +230,164 @@ func (r *Runner) Execute(ctx context.Context, workflow *Workflow, logger Logger)
 	return chain(ctx, workflow, logger)
 }
 
+// publish sends a lifecycle event of the workflow, redacting it if needed
+func (r *Runner) publish(w *Workflow, event Event) {
+	if _, traced := w.Context[contextRunTrace]; !traced && !r.events.wants(event.Type) {
+		return
+	}
+	if r.redactor != nil {
+		event = r.redactor.redactEvent(event, w.Store)
+	}
+	if event.Time.IsZero() {
+		event.Time = r.now()
+	}
+	if event.RunID == "" {
+		event.RunID, _ = w.Context[contextRunID].(string)
+	}
+	if event.Tenant == "" {
+		event.Tenant = r.tenant
+	}
+	if event.Labels == nil {
+		event.Labels = w.RunLabels()
+	}
+	traceEvent(w, event)
+	r.events.Publish(event)
+}
+
 // executeWorkflow is the core workflow execution logic
-func (r *Runner) executeWorkflow(ctx context.Context, w *Workflow, logger Logger) error {
+func (r *Runner) executeWorkflow(ctx context.Context, w *Workflow, logger Logger) (err error) {
 	w.Context["runner"] = r // Expose runner to the context
 
 	if len(w.Stages) == 0 {
 		return fmt.Errorf("workflow '%s' has no stages to execute", w.ID)
 	}
 
+	// Load the runtime configuration bound to the store
+	if err := w.resolveBindings(); err != nil {
+		return err
+	}
+
+	// Enrich every log line of this run with the workflow and run IDs, and the tenant
+	fields := []interface{}{"workflow", w.ID, "run", w.Context[contextRunID]}
+	if r.tenant != "" {
+		fields = append(fields, "tenant", r.tenant)
+	}
+	logger = LoggerWith(logger, fields...)
+
+	// Make sure no other runner executes this workflow at the same time
+	ctx, releaseLock, err := r.acquireWorkflowLock(ctx, w, logger)
+	if err != nil {
+		return err
+	}
+	defer releaseLock()
+
+	// Open the run's log before doing any work when durable execution is enabled
+	if err := r.walStart(w); err != nil {
+		return err
+	}
+	defer func() {
+		// A panicking run is treated like a crash and left open for recovery
+		if p := recover(); p != nil {
+			panic(p)
+		}
+		// So is a run interrupted by Shutdown
+		if shutdownInterrupt(ctx) != nil {
+			return
+		}
+		r.walFinish(w, err)
+	}()
+
 	logger.Info("Starting workflow: %s (%s)", w.Name, w.ID)
+	r.publish(w, Event{Type: EventWorkflowStarted, WorkflowID: w.ID, Annotations: mergedAnnotations(w, nil, nil)})
+	defer func() {
+		if err != nil {
+			r.publish(w, Event{Type: EventWorkflowFailed, WorkflowID: w.ID, Error: err, Annotations: mergedAnnotations(w, nil, nil)})
+		} else {
+			r.publish(w, Event{Type: EventWorkflowCompleted, WorkflowID: w.ID, Annotations: mergedAnnotations(w, nil, nil)})
+		}
+	}()
+
+	// Stop the run once it outlives the deadline or maximum duration of the workflow
+	ctx, stopDeadline := r.startDeadline(ctx, w)
+	defer func() { err = stopDeadline(err) }()
 
 	// Update workflow status in store
 	workflowKey := PrefixWorkflow + w.ID
 	w.Store.SetProperty(workflowKey, PropStatus, StatusRunning)
+	w.resetStatuses()
 
 	// Initialize the disabled stages map if it doesn't exist
-	if _, ok := w.Context["disabledStages"]; !ok {
+	if _, ok := w.Context["disabledStages"].(map[string]bool); !ok {
 		w.Context["disabledStages"] = make(map[string]bool)
 	}
 
-	disabledStages, ok := w.Context["disabledStages"].(map[string]bool)
-	if !ok {
-		disabledStages = make(map[string]bool)
-		w.Context["disabledStages"] = disabledStages
-	}
+	// runStageOn executes a stage of w, or of a copy of w for the stages
+	// running at the same time, through the workflow and runner middleware
+	var runStageOn func(ctx context.Context, stage *Stage, workflow *Workflow) error
 
 	// Define a core function that executes a stage with workflow middleware
 	executeStageWithMiddleware := func(ctx context.Context, stage *Stage, workflow *Workflow, logger Logger) error {
-		// Skip disabled stages
-		if disabledStages[stage.ID] {
+		// Skip disabled stages and stages the run does not select
+		disabledStages, _ := workflow.Context["disabledStages"].(map[string]bool)
+		if selection := runSelectionOf(workflow); disabledStages[stage.ID] || (selection != nil && !selection.selectsStage(stage)) {
 			logger.Debug("Skipping disabled stage: %s", stage.Name)
+			workflow.setStageStatus(stage.ID, StatusSkipped)
+			r.publish(workflow, Event{Type: EventStageSkipped, WorkflowID: workflow.ID, StageID: stage.ID, Annotations: mergedAnnotations(workflow, stage, nil)})
 			return nil
 		}
 
+		// A dry run reports the stage instead of executing it
+		if isDryRun(workflow) {
+			r.dryRunStage(stage, workflow, logger)
+			return nil
+		}
+
+		// Stages are not started once the run's context is cancelled
+		if cancelled(ctx) {
+			workflow.markStageCancelled(stage)
+			return fmt.Errorf("stage '%s' cancelled: %w", stage.Name, context.Cause(ctx))
+		}
+
 		// Update stage status in store
-		stageKey := PrefixStage + stage.ID
-		workflow.Store.SetProperty(stageKey, PropStatus, StatusRunning)
+		workflow.setStageStatus(stage.ID, StatusRunning)
+		r.publish(workflow, Event{Type: EventStageStarted, WorkflowID: workflow.ID, StageID: stage.ID, Annotations: mergedAnnotations(workflow, stage, nil)})
 
-		// Execute the stage
+		// Execute the stage, or the stages of the selected branch of an if or switch stage
 		logger.Debug("Executing stage: %s", stage.Name)
-		if err := r.executeStage(ctx, stage, workflow, logger); err != nil {
-			workflow.Store.SetProperty(stageKey, PropStatus, StatusFailed)
-			workflow.Store.SetProperty(workflowKey, PropStatus, StatusFailed)
+		// The store must satisfy the schemas the stage declared on both sides of it
+		err := checkContract(workflow, stage, boundaryConsumes)
+		if err == nil {
+			if stage.branches != nil {
+				err = r.executeBranches(ctx, stage, workflow, LoggerWith(logger, "stage", stage.ID), func(ctx context.Context, nested *Stage) error {
+					return runStageOn(ctx, nested, workflow)
+				})
+			} else {
+				err = r.executeStage(ctx, stage, workflow, logger)
+			}
+		}
+		if err == nil {
+			err = checkContract(workflow, stage, boundaryProduces)
+		}
+		if err != nil {
+			status := StatusFailed
+			if interruption(ctx) != nil {
+				status = StatusInterrupted
+			} else if cancelled(ctx) {
+				status = StatusCancelled
+			}
+			workflow.setStageStatus(stage.ID, status)
+			workflow.Store.SetProperty(workflowKey, PropStatus, status)
+			r.publish(workflow, Event{Type: EventStageFailed, WorkflowID: workflow.ID, StageID: stage.ID, Error: err, Annotations: mergedAnnotations(workflow, stage, nil)})
 			return fmt.Errorf("stage '%s' failed: %w", stage.Name, err)
 		}
 
 		logger.Info("Completed stage: %s", stage.Name)
-		workflow.Store.SetProperty(stageKey, PropStatus, StatusCompleted)
+		workflow.setStageStatus(stage.ID, StatusCompleted)
+		r.publish(workflow, Event{Type: EventStageCompleted, WorkflowID: workflow.ID, StageID: stage.ID, Annotations: mergedAnnotations(workflow, stage, nil)})
 		return nil
 	}
 
-	// We need to execute stages one by one, as dynamic stages can be inserted during execution
-	for i := 0; i < len(w.Stages); i++ {
-		stage := w.Stages[i]
-
+	runStageOn = func(ctx context.Context, stage *Stage, workflow *Workflow) error {
 		// Create a base stage runner function
 		stageRunner := executeStageWithMiddleware
 
@@ -178,20 +398,46 @@ func (r *Runner) executeWorkflow(ctx context.Context, w *Workflow, logger Logger
 			}
 		}
 
-		// Execute stage with workflow middleware
-		if err := stageRunner(ctx, stage, w, logger); err != nil {
+		// Runner-level workflow middleware wraps the workflow's own middleware
+		for j := len(r.workflowMiddleware) - 1; j >= 0; j-- {
+			stageRunner = r.workflowMiddleware[j](stageRunner)
+		}
+
+		return stageRunner(ctx, stage, workflow, logger)
+	}
+	runStage := func(ctx context.Context, stage *Stage) error {
+		return runStageOn(ctx, stage, w)
+	}
+
+	// Parallel and pipeline workflows run their stages at the same time
+	if w.strategy != StrategySequential {
+		if err := r.executeConcurrently(ctx, w, runStageOn, logger); err != nil {
 			return err
 		}
+		logger.Info("Workflow completed successfully: %s", w.Name)
+		w.Store.SetProperty(workflowKey, PropStatus, StatusCompleted)
+		return nil
+	}
+
+	// We need to execute stages one by one, as dynamic stages can be inserted during execution
+	for i := 0; i < len(w.Stages); i++ {
+		stage := w.Stages[i]
+
+		// Stage boundaries are where preemptible submitted workflows can yield
+		if i > 0 {
+			preemptionPoint(ctx, logger)
+		}
+
+		// Execute stage with workflow middleware
+		if err := runStage(ctx, stage); err != nil {
+			return r.runAlwaysStages(ctx, w, w.Stages[i+1:], err, runStage, logger)
+		}
 
 		// Check if any dynamic stages were generated
 		if dynamicStages, ok := w.Context["dynamicStages"]; ok {
 			if stages, ok := dynamicStages.([]*Stage); ok && len(stages) > 0 {
 				logger.Debug("Found %d dynamic stages to insert after stage %s", len(stages), stage.ID)
 
-				// Insert the new stages after the current one
-				newStages := make([]*Stage, 0, len(w.Stages)+len(stages))
-				newStages = append(newStages, w.Stages[:i+1]...)
-
 				// Add each dynamic stage to the store
 				for _, dynStage := range stages {
 					// Add dynamic tag to these stages
@@ -206,24 +452,32 @@ func (r *Runner) executeWorkflow(ctx context.Context, w *Workflow, logger Logger
 					meta := store.NewMetadata()
 					meta.Tags = append(meta.Tags, dynStage.Tags...)
 					meta.Description = dynStage.Description
-					meta.SetProperty(PropOrder, i+1+len(newStages)-len(w.Stages[:i+1]))
 					meta.SetProperty(PropStatus, StatusPending)
 					meta.SetProperty(PropCreatedBy, "stage:"+stage.ID)
 
 					w.Store.PutWithMetadata(dynStageKey, dynStageInfo, meta)
 				}
 
-				newStages = append(newStages, stages...)
-				if i+1 < len(w.Stages) {
-					newStages = append(newStages, w.Stages[i+1:]...)
+				// Insert the new stages after the current one, or where they were placed
+				placements := make([]Placement, len(stages))
+				for j, dynStage := range stages {
+					placements[j] = dynStage.placement
+				}
+				newStages, err := placeDynamic(w.Stages, i, stages, placements,
+					func(s *Stage) string { return s.ID },
+					func(s *Stage) []string { return s.dependencies })
+				if err != nil {
+					delete(w.Context, "dynamicStages")
+					err = fmt.Errorf("failed to add dynamic stages of stage '%s': %w", stage.Name, err)
+					return r.runAlwaysStages(ctx, w, w.Stages[i+1:], err, runStage, logger)
 				}
 				w.Stages = newStages
 
 				// Remove the dynamic stages from context to avoid re-processing
 				delete(w.Context, "dynamicStages")
 
-				// Update workflow in store
-				w.saveToStore()
+				// Update the order of the stages and the workflow in store
+				w.reorderStages()
 			}
 		}
 	}
@@ -233,35 +487,104 @@ func (r *Runner) executeWorkflow(ctx context.Context, w *Workflow, logger Logger
 	return nil
 }
 
+// runAlwaysStages executes the remaining stages tagged with TagAlwaysRun after
+// a stage failed with err, ignoring the cancellation of the run so that they
+// can clean up. It returns err, joined with the errors of the failed cleanups.
+func (r *Runner) runAlwaysStages(ctx context.Context, w *Workflow, remaining []*Stage, err error, runStage func(context.Context, *Stage) error, logger Logger) error {
+	status := StatusFailed
+	if interruption(ctx) != nil {
+		status = StatusInterrupted
+	} else if cancelled(ctx) {
+		status = StatusCancelled
+	}
+
+	// A run left in the WAL by Shutdown is not over; it reaches its cleanup stages once recovered
+	if _, ok := w.Context["walRun"].(*walRun); ok && shutdownInterrupt(ctx) != nil {
+		return err
+	}
+
+	errs := []error{err}
+	cleanupCtx, cancelCleanup := cleanupContext(ctx, w)
+	defer cancelCleanup()
+	for _, stage := range remaining {
+		if !stage.HasTag(TagAlwaysRun) {
+			// Work a cancelled run will never reach is reported as cancelled
+			if status == StatusCancelled {
+				w.markStageCancelled(stage)
+			}
+			continue
+		}
+		logger.Info("Running always-run stage %s after failure", stage.Name)
+		if cleanupErr := runStage(cleanupCtx, stage); cleanupErr != nil {
+			errs = append(errs, cleanupErr)
+		}
+	}
+
+	// A failed cleanup does not change why the run stopped
+	w.Store.SetProperty(PrefixWorkflow+w.ID, PropStatus, status)
+	if len(errs) == 1 {
+		return err
+	}
+	return errors.Join(errs...)
+}
+
+// actionContexts recycles the action contexts of the stages that finished, as
+// every stage run needs one.
+var actionContexts = sync.Pool{New: func() any { return new(ActionContext) }}
+
+// releaseActionContext clears ctx, so that it keeps nothing of its stage
+// alive, and returns it to actionContexts.
+func releaseActionContext(ctx *ActionContext) {
+	*ctx = ActionContext{}
+	actionContexts.Put(ctx)
+}
+
 // executeStage runs all actions in a stage sequentially.
 // If dynamic actions are generated during execution, they are inserted after
 // the current action and executed in the same stage.
 // If dynamic stages are generated, they are stored for execution after this stage.
 func (r *Runner) executeStage(ctx context.Context, s *Stage, workflow *Workflow, logger Logger) error {
+	logger = LoggerWith(logger, "stage", s.ID)
+
+	// Stages tagged with TagSpawn run in a child process, those tagged with TagRemote on a remote worker
+	if s.HasTag(TagSpawn) {
+		limits, err := r.stageLimits(s)
+		if err != nil {
+			return err
+		}
+		return r.executeStageElsewhere(ctx, s, workflow, logger, "child process", func(ctx context.Context, def SubWorkflowDef, broker *RunnerBroker) error {
+			return spawnChild(ctx, def, broker, limits, r.signer)
+		})
+	}
+	if s.HasTag(TagRemote) {
+		if r.dispatcher == nil {
+			return fmt.Errorf("stage '%s' is tagged %q but the runner has no stage dispatcher", s.ID, TagRemote)
+		}
+		return r.executeStageElsewhere(ctx, s, workflow, logger, "remote worker", r.dispatcher.Dispatch)
+	}
+
 	if len(s.Actions) == 0 {
 		logger.Warn("Stage '%s' has no actions to execute", s.ID)
 		return nil
 	}
 
-	// Copy the stage's initial store data to the workflow's store
+	// Merge the stage's initial store data into the workflow's store
 	if s.initialStore != nil && workflow.Store != nil {
-		logger.Debug("Merging stage's initialStore into workflow store. Stage: %s, Keys in initialStore: %d",
-			s.ID, s.initialStore.Count())
-		copied, overwritten, err := workflow.Store.CopyFromWithOverwrite(s.initialStore)
-		if err != nil {
-			logger.Error("Failed to copy stage's initialStore: %v", err)
-		} else {
-			logger.Debug("Copied %d keys, overwrote %d keys from stage's initialStore", copied, overwritten)
+		if err := s.mergeInitialData(workflow, logger); err != nil {
+			return err
 		}
 	}
 
-	// Initialize the action context with disabled maps
-	actionCtx := &ActionContext{
+	// Initialize the action context with disabled maps, reusing the context
+	// of a stage that finished
+	actionCtx := actionContexts.Get().(*ActionContext)
+	defer releaseActionContext(actionCtx)
+	*actionCtx = ActionContext{
 		GoContext:       ctx,
 		Workflow:        workflow,
 		Stage:           s,
 		Action:          nil,
-		Logger:          logger,
+		Logger:          AsFieldLogger(logger),
 		dynamicActions:  []Action{},
 		dynamicStages:   []*Stage{},
 		disabledActions: make(map[string]bool),
@@ -281,42 +604,98 @@ func (r *Runner) executeStage(ctx context.Context, s *Stage, workflow *Workflow,
 		}
 	}
 
+	// Load the initial data only known once the stage starts
+	if _, err := s.applyInitialData(actionCtx); err != nil {
+		return err
+	}
+
 	// Define the core stage execution function
 	executeStageCore := func(ctx context.Context, stage *Stage, wf *Workflow, logger Logger) error {
+		// Define the core action execution function
+		var executeActionCore ActionRunnerFunc = func(ctx *ActionContext, act Action, index int, isLast bool) error {
+			primary := primaryAction(act)
+			return executeInPools(ctx, primary, func() error { return executeAction(ctx, primary) })
+		}
+
+		// Skip actions whose idempotency key already completed, including on retries
+		executeActionCore = r.idempotent(stage.ID, executeActionCore)
+
+		// Apply runner-level action middleware (first middleware is the outermost wrapper)
+		for j := len(r.actionMiddleware) - 1; j >= 0; j-- {
+			executeActionCore = r.actionMiddleware[j](executeActionCore)
+		}
+
+		// Per-action logging is skipped altogether when the logger discards it
+		verbose := !discardsLogs(logger)
+		stageLogger := AsFieldLogger(logger)
+
 		// We need to execute actions one by one, as dynamic actions can be inserted during execution
+		stage.resolveActions(0)
+		selection := runSelectionOf(wf)
 		for i := 0; i < len(stage.Actions); i++ {
 			action := stage.Actions[i]
-			actionKey := PrefixAction + stage.ID + ":" + action.Name()
+			statusKey := stage.resolved[i].key
+
+			// Stop between actions once the run is interrupted by a signal or by
+			// Shutdown, or its context is cancelled
+			if err := interruption(ctx); err != nil {
+				return err
+			}
+			if cancelled(ctx) {
+				wf.markActionsCancelled(stage, i)
+				return context.Cause(ctx)
+			}
 
 			// Update action status in store
-			wf.Store.SetProperty(actionKey, PropStatus, StatusRunning)
+			wf.setActionStatusAt(statusKey, StatusRunning)
+			annotations := mergedAnnotations(wf, stage, action)
 
-			// Skip disabled actions
-			if actionCtx.disabledActions[action.Name()] {
+			// Skip disabled actions and actions the run does not select
+			if actionCtx.disabledActions[action.Name()] || (selection != nil && !selection.selectsAction(stage, action)) {
 				logger.Debug("Skipping disabled action: %s", action.Name())
-				wf.Store.SetProperty(actionKey, PropStatus, StatusSkipped)
+				wf.setActionStatusAt(statusKey, StatusSkipped)
+				r.publish(wf, Event{Type: EventActionSkipped, WorkflowID: wf.ID, StageID: stage.ID, ActionName: action.Name(), Annotations: annotations})
 				continue
 			}
 
-			logger.Debug("Executing action %d/%d: %s", i+1, len(stage.Actions), action.Name())
+			// Skip actions a recovered run already completed before the crash
+			if actionCtx.Iteration == 0 && walCompleted(wf, stage.ID, action.Name()) {
+				logger.Debug("Skipping action completed before recovery: %s", action.Name())
+				wf.setActionStatusAt(statusKey, StatusCompleted)
+				continue
+			}
 
 			// Update the context with the current action and position info
 			actionCtx.Action = action
+			actionCtx.Logger = stageLogger
+			if verbose {
+				logger.Debug("Executing action %d/%d: %s", i+1, len(stage.Actions), action.Name())
+				actionCtx.Logger = LoggerWith(logger, "action", action.Name())
+			}
 			actionCtx.ActionIndex = i
 			actionCtx.IsLastAction = (i == len(stage.Actions)-1)
 
-			// Define the core action execution function
-			executeActionCore := func(ctx *ActionContext, act Action, index int, isLast bool) error {
-				return act.Execute(ctx)
+			// Render templated params against the live store, then execute the action
+			r.publish(wf, Event{Type: EventActionStarted, WorkflowID: wf.ID, StageID: stage.ID, ActionName: action.Name(), Annotations: annotations})
+			actionCtx.result = nil
+			err := publishActionParams(actionCtx, action)
+			if err == nil {
+				err = creditStoreAccesses(actionCtx, func() error {
+					return recordExecution(actionCtx, func() error {
+						return r.watch(actionCtx, func() error {
+							// Fallbacks run once the action middleware, with any retries, gave up
+							return runFallback(actionCtx, action, executeActionCore(actionCtx, action, i, actionCtx.IsLastAction))
+						})
+					})
+				})
 			}
-
-			// Create a function for running through any workflow-level action middleware
-			// We can add this feature later if needed
-
-			// Execute the action
-			err := executeActionCore(actionCtx, action, i, actionCtx.IsLastAction)
 			if err != nil {
-				wf.Store.SetProperty(actionKey, PropStatus, StatusFailed)
+				status := StatusFailed
+				if cancelled(ctx) {
+					status = StatusCancelled
+				}
+				wf.setActionStatusAt(statusKey, status)
+				r.publish(wf, Event{Type: EventActionFailed, WorkflowID: wf.ID, StageID: stage.ID, ActionName: action.Name(), Error: err, Annotations: annotations})
 				return fmt.Errorf("action '%s' failed: %w", action.Name(), err)
 			}
 
@@ -324,14 +703,10 @@ func (r *Runner) executeStage(ctx context.Context, s *Stage, workflow *Workflow,
 			if len(actionCtx.dynamicActions) > 0 {
 				logger.Debug("Action generated %d new actions", len(actionCtx.dynamicActions))
 
-				// Insert the new actions after the current one
-				newActions := make([]Action, 0, len(stage.Actions)+len(actionCtx.dynamicActions))
-				newActions = append(newActions, stage.Actions[:i+1]...)
-
 				// Store each dynamic action in the KV store
 				for _, dynAction := range actionCtx.dynamicActions {
 					// Create a key for the action
-					dynActionKey := PrefixAction + stage.ID + ":" + dynAction.Name()
+					dynActionKey := actionStoreKey(stage.ID, dynAction.Name())
 
 					// Create metadata for the action
 					meta := store.NewMetadata()
@@ -348,29 +723,51 @@ func (r *Runner) executeStage(ctx context.Context, s *Stage, workflow *Workflow,
 					wf.Store.PutWithMetadata(dynActionKey, dynAction.Description(), meta)
 				}
 
-				newActions = append(newActions, actionCtx.dynamicActions...)
-				if i+1 < len(stage.Actions) {
-					newActions = append(newActions, stage.Actions[i+1:]...)
-				}
-				stage.Actions = newActions
+				// Insert the new actions after the current one, or where they were placed
+				newActions, err := placeDynamic(stage.Actions, i, actionCtx.dynamicActions, actionCtx.dynamicActionPlacements,
+					func(a Action) string { return a.Name() },
+					func(Action) []string { return nil })
 
 				// Clear dynamic actions for the next iteration
 				actionCtx.dynamicActions = []Action{}
+				actionCtx.dynamicActionPlacements = nil
+
+				if err != nil {
+					wf.setActionStatusAt(statusKey, StatusFailed)
+					return fmt.Errorf("action '%s' failed to add dynamic actions: %w", action.Name(), err)
+				}
+				stage.Actions = newActions
+				stage.resolveActions(0)
 			}
 
 			// Check if the action generated new stages to be inserted
 			if len(actionCtx.dynamicStages) > 0 {
 				logger.Debug("Action generated %d new stages", len(actionCtx.dynamicStages))
 
-				// Store the stages to be added to the workflow after this stage completes
-				wf.Context["dynamicStages"] = actionCtx.dynamicStages
+				// Store the stages to be added to the workflow after this stage completes,
+				// after those added by the previous actions of the stage
+				pending, _ := wf.Context["dynamicStages"].([]*Stage)
+				wf.Context["dynamicStages"] = append(pending, actionCtx.dynamicStages...)
 
 				// Clear dynamic stages for the next iteration
 				actionCtx.dynamicStages = []*Stage{}
 			}
 
-			logger.Debug("Completed action %d/%d: %s", i+1, len(stage.Actions), action.Name())
-			wf.Store.SetProperty(actionKey, PropStatus, StatusCompleted)
+			// Record the result the action returned or set
+			if actionCtx.result != nil {
+				wf.setActionResult(stage.ID, action.Name(), *actionCtx.result)
+				actionCtx.result = nil
+			}
+
+			if err := r.walActionCompleted(wf, stage.ID, action.Name()); err != nil {
+				return fmt.Errorf("failed to record completion of action '%s': %w", action.Name(), err)
+			}
+
+			if verbose {
+				logger.Debug("Completed action %d/%d: %s", i+1, len(stage.Actions), action.Name())
+			}
+			wf.setActionStatusAt(statusKey, StatusCompleted)
+			r.publish(wf, Event{Type: EventActionCompleted, WorkflowID: wf.ID, StageID: stage.ID, ActionName: action.Name(), Annotations: annotations})
 		}
 
 		return nil
@@ -379,6 +776,11 @@ func (r *Runner) executeStage(ctx context.Context, s *Stage, workflow *Workflow,
 	// Apply stage middleware
 	var stageHandler StageRunnerFunc = executeStageCore
 
+	// Loop stages repeat their actions inside the middleware chain
+	if s.loop != nil {
+		stageHandler = s.loop.wrap(actionCtx, stageHandler)
+	}
+
 	// Apply middleware in reverse order (so the first middleware is the outermost wrapper)
 	if s.middleware != nil {
 		for i := len(s.middleware) - 1; i >= 0; i-- {
@@ -398,12 +800,44 @@ func (r *Runner) executeStage(ctx context.Context, s *Stage, workflow *Workflow,
 
 // RunResult contains the result of a workflow execution
 type RunResult struct {
+	// RunID identifies the run, such as in the history of the runner
+	RunID         string
 	WorkflowID    string
 	Success       bool
 	Error         error
 	ExecutionTime time.Duration
 	// FinalStore contains the workflow's store state after execution
 	FinalStore map[string]interface{}
+	// StageStatuses contains the status of each stage reached during execution, keyed by stage ID
+	StageStatuses map[string]string
+	// ActionStatuses contains the status of each action reached during execution, keyed by ActionStatusKey
+	ActionStatuses map[string]string
+	// ActionResults contains the results recorded by actions during execution, keyed by ActionStatusKey
+	ActionResults map[string]ActionResult
+	// Logs contains the log lines of the run when RunOptions.CaptureLogs is set
+	Logs []LogEntry
+	// Interrupted reports whether the run was stopped by SignalMiddleware or Shutdown rather than by a failure
+	Interrupted bool
+	// Cancelled reports whether the run was stopped because RunOptions.Context was cancelled or timed out,
+	// or because the run outlived the deadline or maximum duration of the workflow
+	Cancelled bool
+	// Trace is the timeline of the run when RunOptions.Trace is set
+	Trace *Trace
+	// Recording is the record of the run when RunOptions.Record is set
+	Recording *RunRecording
+	// ReplayDivergences lists the actions that did not behave as recorded when RunOptions.Replay is set
+	ReplayDivergences []ReplayDivergence
+	// StoreStats describes the use of the user keys of the store, the most
+	// accessed first, when RunOptions.StoreStats is set
+	StoreStats []store.KeyStats
+	// Labels are the labels of the run from RunOptions.Labels
+	Labels map[string]string
+	// InitialDataConflicts lists the store keys that the initial data of the
+	// run's stages found holding other values, and how they were resolved
+	InitialDataConflicts []InitialDataConflict
+	// Artifacts lists the artifacts attached by the actions of the run, in
+	// the order they were attached
+	Artifacts []Artifact
 }
 
 // RunOptions contains options for workflow execution
@@ -419,6 +853,64 @@ type RunOptions struct {
 
 	// InitialStore contains key-value pairs to populate the workflow store before execution
 	InitialStore map[string]interface{}
+
+	// TagFilter skips the stages and actions whose tags it does not select
+	TagFilter TagFilter
+
+	// OnlyStages runs only the stages with these IDs, skipping the others
+	OnlyStages []string
+
+	// OnlyActions runs only the actions with these names, or with these
+	// "stageID:actionName" keys, skipping the others
+	OnlyActions []string
+
+	// CaptureLogs records every log line of the run in RunResult.Logs,
+	// in addition to writing it to the logger
+	CaptureLogs bool
+
+	// Trace records the timeline of the run in RunResult.Trace, in the
+	// Chrome trace event format
+	Trace bool
+
+	// Record records the store reads and writes and the outcome of every
+	// action in RunResult.Recording. The user store must be serializable to JSON
+	Record bool
+
+	// StoreStats counts the reads and writes of each store key and the actions
+	// making them in RunResult.StoreStats
+	StoreStats bool
+
+	// Replay replays a recorded run: the store starts as recorded, replayable
+	// actions get their recorded outcome instead of executing, and the other
+	// actions are compared with their record
+	Replay *RunRecording
+
+	// Priority orders workflows submitted to the worker pool; higher runs first
+	Priority int
+
+	// Preemptible lets a submitted workflow give its worker to higher-priority
+	// workflows between stages, resuming once a worker is free again
+	Preemptible bool
+
+	// CancelGracePeriod bounds how long the stages tagged with TagAlwaysRun may
+	// take to clean up once Context is cancelled. Zero leaves them unbounded
+	CancelGracePeriod time.Duration
+
+	// Labels attribute the run, such as to the caller or team it runs for.
+	// They are carried by the result, events and history of the run
+	Labels map[string]string
+
+	// MaxDuration stops the run once it has lasted this long, like
+	// Workflow.SetMaxDuration. The smallest of the two applies
+	MaxDuration time.Duration
+
+	// LogLevel drops the log messages below this level, one of the LogLevel
+	// constants. Empty keeps every message
+	LogLevel string
+
+	// DryRun reports the stages and actions the run selects, in its logs and
+	// as skipped, without executing them
+	DryRun bool
 }
 
 // DefaultRunOptions returns the default options for running a workflow
@@ -432,7 +924,7 @@ func DefaultRunOptions() RunOptions {
 
 // ExecuteWithOptions runs a workflow with the given options
 func (r *Runner) ExecuteWithOptions(workflow *Workflow, options RunOptions) RunResult {
-	startTime := time.Now()
+	startTime := r.now()
 
 	// Use options from the runner if not provided
 	logger := options.Logger
@@ -440,6 +932,16 @@ func (r *Runner) ExecuteWithOptions(workflow *Workflow, options RunOptions) RunR
 		logger = r.defaultLogger
 	}
 
+	// Record the run's log lines if requested
+	var capture *captureLogger
+	if options.CaptureLogs {
+		capture = newCaptureLogger(logger)
+		logger = capture
+	}
+
+	// Drop the messages below the requested level
+	logger, levelErr := filterLogLevel(logger, options.LogLevel)
+
 	// Use options context if provided
 	ctx := options.Context
 	if ctx == nil {
@@ -456,24 +958,93 @@ func (r *Runner) ExecuteWithOptions(workflow *Workflow, options RunOptions) RunR
 		}
 	}
 
-	// Execute the workflow
-	err := r.Execute(ctx, workflow, logger)
+	runID := startRun(workflow)
+	startRunLabels(workflow, options.Labels)
+	startConflictLog(workflow)
+	startArtifactLog(workflow)
+	stopStats := startStoreStats(workflow, options)
+	var trace *traceBuilder
+	if options.Trace {
+		trace = newTraceBuilder(startTime)
+		workflow.Context[contextRunTrace] = trace
+	}
+
+	// Execute the workflow, with the stages and actions selected by the options
+	err := levelErr
+	var selection *runSelection
+	if err == nil {
+		selection, err = newRunSelection(workflow, options)
+	}
+	if err == nil {
+		err = startRecording(workflow, options)
+	}
+	if err == nil {
+		if selection != nil {
+			workflow.Context[runSelectionContextKey] = selection
+		}
+		if options.CancelGracePeriod > 0 {
+			workflow.Context[contextCancelGrace] = options.CancelGracePeriod
+		}
+		if options.MaxDuration > 0 {
+			workflow.Context[contextRunMaxDuration] = options.MaxDuration
+		}
+		if options.DryRun {
+			workflow.Context[contextDryRun] = true
+		}
+		err = r.Execute(ctx, workflow, logger)
+		delete(workflow.Context, runSelectionContextKey)
+		delete(workflow.Context, contextCancelGrace)
+		delete(workflow.Context, contextRunMaxDuration)
+		delete(workflow.Context, contextDryRun)
+	}
+	recording, divergences := finishRecording(workflow, err)
+	conflicts := finishConflictLog(workflow)
+	artifacts := finishArtifactLog(workflow)
+	storeStats := stopStats()
+	delete(workflow.Context, contextRunTrace)
 
 	// Capture the final store state
 	finalStore := make(map[string]interface{})
 	if workflow.Store != nil {
-		// Export all store data
-		finalStore = workflow.Store.ExportAll()
+		// Export all store data, masking secrets if a redactor is configured
+		if r.redactor != nil {
+			finalStore = r.redactor.RedactStore(workflow.Store)
+			conflicts = r.redactor.redactConflicts(conflicts, workflow.Store)
+			err = r.redactor.redactError(err, r.redactor.Secrets(workflow.Store))
+		} else {
+			finalStore = workflow.Store.ExportAll()
+		}
 	}
 
 	// Create result
 	result := RunResult{
-		WorkflowID:    workflow.ID,
-		Success:       err == nil,
-		Error:         err,
-		ExecutionTime: time.Since(startTime),
-		FinalStore:    finalStore,
+		RunID:                runID,
+		WorkflowID:           workflow.ID,
+		Success:              err == nil,
+		Error:                err,
+		ExecutionTime:        r.now().Sub(startTime),
+		FinalStore:           finalStore,
+		StageStatuses:        workflow.StageStatuses(),
+		ActionStatuses:       workflow.ActionStatuses(),
+		ActionResults:        workflow.ActionResults(),
+		Interrupted:          errors.Is(err, ErrInterrupted) || errors.Is(err, ErrRunnerShutdown),
+		Cancelled:            err != nil && (ctx.Err() != nil || errors.Is(err, ErrWorkflowDeadline)),
+		Recording:            recording,
+		ReplayDivergences:    divergences,
+		StoreStats:           storeStats,
+		Labels:               workflow.RunLabels(),
+		InitialDataConflicts: conflicts,
+		Artifacts:            artifacts,
+	}
+	if capture != nil {
+		result.Logs = capture.buffer.snapshot()
+	}
+	if trace != nil {
+		result.Trace = trace.finish(workflow, startTime.Add(result.ExecutionTime))
 	}
+	delete(workflow.Context, contextRunID)
+	delete(workflow.Context, contextRunLabels)
+	r.saveHistory(result, startTime, logger)
 
 	return result
 }
@@ -864,79 +1435,12 @@ func (r *Runner) Spawn(ctx context.Context, def SubWorkflowDef) error {
 
 // executeSpawn contains the core spawn logic, separated for middleware integration
 func (r *Runner) executeSpawn(ctx context.Context, def SubWorkflowDef) error {
-	// 1. Serialize the workflow definition
-	defBytes, err := json.Marshal(def)
-	if err != nil {
-		return fmt.Errorf("failed to serialize sub-workflow definition: %w", err)
-	}
-
-	// 2. Get the path to the current executable
-	exePath, err := os.Executable()
-	if err != nil {
-		return fmt.Errorf("failed to find executable path: %w", err)
-	}
-
-	// 3. Create the command to run the child process
-	cmd := exec.CommandContext(ctx, exePath, "--gostage-child")
-
-	// 4. Set up the IPC pipes
-	childStdin, err := cmd.StdinPipe()
-	if err != nil {
-		return fmt.Errorf("failed to create stdin pipe for child: %w", err)
-	}
-	defer childStdin.Close()
-
-	childStdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return fmt.Errorf("failed to create stdout pipe for child: %w", err)
-	}
-	defer childStdout.Close()
-
-	// Redirect child's stderr to the parent's for logging
-	cmd.Stderr = os.Stderr
-
-	// 5. Start the child process
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start child process: %w", err)
-	}
-
 	// Register OnChildMessage callbacks from spawn middleware
 	for _, mw := range r.spawnMiddleware {
 		r.Broker.AddMessageCallback(mw.OnChildMessage)
 	}
 
-	// 6. Start a goroutine to listen for messages from the child
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		// The parent's runner broker listens for messages from the child's stdout
-		if err := r.Broker.Listen(childStdout); err != nil {
-			// Log this error. The runner's logger could be used here.
-			// For simplicity, we print to stderr for now.
-			fmt.Fprintf(os.Stderr, "error listening to child process: %v\n", err)
-		}
-	}()
-
-	// 7. Send the workflow definition to the child's stdin
-	_, err = childStdin.Write(defBytes)
-	if err != nil {
-		return fmt.Errorf("failed to write workflow definition to child: %w", err)
-	}
-	// Close stdin to signal the child that the definition is complete.
-	childStdin.Close()
-
-	// 8. Wait for the child process to finish
-	err = cmd.Wait()
-
-	// Wait for the listening goroutine to finish processing all messages
-	wg.Wait()
-
-	if err != nil {
-		return fmt.Errorf("child process exited with error: %w", err)
-	}
-
-	return nil
+	return spawnChild(ctx, def, r.Broker, r.spawnLimits, r.signer)
 }
 
 // UseSpawnMiddleware adds spawn middleware to the runner
@@ -0,0 +1,433 @@
+// Package scheduler runs gostage workflows on cron expressions or fixed intervals.
+//
+// Workflows are registered as factories because a workflow instance holds the
+// state of a single execution; every activation gets a fresh instance, which is
+// submitted to the runner's worker pool:
+//
+//	s := scheduler.New(runner)
+//	s.Cron("nightly-backup", "0 2 * * *", newBackupWorkflow)
+//	s.Interval("sync", 5*time.Minute, newSyncWorkflow,
+//		scheduler.WithOverlap(scheduler.OverlapQueue),
+//		scheduler.WithJitter(30*time.Second),
+//	)
+//	s.Start(ctx)
+//	defer s.Stop()
+//
+// The overlap policy decides what happens when an activation fires while the
+// previous run of the same entry is still going: it is skipped (the default),
+// queued to run once the previous run finishes, or the previous run is cancelled.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+)
+
+// WorkflowFactory creates a fresh workflow instance for a run.
+type WorkflowFactory func() (*gostage.Workflow, error)
+
+// ResultHandler receives the result of every scheduled run.
+type ResultHandler func(id string, result gostage.RunResult)
+
+// OverlapPolicy decides what happens when an entry fires while its previous
+// run is still in progress.
+type OverlapPolicy int
+
+const (
+	// OverlapSkip drops the activation
+	OverlapSkip OverlapPolicy = iota
+	// OverlapQueue runs the activation once the previous run finishes
+	OverlapQueue
+	// OverlapCancelPrevious cancels the previous run and starts a new one once it has stopped
+	OverlapCancelPrevious
+)
+
+// String returns the name of the policy.
+func (p OverlapPolicy) String() string {
+	switch p {
+	case OverlapSkip:
+		return "skip"
+	case OverlapQueue:
+		return "queue"
+	case OverlapCancelPrevious:
+		return "cancel-previous"
+	default:
+		return fmt.Sprintf("OverlapPolicy(%d)", int(p))
+	}
+}
+
+// Entry describes a scheduled workflow.
+type Entry struct {
+	// ID identifies the entry
+	ID string
+	// Schedule is the cron expression or interval of the entry
+	Schedule string
+	// Overlap is the entry's overlap policy
+	Overlap OverlapPolicy
+	// Next is the next activation time, zero if the scheduler is not started
+	Next time.Time
+	// Running reports whether a run is in progress
+	Running bool
+	// Pending is the number of queued activations waiting for the current run
+	Pending int
+	// Runs is the number of runs started so far
+	Runs int
+}
+
+// entry is the state of a scheduled workflow.
+type entry struct {
+	id       string
+	schedule Schedule
+	factory  WorkflowFactory
+	overlap  OverlapPolicy
+	jitter   time.Duration
+	options  gostage.RunOptions
+
+	stop    chan struct{}
+	stopped bool
+	next    time.Time
+	running bool
+	pending int
+	runs    int
+	cancel  context.CancelFunc
+}
+
+// Scheduler activates registered workflows on their schedules.
+type Scheduler struct {
+	runner   *gostage.Runner
+	logger   gostage.Logger
+	location *time.Location
+	clock    gostage.Clock
+	onResult ResultHandler
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	ctx     context.Context
+	started bool
+	wg      sync.WaitGroup
+}
+
+// Option configures a Scheduler.
+type Option func(*Scheduler)
+
+// WithLogger sets the logger used to report scheduling decisions and failures.
+func WithLogger(logger gostage.Logger) Option {
+	return func(s *Scheduler) {
+		s.logger = logger
+	}
+}
+
+// WithLocation sets the time zone cron expressions are evaluated in.
+// The default is the local time zone.
+func WithLocation(location *time.Location) Option {
+	return func(s *Scheduler) {
+		s.location = location
+	}
+}
+
+// WithClock sets the clock activations are timed with. The default is the
+// clock of the runner.
+func WithClock(clock gostage.Clock) Option {
+	return func(s *Scheduler) {
+		s.clock = clock
+	}
+}
+
+// WithResultHandler registers a function called with the result of every run.
+func WithResultHandler(handler ResultHandler) Option {
+	return func(s *Scheduler) {
+		s.onResult = handler
+	}
+}
+
+// EntryOption configures a scheduled workflow.
+type EntryOption func(*entry)
+
+// WithOverlap sets the overlap policy of the entry. The default is OverlapSkip.
+func WithOverlap(policy OverlapPolicy) EntryOption {
+	return func(e *entry) {
+		e.overlap = policy
+	}
+}
+
+// WithJitter delays every activation by a random duration up to jitter, to
+// spread the load of entries sharing a schedule.
+func WithJitter(jitter time.Duration) EntryOption {
+	return func(e *entry) {
+		e.jitter = jitter
+	}
+}
+
+// WithRunOptions sets the options used to run the entry's workflows.
+// The context is replaced by one derived from the scheduler's context.
+func WithRunOptions(options gostage.RunOptions) EntryOption {
+	return func(e *entry) {
+		e.options = options
+	}
+}
+
+// New creates a scheduler that submits workflows to runner.
+// A nil runner uses a new default runner.
+func New(runner *gostage.Runner, opts ...Option) *Scheduler {
+	if runner == nil {
+		runner = gostage.NewRunner()
+	}
+
+	s := &Scheduler{
+		runner:   runner,
+		logger:   gostage.NewDefaultLogger(),
+		location: time.Local,
+		clock:    runner.Clock(),
+		entries:  make(map[string]*entry),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Cron schedules a workflow with a cron expression, as accepted by ParseCron.
+func (s *Scheduler) Cron(id, expr string, factory WorkflowFactory, opts ...EntryOption) error {
+	schedule, err := ParseCronInLocation(expr, s.location)
+	if err != nil {
+		return fmt.Errorf("failed to schedule '%s': %w", id, err)
+	}
+	return s.Add(id, schedule, factory, opts...)
+}
+
+// Interval schedules a workflow to run every interval.
+func (s *Scheduler) Interval(id string, interval time.Duration, factory WorkflowFactory, opts ...EntryOption) error {
+	if interval <= 0 {
+		return fmt.Errorf("failed to schedule '%s': interval must be positive", id)
+	}
+	return s.Add(id, Every(interval), factory, opts...)
+}
+
+// Add schedules a workflow with a custom schedule. Entries added to a started
+// scheduler are activated right away.
+func (s *Scheduler) Add(id string, schedule Schedule, factory WorkflowFactory, opts ...EntryOption) error {
+	if factory == nil {
+		return fmt.Errorf("failed to schedule '%s': factory is nil", id)
+	}
+
+	e := &entry{
+		id:       id,
+		schedule: schedule,
+		factory:  factory,
+		stop:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.entries[id]; exists {
+		return fmt.Errorf("failed to schedule '%s': entry already exists", id)
+	}
+	s.entries[id] = e
+
+	if s.started {
+		s.wg.Add(1)
+		go s.loop(e)
+	}
+	return nil
+}
+
+// Remove unschedules an entry. A run in progress is left to finish.
+// It reports whether the entry existed.
+func (s *Scheduler) Remove(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[id]
+	if !ok {
+		return false
+	}
+	delete(s.entries, id)
+	s.stopEntry(e)
+	return true
+}
+
+// Entries returns the scheduled workflows sorted by ID.
+func (s *Scheduler) Entries() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, Entry{
+			ID:       e.id,
+			Schedule: fmt.Sprint(e.schedule),
+			Overlap:  e.overlap,
+			Next:     e.next,
+			Running:  e.running,
+			Pending:  e.pending,
+			Runs:     e.runs,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries
+}
+
+// Start activates the scheduled workflows. Runs use contexts derived from ctx,
+// so cancelling it cancels the runs in progress and stops the scheduler.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return
+	}
+	s.started = true
+	s.ctx = ctx
+
+	for _, e := range s.entries {
+		s.wg.Add(1)
+		go s.loop(e)
+	}
+}
+
+// Stop stops activating workflows, drops queued activations and waits for the
+// runs in progress to finish.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	for _, e := range s.entries {
+		s.stopEntry(e)
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// stopEntry ends the activation loop of an entry. It must be called with mu held.
+func (s *Scheduler) stopEntry(e *entry) {
+	if !e.stopped {
+		e.stopped = true
+		e.pending = 0
+		close(e.stop)
+	}
+}
+
+// loop waits for each activation time of an entry and triggers it.
+func (s *Scheduler) loop(e *entry) {
+	defer s.wg.Done()
+
+	base := s.clock.Now()
+	for {
+		base = e.schedule.Next(base)
+		if base.IsZero() {
+			s.logger.Warn("Schedule of '%s' has no further activations", e.id)
+			return
+		}
+
+		next := base
+		if e.jitter > 0 {
+			next = next.Add(rand.N(e.jitter))
+		}
+
+		s.mu.Lock()
+		e.next = next
+		s.mu.Unlock()
+
+		timer := s.clock.NewTimer(next.Sub(s.clock.Now()))
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-e.stop:
+			timer.Stop()
+			return
+		case <-timer.C():
+		}
+
+		s.trigger(e)
+	}
+}
+
+// trigger starts a run of the entry, applying its overlap policy.
+func (s *Scheduler) trigger(e *entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e.stopped {
+		return
+	}
+
+	if e.running {
+		switch e.overlap {
+		case OverlapQueue:
+			e.pending++
+			s.logger.Debug("Queued activation of '%s' behind the run in progress", e.id)
+		case OverlapCancelPrevious:
+			e.pending = 1
+			e.cancel()
+			s.logger.Info("Cancelling the run in progress of '%s' for a new activation", e.id)
+		default:
+			s.logger.Info("Skipping activation of '%s': previous run still in progress", e.id)
+		}
+		return
+	}
+
+	s.start(e)
+}
+
+// start launches a run of the entry. It must be called with mu held.
+func (s *Scheduler) start(e *entry) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	e.running = true
+	e.runs++
+	e.cancel = cancel
+
+	s.wg.Add(1)
+	go s.run(ctx, cancel, e)
+}
+
+// run executes one activation and starts the next queued one, if any.
+func (s *Scheduler) run(ctx context.Context, cancel context.CancelFunc, e *entry) {
+	defer s.wg.Done()
+	defer cancel()
+
+	s.execute(ctx, e)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e.running = false
+	if e.pending > 0 && !e.stopped && s.ctx.Err() == nil {
+		e.pending--
+		s.start(e)
+	}
+}
+
+// execute builds a fresh workflow and runs it on the runner's worker pool.
+func (s *Scheduler) execute(ctx context.Context, e *entry) {
+	wf, err := e.factory()
+	if err != nil {
+		s.logger.Error("Failed to create workflow for '%s': %v", e.id, err)
+		return
+	}
+
+	options := e.options
+	options.Context = ctx
+	job, err := s.runner.SubmitWithOptions(wf, options)
+	if err != nil {
+		s.logger.Error("Failed to run '%s': %v", e.id, err)
+		return
+	}
+
+	result := job.Wait()
+	if !result.Success {
+		s.logger.Warn("Scheduled run of '%s' failed: %v", e.id, result.Error)
+	}
+	if s.onResult != nil {
+		s.onResult(e.id, result)
+	}
+}
@@ -0,0 +1,221 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/davidroman0O/gostage/gostagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type funcAction struct {
+	gostage.BaseAction
+	fn func(ctx *gostage.ActionContext) error
+}
+
+func (a *funcAction) Execute(ctx *gostage.ActionContext) error {
+	return a.fn(ctx)
+}
+
+func factory(fn func(ctx *gostage.ActionContext) error) WorkflowFactory {
+	return func() (*gostage.Workflow, error) {
+		wf := gostage.NewWorkflow("scheduled", "Scheduled", "")
+		stage := gostage.NewStage("stage", "Stage", "")
+		stage.AddAction(&funcAction{BaseAction: gostage.NewBaseAction("action", ""), fn: fn})
+		wf.AddStage(stage)
+		return wf, nil
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	from := time.Date(2024, time.March, 15, 10, 7, 30, 0, time.UTC) // a Friday
+
+	tests := []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2024, time.March, 15, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, time.March, 15, 10, 15, 0, 0, time.UTC)},
+		{"0 9-17 * * mon-fri", time.Date(2024, time.March, 15, 11, 0, 0, 0, time.UTC)},
+		{"30 8 * * sat,sun", time.Date(2024, time.March, 16, 8, 30, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 1 * 1", time.Date(2024, time.March, 18, 12, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, time.March, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 */2 * 1", time.Date(2024, time.March, 25, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * */3", time.Date(2024, time.April, 13, 0, 0, 0, 0, time.UTC)},
+		{"5/20 10 * * *", time.Date(2024, time.March, 15, 10, 25, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, time.March, 16, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", from.Add(90 * time.Second)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			schedule, err := ParseCronInLocation(tt.expr, time.UTC)
+			require.NoError(t, err)
+			assert.Equal(t, tt.next, schedule.Next(from))
+		})
+	}
+
+	none, err := ParseCronInLocation("0 0 30 feb *", time.UTC)
+	require.NoError(t, err)
+	assert.True(t, none.Next(from).IsZero())
+
+	for _, expr := range []string{"* * * *", "60 * * * *", "* * * foo *", "*/0 * * * *", "5-1 * * * *", "@every nope"} {
+		_, err := ParseCron(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestSchedulerInterval(t *testing.T) {
+	var mu sync.Mutex
+	var results []gostage.RunResult
+	s := New(nil, WithResultHandler(func(id string, result gostage.RunResult) {
+		assert.Equal(t, "tick", id)
+		mu.Lock()
+		results = append(results, result)
+		mu.Unlock()
+	}))
+
+	var runs int32
+	require.NoError(t, s.Interval("tick", 10*time.Millisecond, factory(func(ctx *gostage.ActionContext) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}), WithJitter(time.Millisecond)))
+	assert.Error(t, s.Interval("tick", time.Second, factory(nil)))
+	assert.Error(t, s.Interval("zero", 0, factory(nil)))
+	assert.Error(t, s.Cron("bad", "not a cron", factory(nil)))
+
+	s.Start(context.Background())
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&runs) >= 3 }, time.Second, time.Millisecond)
+	s.Stop()
+
+	entries := s.Entries()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "@every 10ms", entries[0].Schedule)
+	assert.Equal(t, OverlapSkip, entries[0].Overlap)
+	assert.False(t, entries[0].Running)
+	assert.Equal(t, int(atomic.LoadInt32(&runs)), entries[0].Runs)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.NotEmpty(t, results)
+	assert.True(t, results[0].Success)
+	assert.True(t, s.Remove("tick"))
+	assert.False(t, s.Remove("tick"))
+}
+
+func TestSchedulerOverlapSkip(t *testing.T) {
+	s := New(nil)
+	release := make(chan struct{})
+	var runs int32
+	require.NoError(t, s.Interval("slow", 5*time.Millisecond, factory(func(ctx *gostage.ActionContext) error {
+		if atomic.AddInt32(&runs, 1) == 1 {
+			<-release
+		}
+		return nil
+	})))
+
+	s.Start(context.Background())
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&runs) == 1 }, time.Second, time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+
+	entry := s.Entries()[0]
+	assert.True(t, entry.Running)
+	assert.Equal(t, 0, entry.Pending)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+
+	close(release)
+	s.Stop()
+}
+
+func TestSchedulerOverlapQueue(t *testing.T) {
+	s := New(nil)
+	release := make(chan struct{})
+	var runs, concurrent, peak int32
+	require.NoError(t, s.Interval("queued", 5*time.Millisecond, factory(func(ctx *gostage.ActionContext) error {
+		n := atomic.AddInt32(&concurrent, 1)
+		defer atomic.AddInt32(&concurrent, -1)
+		if n > atomic.LoadInt32(&peak) {
+			atomic.StoreInt32(&peak, n)
+		}
+		if atomic.AddInt32(&runs, 1) == 1 {
+			<-release
+		}
+		return nil
+	}), WithOverlap(OverlapQueue)))
+
+	s.Start(context.Background())
+	require.Eventually(t, func() bool { return s.Entries()[0].Pending >= 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+
+	close(release)
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&runs) >= 3 }, time.Second, time.Millisecond)
+	s.Stop()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&peak))
+}
+
+func TestSchedulerOverlapCancelPrevious(t *testing.T) {
+	var mu sync.Mutex
+	var results []gostage.RunResult
+	s := New(nil, WithResultHandler(func(id string, result gostage.RunResult) {
+		mu.Lock()
+		results = append(results, result)
+		mu.Unlock()
+	}))
+
+	var runs int32
+	require.NoError(t, s.Interval("latest", 20*time.Millisecond, factory(func(ctx *gostage.ActionContext) error {
+		if atomic.AddInt32(&runs, 1) == 1 {
+			<-ctx.GoContext.Done()
+			return ctx.GoContext.Err()
+		}
+		return nil
+	}), WithOverlap(OverlapCancelPrevious)))
+
+	s.Start(context.Background())
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&runs) >= 2 }, time.Second, time.Millisecond)
+	s.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.GreaterOrEqual(t, len(results), 2)
+	assert.False(t, results[0].Success)
+	assert.True(t, errors.Is(results[0].Error, context.Canceled))
+	assert.True(t, results[1].Success)
+}
+
+func TestOverlapPolicyString(t *testing.T) {
+	assert.Equal(t, "skip", OverlapSkip.String())
+	assert.Equal(t, "queue", OverlapQueue.String())
+	assert.Equal(t, "cancel-previous", OverlapCancelPrevious.String())
+}
+
+func TestSchedulerFollowsTheRunnerClock(t *testing.T) {
+	start := time.Date(2026, time.March, 2, 8, 30, 0, 0, time.UTC)
+	clock := gostagetest.NewFakeClock(start)
+	results := make(chan time.Time, 2)
+	s := New(gostage.NewRunner(gostage.WithClock(clock)), WithLocation(time.UTC))
+	require.NoError(t, s.Cron("nightly", "0 2 * * *", factory(func(ctx *gostage.ActionContext) error {
+		results <- ctx.Now()
+		return nil
+	})))
+
+	s.Start(context.Background())
+	defer s.Stop()
+	clock.BlockUntilTimers(1)
+	assert.Equal(t, time.Date(2026, time.March, 3, 2, 0, 0, 0, time.UTC), s.Entries()[0].Next)
+
+	clock.Advance(17*time.Hour + 29*time.Minute)
+	select {
+	case <-results:
+		t.Fatal("nightly run started early")
+	default:
+	}
+	clock.Advance(time.Minute)
+	assert.Equal(t, time.Date(2026, time.March, 3, 2, 0, 0, 0, time.UTC), <-results)
+}
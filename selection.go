@@ -0,0 +1,117 @@
+package gostage
+
+import (
+	"fmt"
+	"sort"
+)
+
+// runSelectionContextKey holds the selection of the current run in the workflow context.
+const runSelectionContextKey = "runSelection"
+
+// runSelection holds the stages and actions selected by the options of a run.
+type runSelection struct {
+	tags    *tagMatcher
+	stages  map[string]bool
+	actions map[string]bool
+}
+
+// newRunSelection builds the selection of a run, or returns nil if the run
+// executes every stage and action. Stage IDs and action names that are not
+// part of the workflow fail the run, as they are most likely typos.
+func newRunSelection(w *Workflow, options RunOptions) (*runSelection, error) {
+	tags, err := options.TagFilter.compile()
+	if err != nil {
+		return nil, err
+	}
+	if tags == nil && len(options.OnlyStages) == 0 && len(options.OnlyActions) == 0 {
+		return nil, nil
+	}
+
+	stages := make(map[string]bool)
+	actions := make(map[string]bool)
+	var collect func(stages []*Stage)
+	collect = func(list []*Stage) {
+		for _, stage := range list {
+			stages[stage.ID] = true
+			for _, action := range stage.Actions {
+				actions[action.Name()] = true
+				actions[ActionStatusKey(stage.ID, action.Name())] = true
+			}
+			for _, branch := range stage.Branches() {
+				collect(branch.Stages)
+			}
+		}
+	}
+	collect(w.Stages)
+
+	selection := &runSelection{tags: tags}
+	if len(options.OnlyStages) > 0 {
+		selection.stages, err = selectedSet("stage", options.OnlyStages, stages)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(options.OnlyActions) > 0 {
+		selection.actions, err = selectedSet("action", options.OnlyActions, actions)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return selection, nil
+}
+
+// selectedSet returns the selected names as a set, failing if some are unknown.
+func selectedSet(kind string, selected []string, known map[string]bool) (map[string]bool, error) {
+	set := make(map[string]bool, len(selected))
+	var unknown []string
+	for _, name := range selected {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+		set[name] = true
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown %s %v selected to run", kind, unknown)
+	}
+	return set, nil
+}
+
+// runSelectionOf returns the selection of the current run, or nil.
+func runSelectionOf(w *Workflow) *runSelection {
+	selection, _ := w.Context[runSelectionContextKey].(*runSelection)
+	return selection
+}
+
+// selectsAction reports whether an action of the stage runs.
+func (s *runSelection) selectsAction(stage *Stage, action Action) bool {
+	if s.actions != nil && !s.actions[action.Name()] && !s.actions[ActionStatusKey(stage.ID, action.Name())] {
+		return false
+	}
+	return s.tags == nil || s.tags.match(append(append([]string{}, stage.Tags...), action.Tags()...))
+}
+
+// selectsStage reports whether the stage runs. An if or switch stage runs
+// when one of the stages of its branches is selected.
+func (s *runSelection) selectsStage(stage *Stage) bool {
+	for _, branch := range stage.Branches() {
+		for _, nested := range branch.Stages {
+			if s.selectsStage(nested) {
+				return true
+			}
+		}
+	}
+
+	if s.stages != nil && !s.stages[stage.ID] {
+		return false
+	}
+	if s.actions == nil && (s.tags == nil || s.tags.match(stage.Tags)) {
+		return true
+	}
+	for _, action := range stage.Actions {
+		if s.selectsAction(stage, action) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package gostage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunOnlyStagesAndActions(t *testing.T) {
+	newWorkflow := func(ran *[]string) *Workflow {
+		wf := NewWorkflow("debug", "Debug", "")
+
+		fetch := NewStage("fetch", "Fetch", "")
+		fetch.AddAction(recordAction("download", ran))
+		wf.AddStage(fetch)
+
+		process := NewStage("process", "Process", "")
+		process.AddAction(recordAction("parse", ran))
+		process.AddAction(recordAction("validate", ran))
+		wf.AddStage(process)
+
+		publish := NewStage("publish", "Publish", "")
+		publish.AddAction(recordAction("validate", ran))
+		publish.AddAction(recordAction("upload", ran))
+		wf.AddStage(publish)
+
+		wf.AddStage(IfStage("notify", "Notify", func(ctx *ActionContext) (bool, error) { return true, nil },
+			[]*Stage{recordingStage("email", ran), recordingStage("chat", ran)}, nil))
+		return wf
+	}
+
+	for name, tc := range map[string]struct {
+		options RunOptions
+		ran     []string
+		skipped []string
+	}{
+		"stage":           {RunOptions{OnlyStages: []string{"process"}}, []string{"parse", "validate"}, []string{"fetch", "publish", "notify"}},
+		"action":          {RunOptions{OnlyActions: []string{"validate"}}, []string{"validate", "validate"}, []string{"fetch", "notify"}},
+		"action key":      {RunOptions{OnlyActions: []string{"publish:validate"}}, []string{"validate"}, []string{"fetch", "process", "notify"}},
+		"stage, action":   {RunOptions{OnlyStages: []string{"process", "publish"}, OnlyActions: []string{"upload", "parse"}}, []string{"parse", "upload"}, []string{"fetch", "notify"}},
+		"branch stage":    {RunOptions{OnlyStages: []string{"chat"}}, []string{"chat"}, []string{"fetch", "process", "publish", "email"}},
+		"with tag filter": {RunOptions{OnlyStages: []string{"fetch", "process"}, TagFilter: TagFilter{Exclude: []string{"none"}}}, []string{"download", "parse", "validate"}, []string{"publish", "notify"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var ran []string
+			wf := newWorkflow(&ran)
+			result := NewRunner().ExecuteWithOptions(wf, tc.options)
+			require.True(t, result.Success, "%v", result.Error)
+			assert.Equal(t, tc.ran, ran)
+			for _, stageID := range tc.skipped {
+				assert.Equal(t, StatusSkipped, result.StageStatuses[stageID], stageID)
+			}
+			assert.NotContains(t, wf.Context, runSelectionContextKey)
+		})
+	}
+
+	var ran []string
+	result := NewRunner().ExecuteWithOptions(newWorkflow(&ran), RunOptions{OnlyStages: []string{"proces", "fetch", "pubish"}})
+	assert.EqualError(t, result.Error, "unknown stage [proces pubish] selected to run")
+	assert.Empty(t, ran)
+
+	result = NewRunner().ExecuteWithOptions(newWorkflow(&ran), RunOptions{OnlyActions: []string{"fetch:parse"}})
+	assert.EqualError(t, result.Error, "unknown action [fetch:parse] selected to run")
+	assert.Empty(t, ran)
+}
@@ -0,0 +1,146 @@
+package gostage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// systemPrefixes are store key prefixes managed by the workflow itself.
+// They are rebuilt when a workflow is reconstructed and are not serialized.
+var systemPrefixes = []string{PrefixWorkflow, PrefixStage, PrefixAction, PrefixParam, PrefixTemp, PrefixCircuit}
+
+// ToDef converts the workflow to its serializable definition.
+// Every action must have been created through an ActionRegistry so it can be
+// referenced by its registered ID. Middleware and Go-only state such as the
+// workflow Context are not part of the definition.
+func (w *Workflow) ToDef() (*SubWorkflowDef, error) {
+	def := &SubWorkflowDef{
+		ID:           w.ID,
+		Name:         w.Name,
+		Description:  w.Description,
+		Version:      w.Version,
+		Tags:         append([]string{}, w.Tags...),
+		Annotations:  w.Annotations(),
+		Stages:       make([]StageDef, 0, len(w.Stages)),
+		InitialStore: userData(w.Store.ExportAll()),
+		MaxDuration:  w.maxDuration,
+		Strategy:     w.strategy,
+	}
+	if !w.deadline.IsZero() {
+		deadline := w.deadline
+		def.Deadline = &deadline
+	}
+
+	for _, param := range w.params {
+		paramDef := ParamDef{
+			Name:        param.Name,
+			Description: param.Description,
+			Required:    param.Required,
+			Type:        param.Type,
+		}
+		if param.HasDefault {
+			paramDef.Default = param.Default
+		}
+		def.Params = append(def.Params, paramDef)
+	}
+
+	for _, stage := range w.Stages {
+		stageDef, err := w.stageToDef(stage)
+		if err != nil {
+			return nil, err
+		}
+		def.Stages = append(def.Stages, stageDef)
+	}
+
+	return def, nil
+}
+
+// stageToDef converts a stage of the workflow to its serializable definition.
+func (w *Workflow) stageToDef(stage *Stage) (StageDef, error) {
+	stageDef := StageDef{
+		ID:          stage.ID,
+		Name:        stage.Name,
+		Description: stage.Description,
+		Tags:        append([]string{}, stage.Tags...),
+		Annotations: stage.Annotations(),
+		Actions:     make([]ActionDef, 0, len(stage.Actions)),
+		MergePolicy: stage.mergePolicy,
+		Disabled:    !w.IsStageEnabled(stage.ID),
+		Consumes:    stage.ConsumedSchemas(),
+		Produces:    stage.ProducedSchemas(),
+	}
+	if stage.initialStore != nil {
+		stageDef.InitialStore = userData(stage.initialStore.ExportAll())
+	}
+
+	for _, action := range stage.Actions {
+		base := GetActionBaseFields(action)
+		if base == nil || base.registryID == "" {
+			return StageDef{}, fmt.Errorf("action '%s' in stage '%s' was not created from an action registry", action.Name(), stage.ID)
+		}
+
+		stageDef.Actions = append(stageDef.Actions, ActionDef{
+			ID:          base.registryID,
+			Name:        action.Name(),
+			Description: action.Description(),
+			Tags:        append([]string{}, action.Tags()...),
+			Annotations: base.Annotations(),
+			Params:      copyParams(base.params),
+			Disabled:    !w.IsActionEnabled(action.Name()),
+		})
+	}
+
+	return stageDef, nil
+}
+
+// Marshal serializes the full workflow structure to JSON so it can be persisted
+// or transmitted to a remote runner. Store values must be JSON-serializable.
+func (w *Workflow) Marshal() ([]byte, error) {
+	def, err := w.ToDef()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(def)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize workflow '%s': %w", w.ID, err)
+	}
+	return data, nil
+}
+
+// UnmarshalWorkflow reconstructs a workflow serialized with Workflow.Marshal,
+// resolving its actions through the given registry.
+// If registry is nil, the default registry is used. Store values come back with
+// their JSON types (for example, numbers are decoded as float64).
+func UnmarshalWorkflow(data []byte, registry *ActionRegistry) (*Workflow, error) {
+	var def SubWorkflowDef
+	if err := json.Unmarshal(data, &def); err != nil {
+		return nil, fmt.Errorf("failed to deserialize workflow: %w", err)
+	}
+	return NewWorkflowFromDefWithRegistry(&def, registry)
+}
+
+// userData filters out system-managed keys, returning nil when nothing is left.
+func userData(data map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{})
+	for key, value := range data {
+		if hasSystemPrefix(key) {
+			continue
+		}
+		out[key] = value
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+func hasSystemPrefix(key string) bool {
+	for _, prefix := range systemPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
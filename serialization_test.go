@@ -0,0 +1,87 @@
+package gostage
+
+import (
+	"testing"
+
+	"github.com/davidroman0O/gostage/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSerializationRegistry(t *testing.T) *ActionRegistry {
+	registry := NewActionRegistry()
+	require.NoError(t, RegisterTyped(registry, "http-get", func(p httpGetParams) (Action, error) {
+		return &httpGetAction{BaseAction: NewBaseActionWithTags("http-get", "GET a URL", []string{"network"}), params: p}, nil
+	}))
+	require.NoError(t, registry.Register("noop", func() Action {
+		return NewTestAction("noop", "does nothing", nil)
+	}))
+	return registry
+}
+
+func TestWorkflowMarshalRoundTrip(t *testing.T) {
+	registry := newSerializationRegistry(t)
+
+	wf := NewWorkflowWithTags("wf", "Workflow", "round trip", []string{"prod"})
+	wf.Version = "1.2.0"
+	wf.Store.Put("region", "us-east-1")
+
+	fetch := NewStageWithTags("fetch", "Fetch", "fetch things", []string{"io"})
+	fetch.SetInitialData("timeout", 30)
+	get, err := registry.Resolve("http-get", map[string]interface{}{"url": "https://example.com"})
+	require.NoError(t, err)
+	fetch.AddAction(get)
+	wf.AddStage(fetch)
+
+	cleanup := NewStage("cleanup", "Cleanup", "")
+	noop, err := registry.Resolve("noop", nil)
+	require.NoError(t, err)
+	GetActionBaseFields(noop).AddTag("optional")
+	cleanup.AddAction(noop)
+	wf.AddStage(cleanup)
+
+	wf.DisableStage("cleanup")
+	wf.DisableAction("noop")
+
+	data, err := wf.Marshal()
+	require.NoError(t, err)
+
+	restored, err := UnmarshalWorkflow(data, registry)
+	require.NoError(t, err)
+
+	assert.Equal(t, wf.ID, restored.ID)
+	assert.Equal(t, "1.2.0", restored.Version)
+	assert.Equal(t, []string{"prod"}, restored.Tags)
+	require.Len(t, restored.Stages, 2)
+	assert.Equal(t, []string{"io"}, restored.Stages[0].Tags)
+	assert.Equal(t, []string{"network"}, restored.Stages[0].Actions[0].Tags())
+	assert.Equal(t, "https://example.com", restored.Stages[0].Actions[0].(*httpGetAction).params.URL)
+	assert.Equal(t, []string{"optional"}, restored.Stages[1].Actions[0].Tags())
+
+	assert.False(t, restored.IsStageEnabled("cleanup"))
+	assert.False(t, restored.IsActionEnabled("noop"))
+
+	region, err := store.Get[string](restored.Store, "region")
+	require.NoError(t, err)
+	assert.Equal(t, "us-east-1", region)
+
+	// Serializing the restored workflow yields the same definition
+	again, err := restored.Marshal()
+	require.NoError(t, err)
+	assert.JSONEq(t, string(data), string(again))
+
+	result := RunWorkflow(restored, DefaultRunOptions())
+	require.NoError(t, result.Error)
+	assert.Equal(t, float64(30), result.FinalStore["timeout"])
+	assert.Equal(t, "https://example.com", result.FinalStore["fetched"])
+}
+
+func TestWorkflowMarshalRequiresRegistry(t *testing.T) {
+	wf := NewWorkflow("wf", "Workflow", "")
+	stage := NewStage("s", "S", "")
+	stage.AddAction(NewTestAction("adhoc", "not registered", nil))
+	wf.AddStage(stage)
+
+	_, err := wf.Marshal()
+	assert.ErrorContains(t, err, "not created from an action registry")
+}
@@ -0,0 +1,140 @@
+package gostage
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"sync"
+)
+
+// ErrServiceNotFound is returned by Resolve when no service of the requested
+// type was provided.
+var ErrServiceNotFound = errors.New("service not provided")
+
+// serviceRegistry holds the services provided to actions, by type.
+type serviceRegistry struct {
+	mu     sync.RWMutex
+	byType map[reflect.Type]interface{}
+	// order is the types in the order they were first provided, so that
+	// interfaces resolve deterministically
+	order []reflect.Type
+}
+
+// provide registers service under its type, replacing the service of the
+// same type.
+func (s *serviceRegistry) provide(service interface{}) {
+	if service == nil {
+		panic("gostage: cannot provide a nil service")
+	}
+	t := reflect.TypeOf(service)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.byType == nil {
+		s.byType = make(map[reflect.Type]interface{})
+	}
+	if _, ok := s.byType[t]; !ok {
+		s.order = append(s.order, t)
+	}
+	s.byType[t] = service
+}
+
+// clone returns a copy of the registry, or nil if s is nil.
+func (s *serviceRegistry) clone() *serviceRegistry {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return &serviceRegistry{byType: maps.Clone(s.byType), order: append([]reflect.Type(nil), s.order...)}
+}
+
+// lookup returns the service of type t or, for interfaces, the only provided
+// service implementing t. It returns an error if several services implement t.
+func (s *serviceRegistry) lookup(t reflect.Type) (interface{}, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if service, ok := s.byType[t]; ok {
+		return service, true, nil
+	}
+	if t.Kind() != reflect.Interface {
+		return nil, false, nil
+	}
+
+	var found interface{}
+	var names []reflect.Type
+	for _, provided := range s.order {
+		if provided.Implements(t) {
+			found = s.byType[provided]
+			names = append(names, provided)
+		}
+	}
+	if len(names) > 1 {
+		return nil, false, fmt.Errorf("several services implement %s: %v", t, names)
+	}
+	return found, found != nil, nil
+}
+
+// Provide makes service available to the actions of every workflow the
+// runner executes, which get it with Resolve. Services are registered by
+// their type, so providing another value of the same type replaces the
+// previous one. Use distinct types, such as named types, to provide several
+// values of the same underlying type.
+//
+// Services are not sent to child processes or remote workers, whose runners
+// provide their own.
+func (r *Runner) Provide(service interface{}) {
+	r.services.provide(service)
+}
+
+// WithService provides service to the actions of the runner, see Provide.
+func WithService(service interface{}) RunnerOption {
+	return func(r *Runner) {
+		r.Provide(service)
+	}
+}
+
+// Provide makes service available to the actions of the workflow, taking
+// precedence over the service of the same type provided to the runner, such
+// as a client configured for the workflow. See Runner.Provide.
+func (w *Workflow) Provide(service interface{}) {
+	if w.services == nil {
+		w.services = &serviceRegistry{}
+	}
+	w.services.provide(service)
+}
+
+// Resolve returns the service of type T provided to the workflow of ctx or
+// to its runner, so that actions get shared services such as database pools
+// and HTTP clients without going through the store or global variables:
+//
+//	db, err := gostage.Resolve[*sql.DB](ctx)
+//
+// If T is an interface, the service of exactly that type is returned, or
+// else the only provided service implementing T. Resolve returns an error
+// wrapping ErrServiceNotFound if no service matches.
+func Resolve[T any](ctx *ActionContext) (T, error) {
+	var zero T
+	t := reflect.TypeOf((*T)(nil)).Elem()
+
+	var registries []*serviceRegistry
+	if ctx.Workflow != nil {
+		if ctx.Workflow.services != nil {
+			registries = append(registries, ctx.Workflow.services)
+		}
+		if r, ok := ctx.Workflow.Context["runner"].(*Runner); ok {
+			registries = append(registries, &r.services)
+		}
+	}
+	for _, registry := range registries {
+		service, ok, err := registry.lookup(t)
+		if err != nil {
+			return zero, err
+		}
+		if ok {
+			return service.(T), nil
+		}
+	}
+	return zero, fmt.Errorf("%w: %s", ErrServiceNotFound, t)
+}
@@ -0,0 +1,96 @@
+package gostage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type serviceGreeter interface {
+	Greet(name string) string
+}
+
+type englishGreeter struct{ punctuation string }
+
+func (g *englishGreeter) Greet(name string) string { return "hello " + name + g.punctuation }
+
+type frenchGreeter struct{}
+
+func (frenchGreeter) Greet(name string) string { return "bonjour " + name }
+
+// serviceRegion is a named type, provided alongside other strings
+type serviceRegion string
+
+func TestResolve(t *testing.T) {
+	client := &http.Client{}
+	greeter := &englishGreeter{punctuation: "!"}
+	runner := NewRunner(WithService(client), WithService(greeter))
+	runner.Provide(serviceRegion("eu-west-1"))
+
+	var resolved []interface{}
+	wf := NewWorkflow("services", "Services", "")
+	stage := NewStage("s", "S", "")
+	stage.AddAction(NewActionFunc("resolve", "", func(ctx *ActionContext) error {
+		c, err := Resolve[*http.Client](ctx)
+		if err != nil {
+			return err
+		}
+		g, err := Resolve[serviceGreeter](ctx)
+		if err != nil {
+			return err
+		}
+		region, err := Resolve[serviceRegion](ctx)
+		if err != nil {
+			return err
+		}
+		resolved = append(resolved, c, g.Greet("ada"), region)
+		return nil
+	}))
+	wf.AddStage(stage)
+
+	require.NoError(t, runner.Execute(context.Background(), wf, nil))
+	require.Len(t, resolved, 3)
+	assert.Same(t, client, resolved[0])
+	assert.Equal(t, "hello ada!", resolved[1])
+	assert.Equal(t, serviceRegion("eu-west-1"), resolved[2])
+
+	// Services of the workflow take precedence over those of the runner
+	resolved = nil
+	override := &englishGreeter{punctuation: "?"}
+	wf.Provide(override)
+	require.NoError(t, runner.Execute(context.Background(), wf, nil))
+	assert.Equal(t, "hello ada?", resolved[1])
+}
+
+func TestResolveErrors(t *testing.T) {
+	runner := NewRunner(WithService(&englishGreeter{}), WithService(frenchGreeter{}))
+
+	var errs []error
+	wf := NewWorkflow("services", "Services", "")
+	stage := NewStage("s", "S", "")
+	stage.AddAction(NewActionFunc("resolve", "", func(ctx *ActionContext) error {
+		_, err := Resolve[*http.Client](ctx)
+		errs = append(errs, err)
+		_, err = Resolve[serviceGreeter](ctx)
+		errs = append(errs, err)
+		_, err = Resolve[fmt.Stringer](ctx)
+		errs = append(errs, err)
+		return nil
+	}))
+	wf.AddStage(stage)
+
+	require.NoError(t, runner.Execute(context.Background(), wf, nil))
+	require.Len(t, errs, 3)
+	assert.ErrorIs(t, errs[0], ErrServiceNotFound)
+	assert.EqualError(t, errs[0], "service not provided: *http.Client")
+	assert.EqualError(t, errs[1], "several services implement gostage.serviceGreeter: [*gostage.englishGreeter gostage.frenchGreeter]")
+	assert.ErrorIs(t, errs[2], ErrServiceNotFound)
+
+	_, err := Resolve[*http.Client](&ActionContext{})
+	assert.ErrorIs(t, err, ErrServiceNotFound)
+	assert.Panics(t, func() { runner.Provide(nil) })
+}
@@ -0,0 +1,219 @@
+package gostage
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrRunnerShutdown is the cause of the context cancellation of the runs
+// interrupted when Shutdown reaches its deadline.
+var ErrRunnerShutdown = errors.New("runner is shutting down")
+
+// ShutdownReport describes what Shutdown did with the runner's work.
+type ShutdownReport struct {
+	// Drained lists the workflows that finished while the runner was draining
+	Drained []string
+	// Interrupted lists the workflows cancelled at the shutdown deadline
+	Interrupted []string
+	// Abandoned lists the submitted workflows that never started
+	Abandoned []string
+	// Pending lists the delayed runs that had not started yet. They stay in
+	// the schedule backend, if any, to be restored with RestorePending.
+	Pending []string
+	// Checkpointed lists the interrupted and abandoned workflows left in the
+	// WAL, if any, to be resumed with Recover
+	Checkpointed []string
+}
+
+// inflightRun is a workflow being executed by the runner.
+type inflightRun struct {
+	workflow *Workflow
+	runID    string
+	cancel   context.CancelCauseFunc
+}
+
+// runTracker keeps track of the workflows being executed, so that Shutdown
+// can wait for them or cancel them.
+type runTracker struct {
+	mu     sync.Mutex
+	closed bool
+	runs   map[*inflightRun]struct{}
+	wg     sync.WaitGroup
+}
+
+func newRunTracker() *runTracker {
+	return &runTracker{runs: make(map[*inflightRun]struct{})}
+}
+
+// track registers a run and returns its cancellable context along with the
+// function to call once it is over. It fails once the runner is shutting down.
+func (t *runTracker) track(ctx context.Context, w *Workflow) (context.Context, func(), error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return ctx, nil, ErrRunnerClosed
+	}
+
+	runCtx, cancel := context.WithCancelCause(ctx)
+	runID, _ := w.Context[contextRunID].(string)
+	run := &inflightRun{workflow: w, runID: runID, cancel: cancel}
+	t.runs[run] = struct{}{}
+	t.wg.Add(1)
+
+	untrack := func() {
+		t.mu.Lock()
+		delete(t.runs, run)
+		t.mu.Unlock()
+		cancel(nil)
+		t.wg.Done()
+	}
+	return runCtx, untrack, nil
+}
+
+// running reports whether the run with the given ID is being executed.
+func (t *runTracker) running(runID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for run := range t.runs {
+		if run.runID == runID {
+			return true
+		}
+	}
+	return false
+}
+
+// close stops accepting runs and returns the workflows being executed.
+func (t *runTracker) close() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closed = true
+	ids := make([]string, 0, len(t.runs))
+	for run := range t.runs {
+		ids = append(ids, run.workflow.ID)
+	}
+	return ids
+}
+
+// cancel interrupts the runs still in flight and returns their workflows.
+func (t *runTracker) cancel() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ids := make([]string, 0, len(t.runs))
+	for run := range t.runs {
+		ids = append(ids, run.workflow.ID)
+		run.cancel(ErrRunnerShutdown)
+	}
+	return ids
+}
+
+// wait returns a channel closed once no run is in flight.
+func (t *runTracker) wait() <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+	return done
+}
+
+// drain stops accepting jobs and removes the jobs that have not started yet
+// from the queue. Jobs waiting to resume after a preemption are in flight and
+// stay queued.
+func (p *workerPool) drain() []*Job {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	var abandoned []*Job
+	kept := make(jobQueue, 0, len(p.queue))
+	for _, entry := range p.queue {
+		if entry.resume != nil {
+			kept = append(kept, entry)
+		} else {
+			abandoned = append(abandoned, entry.job)
+		}
+	}
+	p.queue = kept
+	heap.Init(&p.queue)
+	return abandoned
+}
+
+// shutdownInterrupt returns the error stopping a run cancelled by Shutdown, if any.
+func shutdownInterrupt(ctx context.Context) error {
+	if cause := context.Cause(ctx); errors.Is(cause, ErrRunnerShutdown) {
+		return cause
+	}
+	return nil
+}
+
+// Shutdown stops the runner for a deployment. It stops accepting new work and
+// lets the workflows in flight run to completion. If ctx is done first, their
+// contexts are cancelled with ErrRunnerShutdown as the cause and they stop
+// before their next action, once the running actions return.
+//
+// Submitted workflows that have not started never will; their jobs finish
+// with ErrRunnerClosed. With a WAL, the interrupted and abandoned workflows
+// are left in it for Recover. Pending delayed runs stay in the schedule
+// backend for RestorePending.
+//
+// Shutdown returns ctx's error if the deadline was reached.
+func (r *Runner) Shutdown(ctx context.Context) (ShutdownReport, error) {
+	var report ShutdownReport
+
+	for _, run := range r.PendingRuns() {
+		report.Pending = append(report.Pending, run.ID)
+	}
+	r.stopDelayed()
+
+	for _, job := range r.pool.drain() {
+		report.Abandoned = append(report.Abandoned, job.Workflow.ID)
+		if r.wal != nil {
+			err := r.walStart(job.Workflow)
+			delete(job.Workflow.Context, "walRun")
+			if err != nil {
+				r.defaultLogger.Warn("Failed to checkpoint workflow %s: %v", job.Workflow.ID, err)
+			} else {
+				report.Checkpointed = append(report.Checkpointed, job.Workflow.ID)
+			}
+		}
+		job.result = RunResult{
+			WorkflowID: job.Workflow.ID,
+			Error:      fmt.Errorf("workflow '%s' was not started: %w", job.Workflow.ID, ErrRunnerClosed),
+		}
+		close(job.done)
+		r.pool.wg.Done()
+	}
+
+	inflight := r.runs.close()
+
+	var deadlineErr error
+	select {
+	case <-r.runs.wait():
+	case <-ctx.Done():
+		deadlineErr = ctx.Err()
+		report.Interrupted = r.runs.cancel()
+		<-r.runs.wait()
+	}
+	r.pool.close()
+
+	interrupted := make(map[string]bool, len(report.Interrupted))
+	for _, id := range report.Interrupted {
+		interrupted[id] = true
+		if r.wal != nil {
+			report.Checkpointed = append(report.Checkpointed, id)
+		}
+	}
+	for _, id := range inflight {
+		if !interrupted[id] {
+			report.Drained = append(report.Drained, id)
+		}
+	}
+	return report, deadlineErr
+}
@@ -0,0 +1,134 @@
+package gostage
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newShutdownRegistry registers a "wait" action blocking until release is
+// closed or its run is cancelled, and a "count" action incrementing counted.
+func newShutdownRegistry(t *testing.T, started chan<- string, release <-chan struct{}, counted *int32) *ActionRegistry {
+	registry := NewActionRegistry()
+	require.NoError(t, registry.Register("wait", func() Action {
+		return NewTestAction("wait", "", func(ctx *ActionContext) error {
+			started <- ctx.Workflow.ID
+			select {
+			case <-release:
+			case <-ctx.GoContext.Done():
+			}
+			return nil
+		})
+	}))
+	require.NoError(t, registry.Register("count", func() Action {
+		return NewTestAction("count", "", func(ctx *ActionContext) error {
+			atomic.AddInt32(counted, 1)
+			return nil
+		})
+	}))
+	return registry
+}
+
+func newShutdownWorkflow(t *testing.T, registry *ActionRegistry, id string) *Workflow {
+	wf := NewWorkflow(id, id, "")
+	stage := NewStage("work", "Work", "")
+	for _, name := range []string{"wait", "count"} {
+		action, err := registry.Resolve(name, nil)
+		require.NoError(t, err)
+		stage.AddAction(action)
+	}
+	wf.AddStage(stage)
+	return wf
+}
+
+func TestShutdownDrainsInFlightWorkflows(t *testing.T) {
+	var counted int32
+	started := make(chan string, 1)
+	release := make(chan struct{})
+	registry := newShutdownRegistry(t, started, release, &counted)
+	runner := NewRunner()
+
+	job, err := runner.Submit(newShutdownWorkflow(t, registry, "report"))
+	require.NoError(t, err)
+	<-started
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	report, err := runner.Shutdown(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"report"}, report.Drained)
+	assert.Empty(t, report.Interrupted)
+	assert.True(t, job.Wait().Success)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&counted))
+
+	// No new work is accepted
+	_, err = runner.Submit(newShutdownWorkflow(t, registry, "late"))
+	assert.ErrorIs(t, err, ErrRunnerClosed)
+	err = runner.Execute(context.Background(), newShutdownWorkflow(t, registry, "late"), nil)
+	assert.ErrorIs(t, err, ErrRunnerClosed)
+}
+
+func TestShutdownInterruptsAtDeadline(t *testing.T) {
+	var counted int32
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	registry := newShutdownRegistry(t, started, release, &counted)
+
+	wal, err := NewFileWAL(t.TempDir())
+	require.NoError(t, err)
+	runner := NewRunner(WithWAL(wal), WithMaxConcurrentWorkflows(1))
+
+	running, err := runner.Submit(newShutdownWorkflow(t, registry, "running"))
+	require.NoError(t, err)
+	<-started
+	queued, err := runner.Submit(newShutdownWorkflow(t, registry, "queued"))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	report, err := runner.Shutdown(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	assert.Equal(t, []string{"running"}, report.Interrupted)
+	assert.Equal(t, []string{"queued"}, report.Abandoned)
+	assert.ElementsMatch(t, []string{"running", "queued"}, report.Checkpointed)
+	assert.Empty(t, report.Drained)
+
+	result := running.Wait()
+	assert.ErrorIs(t, result.Error, ErrRunnerShutdown)
+	assert.ErrorIs(t, queued.Wait().Error, ErrRunnerClosed)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&counted), "the interrupted run stops before its next action")
+
+	// Both workflows resume on the next deployment
+	close(release)
+	results, err := NewRunner(WithWAL(wal)).RecoverWithRegistry(registry)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	for _, result := range results {
+		assert.True(t, result.Success, "%v", result.Error)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&counted))
+}
+
+func TestShutdownReportsPendingDelayedRuns(t *testing.T) {
+	var counted int32
+	registry := newShutdownRegistry(t, make(chan string, 1), nil, &counted)
+	runner := NewRunner()
+
+	run, err := runner.ExecuteAfter(time.Hour, newShutdownWorkflow(t, registry, "later"))
+	require.NoError(t, err)
+
+	report, err := runner.Shutdown(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{run.ID}, report.Pending)
+	assert.ErrorIs(t, run.Wait().Error, ErrRunnerClosed)
+}
@@ -0,0 +1,69 @@
+package gostage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// ErrInterrupted is the cause of the context cancellation of a run stopped by
+// SignalMiddleware. The errors of interrupted runs wrap it.
+var ErrInterrupted = errors.New("workflow interrupted")
+
+// SignalMiddleware creates a middleware that interrupts the workflow when the
+// process receives one of signals, or SIGINT or SIGTERM if none is given.
+//
+// The run's context is cancelled with an error wrapping ErrInterrupted as its
+// cause, and the run stops before its next action. Stages tagged with
+// TagAlwaysRun still execute so that they can clean up. The workflow and the
+// stage that was running get StatusInterrupted, and the run's error wraps
+// ErrInterrupted, which sets RunResult.Interrupted.
+func SignalMiddleware(signals ...os.Signal) Middleware {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	return func(next RunnerFunc) RunnerFunc {
+		return func(ctx context.Context, workflow *Workflow, logger Logger) error {
+			ctx, cancel := context.WithCancelCause(ctx)
+			defer cancel(nil)
+
+			received := make(chan os.Signal, 1)
+			signal.Notify(received, signals...)
+			defer signal.Stop(received)
+
+			finished := make(chan struct{})
+			defer close(finished)
+			go func() {
+				select {
+				case sig := <-received:
+					logger.Warn("Received %v, interrupting workflow %s", sig, workflow.ID)
+					cancel(fmt.Errorf("received %v: %w", sig, ErrInterrupted))
+				case <-finished:
+				}
+			}()
+
+			err := next(ctx, workflow, logger)
+
+			// Actions returning the context's error do not say why it was cancelled
+			if err != nil && !errors.Is(err, ErrInterrupted) {
+				if cause := context.Cause(ctx); errors.Is(cause, ErrInterrupted) {
+					err = fmt.Errorf("%w: %w", cause, err)
+				}
+			}
+			return err
+		}
+	}
+}
+
+// interruption returns the error stopping a run cancelled by SignalMiddleware
+// or by Shutdown, if any.
+func interruption(ctx context.Context) error {
+	if cause := context.Cause(ctx); errors.Is(cause, ErrInterrupted) || errors.Is(cause, ErrRunnerShutdown) {
+		return cause
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package gostage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignalMiddlewareInterruptsRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sending signals to the own process is not supported on Windows")
+	}
+
+	var ran []string
+	wf := NewWorkflow("deploy", "Deploy", "")
+	rollout := NewStage("rollout", "Rollout", "")
+	rollout.AddAction(NewTestAction("wait", "", func(ctx *ActionContext) error {
+		ran = append(ran, "wait")
+		process, err := os.FindProcess(os.Getpid())
+		require.NoError(t, err)
+		require.NoError(t, process.Signal(os.Interrupt))
+		<-ctx.GoContext.Done()
+		return ctx.GoContext.Err()
+	}))
+	rollout.AddAction(NewTestAction("after", "", func(ctx *ActionContext) error {
+		ran = append(ran, "after")
+		return nil
+	}))
+	verify := NewStage("verify", "Verify", "")
+	verify.AddAction(NewTestAction("verify", "", func(ctx *ActionContext) error {
+		ran = append(ran, "verify")
+		return nil
+	}))
+	cleanup := NewStage("cleanup", "Cleanup", "")
+	cleanup.AddTag(TagAlwaysRun)
+	cleanup.AddAction(NewTestAction("cleanup", "", func(ctx *ActionContext) error {
+		ran = append(ran, "cleanup")
+		return ctx.GoContext.Err()
+	}))
+	wf.AddStage(rollout)
+	wf.AddStage(verify)
+	wf.AddStage(cleanup)
+
+	result := NewRunner(WithMiddleware(SignalMiddleware())).ExecuteWithOptions(wf, DefaultRunOptions())
+
+	assert.False(t, result.Success)
+	assert.True(t, result.Interrupted)
+	assert.ErrorIs(t, result.Error, ErrInterrupted)
+	assert.ErrorIs(t, result.Error, context.Canceled)
+	assert.Equal(t, []string{"wait", "cleanup"}, ran)
+	assert.Equal(t, StatusInterrupted, result.StageStatuses["rollout"])
+	assert.Equal(t, StatusCompleted, result.StageStatuses["cleanup"])
+	assert.NotContains(t, result.StageStatuses, "verify")
+
+	status, err := wf.Store.GetProperty(PrefixWorkflow+wf.ID, PropStatus)
+	require.NoError(t, err)
+	assert.Equal(t, StatusInterrupted, status)
+}
+
+func TestAlwaysRunStagesAfterFailure(t *testing.T) {
+	var ran []string
+	wf := NewWorkflow("deploy", "Deploy", "")
+	for _, def := range []struct {
+		id     string
+		always bool
+		err    error
+	}{
+		{"rollout", false, errors.New("rollout failed")},
+		{"verify", false, nil},
+		{"release-lock", true, errors.New("lock already released")},
+		{"notify", true, nil},
+	} {
+		stage := NewStage(def.id, def.id, "")
+		if def.always {
+			stage.AddTag(TagAlwaysRun)
+		}
+		stageErr, id := def.err, def.id
+		stage.AddAction(NewTestAction(id, "", func(ctx *ActionContext) error {
+			ran = append(ran, id)
+			return stageErr
+		}))
+		wf.AddStage(stage)
+	}
+
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+
+	assert.False(t, result.Success)
+	assert.False(t, result.Interrupted)
+	assert.Equal(t, []string{"rollout", "release-lock", "notify"}, ran)
+	assert.Contains(t, result.Error.Error(), "rollout failed")
+	assert.Contains(t, result.Error.Error(), "lock already released")
+	assert.Equal(t, StatusFailed, result.StageStatuses["rollout"])
+	assert.Equal(t, StatusFailed, result.StageStatuses["release-lock"])
+	assert.Equal(t, StatusCompleted, result.StageStatuses["notify"])
+
+	status, err := wf.Store.GetProperty(PrefixWorkflow+wf.ID, PropStatus)
+	require.NoError(t, err)
+	assert.Equal(t, StatusFailed, status)
+}
@@ -0,0 +1,257 @@
+package gostage
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrUntrustedDefinition is returned when a workflow definition is unsigned,
+// signed by a key missing from the trust store, or altered after it was signed.
+var ErrUntrustedDefinition = errors.New("untrusted workflow definition")
+
+// SignedDefinition is a serialized workflow definition and its signature.
+// The signature covers the exact bytes of Definition.
+type SignedDefinition struct {
+	Definition json.RawMessage `json:"definition"`
+	KeyID      string          `json:"keyId"`
+	Signature  []byte          `json:"signature"`
+}
+
+// DefinitionSigner signs serialized workflow definitions.
+type DefinitionSigner interface {
+	// KeyID names the key, so that verifiers know which public key to check with
+	KeyID() string
+	// Sign returns the signature of data
+	Sign(data []byte) ([]byte, error)
+}
+
+// keySigner is a DefinitionSigner using a private key.
+type keySigner struct {
+	keyID string
+	key   crypto.Signer
+}
+
+// NewDefinitionSigner creates a signer using an Ed25519, ECDSA or RSA private
+// key, named keyID in the trust stores of the verifiers. ECDSA and RSA keys
+// sign a SHA-256 digest, with PKCS #1 v1.5 for RSA.
+func NewDefinitionSigner(keyID string, key crypto.Signer) (DefinitionSigner, error) {
+	if keyID == "" {
+		return nil, fmt.Errorf("signing key ID cannot be empty")
+	}
+	switch key.Public().(type) {
+	case ed25519.PublicKey, *ecdsa.PublicKey, *rsa.PublicKey:
+		return &keySigner{keyID: keyID, key: key}, nil
+	default:
+		return nil, fmt.Errorf("unsupported signing key type %T", key)
+	}
+}
+
+func (s *keySigner) KeyID() string {
+	return s.keyID
+}
+
+func (s *keySigner) Sign(data []byte) ([]byte, error) {
+	if _, ok := s.key.Public().(ed25519.PublicKey); ok {
+		return s.key.Sign(rand.Reader, data, crypto.Hash(0))
+	}
+	digest := sha256.Sum256(data)
+	return s.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+// verifySignature checks a signature made by keySigner.
+func verifySignature(key crypto.PublicKey, data, signature []byte) bool {
+	digest := sha256.Sum256(data)
+	switch key := key.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, signature)
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	default:
+		return false
+	}
+}
+
+// TrustStore holds the public keys whose signatures are trusted, by key ID.
+// It is safe for concurrent use.
+type TrustStore struct {
+	mu   sync.RWMutex
+	keys map[string]crypto.PublicKey
+}
+
+// NewTrustStore creates a trust store trusting no key.
+func NewTrustStore() *TrustStore {
+	return &TrustStore{keys: make(map[string]crypto.PublicKey)}
+}
+
+// Add trusts the Ed25519, ECDSA or RSA public key under keyID, replacing any
+// key trusted under that ID.
+func (t *TrustStore) Add(keyID string, key crypto.PublicKey) error {
+	switch key.(type) {
+	case ed25519.PublicKey, *ecdsa.PublicKey, *rsa.PublicKey:
+	default:
+		return fmt.Errorf("unsupported public key type %T", key)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.keys[keyID] = key
+	return nil
+}
+
+// AddPEM trusts the public key of a PEM "PUBLIC KEY" block under keyID.
+func (t *TrustStore) AddPEM(keyID string, data []byte) error {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return fmt.Errorf("key '%s' is not a PEM encoded public key", keyID)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse key '%s': %w", keyID, err)
+	}
+	return t.Add(keyID, key)
+}
+
+// Remove stops trusting the key under keyID.
+func (t *TrustStore) Remove(keyID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.keys, keyID)
+}
+
+// KeyIDs returns the IDs of the trusted keys in sorted order.
+func (t *TrustStore) KeyIDs() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	ids := make([]string, 0, len(t.keys))
+	for id := range t.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Verify checks that signed was signed by a trusted key and returns the
+// definition it holds. Its errors wrap ErrUntrustedDefinition.
+func (t *TrustStore) Verify(signed *SignedDefinition) (*SubWorkflowDef, error) {
+	t.mu.RLock()
+	key, ok := t.keys[signed.KeyID]
+	t.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown signing key '%s'", ErrUntrustedDefinition, signed.KeyID)
+	}
+	if !verifySignature(key, signed.Definition, signed.Signature) {
+		return nil, fmt.Errorf("%w: invalid signature by key '%s'", ErrUntrustedDefinition, signed.KeyID)
+	}
+
+	var def SubWorkflowDef
+	if err := json.Unmarshal(signed.Definition, &def); err != nil {
+		return nil, fmt.Errorf("failed to parse workflow definition: %w", err)
+	}
+	return &def, nil
+}
+
+// SignDefinition serializes def and signs it with signer, returning the JSON
+// of the SignedDefinition.
+func SignDefinition(def *SubWorkflowDef, signer DefinitionSigner) ([]byte, error) {
+	data, err := json.Marshal(def)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize workflow '%s': %w", def.ID, err)
+	}
+	signature, err := signer.Sign(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign workflow '%s': %w", def.ID, err)
+	}
+	return json.Marshal(SignedDefinition{Definition: data, KeyID: signer.KeyID(), Signature: signature})
+}
+
+// MarshalSigned serializes the workflow like Marshal and signs it with signer.
+func (w *Workflow) MarshalSigned(signer DefinitionSigner) ([]byte, error) {
+	def, err := w.ToDef()
+	if err != nil {
+		return nil, err
+	}
+	return SignDefinition(def, signer)
+}
+
+// UnmarshalSignedWorkflow reconstructs a workflow serialized with
+// MarshalSigned once trust has verified its signature, resolving its actions
+// through registry, or the default registry if nil.
+func UnmarshalSignedWorkflow(data []byte, trust *TrustStore, registry *ActionRegistry) (*Workflow, error) {
+	def, err := decodeDefinition(data, trust)
+	if err != nil {
+		return nil, err
+	}
+	return NewWorkflowFromDefWithRegistry(def, registry)
+}
+
+// WithDefinitionSigner makes the runner sign the definitions it sends to be
+// executed in child processes, by spawned stages, Spawn and SpawnWithStore, so
+// that children configured with WithTrustStore accept them. Remote stages are
+// signed by the coordinator, see remote.WithSigner.
+func WithDefinitionSigner(signer DefinitionSigner) RunnerOption {
+	return func(r *Runner) {
+		r.signer = signer
+	}
+}
+
+// WithTrustStore makes the runner only execute serialized definitions signed
+// by a key of trust, in RunChild, RunDefinition and the agents of the remote
+// package. Other definitions are rejected before any of their actions is
+// resolved, with an error wrapping ErrUntrustedDefinition.
+func WithTrustStore(trust *TrustStore) RunnerOption {
+	return func(r *Runner) {
+		r.trust = trust
+	}
+}
+
+// encodeDefinition serializes def, signed when signer is not nil.
+func encodeDefinition(def *SubWorkflowDef, signer DefinitionSigner) ([]byte, error) {
+	if signer != nil {
+		return SignDefinition(def, signer)
+	}
+	data, err := json.Marshal(def)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize workflow '%s': %w", def.ID, err)
+	}
+	return data, nil
+}
+
+// decodeDefinition parses a serialized definition, signed or not. With a trust
+// store, the definition must be signed by one of its keys.
+func decodeDefinition(data []byte, trust *TrustStore) (*SubWorkflowDef, error) {
+	var signed SignedDefinition
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return nil, fmt.Errorf("failed to parse workflow definition: %w", err)
+	}
+
+	if trust != nil {
+		if signed.Definition == nil {
+			return nil, fmt.Errorf("%w: the definition is not signed", ErrUntrustedDefinition)
+		}
+		return trust.Verify(&signed)
+	}
+
+	if signed.Definition != nil {
+		data = signed.Definition
+	}
+	var def SubWorkflowDef
+	if err := json.Unmarshal(data, &def); err != nil {
+		return nil, fmt.Errorf("failed to parse workflow definition: %w", err)
+	}
+	return &def, nil
+}
@@ -0,0 +1,117 @@
+package gostage
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSignedWorkflow returns a workflow of the "noop" action of registry.
+func newSignedWorkflow(t *testing.T, registry *ActionRegistry) *Workflow {
+	wf := NewWorkflow("deploy", "Deploy", "")
+	stage := NewStage("release", "Release", "")
+	noop, err := registry.Resolve("noop", nil)
+	require.NoError(t, err)
+	stage.AddAction(noop)
+	wf.AddStage(stage)
+	return wf
+}
+
+func TestSignAndVerifyDefinitions(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	registry := newSerializationRegistry(t)
+	for name, key := range map[string]crypto.Signer{"ed25519": edKey, "ecdsa": ecKey, "rsa": rsaKey} {
+		t.Run(name, func(t *testing.T) {
+			signer, err := NewDefinitionSigner(name, key)
+			require.NoError(t, err)
+			trust := NewTrustStore()
+			require.NoError(t, trust.Add(name, key.Public()))
+
+			data, err := newSignedWorkflow(t, registry).MarshalSigned(signer)
+			require.NoError(t, err)
+			wf, err := UnmarshalSignedWorkflow(data, trust, registry)
+			require.NoError(t, err)
+			assert.Equal(t, "deploy", wf.ID)
+
+			// Any change to the definition breaks the signature
+			tampered := bytes.Replace(data, []byte("Release"), []byte("Rm -rf"), 1)
+			require.NotEqual(t, data, tampered)
+			_, err = UnmarshalSignedWorkflow(tampered, trust, registry)
+			assert.ErrorIs(t, err, ErrUntrustedDefinition)
+
+			trust.Remove(name)
+			_, err = UnmarshalSignedWorkflow(data, trust, registry)
+			assert.ErrorIs(t, err, ErrUntrustedDefinition)
+		})
+	}
+}
+
+func TestTrustStore(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(public)
+	require.NoError(t, err)
+
+	trust := NewTrustStore()
+	require.NoError(t, trust.AddPEM("ci", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))
+	assert.Error(t, trust.AddPEM("broken", []byte("not a key")))
+	assert.Error(t, trust.Add("hmac", []byte("secret")))
+	assert.Equal(t, []string{"ci"}, trust.KeyIDs())
+
+	_, err = NewDefinitionSigner("", private)
+	assert.Error(t, err)
+
+	// A key trusted under another ID does not vouch for the definition
+	signer, err := NewDefinitionSigner("release", private)
+	require.NoError(t, err)
+	data, err := newSignedWorkflow(t, newSerializationRegistry(t)).MarshalSigned(signer)
+	require.NoError(t, err)
+	_, err = UnmarshalSignedWorkflow(data, trust, newSerializationRegistry(t))
+	assert.ErrorIs(t, err, ErrUntrustedDefinition)
+	assert.ErrorContains(t, err, "unknown signing key 'release'")
+}
+
+func TestRunDefinitionWithTrustStore(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := NewDefinitionSigner("ci", private)
+	require.NoError(t, err)
+	trust := NewTrustStore()
+	require.NoError(t, trust.Add("ci", public))
+
+	registry := newSerializationRegistry(t)
+	def, err := newSignedWorkflow(t, registry).ToDef()
+	require.NoError(t, err)
+	unsigned, err := json.Marshal(def)
+	require.NoError(t, err)
+	signed, err := SignDefinition(def, signer)
+	require.NoError(t, err)
+
+	var output bytes.Buffer
+	require.NoError(t, RunDefinition(context.Background(), signed, &output, registry, WithTrustStore(trust)))
+
+	err = RunDefinition(context.Background(), unsigned, &output, registry, WithTrustStore(trust))
+	assert.ErrorIs(t, err, ErrUntrustedDefinition)
+
+	// Without a trust store, both are executed
+	require.NoError(t, RunDefinition(context.Background(), unsigned, &output, registry))
+	require.NoError(t, RunDefinition(context.Background(), signed, &output, registry))
+}
@@ -0,0 +1,500 @@
+package gostage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"time"
+)
+
+// ChildProcessFlag is the argument with which the runner re-executes the
+// current binary to run a spawned workflow or stage.
+const ChildProcessFlag = "--gostage-child"
+
+// IsChildProcess reports whether the process was started by a runner to
+// execute a spawned workflow or stage. Programs that spawn should check it at
+// the top of main and hand over to RunChild.
+func IsChildProcess() bool {
+	for _, arg := range os.Args[1:] {
+		if arg == ChildProcessFlag {
+			return true
+		}
+	}
+	return false
+}
+
+// childResult is the outcome a child process reports to its parent.
+type childResult struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// childEvent is the form in which a child process sends its lifecycle events.
+type childEvent struct {
+	Type       EventType              `json:"type"`
+	Time       time.Time              `json:"time"`
+	StageID    string                 `json:"stageId,omitempty"`
+	ActionName string                 `json:"actionName,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	Payload    map[string]interface{} `json:"payload,omitempty"`
+}
+
+// storePutMessage is the payload of MessageTypeStorePut.
+type storePutMessage struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// storeDeleteMessage is the payload of MessageTypeStoreDelete.
+type storeDeleteMessage struct {
+	Key string `json:"key"`
+}
+
+// logMessage is the payload of MessageTypeLog.
+type logMessage struct {
+	Level   string            `json:"level"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// ipcLogger sends log lines and their fields to the parent process.
+type ipcLogger struct {
+	broker *RunnerBroker
+	fields map[string]string
+}
+
+func (l *ipcLogger) send(level, format string, args ...interface{}) {
+	l.broker.Send(MessageTypeLog, logMessage{Level: level, Message: fmt.Sprintf(format, args...), Fields: l.fields})
+}
+
+func (l *ipcLogger) Debug(format string, args ...interface{}) { l.send("debug", format, args...) }
+func (l *ipcLogger) Info(format string, args ...interface{})  { l.send("info", format, args...) }
+func (l *ipcLogger) Warn(format string, args ...interface{})  { l.send("warn", format, args...) }
+func (l *ipcLogger) Error(format string, args ...interface{}) { l.send("error", format, args...) }
+
+// With implements FieldLogger.With
+func (l *ipcLogger) With(args ...interface{}) FieldLogger {
+	fields := make(map[string]string, len(l.fields)+len(args)/2)
+	for key, value := range l.fields {
+		fields[key] = value
+	}
+	for i := 0; i+1 < len(args); i += 2 {
+		fields[fmt.Sprint(args[i])] = fmt.Sprint(args[i+1])
+	}
+	return &ipcLogger{broker: l.broker, fields: fields}
+}
+
+// RunChild executes the workflow definition that the parent process writes to
+// stdin, resolving its actions from registry, or from the default registry if
+// registry is nil. Log lines, lifecycle events and the store changes of each
+// action are streamed to the parent over stdout as they happen, followed by
+// the final store and the outcome of the run:
+//
+//	func main() {
+//		if gostage.IsChildProcess() {
+//			if err := gostage.RunChild(nil); err != nil {
+//				os.Exit(1)
+//			}
+//			return
+//		}
+//		// ...
+//	}
+func RunChild(registry *ActionRegistry, opts ...RunnerOption) error {
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return fmt.Errorf("failed to read workflow definition: %w", err)
+	}
+	if err := applyChildLimits(); err != nil {
+		// Report the failure to the parent rather than running unconstrained
+		broker := NewRunnerBroker(os.Stdout)
+		broker.Send(MessageTypeWorkflowResult, childResult{Error: err.Error()})
+		return err
+	}
+	return RunDefinition(context.Background(), data, os.Stdout, registry, opts...)
+}
+
+// RunDefinition executes a serialized workflow definition the way a child
+// process does, writing its log lines, lifecycle events, store changes, final
+// store and outcome to output as IPC messages. It is the executing side of
+// spawned stages and of remote workers. A nil registry uses the default one.
+func RunDefinition(ctx context.Context, data []byte, output io.Writer, registry *ActionRegistry, opts ...RunnerOption) error {
+	if registry == nil {
+		registry = defaultActionRegistry
+	}
+
+	broker := NewRunnerBroker(output)
+	err := runDefinition(ctx, data, broker, registry, opts)
+
+	result := childResult{Success: err == nil}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	if sendErr := broker.Send(MessageTypeWorkflowResult, result); sendErr != nil && err == nil {
+		err = fmt.Errorf("failed to report the result to the parent: %w", sendErr)
+	}
+	return err
+}
+
+// runDefinition executes a serialized workflow definition, streaming its
+// progress through broker.
+func runDefinition(ctx context.Context, data []byte, broker *RunnerBroker, registry *ActionRegistry, opts []RunnerOption) error {
+	// Store synchronization wraps every other action middleware so that it sees all their changes
+	opts = append([]RunnerOption{WithActionMiddleware(storeSyncMiddleware(broker))}, opts...)
+	runner := NewRunnerWithBroker(broker, opts...)
+
+	// The signature is checked before any action of the definition is resolved
+	def, err := decodeDefinition(data, runner.trust)
+	if err != nil {
+		return err
+	}
+	wf, err := NewWorkflowFromDefWithRegistry(def, registry)
+	if err != nil {
+		return fmt.Errorf("failed to create workflow from definition: %w", err)
+	}
+
+	unsubscribe := runner.Subscribe(EventAll, func(event Event) {
+		sent := childEvent{
+			Type:       event.Type,
+			Time:       event.Time,
+			StageID:    event.StageID,
+			ActionName: event.ActionName,
+			Payload:    event.Payload,
+		}
+		if event.Error != nil {
+			sent.Error = event.Error.Error()
+		}
+		broker.Send(MessageTypeEvent, sent)
+	})
+	defer unsubscribe()
+
+	runErr := runner.Execute(ctx, wf, &ipcLogger{broker: broker})
+
+	if err := broker.Send(MessageTypeFinalStore, userData(wf.Store.ExportAll())); err != nil && runErr == nil {
+		return fmt.Errorf("failed to send the final store to the parent: %w", err)
+	}
+	return runErr
+}
+
+// storeSyncMiddleware sends the store changes of each action to the parent process.
+func storeSyncMiddleware(broker *RunnerBroker) ActionMiddleware {
+	return func(next ActionRunnerFunc) ActionRunnerFunc {
+		return func(ctx *ActionContext, action Action, index int, isLast bool) error {
+			before, err := encodeUserStore(ctx.Workflow)
+			if err != nil {
+				return fmt.Errorf("failed to synchronize the store: %w", err)
+			}
+
+			actionErr := next(ctx, action, index, isLast)
+
+			after, err := encodeUserStore(ctx.Workflow)
+			if err != nil {
+				return fmt.Errorf("failed to synchronize the store: %w", err)
+			}
+			puts, deletes := storeDelta(before, after)
+			keys := make([]string, 0, len(puts))
+			for key := range puts {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				if err := broker.Send(MessageTypeStorePut, storePutMessage{Key: key, Value: puts[key]}); err != nil {
+					return fmt.Errorf("failed to synchronize the store: %w", err)
+				}
+			}
+			for _, key := range deletes {
+				if err := broker.Send(MessageTypeStoreDelete, storeDeleteMessage{Key: key}); err != nil {
+					return fmt.Errorf("failed to synchronize the store: %w", err)
+				}
+			}
+			return actionErr
+		}
+	}
+}
+
+// spawnChild re-executes the current binary as a child process constrained by
+// limits, writes def to its stdin, signed by signer if set, and dispatches the
+// messages it writes on stdout to broker until it exits.
+func spawnChild(ctx context.Context, def SubWorkflowDef, broker *RunnerBroker, limits ResourceLimits, signer DefinitionSigner) error {
+	// 1. Serialize the workflow definition
+	defBytes, err := encodeDefinition(&def, signer)
+	if err != nil {
+		return fmt.Errorf("failed to serialize sub-workflow definition: %w", err)
+	}
+
+	// 2. Get the path to the current executable
+	exePath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find executable path: %w", err)
+	}
+
+	// 3. Create the command to run the child process
+	cmd := exec.CommandContext(ctx, exePath, ChildProcessFlag)
+
+	// The child applies the resource limits to itself; switching users happens at exec
+	if !limits.IsZero() {
+		env, err := limitsEnv(limits)
+		if err != nil {
+			return err
+		}
+		cmd.Env = append(os.Environ(), env)
+		if limits.User != "" {
+			if err := runAsUser(cmd, limits.User); err != nil {
+				return fmt.Errorf("cannot run child process as user '%s': %w", limits.User, err)
+			}
+		}
+	}
+
+	// 4. Set up the IPC pipes
+	childStdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create stdin pipe for child: %w", err)
+	}
+	defer childStdin.Close()
+
+	childStdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create stdout pipe for child: %w", err)
+	}
+
+	// Redirect child's stderr to the parent's for logging
+	cmd.Stderr = os.Stderr
+
+	// 5. Start the child process
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start child process: %w", err)
+	}
+
+	// 6. Listen for messages from the child until it closes its stdout
+	listened := make(chan struct{})
+	go func() {
+		defer close(listened)
+		if err := broker.Listen(childStdout); err != nil {
+			fmt.Fprintf(os.Stderr, "error listening to child process: %v\n", err)
+			// Keep draining so that the child never blocks on a full pipe
+			io.Copy(io.Discard, childStdout)
+		}
+	}()
+
+	// 7. Send the workflow definition to the child's stdin, closing it to mark the end
+	_, writeErr := childStdin.Write(defBytes)
+	childStdin.Close()
+
+	// 8. Wait for every message to be read before Wait closes the pipe, then for the child to exit
+	<-listened
+	err = cmd.Wait()
+
+	if writeErr != nil && err == nil {
+		return fmt.Errorf("failed to write workflow definition to child: %w", writeErr)
+	}
+	if err != nil {
+		return fmt.Errorf("child process exited with error: %w", err)
+	}
+	return nil
+}
+
+// executeStageElsewhere runs a stage outside of the runner's process: in a
+// child process started with RunChild, or on a remote worker. dispatch sends
+// the stage's definition to the executor and feeds what it streams back to
+// the broker; where names the executor in errors. The executor starts from the
+// workflow's store; the store changes, logs and action events it streams back
+// are applied to the workflow as they arrive.
+func (r *Runner) executeStageElsewhere(ctx context.Context, s *Stage, w *Workflow, logger Logger, where string, dispatch func(context.Context, SubWorkflowDef, *RunnerBroker) error) error {
+	stageDef, err := w.stageToDef(s)
+	if err != nil {
+		return fmt.Errorf("cannot run stage '%s' in a %s: %w", s.ID, where, err)
+	}
+	// The executor runs the stage itself rather than dispatching it again
+	tags := stageDef.Tags[:0]
+	for _, tag := range stageDef.Tags {
+		if tag != TagSpawn && tag != TagRemote {
+			tags = append(tags, tag)
+		}
+	}
+	stageDef.Tags = tags
+
+	// Initial data providers run here and their values travel in the store,
+	// taking precedence over the static initial data as they do in process
+	loaded, err := s.applyInitialData(&ActionContext{GoContext: ctx, Workflow: w, Stage: s, Logger: AsFieldLogger(logger)})
+	if err != nil {
+		return err
+	}
+	for key := range loaded {
+		delete(stageDef.InitialStore, key)
+	}
+
+	def := SubWorkflowDef{
+		ID:           w.ID,
+		Name:         w.Name,
+		Annotations:  w.Annotations(),
+		Stages:       []StageDef{stageDef},
+		InitialStore: userData(w.Store.ExportAll()),
+	}
+	// The stage gets what is left of the run's time budget, not a fresh one
+	if deadline, ok := runDeadline(w); ok {
+		def.Deadline = &deadline
+	}
+
+	// A broker of its own keeps the messages of this stage apart from other dispatches
+	broker := NewRunnerBroker(io.Discard)
+	if r.Broker != nil {
+		r.Broker.mu.RLock()
+		broker.AddIPCMiddleware(r.Broker.middleware...)
+		r.Broker.mu.RUnlock()
+	}
+
+	var result *childResult
+	var syncErr error
+	broker.RegisterHandler(MessageTypeLog, relayLog(logger))
+	broker.RegisterHandler(MessageTypeStorePut, func(_ MessageType, payload json.RawMessage) error {
+		var msg storePutMessage
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			return err
+		}
+		if err := applyStoreDelta(w, map[string]json.RawMessage{msg.Key: msg.Value}, nil); err != nil && syncErr == nil {
+			syncErr = err
+		}
+		return nil
+	})
+	broker.RegisterHandler(MessageTypeStoreDelete, func(_ MessageType, payload json.RawMessage) error {
+		var msg storeDeleteMessage
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			return err
+		}
+		w.Store.Delete(msg.Key)
+		return nil
+	})
+	broker.RegisterHandler(MessageTypeEvent, func(_ MessageType, payload json.RawMessage) error {
+		var msg childEvent
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			return err
+		}
+		r.forwardChildEvent(w, s, msg)
+		return nil
+	})
+	broker.RegisterHandler(MessageTypeWorkflowResult, func(_ MessageType, payload json.RawMessage) error {
+		result = &childResult{}
+		return json.Unmarshal(payload, result)
+	})
+	var finalStore map[string]json.RawMessage
+	broker.RegisterHandler(MessageTypeFinalStore, func(_ MessageType, payload json.RawMessage) error {
+		return json.Unmarshal(payload, &finalStore)
+	})
+
+	logger.Debug("Running stage %s in a %s", s.ID, where)
+	dispatchErr := dispatch(ctx, def, broker)
+
+	// Catch up with the changes made outside of actions, such as the stage's initial store
+	if finalStore != nil && syncErr == nil {
+		syncErr = reconcileStore(w, finalStore)
+	}
+
+	switch {
+	case result != nil && !result.Success:
+		return errors.New(where + ": " + result.Error)
+	case dispatchErr != nil:
+		return dispatchErr
+	case syncErr != nil:
+		return fmt.Errorf("failed to synchronize the store from the %s: %w", where, syncErr)
+	}
+	return nil
+}
+
+// relayLog returns a handler logging the MessageTypeLog messages to logger.
+func relayLog(logger Logger) MessageHandler {
+	return func(_ MessageType, payload json.RawMessage) error {
+		var msg logMessage
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			return err
+		}
+		// The parent's logger already carries the workflow and stage
+		keys := make([]string, 0, len(msg.Fields))
+		for key := range msg.Fields {
+			if key != "workflow" && key != "stage" {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		var fields []interface{}
+		for _, key := range keys {
+			fields = append(fields, key, msg.Fields[key])
+		}
+		logger := LoggerWith(logger, fields...)
+
+		switch msg.Level {
+		case "debug":
+			logger.Debug("%s", msg.Message)
+		case "warn":
+			logger.Warn("%s", msg.Message)
+		case "error":
+			logger.Error("%s", msg.Message)
+		default:
+			logger.Info("%s", msg.Message)
+		}
+		return nil
+	}
+}
+
+// reconcileStore makes the user data of the workflow store match final.
+func reconcileStore(w *Workflow, final map[string]json.RawMessage) error {
+	current, err := encodeUserStore(w)
+	if err != nil {
+		return err
+	}
+	target := make(map[string]string, len(final))
+	for key, value := range final {
+		target[key] = string(value)
+	}
+	puts, deletes := storeDelta(current, target)
+	return applyStoreDelta(w, puts, deletes)
+}
+
+// forwardChildEvent publishes an action event of a spawned stage on the
+// runner's bus and records the action status. The stage and workflow events
+// of the child are not forwarded, as the parent reports those itself.
+func (r *Runner) forwardChildEvent(w *Workflow, s *Stage, msg childEvent) {
+	var status string
+	switch msg.Type {
+	case EventActionStarted:
+		status = StatusRunning
+	case EventActionCompleted:
+		status = StatusCompleted
+	case EventActionFailed:
+		status = StatusFailed
+	case EventActionSkipped:
+		status = StatusSkipped
+	case EventActionRetried, EventActionHedged, EventActionStuck:
+	case EventArtifactAttached:
+		forwardChildArtifact(w, s.ID, msg.ActionName, msg.Payload)
+	default:
+		return
+	}
+	if status != "" {
+		w.setActionStatus(s.ID, msg.ActionName, status)
+	}
+
+	event := Event{
+		Type:       msg.Type,
+		Time:       msg.Time,
+		WorkflowID: w.ID,
+		StageID:    s.ID,
+		ActionName: msg.ActionName,
+		Payload:    msg.Payload,
+	}
+	if msg.Error != "" {
+		event.Error = errors.New(msg.Error)
+	}
+	var action Action
+	for _, candidate := range s.Actions {
+		if candidate.Name() == msg.ActionName {
+			action = candidate
+			break
+		}
+	}
+	event.Annotations = mergedAnnotations(w, s, action)
+	r.publish(w, event)
+}
@@ -14,6 +14,7 @@ import (
 
 	"github.com/davidroman0O/gostage/store"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // BrokerLogger is a gostage.Logger implementation that sends log messages
@@ -50,6 +51,14 @@ func TestMain(m *testing.M) {
 		childMain()
 		return
 	}
+	// Stages and workflows spawned by the runner re-execute the test binary with ChildProcessFlag.
+	if IsChildProcess() {
+		registerSpawnTestActions()
+		if err := RunChild(nil); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
 	// Otherwise, run the tests as normal.
 	os.Exit(m.Run())
 }
@@ -119,6 +128,8 @@ const (
 	storeModifierActionID = "store-modifier-action"
 	panicTestActionID     = "panic-test-action"
 	slowTestActionID      = "slow-test-action"
+	orderEchoActionID     = "order-echo-action"
+	openFilesActionID     = "open-files-action"
 )
 
 // SpawnTestAction is a simple action that sends messages back to the parent.
@@ -167,6 +178,43 @@ func (a *PanicTestAction) Execute(ctx *ActionContext) error {
 	panic("intentional panic for testing")
 }
 
+// OrderEchoAction reads the order from the store it received from the parent,
+// records the process it ran in and consumes the draft.
+type OrderEchoAction struct{ BaseAction }
+
+func (a *OrderEchoAction) Execute(ctx *ActionContext) error {
+	orderID, err := store.Get[string](ctx.Store(), "orderId")
+	if err != nil {
+		return err
+	}
+	ctx.Logger.Info("OrderEchoAction saw order %s.", orderID)
+	ctx.Store().Delete("draft")
+	if err := ctx.Store().Put("echo", orderID); err != nil {
+		return err
+	}
+	return ctx.Store().Put("pid", os.Getpid())
+}
+
+// OpenFilesAction opens many files at once to test the open files limit of a child.
+type OpenFilesAction struct{ BaseAction }
+
+func (a *OpenFilesAction) Execute(ctx *ActionContext) error {
+	var files []*os.File
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+	for i := 0; i < 64; i++ {
+		file, err := os.Open(os.DevNull)
+		if err != nil {
+			return err
+		}
+		files = append(files, file)
+	}
+	return ctx.Store().Put("opened", len(files))
+}
+
 // SlowTestAction is an action that takes a long time to test timeout scenarios.
 type SlowTestAction struct{ BaseAction }
 
@@ -203,6 +251,12 @@ func registerSpawnTestActions() {
 		RegisterAction(slowTestActionID, func() Action {
 			return &SlowTestAction{BaseAction: NewBaseAction(slowTestActionID, "An action that takes a long time.")}
 		})
+		RegisterAction(orderEchoActionID, func() Action {
+			return &OrderEchoAction{BaseAction: NewBaseAction(orderEchoActionID, "An action that echoes the order.")}
+		})
+		RegisterAction(openFilesActionID, func() Action {
+			return &OpenFilesAction{BaseAction: NewBaseAction(openFilesActionID, "An action that opens many files.")}
+		})
 	})
 }
 
@@ -407,7 +461,8 @@ func spawnTestProcess(ctx context.Context, r *Runner, def SubWorkflowDef) error
 	go func() {
 		defer wg.Done()
 		if err := r.Broker.Listen(childStdout); err != nil {
-			// In tests, it's okay if this errors when the pipe closes, so we don't log it.
+			// Keep draining so that the child never blocks on a full pipe.
+			io.Copy(io.Discard, childStdout)
 		}
 	}()
 
@@ -422,12 +477,13 @@ func spawnTestProcess(ctx context.Context, r *Runner, def SubWorkflowDef) error
 	}
 	childStdin.Close() // Close stdin to signal EOF to the child's reader.
 
-	// Wait for the child process to finish.
-	err = cmd.Wait()
-
 	// Wait for the listening goroutine to finish processing all messages.
+	// This must happen before cmd.Wait, which closes the stdout pipe.
 	wg.Wait()
 
+	// Wait for the child process to finish.
+	err = cmd.Wait()
+
 	if err != nil {
 		return fmt.Errorf("child process exited with error: %w", err)
 	}
@@ -611,3 +667,108 @@ func TestSpawnWorkflow_WithMultipleFailures(t *testing.T) {
 	}
 	assert.False(t, panicFound, "Should not reach the panic action due to earlier failure")
 }
+
+// newSpawnedStageWorkflow builds a workflow whose middle stage runs the given
+// registered actions in a child process.
+func newSpawnedStageWorkflow(t *testing.T, actionIDs ...string) *Workflow {
+	registerSpawnTestActions()
+
+	wf := NewWorkflow("orders", "Orders", "")
+	prepare := NewStage("prepare", "Prepare", "")
+	prepare.AddAction(NewTestAction("prepare", "", func(ctx *ActionContext) error {
+		ctx.Store().Put("draft", true)
+		return ctx.Store().Put("orderId", "o-1")
+	}))
+	wf.AddStage(prepare)
+
+	isolated := NewStage("isolated", "Isolated", "")
+	isolated.AddTag(TagSpawn)
+	for _, id := range actionIDs {
+		action, err := NewActionFromRegistry(id)
+		require.NoError(t, err)
+		isolated.AddAction(action)
+	}
+	wf.AddStage(isolated)
+
+	finish := NewStage("finish", "Finish", "")
+	finish.AddAction(NewTestAction("finish", "", func(ctx *ActionContext) error {
+		echo, err := store.Get[string](ctx.Store(), "echo")
+		if err != nil {
+			return err
+		}
+		return ctx.Store().Put("finished", echo)
+	}))
+	wf.AddStage(finish)
+	return wf
+}
+
+func TestSpawnStageInChildProcess(t *testing.T) {
+	wf := newSpawnedStageWorkflow(t, orderEchoActionID, storeModifierActionID)
+	runner := NewRunner()
+	var events []Event
+	runner.Subscribe(EventAll, func(event Event) { events = append(events, event) })
+
+	options := DefaultRunOptions()
+	options.CaptureLogs = true
+	result := runner.ExecuteWithOptions(wf, options)
+	require.True(t, result.Success, "%v", result.Error)
+
+	// Store changes made in the child are synchronized back to the parent
+	assert.Equal(t, "o-1", result.FinalStore["echo"])
+	assert.Equal(t, "o-1", result.FinalStore["finished"])
+	assert.Equal(t, "value1", result.FinalStore["item1"])
+	assert.NotContains(t, result.FinalStore, "draft")
+	assert.NotEqual(t, float64(os.Getpid()), result.FinalStore["pid"], "the stage must run in another process")
+
+	// Logs and action events are streamed back
+	var messages []string
+	for _, entry := range result.Logs {
+		messages = append(messages, entry.Message)
+	}
+	assert.Contains(t, messages, "OrderEchoAction saw order o-1.")
+
+	var completed []string
+	for _, event := range events {
+		if event.Type == EventActionCompleted && event.StageID == "isolated" {
+			completed = append(completed, event.ActionName)
+			assert.Equal(t, "orders", event.WorkflowID)
+		}
+	}
+	assert.Equal(t, []string{orderEchoActionID, storeModifierActionID}, completed)
+	assert.Equal(t, StatusCompleted, result.ActionStatuses[ActionStatusKey("isolated", orderEchoActionID)])
+	assert.Equal(t, StatusCompleted, result.StageStatuses["isolated"])
+}
+
+func TestSpawnStageFailure(t *testing.T) {
+	wf := newSpawnedStageWorkflow(t, orderEchoActionID, errorTestActionID)
+
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.Error(t, result.Error)
+	assert.Contains(t, result.Error.Error(), "intentional action failure")
+	assert.Equal(t, StatusFailed, result.ActionStatuses[ActionStatusKey("isolated", errorTestActionID)])
+	assert.Equal(t, StatusFailed, result.StageStatuses["isolated"])
+	// Changes made before the failure still reach the parent
+	assert.Equal(t, "o-1", result.FinalStore["echo"])
+}
+
+func TestSpawnStageCrashIsIsolated(t *testing.T) {
+	wf := newSpawnedStageWorkflow(t, panicTestActionID)
+
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.Error(t, result.Error)
+	assert.Contains(t, result.Error.Error(), "child process exited with error")
+	assert.Equal(t, StatusFailed, result.StageStatuses["isolated"])
+}
+
+func TestSpawnWithRunChild(t *testing.T) {
+	registerSpawnTestActions()
+
+	result := NewRunner().SpawnWithStore(context.Background(), SubWorkflowDef{
+		ID:     "child-workflow",
+		Stages: []StageDef{{ID: "work", Actions: []ActionDef{{ID: storeModifierActionID}}}},
+	}, map[string]interface{}{"parent_message": "hello"})
+
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, "hello", result.FinalStore["parent_message"])
+	assert.Equal(t, 42.0, result.FinalStore["item2"])
+}
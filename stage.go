@@ -31,9 +31,39 @@ type Stage struct {
 
 	// initialStore contains key-value data available at the start of stage execution
 	initialStore *store.KVStore
+	// initialSources loads initial data when the stage starts, set with SetInitialDataFrom
+	initialSources []initialDataSource
+	// mergePolicy resolves the conflicts of the initial data with the workflow store
+	mergePolicy MergePolicy
 
 	// middleware contains the middleware functions to apply during stage execution
 	middleware []StageMiddleware
+
+	// limits constrains the child process running the stage when it is spawned
+	limits ResourceLimits
+
+	// loop repeats the actions of the stage when it was created with LoopStage
+	loop *loopConfig
+
+	// branches holds the alternative stages of a stage created with IfStage or SwitchStage
+	branches *stageBranches
+
+	// placement and dependencies position the stage when it is added dynamically
+	placement    Placement
+	dependencies []string
+	// barrier makes the stage wait for its dependencies when stages run at the same time
+	barrier bool
+
+	// annotations holds arbitrary key/value metadata set with SetAnnotation
+	annotations map[string]string
+
+	// consumes and produces hold the schemas declared with Consumes and Produces
+	consumes []keySchema
+	produces []keySchema
+
+	// resolved holds the actions resolved by resolveActions for the stage ID resolvedID
+	resolved   []resolvedAction
+	resolvedID string
 }
 
 // StageInfo holds serializable stage information for persistence and transmission.
@@ -160,6 +190,7 @@ func (s *Stage) HasAnyTag(tags []string) bool {
 // Actions are executed in the order they are added to the stage.
 func (s *Stage) AddAction(action Action) {
 	s.Actions = append(s.Actions, action)
+	s.resolveActions(len(s.Actions) - 1)
 }
 
 // SetInitialData adds or updates a key-value pair in the stage's initial store
@@ -985,3 +985,29 @@ func TestNilValuesInInitialStore(t *testing.T) {
 	assert.NoError(t, err)
 	assert.True(t, checkRan, "Check action should have run")
 }
+
+func TestStageActionStatusKeys(t *testing.T) {
+	noop := func(ctx *ActionContext) error { return nil }
+	stage := NewStage("draft", "Stage", "")
+	stage.AddAction(NewTestAction("first", "First", noop))
+	stage.AddAction(NewTestAction("second", "Second", func(ctx *ActionContext) error {
+		ctx.AddDynamicAction(NewTestAction("dynamic", "Dynamic", noop))
+		return nil
+	}))
+
+	// The statuses follow the stage ID and actions replaced after they were added
+	stage.ID = "build"
+	stage.Actions[0] = NewTestAction("replaced", "Replaced", noop)
+	stage.Actions = append(stage.Actions, NewTestAction("appended", "Appended", noop))
+
+	workflow := NewWorkflow("keys", "Keys", "")
+	workflow.AddStage(stage)
+	assert.NoError(t, NewRunner().Execute(context.Background(), workflow, nil))
+
+	assert.Equal(t, map[string]string{
+		"build:replaced": StatusCompleted,
+		"build:second":   StatusCompleted,
+		"build:dynamic":  StatusCompleted,
+		"build:appended": StatusCompleted,
+	}, workflow.ActionStatuses())
+}
@@ -0,0 +1,146 @@
+package gostage
+
+import "sync"
+
+// Context keys used to record the execution status of stages and actions
+const (
+	contextStageStatuses  = "stageStatuses"
+	contextActionStatuses = "actionStatuses"
+	contextActionResults  = "actionResults"
+)
+
+// ActionStatusKey returns the key identifying an action in ActionStatuses.
+func ActionStatusKey(stageID, actionName string) string {
+	return stageID + ":" + actionName
+}
+
+// StageStatuses returns the status of each stage recorded during the last run, keyed by stage ID.
+func (w *Workflow) StageStatuses() map[string]string {
+	return copyStatuses(w.Context[contextStageStatuses])
+}
+
+// ActionStatuses returns the status of each action recorded during the last run,
+// keyed by ActionStatusKey.
+func (w *Workflow) ActionStatuses() map[string]string {
+	return copyStatuses(w.Context[contextActionStatuses])
+}
+
+// setStageStatus records a stage status in the store metadata and the run statuses.
+func (w *Workflow) setStageStatus(stageID, status string) {
+	w.Store.SetProperty(PrefixStage+stageID, PropStatus, statusValue(status))
+	w.statuses(contextStageStatuses).set(stageID, status)
+}
+
+// setActionStatus records an action status in the store metadata and the run statuses.
+func (w *Workflow) setActionStatus(stageID, actionName, status string) {
+	w.setActionStatusAt(actionStoreKey(stageID, actionName), status)
+}
+
+// setActionStatusAt records the status of the action stored under storeKey,
+// which the runner builds once for all the statuses of an action. The
+// ActionStatusKey of the action is the end of storeKey, so that recording a
+// status does not allocate.
+func (w *Workflow) setActionStatusAt(storeKey, status string) {
+	w.Store.SetProperty(storeKey, PropStatus, statusValue(status))
+	w.statuses(contextActionStatuses).set(storeKey[len(PrefixAction):], status)
+}
+
+// actionStoreKey returns the store key of an action.
+func actionStoreKey(stageID, actionName string) string {
+	return PrefixAction + stageID + ":" + actionName
+}
+
+// resolvedAction is an action of a stage resolved for dispatch: its name and
+// the store key its statuses are recorded under.
+type resolvedAction struct {
+	name string
+	key  string
+}
+
+// resolveActions resolves the actions of s from position from on, building
+// the store key of those added, replaced or renamed since they were last
+// resolved, so that the runner looks up the key of an action by position
+// instead of building it on every dispatch. All the actions are resolved
+// again if the stage ID changed.
+func (s *Stage) resolveActions(from int) {
+	if s.resolvedID != s.ID {
+		s.resolved = s.resolved[:0]
+		s.resolvedID = s.ID
+	}
+	s.resolved = s.resolved[:min(len(s.resolved), len(s.Actions))]
+	for i := min(from, len(s.resolved)); i < len(s.Actions); i++ {
+		name := s.Actions[i].Name()
+		if i == len(s.resolved) {
+			s.resolved = append(s.resolved, resolvedAction{name: name, key: actionStoreKey(s.ID, name)})
+		} else if s.resolved[i].name != name {
+			s.resolved[i] = resolvedAction{name: name, key: actionStoreKey(s.ID, name)}
+		}
+	}
+}
+
+// statusValue returns status as an interface value. Converting a constant
+// does not allocate, unlike converting a string variable.
+func statusValue(status string) interface{} {
+	switch status {
+	case StatusPending:
+		return StatusPending
+	case StatusRunning:
+		return StatusRunning
+	case StatusCompleted:
+		return StatusCompleted
+	case StatusFailed:
+		return StatusFailed
+	case StatusSkipped:
+		return StatusSkipped
+	case StatusInterrupted:
+		return StatusInterrupted
+	case StatusCancelled:
+		return StatusCancelled
+	}
+	return status
+}
+
+// resetStatuses clears the statuses and action results recorded by a previous run.
+func (w *Workflow) resetStatuses() {
+	actions := 0
+	for _, stage := range w.Stages {
+		actions += len(stage.Actions)
+	}
+	w.Context[contextStageStatuses] = &runStatuses{byKey: make(map[string]string, len(w.Stages))}
+	w.Context[contextActionStatuses] = &runStatuses{byKey: make(map[string]string, actions)}
+	w.Context[contextActionResults] = &actionResults{}
+}
+
+// runStatuses holds the statuses of a run, which stages running at the same
+// time record concurrently.
+type runStatuses struct {
+	mu    sync.Mutex
+	byKey map[string]string
+}
+
+func (s *runStatuses) set(key, status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.byKey[key] = status
+}
+
+func (w *Workflow) statuses(key string) *runStatuses {
+	statuses, ok := w.Context[key].(*runStatuses)
+	if !ok {
+		statuses = &runStatuses{byKey: make(map[string]string)}
+		w.Context[key] = statuses
+	}
+	return statuses
+}
+
+func copyStatuses(value interface{}) map[string]string {
+	out := make(map[string]string)
+	if statuses, ok := value.(*runStatuses); ok {
+		statuses.mu.Lock()
+		defer statuses.mu.Unlock()
+		for k, v := range statuses.byKey {
+			out[k] = v
+		}
+	}
+	return out
+}
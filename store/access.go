@@ -0,0 +1,98 @@
+package store
+
+import (
+	"fmt"
+	"path"
+	"slices"
+)
+
+// AccessRule restricts the keys matching Pattern, a path.Match pattern such
+// as "billing.*", to the callers with one of the Read tags for reading and one
+// of the Write tags for writing. Callers allowed to write may also read.
+type AccessRule struct {
+	Pattern string
+	Read    []string
+	Write   []string
+}
+
+// accessPolicy holds the rules set with SetAccessPolicy.
+type accessPolicy struct {
+	rules []AccessRule
+}
+
+// SetAccessPolicy restricts the keys of the store to the callers with the
+// tags of the rules matching them, replacing any previous rules. A key
+// matching several rules must be allowed by all of them; keys matching none
+// are open to every caller. The policy only binds the views of AccessAs:
+// the store itself keeps full access.
+func (s *KVStore) SetAccessPolicy(rules ...AccessRule) error {
+	for _, rule := range rules {
+		if _, err := path.Match(rule.Pattern, ""); err != nil {
+			return fmt.Errorf("invalid access rule pattern '%s': %w", rule.Pattern, err)
+		}
+	}
+	if len(rules) == 0 {
+		s.policy.Store(nil)
+		return nil
+	}
+	s.policy.Store(&accessPolicy{rules: append([]AccessRule(nil), rules...)})
+	return nil
+}
+
+// HasAccessPolicy reports whether access rules are set on the store.
+func (s *KVStore) HasAccessPolicy() bool {
+	return s.policy.Load() != nil
+}
+
+// AccessAs returns a view of the store for a caller with tags, such as the
+// tags of an action, enforcing the access policy of the store. Reads and
+// writes the policy denies fail with ErrAccessDenied, listing and searching
+// keys skips the keys the caller may not read, and the metadata of keys the
+// caller may not write is handed out as a copy.
+func (s *KVStore) AccessAs(tags ...string) *KVStore {
+	return &KVStore{kvState: s.kvState, readOnly: s.readOnly, callerTags: tags, restricted: true}
+}
+
+// canRead reports whether the caller of the view may read key.
+func (s *KVStore) canRead(key string) bool {
+	return s.allowed(key, true)
+}
+
+// canWrite reports whether the caller of the view may write key.
+func (s *KVStore) canWrite(key string) bool {
+	return s.allowed(key, false)
+}
+
+func (s *KVStore) allowed(key string, read bool) bool {
+	if !s.restricted {
+		return true
+	}
+	policy := s.policy.Load()
+	if policy == nil {
+		return true
+	}
+	for _, rule := range policy.rules {
+		if matched, _ := path.Match(rule.Pattern, key); !matched {
+			continue
+		}
+		if !s.hasAnyTag(rule.Write) && (!read || !s.hasAnyTag(rule.Read)) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasAnyTag reports whether the caller of the view has one of tags.
+func (s *KVStore) hasAnyTag(tags []string) bool {
+	for _, tag := range tags {
+		if slices.Contains(s.callerTags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// accessDenied is the error of an access to key the policy denies.
+func accessDenied(op, key string) error {
+	return fmt.Errorf("cannot %s key %s: %w", op, key, ErrAccessDenied)
+}
@@ -0,0 +1,130 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessPolicy(t *testing.T) {
+	s := NewKVStore()
+	require.NoError(t, s.SetAccessPolicy(
+		AccessRule{Pattern: "billing.*", Read: []string{"reporting"}, Write: []string{"billing"}},
+		AccessRule{Pattern: "credentials.*", Write: []string{"deploy"}},
+	))
+	assert.True(t, s.HasAccessPolicy())
+
+	// The store itself is not bound by the policy
+	require.NoError(t, s.Put("billing.total", 120))
+	require.NoError(t, s.Put("credentials.token", "secret"))
+	require.NoError(t, s.Put("public.name", "orders"))
+
+	billing := s.AccessAs("billing")
+	reporting := s.AccessAs("reporting", "noisy")
+	anyone := s.AccessAs()
+
+	// Writers can read and write, readers can only read
+	require.NoError(t, billing.Put("billing.total", 130))
+	total, err := Get[int](reporting, "billing.total")
+	require.NoError(t, err)
+	assert.Equal(t, 130, total)
+	assert.ErrorIs(t, reporting.Put("billing.total", 0), ErrAccessDenied)
+	assert.False(t, reporting.Delete("billing.total"))
+	assert.ErrorIs(t, reporting.AddTag("billing.total", "x"), ErrAccessDenied)
+
+	// Callers without the tags can neither read nor write
+	_, err = Get[string](anyone, "credentials.token")
+	assert.ErrorIs(t, err, ErrAccessDenied)
+	_, err = Get[string](billing, "credentials.token")
+	assert.ErrorIs(t, err, ErrAccessDenied)
+	_, err = anyone.GetMetadata("credentials.token")
+	assert.ErrorIs(t, err, ErrAccessDenied)
+	assert.ErrorIs(t, anyone.Put("billing.total", 0), ErrAccessDenied)
+
+	// Keys matching no rule are open to every caller
+	require.NoError(t, anyone.Put("public.name", "invoices"))
+
+	// Scans and exports skip what the caller may not read
+	assert.Equal(t, map[string]interface{}{"public.name": "invoices"}, anyone.ExportAll())
+	assert.ElementsMatch(t, []string{"billing.total", "public.name"}, keysOf(reporting))
+	assert.Equal(t, 2, reporting.Clone().Count())
+
+	// A read-only view keeps the caller's restrictions
+	view := reporting.ReadOnlyView()
+	_, err = Get[string](view, "credentials.token")
+	assert.ErrorIs(t, err, ErrAccessDenied)
+
+	// Clearing through a view only removes the keys the caller may write
+	anyone.Clear()
+	assert.ElementsMatch(t, []string{"billing.total", "credentials.token"}, s.ListKeys())
+
+	assert.Error(t, s.SetAccessPolicy(AccessRule{Pattern: "[", Read: []string{"x"}}))
+	require.NoError(t, s.SetAccessPolicy())
+	_, err = Get[string](anyone, "credentials.token")
+	assert.NoError(t, err)
+}
+
+// keysOf lists the keys Range yields on s.
+func keysOf(s *KVStore) []string {
+	var keys []string
+	s.Range("", func(key string, value any) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+func TestAccessPolicyListings(t *testing.T) {
+	s := NewKVStore()
+	require.NoError(t, s.SetAccessPolicy(AccessRule{Pattern: "secret.*", Read: []string{"ops"}}))
+	require.NoError(t, s.PutWithMetadata("secret.token", "abc", taggedMetadata("sensitive")))
+	require.NoError(t, s.PutWithMetadata("public.name", "orders", taggedMetadata("sensitive")))
+	require.NoError(t, s.SetProperty("secret.token", "owner", "ops"))
+	require.NoError(t, s.SetProperty("public.name", "owner", "ops"))
+
+	anyone := s.AccessAs()
+	ops := s.AccessAs("ops")
+
+	assert.Equal(t, []string{"public.name"}, anyone.ListKeys())
+	assert.Equal(t, 1, anyone.Count())
+	assert.Equal(t, []string{"public.name"}, anyone.FindKeysByTag("sensitive"))
+	assert.Equal(t, []string{"public.name"}, anyone.FindKeysByAllTags([]string{"sensitive"}))
+	assert.Equal(t, []string{"public.name"}, anyone.FindKeysByAnyTag([]string{"sensitive", "other"}))
+	assert.Equal(t, []string{"public.name"}, anyone.FindKeysByProperty("owner", "ops"))
+	assert.Equal(t, []string{"public.name"}, KeysByType[string](anyone))
+
+	assert.ElementsMatch(t, []string{"secret.token", "public.name"}, ops.ListKeys())
+	assert.Equal(t, 2, ops.Count())
+	assert.ElementsMatch(t, []string{"secret.token", "public.name"}, ops.FindKeysByTag("sensitive"))
+	assert.ElementsMatch(t, []string{"secret.token", "public.name"}, KeysByType[string](ops))
+}
+
+func TestAccessPolicyMetadataCopies(t *testing.T) {
+	s := NewKVStore()
+	require.NoError(t, s.SetAccessPolicy(AccessRule{Pattern: "billing.*", Read: []string{"reporting"}, Write: []string{"billing"}}))
+	require.NoError(t, s.PutWithMetadata("billing.card", "4242", taggedMetadata("secret")))
+
+	// Readers get a copy, so that they cannot untag the key through it
+	meta, err := s.AccessAs("reporting").GetMetadata("billing.card")
+	require.NoError(t, err)
+	meta.RemoveTag("secret")
+	hasTag, err := s.HasTag("billing.card", "secret")
+	require.NoError(t, err)
+	assert.True(t, hasTag)
+
+	// Writers get the metadata of the key itself
+	meta, err = s.AccessAs("billing").GetMetadata("billing.card")
+	require.NoError(t, err)
+	meta.AddTag("audited")
+	hasTag, err = s.HasTag("billing.card", "audited")
+	require.NoError(t, err)
+	assert.True(t, hasTag)
+}
+
+// taggedMetadata returns metadata with tag.
+func taggedMetadata(tag string) *Metadata {
+	meta := NewMetadata()
+	meta.AddTag(tag)
+	return meta
+}
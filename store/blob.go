@@ -0,0 +1,261 @@
+package store
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ErrNotBlob is returned when a blob operation targets a key that holds a regular value.
+var ErrNotBlob = errors.New("key does not hold a blob")
+
+// BlobBackend persists large binary payloads outside of the in-memory store.
+// The store only keeps a BlobRef for each blob, so multi-hundred-MB artifacts
+// can move between stages without being held in memory.
+type BlobBackend interface {
+	// Write streams the content of r into the blob identified by id and returns the number of bytes written.
+	Write(id string, r io.Reader) (int64, error)
+
+	// Open returns a reader over the content of the blob identified by id.
+	Open(id string) (io.ReadCloser, error)
+
+	// Remove deletes the blob identified by id.
+	Remove(id string) error
+}
+
+// BlobRef is the value stored under a key written with PutBlob.
+// It is a small, serializable handle pointing to the data held by the BlobBackend.
+type BlobRef struct {
+	ID   string `json:"id"`
+	Size int64  `json:"size"`
+}
+
+// FileBlobBackend is a BlobBackend that keeps each blob in its own file.
+type FileBlobBackend struct {
+	dir string
+}
+
+// NewFileBlobBackend creates a file-backed blob backend rooted at dir.
+// If dir is empty, a new temporary directory is created.
+func NewFileBlobBackend(dir string) (*FileBlobBackend, error) {
+	if dir == "" {
+		tmp, err := os.MkdirTemp("", "gostage-blobs-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create blob directory: %w", err)
+		}
+		dir = tmp
+	} else if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	return &FileBlobBackend{dir: dir}, nil
+}
+
+// Dir returns the directory where blobs are written.
+func (b *FileBlobBackend) Dir() string {
+	return b.dir
+}
+
+// Write implements BlobBackend.Write.
+// Content is written to a temporary file first and renamed into place once complete,
+// so readers never observe a partially written blob.
+func (b *FileBlobBackend) Write(id string, r io.Reader) (int64, error) {
+	tmp, err := os.CreateTemp(b.dir, id+".*.tmp")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create blob file: %w", err)
+	}
+
+	n, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return 0, fmt.Errorf("failed to write blob: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), b.path(id)); err != nil {
+		os.Remove(tmp.Name())
+		return 0, fmt.Errorf("failed to finalize blob: %w", err)
+	}
+	return n, nil
+}
+
+// Open implements BlobBackend.Open.
+func (b *FileBlobBackend) Open(id string) (io.ReadCloser, error) {
+	f, err := os.Open(b.path(id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to open blob: %w", err)
+	}
+	return f, nil
+}
+
+// Remove implements BlobBackend.Remove.
+func (b *FileBlobBackend) Remove(id string) error {
+	if err := os.Remove(b.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove blob: %w", err)
+	}
+	return nil
+}
+
+func (b *FileBlobBackend) path(id string) string {
+	return filepath.Join(b.dir, id+".blob")
+}
+
+// PrefixBlobBackend is a BlobBackend storing its blobs in another backend
+// under IDs starting with a prefix, so that several owners can share one
+// backend without seeing each other's blobs.
+type PrefixBlobBackend struct {
+	backend BlobBackend
+	prefix  string
+}
+
+// NewPrefixBlobBackend creates a backend storing the blob id in backend as prefix+id.
+func NewPrefixBlobBackend(backend BlobBackend, prefix string) *PrefixBlobBackend {
+	return &PrefixBlobBackend{backend: backend, prefix: prefix}
+}
+
+// Write implements BlobBackend.Write.
+func (b *PrefixBlobBackend) Write(id string, r io.Reader) (int64, error) {
+	return b.backend.Write(b.prefix+id, r)
+}
+
+// Open implements BlobBackend.Open.
+func (b *PrefixBlobBackend) Open(id string) (io.ReadCloser, error) {
+	return b.backend.Open(b.prefix + id)
+}
+
+// Remove implements BlobBackend.Remove.
+func (b *PrefixBlobBackend) Remove(id string) error {
+	return b.backend.Remove(b.prefix + id)
+}
+
+// SetBlobBackend configures the backend used by PutBlob and GetBlob.
+// Blobs written with a previous backend are not migrated.
+func (s *KVStore) SetBlobBackend(backend BlobBackend) {
+	if s.readOnly {
+		return
+	}
+	s.blobMu.Lock()
+	defer s.blobMu.Unlock()
+	s.blobs = backend
+}
+
+// blobBackend returns the configured backend, lazily creating a temp-file backend.
+func (s *KVStore) blobBackend() (BlobBackend, error) {
+	s.blobMu.Lock()
+	defer s.blobMu.Unlock()
+
+	if s.blobs == nil {
+		backend, err := NewFileBlobBackend("")
+		if err != nil {
+			return nil, err
+		}
+		s.blobs = backend
+	}
+	return s.blobs, nil
+}
+
+// PutBlob streams the content of r into the blob backend and stores a BlobRef under key.
+// If key already holds a blob, the previous content is removed once the new one is written.
+func (s *KVStore) PutBlob(key string, r io.Reader) error {
+	if key == "" {
+		return errors.New("key cannot be empty")
+	}
+	if s.readOnly {
+		return readOnlyError("put", key)
+	}
+	if !s.canWrite(key) {
+		return accessDenied("put", key)
+	}
+
+	backend, err := s.blobBackend()
+	if err != nil {
+		return err
+	}
+
+	id, err := newBlobID()
+	if err != nil {
+		return err
+	}
+
+	size, err := backend.Write(id, r)
+	if err != nil {
+		return err
+	}
+
+	previous, prevErr := Get[BlobRef](s, key)
+
+	meta := NewMetadata()
+	meta.SetProperty("blobSize", size)
+	if err := s.PutWithMetadata(key, BlobRef{ID: id, Size: size}, meta); err != nil {
+		backend.Remove(id)
+		return err
+	}
+
+	if prevErr == nil {
+		backend.Remove(previous.ID)
+	}
+	return nil
+}
+
+// GetBlob returns a reader over the blob stored under key.
+// The caller is responsible for closing the returned reader.
+func (s *KVStore) GetBlob(key string) (io.ReadCloser, error) {
+	ref, err := s.blobRef(key)
+	if err != nil {
+		return nil, err
+	}
+
+	backend, err := s.blobBackend()
+	if err != nil {
+		return nil, err
+	}
+	return backend.Open(ref.ID)
+}
+
+// DeleteBlob removes the key and the blob content it references.
+// Unlike Delete, it also releases the data held by the blob backend.
+func (s *KVStore) DeleteBlob(key string) error {
+	if s.readOnly {
+		return readOnlyError("delete", key)
+	}
+	if !s.canWrite(key) {
+		return accessDenied("delete", key)
+	}
+	ref, err := s.blobRef(key)
+	if err != nil {
+		return err
+	}
+
+	backend, err := s.blobBackend()
+	if err != nil {
+		return err
+	}
+
+	s.Delete(key)
+	return backend.Remove(ref.ID)
+}
+
+// blobRef fetches the BlobRef stored under key, mapping type mismatches to ErrNotBlob.
+func (s *KVStore) blobRef(key string) (BlobRef, error) {
+	ref, err := Get[BlobRef](s, key)
+	if errors.Is(err, ErrTypeMismatch) {
+		return BlobRef{}, fmt.Errorf("%w: %s", ErrNotBlob, key)
+	}
+	return ref, err
+}
+
+func newBlobID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate blob id: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,95 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlobRoundTrip(t *testing.T) {
+	s := NewKVStore()
+	backend, err := NewFileBlobBackend(t.TempDir())
+	assert.NoError(t, err)
+	s.SetBlobBackend(backend)
+
+	payload := bytes.Repeat([]byte("gostage"), 1024)
+	assert.NoError(t, s.PutBlob("artifact", bytes.NewReader(payload)))
+
+	ref, err := Get[BlobRef](s, "artifact")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(payload)), ref.Size)
+
+	rc, err := s.GetBlob("artifact")
+	assert.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, payload, data)
+
+	// Overwriting a blob releases the previous content
+	assert.NoError(t, s.PutBlob("artifact", strings.NewReader("small")))
+	_, err = backend.Open(ref.ID)
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	// DeleteBlob removes both the key and the file
+	newRef, _ := Get[BlobRef](s, "artifact")
+	assert.NoError(t, s.DeleteBlob("artifact"))
+	_, err = s.GetBlob("artifact")
+	assert.ErrorIs(t, err, ErrNotFound)
+	entries, _ := os.ReadDir(backend.Dir())
+	assert.Empty(t, entries, "blob %s should be removed", newRef.ID)
+}
+
+func TestBlobOnRegularValue(t *testing.T) {
+	s := NewKVStore()
+	s.Put("plain", "not a blob")
+
+	_, err := s.GetBlob("plain")
+	assert.ErrorIs(t, err, ErrNotBlob)
+}
+
+func TestBlobSharedWithClone(t *testing.T) {
+	s := NewKVStore()
+	backend, err := NewFileBlobBackend(t.TempDir())
+	assert.NoError(t, err)
+	s.SetBlobBackend(backend)
+	assert.NoError(t, s.PutBlob("artifact", strings.NewReader("shared")))
+
+	clone := s.Clone()
+	rc, err := clone.GetBlob("artifact")
+	assert.NoError(t, err)
+	defer rc.Close()
+	data, _ := io.ReadAll(rc)
+	assert.Equal(t, "shared", string(data))
+}
+
+func TestPrefixBlobBackend(t *testing.T) {
+	dir := t.TempDir()
+	shared, err := NewFileBlobBackend(dir)
+	assert.NoError(t, err)
+	teamA := NewPrefixBlobBackend(shared, "team-a.")
+	teamB := NewPrefixBlobBackend(shared, "team-b.")
+
+	_, err = teamA.Write("report", strings.NewReader("a"))
+	assert.NoError(t, err)
+	_, err = teamB.Write("report", strings.NewReader("b"))
+	assert.NoError(t, err)
+
+	reader, err := teamA.Open("report")
+	assert.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "a", string(data))
+
+	assert.NoError(t, teamA.Remove("report"))
+	_, err = teamA.Open("report")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = os.Stat(dir + "/team-b.report.blob")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+)
+
+// computeCall tracks an in-flight GetOrCompute computation for a key.
+type computeCall struct {
+	done  chan struct{}
+	value any
+	err   error
+}
+
+// GetOrCompute returns the value of type T stored under key, computing and storing it
+// if the key is missing or expired.
+// Concurrent callers asking for the same key share a single computation: only one of them
+// runs compute while the others wait for its result. Failed computations are not stored,
+// so a later call will retry.
+func GetOrCompute[T any](s *KVStore, key string, compute func() (T, error)) (result T, err error) {
+	result, err = Get[T](s, key)
+	if err == nil || !isMissing(err) {
+		return result, err
+	}
+
+	s.computeMu.Lock()
+	// Another caller may have stored the value while we were waiting for the lock
+	if value, err := Get[T](s, key); err == nil || !isMissing(err) {
+		s.computeMu.Unlock()
+		return value, err
+	}
+	if call, ok := s.computing[key]; ok {
+		s.computeMu.Unlock()
+		<-call.done
+		return computeResult[T](call)
+	}
+
+	call := &computeCall{done: make(chan struct{})}
+	if s.computing == nil {
+		s.computing = make(map[string]*computeCall)
+	}
+	s.computing[key] = call
+	s.computeMu.Unlock()
+
+	defer func() {
+		if r := recover(); r != nil {
+			call.err = fmt.Errorf("compute for key %s panicked: %v", key, r)
+		}
+		s.computeMu.Lock()
+		delete(s.computing, key)
+		s.computeMu.Unlock()
+		close(call.done)
+		result, err = computeResult[T](call)
+	}()
+
+	computed, computeErr := compute()
+	if computeErr == nil {
+		computeErr = s.Put(key, computed)
+	}
+	call.value, call.err = computed, computeErr
+	return computed, computeErr
+}
+
+// computeResult extracts the typed outcome of a finished computation.
+func computeResult[T any](call *computeCall) (T, error) {
+	var zero T
+	if call.err != nil {
+		return zero, call.err
+	}
+	value, ok := call.value.(T)
+	if !ok && call.value != nil {
+		return zero, fmt.Errorf("%w: computed value is %T", ErrTypeMismatch, call.value)
+	}
+	return value, nil
+}
+
+// isMissing reports whether err means the key has no usable value.
+func isMissing(err error) bool {
+	return errors.Is(err, ErrNotFound) || errors.Is(err, ErrExpired)
+}
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetOrComputeSingleFlight(t *testing.T) {
+	s := NewKVStore()
+	var calls int32
+
+	var wg sync.WaitGroup
+	results := make([]string, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, err := GetOrCompute(s, "manifest", func() (string, error) {
+				atomic.AddInt32(&calls, 1)
+				time.Sleep(20 * time.Millisecond)
+				return "v1", nil
+			})
+			assert.NoError(t, err)
+			results[i] = v
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	for _, r := range results {
+		assert.Equal(t, "v1", r)
+	}
+
+	stored, err := Get[string](s, "manifest")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", stored)
+}
+
+func TestGetOrComputeErrorNotCached(t *testing.T) {
+	s := NewKVStore()
+	boom := errors.New("boom")
+
+	_, err := GetOrCompute(s, "k", func() (int, error) { return 0, boom })
+	assert.ErrorIs(t, err, boom)
+	assert.Equal(t, 0, s.Count())
+
+	v, err := GetOrCompute(s, "k", func() (int, error) { return 7, nil })
+	assert.NoError(t, err)
+	assert.Equal(t, 7, v)
+}
+
+func TestGetOrComputeExistingValue(t *testing.T) {
+	s := NewKVStore()
+	s.Put("k", 3)
+
+	v, err := GetOrCompute(s, "k", func() (int, error) {
+		t.Fatal("compute should not run for an existing key")
+		return 0, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, v)
+
+	_, err = GetOrCompute(s, "k", func() (string, error) { return "", nil })
+	assert.ErrorIs(t, err, ErrTypeMismatch)
+}
+
+func TestGetOrComputePanic(t *testing.T) {
+	s := NewKVStore()
+	_, err := GetOrCompute(s, "k", func() (int, error) { panic("bad") })
+	assert.Error(t, err)
+
+	v, err := GetOrCompute(s, "k", func() (int, error) { return 1, nil })
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+}
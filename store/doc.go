@@ -10,7 +10,10 @@
 //   - Time-to-live (TTL) expiration for entries
 //   - JSON Schema support for type validation
 //   - Thread-safe operations with concurrency support
+//   - Lock-sharded stores for heavily concurrent workloads (NewConcurrent)
 //   - Deep cloning and copying between stores
+//   - Streaming blob storage for large payloads (PutBlob/GetBlob)
+//   - Streams of typed items with backpressure (PutStream/GetStream)
 //
 // Store Cloning and Copying:
 //
@@ -23,6 +26,9 @@
 //   - CopyFromWithOverwrite(): Similar to CopyFrom() but overwrites any existing
 //     entries in the destination that have the same keys as in the source
 //
+// Scope() layers an empty store over an existing one instead: it reads the
+// keys of the existing store and keeps its own writes, without copying it.
+//
 // All of these functions perform deep copying to ensure that no references are
 // shared between the original and new stores, maintaining proper isolation.
 package store
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"iter"
+	"strings"
+	"time"
+)
+
+// Range calls fn with each unexpired key starting with prefix and its value,
+// in no particular order, until fn returns false. Unlike ListKeys followed by
+// Get, it skips the other keys under the lock, finds each value once and
+// stops as soon as fn asks to.
+//
+// fn is called without the store locked, so it may read and write the store.
+// Keys put or deleted during the iteration may or may not be seen.
+func (s *KVStore) Range(prefix string, fn func(key string, value any) bool) {
+	s.rangeEntries(prefix, nil, fn)
+}
+
+// Iter returns an iterator over the unexpired keys starting with prefix whose
+// value is of type T, or implements T if it is an interface, and their values:
+//
+//	for key, order := range store.Iter[Order](s, "orders.") {
+//		...
+//	}
+//
+// It iterates as Range does, skipping the values of other types.
+func Iter[T any](s *KVStore, prefix string) iter.Seq2[string, T] {
+	return func(yield func(string, T) bool) {
+		isT := func(value any) bool {
+			_, ok := value.(T)
+			return ok
+		}
+		s.rangeEntries(prefix, isT, func(key string, value any) bool {
+			return yield(key, value.(T))
+		})
+	}
+}
+
+// rangeEntries calls fn with each unexpired key starting with prefix and its
+// value, if match accepts it, until fn returns false. The matching values of
+// a shard are copied under its read lock, so that fn runs with no lock held.
+// A scope then ranges over the entries it inherits and does not hide. It
+// returns false if fn stopped the iteration.
+func (s *KVStore) rangeEntries(prefix string, match func(value any) bool, fn func(key string, value any) bool) bool {
+	type item struct {
+		key   string
+		value any
+	}
+	observers := s.observers()
+	var batch []item
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.RLock()
+		if cap(batch) < len(sh.data) {
+			batch = make([]item, 0, len(sh.data))
+		}
+		now := time.Now()
+		for key, e := range sh.data {
+			if !strings.HasPrefix(key, prefix) || (e.expiresAt != nil && now.After(*e.expiresAt)) || (match != nil && !match(e.value)) || !s.canRead(key) {
+				continue
+			}
+			batch = append(batch, item{key, e.value})
+		}
+		sh.mu.RUnlock()
+
+		for _, it := range batch {
+			for _, observe := range observers {
+				observe(it.key, it.value)
+			}
+			s.recordGet(it.key)
+			if !fn(it.key, it.value) {
+				return false
+			}
+		}
+		clear(batch)
+		batch = batch[:0]
+	}
+
+	if s.parent == nil {
+		return true
+	}
+	return s.parent.rangeEntries(prefix, match, func(key string, value any) bool {
+		if _, owned := s.lookupOwn(key); owned || !s.canRead(key) {
+			return true
+		}
+		for _, observe := range observers {
+			observe(key, value)
+		}
+		s.recordGet(key)
+		return fn(key, value)
+	})
+}
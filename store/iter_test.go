@@ -0,0 +1,112 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type shape interface{ Area() float64 }
+
+type square struct{ Side float64 }
+
+func (s square) Area() float64 { return s.Side * s.Side }
+
+func TestRange(t *testing.T) {
+	for name, s := range map[string]*KVStore{"default": NewKVStore(), "concurrent": NewConcurrent()} {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 10; i++ {
+				require.NoError(t, s.Put(fmt.Sprintf("orders.%d", i), i))
+			}
+			require.NoError(t, s.Put("customers.1", "ada"))
+			require.NoError(t, s.PutWithTTL("orders.expired", 99, time.Nanosecond))
+			time.Sleep(time.Millisecond)
+
+			seen := map[string]any{}
+			s.Range("orders.", func(key string, value any) bool {
+				seen[key] = value
+				return true
+			})
+			assert.Len(t, seen, 10)
+			assert.Equal(t, 3, seen["orders.3"])
+
+			// Returning false stops the iteration
+			calls := 0
+			s.Range("", func(key string, value any) bool {
+				calls++
+				return false
+			})
+			assert.Equal(t, 1, calls)
+
+			// fn may write to the store
+			s.Range("orders.", func(key string, value any) bool {
+				assert.NoError(t, s.Put(strings.Replace(key, "orders.", "done.", 1), value))
+				return true
+			})
+			assert.Len(t, s.ListKeys(), 21)
+		})
+	}
+}
+
+func TestIter(t *testing.T) {
+	s := NewConcurrent()
+	require.NoError(t, s.Put("shapes.small", square{Side: 1}))
+	require.NoError(t, s.Put("shapes.large", square{Side: 3}))
+	require.NoError(t, s.Put("shapes.count", 2))
+	require.NoError(t, s.Put("other.square", square{Side: 2}))
+
+	var reads []string
+	stop := s.OnRead(func(key string, value any) { reads = append(reads, key) })
+	defer stop()
+
+	total := 0.0
+	for key, sq := range Iter[square](s, "shapes.") {
+		assert.True(t, strings.HasPrefix(key, "shapes."))
+		total += sq.Area()
+	}
+	assert.Equal(t, 10.0, total)
+	assert.ElementsMatch(t, []string{"shapes.small", "shapes.large"}, reads)
+
+	// Interfaces match the values implementing them
+	areas := 0.0
+	for _, sh := range Iter[shape](s, "") {
+		areas += sh.Area()
+	}
+	assert.Equal(t, 14.0, areas)
+
+	for range Iter[int](s, "shapes.") {
+		break
+	}
+}
+
+func BenchmarkScan(b *testing.B) {
+	s := NewKVStore()
+	for i := 0; i < 10000; i++ {
+		_ = s.Put(fmt.Sprintf("items.%d", i), i)
+	}
+
+	b.Run("ListKeys+Get", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sum := 0
+			for _, key := range s.ListKeys() {
+				if v, err := Get[int](s, key); err == nil {
+					sum += v
+				}
+			}
+		}
+	})
+	b.Run("Iter", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sum := 0
+			for _, v := range Iter[int](s, "items.") {
+				sum += v
+			}
+		}
+	})
+}
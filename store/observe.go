@@ -0,0 +1,50 @@
+package store
+
+// readObservers holds the functions called on every read of a store.
+type readObservers struct {
+	next int
+	fns  map[int]func(key string, value any)
+}
+
+// OnRead calls fn with the key and stored value each time Get reads an
+// existing key, until the returned function is called. A read is reported
+// even if the value turns out to have another type than requested. fn may be
+// called from several goroutines at once.
+func (s *KVStore) OnRead(fn func(key string, value any)) (stop func()) {
+	s.observersMu.Lock()
+	defer s.observersMu.Unlock()
+
+	if s.readers.fns == nil {
+		s.readers.fns = make(map[int]func(key string, value any))
+	}
+	id := s.readers.next
+	s.readers.next++
+	s.readers.fns[id] = fn
+
+	return func() {
+		s.observersMu.Lock()
+		defer s.observersMu.Unlock()
+		delete(s.readers.fns, id)
+	}
+}
+
+// notifyRead reports a read to the observers of the store.
+func (s *KVStore) notifyRead(key string, value any) {
+	for _, fn := range s.observers() {
+		fn(key, value)
+	}
+}
+
+// observers returns the functions registered with OnRead.
+func (s *KVStore) observers() []func(key string, value any) {
+	s.observersMu.RLock()
+	defer s.observersMu.RUnlock()
+	if len(s.readers.fns) == 0 {
+		return nil
+	}
+	fns := make([]func(key string, value any), 0, len(s.readers.fns))
+	for _, fn := range s.readers.fns {
+		fns = append(fns, fn)
+	}
+	return fns
+}
@@ -0,0 +1,33 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnRead(t *testing.T) {
+	s := NewKVStore()
+	require.NoError(t, s.Put("region", "eu-west-1"))
+	require.NoError(t, s.Put("replicas", 3))
+
+	reads := map[string]any{}
+	stop := s.OnRead(func(key string, value any) {
+		reads[key] = value
+	})
+
+	_, err := Get[string](s, "region")
+	require.NoError(t, err)
+	_, err = Get[string](s, "replicas")
+	assert.ErrorIs(t, err, ErrTypeMismatch)
+	_, err = Get[string](s, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, map[string]any{"region": "eu-west-1", "replicas": 3}, reads)
+
+	stop()
+	require.NoError(t, s.Put("region", "us-east-1"))
+	_, err = Get[string](s, "region")
+	require.NoError(t, err)
+	assert.Equal(t, "eu-west-1", reads["region"])
+}
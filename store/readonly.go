@@ -0,0 +1,33 @@
+package store
+
+import "fmt"
+
+// ReadOnlyView returns a view of the store that reads the same entries but
+// cannot change them, to hand to code that must not mutate the store. Its
+// writes fail with ErrReadOnly, except Delete which returns false, and Clear
+// and SetBlobBackend which do nothing. GetMetadata returns copies of the
+// metadata. Writes to the store itself show through the view.
+func (s *KVStore) ReadOnlyView() *KVStore {
+	return &KVStore{kvState: s.kvState, readOnly: true, restricted: s.restricted, callerTags: s.callerTags}
+}
+
+// ReadOnly reports whether s is a view of ReadOnlyView.
+func (s *KVStore) ReadOnly() bool {
+	return s.readOnly
+}
+
+// readOnlyError is the error of a write to key through a read-only view.
+func readOnlyError(op, key string) error {
+	return fmt.Errorf("cannot %s key %s: %w", op, key, ErrReadOnly)
+}
+
+// copyMetadata returns a copy of m that shares no tags or properties with it.
+func copyMetadata(m *Metadata) *Metadata {
+	meta := *m
+	meta.Tags = append([]string{}, m.Tags...)
+	meta.Properties = make(map[string]interface{}, len(m.Properties))
+	for k, v := range m.Properties {
+		meta.Properties[k] = v
+	}
+	return &meta
+}
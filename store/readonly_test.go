@@ -0,0 +1,55 @@
+package store
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadOnlyView(t *testing.T) {
+	s := NewConcurrent()
+	meta := NewMetadata()
+	meta.AddTag("config")
+	require.NoError(t, s.PutWithMetadata("region", "eu-west-1", meta))
+
+	view := s.ReadOnlyView()
+	assert.True(t, view.ReadOnly())
+	assert.False(t, s.ReadOnly())
+
+	region, err := Get[string](view, "region")
+	require.NoError(t, err)
+	assert.Equal(t, "eu-west-1", region)
+	assert.Equal(t, []string{"region"}, view.FindKeysByTag("config"))
+
+	// Writes fail and leave the store unchanged
+	assert.ErrorIs(t, view.Put("region", "us-east-1"), ErrReadOnly)
+	assert.ErrorIs(t, view.UpdateField("region", "Name", "x"), ErrReadOnly)
+	assert.ErrorIs(t, view.AddTag("region", "changed"), ErrReadOnly)
+	assert.ErrorIs(t, view.SetProperty("region", "owner", "me"), ErrReadOnly)
+	assert.ErrorIs(t, view.PutBlob("blob", strings.NewReader("data")), ErrReadOnly)
+	_, err = view.CopyFrom(NewKVStore())
+	assert.ErrorIs(t, err, ErrReadOnly)
+	_, err = GetOrCompute(view, "computed", func() (int, error) { return 1, nil })
+	assert.ErrorIs(t, err, ErrReadOnly)
+	assert.False(t, view.Delete("region"))
+	view.Clear()
+
+	viewMeta, err := view.GetMetadata("region")
+	require.NoError(t, err)
+	viewMeta.AddTag("changed")
+	hasTag, err := s.HasTag("region", "changed")
+	require.NoError(t, err)
+	assert.False(t, hasTag)
+
+	region, err = Get[string](s, "region")
+	require.NoError(t, err)
+	assert.Equal(t, "eu-west-1", region)
+
+	// Writes to the store show through the view
+	require.NoError(t, s.Put("zone", "b"))
+	zone, err := Get[string](view, "zone")
+	require.NoError(t, err)
+	assert.Equal(t, "b", zone)
+}
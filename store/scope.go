@@ -0,0 +1,93 @@
+package store
+
+import "time"
+
+// Scope returns an empty store layered over s, for work that needs keys of
+// its own on top of a store without copying it, such as the items of a loop.
+// Reading a key the scope does not hold reads it from s. Writes stay in the
+// scope: they add keys to it, and changing the value or metadata of a key of
+// s first copies the key into the scope. Keys of s cannot be deleted through
+// the scope. Listing, searching, exporting and cloning the scope see the keys
+// of both, the keys of the scope hiding those of s.
+//
+// The scope has the access policy and blob backend of s, and only sees the
+// keys of s that s may read when s is a view.
+func (s *KVStore) Scope() *KVStore {
+	scope := newKVStore(1)
+	scope.parent = s
+	s.blobMu.Lock()
+	scope.blobs = s.blobs
+	s.blobMu.Unlock()
+	scope.policy.Store(s.policy.Load())
+	return scope
+}
+
+// Owns reports whether the store holds key itself, rather than inheriting it
+// from the store it is a scope of.
+func (s *KVStore) Owns(key string) bool {
+	e, ok := s.lookupOwn(key)
+	return ok && (e.expiresAt == nil || time.Now().Before(*e.expiresAt))
+}
+
+// inherited returns the entry of key in the store s is a scope of, if any.
+func (s *KVStore) inherited(key string) (entry, bool) {
+	if s.parent == nil || !s.parent.canRead(key) {
+		return entry{}, false
+	}
+	return s.parent.lookup(key)
+}
+
+// own returns the entry of key held by s, copying it from the store s is a
+// scope of if s does not hold it yet. The caller must hold the write lock of
+// sh, the shard of key.
+func (s *KVStore) own(sh *shard, key string) (entry, bool) {
+	if e, ok := sh.data[key]; ok {
+		return e, true
+	}
+	e, ok := s.inherited(key)
+	if !ok {
+		return entry{}, false
+	}
+	e.value = deepCopy(e.value)
+	if e.metadata != nil {
+		e.metadata = copyMetadata(e.metadata)
+	}
+	sh.data[key] = e
+	return e, true
+}
+
+// flattened returns s, or a clone of s holding the keys it inherits if s is
+// a scope, for operations walking the entries of s under its locks.
+func (s *KVStore) flattened() *KVStore {
+	if s.parent == nil {
+		return s
+	}
+	return s.Clone()
+}
+
+// cloneScope clones a scope: the keys it may read from the store it is a
+// scope of, overridden by copies of its own keys.
+func (s *KVStore) cloneScope() *KVStore {
+	clone := s.parent.Clone()
+	for _, key := range clone.ListKeys() {
+		if !s.canRead(key) {
+			clone.Delete(key)
+		}
+	}
+	clone.policy.Store(s.policy.Load())
+
+	s.rlockAll()
+	defer s.runlockAll()
+	now := time.Now()
+	for key, e := range s.all() {
+		if !s.canRead(key) || (e.expiresAt != nil && now.After(*e.expiresAt)) {
+			continue
+		}
+		e.value = deepCopy(e.value)
+		if e.metadata != nil {
+			e.metadata = copyMetadata(e.metadata)
+		}
+		clone.shard(key).data[key] = e
+	}
+	return clone
+}
@@ -0,0 +1,97 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type scopeConfig struct {
+	Retries int
+}
+
+func TestScope(t *testing.T) {
+	s := NewKVStore()
+	require.NoError(t, s.Put("domain", "example.com"))
+	require.NoError(t, s.Put("config", scopeConfig{Retries: 3}))
+	require.NoError(t, s.Put("shared", "base"))
+
+	scope := s.Scope()
+	require.NoError(t, scope.Put("item", "api"))
+	require.NoError(t, scope.Put("shared", "scoped"))
+
+	// Reads fall through to the store, the scope's own keys hiding its keys
+	domain, err := Get[string](scope, "domain")
+	require.NoError(t, err)
+	assert.Equal(t, "example.com", domain)
+	shared, err := Get[string](scope, "shared")
+	require.NoError(t, err)
+	assert.Equal(t, "scoped", shared)
+	assert.True(t, scope.Owns("item"))
+	assert.False(t, scope.Owns("domain"))
+
+	// Listings see the keys of both
+	assert.ElementsMatch(t, []string{"domain", "config", "shared", "item"}, scope.ListKeys())
+	assert.Equal(t, 4, scope.Count())
+	assert.Equal(t, map[string]interface{}{
+		"domain": "example.com",
+		"config": scopeConfig{Retries: 3},
+		"shared": "scoped",
+		"item":   "api",
+	}, scope.ExportAll())
+	assert.ElementsMatch(t, []string{"domain", "config", "shared", "item"}, keysOf(scope))
+
+	// Writes, metadata changes and deletes leave the store untouched
+	require.NoError(t, scope.UpdateField("config", "Retries", 5))
+	assert.False(t, scope.Delete("domain"))
+	require.NoError(t, scope.AddTag("domain", "scoped"))
+	assert.True(t, scope.Owns("config"))
+	config, err := Get[scopeConfig](s, "config")
+	require.NoError(t, err)
+	assert.Equal(t, 3, config.Retries)
+	hasTag, err := s.HasTag("domain", "scoped")
+	require.NoError(t, err)
+	assert.False(t, hasTag)
+	hasTag, err = scope.HasTag("domain", "scoped")
+	require.NoError(t, err)
+	assert.True(t, hasTag)
+	assert.ElementsMatch(t, []string{"domain", "config", "shared"}, s.ListKeys())
+
+	// The store's later writes are seen by the scope
+	require.NoError(t, s.Put("later", true))
+	later, err := Get[bool](scope, "later")
+	require.NoError(t, err)
+	assert.True(t, later)
+
+	// Clones and copies of the scope hold the keys of both
+	clone := scope.Clone()
+	assert.Equal(t, 5, clone.Count())
+	shared, err = Get[string](clone, "shared")
+	require.NoError(t, err)
+	assert.Equal(t, "scoped", shared)
+	copied := NewKVStore()
+	n, err := copied.CopyFrom(scope)
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+}
+
+func TestScopeAccessPolicy(t *testing.T) {
+	s := NewKVStore()
+	require.NoError(t, s.SetAccessPolicy(AccessRule{Pattern: "secret.*", Read: []string{"ops"}}))
+	require.NoError(t, s.Put("secret.token", "abc"))
+	require.NoError(t, s.Put("public.name", "orders"))
+
+	// Scopes keep the policy of the store and the restrictions of its views
+	scope := s.Scope()
+	_, err := Get[string](scope.AccessAs(), "secret.token")
+	assert.ErrorIs(t, err, ErrAccessDenied)
+	token, err := Get[string](scope.AccessAs("ops"), "secret.token")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", token)
+
+	restricted := s.AccessAs().Scope()
+	_, err = Get[string](restricted, "secret.token")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, []string{"public.name"}, restricted.ListKeys())
+}
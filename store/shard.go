@@ -0,0 +1,143 @@
+package store
+
+import (
+	"hash/maphash"
+	"iter"
+	"sync"
+	"time"
+)
+
+// concurrentShards is the number of shards of a store created by NewConcurrent.
+const concurrentShards = 64
+
+// shard holds the entries of the keys hashing to it, behind its own lock.
+type shard struct {
+	mu   sync.RWMutex
+	data map[string]entry
+	// pad keeps shards on separate cache lines, so that goroutines locking
+	// neighbouring shards do not slow each other down
+	_ [32]byte
+}
+
+// NewConcurrent constructs an empty store optimized for many goroutines
+// reading and writing at once, as the actions of parallel stages do. Its keys
+// are spread over shards with their own locks, so that operations on
+// different keys rarely wait for each other. It behaves as a store of
+// NewKVStore otherwise, except that scans such as ListKeys or FindKeysByTag
+// see each shard at a time rather than the whole store at once.
+func NewConcurrent() *KVStore {
+	return newKVStore(concurrentShards)
+}
+
+// newKVStore constructs an empty store of n shards, n being a power of two.
+func newKVStore(n int) *KVStore {
+	s := &KVStore{kvState: &kvState{shards: make([]shard, n), seed: maphash.MakeSeed()}}
+	for i := range s.shards {
+		s.shards[i].data = make(map[string]entry)
+	}
+	return s
+}
+
+// shard returns the shard holding key.
+func (s *KVStore) shard(key string) *shard {
+	if len(s.shards) == 1 {
+		return &s.shards[0]
+	}
+	return &s.shards[maphash.String(s.seed, key)&uint64(len(s.shards)-1)]
+}
+
+// lookup returns the entry of key, expired or not, inherited from the store
+// s is a scope of if s does not hold it.
+func (s *KVStore) lookup(key string) (entry, bool) {
+	if e, ok := s.lookupOwn(key); ok {
+		return e, true
+	}
+	return s.inherited(key)
+}
+
+// lookupOwn returns the entry of key held by s, expired or not.
+func (s *KVStore) lookupOwn(key string) (entry, bool) {
+	sh := s.shard(key)
+	sh.mu.RLock()
+	e, ok := sh.data[key]
+	sh.mu.RUnlock()
+	return e, ok
+}
+
+// scan calls fn with each unexpired entry, holding the read lock of its
+// shard. The entries a scope inherits and does not hide come last, and are
+// passed with no lock held.
+func (s *KVStore) scan(fn func(key string, e entry)) {
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.RLock()
+		now := time.Now()
+		for key, e := range sh.data {
+			if (e.expiresAt != nil && now.After(*e.expiresAt)) || !s.canRead(key) {
+				continue
+			}
+			fn(key, e)
+		}
+		sh.mu.RUnlock()
+	}
+	if s.parent == nil {
+		return
+	}
+
+	// The inherited entries are collected first, so that the locks of the
+	// scope are never taken while holding those of its parent
+	type keyEntry struct {
+		key string
+		e   entry
+	}
+	var inherited []keyEntry
+	s.parent.scan(func(key string, e entry) {
+		inherited = append(inherited, keyEntry{key, e})
+	})
+	for _, it := range inherited {
+		if _, owned := s.lookupOwn(it.key); !owned && s.canRead(it.key) {
+			fn(it.key, it.e)
+		}
+	}
+}
+
+// lockAll locks every shard for writing, in order, for operations that must
+// see and change the whole store at once.
+func (s *KVStore) lockAll() {
+	for i := range s.shards {
+		s.shards[i].mu.Lock()
+	}
+}
+
+func (s *KVStore) unlockAll() {
+	for i := range s.shards {
+		s.shards[i].mu.Unlock()
+	}
+}
+
+// rlockAll locks every shard for reading, in order.
+func (s *KVStore) rlockAll() {
+	for i := range s.shards {
+		s.shards[i].mu.RLock()
+	}
+}
+
+func (s *KVStore) runlockAll() {
+	for i := range s.shards {
+		s.shards[i].mu.RUnlock()
+	}
+}
+
+// all iterates over every entry, expired or not, while the caller holds the
+// locks of all shards.
+func (s *KVStore) all() iter.Seq2[string, entry] {
+	return func(yield func(string, entry) bool) {
+		for i := range s.shards {
+			for key, e := range s.shards[i].data {
+				if !yield(key, e) {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrentStore(t *testing.T) {
+	s := NewConcurrent()
+	for i := 0; i < 200; i++ {
+		meta := NewMetadata()
+		if i%2 == 0 {
+			meta.AddTag("even")
+		}
+		require.NoError(t, s.PutWithMetadata(fmt.Sprintf("key-%03d", i), i, meta))
+	}
+	require.NoError(t, s.Put("name", "orders"))
+
+	value, err := Get[int](s, "key-042")
+	require.NoError(t, err)
+	assert.Equal(t, 42, value)
+	_, err = Get[string](s, "key-042")
+	assert.ErrorIs(t, err, ErrTypeMismatch)
+
+	assert.Equal(t, 201, s.Count())
+	assert.Len(t, KeysByType[int](s), 200)
+	assert.Len(t, s.FindKeysByTag("even"), 100)
+	assert.ElementsMatch(t, []string{"int", "string"}, s.ListTypes())
+
+	assert.True(t, s.Delete("key-000"))
+	assert.False(t, s.Delete("key-000"))
+	assert.Equal(t, 200, s.Count())
+
+	// Clones and copies keep every entry, whatever the shards of either store
+	clone := s.Clone()
+	assert.Equal(t, 200, clone.Count())
+	copied := NewKVStore()
+	n, err := copied.CopyFrom(s)
+	require.NoError(t, err)
+	assert.Equal(t, 200, n)
+	back := NewConcurrent()
+	collisions, err := back.Merge(copied, Error)
+	require.NoError(t, err)
+	assert.Empty(t, collisions)
+
+	keys := back.ListKeys()
+	sort.Strings(keys)
+	assert.Equal(t, "key-001", keys[0])
+	assert.Len(t, back.FindKeyCollisions(s), 200)
+
+	back.Clear()
+	assert.Equal(t, 0, back.Count())
+}
+
+func TestConcurrentStoreParallelAccess(t *testing.T) {
+	s := NewConcurrent()
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				key := fmt.Sprintf("worker-%d-%d", w, i%50)
+				assert.NoError(t, s.Put(key, i))
+				_, err := Get[int](s, key)
+				assert.NoError(t, err)
+				assert.NoError(t, s.SetProperty(key, "worker", w))
+				if i%100 == 0 {
+					s.ListKeys()
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	assert.Equal(t, 400, s.Count())
+	assert.Len(t, s.FindKeysByProperty("worker", 3), 50)
+}
+
+// benchmarkStore measures a mix of nine reads for each write from parallel goroutines.
+func benchmarkStore(b *testing.B, s *KVStore) {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+		if err := s.Put(keys[i], i); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := keys[i%len(keys)]
+			if i%10 == 0 {
+				_ = s.Put(key, i)
+			} else {
+				_, _ = Get[int](s, key)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkStore(b *testing.B) {
+	b.Run("default", func(b *testing.B) { benchmarkStore(b, NewKVStore()) })
+	b.Run("concurrent", func(b *testing.B) { benchmarkStore(b, NewConcurrent()) })
+}
@@ -0,0 +1,207 @@
+package store
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// KeyStats describes how a key was used while its store tracked statistics.
+type KeyStats struct {
+	Key string `json:"key"`
+	// Gets counts the reads of the key by Get, Range and Iter
+	Gets int64 `json:"gets"`
+	// Puts counts the writes of the key by Put and UpdateField
+	Puts    int64 `json:"puts"`
+	Deletes int64 `json:"deletes,omitempty"`
+	// Size is the approximate size in bytes of the last value put
+	Size int `json:"size"`
+	// Accessors lists, sorted, the accessors set with SetStatsAccessor when
+	// the key was read or written, such as the actions of a run
+	Accessors []string `json:"accessors,omitempty"`
+}
+
+// storeStats collects the KeyStats of a store.
+type storeStats struct {
+	mu        sync.Mutex
+	accessor  string
+	keys      map[string]*KeyStats
+	accessors map[string]map[string]bool
+}
+
+// TrackStats starts counting the reads and writes of each key, resetting the
+// statistics of a previous tracking, until the returned function is called.
+// Tracking serializes the accesses to the store, so it is meant for finding
+// hot keys rather than to be left on.
+func (s *KVStore) TrackStats() (stop func()) {
+	st := &storeStats{keys: make(map[string]*KeyStats), accessors: make(map[string]map[string]bool)}
+	s.statsMu.Lock()
+	s.collected = st
+	s.statsMu.Unlock()
+	s.tracking.Store(st)
+
+	return func() {
+		s.tracking.CompareAndSwap(st, nil)
+	}
+}
+
+// SetStatsAccessor names who the following reads and writes are credited to,
+// none if accessor is empty. It holds for the whole store, so accesses from
+// goroutines running at the same time are credited to the latest accessor.
+func (s *KVStore) SetStatsAccessor(accessor string) {
+	if st := s.tracking.Load(); st != nil {
+		st.mu.Lock()
+		st.accessor = accessor
+		st.mu.Unlock()
+	}
+}
+
+// Stats returns the statistics of the keys accessed during the last tracking,
+// the most accessed first.
+func (s *KVStore) Stats() []KeyStats {
+	s.statsMu.Lock()
+	st := s.collected
+	s.statsMu.Unlock()
+	if st == nil {
+		return nil
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	out := make([]KeyStats, 0, len(st.keys))
+	for key, ks := range st.keys {
+		stats := *ks
+		for accessor := range st.accessors[key] {
+			stats.Accessors = append(stats.Accessors, accessor)
+		}
+		sort.Strings(stats.Accessors)
+		out = append(out, stats)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if a, b := out[i].Gets+out[i].Puts+out[i].Deletes, out[j].Gets+out[j].Puts+out[j].Deletes; a != b {
+			return a > b
+		}
+		return out[i].Key < out[j].Key
+	})
+	return out
+}
+
+func (s *KVStore) recordGet(key string) {
+	if st := s.tracking.Load(); st != nil {
+		st.record(key, func(ks *KeyStats) { ks.Gets++ })
+	}
+}
+
+func (s *KVStore) recordPut(key string, value any) {
+	if st := s.tracking.Load(); st != nil {
+		size := approxSize(value)
+		st.record(key, func(ks *KeyStats) {
+			ks.Puts++
+			ks.Size = size
+		})
+	}
+}
+
+func (s *KVStore) recordDelete(key string) {
+	if st := s.tracking.Load(); st != nil {
+		st.record(key, func(ks *KeyStats) { ks.Deletes++ })
+	}
+}
+
+// record updates the statistics of key and credits it to the current accessor.
+func (st *storeStats) record(key string, update func(*KeyStats)) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	ks, ok := st.keys[key]
+	if !ok {
+		ks = &KeyStats{Key: key}
+		st.keys[key] = ks
+	}
+	update(ks)
+	if st.accessor != "" {
+		if st.accessors[key] == nil {
+			st.accessors[key] = make(map[string]bool)
+		}
+		st.accessors[key][st.accessor] = true
+	}
+}
+
+// approxSize estimates the memory held by value: its own size and that of the
+// strings, slices, maps and pointers it references, each counted once.
+func approxSize(value any) int {
+	if value == nil {
+		return 0
+	}
+	v := reflect.ValueOf(value)
+	return int(v.Type().Size()) + referencedSize(v, make(map[uintptr]bool), 0)
+}
+
+// referencedSize returns the size of the memory referenced by v, beyond v itself.
+func referencedSize(v reflect.Value, seen map[uintptr]bool, depth int) int {
+	if depth > 32 {
+		return 0
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.Len()
+	case reflect.Pointer:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		return int(v.Type().Elem().Size()) + referencedSize(v.Elem(), seen, depth+1)
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		return int(v.Elem().Type().Size()) + referencedSize(v.Elem(), seen, depth+1)
+	case reflect.Slice:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		size := v.Cap() * int(v.Type().Elem().Size())
+		for i := 0; i < v.Len() && references(v.Type().Elem()); i++ {
+			size += referencedSize(v.Index(i), seen, depth+1)
+		}
+		return size
+	case reflect.Array:
+		size := 0
+		for i := 0; i < v.Len() && references(v.Type().Elem()); i++ {
+			size += referencedSize(v.Index(i), seen, depth+1)
+		}
+		return size
+	case reflect.Map:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		size := 0
+		iter := v.MapRange()
+		for iter.Next() {
+			size += int(v.Type().Key().Size()+v.Type().Elem().Size()) + referencedSize(iter.Key(), seen, depth+1) + referencedSize(iter.Value(), seen, depth+1)
+		}
+		return size
+	case reflect.Struct:
+		size := 0
+		for i := 0; i < v.NumField(); i++ {
+			size += referencedSize(v.Field(i), seen, depth+1)
+		}
+		return size
+	default:
+		return 0
+	}
+}
+
+// references reports whether values of type t may reference other memory.
+func references(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,65 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	s := NewKVStore()
+	require.NoError(t, s.Put("untracked", 1))
+	assert.Nil(t, s.Stats())
+
+	stop := s.TrackStats()
+	s.SetStatsAccessor("loader")
+	require.NoError(t, s.Put("rows", []string{"a", "bb"}))
+	require.NoError(t, s.Put("count", 2))
+	s.SetStatsAccessor("reporter")
+	for i := 0; i < 3; i++ {
+		_, err := Get[[]string](s, "rows")
+		require.NoError(t, err)
+	}
+	s.Range("co", func(key string, value any) bool { return true })
+	s.SetStatsAccessor("")
+	assert.True(t, s.Delete("count"))
+	_, err := Get[int](s, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+	stop()
+
+	// Accesses after stop are not counted
+	_, err = Get[[]string](s, "rows")
+	require.NoError(t, err)
+
+	stats := s.Stats()
+	require.Len(t, stats, 2)
+	assert.Equal(t, "rows", stats[0].Key)
+	assert.Equal(t, int64(3), stats[0].Gets)
+	assert.Equal(t, int64(1), stats[0].Puts)
+	assert.Equal(t, []string{"loader", "reporter"}, stats[0].Accessors)
+	// The slice header, two string headers and three bytes
+	assert.Equal(t, 24+2*16+3, stats[0].Size)
+
+	assert.Equal(t, KeyStats{Key: "count", Gets: 1, Puts: 1, Deletes: 1, Size: 8, Accessors: []string{"loader", "reporter"}}, stats[1])
+
+	// Tracking again starts over
+	s.TrackStats()
+	assert.Empty(t, s.Stats())
+}
+
+func TestApproxSize(t *testing.T) {
+	type node struct {
+		Name string
+		Next *node
+	}
+	loop := &node{Name: "a"}
+	loop.Next = loop
+
+	assert.Equal(t, 0, approxSize(nil))
+	assert.Equal(t, 16+5, approxSize("hello"))
+	assert.Equal(t, 24+1024, approxSize(make([]byte, 1024)))
+	// Cycles are counted once
+	assert.Equal(t, 8+24+1, approxSize(loop))
+	assert.Greater(t, approxSize(map[string]int{"a": 1, "b": 2}), 2*(16+8))
+}
@@ -4,9 +4,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/maphash"
 	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/invopop/jsonschema"
@@ -14,13 +16,51 @@ import (
 
 // KVStore is a threadsafe, type‑aware in‑memory store.
 type KVStore struct {
-	mu   sync.RWMutex
-	data map[string]entry
+	*kvState
+
+	// readOnly is set on the views of ReadOnlyView, which share the state of
+	// their store
+	readOnly bool
+
+	// restricted is set on the views of AccessAs, whose caller has callerTags
+	restricted bool
+	callerTags []string
+}
+
+// kvState is the state of a store, shared with its read-only views.
+type kvState struct {
+	// shards hold the entries, a single one for stores of NewKVStore
+	shards []shard
+	seed   maphash.Seed
+
+	// blobMu guards blobs
+	blobMu sync.Mutex
+	blobs  BlobBackend
+
+	// computeMu guards computing, the in-flight GetOrCompute calls by key
+	computeMu sync.Mutex
+	computing map[string]*computeCall
+
+	// observersMu guards readers, the functions registered with OnRead
+	observersMu sync.RWMutex
+	readers     readObservers
+
+	// policy holds the rules set with SetAccessPolicy
+	policy atomic.Pointer[accessPolicy]
+
+	// tracking holds the statistics being collected since TrackStats, and
+	// collected, guarded by statsMu, those of the last tracking
+	tracking  atomic.Pointer[storeStats]
+	statsMu   sync.Mutex
+	collected *storeStats
+
+	// parent is the store a store of Scope is layered over
+	parent *KVStore
 }
 
 // NewKVStore constructs an empty store.
 func NewKVStore() *KVStore {
-	return &KVStore{data: make(map[string]entry)}
+	return newKVStore(1)
 }
 
 // Put stores any Go value under key, capturing its concrete type.
@@ -44,6 +84,14 @@ func (s *KVStore) PutWithTTLAndMetadata(key string, value any, ttl time.Duration
 	if key == "" {
 		return errors.New("key cannot be empty")
 	}
+	if s.readOnly {
+		return readOnlyError("put", key)
+	}
+	if !s.canWrite(key) {
+		return accessDenied("put", key)
+	}
+
+	sh := s.shard(key)
 
 	// Special handling for nil values
 	if value == nil {
@@ -58,24 +106,25 @@ func (s *KVStore) PutWithTTLAndMetadata(key string, value any, ttl time.Duration
 		if metadata != nil {
 			meta = metadata
 		} else {
-			s.mu.RLock()
-			if existingEntry, exists := s.data[key]; exists && existingEntry.metadata != nil {
+			sh.mu.RLock()
+			if existingEntry, exists := sh.data[key]; exists && existingEntry.metadata != nil {
 				meta = existingEntry.metadata
 				// Update the UpdatedAt timestamp
 				meta.UpdatedAt = time.Now()
 			}
-			s.mu.RUnlock()
+			sh.mu.RUnlock()
 		}
 
-		s.mu.Lock()
-		s.data[key] = entry{
+		sh.mu.Lock()
+		sh.data[key] = entry{
 			typ:       nil,
 			typeKind:  reflect.Invalid,
 			value:     nil,
 			expiresAt: expiresAt,
 			metadata:  meta,
 		}
-		s.mu.Unlock()
+		sh.mu.Unlock()
+		s.recordPut(key, nil)
 		return nil
 	}
 
@@ -94,38 +143,26 @@ func (s *KVStore) PutWithTTLAndMetadata(key string, value any, ttl time.Duration
 		meta = metadata
 	}
 
-	s.mu.Lock()
+	sh.mu.Lock()
 	// If entry already exists and has metadata, preserve it unless new metadata is provided
-	if existingEntry, exists := s.data[key]; exists && existingEntry.metadata != nil && metadata == nil {
+	if existingEntry, exists := sh.data[key]; exists && existingEntry.metadata != nil && metadata == nil {
 		meta = existingEntry.metadata
 		// Update the UpdatedAt timestamp
 		meta.UpdatedAt = time.Now()
 	}
 	// Store the actual value directly - no serialization
-	s.data[key] = entry{typ: t, typeKind: k, value: value, expiresAt: expiresAt, metadata: meta}
-	s.mu.Unlock()
+	sh.data[key] = entry{typ: t, typeKind: k, value: value, expiresAt: expiresAt, metadata: meta}
+	sh.mu.Unlock()
+	s.recordPut(key, value)
 	return nil
 }
 
 // Get retrieves a value of type T for the given key.
 func Get[T any](s *KVStore, key string) (T, error) {
 	var zero T
-	if key == "" {
-		return zero, errors.New("key cannot be empty")
-	}
-
-	s.mu.RLock()
-	e, ok := s.data[key]
-	s.mu.RUnlock()
-
-	if !ok {
-		return zero, ErrNotFound
-	}
-
-	// Check if the entry has expired
-	if e.expiresAt != nil && time.Now().After(*e.expiresAt) {
-		s.Delete(key)
-		return zero, ErrExpired
+	e, err := s.read(key)
+	if err != nil {
+		return zero, err
 	}
 
 	// Get the requested type
@@ -170,6 +207,41 @@ func Get[T any](s *KVStore, key string) (T, error) {
 	return result, nil
 }
 
+// GetValue retrieves the value of key whatever its type, for callers that
+// handle any value, such as scripts and serializers.
+func (s *KVStore) GetValue(key string) (any, error) {
+	e, err := s.read(key)
+	if err != nil {
+		return nil, err
+	}
+	return e.value, nil
+}
+
+// read returns the unexpired entry of key, notifying the observers of the read.
+func (s *KVStore) read(key string) (entry, error) {
+	if key == "" {
+		return entry{}, errors.New("key cannot be empty")
+	}
+	if !s.canRead(key) {
+		return entry{}, accessDenied("get", key)
+	}
+
+	e, ok := s.lookup(key)
+
+	if !ok {
+		return entry{}, ErrNotFound
+	}
+
+	// Check if the entry has expired
+	if e.expiresAt != nil && time.Now().After(*e.expiresAt) {
+		s.Delete(key)
+		return entry{}, ErrExpired
+	}
+	s.notifyRead(key, e.value)
+	s.recordGet(key)
+	return e, nil
+}
+
 // Helper function to determine if a reflect.Kind can implement interfaces
 func canImplementInterface(kind reflect.Kind) bool {
 	switch kind {
@@ -196,16 +268,18 @@ func GetOrDefault[T any](s *KVStore, key string, defaultValue T) (T, error) {
 
 // Delete removes a key from the store.
 func (s *KVStore) Delete(key string) bool {
-	if key == "" {
+	if key == "" || s.readOnly || !s.canWrite(key) {
 		return false
 	}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
 
-	_, exists := s.data[key]
+	_, exists := sh.data[key]
 	if exists {
-		delete(s.data, key)
+		delete(sh.data, key)
+		s.recordDelete(key)
 		return true
 	}
 	return false
@@ -213,23 +287,30 @@ func (s *KVStore) Delete(key string) bool {
 
 // Clear removes all keys from the store.
 func (s *KVStore) Clear() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.data = make(map[string]entry)
+	if s.readOnly {
+		return
+	}
+	// Restricted views only clear the keys their caller may write
+	if s.restricted && s.HasAccessPolicy() {
+		for _, key := range s.ListKeys() {
+			s.Delete(key)
+		}
+		return
+	}
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		sh.data = make(map[string]entry)
+		sh.mu.Unlock()
+	}
 }
 
 // ListKeys returns all stored keys.
 func (s *KVStore) ListKeys() []string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	out := make([]string, 0, len(s.data))
-	for k, e := range s.data {
-		if e.expiresAt != nil && time.Now().After(*e.expiresAt) {
-			continue
-		}
+	out := []string{}
+	s.scan(func(k string, e entry) {
 		out = append(out, k)
-	}
+	})
 	return out
 }
 
@@ -240,43 +321,29 @@ func (s *KVStore) Count() int {
 
 // ListTypes returns the set of all concrete types stored.
 func (s *KVStore) ListTypes() []string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
 	seen := map[reflect.Type]struct{}{}
 	out := []string{}
 
-	for _, e := range s.data {
-		if e.expiresAt != nil && time.Now().After(*e.expiresAt) {
-			continue
-		}
-
+	s.scan(func(_ string, e entry) {
 		if _, ok := seen[e.typ]; ok {
-			continue
+			return
 		}
 		seen[e.typ] = struct{}{}
 		out = append(out, e.typ.String())
-	}
+	})
 	return out
 }
 
 // KeysByType returns all keys whose stored value has type T.
 func KeysByType[T any](s *KVStore) []string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
 	want := reflect.TypeOf((*T)(nil)).Elem()
 	keys := []string{}
 
-	for k, e := range s.data {
-		if e.expiresAt != nil && time.Now().After(*e.expiresAt) {
-			continue
-		}
-
+	s.scan(func(k string, e entry) {
 		if e.typ == want {
 			keys = append(keys, k)
 		}
-	}
+	})
 	return keys
 }
 
@@ -285,10 +352,11 @@ func (s *KVStore) GetTypeSchema(key string) (interface{}, error) {
 	if key == "" {
 		return nil, errors.New("key cannot be empty")
 	}
+	if !s.canRead(key) {
+		return nil, accessDenied("get", key)
+	}
 
-	s.mu.RLock()
-	e, ok := s.data[key]
-	s.mu.RUnlock()
+	e, ok := s.lookup(key)
 
 	if !ok {
 		return nil, ErrNotFound
@@ -417,17 +485,24 @@ func (s *KVStore) UpdateField(key string, fieldPath string, fieldValue interface
 	if fieldPath == "" {
 		return errors.New("fieldPath cannot be empty")
 	}
+	if s.readOnly {
+		return readOnlyError("update", key)
+	}
+	if !s.canWrite(key) {
+		return accessDenied("update", key)
+	}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
 
-	e, ok := s.data[key]
+	e, ok := s.own(sh, key)
 	if !ok {
 		return ErrNotFound
 	}
 
 	if e.expiresAt != nil && time.Now().After(*e.expiresAt) {
-		delete(s.data, key)
+		delete(sh.data, key)
 		return ErrExpired
 	}
 
@@ -460,13 +535,14 @@ func (s *KVStore) UpdateField(key string, fieldPath string, fieldValue interface
 	}
 
 	// Update the entry in the store
-	s.data[key] = entry{
+	sh.data[key] = entry{
 		typ:       e.typ,
 		typeKind:  e.typeKind,
 		value:     updatedValue,
 		expiresAt: e.expiresAt,
 		metadata:  e.metadata,
 	}
+	s.recordPut(key, updatedValue)
 
 	return nil
 }
@@ -480,17 +556,24 @@ func (s *KVStore) UpdateFields(key string, fields map[string]interface{}) error
 	if len(fields) == 0 {
 		return nil
 	}
+	if s.readOnly {
+		return readOnlyError("update", key)
+	}
+	if !s.canWrite(key) {
+		return accessDenied("update", key)
+	}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
 
-	e, ok := s.data[key]
+	e, ok := s.own(sh, key)
 	if !ok {
 		return ErrNotFound
 	}
 
 	if e.expiresAt != nil && time.Now().After(*e.expiresAt) {
-		delete(s.data, key)
+		delete(sh.data, key)
 		return ErrExpired
 	}
 
@@ -525,13 +608,14 @@ func (s *KVStore) UpdateFields(key string, fields map[string]interface{}) error
 	}
 
 	// Update the entry in the store
-	s.data[key] = entry{
+	sh.data[key] = entry{
 		typ:       e.typ,
 		typeKind:  e.typeKind,
 		value:     updatedValue,
 		expiresAt: e.expiresAt,
 		metadata:  e.metadata,
 	}
+	s.recordPut(key, updatedValue)
 
 	return nil
 }
@@ -539,18 +623,29 @@ func (s *KVStore) UpdateFields(key string, fields map[string]interface{}) error
 // Merge combines this store with another, handling collisions according to the strategy.
 // Returns a list of collided keys and handles metadata merging.
 func (s *KVStore) Merge(other *KVStore, strategy MergeStrategy) ([]string, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	if s.readOnly {
+		return nil, fmt.Errorf("cannot merge into store: %w", ErrReadOnly)
+	}
+	other = other.flattened()
+	s.lockAll()
+	defer s.unlockAll()
 
 	collisions := []string{}
 
-	for key, otherEntry := range other.data {
+	for key, otherEntry := range other.all() {
+		if !other.canRead(key) {
+			continue
+		}
+		if !s.canWrite(key) {
+			return collisions, accessDenied("merge", key)
+		}
+		sh := s.shard(key)
 		// Check if the entry has expired
 		if otherEntry.expiresAt != nil && time.Now().After(*otherEntry.expiresAt) {
 			continue
 		}
 
-		_, exists := s.data[key]
+		_, exists := sh.data[key]
 		if exists {
 			collisions = append(collisions, key)
 
@@ -567,7 +662,7 @@ func (s *KVStore) Merge(other *KVStore, strategy MergeStrategy) ([]string, error
 
 		// Handle metadata merging
 		if exists && strategy == Overwrite {
-			if existingEntry, ok := s.data[key]; ok && existingEntry.metadata != nil && otherEntry.metadata != nil {
+			if existingEntry, ok := sh.data[key]; ok && existingEntry.metadata != nil && otherEntry.metadata != nil {
 				// Merge tags (union of both sets)
 				for _, tag := range otherEntry.metadata.Tags {
 					found := false
@@ -596,7 +691,7 @@ func (s *KVStore) Merge(other *KVStore, strategy MergeStrategy) ([]string, error
 		}
 
 		// Add or overwrite the entry
-		s.data[key] = otherEntry
+		sh.data[key] = otherEntry
 	}
 
 	return collisions, nil
@@ -604,25 +699,15 @@ func (s *KVStore) Merge(other *KVStore, strategy MergeStrategy) ([]string, error
 
 // FindKeyCollisions identifies keys that exist in both stores.
 func (s *KVStore) FindKeyCollisions(other *KVStore) []string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	other.mu.RLock()
-	defer other.mu.RUnlock()
-
 	var collisions []string
-	for k, e := range s.data {
-		if e.expiresAt != nil && time.Now().After(*e.expiresAt) {
-			continue
-		}
-
-		if otherEntry, exists := other.data[k]; exists {
+	s.scan(func(k string, e entry) {
+		if otherEntry, exists := other.lookup(k); exists {
 			if otherEntry.expiresAt != nil && time.Now().After(*otherEntry.expiresAt) {
-				continue
+				return
 			}
 			collisions = append(collisions, k)
 		}
-	}
+	})
 
 	return collisions
 }
@@ -630,21 +715,13 @@ func (s *KVStore) FindKeyCollisions(other *KVStore) []string {
 // FindKeysBySchema returns all keys whose type schema matches the given pattern.
 // Pattern can be a partial schema - entries must contain at least all fields in pattern.
 func (s *KVStore) FindKeysBySchema(pattern interface{}) []string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
 	var keys []string
-	for k, e := range s.data {
-		// Skip expired entries
-		if e.expiresAt != nil && time.Now().After(*e.expiresAt) {
-			continue
-		}
-
+	s.scan(func(k string, e entry) {
 		schema := TypeToSchema(e.typ)
 		if SchemaMatch(schema, pattern) {
 			keys = append(keys, k)
 		}
-	}
+	})
 
 	return keys
 }
@@ -742,10 +819,11 @@ func (s *KVStore) GetMetadata(key string) (*Metadata, error) {
 	if key == "" {
 		return nil, errors.New("key cannot be empty")
 	}
+	if !s.canRead(key) {
+		return nil, accessDenied("get", key)
+	}
 
-	s.mu.RLock()
-	e, ok := s.data[key]
-	s.mu.RUnlock()
+	e, ok := s.lookup(key)
 
 	if !ok {
 		return nil, ErrNotFound
@@ -757,12 +835,33 @@ func (s *KVStore) GetMetadata(key string) (*Metadata, error) {
 		return nil, ErrExpired
 	}
 
+	// Read-only views, and views that may not write the key, hand out copies,
+	// so that the metadata cannot be changed through them
+	if s.readOnly || !s.canWrite(key) {
+		if e.metadata == nil {
+			return NewMetadata(), nil
+		}
+		return copyMetadata(e.metadata), nil
+	}
+
+	// Scopes copy the keys they inherit before handing out their metadata
+	if s.parent != nil {
+		sh := s.shard(key)
+		sh.mu.Lock()
+		e, ok = s.own(sh, key)
+		sh.mu.Unlock()
+		if !ok {
+			return nil, ErrNotFound
+		}
+	}
+
 	// If no metadata exists, create a new one
 	if e.metadata == nil {
 		meta := NewMetadata()
-		s.mu.Lock()
-		s.data[key] = entry{typ: e.typ, typeKind: e.typeKind, value: e.value, expiresAt: e.expiresAt, metadata: meta}
-		s.mu.Unlock()
+		sh := s.shard(key)
+		sh.mu.Lock()
+		sh.data[key] = entry{typ: e.typ, typeKind: e.typeKind, value: e.value, expiresAt: e.expiresAt, metadata: meta}
+		sh.mu.Unlock()
 		return meta, nil
 	}
 
@@ -778,28 +877,41 @@ func (s *KVStore) SetMetadata(key string, metadata *Metadata) error {
 	if metadata == nil {
 		return errors.New("metadata cannot be nil")
 	}
+	if s.readOnly {
+		return readOnlyError("set metadata of", key)
+	}
+	if !s.canWrite(key) {
+		return accessDenied("set metadata of", key)
+	}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
 
-	e, ok := s.data[key]
+	e, ok := s.own(sh, key)
 	if !ok {
 		return ErrNotFound
 	}
 
 	// Check if the entry has expired
 	if e.expiresAt != nil && time.Now().After(*e.expiresAt) {
-		delete(s.data, key)
+		delete(sh.data, key)
 		return ErrExpired
 	}
 
 	e.metadata = metadata
-	s.data[key] = e
+	sh.data[key] = e
 	return nil
 }
 
 // AddTag adds a tag to the metadata for a key
 func (s *KVStore) AddTag(key string, tag string) error {
+	if s.readOnly {
+		return readOnlyError("tag", key)
+	}
+	if !s.canWrite(key) {
+		return accessDenied("tag", key)
+	}
 	meta, err := s.GetMetadata(key)
 	if err != nil {
 		return err
@@ -811,6 +923,12 @@ func (s *KVStore) AddTag(key string, tag string) error {
 
 // RemoveTag removes a tag from the metadata for a key
 func (s *KVStore) RemoveTag(key string, tag string) error {
+	if s.readOnly {
+		return readOnlyError("untag", key)
+	}
+	if !s.canWrite(key) {
+		return accessDenied("untag", key)
+	}
 	meta, err := s.GetMetadata(key)
 	if err != nil {
 		return err
@@ -832,66 +950,48 @@ func (s *KVStore) HasTag(key string, tag string) (bool, error) {
 
 // FindKeysByTag returns all keys that have a specific tag in their metadata
 func (s *KVStore) FindKeysByTag(tag string) []string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
 	var keys []string
-	for k, e := range s.data {
-		// Skip expired entries
-		if e.expiresAt != nil && time.Now().After(*e.expiresAt) {
-			continue
-		}
-
+	s.scan(func(k string, e entry) {
 		// Skip entries with no metadata or without the tag
 		if e.metadata != nil && e.metadata.HasTag(tag) {
 			keys = append(keys, k)
 		}
-	}
+	})
 	return keys
 }
 
 // FindKeysByAllTags returns all keys that have all the specified tags in their metadata
 func (s *KVStore) FindKeysByAllTags(tags []string) []string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
 	var keys []string
-	for k, e := range s.data {
-		// Skip expired entries
-		if e.expiresAt != nil && time.Now().After(*e.expiresAt) {
-			continue
-		}
-
+	s.scan(func(k string, e entry) {
 		// Skip entries with no metadata or without all the tags
 		if e.metadata != nil && e.metadata.HasAllTags(tags) {
 			keys = append(keys, k)
 		}
-	}
+	})
 	return keys
 }
 
 // FindKeysByAnyTag returns all keys that have any of the specified tags in their metadata
 func (s *KVStore) FindKeysByAnyTag(tags []string) []string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
 	var keys []string
-	for k, e := range s.data {
-		// Skip expired entries
-		if e.expiresAt != nil && time.Now().After(*e.expiresAt) {
-			continue
-		}
-
+	s.scan(func(k string, e entry) {
 		// Skip entries with no metadata or without any of the tags
 		if e.metadata != nil && e.metadata.HasAnyTag(tags) {
 			keys = append(keys, k)
 		}
-	}
+	})
 	return keys
 }
 
 // SetProperty sets a property in a key's metadata
 func (s *KVStore) SetProperty(key string, propertyKey string, propertyValue interface{}) error {
+	if s.readOnly {
+		return readOnlyError("set a property of", key)
+	}
+	if !s.canWrite(key) {
+		return accessDenied("set a property of", key)
+	}
 	meta, err := s.GetMetadata(key)
 	if err != nil {
 		return err
@@ -917,19 +1017,11 @@ func (s *KVStore) GetProperty(key string, propertyKey string) (interface{}, erro
 
 // FindKeysByProperty returns all keys that have a specific property with a specific value
 func (s *KVStore) FindKeysByProperty(propertyKey string, propertyValue interface{}) []string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
 	var keys []string
-	for k, e := range s.data {
-		// Skip expired entries
-		if e.expiresAt != nil && time.Now().After(*e.expiresAt) {
-			continue
-		}
-
+	s.scan(func(k string, e entry) {
 		// Skip entries with no metadata
 		if e.metadata == nil {
-			continue
+			return
 		}
 
 		// Check if the property exists and matches the value
@@ -939,21 +1031,34 @@ func (s *KVStore) FindKeysByProperty(propertyKey string, propertyValue interface
 				keys = append(keys, k)
 			}
 		}
-	}
+	})
 	return keys
 }
 
 // Clone creates a new KVStore with a deep copy of all entries from this store.
 // The returned store will have the same data but no shared references with the original.
 func (s *KVStore) Clone() *KVStore {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	if s.parent != nil {
+		return s.cloneScope()
+	}
+	s.rlockAll()
+	defer s.runlockAll()
 
-	// Create a new store
-	newStore := NewKVStore()
+	// Create a new store of as many shards and the same access policy, sharing
+	// the blob backend so blob references stay resolvable
+	newStore := newKVStore(len(s.shards))
+	s.blobMu.Lock()
+	newStore.blobs = s.blobs
+	s.blobMu.Unlock()
+	newStore.policy.Store(s.policy.Load())
 
 	// Copy all entries, handling expired keys
-	for key, e := range s.data {
+	for key, e := range s.all() {
+		// Views of AccessAs only clone what their caller may read
+		if !s.canRead(key) {
+			continue
+		}
+
 		// Skip expired entries
 		if e.expiresAt != nil && time.Now().After(*e.expiresAt) {
 			continue
@@ -1038,7 +1143,7 @@ func (s *KVStore) Clone() *KVStore {
 		}
 
 		// Create the entry directly
-		newStore.data[key] = entry{
+		newStore.shard(key).data[key] = entry{
 			typ:       e.typ,
 			typeKind:  e.typeKind,
 			value:     deepCopy,
@@ -1065,22 +1170,34 @@ func (s *KVStore) CopyFrom(source *KVStore) (int, error) {
 	if source == nil {
 		return 0, fmt.Errorf("source store is nil")
 	}
+	if s.readOnly {
+		return 0, fmt.Errorf("cannot copy into store: %w", ErrReadOnly)
+	}
 
-	source.mu.RLock()
-	defer source.mu.RUnlock()
+	source = source.flattened()
+	source.rlockAll()
+	defer source.runlockAll()
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.lockAll()
+	defer s.unlockAll()
 
 	copied := 0
-	for key, srcEntry := range source.data {
+	for key, srcEntry := range source.all() {
+		if !source.canRead(key) {
+			continue
+		}
+		if !s.canWrite(key) {
+			return copied, accessDenied("copy", key)
+		}
+		sh := s.shard(key)
+
 		// Skip expired entries
 		if srcEntry.expiresAt != nil && time.Now().After(*srcEntry.expiresAt) {
 			continue
 		}
 
 		// Skip keys that already exist in the destination
-		if _, exists := s.data[key]; exists {
+		if _, exists := sh.data[key]; exists {
 			continue
 		}
 
@@ -1104,7 +1221,7 @@ func (s *KVStore) CopyFrom(source *KVStore) (int, error) {
 		}
 
 		// Create a new entry with the deep-copied value
-		s.data[key] = entry{
+		sh.data[key] = entry{
 			typ:       srcEntry.typ,
 			typeKind:  srcEntry.typeKind,
 			value:     deepCopiedValue,
@@ -1126,21 +1243,33 @@ func (s *KVStore) CopyFromWithOverwrite(source *KVStore) (copied int, overwritte
 	if source == nil {
 		return 0, 0, fmt.Errorf("source store is nil")
 	}
+	if s.readOnly {
+		return 0, 0, fmt.Errorf("cannot copy into store: %w", ErrReadOnly)
+	}
 
-	source.mu.RLock()
-	defer source.mu.RUnlock()
+	source = source.flattened()
+	source.rlockAll()
+	defer source.runlockAll()
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.lockAll()
+	defer s.unlockAll()
+
+	for key, srcEntry := range source.all() {
+		if !source.canRead(key) {
+			continue
+		}
+		if !s.canWrite(key) {
+			return copied, overwritten, accessDenied("copy", key)
+		}
+		sh := s.shard(key)
 
-	for key, srcEntry := range source.data {
 		// Skip expired entries
 		if srcEntry.expiresAt != nil && time.Now().After(*srcEntry.expiresAt) {
 			continue
 		}
 
 		// Check if key exists in destination
-		_, exists := s.data[key]
+		_, exists := sh.data[key]
 
 		// Use our deepCopy function to ensure proper reference isolation
 		deepCopiedValue := deepCopy(srcEntry.value)
@@ -1162,7 +1291,7 @@ func (s *KVStore) CopyFromWithOverwrite(source *KVStore) (copied int, overwritte
 		}
 
 		// Create a new entry with the deep-copied value
-		s.data[key] = entry{
+		sh.data[key] = entry{
 			typ:       srcEntry.typ,
 			typeKind:  srcEntry.typeKind,
 			value:     deepCopiedValue,
@@ -1185,6 +1314,10 @@ func deepCopy(value interface{}) interface{} {
 	if value == nil {
 		return nil
 	}
+	// Streams are shared, not copied
+	if _, ok := value.(interface{ sharedByCopies() }); ok {
+		return value
+	}
 
 	valueType := reflect.TypeOf(value)
 	valueKind := valueType.Kind()
@@ -1272,16 +1405,9 @@ func deepCopy(value interface{}) interface{} {
 // ExportAll returns all non-expired entries as a map[string]interface{} for serialization.
 // This is useful for extracting store data to send across process boundaries.
 func (s *KVStore) ExportAll() map[string]interface{} {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
 	result := make(map[string]interface{})
-	for key, e := range s.data {
-		// Skip expired entries
-		if e.expiresAt != nil && time.Now().After(*e.expiresAt) {
-			continue
-		}
+	s.scan(func(key string, e entry) {
 		result[key] = e.value
-	}
+	})
 	return result
 }
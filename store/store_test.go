@@ -1426,3 +1426,27 @@ func TestCopyFromWithOverwrite(t *testing.T) {
 		assert.NotContains(t, testDest.ListKeys(), "will-expire")
 	})
 }
+
+func TestGetValue(t *testing.T) {
+	s := NewKVStore()
+	assert.NoError(t, s.Put("name", "gopher"))
+	assert.NoError(t, s.Put("count", 3))
+	assert.NoError(t, s.Put("tags", []string{"a", "b"}))
+
+	value, err := s.GetValue("name")
+	assert.NoError(t, err)
+	assert.Equal(t, "gopher", value)
+	value, err = s.GetValue("count")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, value)
+	value, err = s.GetValue("tags")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, value)
+
+	_, err = s.GetValue("missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.NoError(t, s.SetAccessPolicy(AccessRule{Pattern: "name", Read: []string{"admin"}}))
+	_, err = s.AccessAs("guest").GetValue("name")
+	assert.ErrorIs(t, err, ErrAccessDenied)
+}
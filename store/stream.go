@@ -0,0 +1,161 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"sync"
+)
+
+// ErrNotStream is returned when a key does not hold a stream of the requested type.
+var ErrNotStream = errors.New("key does not hold a stream")
+
+// ErrStreamClosed is returned when sending to a stream whose receiver has stopped.
+var ErrStreamClosed = errors.New("stream is closed")
+
+// Stream carries items of type T from senders to receivers, blocking the
+// senders while its buffer is full. Unlike a slice stored under a key, the
+// items are held only until they are received, and a slow receiver slows
+// the senders down instead of letting items pile up in memory.
+//
+// Stores hold streams by reference: clones and copies of a store share them.
+type Stream[T any] struct {
+	items chan T
+	// stopped is closed once the receiver stopped receiving
+	stopped   chan struct{}
+	closeOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// StreamSender is the sending side of a Stream.
+type StreamSender[T any] struct {
+	stream *Stream[T]
+}
+
+// StreamReceiver is the receiving side of a Stream.
+type StreamReceiver[T any] struct {
+	stream *Stream[T]
+}
+
+// NewStream creates a stream buffering up to buffer items. With a buffer of
+// zero, each send waits for a receiver.
+func NewStream[T any](buffer int) *Stream[T] {
+	if buffer < 0 {
+		buffer = 0
+	}
+	return &Stream[T]{
+		items:   make(chan T, buffer),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Sender returns the sending side of the stream.
+func (s *Stream[T]) Sender() StreamSender[T] {
+	return StreamSender[T]{stream: s}
+}
+
+// Receiver returns the receiving side of the stream.
+func (s *Stream[T]) Receiver() StreamReceiver[T] {
+	return StreamReceiver[T]{stream: s}
+}
+
+// sharedByCopies keeps deepCopy from copying streams, whose channels and
+// state must be shared.
+func (s *Stream[T]) sharedByCopies() {}
+
+// PutStream creates a stream of items of type T buffering up to buffer items,
+// stores it under key and returns its sides. Producer and consumer actions,
+// typically in stages run in parallel, can then stream items through the key:
+//
+//	send, _, err := store.PutStream[Record](s, "records", 64)
+//	...
+//	_, receive, err := store.GetStream[Record](s, "records")
+//	for record := range receive.Items(ctx) {
+//		...
+//	}
+func PutStream[T any](s *KVStore, key string, buffer int) (StreamSender[T], StreamReceiver[T], error) {
+	stream := NewStream[T](buffer)
+	if err := s.Put(key, stream); err != nil {
+		return StreamSender[T]{}, StreamReceiver[T]{}, err
+	}
+	return stream.Sender(), stream.Receiver(), nil
+}
+
+// GetStream returns the sides of the stream of items of type T stored under
+// key with PutStream. It returns an error wrapping ErrNotStream if key holds
+// something else.
+func GetStream[T any](s *KVStore, key string) (StreamSender[T], StreamReceiver[T], error) {
+	stream, err := Get[*Stream[T]](s, key)
+	if errors.Is(err, ErrTypeMismatch) {
+		return StreamSender[T]{}, StreamReceiver[T]{}, fmt.Errorf("%w of %T: %s", ErrNotStream, *new(T), key)
+	}
+	if err != nil {
+		return StreamSender[T]{}, StreamReceiver[T]{}, err
+	}
+	return stream.Sender(), stream.Receiver(), nil
+}
+
+// Send sends item to the stream, blocking while its buffer is full. It
+// returns ErrStreamClosed once the receiver has stopped, and the cause of
+// ctx once ctx is done.
+func (s StreamSender[T]) Send(ctx context.Context, item T) error {
+	// Do not send to a stopped receiver, even if the buffer has room
+	select {
+	case <-s.stream.stopped:
+		return ErrStreamClosed
+	default:
+	}
+
+	select {
+	case s.stream.items <- item:
+		return nil
+	case <-s.stream.stopped:
+		return ErrStreamClosed
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+// Close tells the receiver that no more items are coming, once it has
+// received those already sent. It must be called once every Send returned.
+// Closing a stream again does nothing.
+func (s StreamSender[T]) Close() {
+	s.stream.closeOnce.Do(func() { close(s.stream.items) })
+}
+
+// Receive returns the next item of the stream, blocking until one is sent.
+// It returns io.EOF once the sender closed the stream and every item was
+// received, and the cause of ctx once ctx is done.
+func (r StreamReceiver[T]) Receive(ctx context.Context) (T, error) {
+	var zero T
+	select {
+	case item, ok := <-r.stream.items:
+		if !ok {
+			return zero, io.EOF
+		}
+		return item, nil
+	case <-ctx.Done():
+		return zero, context.Cause(ctx)
+	}
+}
+
+// Items iterates over the items of the stream as they are sent, until the
+// sender closes the stream or ctx is done. Check ctx to tell both apart.
+func (r StreamReceiver[T]) Items(ctx context.Context) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for {
+			item, err := r.Receive(ctx)
+			if err != nil || !yield(item) {
+				return
+			}
+		}
+	}
+}
+
+// Close stops receiving: pending and later sends return ErrStreamClosed.
+// Closing a stream again does nothing.
+func (r StreamReceiver[T]) Close() {
+	r.stream.stopOnce.Do(func() { close(r.stream.stopped) })
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPutStream(t *testing.T) {
+	s := NewKVStore()
+	send, _, err := PutStream[int](s, "numbers", 2)
+	require.NoError(t, err)
+
+	go func() {
+		defer send.Close()
+		for i := 1; i <= 5; i++ {
+			if err := send.Send(context.Background(), i); err != nil {
+				return
+			}
+		}
+	}()
+
+	_, receive, err := GetStream[int](s, "numbers")
+	require.NoError(t, err)
+	var received []int
+	for item := range receive.Items(context.Background()) {
+		received = append(received, item)
+	}
+	assert.Equal(t, []int{1, 2, 3, 4, 5}, received)
+
+	_, err = receive.Receive(context.Background())
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Copies of the store share the stream
+	copied := NewKVStore()
+	_, err = copied.CopyFrom(s)
+	require.NoError(t, err)
+	original, err := Get[*Stream[int]](s, "numbers")
+	require.NoError(t, err)
+	shared, err := Get[*Stream[int]](copied, "numbers")
+	require.NoError(t, err)
+	assert.Same(t, original, shared)
+}
+
+func TestStreamBackpressure(t *testing.T) {
+	stream := NewStream[string](1)
+	send, receive := stream.Sender(), stream.Receiver()
+	require.NoError(t, send.Send(context.Background(), "first"))
+
+	// The buffer is full, so the next send waits
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, send.Send(ctx, "second"), context.DeadlineExceeded)
+
+	item, err := receive.Receive(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "first", item)
+
+	// A stopped receiver releases blocked senders
+	require.NoError(t, send.Send(context.Background(), "third"))
+	sent := make(chan error, 1)
+	go func() { sent <- send.Send(context.Background(), "fourth") }()
+	receive.Close()
+	receive.Close()
+	assert.ErrorIs(t, <-sent, ErrStreamClosed)
+	assert.ErrorIs(t, send.Send(context.Background(), "fifth"), ErrStreamClosed)
+}
+
+func TestGetStreamErrors(t *testing.T) {
+	s := NewKVStore()
+	_, _, err := GetStream[int](s, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, s.Put("plain", 42))
+	_, _, err = GetStream[int](s, "plain")
+	assert.ErrorIs(t, err, ErrNotStream)
+
+	_, _, err = PutStream[string](s, "words", 0)
+	require.NoError(t, err)
+	_, _, err = GetStream[int](s, "words")
+	assert.True(t, errors.Is(err, ErrNotStream))
+	assert.EqualError(t, err, "key does not hold a stream of int: words")
+
+	_, _, err = PutStream[int](s.ReadOnlyView(), "numbers", 1)
+	assert.ErrorIs(t, err, ErrReadOnly)
+}
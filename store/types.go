@@ -138,4 +138,6 @@ var (
 	ErrNotFound     = errors.New("key not found")
 	ErrTypeMismatch = errors.New("type mismatch on Get")
 	ErrExpired      = errors.New("key has expired")
+	ErrReadOnly     = errors.New("store is read-only")
+	ErrAccessDenied = errors.New("access denied by the store policy")
 )
@@ -0,0 +1,65 @@
+package gostage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/davidroman0O/gostage/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadOnlyActions(t *testing.T) {
+	var read string
+	plugin := NewActionFunc("plugin", "", func(ctx *ActionContext) error {
+		value, err := store.Get[string](ctx.Store(), "config")
+		if err != nil {
+			return err
+		}
+		read = value
+		return ctx.Store().Put("config", "tampered")
+	})
+	plugin.(*funcAction).AddTag(TagReadOnly)
+
+	result := runSingleAction(t, context.Background(), plugin, func(wf *Workflow) {
+		require.NoError(t, wf.Store.Put("config", "original"))
+	})
+	assert.Equal(t, "original", read)
+	assert.ErrorIs(t, result.Error, store.ErrReadOnly)
+	assert.Equal(t, "original", result.FinalStore["config"])
+
+	// Other actions still write to the store
+	writer := NewActionFunc("writer", "", func(ctx *ActionContext) error {
+		return ctx.Store().Put("config", "updated")
+	})
+	result = runSingleAction(t, context.Background(), writer, nil)
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, "updated", result.FinalStore["config"])
+}
+
+func TestStoreAccessPolicyByActionTag(t *testing.T) {
+	wf := NewWorkflow("billing", "Billing", "")
+	require.NoError(t, wf.Store.SetAccessPolicy(store.AccessRule{Pattern: "billing.*", Write: []string{"billing"}}))
+	require.NoError(t, wf.Store.Put("billing.card", "4242"))
+
+	stage := NewStage("charge", "Charge", "")
+	stage.AddAction(NewTestActionWithTags("charge", "", []string{"billing"}, func(ctx *ActionContext) error {
+		card, err := store.Get[string](ctx.Store(), "billing.card")
+		if err != nil {
+			return err
+		}
+		return ctx.Store().Put("billing.charged", card)
+	}))
+	var denied error
+	stage.AddAction(NewTestAction("dynamic", "", func(ctx *ActionContext) error {
+		_, denied = store.Get[string](ctx.Store(), "billing.card")
+		return ctx.Store().Put("summary", "done")
+	}))
+	wf.AddStage(stage)
+
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, "4242", result.FinalStore["billing.charged"])
+	assert.ErrorIs(t, denied, store.ErrAccessDenied)
+	assert.Equal(t, "done", result.FinalStore["summary"])
+}
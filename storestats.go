@@ -0,0 +1,42 @@
+package gostage
+
+import "github.com/davidroman0O/gostage/store"
+
+// contextStoreStats marks the workflow of a run made with RunOptions.StoreStats
+const contextStoreStats = "storeStats"
+
+// startStoreStats starts tracking the store statistics of the run if the
+// options ask for them. The returned function stops it and returns the
+// statistics of the user keys.
+func startStoreStats(w *Workflow, options RunOptions) func() []store.KeyStats {
+	if !options.StoreStats || w.Store == nil {
+		return func() []store.KeyStats { return nil }
+	}
+
+	tracked := w.Store
+	stop := tracked.TrackStats()
+	w.Context[contextStoreStats] = true
+	return func() []store.KeyStats {
+		stop()
+		delete(w.Context, contextStoreStats)
+		stats := []store.KeyStats{}
+		for _, key := range tracked.Stats() {
+			if !hasSystemPrefix(key.Key) {
+				stats = append(stats, key)
+			}
+		}
+		return stats
+	}
+}
+
+// creditStoreAccesses credits the store reads and writes of execute to the
+// action of ctx, under its ActionStatusKey, when the run tracks store statistics.
+func creditStoreAccesses(ctx *ActionContext, execute func() error) error {
+	if _, ok := ctx.Workflow.Context[contextStoreStats]; !ok {
+		return execute()
+	}
+
+	ctx.Workflow.Store.SetStatsAccessor(ActionStatusKey(ctx.Stage.ID, ctx.Action.Name()))
+	defer ctx.Workflow.Store.SetStatsAccessor("")
+	return execute()
+}
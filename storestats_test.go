@@ -0,0 +1,44 @@
+package gostage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/davidroman0O/gostage/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunStoreStats(t *testing.T) {
+	wf := NewWorkflow("stats", "Stats", "")
+	stage := NewStage("etl", "ETL", "")
+	stage.AddAction(NewActionFunc("load", "", func(ctx *ActionContext) error {
+		return ctx.Store().Put("rows", []int{1, 2, 3})
+	}))
+	stage.AddAction(NewActionFunc("transform", "", func(ctx *ActionContext) error {
+		for i := 0; i < 5; i++ {
+			if _, err := store.Get[[]int](ctx.Store(), "rows"); err != nil {
+				return err
+			}
+		}
+		return ctx.Store().Put("total", 6)
+	}))
+	wf.AddStage(stage)
+
+	runner := NewRunner()
+	result := runner.ExecuteWithOptions(wf, RunOptions{Context: context.Background(), StoreStats: true})
+	require.True(t, result.Success, "%v", result.Error)
+
+	require.Len(t, result.StoreStats, 2)
+	rows := result.StoreStats[0]
+	assert.Equal(t, "rows", rows.Key)
+	assert.Equal(t, int64(5), rows.Gets)
+	assert.Equal(t, int64(1), rows.Puts)
+	assert.Equal(t, []string{ActionStatusKey("etl", "load"), ActionStatusKey("etl", "transform")}, rows.Accessors)
+	assert.Equal(t, "total", result.StoreStats[1].Key)
+
+	// Runs without the option leave the store untracked
+	result = runner.ExecuteWithOptions(wf, RunOptions{Context: context.Background()})
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Nil(t, result.StoreStats)
+}
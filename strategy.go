@@ -0,0 +1,249 @@
+package gostage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"strings"
+	"sync"
+
+	"github.com/davidroman0O/gostage/store"
+)
+
+// ErrPipelineClosed is returned by EmitItem once the stage consuming the items
+// has finished, so that producers can stop early.
+var ErrPipelineClosed = errors.New("the next stage of the pipeline no longer consumes items")
+
+// ExecutionStrategy decides how the stages of a workflow are run.
+type ExecutionStrategy int
+
+const (
+	// StrategySequential runs the stages one after the other. It is the default
+	StrategySequential ExecutionStrategy = iota
+	// StrategyParallel runs every stage at the same time
+	StrategyParallel
+	// StrategyPipeline runs every stage at the same time, each stage
+	// consuming the items the previous one emits with EmitItem, as they are
+	// emitted
+	StrategyPipeline
+)
+
+// executionStrategyNames are the names of the strategies in definitions
+var executionStrategyNames = map[ExecutionStrategy]string{
+	StrategySequential: "sequential",
+	StrategyParallel:   "parallel",
+	StrategyPipeline:   "pipeline",
+}
+
+// pipelineBuffer is how many items a stage of a pipeline can emit ahead of
+// the next stage before EmitItem blocks
+const pipelineBuffer = 16
+
+// String returns the name of the strategy.
+func (s ExecutionStrategy) String() string {
+	if name, ok := executionStrategyNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("ExecutionStrategy(%d)", int(s))
+}
+
+// ParseExecutionStrategy returns the strategy with the given name, as returned by String.
+func ParseExecutionStrategy(name string) (ExecutionStrategy, error) {
+	for strategy, strategyName := range executionStrategyNames {
+		if strings.EqualFold(name, strategyName) {
+			return strategy, nil
+		}
+	}
+	return StrategySequential, fmt.Errorf("unknown execution strategy '%s'", name)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s ExecutionStrategy) MarshalText() ([]byte, error) {
+	if _, ok := executionStrategyNames[s]; !ok {
+		return nil, fmt.Errorf("unknown execution strategy %d", int(s))
+	}
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *ExecutionStrategy) UnmarshalText(text []byte) error {
+	strategy, err := ParseExecutionStrategy(string(text))
+	if err != nil {
+		return err
+	}
+	*s = strategy
+	return nil
+}
+
+// SetExecutionStrategy sets how the Runner runs the stages of the workflow.
+//
+// With StrategyParallel and StrategyPipeline, every stage starts at once and
+// the first failure cancels the others. Each stage gets its own copy of the
+// workflow's context, so stages and actions disabled by a running stage are
+// not seen by the others, and stages cannot generate dynamic stages.
+// Pipeline stages cannot run in a child process or on a remote worker.
+func (w *Workflow) SetExecutionStrategy(strategy ExecutionStrategy) {
+	w.strategy = strategy
+}
+
+// ExecutionStrategy returns the strategy the stages of the workflow run with.
+func (w *Workflow) ExecutionStrategy() ExecutionStrategy {
+	return w.strategy
+}
+
+// Context keys of the streams linking a stage of a pipeline to its neighbours
+const (
+	contextPipelineInput  = "pipelineInput"
+	contextPipelineOutput = "pipelineOutput"
+)
+
+// itemStream carries the items emitted by a stage of a pipeline to the next.
+type itemStream struct {
+	// to is the ID of the consuming stage
+	to     string
+	stream *store.Stream[interface{}]
+}
+
+func newItemStream(to string) *itemStream {
+	return &itemStream{to: to, stream: store.NewStream[interface{}](pipelineBuffer)}
+}
+
+// actionGoContext returns the Go context of ctx, which tests may leave unset.
+func actionGoContext(ctx *ActionContext) context.Context {
+	if ctx.GoContext == nil {
+		return context.Background()
+	}
+	return ctx.GoContext
+}
+
+// EmitItem sends item to the next stage of a workflow run with
+// StrategyPipeline, which receives it from Items. It blocks while the next
+// stage is too far behind, and returns ErrPipelineClosed once the next stage
+// has finished.
+func (ctx *ActionContext) EmitItem(item interface{}) error {
+	output, ok := ctx.Workflow.Context[contextPipelineOutput].(*itemStream)
+	if !ok {
+		return fmt.Errorf("stage '%s' has no next stage to emit items to", ctx.Stage.ID)
+	}
+	err := output.stream.Sender().Send(actionGoContext(ctx), item)
+	if errors.Is(err, store.ErrStreamClosed) {
+		return fmt.Errorf("stage '%s': %w", output.to, ErrPipelineClosed)
+	}
+	return err
+}
+
+// Items iterates over the items the previous stage of a workflow run with
+// StrategyPipeline emits, as they are emitted, until that stage finishes or
+// the run is cancelled. The actions of a stage share its items, each item
+// being received once. The sequence is empty for the first stage and for
+// workflows run with another strategy.
+func (ctx *ActionContext) Items() iter.Seq[interface{}] {
+	input, ok := ctx.Workflow.Context[contextPipelineInput].(*itemStream)
+	if !ok {
+		return func(func(interface{}) bool) {}
+	}
+	return input.stream.Receiver().Items(actionGoContext(ctx))
+}
+
+// stageCopy returns a copy of w for a stage running at the same time as
+// others, sharing the store and the run state of w but with its own context
+// and disabled stages and actions.
+func stageCopy(w *Workflow) *Workflow {
+	// Create the shared run state before copying it
+	w.results()
+	childrenOf(w)
+
+	copied := *w
+	copied.Context = make(map[string]interface{}, len(w.Context))
+	for key, value := range w.Context {
+		copied.Context[key] = value
+	}
+	for _, key := range []string{"disabledStages", "disabledActions"} {
+		if disabled, ok := w.Context[key].(map[string]bool); ok {
+			own := make(map[string]bool, len(disabled))
+			for name, value := range disabled {
+				own[name] = value
+			}
+			copied.Context[key] = own
+		}
+	}
+	return &copied
+}
+
+// executeConcurrently runs the stages of w at the same time, linking them
+// with item streams for StrategyPipeline, and returns the first failure.
+// Barrier stages start once the stages they wait for have finished.
+func (r *Runner) executeConcurrently(ctx context.Context, w *Workflow, runStage func(context.Context, *Stage, *Workflow) error, logger Logger) error {
+	stages := append([]*Stage{}, w.Stages...)
+	pipeline := w.strategy == StrategyPipeline
+	if pipeline {
+		for _, stage := range stages {
+			if stage.HasTag(TagSpawn) || stage.HasTag(TagRemote) {
+				return fmt.Errorf("stage '%s' cannot run in a child process or on a remote worker with the %s strategy", stage.ID, w.strategy)
+			}
+			if stage.barrier {
+				return fmt.Errorf("barrier stage '%s' cannot run with the %s strategy", stage.ID, w.strategy)
+			}
+		}
+	}
+	if err := checkBarriers(stages); err != nil {
+		return err
+	}
+	logger.Debug("Running %d stages with the %s strategy", len(stages), w.strategy)
+
+	copies := make([]*Workflow, len(stages))
+	done := make(map[string]chan struct{}, len(stages))
+	for i, stage := range stages {
+		copies[i] = stageCopy(w)
+		done[stage.ID] = make(chan struct{})
+	}
+	if pipeline {
+		for i := 0; i < len(stages)-1; i++ {
+			stream := newItemStream(stages[i+1].ID)
+			copies[i].Context[contextPipelineOutput] = stream
+			copies[i+1].Context[contextPipelineInput] = stream
+		}
+	}
+
+	runCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var wg sync.WaitGroup
+	var failOnce sync.Once
+	var failed error
+	for i, stage := range stages {
+		wg.Add(1)
+		go func(stage *Stage, copied *Workflow) {
+			defer wg.Done()
+			defer close(done[stage.ID])
+			// Tell the next stage no more items are coming, and the previous
+			// one that its items are no longer consumed
+			if output, ok := copied.Context[contextPipelineOutput].(*itemStream); ok {
+				defer output.stream.Sender().Close()
+			}
+			if input, ok := copied.Context[contextPipelineInput].(*itemStream); ok {
+				defer input.stream.Receiver().Close()
+			}
+
+			err := waitForUpstream(runCtx, stage, done)
+			if err == nil {
+				err = runStage(runCtx, stage, copied)
+			}
+			if err == nil {
+				if dynamic, ok := copied.Context["dynamicStages"].([]*Stage); ok && len(dynamic) > 0 {
+					err = fmt.Errorf("stage '%s' generated dynamic stages, which the %s strategy does not support", stage.ID, w.strategy)
+				}
+			}
+			if err != nil {
+				// Report the failure that stopped the stages, not the cancellations it caused
+				failOnce.Do(func() {
+					failed = err
+					cancel(err)
+				})
+			}
+		}(stage, copies[i])
+	}
+	wg.Wait()
+	return failed
+}
@@ -0,0 +1,267 @@
+package gostage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidroman0O/gostage/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipelineStrategy(t *testing.T) {
+	wf := NewWorkflow("pipeline", "Pipeline", "")
+	wf.SetExecutionStrategy(StrategyPipeline)
+	require.NoError(t, wf.Store.Put("input", []string{"item1", "item2", "item3"}))
+
+	// The first item reaches the last stage before the input stage emits the next
+	firstOutput := make(chan struct{})
+	input := NewStage("input", "Input", "")
+	input.AddAction(NewActionFunc("read-input", "", func(ctx *ActionContext) error {
+		items, err := store.Get[[]string](ctx.Store(), "input")
+		if err != nil {
+			return err
+		}
+		for i, item := range items {
+			if err := ctx.EmitItem(item); err != nil {
+				return err
+			}
+			if i == 0 {
+				select {
+				case <-firstOutput:
+				case <-time.After(5 * time.Second):
+					return errors.New("the first item was not streamed")
+				}
+			}
+		}
+		return nil
+	}))
+
+	process := NewStage("process", "Process", "")
+	process.AddAction(NewActionFunc("process-items", "", func(ctx *ActionContext) error {
+		for item := range ctx.Items() {
+			if err := ctx.EmitItem(strings.ToUpper(item.(string))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	var output []string
+	write := NewStage("output", "Output", "")
+	write.AddAction(NewActionFunc("write-output", "", func(ctx *ActionContext) error {
+		for item := range ctx.Items() {
+			output = append(output, item.(string))
+			if len(output) == 1 {
+				close(firstOutput)
+			}
+		}
+		return ctx.Store().Put("output", output)
+	}))
+
+	wf.AddStage(input)
+	wf.AddStage(process)
+	wf.AddStage(write)
+
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, []string{"ITEM1", "ITEM2", "ITEM3"}, output)
+	for _, id := range []string{"input", "process", "output"} {
+		assert.Equal(t, StatusCompleted, result.StageStatuses[id])
+	}
+	assert.Equal(t, []string{"ITEM1", "ITEM2", "ITEM3"}, result.FinalStore["output"])
+}
+
+func TestPipelineStrategyStopsProducers(t *testing.T) {
+	wf := NewWorkflow("pipeline", "Pipeline", "")
+	wf.SetExecutionStrategy(StrategyPipeline)
+
+	var emitted int
+	var stopErr error
+	producer := NewStage("produce", "Produce", "")
+	producer.AddAction(NewActionFunc("count", "", func(ctx *ActionContext) error {
+		for i := 0; ; i++ {
+			if err := ctx.EmitItem(i); err != nil {
+				stopErr = err
+				return nil
+			}
+			emitted++
+		}
+	}))
+	consumer := NewStage("consume", "Consume", "")
+	consumer.AddAction(NewActionFunc("first", "", func(ctx *ActionContext) error {
+		for item := range ctx.Items() {
+			return ctx.Store().Put("first", item)
+		}
+		return nil
+	}))
+	wf.AddStage(producer)
+	wf.AddStage(consumer)
+
+	require.NoError(t, NewRunner().Execute(context.Background(), wf, nil))
+	assert.ErrorIs(t, stopErr, ErrPipelineClosed)
+	assert.Less(t, emitted, 2*pipelineBuffer)
+	first, err := store.Get[int](wf.Store, "first")
+	require.NoError(t, err)
+	assert.Equal(t, 0, first)
+
+	// The last stage has no next stage
+	last := NewWorkflow("last", "Last", "")
+	last.SetExecutionStrategy(StrategyPipeline)
+	stage := NewStage("only", "Only", "")
+	stage.AddAction(NewActionFunc("emit", "", func(ctx *ActionContext) error {
+		return ctx.EmitItem(1)
+	}))
+	last.AddStage(stage)
+	err = NewRunner().Execute(context.Background(), last, nil)
+	assert.ErrorContains(t, err, "stage 'only' has no next stage to emit items to")
+
+	spawned := NewWorkflow("spawned", "Spawned", "")
+	spawned.SetExecutionStrategy(StrategyPipeline)
+	spawnedStage := NewStage("isolated", "Isolated", "")
+	spawnedStage.AddTag(TagSpawn)
+	spawnedStage.AddAction(NewActionFunc("noop", "", func(*ActionContext) error { return nil }))
+	spawned.AddStage(spawnedStage)
+	err = NewRunner().Execute(context.Background(), spawned, nil)
+	assert.EqualError(t, err, "stage 'isolated' cannot run in a child process or on a remote worker with the pipeline strategy")
+}
+
+func TestParallelStrategy(t *testing.T) {
+	wf := NewWorkflow("parallel", "Parallel", "")
+	wf.SetExecutionStrategy(StrategyParallel)
+
+	// Each stage waits for the other, which only works if they run at the same time
+	ready := map[string]chan struct{}{"a": make(chan struct{}), "b": make(chan struct{})}
+	for id, other := range map[string]string{"a": "b", "b": "a"} {
+		stage := NewStage(id, strings.ToUpper(id), "")
+		stage.AddAction(NewActionFunc("meet", "", func(ctx *ActionContext) error {
+			close(ready[id])
+			select {
+			case <-ready[other]:
+			case <-time.After(5 * time.Second):
+				return fmt.Errorf("stage '%s' never started", other)
+			}
+			return ctx.Store().Put(id, true)
+		}))
+		wf.AddStage(stage)
+	}
+	disabled := NewStage("disabled", "Disabled", "")
+	disabled.AddAction(NewActionFunc("never", "", func(*ActionContext) error { return errors.New("ran") }))
+	wf.AddStage(disabled)
+	wf.DisableStage("disabled")
+
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, true, result.FinalStore["a"])
+	assert.Equal(t, true, result.FinalStore["b"])
+	assert.Equal(t, StatusSkipped, result.StageStatuses["disabled"])
+}
+
+func TestParallelStrategyCancelsOnFailure(t *testing.T) {
+	wf := NewWorkflow("parallel", "Parallel", "")
+	wf.SetExecutionStrategy(StrategyParallel)
+
+	failing := NewStage("failing", "Failing", "")
+	failing.AddAction(NewActionFunc("fail", "", func(*ActionContext) error {
+		return errors.New("boom")
+	}))
+	waiting := NewStage("waiting", "Waiting", "")
+	waiting.AddAction(NewActionFunc("wait", "", func(ctx *ActionContext) error {
+		return ctx.Sleep(time.Minute)
+	}))
+	wf.AddStage(failing)
+	wf.AddStage(waiting)
+
+	result := NewRunner().ExecuteWithOptions(wf, DefaultRunOptions())
+	require.Error(t, result.Error)
+	assert.Contains(t, result.Error.Error(), "boom")
+	assert.Equal(t, StatusFailed, result.StageStatuses["failing"])
+	assert.Equal(t, StatusCancelled, result.StageStatuses["waiting"])
+
+	// Dynamic stages are not supported
+	dynamic := NewWorkflow("dynamic", "Dynamic", "")
+	dynamic.SetExecutionStrategy(StrategyParallel)
+	generator := NewStage("generator", "Generator", "")
+	generator.AddAction(NewActionFunc("generate", "", func(ctx *ActionContext) error {
+		ctx.AddDynamicStage(NewStage("generated", "Generated", ""))
+		return nil
+	}))
+	dynamic.AddStage(generator)
+	err := NewRunner().Execute(context.Background(), dynamic, nil)
+	assert.EqualError(t, err, "stage 'generator' generated dynamic stages, which the parallel strategy does not support")
+}
+
+func TestExecutionStrategySerialization(t *testing.T) {
+	for _, strategy := range []ExecutionStrategy{StrategySequential, StrategyParallel, StrategyPipeline} {
+		parsed, err := ParseExecutionStrategy(strategy.String())
+		require.NoError(t, err)
+		assert.Equal(t, strategy, parsed)
+	}
+	_, err := ParseExecutionStrategy("fanout")
+	assert.EqualError(t, err, "unknown execution strategy 'fanout'")
+
+	registry := newSerializationRegistry(t)
+	wf := NewWorkflow("streamed", "Streamed", "")
+	wf.SetExecutionStrategy(StrategyPipeline)
+	stage := NewStage("s", "S", "")
+	noop, err := registry.Resolve("noop", nil)
+	require.NoError(t, err)
+	stage.AddAction(noop)
+	wf.AddStage(stage)
+
+	data, err := wf.Marshal()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"strategy":"pipeline"`)
+
+	var def SubWorkflowDef
+	require.NoError(t, json.Unmarshal(data, &def))
+	restored, err := NewWorkflowFromDefWithRegistry(&def, registry)
+	require.NoError(t, err)
+	assert.Equal(t, StrategyPipeline, restored.ExecutionStrategy())
+}
+
+func TestParallelStrategyStoreStream(t *testing.T) {
+	wf := NewWorkflow("parallel", "Parallel", "")
+	wf.SetExecutionStrategy(StrategyParallel)
+	_, _, err := store.PutStream[int](wf.Store, "numbers", 1)
+	require.NoError(t, err)
+
+	producer := NewStage("produce", "Produce", "")
+	producer.AddAction(NewActionFunc("count", "", func(ctx *ActionContext) error {
+		send, _, err := store.GetStream[int](ctx.Store(), "numbers")
+		if err != nil {
+			return err
+		}
+		defer send.Close()
+		for i := 1; i <= 100; i++ {
+			if err := send.Send(ctx.GoContext, i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	consumer := NewStage("consume", "Consume", "")
+	consumer.AddAction(NewActionFunc("sum", "", func(ctx *ActionContext) error {
+		_, receive, err := store.GetStream[int](ctx.Store(), "numbers")
+		if err != nil {
+			return err
+		}
+		sum := 0
+		for n := range receive.Items(ctx.GoContext) {
+			sum += n
+		}
+		return ctx.Store().Put("sum", sum)
+	}))
+	wf.AddStage(producer)
+	wf.AddStage(consumer)
+
+	require.NoError(t, NewRunner().Execute(context.Background(), wf, nil))
+	sum, err := store.Get[int](wf.Store, "sum")
+	require.NoError(t, err)
+	assert.Equal(t, 5050, sum)
+}
@@ -1,6 +1,10 @@
 package gostage
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
 
 // ActionDef is a serializable representation of an Action.
 // It uses a registered ID to identify the action type and can hold
@@ -14,9 +18,13 @@ type ActionDef struct {
 	Description string `json:"description,omitempty"`
 	// Tags will be merged with the default tags of the registered action.
 	Tags []string `json:"tags,omitempty"`
+	// Annotations are key/value metadata set on the action.
+	Annotations map[string]string `json:"annotations,omitempty"`
 	// Params are arbitrary key-value pairs that can be passed to the action
 	// via the ActionContext's store.
 	Params map[string]interface{} `json:"params,omitempty"`
+	// Disabled marks the action as disabled in the resulting workflow.
+	Disabled bool `json:"disabled,omitempty"`
 }
 
 // StageDef is a serializable representation of a Stage.
@@ -29,8 +37,38 @@ type StageDef struct {
 	Description string `json:"description,omitempty"`
 	// Tags for organization and filtering.
 	Tags []string `json:"tags,omitempty"`
+	// Annotations are key/value metadata set on the stage.
+	Annotations map[string]string `json:"annotations,omitempty"`
 	// Actions is an ordered list of action definitions for this stage.
 	Actions []ActionDef `json:"actions"`
+	// InitialStore contains key-value data merged into the workflow's store
+	// when the stage starts. Values must be JSON-serializable.
+	InitialStore map[string]interface{} `json:"initialStore,omitempty"`
+	// MergePolicy decides how InitialStore is merged into a store already
+	// holding some of its keys. The default is MergeOverride.
+	MergePolicy MergePolicy `json:"mergePolicy,omitempty"`
+	// Disabled marks the stage as disabled in the resulting workflow.
+	Disabled bool `json:"disabled,omitempty"`
+	// Consumes maps store keys the stage reads to the JSON Schemas they must
+	// match when the stage starts.
+	Consumes map[string]json.RawMessage `json:"consumes,omitempty"`
+	// Produces maps store keys the stage writes to the JSON Schemas they must
+	// match when the stage completes.
+	Produces map[string]json.RawMessage `json:"produces,omitempty"`
+}
+
+// ParamDef is a serializable representation of a workflow Param.
+type ParamDef struct {
+	// Name is the parameter name.
+	Name string `json:"name"`
+	// Description explains what the parameter controls.
+	Description string `json:"description,omitempty"`
+	// Required parameters must be supplied unless they have a default.
+	Required bool `json:"required,omitempty"`
+	// Default is used when the parameter is not supplied. Nil means no default.
+	Default interface{} `json:"default,omitempty"`
+	// Type is the type of the values of the parameter.
+	Type ParamType `json:"type,omitempty"`
 }
 
 // SubWorkflowDef is a serializable representation of a Workflow.
@@ -43,19 +81,62 @@ type SubWorkflowDef struct {
 	Name string `json:"name,omitempty"`
 	// Description provides details about the workflow's purpose.
 	Description string `json:"description,omitempty"`
+	// Version identifies the revision of the workflow definition.
+	Version string `json:"version,omitempty"`
 	// Tags for organization and filtering.
 	Tags []string `json:"tags,omitempty"`
+	// Annotations are key/value metadata set on the workflow.
+	Annotations map[string]string `json:"annotations,omitempty"`
 	// Stages contains all the workflow's stage definitions in execution order.
 	Stages []StageDef `json:"stages"`
 	// InitialStore contains key-value data that will be loaded into the
 	// workflow's store before execution begins. Values must be JSON-serializable.
 	InitialStore map[string]interface{} `json:"initialStore,omitempty"`
+	// Params declares the parameters accepted by the workflow.
+	Params []ParamDef `json:"params,omitempty"`
+	// Deadline is the time the workflow must finish by, if any.
+	Deadline *time.Time `json:"deadline,omitempty"`
+	// MaxDuration is the longest a run of the workflow may last, if not zero.
+	MaxDuration time.Duration `json:"maxDuration,omitempty"`
+	// Strategy decides how the stages are run.
+	Strategy ExecutionStrategy `json:"strategy,omitempty"`
 }
 
 // NewWorkflowFromDef creates a new Workflow instance from a SubWorkflowDef.
-// It uses the action registry to instantiate the correct action types.
+// It uses the default action registry to instantiate the correct action types.
 func NewWorkflowFromDef(def *SubWorkflowDef) (*Workflow, error) {
+	return NewWorkflowFromDefWithRegistry(def, defaultActionRegistry)
+}
+
+// NewWorkflowFromDefWithRegistry creates a new Workflow instance from a SubWorkflowDef,
+// resolving actions and their parameters through the given registry.
+func NewWorkflowFromDefWithRegistry(def *SubWorkflowDef, registry *ActionRegistry) (*Workflow, error) {
+	if registry == nil {
+		registry = defaultActionRegistry
+	}
+
 	wf := NewWorkflowWithTags(def.ID, def.Name, def.Description, def.Tags)
+	if def.Version != "" {
+		wf.Version = def.Version
+		wf.saveToStore()
+	}
+	wf.annotations = copyAnnotations(def.Annotations)
+	if def.Deadline != nil {
+		wf.SetDeadline(*def.Deadline)
+	}
+	wf.SetMaxDuration(def.MaxDuration)
+	wf.SetExecutionStrategy(def.Strategy)
+
+	for _, paramDef := range def.Params {
+		opts := []ParamOption{Describe(paramDef.Description), OfType(paramDef.Type)}
+		if paramDef.Required {
+			opts = append(opts, Required)
+		}
+		if paramDef.Default != nil {
+			opts = append(opts, Default(paramDef.Default))
+		}
+		wf.AddParam(paramDef.Name, opts...)
+	}
 
 	// Populate the initial store
 	if def.InitialStore != nil {
@@ -68,8 +149,26 @@ func NewWorkflowFromDef(def *SubWorkflowDef) (*Workflow, error) {
 
 	for _, stageDef := range def.Stages {
 		stage := NewStageWithTags(stageDef.ID, stageDef.Name, stageDef.Description, stageDef.Tags)
+		stage.annotations = copyAnnotations(stageDef.Annotations)
+		stage.mergePolicy = stageDef.MergePolicy
+		for key, schema := range stageDef.Consumes {
+			if err := stage.Consumes(key, schema); err != nil {
+				return nil, err
+			}
+		}
+		for key, schema := range stageDef.Produces {
+			if err := stage.Produces(key, schema); err != nil {
+				return nil, err
+			}
+		}
+		for key, value := range stageDef.InitialStore {
+			if err := stage.SetInitialData(key, value); err != nil {
+				return nil, fmt.Errorf("stage '%s': failed to set initial data '%s': %w", stageDef.ID, key, err)
+			}
+		}
+
 		for _, actionDef := range stageDef.Actions {
-			action, err := NewActionFromRegistry(actionDef.ID)
+			action, err := registry.Resolve(actionDef.ID, actionDef.Params)
 			if err != nil {
 				return nil, err
 			}
@@ -82,25 +181,33 @@ func NewWorkflowFromDef(def *SubWorkflowDef) (*Workflow, error) {
 				if actionDef.Description != "" {
 					base.description = actionDef.Description
 				}
-				if len(actionDef.Tags) > 0 {
-					base.tags = append(base.tags, actionDef.Tags...)
+				for _, tag := range actionDef.Tags {
+					base.AddTag(tag)
+				}
+				for key, value := range actionDef.Annotations {
+					base.SetAnnotation(key, value)
 				}
 			}
 
-			// It's a bit tricky to apply params directly here.
-			// The action itself should be responsible for looking for its params
-			// in the store during its Execute method.
+			// Typed factories receive the params directly, but they are also
+			// published in the store for actions that read them at execution time.
 			// We can prefix them to avoid collisions.
 			if actionDef.Params != nil {
 				for pKey, pValue := range actionDef.Params {
-					storeKey := fmt.Sprintf("param:%s:%s", actionDef.ID, pKey)
+					storeKey := fmt.Sprintf("%s%s:%s", PrefixParam, actionDef.ID, pKey)
 					wf.Store.Put(storeKey, pValue)
 				}
 			}
 
 			stage.AddAction(action)
+			if actionDef.Disabled {
+				wf.DisableAction(action.Name())
+			}
 		}
 		wf.AddStage(stage)
+		if stageDef.Disabled {
+			wf.DisableStage(stage.ID)
+		}
 	}
 
 	return wf, nil
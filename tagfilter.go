@@ -0,0 +1,228 @@
+package gostage
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TagFilter selects the stages and actions a run executes by their tags.
+//
+// An action is matched against its own tags and the tags of its stage. A
+// stage runs if its tags match or if one of its actions matches, and only its
+// matching actions run. Stages and actions that do not match are skipped.
+// An empty filter selects everything.
+type TagFilter struct {
+	// Expression combines tags with &&, ||, ! and parentheses, as in
+	// "deploy && !experimental"
+	Expression string
+	// Include selects items with at least one of these tags
+	Include []string
+	// Exclude skips items with any of these tags
+	Exclude []string
+}
+
+// IsEmpty reports whether the filter selects everything.
+func (f TagFilter) IsEmpty() bool {
+	return strings.TrimSpace(f.Expression) == "" && len(f.Include) == 0 && len(f.Exclude) == 0
+}
+
+// Match reports whether an item with the given tags is selected by the filter.
+// It fails if the expression is invalid.
+func (f TagFilter) Match(tags []string) (bool, error) {
+	matcher, err := f.compile()
+	if err != nil {
+		return false, err
+	}
+	if matcher == nil {
+		return true, nil
+	}
+	return matcher.match(tags), nil
+}
+
+// tagMatcher is a compiled TagFilter.
+type tagMatcher struct {
+	expression tagNode
+	include    []string
+	exclude    []string
+}
+
+// compile parses the expression of the filter, returning nil for an empty filter.
+func (f TagFilter) compile() (*tagMatcher, error) {
+	if f.IsEmpty() {
+		return nil, nil
+	}
+	matcher := &tagMatcher{include: f.Include, exclude: f.Exclude}
+	if strings.TrimSpace(f.Expression) != "" {
+		expression, err := ParseTagExpression(f.Expression)
+		if err != nil {
+			return nil, err
+		}
+		matcher.expression = expression.root
+	}
+	return matcher, nil
+}
+
+func (m *tagMatcher) match(tags []string) bool {
+	set := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		set[tag] = true
+	}
+	for _, tag := range m.exclude {
+		if set[tag] {
+			return false
+		}
+	}
+	if len(m.include) > 0 {
+		included := false
+		for _, tag := range m.include {
+			included = included || set[tag]
+		}
+		if !included {
+			return false
+		}
+	}
+	return m.expression == nil || m.expression.eval(set)
+}
+
+// TagExpression is a parsed tag expression.
+type TagExpression struct {
+	source string
+	root   tagNode
+}
+
+// ParseTagExpression parses an expression combining tags with && (and), ||
+// (or), ! (not) and parentheses. A tag is any run of characters other than
+// spaces, &, |, ! and parentheses.
+func ParseTagExpression(expression string) (TagExpression, error) {
+	p := &tagParser{tokens: tokenizeTags(expression)}
+	root, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected '%s'", p.tokens[p.pos])
+	}
+	if err != nil {
+		return TagExpression{}, fmt.Errorf("invalid tag expression %q: %w", expression, err)
+	}
+	return TagExpression{source: expression, root: root}, nil
+}
+
+// Match reports whether the tags satisfy the expression.
+func (e TagExpression) Match(tags []string) bool {
+	set := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		set[tag] = true
+	}
+	return e.root == nil || e.root.eval(set)
+}
+
+// String returns the expression as it was parsed.
+func (e TagExpression) String() string {
+	return e.source
+}
+
+// tagNode is a node of a parsed tag expression.
+type tagNode interface {
+	eval(tags map[string]bool) bool
+}
+
+type tagLeaf string
+
+func (n tagLeaf) eval(tags map[string]bool) bool { return tags[string(n)] }
+
+type tagNot struct{ operand tagNode }
+
+func (n tagNot) eval(tags map[string]bool) bool { return !n.operand.eval(tags) }
+
+type tagAnd struct{ left, right tagNode }
+
+func (n tagAnd) eval(tags map[string]bool) bool { return n.left.eval(tags) && n.right.eval(tags) }
+
+type tagOr struct{ left, right tagNode }
+
+func (n tagOr) eval(tags map[string]bool) bool { return n.left.eval(tags) || n.right.eval(tags) }
+
+// tokenizeTags splits an expression into operators, parentheses and tags.
+func tokenizeTags(expression string) []string {
+	var tokens []string
+	for i := 0; i < len(expression); {
+		switch c := expression[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case strings.HasPrefix(expression[i:], "&&") || strings.HasPrefix(expression[i:], "||"):
+			tokens = append(tokens, expression[i:i+2])
+			i += 2
+		case strings.ContainsRune("&|!()", rune(c)):
+			tokens = append(tokens, string(c))
+			i++
+		default:
+			start := i
+			for i < len(expression) && !strings.ContainsRune(" \t\n&|!()", rune(expression[i])) {
+				i++
+			}
+			tokens = append(tokens, expression[start:i])
+		}
+	}
+	return tokens
+}
+
+// tagParser parses tokens by precedence: ! binds tighter than &&, which binds
+// tighter than ||.
+type tagParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *tagParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *tagParser) parseOr() (tagNode, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.peek() == "||" {
+		p.pos++
+		var right tagNode
+		right, err = p.parseAnd()
+		left = tagOr{left, right}
+	}
+	return left, err
+}
+
+func (p *tagParser) parseAnd() (tagNode, error) {
+	left, err := p.parseUnary()
+	for err == nil && p.peek() == "&&" {
+		p.pos++
+		var right tagNode
+		right, err = p.parseUnary()
+		left = tagAnd{left, right}
+	}
+	return left, err
+}
+
+func (p *tagParser) parseUnary() (tagNode, error) {
+	token := p.peek()
+	switch token {
+	case "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case "!":
+		p.pos++
+		operand, err := p.parseUnary()
+		return tagNot{operand}, err
+	case "(":
+		p.pos++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing ')'")
+		}
+		p.pos++
+		return node, nil
+	case "&&", "||", ")", "&", "|":
+		return nil, fmt.Errorf("unexpected '%s'", token)
+	}
+	p.pos++
+	return tagLeaf(token), nil
+}
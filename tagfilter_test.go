@@ -0,0 +1,103 @@
+package gostage
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTagExpression(t *testing.T) {
+	for expression, cases := range map[string]map[string]bool{
+		"deploy":                           {"deploy": true, "": false},
+		"deploy && !experimental":          {"deploy": true, "deploy experimental": false, "experimental": false},
+		"smoke || full":                    {"smoke": true, "full": true, "cleanup": false},
+		"a || b && c":                      {"a": true, "b": false, "b c": true},
+		"(a || b) && !(c || d)":            {"a": true, "b c": false, "d": false},
+		"!!env:prod && region/eu-west-1.a": {"env:prod region/eu-west-1.a": true, "env:prod": false},
+	} {
+		parsed, err := ParseTagExpression(expression)
+		require.NoError(t, err, expression)
+		assert.Equal(t, expression, parsed.String())
+		for tags, expected := range cases {
+			list := strings.Fields(tags)
+			assert.Equal(t, expected, parsed.Match(list), "%s with %v", expression, list)
+		}
+	}
+
+	for expression, message := range map[string]string{
+		"":               "unexpected end of expression",
+		"deploy &&":      "unexpected end of expression",
+		"(deploy":        "missing ')'",
+		"deploy)":        "unexpected ')'",
+		"deploy & smoke": "unexpected '&'",
+		"deploy smoke":   "unexpected 'smoke'",
+		"|| deploy":      "unexpected '||'",
+	} {
+		_, err := ParseTagExpression(expression)
+		assert.ErrorContains(t, err, message, expression)
+	}
+}
+
+func TestRunTagFilter(t *testing.T) {
+	newWorkflow := func(ran *[]string) *Workflow {
+		wf := NewWorkflow("profiles", "Profiles", "")
+
+		build := NewStageWithTags("build", "Build", "", []string{"full", "smoke"})
+		build.AddAction(recordAction("compile", ran))
+		lint := recordAction("lint", ran)
+		GetActionBaseFields(lint).AddTag("slow")
+		build.AddAction(lint)
+		wf.AddStage(build)
+
+		deploy := NewStage("deploy", "Deploy", "")
+		canary := recordAction("canary", ran)
+		GetActionBaseFields(canary).AddTag("experimental")
+		deploy.AddAction(canary)
+		apply := recordAction("apply", ran)
+		GetActionBaseFields(apply).AddTag("full")
+		deploy.AddAction(apply)
+		wf.AddStage(deploy)
+
+		wf.AddStage(NewStageWithTags("cleanup", "Cleanup", "", []string{"cleanup"}))
+		return wf
+	}
+
+	for name, tc := range map[string]struct {
+		filter  TagFilter
+		ran     []string
+		skipped []string
+	}{
+		"empty":      {TagFilter{}, []string{"compile", "lint", "canary", "apply"}, nil},
+		"expression": {TagFilter{Expression: "full && !slow && !experimental"}, []string{"compile", "apply"}, []string{"cleanup"}},
+		"smoke":      {TagFilter{Include: []string{"smoke"}, Exclude: []string{"slow"}}, []string{"compile"}, []string{"deploy", "cleanup"}},
+		"cleanup":    {TagFilter{Include: []string{"cleanup"}}, nil, []string{"build", "deploy"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var ran []string
+			wf := newWorkflow(&ran)
+			options := DefaultRunOptions()
+			options.TagFilter = tc.filter
+			result := NewRunner().ExecuteWithOptions(wf, options)
+			require.True(t, result.Success, "%v", result.Error)
+			assert.Equal(t, tc.ran, ran)
+			for _, stageID := range tc.skipped {
+				assert.Equal(t, StatusSkipped, result.StageStatuses[stageID], stageID)
+			}
+
+			// The filter only applies to the run it was given to
+			assert.NotContains(t, wf.Context, runSelectionContextKey)
+			assert.True(t, wf.IsStageEnabled("cleanup"))
+		})
+	}
+
+	var ran []string
+	result := NewRunner().ExecuteWithOptions(newWorkflow(&ran), RunOptions{TagFilter: TagFilter{Expression: "full &&"}})
+	assert.ErrorContains(t, result.Error, `invalid tag expression "full &&"`)
+	assert.Empty(t, ran)
+
+	matched, err := TagFilter{Expression: "a", Exclude: []string{"b"}}.Match([]string{"a", "b"})
+	require.NoError(t, err)
+	assert.False(t, matched)
+}
@@ -0,0 +1,237 @@
+package gostage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/davidroman0O/gostage/store"
+)
+
+// RenderTemplate renders text as a Go template against the current values of the store.
+// Store values are exposed under .store, so "{{ .store.region }}" renders the value of
+// the "region" key and "{{ index .store \"param:x\" }}" reaches keys that are not valid
+// identifiers. Referencing a missing key is an error.
+func RenderTemplate(text string, s *store.KVStore) (string, error) {
+	if !isTemplate(text) {
+		return text, nil
+	}
+	return renderString(text, templateData(s))
+}
+
+// RunInfo describes the run an action belongs to. Templates rendered from an
+// action context expose it under .run, so "{{ .run.Status }}" renders the
+// status of the workflow.
+type RunInfo struct {
+	WorkflowID   string
+	WorkflowName string
+	StageID      string
+	StageName    string
+	ActionName   string
+	// Status is the status of the workflow, which is already failed or
+	// interrupted when an always-run stage executes after a failure
+	Status string
+	// FailedStages holds the IDs of the stages that failed so far
+	FailedStages []string
+}
+
+// Run returns information about the run of the current action.
+func (ctx *ActionContext) Run() RunInfo {
+	var info RunInfo
+	if ctx.Workflow != nil {
+		info.WorkflowID = ctx.Workflow.ID
+		info.WorkflowName = ctx.Workflow.Name
+		if status, err := ctx.Workflow.Store.GetProperty(PrefixWorkflow+ctx.Workflow.ID, PropStatus); err == nil {
+			info.Status, _ = status.(string)
+		}
+		for _, stage := range ctx.Workflow.ListStagesByStatus(StatusFailed) {
+			info.FailedStages = append(info.FailedStages, stage.ID)
+		}
+		sort.Strings(info.FailedStages)
+	}
+	if ctx.Stage != nil {
+		info.StageID = ctx.Stage.ID
+		info.StageName = ctx.Stage.Name
+	}
+	if ctx.Action != nil {
+		info.ActionName = ctx.Action.Name()
+	}
+	return info
+}
+
+// Render renders text as a template against the workflow store, with the
+// run of the action exposed under .run.
+func (ctx *ActionContext) Render(text string) (string, error) {
+	if !isTemplate(text) {
+		return text, nil
+	}
+	return renderString(text, ctx.templateData())
+}
+
+// templateData builds the data passed to templates rendered from the action context.
+func (ctx *ActionContext) templateData() map[string]interface{} {
+	data := templateData(ctx.Store())
+	data["run"] = ctx.Run()
+	return data
+}
+
+// Params returns the definition parameters of the current action with
+// any template placeholders rendered against the live store.
+// It returns nil if the action was not created from a registry or has no parameters.
+func (ctx *ActionContext) Params() (map[string]interface{}, error) {
+	base := GetActionBaseFields(ctx.Action)
+	if base == nil || len(base.params) == 0 {
+		return nil, nil
+	}
+
+	rendered, err := renderValue(base.params, ctx.templateData())
+	if err != nil {
+		return nil, fmt.Errorf("failed to render params of action '%s': %w", ctx.Action.Name(), err)
+	}
+	return rendered.(map[string]interface{}), nil
+}
+
+// ActionParams decodes the rendered parameters of the current action into P.
+// Parameters are converted through JSON, so P can use json struct tags.
+func ActionParams[P any](ctx *ActionContext) (P, error) {
+	var params P
+
+	raw, err := ctx.Params()
+	if err != nil || raw == nil {
+		return params, err
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return params, fmt.Errorf("failed to encode params of action '%s': %w", ctx.Action.Name(), err)
+	}
+	if err := json.Unmarshal(data, &params); err != nil {
+		return params, fmt.Errorf("failed to decode params of action '%s': %w", ctx.Action.Name(), err)
+	}
+	return params, nil
+}
+
+// publishActionParams renders the parameters of an action and writes them to
+// the store under their param: keys, right before the action executes.
+func publishActionParams(ctx *ActionContext, action Action) error {
+	base := GetActionBaseFields(action)
+	if base == nil || base.registryID == "" || !hasTemplate(base.params) {
+		return nil
+	}
+
+	rendered, err := ctx.Params()
+	if err != nil {
+		return err
+	}
+	for key, value := range rendered {
+		storeKey := fmt.Sprintf("%s%s:%s", PrefixParam, base.registryID, key)
+		if err := ctx.Store().Put(storeKey, value); err != nil {
+			return fmt.Errorf("failed to publish param '%s': %w", key, err)
+		}
+	}
+	return nil
+}
+
+// renderInitialData renders templated values of a stage's initial store against
+// the workflow store and writes the results into the workflow store, except for
+// the skipped keys.
+func renderInitialData(initial *store.KVStore, target *store.KVStore, skipped map[string]bool) error {
+	var data map[string]interface{}
+	for key, value := range initial.ExportAll() {
+		if skipped[key] || !hasTemplate(value) {
+			continue
+		}
+		if data == nil {
+			data = templateData(target)
+		}
+
+		rendered, err := renderValue(value, data)
+		if err != nil {
+			return fmt.Errorf("failed to render initial data '%s': %w", key, err)
+		}
+		if err := target.Put(key, rendered); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// templateData builds the data passed to templates.
+func templateData(s *store.KVStore) map[string]interface{} {
+	return map[string]interface{}{"store": s.ExportAll()}
+}
+
+// renderValue renders strings found in value, descending into maps and slices
+// produced by JSON or YAML decoding. Other values are returned unchanged.
+func renderValue(value interface{}, data map[string]interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if !isTemplate(v) {
+			return v, nil
+		}
+		return renderString(v, data)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			rendered, err := renderValue(item, data)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = rendered
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			rendered, err := renderValue(item, data)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = rendered
+		}
+		return out, nil
+	default:
+		return value, nil
+	}
+}
+
+// hasTemplate reports whether value contains a string with template placeholders.
+func hasTemplate(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		return isTemplate(v)
+	case map[string]interface{}:
+		for _, item := range v {
+			if hasTemplate(item) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if hasTemplate(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isTemplate(text string) bool {
+	return strings.Contains(text, "{{")
+}
+
+func renderString(text string, data map[string]interface{}) (string, error) {
+	tmpl, err := template.New("gostage").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid template %q: %w", text, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render template %q: %w", text, err)
+	}
+	return buf.String(), nil
+}
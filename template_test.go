@@ -0,0 +1,116 @@
+package gostage
+
+import (
+	"testing"
+
+	"github.com/davidroman0O/gostage/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type renderedParamsAction struct{ BaseAction }
+
+func (a *renderedParamsAction) Execute(ctx *ActionContext) error {
+	params, err := ActionParams[httpGetParams](ctx)
+	if err != nil {
+		return err
+	}
+	return ctx.Store().Put("fetched", params.URL)
+}
+
+func TestRenderTemplate(t *testing.T) {
+	s := store.NewKVStore()
+	s.Put("region", "eu-west-1")
+	s.Put("param:x", 3)
+
+	out, err := RenderTemplate("deploy to {{ .store.region }} x{{ index .store \"param:x\" }}", s)
+	require.NoError(t, err)
+	assert.Equal(t, "deploy to eu-west-1 x3", out)
+
+	out, err = RenderTemplate("no placeholders", s)
+	require.NoError(t, err)
+	assert.Equal(t, "no placeholders", out)
+
+	_, err = RenderTemplate("{{ .store.missing }}", s)
+	assert.Error(t, err)
+}
+
+func TestTemplatedParamsAndInitialData(t *testing.T) {
+	registry := NewActionRegistry()
+	require.NoError(t, registry.Register("fetch", func() Action {
+		return &renderedParamsAction{BaseAction: NewBaseAction("fetch", "fetch a rendered URL")}
+	}))
+	require.NoError(t, registry.Register("produce", func() Action {
+		return NewTestAction("produce", "writes the bucket", func(ctx *ActionContext) error {
+			return ctx.Store().Put("bucket", "artifacts-42")
+		})
+	}))
+
+	wf, err := NewWorkflowFromDefWithRegistry(&SubWorkflowDef{
+		ID: "templated",
+		Stages: []StageDef{
+			{ID: "produce", Actions: []ActionDef{{ID: "produce"}}},
+			{
+				ID:           "consume",
+				InitialStore: map[string]interface{}{"target": "s3://{{ .store.bucket }}/out"},
+				Actions: []ActionDef{{
+					ID:     "fetch",
+					Params: map[string]interface{}{"url": "https://{{ .store.bucket }}.example.com"},
+				}},
+			},
+		},
+	}, registry)
+	require.NoError(t, err)
+
+	result := RunWorkflow(wf, DefaultRunOptions())
+	require.NoError(t, result.Error)
+
+	assert.Equal(t, "s3://artifacts-42/out", result.FinalStore["target"])
+	assert.Equal(t, "https://artifacts-42.example.com", result.FinalStore["fetched"])
+	assert.Equal(t, "https://artifacts-42.example.com", result.FinalStore["param:fetch:url"])
+}
+
+func TestTemplatedParamsMissingKey(t *testing.T) {
+	registry := NewActionRegistry()
+	require.NoError(t, registry.Register("fetch", func() Action {
+		return &renderedParamsAction{BaseAction: NewBaseAction("fetch", "fetch a rendered URL")}
+	}))
+
+	wf, err := NewWorkflowFromDefWithRegistry(&SubWorkflowDef{
+		ID: "broken",
+		Stages: []StageDef{{
+			ID:      "s",
+			Actions: []ActionDef{{ID: "fetch", Params: map[string]interface{}{"url": "{{ .store.nope }}"}}},
+		}},
+	}, registry)
+	require.NoError(t, err)
+
+	result := RunWorkflow(wf, DefaultRunOptions())
+	assert.ErrorContains(t, result.Error, "failed to render params")
+}
+
+func TestRenderExposesRun(t *testing.T) {
+	var rendered []string
+	report := func(ctx *ActionContext) error {
+		text, err := ctx.Render("{{ .run.WorkflowName }}/{{ .run.StageID }}/{{ .run.ActionName }}: {{ .run.Status }} {{ .run.FailedStages }}")
+		rendered = append(rendered, text)
+		return err
+	}
+
+	wf := NewWorkflow("release", "Release", "")
+	build := NewStage("build", "Build", "")
+	build.AddAction(NewTestAction("compile", "", report))
+	build.AddAction(NewTestAction("test", "", func(ctx *ActionContext) error { return assert.AnError }))
+	cleanup := NewStage("cleanup", "Cleanup", "")
+	cleanup.AddTag(TagAlwaysRun)
+	cleanup.AddAction(NewTestAction("notify", "", report))
+	wf.AddStage(build)
+	wf.AddStage(cleanup)
+
+	result := RunWorkflow(wf, DefaultRunOptions())
+	require.Error(t, result.Error)
+	assert.Equal(t, []string{
+		"Release/build/compile: running []",
+		"Release/cleanup/notify: failed [build]",
+	}, rendered)
+}
@@ -0,0 +1,146 @@
+package gostage
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/davidroman0O/gostage/history"
+	"github.com/davidroman0O/gostage/lock"
+	"github.com/davidroman0O/gostage/store"
+)
+
+// tenantPattern restricts tenant names to characters that are safe in file
+// names and never occur in the separators of partitioned keys
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// WithTenant scopes the runner to a tenant, so that runners of several tenants
+// can share their backends in one service without seeing each other's data:
+//
+//   - workflow leases are keyed by tenant, so tenants may reuse workflow IDs
+//   - the history records runs as the tenant's and only returns those
+//   - WAL logs, idempotency keys and pending delayed runs are kept apart
+//
+// The runs, events and log lines of the runner carry the tenant too. Give the
+// backends to the runner with their options; they are partitioned once the
+// runner is created. It panics if tenant is not made of letters, digits, '-'
+// and '_'.
+func WithTenant(tenant string) RunnerOption {
+	if !tenantPattern.MatchString(tenant) {
+		panic(fmt.Sprintf("invalid tenant '%s': only letters, digits, '-' and '_' are allowed", tenant))
+	}
+	return func(r *Runner) {
+		r.tenant = tenant
+	}
+}
+
+// Tenant returns the tenant the runner is scoped to, or "" if it is not.
+func (r *Runner) Tenant() string {
+	return r.tenant
+}
+
+// Tenant returns the tenant of the runner executing the action, or "".
+func (ctx *ActionContext) Tenant() string {
+	if ctx.Workflow == nil {
+		return ""
+	}
+	if r, ok := ctx.Workflow.Context["runner"].(*Runner); ok {
+		return r.tenant
+	}
+	return ""
+}
+
+// partitionBackends scopes the backends of the runner to its tenant. It is
+// called once the options of NewRunner are applied.
+func (r *Runner) partitionBackends() {
+	if r.tenant == "" {
+		return
+	}
+	if r.locks != nil {
+		r.locks = &tenantLocks{provider: r.locks, prefix: r.tenant + "/"}
+	}
+	if r.history != nil {
+		r.history = history.ForTenant(r.history, r.tenant)
+	}
+	if r.wal != nil {
+		r.wal = &tenantWAL{wal: r.wal, prefix: r.tenant + "."}
+	}
+	if r.idempotency != nil {
+		r.idempotency = &tenantIdempotency{store: r.idempotency, prefix: r.tenant + "/"}
+	}
+	if r.delayed.backend != nil {
+		r.delayed.backend = store.NewPrefixBlobBackend(r.delayed.backend, r.tenant+".")
+	}
+}
+
+// tenantLocks leases the keys of a tenant in a shared lock provider.
+type tenantLocks struct {
+	provider lock.Provider
+	prefix   string
+}
+
+func (l *tenantLocks) Acquire(ctx context.Context, key string, ttl time.Duration) (lock.Lease, error) {
+	return l.provider.Acquire(ctx, l.prefix+key, ttl)
+}
+
+// tenantWAL keeps the logs of a tenant in a shared WAL, under run IDs
+// prefixed with the tenant.
+type tenantWAL struct {
+	wal    WAL
+	prefix string
+}
+
+func (l *tenantWAL) Append(record WALRecord) error {
+	record.RunID = l.prefix + record.RunID
+	return l.wal.Append(record)
+}
+
+func (l *tenantWAL) Read(runID string) ([]WALRecord, error) {
+	records, err := l.wal.Read(l.prefix + runID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range records {
+		records[i].RunID = strings.TrimPrefix(records[i].RunID, l.prefix)
+	}
+	return records, nil
+}
+
+func (l *tenantWAL) Runs() ([]string, error) {
+	runIDs, err := l.wal.Runs()
+	if err != nil {
+		return nil, err
+	}
+	owned := runIDs[:0]
+	for _, runID := range runIDs {
+		if strings.HasPrefix(runID, l.prefix) {
+			owned = append(owned, strings.TrimPrefix(runID, l.prefix))
+		}
+	}
+	return owned, nil
+}
+
+func (l *tenantWAL) Remove(runID string) error {
+	return l.wal.Remove(l.prefix + runID)
+}
+
+// tenantIdempotency records the keys of a tenant in a shared idempotency store.
+type tenantIdempotency struct {
+	store  IdempotencyStore
+	prefix string
+}
+
+func (s *tenantIdempotency) Get(key string) (*IdempotencyRecord, error) {
+	record, err := s.store.Get(s.prefix + key)
+	if record != nil {
+		record.Key = key
+	}
+	return record, err
+}
+
+func (s *tenantIdempotency) Put(record IdempotencyRecord) error {
+	record.Key = s.prefix + record.Key
+	return s.store.Put(record)
+}
@@ -0,0 +1,157 @@
+package gostage
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/davidroman0O/gostage/history"
+	"github.com/davidroman0O/gostage/lock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithTenantRejectsInvalidNames(t *testing.T) {
+	assert.Panics(t, func() { WithTenant("") })
+	assert.Panics(t, func() { WithTenant("team/a") })
+	assert.Panics(t, func() { WithTenant("team.a") })
+	assert.NotPanics(t, func() { WithTenant("team_a-1") })
+
+	assert.Equal(t, "", NewRunner().Tenant())
+	assert.Equal(t, "team-a", NewRunner(WithTenant("team-a")).Tenant())
+}
+
+func TestTenantsShareLocks(t *testing.T) {
+	provider := lock.NewMemoryProvider()
+	teamA := NewRunner(WithTenant("team-a"), WithLockProvider(provider))
+	teamB := NewRunner(WithTenant("team-b"), WithLockProvider(provider))
+
+	// Both tenants run a workflow with the same ID at the same time
+	started := make(chan struct{})
+	proceed := make(chan struct{})
+	blocking := NewWorkflow("nightly", "Nightly", "")
+	stage := NewStage("work", "Work", "")
+	stage.AddAction(NewTestAction("block", "", func(ctx *ActionContext) error {
+		close(started)
+		<-proceed
+		return nil
+	}))
+	blocking.AddStage(stage)
+
+	done := make(chan error, 1)
+	go func() { done <- teamA.Execute(context.Background(), blocking, nil) }()
+	<-started
+
+	require.NoError(t, teamB.Execute(context.Background(), newLockedWorkflow(), nil))
+
+	// Within a tenant, the workflow is still locked
+	err := NewRunner(WithTenant("team-a"), WithLockProvider(provider)).Execute(context.Background(), newLockedWorkflow(), nil)
+	assert.ErrorIs(t, err, lock.ErrNotAcquired)
+
+	close(proceed)
+	require.NoError(t, <-done)
+}
+
+func TestTenantsShareHistory(t *testing.T) {
+	shared := history.NewMemoryStore()
+	wal, err := NewFileWAL(t.TempDir())
+	require.NoError(t, err)
+	teamA := NewRunner(WithTenant("team-a"), WithHistory(shared), WithWAL(wal))
+	teamB := NewRunner(WithTenant("team-b"), WithHistory(shared), WithWAL(wal))
+
+	registry := newSerializationRegistry(t)
+	newWorkflow := func() *Workflow {
+		wf := NewWorkflow("nightly", "Nightly", "")
+		stage := NewStage("work", "Work", "")
+		noop, err := registry.Resolve("noop", nil)
+		require.NoError(t, err)
+		stage.AddAction(noop)
+		wf.AddStage(stage)
+		return wf
+	}
+
+	resultA := teamA.ExecuteWithOptions(newWorkflow(), DefaultRunOptions())
+	require.True(t, resultA.Success, "%v", resultA.Error)
+	resultB := teamB.ExecuteWithOptions(newWorkflow(), DefaultRunOptions())
+	require.True(t, resultB.Success, "%v", resultB.Error)
+
+	run, err := shared.GetRun(resultA.RunID)
+	require.NoError(t, err)
+	assert.Equal(t, "team-a", run.Tenant)
+
+	runs, err := history.ForTenant(shared, "team-b").ListRuns("", "", run.StartedAt.AddDate(0, 0, -1))
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, resultB.RunID, runs[0].ID)
+
+	// A tenant cannot resume or even see the runs of another
+	_, err = teamA.Resume(resultA.RunID)
+	assert.ErrorContains(t, err, "already completed")
+	_, err = teamB.Resume(resultA.RunID)
+	assert.ErrorIs(t, err, ErrRunNotResumable)
+	assert.NotContains(t, err.Error(), "completed")
+}
+
+func TestTenantsShareWAL(t *testing.T) {
+	shared, err := NewFileWAL(t.TempDir())
+	require.NoError(t, err)
+	teamA := NewRunner(WithTenant("team-a"), WithWAL(shared))
+	teamB := NewRunner(WithTenant("team-b"), WithWAL(shared))
+
+	require.NoError(t, teamA.wal.Append(WALRecord{Type: WALRunStarted, RunID: "run-1"}))
+
+	runs, err := shared.Runs()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"team-a.run-1"}, runs)
+
+	runs, err = teamA.wal.Runs()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"run-1"}, runs)
+	records, err := teamA.wal.Read("run-1")
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "run-1", records[0].RunID)
+
+	runs, err = teamB.wal.Runs()
+	require.NoError(t, err)
+	assert.Empty(t, runs)
+	_, err = teamB.Resume("run-1")
+	assert.ErrorIs(t, err, ErrRunNotResumable)
+}
+
+func TestTenantsShareIdempotencyStore(t *testing.T) {
+	shared := NewMemoryIdempotencyStore()
+	teamA := NewRunner(WithTenant("team-a"), WithIdempotencyStore(shared))
+	teamB := NewRunner(WithTenant("team-b"), WithIdempotencyStore(shared))
+
+	var charges int32
+	require.NoError(t, teamA.Execute(context.Background(), newChargeWorkflow("order-1", &charges, false), nil))
+	require.NoError(t, teamA.Execute(context.Background(), newChargeWorkflow("order-1", &charges, false), nil))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&charges))
+
+	// The same key of another tenant is a different side effect
+	require.NoError(t, teamB.Execute(context.Background(), newChargeWorkflow("order-1", &charges, false), nil))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&charges))
+}
+
+func TestTenantOnEventsAndActions(t *testing.T) {
+	runner := NewRunner(WithTenant("team-a"))
+	var events []Event
+	runner.Subscribe(EventWorkflowCompleted, func(event Event) {
+		events = append(events, event)
+	})
+
+	var tenant string
+	wf := NewWorkflow("tenant", "Tenant", "")
+	stage := NewStage("s", "S", "")
+	stage.AddAction(NewActionFunc("read", "", func(ctx *ActionContext) error {
+		tenant = ctx.Tenant()
+		return nil
+	}))
+	wf.AddStage(stage)
+
+	require.NoError(t, runner.Execute(context.Background(), wf, nil))
+	assert.Equal(t, "team-a", tenant)
+	require.Len(t, events, 1)
+	assert.Equal(t, "team-a", events[0].Tenant)
+}
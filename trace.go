@@ -0,0 +1,207 @@
+package gostage
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// contextRunTrace holds the *traceBuilder of a run made with RunOptions.Trace
+const contextRunTrace = "runTrace"
+
+// Trace is the timeline of a run in the Chrome trace event format. Saved as
+// JSON, it opens in chrome://tracing or Perfetto, with a track for the
+// workflow and one per stage in which the actions are nested slices.
+type Trace struct {
+	TraceEvents     []TraceEvent `json:"traceEvents"`
+	DisplayTimeUnit string       `json:"displayTimeUnit"`
+}
+
+// TraceEvent is an entry of a Trace.
+type TraceEvent struct {
+	Name     string `json:"name"`
+	Category string `json:"cat,omitempty"`
+	// Phase is "X" for slices, "i" for instant events and "M" for metadata
+	Phase string `json:"ph"`
+	// Timestamp and Duration are in microseconds since the start of the run
+	Timestamp float64                `json:"ts"`
+	Duration  float64                `json:"dur,omitempty"`
+	PID       int                    `json:"pid"`
+	TID       int                    `json:"tid"`
+	Scope     string                 `json:"s,omitempty"`
+	Args      map[string]interface{} `json:"args,omitempty"`
+}
+
+// traceBuilder turns the events of a run into trace events.
+type traceBuilder struct {
+	mu    sync.Mutex
+	start time.Time
+	// tracks holds the track of each stage ID, the workflow being track 0
+	tracks []string
+	// open holds the started events of the running spans, by span key
+	open   map[string]Event
+	events []TraceEvent
+}
+
+func newTraceBuilder(start time.Time) *traceBuilder {
+	return &traceBuilder{start: start, tracks: []string{""}, open: make(map[string]Event)}
+}
+
+// traceSpan describes how an event type opens or closes a span.
+func traceSpan(eventType EventType) (category string, opens, closes bool) {
+	switch eventType {
+	case EventWorkflowStarted:
+		return "workflow", true, false
+	case EventWorkflowCompleted, EventWorkflowFailed:
+		return "workflow", false, true
+	case EventStageStarted:
+		return "stage", true, false
+	case EventStageCompleted, EventStageFailed:
+		return "stage", false, true
+	case EventActionStarted:
+		return "action", true, false
+	case EventActionCompleted, EventActionFailed:
+		return "action", false, true
+	}
+	return "", false, false
+}
+
+// spanKey identifies the span an event belongs to.
+func spanKey(category string, event Event) string {
+	switch category {
+	case "stage":
+		return event.StageID
+	case "action":
+		return ActionStatusKey(event.StageID, event.ActionName)
+	}
+	return ""
+}
+
+// track returns the track of a stage, adding it on first use.
+func (b *traceBuilder) track(stageID string) int {
+	for i, id := range b.tracks {
+		if id == stageID {
+			return i
+		}
+	}
+	b.tracks = append(b.tracks, stageID)
+	return len(b.tracks) - 1
+}
+
+func (b *traceBuilder) micros(t time.Time) float64 {
+	return float64(t.Sub(b.start).Nanoseconds()) / 1e3
+}
+
+// add records an event of the run.
+func (b *traceBuilder) add(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	category, opens, closes := traceSpan(event.Type)
+	key := category + "/" + spanKey(category, event)
+	switch {
+	case opens:
+		b.open[key] = event
+	case closes:
+		started, ok := b.open[key]
+		if !ok {
+			return
+		}
+		delete(b.open, key)
+		args := map[string]interface{}{"status": StatusCompleted}
+		if event.Type == EventWorkflowFailed || event.Type == EventStageFailed || event.Type == EventActionFailed {
+			args["status"] = StatusFailed
+		}
+		if event.Error != nil {
+			args["error"] = event.Error.Error()
+		}
+		b.slice(category, started, event.Time, args)
+	default:
+		args := make(map[string]interface{}, len(event.Payload)+1)
+		for k, v := range event.Payload {
+			args[k] = v
+		}
+		if event.ActionName != "" {
+			args["action"] = event.ActionName
+		}
+		if event.Error != nil {
+			args["error"] = event.Error.Error()
+		}
+		b.events = append(b.events, TraceEvent{
+			Name:      event.Type.String(),
+			Category:  "event",
+			Phase:     "i",
+			Timestamp: b.micros(event.Time),
+			PID:       1,
+			TID:       b.track(event.StageID),
+			Scope:     "t",
+			Args:      args,
+		})
+	}
+}
+
+// slice adds the span of a started event ending at end.
+func (b *traceBuilder) slice(category string, started Event, end time.Time, args map[string]interface{}) {
+	name := started.WorkflowID
+	switch category {
+	case "stage":
+		name = started.StageID
+	case "action":
+		name = started.ActionName
+	}
+	b.events = append(b.events, TraceEvent{
+		Name:      name,
+		Category:  category,
+		Phase:     "X",
+		Timestamp: b.micros(started.Time),
+		Duration:  float64(end.Sub(started.Time).Nanoseconds()) / 1e3,
+		PID:       1,
+		TID:       b.track(started.StageID),
+		Args:      args,
+	})
+}
+
+// finish closes the spans still open at end and names the tracks after the
+// workflow and its stages.
+func (b *traceBuilder) finish(w *Workflow, end time.Time) *Trace {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	keys := make([]string, 0, len(b.open))
+	for key := range b.open {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		started := b.open[key]
+		category, _, _ := traceSpan(started.Type)
+		b.slice(category, started, end, map[string]interface{}{"status": "unfinished"})
+	}
+
+	trace := &Trace{DisplayTimeUnit: "ms"}
+	trace.TraceEvents = append(trace.TraceEvents, TraceEvent{
+		Name: "process_name", Phase: "M", PID: 1, Args: map[string]interface{}{"name": w.ID},
+	})
+	for tid, stageID := range b.tracks {
+		name := "workflow " + w.ID
+		if stageID != "" {
+			name = stageID
+			if stage, err := w.GetStage(stageID); err == nil && stage.Name != "" {
+				name = stage.Name
+			}
+		}
+		trace.TraceEvents = append(trace.TraceEvents,
+			TraceEvent{Name: "thread_name", Phase: "M", PID: 1, TID: tid, Args: map[string]interface{}{"name": name}},
+			TraceEvent{Name: "thread_sort_index", Phase: "M", PID: 1, TID: tid, Args: map[string]interface{}{"sort_index": tid}},
+		)
+	}
+	trace.TraceEvents = append(trace.TraceEvents, b.events...)
+	return trace
+}
+
+// traceEvent records an event in the trace of its run, if the run is traced.
+func traceEvent(w *Workflow, event Event) {
+	if trace, ok := w.Context[contextRunTrace].(*traceBuilder); ok {
+		trace.add(event)
+	}
+}
@@ -0,0 +1,100 @@
+package gostage
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunTrace(t *testing.T) {
+	wf := NewWorkflow("etl", "ETL", "")
+	extract := NewStage("extract", "Extract", "")
+	extract.AddAction(NewActionFunc("download", "", func(ctx *ActionContext) error {
+		time.Sleep(5 * time.Millisecond)
+		ctx.Emit(EventActionRetried, map[string]interface{}{"attempt": 2})
+		return nil
+	}))
+	wf.AddStage(extract)
+	load := NewStage("load", "Load", "")
+	load.AddAction(NewActionFunc("insert", "", func(ctx *ActionContext) error {
+		return errors.New("table locked")
+	}))
+	wf.AddStage(load)
+
+	options := DefaultRunOptions()
+	options.Trace = true
+	result := NewRunner().ExecuteWithOptions(wf, options)
+	require.Error(t, result.Error)
+	require.NotNil(t, result.Trace)
+
+	data, err := json.Marshal(result.Trace)
+	require.NoError(t, err)
+	var trace Trace
+	require.NoError(t, json.Unmarshal(data, &trace))
+	assert.Equal(t, "ms", trace.DisplayTimeUnit)
+
+	tracks := map[int]string{}
+	slices := map[string]TraceEvent{}
+	var instants []TraceEvent
+	for _, event := range trace.TraceEvents {
+		switch event.Phase {
+		case "M":
+			if event.Name == "thread_name" {
+				tracks[event.TID] = event.Args["name"].(string)
+			}
+		case "X":
+			slices[event.Category+":"+event.Name] = event
+		case "i":
+			instants = append(instants, event)
+		}
+	}
+	assert.Equal(t, map[int]string{0: "workflow etl", 1: "Extract", 2: "Load"}, tracks)
+
+	stage, action := slices["stage:extract"], slices["action:download"]
+	assert.Equal(t, 1, stage.TID)
+	assert.Equal(t, stage.TID, action.TID)
+	assert.GreaterOrEqual(t, action.Timestamp, stage.Timestamp)
+	assert.LessOrEqual(t, action.Timestamp+action.Duration, stage.Timestamp+stage.Duration)
+	assert.GreaterOrEqual(t, action.Duration, 5000.0)
+	assert.Equal(t, StatusCompleted, action.Args["status"])
+
+	failed := slices["action:insert"]
+	assert.Equal(t, 2, failed.TID)
+	assert.Equal(t, StatusFailed, failed.Args["status"])
+	assert.Equal(t, "table locked", failed.Args["error"])
+	assert.Equal(t, StatusFailed, slices["workflow:etl"].Args["status"])
+	assert.Equal(t, 0, slices["workflow:etl"].TID)
+
+	require.Len(t, instants, 1)
+	assert.Equal(t, "action.retried", instants[0].Name)
+	assert.Equal(t, 1, instants[0].TID)
+	assert.Equal(t, "download", instants[0].Args["action"])
+
+	// Runs are not traced unless asked
+	assert.Nil(t, NewRunner().ExecuteWithOptions(NewWorkflow("empty", "", ""), DefaultRunOptions()).Trace)
+}
+
+func TestTraceClosesUnfinishedSpans(t *testing.T) {
+	start := time.Now()
+	builder := newTraceBuilder(start)
+	builder.add(Event{Type: EventStageStarted, WorkflowID: "w", StageID: "s", Time: start})
+	builder.add(Event{Type: EventActionStarted, WorkflowID: "w", StageID: "s", ActionName: "a", Time: start.Add(time.Millisecond)})
+
+	trace := builder.finish(NewWorkflow("w", "", ""), start.Add(3*time.Millisecond))
+	var unfinished []TraceEvent
+	for _, event := range trace.TraceEvents {
+		if event.Phase == "X" {
+			unfinished = append(unfinished, event)
+		}
+	}
+	require.Len(t, unfinished, 2)
+	for _, event := range unfinished {
+		assert.Equal(t, "unfinished", event.Args["status"])
+	}
+	assert.Equal(t, 2000.0, unfinished[0].Duration)
+	assert.Equal(t, 3000.0, unfinished[1].Duration)
+}
@@ -0,0 +1,301 @@
+// Package tui renders workflow runs as a live tree in the terminal.
+//
+// The renderer consumes runner events and redraws the tree of stages and
+// actions with spinners, durations and failures using plain ANSI escape codes:
+//
+//	view := tui.New(os.Stderr)
+//	defer view.Attach(runner)()
+//
+// When the output is not a terminal, the renderer prints one line per finished
+// stage or action instead, which keeps CI logs readable.
+package tui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+)
+
+// ANSI escape sequences
+const (
+	colorReset  = "\x1b[0m"
+	colorGreen  = "\x1b[32m"
+	colorRed    = "\x1b[31m"
+	colorYellow = "\x1b[33m"
+	colorGray   = "\x1b[90m"
+	clearLine   = "\x1b[2K"
+)
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// node is a workflow, stage or action in the rendered tree.
+type node struct {
+	name     string
+	status   string
+	start    time.Time
+	end      time.Time
+	err      error
+	children []*node
+}
+
+// child returns the child with the given name, creating it if needed.
+func (n *node) child(name string) *node {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	c := &node{name: name, status: gostage.StatusPending}
+	n.children = append(n.children, c)
+	return c
+}
+
+// Renderer draws the progress of workflow runs.
+type Renderer struct {
+	w           io.Writer
+	interactive bool
+	color       bool
+	interval    time.Duration
+
+	mu    sync.Mutex
+	root  *node
+	frame int
+	lines int
+}
+
+// Option configures a Renderer.
+type Option func(*Renderer)
+
+// WithInteractive forces live redrawing on or off instead of detecting a terminal.
+func WithInteractive(interactive bool) Option {
+	return func(r *Renderer) {
+		r.interactive = interactive
+	}
+}
+
+// WithColor enables or disables ANSI colors. Colors default to on for terminals.
+func WithColor(color bool) Option {
+	return func(r *Renderer) {
+		r.color = color
+	}
+}
+
+// WithRefreshInterval sets how often the spinner is redrawn.
+func WithRefreshInterval(interval time.Duration) Option {
+	return func(r *Renderer) {
+		r.interval = interval
+	}
+}
+
+// New creates a renderer writing to w.
+func New(w io.Writer, opts ...Option) *Renderer {
+	terminal := isTerminal(w)
+	r := &Renderer{
+		w:           w,
+		interactive: terminal,
+		color:       terminal,
+		interval:    100 * time.Millisecond,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// isTerminal reports whether w is a character device.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Attach subscribes the renderer to the runner's events. The returned function
+// unsubscribes it and stops the spinner.
+func (r *Renderer) Attach(runner *gostage.Runner) func() {
+	unsubscribe := runner.Subscribe(gostage.EventAll, r.Handle)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if !r.interactive {
+			return
+		}
+
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.mu.Lock()
+				if r.root != nil && r.root.status == gostage.StatusRunning {
+					r.frame++
+					r.redraw()
+				}
+				r.mu.Unlock()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		unsubscribe()
+		close(stop)
+		<-done
+	}
+}
+
+// Handle applies an event to the tree and updates the output.
+func (r *Renderer) Handle(event gostage.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if event.Type == gostage.EventWorkflowStarted {
+		r.root = &node{name: event.WorkflowID}
+		r.lines = 0
+	}
+	if r.root == nil {
+		return
+	}
+
+	target := r.root
+	if event.StageID != "" {
+		target = target.child(event.StageID)
+	}
+	if event.ActionName != "" {
+		target = target.child(event.ActionName)
+	}
+
+	switch event.Type {
+	case gostage.EventWorkflowStarted, gostage.EventStageStarted, gostage.EventActionStarted:
+		target.status = gostage.StatusRunning
+		target.start = event.Time
+	case gostage.EventWorkflowCompleted, gostage.EventStageCompleted, gostage.EventActionCompleted:
+		target.status = gostage.StatusCompleted
+		target.end = event.Time
+	case gostage.EventWorkflowFailed, gostage.EventStageFailed, gostage.EventActionFailed:
+		target.status = gostage.StatusFailed
+		target.end = event.Time
+		target.err = event.Error
+	case gostage.EventStageSkipped, gostage.EventActionSkipped:
+		target.status = gostage.StatusSkipped
+	default:
+		return
+	}
+
+	if r.interactive {
+		r.redraw()
+		return
+	}
+	if target.status != gostage.StatusRunning {
+		depth := 0
+		if event.StageID != "" {
+			depth++
+		}
+		if event.ActionName != "" {
+			depth++
+		}
+		fmt.Fprintln(r.w, r.line(target, depth))
+	}
+}
+
+// Render returns the current tree without cursor movement.
+func (r *Renderer) Render() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.render()
+}
+
+func (r *Renderer) render() string {
+	if r.root == nil {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(r.line(r.root, 0))
+	b.WriteString("\n")
+	for _, stage := range r.root.children {
+		b.WriteString(r.line(stage, 1))
+		b.WriteString("\n")
+		for _, action := range stage.children {
+			b.WriteString(r.line(action, 2))
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// redraw moves the cursor back over the previous frame and draws the tree.
+func (r *Renderer) redraw() {
+	out := r.render()
+
+	var b strings.Builder
+	if r.lines > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", r.lines)
+	}
+	for _, line := range strings.SplitAfter(out, "\n") {
+		if line != "" {
+			b.WriteString(clearLine)
+			b.WriteString(line)
+		}
+	}
+	r.lines = strings.Count(out, "\n")
+	io.WriteString(r.w, b.String())
+}
+
+// line formats a single node at the given depth.
+func (r *Renderer) line(n *node, depth int) string {
+	var symbol, color string
+	switch n.status {
+	case gostage.StatusRunning:
+		symbol, color = spinnerFrames[r.frame%len(spinnerFrames)], colorYellow
+	case gostage.StatusCompleted:
+		symbol, color = "✓", colorGreen
+	case gostage.StatusFailed:
+		symbol, color = "✗", colorRed
+	case gostage.StatusSkipped:
+		symbol, color = "-", colorGray
+	default:
+		symbol, color = "·", colorGray
+	}
+
+	text := symbol + " " + n.name
+	switch {
+	case n.status == gostage.StatusSkipped:
+		text += " (skipped)"
+	case !n.end.IsZero() && !n.start.IsZero():
+		text += fmt.Sprintf(" (%s)", formatDuration(n.end.Sub(n.start)))
+	case n.status == gostage.StatusRunning && !n.start.IsZero():
+		text += fmt.Sprintf(" (%s)", formatDuration(time.Since(n.start)))
+	}
+	if n.err != nil && len(n.children) == 0 {
+		text += ": " + n.err.Error()
+	}
+
+	if r.color {
+		text = color + text + colorReset
+	}
+	return strings.Repeat("  ", depth) + text
+}
+
+// formatDuration rounds a duration for display.
+func formatDuration(d time.Duration) string {
+	switch {
+	case d < time.Millisecond:
+		return d.Round(time.Microsecond).String()
+	case d < time.Second:
+		return d.Round(time.Millisecond).String()
+	default:
+		return d.Round(100 * time.Millisecond).String()
+	}
+}
@@ -0,0 +1,101 @@
+package tui
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderTree(t *testing.T) {
+	r := New(&bytes.Buffer{}, WithInteractive(false))
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	events := []gostage.Event{
+		{Type: gostage.EventWorkflowStarted, WorkflowID: "deploy", Time: at(0)},
+		{Type: gostage.EventStageStarted, WorkflowID: "deploy", StageID: "build", Time: at(0)},
+		{Type: gostage.EventActionStarted, WorkflowID: "deploy", StageID: "build", ActionName: "compile", Time: at(0)},
+		{Type: gostage.EventActionCompleted, WorkflowID: "deploy", StageID: "build", ActionName: "compile", Time: at(250)},
+		{Type: gostage.EventActionSkipped, WorkflowID: "deploy", StageID: "build", ActionName: "lint", Time: at(250)},
+		{Type: gostage.EventStageCompleted, WorkflowID: "deploy", StageID: "build", Time: at(250)},
+		{Type: gostage.EventStageStarted, WorkflowID: "deploy", StageID: "release", Time: at(250)},
+		{Type: gostage.EventActionStarted, WorkflowID: "deploy", StageID: "release", ActionName: "publish", Time: at(250)},
+		{Type: gostage.EventActionFailed, WorkflowID: "deploy", StageID: "release", ActionName: "publish", Time: at(1750), Error: errors.New("registry down")},
+	}
+	for _, e := range events {
+		r.Handle(e)
+	}
+
+	assert.Equal(t, strings.Join([]string{
+		"⠋ deploy",
+		"  ✓ build (250ms)",
+		"    ✓ compile (250ms)",
+		"    - lint (skipped)",
+		"  ⠋ release",
+		"    ✗ publish (1.5s): registry down",
+		"",
+	}, "\n"), stripElapsed(r.Render()))
+}
+
+// stripElapsed removes the live durations of running nodes, which depend on the clock.
+func stripElapsed(out string) string {
+	lines := strings.Split(out, "\n")
+	for i, line := range lines {
+		if strings.Contains(line, "⠋") {
+			if idx := strings.Index(line, " ("); idx >= 0 {
+				lines[i] = line[:idx]
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func newTestWorkflow() *gostage.Workflow {
+	wf := gostage.NewWorkflow("local", "Local", "")
+	stage := gostage.NewStage("only", "Only", "")
+	stage.AddAction(&failingAction{BaseAction: gostage.NewBaseAction("explode", "")})
+	wf.AddStage(stage)
+	return wf
+}
+
+type failingAction struct{ gostage.BaseAction }
+
+func (a *failingAction) Execute(ctx *gostage.ActionContext) error {
+	return errors.New("boom")
+}
+
+func TestAttachPlainOutput(t *testing.T) {
+	var out bytes.Buffer
+	runner := gostage.NewRunner()
+	detach := New(&out, WithInteractive(false)).Attach(runner)
+
+	require.Error(t, runner.Execute(context.Background(), newTestWorkflow(), nil))
+	detach()
+
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	require.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[0], "    ✗ explode ("), lines[0])
+	assert.True(t, strings.HasSuffix(lines[0], "): boom"), lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], "  ✗ only ("), lines[1])
+	assert.True(t, strings.HasPrefix(lines[2], "✗ local ("), lines[2])
+	assert.NotContains(t, out.String(), "\x1b[")
+}
+
+func TestAttachInteractiveOutput(t *testing.T) {
+	var out bytes.Buffer
+	runner := gostage.NewRunner()
+	detach := New(&out, WithInteractive(true), WithColor(true), WithRefreshInterval(time.Millisecond)).Attach(runner)
+
+	require.Error(t, runner.Execute(context.Background(), newTestWorkflow(), nil))
+	detach()
+
+	assert.Contains(t, out.String(), "\x1b[3A")
+	assert.Contains(t, out.String(), colorRed+"✗ local")
+}
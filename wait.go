@@ -0,0 +1,126 @@
+package gostage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/davidroman0O/gostage/store"
+)
+
+// ErrPollTimeout is returned by a PollAction whose predicate was not satisfied in time.
+var ErrPollTimeout = errors.New("condition not met before timeout")
+
+// PollPredicate reports whether the condition a PollAction waits for is
+// satisfied. Returning an error stops polling and fails the action.
+type PollPredicate func(ctx *ActionContext) (bool, error)
+
+// waitAction pauses the workflow for a fixed duration.
+type waitAction struct {
+	BaseAction
+	duration time.Duration
+}
+
+// WaitAction creates an action that pauses the workflow for duration. The
+// wait ends early with the context's error if the run is cancelled.
+func WaitAction(name string, duration time.Duration) Action {
+	return &waitAction{
+		BaseAction: NewBaseAction(name, fmt.Sprintf("Waits %s", duration)),
+		duration:   duration,
+	}
+}
+
+func (a *waitAction) Execute(ctx *ActionContext) error {
+	ctx.Logger.Debug("Waiting %s", a.duration)
+	return ctx.Sleep(a.duration)
+}
+
+// pollAction evaluates a predicate until it is satisfied.
+type pollAction struct {
+	BaseAction
+	interval  time.Duration
+	timeout   time.Duration
+	predicate PollPredicate
+}
+
+// PollAction creates an action that evaluates predicate right away and then
+// every interval until it is satisfied, as when waiting for a machine, a DNS
+// record or a deployment to become ready. It fails with an error wrapping
+// ErrPollTimeout if predicate is still unsatisfied after timeout, or never
+// times out if timeout is zero. Cancelling the run stops polling.
+func PollAction(name string, interval, timeout time.Duration, predicate PollPredicate) Action {
+	return &pollAction{
+		BaseAction: NewBaseAction(name, fmt.Sprintf("Polls every %s", interval)),
+		interval:   interval,
+		timeout:    timeout,
+		predicate:  predicate,
+	}
+}
+
+func (a *pollAction) Execute(ctx *ActionContext) error {
+	clock := ctx.Clock()
+	var deadline <-chan time.Time
+	if a.timeout > 0 {
+		timer := clock.NewTimer(a.timeout)
+		defer timer.Stop()
+		deadline = timer.C()
+	}
+
+	for attempt := 1; ; attempt++ {
+		ok, err := a.predicate(ctx)
+		if err != nil {
+			return fmt.Errorf("poll condition failed after %d attempts: %w", attempt, err)
+		}
+		if ok {
+			ctx.Logger.Debug("Poll condition met after %d attempts", attempt)
+			return nil
+		}
+
+		next := clock.NewTimer(a.interval)
+		select {
+		case <-next.C():
+		case <-deadline:
+			next.Stop()
+			return fmt.Errorf("%w after %s and %d attempts", ErrPollTimeout, a.timeout, attempt)
+		case <-actionDone(ctx):
+			next.Stop()
+			return ctx.GoContext.Err()
+		}
+	}
+}
+
+// actionDone returns the channel closed when the run of the action is cancelled.
+func actionDone(ctx *ActionContext) <-chan struct{} {
+	if ctx.GoContext == nil {
+		return context.Background().Done()
+	}
+	return ctx.GoContext.Done()
+}
+
+// StoreKeyExists returns a predicate satisfied once key is in the workflow store.
+func StoreKeyExists(key string) PollPredicate {
+	return func(ctx *ActionContext) (bool, error) {
+		for _, existing := range ctx.Store().ListKeys() {
+			if existing == key {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+}
+
+// StoreKeyEquals returns a predicate satisfied once key holds value in the
+// workflow store. A value of another type than T fails the predicate.
+func StoreKeyEquals[T comparable](key string, value T) PollPredicate {
+	return func(ctx *ActionContext) (bool, error) {
+		current, err := store.Get[T](ctx.Store(), key)
+		if errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrExpired) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return current == value, nil
+	}
+}
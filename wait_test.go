@@ -0,0 +1,91 @@
+package gostage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runSingleAction(t *testing.T, ctx context.Context, action Action, setup func(wf *Workflow)) RunResult {
+	t.Helper()
+	wf := NewWorkflow("waiting", "Waiting", "")
+	stage := NewStage("wait", "Wait", "")
+	stage.AddAction(action)
+	wf.AddStage(stage)
+	if setup != nil {
+		setup(wf)
+	}
+
+	options := DefaultRunOptions()
+	options.Context = ctx
+	return NewRunner().ExecuteWithOptions(wf, options)
+}
+
+func TestWaitAction(t *testing.T) {
+	started := time.Now()
+	result := runSingleAction(t, context.Background(), WaitAction("pause", 50*time.Millisecond), nil)
+	require.True(t, result.Success, "%v", result.Error)
+	assert.GreaterOrEqual(t, time.Since(started), 50*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	started = time.Now()
+	result = runSingleAction(t, ctx, WaitAction("pause", time.Minute), nil)
+	assert.ErrorIs(t, result.Error, context.DeadlineExceeded)
+	assert.Less(t, time.Since(started), 5*time.Second)
+}
+
+func TestPollAction(t *testing.T) {
+	attempts := 0
+	result := runSingleAction(t, context.Background(), PollAction("ready", time.Millisecond, time.Second, func(ctx *ActionContext) (bool, error) {
+		attempts++
+		return attempts == 3, nil
+	}), nil)
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, 3, attempts)
+}
+
+func TestPollActionTimeout(t *testing.T) {
+	result := runSingleAction(t, context.Background(), PollAction("never", 5*time.Millisecond, 30*time.Millisecond, func(ctx *ActionContext) (bool, error) {
+		return false, nil
+	}), nil)
+	assert.ErrorIs(t, result.Error, ErrPollTimeout)
+	assert.Equal(t, StatusFailed, result.StageStatuses["wait"])
+}
+
+func TestPollActionPredicateError(t *testing.T) {
+	errUnreachable := errors.New("host unreachable")
+	result := runSingleAction(t, context.Background(), PollAction("broken", time.Millisecond, 0, func(ctx *ActionContext) (bool, error) {
+		return false, errUnreachable
+	}), nil)
+	assert.ErrorIs(t, result.Error, errUnreachable)
+}
+
+func TestPollActionStorePredicates(t *testing.T) {
+	// The keys are written concurrently, as a webhook handler or another goroutine would
+	writeLater := func(key string, value interface{}) func(wf *Workflow) {
+		return func(wf *Workflow) {
+			time.AfterFunc(20*time.Millisecond, func() { wf.Store.Put(key, value) })
+		}
+	}
+
+	result := runSingleAction(t, context.Background(),
+		PollAction("dns", 5*time.Millisecond, time.Second, StoreKeyExists("dns.record")),
+		writeLater("dns.record", "10.0.0.1"))
+	require.True(t, result.Success, "%v", result.Error)
+
+	result = runSingleAction(t, context.Background(),
+		PollAction("deploy", 5*time.Millisecond, time.Second, StoreKeyEquals("deploy.status", "ready")),
+		writeLater("deploy.status", "ready"))
+	require.True(t, result.Success, "%v", result.Error)
+
+	result = runSingleAction(t, context.Background(),
+		PollAction("replicas", 5*time.Millisecond, time.Second, StoreKeyEquals("replicas", 3)),
+		func(wf *Workflow) { wf.Store.Put("replicas", "three") })
+	require.Error(t, result.Error)
+	assert.Contains(t, result.Error.Error(), "type mismatch")
+}
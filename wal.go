@@ -0,0 +1,462 @@
+package gostage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WALRecordType identifies the kind of a write-ahead log record.
+type WALRecordType string
+
+const (
+	// WALRunStarted opens the log of a run and carries the workflow definition
+	WALRunStarted WALRecordType = "run.started"
+	// WALActionCompleted records a completed action and the store changes it made
+	WALActionCompleted WALRecordType = "action.completed"
+	// WALRunFinished closes the log of a run that reached a final state
+	WALRunFinished WALRecordType = "run.finished"
+)
+
+// WALRecord is an entry of the write-ahead log of a run.
+type WALRecord struct {
+	Type       WALRecordType `json:"type"`
+	RunID      string        `json:"runId"`
+	WorkflowID string        `json:"workflowId"`
+	Time       time.Time     `json:"time"`
+	// Definition is the workflow as it was when the run started
+	Definition *SubWorkflowDef `json:"definition,omitempty"`
+	// StageID and Action identify the completed action
+	StageID string `json:"stageId,omitempty"`
+	Action  string `json:"action,omitempty"`
+	// Puts and Deletes are the store changes made by the completed action
+	Puts    map[string]json.RawMessage `json:"puts,omitempty"`
+	Deletes []string                   `json:"deletes,omitempty"`
+	// Error is the failure of a finished run
+	Error string `json:"error,omitempty"`
+}
+
+// WAL is the write-ahead log used for durable execution.
+// Records of a run must be durable once Append returns.
+type WAL interface {
+	// Append adds a record to the log of its run
+	Append(record WALRecord) error
+
+	// Read returns the records of a run in the order they were appended
+	Read(runID string) ([]WALRecord, error)
+
+	// Runs returns the IDs of the runs that have a log
+	Runs() ([]string, error)
+
+	// Remove deletes the log of a run
+	Remove(runID string) error
+}
+
+// FileWAL is a WAL that keeps the log of each run in its own JSON lines file.
+type FileWAL struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewFileWAL creates a file-backed WAL rooted at dir.
+func NewFileWAL(dir string) (*FileWAL, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create WAL directory: %w", err)
+	}
+	return &FileWAL{dir: dir}, nil
+}
+
+// Dir returns the directory where logs are written.
+func (l *FileWAL) Dir() string {
+	return l.dir
+}
+
+// Append implements WAL.Append. The file is synced before returning.
+func (l *FileWAL) Append(record WALRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode WAL record: %w", err)
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(l.path(record.RunID), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open WAL: %w", err)
+	}
+
+	// Start on a fresh line if a crash left a torn record at the end
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			data = append([]byte{'\n'}, data...)
+		}
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write WAL record: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync WAL: %w", err)
+	}
+	return f.Close()
+}
+
+// Read implements WAL.Read. Torn records, left by a crash during a write, are ignored.
+func (l *FileWAL) Read(runID string) ([]WALRecord, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	data, err := os.ReadFile(l.path(runID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read WAL: %w", err)
+	}
+
+	var records []WALRecord
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		var record WALRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// Runs implements WAL.Runs.
+func (l *FileWAL) Runs() ([]string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	paths, err := filepath.Glob(filepath.Join(l.dir, "*.wal"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list WAL files: %w", err)
+	}
+	runs := make([]string, 0, len(paths))
+	for _, path := range paths {
+		runs = append(runs, strings.TrimSuffix(filepath.Base(path), ".wal"))
+	}
+	sort.Strings(runs)
+	return runs, nil
+}
+
+// Remove implements WAL.Remove.
+func (l *FileWAL) Remove(runID string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.Remove(l.path(runID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove WAL: %w", err)
+	}
+	return nil
+}
+
+func (l *FileWAL) path(runID string) string {
+	return filepath.Join(l.dir, runID+".wal")
+}
+
+// walRun is the durable state of a run, kept in the workflow context.
+type walRun struct {
+	id string
+	// mu serializes the records of stages running at the same time
+	mu sync.Mutex
+	// snapshot holds the JSON encoding of the user store values at the last record
+	snapshot map[string]string
+	// completed holds the ActionStatusKey of the actions completed before recovery
+	completed map[string]bool
+}
+
+// WithWAL enables durable execution: the start of every run, each completed
+// action with the store changes it made, and the end of the run are appended
+// to wal. Workflows must be serializable with ToDef. After a crash, Recover
+// resumes the unfinished runs from their first incomplete action.
+func WithWAL(wal WAL) RunnerOption {
+	return func(r *Runner) {
+		r.wal = wal
+	}
+}
+
+// encodeUserStore returns the JSON encoding of each user value of the workflow store.
+func encodeUserStore(w *Workflow) (map[string]string, error) {
+	encoded := make(map[string]string)
+	for key, value := range userData(w.Store.ExportAll()) {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("store key '%s' is not serializable: %w", key, err)
+		}
+		encoded[key] = string(data)
+	}
+	return encoded, nil
+}
+
+// storeDelta returns the values put and the keys deleted between two encoded store snapshots.
+func storeDelta(before, after map[string]string) (map[string]json.RawMessage, []string) {
+	var puts map[string]json.RawMessage
+	for key, value := range after {
+		if previous, ok := before[key]; !ok || previous != value {
+			if puts == nil {
+				puts = make(map[string]json.RawMessage)
+			}
+			puts[key] = json.RawMessage(value)
+		}
+	}
+
+	var deletes []string
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			deletes = append(deletes, key)
+		}
+	}
+	sort.Strings(deletes)
+	return puts, deletes
+}
+
+// applyStoreDelta replays recorded store changes on the workflow store.
+func applyStoreDelta(w *Workflow, puts map[string]json.RawMessage, deletes []string) error {
+	for key, raw := range puts {
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return fmt.Errorf("failed to decode store key '%s': %w", key, err)
+		}
+		if err := w.Store.Put(key, value); err != nil {
+			return fmt.Errorf("failed to restore store key '%s': %w", key, err)
+		}
+	}
+	for _, key := range deletes {
+		w.Store.Delete(key)
+	}
+	return nil
+}
+
+// walStart opens the log of a run, unless the workflow is being recovered.
+func (r *Runner) walStart(w *Workflow) error {
+	if r.wal == nil {
+		return nil
+	}
+	if _, ok := w.Context["walRun"].(*walRun); ok {
+		return nil
+	}
+
+	def, err := w.ToDef()
+	if err != nil {
+		return fmt.Errorf("durable execution of workflow '%s' failed: %w", w.ID, err)
+	}
+	snapshot, err := encodeUserStore(w)
+	if err != nil {
+		return fmt.Errorf("durable execution of workflow '%s' failed: %w", w.ID, err)
+	}
+
+	runID, ok := w.Context[contextRunID].(string)
+	if !ok {
+		runID = newRunID()
+	}
+	run := &walRun{id: runID, snapshot: snapshot, completed: make(map[string]bool)}
+	if err := r.wal.Append(WALRecord{
+		Type:       WALRunStarted,
+		RunID:      run.id,
+		WorkflowID: w.ID,
+		Time:       time.Now(),
+		Definition: def,
+	}); err != nil {
+		return fmt.Errorf("durable execution of workflow '%s' failed: %w", w.ID, err)
+	}
+
+	w.Context["walRun"] = run
+	return nil
+}
+
+// walCompleted reports whether the action completed before the run was recovered.
+func walCompleted(w *Workflow, stageID, actionName string) bool {
+	run, ok := w.Context["walRun"].(*walRun)
+	return ok && run.completed[ActionStatusKey(stageID, actionName)]
+}
+
+// walActionCompleted records a completed action and the store changes since the previous record.
+func (r *Runner) walActionCompleted(w *Workflow, stageID, actionName string) error {
+	run, ok := w.Context["walRun"].(*walRun)
+	if r.wal == nil || !ok {
+		return nil
+	}
+
+	run.mu.Lock()
+	defer run.mu.Unlock()
+
+	current, err := encodeUserStore(w)
+	if err != nil {
+		return err
+	}
+
+	record := WALRecord{
+		Type:       WALActionCompleted,
+		RunID:      run.id,
+		WorkflowID: w.ID,
+		Time:       time.Now(),
+		StageID:    stageID,
+		Action:     actionName,
+	}
+	record.Puts, record.Deletes = storeDelta(run.snapshot, current)
+
+	if err := r.wal.Append(record); err != nil {
+		return err
+	}
+	run.snapshot = current
+	return nil
+}
+
+// walFinish closes the log of a run and removes it.
+func (r *Runner) walFinish(w *Workflow, runErr error) {
+	run, ok := w.Context["walRun"].(*walRun)
+	if r.wal == nil || !ok {
+		return
+	}
+	delete(w.Context, "walRun")
+
+	record := WALRecord{Type: WALRunFinished, RunID: run.id, WorkflowID: w.ID, Time: time.Now()}
+	if runErr != nil {
+		record.Error = runErr.Error()
+	}
+	if err := r.wal.Append(record); err != nil {
+		r.defaultLogger.Warn("Failed to close the WAL of run %s: %v", run.id, err)
+		return
+	}
+	if err := r.wal.Remove(run.id); err != nil {
+		r.defaultLogger.Warn("Failed to remove the WAL of run %s: %v", run.id, err)
+	}
+}
+
+// ErrRunNotResumable is returned by Resume for a run the WAL holds no
+// unfinished log of, because it finished or never ran with durable execution.
+var ErrRunNotResumable = errors.New("run is not resumable")
+
+// Resume continues the run with the given ID from its log in the WAL,
+// rebuilding its workflow from the default action registry. See ResumeWithRegistry.
+func (r *Runner) Resume(runID string) (RunResult, error) {
+	return r.ResumeWithRegistry(runID, defaultActionRegistry)
+}
+
+// ResumeWithRegistry continues the run with the given ID, as Recover does for
+// every unfinished run, with the runner's default options. The run keeps its
+// ID. It fails with ErrRunNotResumable when the run finished, reporting its
+// status when the runner has a history, or when the WAL has no log of it.
+func (r *Runner) ResumeWithRegistry(runID string, registry *ActionRegistry) (RunResult, error) {
+	if r.wal == nil {
+		return RunResult{}, fmt.Errorf("no WAL configured")
+	}
+	if r.runs.running(runID) {
+		return RunResult{}, fmt.Errorf("run %s is in progress: %w", runID, ErrRunNotResumable)
+	}
+
+	records, err := r.wal.Read(runID)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return RunResult{}, err
+	}
+	if len(records) == 0 || records[len(records)-1].Type == WALRunFinished {
+		if r.history != nil {
+			if run, err := r.history.GetRun(runID); err == nil {
+				return RunResult{}, fmt.Errorf("run %s already %s: %w", runID, run.Status, ErrRunNotResumable)
+			}
+		}
+		return RunResult{}, fmt.Errorf("run %s has no unfinished log: %w", runID, ErrRunNotResumable)
+	}
+
+	workflow, err := restoreWALRun(records, registry)
+	if err != nil {
+		return RunResult{}, fmt.Errorf("failed to resume run %s: %w", runID, err)
+	}
+
+	r.defaultLogger.Info("Resuming workflow %s from run %s", workflow.ID, runID)
+	return r.ExecuteWithOptions(workflow, r.options), nil
+}
+
+// Recover resumes the runs left unfinished in the WAL, rebuilding their
+// workflows from the default action registry. See RecoverWithRegistry.
+func (r *Runner) Recover() ([]RunResult, error) {
+	return r.RecoverWithRegistry(defaultActionRegistry)
+}
+
+// RecoverWithRegistry resumes the runs left unfinished in the WAL, one after
+// the other, with the runner's default options. Each workflow is rebuilt from
+// the definition it started with, its store is restored from the recorded
+// changes, and execution continues from the first action without a completion
+// record. That action may have run before the crash, so actions should be
+// idempotent. Store values are restored from JSON, so numbers come back as float64.
+func (r *Runner) RecoverWithRegistry(registry *ActionRegistry) ([]RunResult, error) {
+	if r.wal == nil {
+		return nil, fmt.Errorf("no WAL configured")
+	}
+
+	runIDs, err := r.wal.Runs()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []RunResult
+	for _, runID := range runIDs {
+		records, err := r.wal.Read(runID)
+		if err != nil {
+			return results, err
+		}
+
+		if len(records) == 0 || records[len(records)-1].Type == WALRunFinished {
+			// Finished runs whose log could not be removed, or runs that crashed
+			// before their first record was complete
+			if err := r.wal.Remove(runID); err != nil {
+				return results, err
+			}
+			continue
+		}
+
+		workflow, err := restoreWALRun(records, registry)
+		if err != nil {
+			return results, fmt.Errorf("failed to recover run %s: %w", runID, err)
+		}
+
+		r.defaultLogger.Info("Recovering workflow %s from run %s", workflow.ID, runID)
+		results = append(results, r.ExecuteWithOptions(workflow, r.options))
+	}
+	return results, nil
+}
+
+// restoreWALRun rebuilds a workflow and its durable state from the records of a run.
+func restoreWALRun(records []WALRecord, registry *ActionRegistry) (*Workflow, error) {
+	start := records[0]
+	if start.Type != WALRunStarted || start.Definition == nil {
+		return nil, fmt.Errorf("log does not start with a %s record", WALRunStarted)
+	}
+
+	workflow, err := NewWorkflowFromDefWithRegistry(start.Definition, registry)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &walRun{id: start.RunID, completed: make(map[string]bool)}
+	for _, record := range records[1:] {
+		if record.Type != WALActionCompleted {
+			continue
+		}
+		if err := applyStoreDelta(workflow, record.Puts, record.Deletes); err != nil {
+			return nil, err
+		}
+		run.completed[ActionStatusKey(record.StageID, record.Action)] = true
+	}
+
+	if run.snapshot, err = encodeUserStore(workflow); err != nil {
+		return nil, err
+	}
+	workflow.Context["walRun"] = run
+	return workflow, nil
+}
@@ -0,0 +1,209 @@
+package gostage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/davidroman0O/gostage/history"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWALRecoverResumesFromIncompleteAction(t *testing.T) {
+	var prepared, charged, notified int32
+	crash := true
+
+	registry := NewActionRegistry()
+	require.NoError(t, registry.Register("prepare", func() Action {
+		return NewTestAction("prepare", "", func(ctx *ActionContext) error {
+			atomic.AddInt32(&prepared, 1)
+			ctx.Store().Delete("draft")
+			return ctx.Store().Put("order", map[string]interface{}{"id": "o-1", "amount": 42})
+		})
+	}))
+	require.NoError(t, registry.Register("charge", func() Action {
+		return NewTestAction("charge", "", func(ctx *ActionContext) error {
+			atomic.AddInt32(&charged, 1)
+			return ctx.Store().Put("charged", true)
+		})
+	}))
+	require.NoError(t, registry.Register("notify", func() Action {
+		return NewTestAction("notify", "", func(ctx *ActionContext) error {
+			if crash {
+				panic("process killed")
+			}
+			atomic.AddInt32(&notified, 1)
+			return nil
+		})
+	}))
+
+	newWorkflow := func() *Workflow {
+		wf := NewWorkflow("checkout", "Checkout", "")
+		require.NoError(t, wf.Store.Put("draft", "cart"))
+		for _, stageDef := range []struct{ id, action string }{{"prepare", "prepare"}, {"pay", "charge"}, {"notify", "notify"}} {
+			stage := NewStage(stageDef.id, stageDef.id, "")
+			action, err := registry.Resolve(stageDef.action, nil)
+			require.NoError(t, err)
+			stage.AddAction(action)
+			wf.AddStage(stage)
+		}
+		return wf
+	}
+
+	wal, err := NewFileWAL(t.TempDir())
+	require.NoError(t, err)
+
+	assert.Panics(t, func() {
+		NewRunner(WithWAL(wal)).ExecuteWithOptions(newWorkflow(), DefaultRunOptions())
+	})
+
+	runs, err := wal.Runs()
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	records, err := wal.Read(runs[0])
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, WALRunStarted, records[0].Type)
+	assert.Equal(t, "checkout", records[0].Definition.ID)
+	assert.Equal(t, WALActionCompleted, records[1].Type)
+	assert.Equal(t, "prepare", records[1].StageID)
+	assert.Equal(t, []string{"draft"}, records[1].Deletes)
+	assert.Contains(t, records[1].Puts, "order")
+	assert.Equal(t, "pay", records[2].StageID)
+
+	crash = false
+	results, err := NewRunner(WithWAL(wal)).RecoverWithRegistry(registry)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+
+	result := results[0]
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&prepared))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&charged))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&notified))
+	assert.Equal(t, true, result.FinalStore["charged"])
+	assert.Equal(t, map[string]interface{}{"id": "o-1", "amount": 42.0}, result.FinalStore["order"])
+	assert.NotContains(t, result.FinalStore, "draft")
+	assert.Equal(t, StatusCompleted, result.ActionStatuses[ActionStatusKey("pay", "charge")])
+
+	runs, err = wal.Runs()
+	require.NoError(t, err)
+	assert.Empty(t, runs)
+}
+
+func TestWALFinishedRunsAreRemoved(t *testing.T) {
+	registry := NewActionRegistry()
+	require.NoError(t, registry.Register("fail", func() Action {
+		return NewTestAction("fail", "", func(ctx *ActionContext) error { return errors.New("boom") })
+	}))
+
+	wf := NewWorkflow("failing", "Failing", "")
+	stage := NewStage("s", "S", "")
+	action, err := registry.Resolve("fail", nil)
+	require.NoError(t, err)
+	stage.AddAction(action)
+	wf.AddStage(stage)
+
+	wal, err := NewFileWAL(t.TempDir())
+	require.NoError(t, err)
+	result := NewRunner(WithWAL(wal)).ExecuteWithOptions(wf, DefaultRunOptions())
+	assert.False(t, result.Success)
+
+	runs, err := wal.Runs()
+	require.NoError(t, err)
+	assert.Empty(t, runs)
+}
+
+func TestWALRequiresSerializableWorkflow(t *testing.T) {
+	wal, err := NewFileWAL(t.TempDir())
+	require.NoError(t, err)
+
+	result := NewRunner(WithWAL(wal)).ExecuteWithOptions(newPoolWorkflow("adhoc", func(ctx *ActionContext) error { return nil }), DefaultRunOptions())
+	require.Error(t, result.Error)
+	assert.Contains(t, result.Error.Error(), "durable execution")
+
+	_, err = NewRunner().Recover()
+	assert.Error(t, err)
+}
+
+func TestFileWALIgnoresTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	wal, err := NewFileWAL(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, wal.Append(WALRecord{Type: WALRunStarted, RunID: "run", WorkflowID: "wf", Definition: &SubWorkflowDef{ID: "wf"}}))
+	f, err := os.OpenFile(filepath.Join(dir, "run.wal"), os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"type":"action.comp`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	records, err := wal.Read("run")
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "wf", records[0].WorkflowID)
+
+	require.NoError(t, wal.Append(WALRecord{Type: WALRunFinished, RunID: "run", WorkflowID: "wf"}))
+	records, err = wal.Read("run")
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, WALRunFinished, records[1].Type)
+}
+
+func TestResumeRunByID(t *testing.T) {
+	crash := map[string]bool{"first": true, "second": true}
+	var resumed []string
+	registry := NewActionRegistry()
+	require.NoError(t, registry.Register("finish", func() Action {
+		return NewActionFunc("finish", "", func(ctx *ActionContext) error {
+			if crash[ctx.Workflow.ID] {
+				panic("process killed")
+			}
+			resumed = append(resumed, ctx.Workflow.ID)
+			return nil
+		})
+	}))
+	newWorkflow := func(id string) *Workflow {
+		wf := NewWorkflow(id, id, "")
+		stage := NewStage("s", "S", "")
+		action, err := registry.Resolve("finish", nil)
+		require.NoError(t, err)
+		stage.AddAction(action)
+		wf.AddStage(stage)
+		return wf
+	}
+
+	wal, err := NewFileWAL(t.TempDir())
+	require.NoError(t, err)
+	var runIDs []string
+	for _, id := range []string{"first", "second"} {
+		wf := newWorkflow(id)
+		assert.Panics(t, func() {
+			NewRunner(WithWAL(wal)).ExecuteWithOptions(wf, DefaultRunOptions())
+		})
+		runIDs = append(runIDs, wf.Context[contextRunID].(string))
+	}
+
+	crash["first"] = false
+	runner := NewRunner(WithWAL(wal), WithHistory(history.NewMemoryStore()))
+	result, err := runner.ResumeWithRegistry(runIDs[0], registry)
+	require.NoError(t, err)
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, runIDs[0], result.RunID)
+	assert.Equal(t, []string{"first"}, resumed)
+
+	// The other run is left for later
+	runs, err := wal.Runs()
+	require.NoError(t, err)
+	assert.Equal(t, []string{runIDs[1]}, runs)
+
+	_, err = runner.ResumeWithRegistry(runIDs[0], registry)
+	assert.ErrorIs(t, err, ErrRunNotResumable)
+	assert.Contains(t, err.Error(), "already completed")
+
+	_, err = runner.ResumeWithRegistry("unknown", registry)
+	assert.ErrorIs(t, err, ErrRunNotResumable)
+}
@@ -0,0 +1,154 @@
+package gostage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrActionStuck is the cause of cancelling an action the watchdog found stuck.
+var ErrActionStuck = errors.New("action stuck")
+
+// WatchdogOption configures the watchdog of a runner.
+type WatchdogOption func(*watchdog)
+
+// watchdog flags the actions that neither complete nor heartbeat in time.
+type watchdog struct {
+	interval time.Duration
+	cancel   bool
+}
+
+// WithWatchdog watches every action executed by the runner. An action that
+// has neither completed nor called ActionContext.Heartbeat for interval is
+// flagged with an EventActionStuck event, published again for each further
+// interval it stays silent.
+func WithWatchdog(interval time.Duration, opts ...WatchdogOption) RunnerOption {
+	return func(r *Runner) {
+		w := &watchdog{interval: interval}
+		for _, opt := range opts {
+			opt(w)
+		}
+		r.watchdog = w
+	}
+}
+
+// WithStuckCancellation makes the watchdog cancel the GoContext of the
+// actions it flags. Actions that stop on cancellation then fail with an error
+// wrapping ErrActionStuck.
+func WithStuckCancellation() WatchdogOption {
+	return func(w *watchdog) {
+		w.cancel = true
+	}
+}
+
+// actionWatch tracks the heartbeats of an executing action.
+type actionWatch struct {
+	clock    Clock
+	mu       sync.Mutex
+	lastBeat time.Time
+}
+
+func (w *actionWatch) beat() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastBeat = w.clock.Now()
+}
+
+func (w *actionWatch) silence() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.clock.Now().Sub(w.lastBeat)
+}
+
+// Heartbeat reports that the current action is still making progress, which
+// keeps the watchdog of the runner from flagging it. Long-running actions
+// should call it regularly. It does nothing when the runner has no watchdog.
+func (ctx *ActionContext) Heartbeat() {
+	if ctx.watch != nil {
+		ctx.watch.beat()
+	}
+}
+
+// watch runs execute, the execution of the current action of ctx, under the
+// watchdog of the runner.
+func (r *Runner) watch(ctx *ActionContext, execute func() error) error {
+	if r.watchdog == nil {
+		return execute()
+	}
+
+	parent := ctx.GoContext
+	if parent == nil {
+		parent = context.Background()
+	}
+	watchCtx, cancel := context.WithCancelCause(parent)
+	defer cancel(nil)
+
+	clock := r.Clock()
+	watch := &actionWatch{clock: clock, lastBeat: clock.Now()}
+	ctx.GoContext = watchCtx
+	ctx.watch = watch
+	defer func() {
+		ctx.GoContext = parent
+		ctx.watch = nil
+	}()
+
+	// The action of ctx changes while fallbacks run, so the event is built now
+	stuck := Event{
+		Type:        EventActionStuck,
+		WorkflowID:  ctx.Workflow.ID,
+		StageID:     ctx.Stage.ID,
+		ActionName:  ctx.Action.Name(),
+		Annotations: mergedAnnotations(ctx.Workflow, ctx.Stage, ctx.Action),
+	}
+	logger := ctx.Logger
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		r.watchdog.run(watch, done, func(silence time.Duration) {
+			logger.Warn("Action %s has not reported progress for %s", stuck.ActionName, silence.Round(time.Millisecond))
+			event := stuck
+			event.Payload = map[string]interface{}{"silence": silence.String(), "interval": r.watchdog.interval.String()}
+			r.publish(ctx.Workflow, event)
+			if r.watchdog.cancel {
+				cancel(ErrActionStuck)
+			}
+		})
+	}()
+
+	err := execute()
+	close(done)
+	<-stopped
+
+	if err != nil && errors.Is(context.Cause(watchCtx), ErrActionStuck) {
+		return fmt.Errorf("%w: %w", ErrActionStuck, err)
+	}
+	return err
+}
+
+// run calls flag each time watch stays silent for an interval, until done
+// is closed or the action is cancelled.
+func (w *watchdog) run(watch *actionWatch, done <-chan struct{}, flag func(silence time.Duration)) {
+	wait := w.interval
+	for {
+		timer := watch.clock.NewTimer(wait)
+		select {
+		case <-done:
+			timer.Stop()
+			return
+		case <-timer.C():
+			silence := watch.silence()
+			if silence < w.interval {
+				wait = w.interval - silence
+				continue
+			}
+			flag(silence)
+			if w.cancel {
+				return
+			}
+			wait = w.interval
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package gostage
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// watchedRun executes action in a single-stage workflow on runner and
+// returns the result with the stuck events published during the run.
+func watchedRun(t *testing.T, runner *Runner, action Action) (RunResult, []Event) {
+	t.Helper()
+	wf := NewWorkflow("watched", "Watched", "")
+	stage := NewStage("sync", "Sync", "")
+	stage.AddAction(action)
+	wf.AddStage(stage)
+
+	var mu sync.Mutex
+	var stuck []Event
+	unsubscribe := runner.Subscribe(EventActionStuck, func(event Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		stuck = append(stuck, event)
+	})
+	defer unsubscribe()
+
+	result := runner.ExecuteWithOptions(wf, DefaultRunOptions())
+	mu.Lock()
+	defer mu.Unlock()
+	return result, stuck
+}
+
+func TestWatchdogFlagsSilentActions(t *testing.T) {
+	runner := NewRunner(WithWatchdog(20 * time.Millisecond))
+
+	result, stuck := watchedRun(t, runner, NewActionFunc("download", "", func(ctx *ActionContext) error {
+		time.Sleep(70 * time.Millisecond)
+		return nil
+	}))
+	require.True(t, result.Success, "%v", result.Error)
+	require.NotEmpty(t, stuck)
+	assert.Equal(t, "sync", stuck[0].StageID)
+	assert.Equal(t, "download", stuck[0].ActionName)
+	assert.Equal(t, "20ms", stuck[0].Payload["interval"])
+
+	result, stuck = watchedRun(t, runner, NewActionFunc("download", "", func(ctx *ActionContext) error {
+		for i := 0; i < 14; i++ {
+			time.Sleep(5 * time.Millisecond)
+			ctx.Heartbeat()
+		}
+		return nil
+	}))
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Empty(t, stuck)
+}
+
+func TestWatchdogCancelsStuckActions(t *testing.T) {
+	runner := NewRunner(WithWatchdog(20*time.Millisecond, WithStuckCancellation()))
+
+	result, stuck := watchedRun(t, runner, NewActionFunc("download", "", func(ctx *ActionContext) error {
+		<-ctx.GoContext.Done()
+		return ctx.GoContext.Err()
+	}))
+	assert.ErrorIs(t, result.Error, ErrActionStuck)
+	assert.ErrorIs(t, result.Error, context.Canceled)
+	assert.Len(t, stuck, 1)
+
+	// Heartbeats from the items of a loop keep the loop alive
+	body := NewActionFunc("chunk", "", func(ctx *ActionContext) error {
+		time.Sleep(10 * time.Millisecond)
+		ctx.Heartbeat()
+		return nil
+	})
+	loop := NewForEachAction[int]("chunks", "chunks", []Action{body})
+	wf := NewWorkflow("watched", "Watched", "")
+	stage := NewStage("sync", "Sync", "")
+	stage.AddAction(loop)
+	wf.AddStage(stage)
+	wf.Store.Put("chunks", []int{1, 2, 3, 4, 5, 6})
+	runResult := runner.ExecuteWithOptions(wf, DefaultRunOptions())
+	require.True(t, runResult.Success, "%v", runResult.Error)
+}
+
+func TestHeartbeatWithoutWatchdog(t *testing.T) {
+	result := runSingleAction(t, context.Background(), NewActionFunc("download", "", func(ctx *ActionContext) error {
+		ctx.Heartbeat()
+		return nil
+	}), nil)
+	require.True(t, result.Success, "%v", result.Error)
+}
@@ -0,0 +1,238 @@
+// Package webhook posts gostage lifecycle events to an HTTP endpoint.
+//
+// A Sink subscribes to a runner's events and delivers each one as a JSON POST,
+// optionally signed with HMAC-SHA256 and retried on failure:
+//
+//	sink := webhook.New("https://hooks.example.com/gostage",
+//		webhook.WithSecret(os.Getenv("WEBHOOK_SECRET")),
+//		webhook.WithHeader("Authorization", "Bearer "+token),
+//	)
+//	defer sink.Attach(runner)()
+//
+// By default only workflow started, completed and failed events are sent.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+)
+
+// SignatureHeader carries the HMAC-SHA256 signature of the request body,
+// formatted as "sha256=<hex>".
+const SignatureHeader = "X-Gostage-Signature"
+
+// EventHeader carries the event type of the request.
+const EventHeader = "X-Gostage-Event"
+
+// DefaultEvents are the event types delivered when WithEvents is not used.
+const DefaultEvents = gostage.EventWorkflowStarted | gostage.EventWorkflowCompleted | gostage.EventWorkflowFailed
+
+// Payload is the JSON body posted for each event.
+type Payload struct {
+	ID         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	Time       time.Time              `json:"time"`
+	WorkflowID string                 `json:"workflowId"`
+	StageID    string                 `json:"stageId,omitempty"`
+	ActionName string                 `json:"actionName,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	Payload    map[string]interface{} `json:"payload,omitempty"`
+}
+
+// Sink delivers events to a webhook URL.
+type Sink struct {
+	url        string
+	headers    map[string]string
+	secret     []byte
+	client     *http.Client
+	events     gostage.EventType
+	attempts   int
+	backoff    time.Duration
+	onError    func(event gostage.Event, err error)
+	inProgress sync.WaitGroup
+}
+
+// Option configures a Sink.
+type Option func(*Sink)
+
+// WithHeader adds a header sent with every request.
+func WithHeader(key, value string) Option {
+	return func(s *Sink) {
+		s.headers[key] = value
+	}
+}
+
+// WithSecret signs request bodies with HMAC-SHA256 using the given secret.
+func WithSecret(secret string) Option {
+	return func(s *Sink) {
+		s.secret = []byte(secret)
+	}
+}
+
+// WithHTTPClient sets the client used to deliver events.
+func WithHTTPClient(client *http.Client) Option {
+	return func(s *Sink) {
+		s.client = client
+	}
+}
+
+// WithEvents sets the event types delivered by the sink.
+func WithEvents(types gostage.EventType) Option {
+	return func(s *Sink) {
+		s.events = types
+	}
+}
+
+// WithRetry sets how many times a delivery is attempted and the delay before
+// the first retry, which doubles after every failed attempt.
+func WithRetry(attempts int, backoff time.Duration) Option {
+	return func(s *Sink) {
+		s.attempts = attempts
+		s.backoff = backoff
+	}
+}
+
+// WithErrorHandler sets a function called when an event could not be delivered.
+func WithErrorHandler(handler func(event gostage.Event, err error)) Option {
+	return func(s *Sink) {
+		s.onError = handler
+	}
+}
+
+// New creates a sink posting to url.
+func New(url string, opts ...Option) *Sink {
+	s := &Sink{
+		url:      url,
+		headers:  make(map[string]string),
+		client:   &http.Client{Timeout: 10 * time.Second},
+		events:   DefaultEvents,
+		attempts: 3,
+		backoff:  500 * time.Millisecond,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.attempts < 1 {
+		s.attempts = 1
+	}
+	return s
+}
+
+// Attach subscribes the sink to the runner's events. Deliveries happen in the
+// background so they never slow down the workflow. The returned function
+// unsubscribes the sink and waits for pending deliveries.
+func (s *Sink) Attach(runner *gostage.Runner) func() {
+	unsubscribe := runner.Subscribe(s.events, func(event gostage.Event) {
+		s.inProgress.Add(1)
+		go func() {
+			defer s.inProgress.Done()
+			if err := s.Send(context.Background(), event); err != nil && s.onError != nil {
+				s.onError(event, err)
+			}
+		}()
+	})
+
+	return func() {
+		unsubscribe()
+		s.Wait()
+	}
+}
+
+// Wait blocks until all background deliveries have finished.
+func (s *Sink) Wait() {
+	s.inProgress.Wait()
+}
+
+// Send delivers a single event, retrying on network errors, 429 and 5xx responses.
+func (s *Sink) Send(ctx context.Context, event gostage.Event) error {
+	body, err := json.Marshal(NewPayload(event))
+	if err != nil {
+		return fmt.Errorf("failed to encode event %s: %w", event.ID, err)
+	}
+
+	backoff := s.backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := s.post(ctx, event, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= s.attempts {
+			return fmt.Errorf("failed to deliver event %s after %d attempt(s): %w", event.ID, attempt, err)
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// post sends one request and reports whether a failure is worth retrying.
+func (s *Sink) post(ctx context.Context, event gostage.Event, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event.Type.String())
+	for key, value := range s.headers {
+		req.Header.Set(key, value)
+	}
+	if len(s.secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(s.secret, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+}
+
+// NewPayload converts an event to its JSON payload.
+func NewPayload(event gostage.Event) Payload {
+	payload := Payload{
+		ID:         event.ID,
+		Type:       event.Type.String(),
+		Time:       event.Time,
+		WorkflowID: event.WorkflowID,
+		StageID:    event.StageID,
+		ActionName: event.ActionName,
+		Payload:    event.Payload,
+	}
+	if event.Error != nil {
+		payload.Error = event.Error.Error()
+	}
+	return payload
+}
+
+// Sign returns the signature header value of body for the given secret.
+// Receivers verify a request by comparing it to the SignatureHeader with hmac.Equal.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
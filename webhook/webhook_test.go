@@ -0,0 +1,110 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davidroman0O/gostage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recorder struct {
+	mu       sync.Mutex
+	payloads []Payload
+	headers  []http.Header
+	bodies   [][]byte
+}
+
+func (r *recorder) handler(status func(n int) int) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		r.mu.Lock()
+		n := len(r.bodies)
+		r.bodies = append(r.bodies, body)
+		r.headers = append(r.headers, req.Header.Clone())
+		var payload Payload
+		json.Unmarshal(body, &payload)
+		r.payloads = append(r.payloads, payload)
+		r.mu.Unlock()
+
+		w.WriteHeader(status(n))
+	}
+}
+
+func ok(int) int { return http.StatusOK }
+
+func TestAttachDeliversWorkflowEvents(t *testing.T) {
+	rec := &recorder{}
+	server := httptest.NewServer(rec.handler(ok))
+	defer server.Close()
+
+	runner := gostage.NewRunner()
+	sink := New(server.URL, WithSecret("s3cret"), WithHeader("Authorization", "Bearer token"))
+	detach := sink.Attach(runner)
+
+	wf := gostage.NewWorkflow("notify", "Notify", "")
+	stage := gostage.NewStage("only", "Only", "")
+	stage.AddAction(&failingAction{BaseAction: gostage.NewBaseAction("fail", "")})
+	wf.AddStage(stage)
+	require.Error(t, runner.Execute(context.Background(), wf, nil))
+	detach()
+
+	require.Len(t, rec.payloads, 2)
+	types := []string{rec.payloads[0].Type, rec.payloads[1].Type}
+	assert.ElementsMatch(t, []string{"workflow.started", "workflow.failed"}, types)
+
+	for i, payload := range rec.payloads {
+		assert.Equal(t, "notify", payload.WorkflowID)
+		assert.NotEmpty(t, payload.ID)
+		assert.Equal(t, "Bearer token", rec.headers[i].Get("Authorization"))
+		assert.Equal(t, payload.Type, rec.headers[i].Get(EventHeader))
+		assert.Equal(t, Sign([]byte("s3cret"), rec.bodies[i]), rec.headers[i].Get(SignatureHeader))
+		if payload.Type == "workflow.failed" {
+			assert.Contains(t, payload.Error, "nope")
+		}
+	}
+}
+
+type failingAction struct{ gostage.BaseAction }
+
+func (a *failingAction) Execute(ctx *gostage.ActionContext) error {
+	return errors.New("nope")
+}
+
+func TestSendRetries(t *testing.T) {
+	rec := &recorder{}
+	server := httptest.NewServer(rec.handler(func(n int) int {
+		if n < 2 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	}))
+	defer server.Close()
+
+	sink := New(server.URL, WithRetry(3, time.Millisecond))
+	event := gostage.Event{ID: "evt", Type: gostage.EventWorkflowCompleted, WorkflowID: "wf"}
+	require.NoError(t, sink.Send(context.Background(), event))
+	assert.Len(t, rec.bodies, 3)
+}
+
+func TestSendDoesNotRetryClientErrors(t *testing.T) {
+	rec := &recorder{}
+	server := httptest.NewServer(rec.handler(func(int) int { return http.StatusBadRequest }))
+	defer server.Close()
+
+	sink := New(server.URL, WithRetry(5, time.Millisecond))
+
+	err := sink.Send(context.Background(), gostage.Event{ID: "evt", Type: gostage.EventWorkflowStarted})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "status 400")
+	assert.Len(t, rec.bodies, 1)
+}
@@ -2,7 +2,9 @@ package gostage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/davidroman0O/gostage/store"
@@ -27,6 +29,8 @@ type Workflow struct {
 	Name string
 	// Description provides details about the workflow's purpose
 	Description string
+	// Version identifies the revision of the workflow definition
+	Version string
 	// Tags for organization and filtering
 	Tags []string
 
@@ -44,6 +48,25 @@ type Workflow struct {
 
 	// middleware contains workflow-level middleware that wraps stage execution
 	middleware []WorkflowMiddleware
+
+	// params contains the declared workflow parameters
+	params []Param
+
+	// bindings maps environment variables and flags to store keys
+	bindings []Binding
+
+	// strategy decides how the stages are run
+	strategy ExecutionStrategy
+
+	// services holds the services provided to the actions of the workflow, if any
+	services *serviceRegistry
+
+	// annotations holds arbitrary key/value metadata set with SetAnnotation
+	annotations map[string]string
+
+	// deadline and maxDuration bound the runs of the workflow
+	deadline    time.Time
+	maxDuration time.Duration
 }
 
 // WorkflowInfo holds serializable workflow information.
@@ -53,6 +76,7 @@ type WorkflowInfo struct {
 	ID          string   `json:"id"`
 	Name        string   `json:"name"`
 	Description string   `json:"description"`
+	Version     string   `json:"version,omitempty"`
 	Tags        []string `json:"tags"`
 	StageIDs    []string `json:"stageIds"`
 	CreatedAt   string   `json:"createdAt"`
@@ -99,6 +123,7 @@ func (w *Workflow) saveToStore() {
 		ID:          w.ID,
 		Name:        w.Name,
 		Description: w.Description,
+		Version:     w.Version,
 		Tags:        w.Tags,
 		StageIDs:    w.getStageIDs(),
 		CreatedAt:   time.Now().Format(time.RFC3339),
@@ -193,24 +218,164 @@ func (w *Workflow) HasAnyTag(tags []string) bool {
 func (w *Workflow) AddStage(stage *Stage) {
 	// Add to traditional Stages slice
 	w.Stages = append(w.Stages, stage)
+	w.storeStage(stage, len(w.Stages)-1)
+
+	// Update workflow info in the store
+	w.saveToStore()
+}
 
-	// Store the stage in the KV store
+// storeStage stores the stage info in the KV store at the given position.
+func (w *Workflow) storeStage(stage *Stage, order int) {
 	stageKey := PrefixStage + stage.ID
 	stageInfo := stage.toStageInfo()
 
 	meta := store.NewMetadata()
 	meta.Tags = append(meta.Tags, stage.Tags...)
 	meta.Description = stage.Description
-	meta.SetProperty(PropOrder, len(w.Stages)-1)
+	meta.SetProperty(PropOrder, order)
 	meta.SetProperty(PropStatus, StatusPending)
 	meta.SetProperty(PropCreatedBy, "workflow:"+w.ID)
 
 	w.Store.PutWithMetadata(stageKey, stageInfo, meta)
+}
 
-	// Update workflow info in the store
+// stageIndex returns the position of the stage with the given ID, or an error
+// if the workflow has no such stage.
+func (w *Workflow) stageIndex(stageID string) (int, error) {
+	for i, stage := range w.Stages {
+		if stage.ID == stageID {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("stage '%s' not found in workflow '%s'", stageID, w.ID)
+}
+
+// checkNewStage validates a stage about to be added to the workflow. The stage
+// with the ID replaced, if any, is allowed to share the ID of the new stage.
+func (w *Workflow) checkNewStage(stage *Stage, replaced string) error {
+	if stage == nil {
+		return errors.New("stage is nil")
+	}
+	if stage.ID == "" {
+		return errors.New("stage has no ID")
+	}
+	if stage.ID != replaced {
+		if _, err := w.stageIndex(stage.ID); err == nil {
+			return fmt.Errorf("stage '%s' already exists in workflow '%s'", stage.ID, w.ID)
+		}
+	}
+	return nil
+}
+
+// insertStage inserts a validated stage at index and updates the store.
+func (w *Workflow) insertStage(index int, stage *Stage) {
+	w.Stages = append(w.Stages, nil)
+	copy(w.Stages[index+1:], w.Stages[index:])
+	w.Stages[index] = stage
+	w.storeStage(stage, index)
+	w.reorderStages()
+}
+
+// reorderStages updates the order of every stage in the store after the
+// stages were edited.
+func (w *Workflow) reorderStages() {
+	for i, stage := range w.Stages {
+		w.Store.SetProperty(PrefixStage+stage.ID, PropOrder, i)
+	}
 	w.saveToStore()
 }
 
+// InsertStageBefore inserts stage right before the stage with the given ID.
+// It fails if there is no such stage or if the workflow already has a stage
+// with the ID of the new one.
+func (w *Workflow) InsertStageBefore(stageID string, stage *Stage) error {
+	index, err := w.stageIndex(stageID)
+	if err != nil {
+		return err
+	}
+	if err := w.checkNewStage(stage, ""); err != nil {
+		return err
+	}
+	w.insertStage(index, stage)
+	return nil
+}
+
+// InsertStageAfter inserts stage right after the stage with the given ID.
+// It fails like InsertStageBefore.
+func (w *Workflow) InsertStageAfter(stageID string, stage *Stage) error {
+	index, err := w.stageIndex(stageID)
+	if err != nil {
+		return err
+	}
+	if err := w.checkNewStage(stage, ""); err != nil {
+		return err
+	}
+	w.insertStage(index+1, stage)
+	return nil
+}
+
+// RemoveStage removes the stage with the given ID from the workflow and the
+// store, along with the metadata of its actions.
+func (w *Workflow) RemoveStage(stageID string) error {
+	index, err := w.stageIndex(stageID)
+	if err != nil {
+		return err
+	}
+	w.Stages = append(w.Stages[:index], w.Stages[index+1:]...)
+	w.forgetStage(stageID)
+	w.reorderStages()
+	return nil
+}
+
+// forgetStage deletes the stage and its actions from the store.
+func (w *Workflow) forgetStage(stageID string) {
+	w.Store.Delete(PrefixStage + stageID)
+	actionPrefix := PrefixAction + stageID + ":"
+	for _, key := range w.Store.ListKeys() {
+		if strings.HasPrefix(key, actionPrefix) {
+			w.Store.Delete(key)
+		}
+	}
+}
+
+// ReplaceStage replaces the stage with the given ID by stage, at the same
+// position. The new stage may keep the ID of the replaced one, but must not
+// take the ID of another stage of the workflow.
+func (w *Workflow) ReplaceStage(stageID string, stage *Stage) error {
+	index, err := w.stageIndex(stageID)
+	if err != nil {
+		return err
+	}
+	if err := w.checkNewStage(stage, stageID); err != nil {
+		return err
+	}
+	w.forgetStage(stageID)
+	w.Stages[index] = stage
+	w.storeStage(stage, index)
+	w.saveToStore()
+	return nil
+}
+
+// MoveStage moves the stage with the given ID to index, shifting the stages
+// in between. The index is the position of the stage once moved and must be
+// between 0 and the number of stages minus one.
+func (w *Workflow) MoveStage(stageID string, index int) error {
+	from, err := w.stageIndex(stageID)
+	if err != nil {
+		return err
+	}
+	if index < 0 || index >= len(w.Stages) {
+		return fmt.Errorf("stage index %d out of range [0, %d)", index, len(w.Stages))
+	}
+	stage := w.Stages[from]
+	w.Stages = append(w.Stages[:from], w.Stages[from+1:]...)
+	w.Stages = append(w.Stages, nil)
+	copy(w.Stages[index+1:], w.Stages[index:])
+	w.Stages[index] = stage
+	w.reorderStages()
+	return nil
+}
+
 // GetStage retrieves a stage by ID from the KV store
 func (w *Workflow) GetStage(stageID string) (*Stage, error) {
 	// First try to find in the Stages slice for efficiency
@@ -338,6 +503,34 @@ func (w *Workflow) IsStageEnabled(stageID string) bool {
 	return !disabledStages[stageID]
 }
 
+// DisableAction disables an action by name across all stages
+func (w *Workflow) DisableAction(actionName string) {
+	disabledActions, ok := w.Context["disabledActions"].(map[string]bool)
+	if !ok {
+		disabledActions = make(map[string]bool)
+		w.Context["disabledActions"] = disabledActions
+	}
+	disabledActions[actionName] = true
+}
+
+// EnableAction enables an action by name
+func (w *Workflow) EnableAction(actionName string) {
+	disabledActions, ok := w.Context["disabledActions"].(map[string]bool)
+	if !ok {
+		return
+	}
+	delete(disabledActions, actionName)
+}
+
+// IsActionEnabled checks if an action is enabled
+func (w *Workflow) IsActionEnabled(actionName string) bool {
+	disabledActions, ok := w.Context["disabledActions"].(map[string]bool)
+	if !ok {
+		return true
+	}
+	return !disabledActions[actionName]
+}
+
 // ListStagesByTag returns all stages with a specific tag
 func (w *Workflow) ListStagesByTag(tag string) []*Stage {
 	var result []*Stage
@@ -0,0 +1,174 @@
+package gostage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrWorkflowNotFound is returned when no workflow is registered under a name.
+var ErrWorkflowNotFound = errors.New("workflow not found")
+
+// WorkflowBuilder creates a fresh workflow instance for a run.
+type WorkflowBuilder func() (*Workflow, error)
+
+// WorkflowRegistry maps workflow names to the builders that create them, so
+// that the HTTP API, schedules and triggers can start workflows by name.
+type WorkflowRegistry struct {
+	mu       sync.RWMutex
+	builders map[string]WorkflowBuilder
+}
+
+// NewWorkflowRegistry creates an empty workflow registry.
+func NewWorkflowRegistry() *WorkflowRegistry {
+	return &WorkflowRegistry{
+		builders: make(map[string]WorkflowBuilder),
+	}
+}
+
+var defaultWorkflowRegistry = NewWorkflowRegistry()
+
+// DefaultWorkflowRegistry returns the process-wide registry used by RegisterWorkflow.
+func DefaultWorkflowRegistry() *WorkflowRegistry {
+	return defaultWorkflowRegistry
+}
+
+// Register adds a builder under name.
+// It returns an error if a workflow with the same name is already registered.
+func (r *WorkflowRegistry) Register(name string, builder WorkflowBuilder) error {
+	if name == "" {
+		return fmt.Errorf("workflow name cannot be empty")
+	}
+	if builder == nil {
+		return fmt.Errorf("builder of workflow '%s' is nil", name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.builders[name]; exists {
+		return fmt.Errorf("workflow '%s' is already registered", name)
+	}
+	r.builders[name] = builder
+	return nil
+}
+
+// RegisterDef adds a serialized workflow definition under its ID. Actions are
+// resolved through actions, or the default action registry if nil.
+func (r *WorkflowRegistry) RegisterDef(def *SubWorkflowDef, actions *ActionRegistry) error {
+	return r.Register(def.ID, func() (*Workflow, error) {
+		return NewWorkflowFromDefWithRegistry(def, actions)
+	})
+}
+
+// Build creates the workflow registered under name and instantiates it with
+// params, which must match the parameters the workflow declares.
+func (r *WorkflowRegistry) Build(name string, params map[string]interface{}) (*Workflow, error) {
+	builder, ok := r.Builder(name)
+	if !ok {
+		return nil, fmt.Errorf("workflow '%s': %w", name, ErrWorkflowNotFound)
+	}
+
+	wf, err := builder()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build workflow '%s': %w", name, err)
+	}
+	if wf == nil {
+		return nil, fmt.Errorf("builder of workflow '%s' returned nil", name)
+	}
+	if err := wf.Instantiate(params); err != nil {
+		return nil, err
+	}
+	return wf, nil
+}
+
+// Factory returns a function building the workflow registered under name with
+// params, which can be passed wherever a workflow factory is expected, such as
+// to scheduler.Cron, messaging.Triggers.On or httpapi.Handler.Register.
+func (r *WorkflowRegistry) Factory(name string, params map[string]interface{}) func() (*Workflow, error) {
+	return func() (*Workflow, error) {
+		return r.Build(name, params)
+	}
+}
+
+// Builder returns the builder registered under name, which creates the
+// workflow without instantiating its parameters.
+func (r *WorkflowRegistry) Builder(name string) (WorkflowBuilder, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	builder, ok := r.builders[name]
+	return builder, ok
+}
+
+// Has checks if a workflow name is registered.
+func (r *WorkflowRegistry) Has(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.builders[name]
+	return ok
+}
+
+// Names returns the registered workflow names in sorted order.
+func (r *WorkflowRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.builders))
+	for name := range r.builders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RegisterWorkflow registers a workflow builder under a unique name in the
+// default registry.
+// It will panic if a workflow with the same name is already registered.
+func RegisterWorkflow(name string, builder WorkflowBuilder) {
+	if err := defaultWorkflowRegistry.Register(name, builder); err != nil {
+		panic(err.Error())
+	}
+}
+
+// WithWorkflowRegistry makes the runner look up the workflows of ExecuteByName
+// and SubmitByName in registry instead of the default registry.
+func WithWorkflowRegistry(registry *WorkflowRegistry) RunnerOption {
+	return func(r *Runner) {
+		r.workflows = registry
+	}
+}
+
+// Workflows returns the registry the runner looks up named workflows in.
+func (r *Runner) Workflows() *WorkflowRegistry {
+	if r.workflows == nil {
+		return defaultWorkflowRegistry
+	}
+	return r.workflows
+}
+
+// ExecuteByName builds the workflow registered under name with params and
+// executes it with the runner's default options and ctx. A workflow that
+// cannot be built is reported in the error of the result, which wraps
+// ErrWorkflowNotFound when the name is not registered.
+func (r *Runner) ExecuteByName(ctx context.Context, name string, params map[string]interface{}) RunResult {
+	wf, err := r.Workflows().Build(name, params)
+	if err != nil {
+		return RunResult{WorkflowID: name, Error: err}
+	}
+
+	options := r.options
+	options.Context = ctx
+	return r.ExecuteWithOptions(wf, options)
+}
+
+// SubmitByName builds the workflow registered under name with params and
+// queues it on the runner's worker pool like Submit.
+func (r *Runner) SubmitByName(name string, params map[string]interface{}, opts ...SubmitOption) (*Job, error) {
+	wf, err := r.Workflows().Build(name, params)
+	if err != nil {
+		return nil, err
+	}
+	return r.Submit(wf, opts...)
+}
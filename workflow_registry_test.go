@@ -0,0 +1,93 @@
+package gostage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/davidroman0O/gostage/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCleanupBuilder returns a builder of a workflow purging the files older
+// than its "days" parameter.
+func newCleanupBuilder() WorkflowBuilder {
+	return func() (*Workflow, error) {
+		wf := NewWorkflow("cleanup", "Cleanup", "")
+		wf.AddParam("days", Default(7))
+		stage := NewStage("purge", "Purge", "")
+		stage.AddAction(NewActionFunc("purge", "", func(ctx *ActionContext) error {
+			days, err := store.Get[int](ctx.Store(), "days")
+			if err != nil {
+				return err
+			}
+			return ctx.Store().Put("purged.before", days)
+		}))
+		wf.AddStage(stage)
+		return wf, nil
+	}
+}
+
+func TestWorkflowRegistry(t *testing.T) {
+	registry := NewWorkflowRegistry()
+	require.NoError(t, registry.Register("nightly-cleanup", newCleanupBuilder()))
+	require.NoError(t, registry.Register("archive", newCleanupBuilder()))
+
+	assert.ErrorContains(t, registry.Register("archive", newCleanupBuilder()), "already registered")
+	assert.Error(t, registry.Register("", newCleanupBuilder()))
+	assert.Error(t, registry.Register("nil", nil))
+
+	assert.True(t, registry.Has("nightly-cleanup"))
+	assert.False(t, registry.Has("missing"))
+	assert.Equal(t, []string{"archive", "nightly-cleanup"}, registry.Names())
+
+	// Every build is a fresh instance with its parameters applied
+	first, err := registry.Build("nightly-cleanup", map[string]interface{}{"days": 30})
+	require.NoError(t, err)
+	second, err := registry.Build("nightly-cleanup", nil)
+	require.NoError(t, err)
+	assert.NotSame(t, first, second)
+	days, err := store.Get[int](second.Store, "days")
+	require.NoError(t, err)
+	assert.Equal(t, 7, days)
+
+	_, err = registry.Build("nightly-cleanup", map[string]interface{}{"weeks": 1})
+	assert.ErrorContains(t, err, "no parameters named: weeks")
+	_, err = registry.Build("missing", nil)
+	assert.ErrorIs(t, err, ErrWorkflowNotFound)
+}
+
+func TestRunnerExecuteByName(t *testing.T) {
+	registry := NewWorkflowRegistry()
+	require.NoError(t, registry.Register("nightly-cleanup", newCleanupBuilder()))
+	runner := NewRunner(WithWorkflowRegistry(registry))
+
+	result := runner.ExecuteByName(context.Background(), "nightly-cleanup", map[string]interface{}{"days": 30})
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, "cleanup", result.WorkflowID)
+	assert.Equal(t, 30, result.FinalStore["purged.before"])
+
+	result = runner.ExecuteByName(context.Background(), "missing", nil)
+	assert.False(t, result.Success)
+	assert.ErrorIs(t, result.Error, ErrWorkflowNotFound)
+
+	job, err := runner.SubmitByName("nightly-cleanup", nil)
+	require.NoError(t, err)
+	result = job.Wait()
+	require.True(t, result.Success, "%v", result.Error)
+	assert.Equal(t, 7, result.FinalStore["purged.before"])
+
+	// Factories build the workflow for schedulers and triggers
+	wf, err := registry.Factory("nightly-cleanup", map[string]interface{}{"days": 1})()
+	require.NoError(t, err)
+	assert.Equal(t, "cleanup", wf.ID)
+}
+
+func TestRegisterWorkflowUsesTheDefaultRegistry(t *testing.T) {
+	RegisterWorkflow("test-default-cleanup", newCleanupBuilder())
+	assert.True(t, DefaultWorkflowRegistry().Has("test-default-cleanup"))
+	assert.Panics(t, func() { RegisterWorkflow("test-default-cleanup", newCleanupBuilder()) })
+
+	result := NewRunner().ExecuteByName(context.Background(), "test-default-cleanup", nil)
+	require.True(t, result.Success, "%v", result.Error)
+}
@@ -30,6 +30,10 @@ func (l *TestLogger) Error(format string, args ...interface{}) {
 	l.t.Logf("[ERROR] "+format, args...)
 }
 
+func (l *TestLogger) With(args ...interface{}) FieldLogger {
+	return LoggerWith(&fieldLogger{logger: l}, args...)
+}
+
 // TestAction is a simple action implementation for testing
 type TestAction struct {
 	BaseAction
@@ -353,3 +357,54 @@ func TestWorkflowWithStage(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "action-value", val)
 }
+
+func TestWorkflowStageEditing(t *testing.T) {
+	workflow := NewWorkflow("edit", "Edit", "")
+	for _, id := range []string{"build", "test", "deploy"} {
+		workflow.AddStage(NewStage(id, id, ""))
+	}
+	stageIDs := func() []string { return workflow.getStageIDs() }
+	order := func(id string) interface{} {
+		value, err := workflow.Store.GetProperty(PrefixStage+id, PropOrder)
+		assert.NoError(t, err)
+		return value
+	}
+
+	assert.NoError(t, workflow.InsertStageBefore("build", NewStage("checkout", "Checkout", "")))
+	assert.NoError(t, workflow.InsertStageAfter("test", NewStage("package", "Package", "")))
+	assert.Equal(t, []string{"checkout", "build", "test", "package", "deploy"}, stageIDs())
+	assert.Equal(t, 3, order("package"))
+	assert.Equal(t, 4, order("deploy"))
+
+	assert.NoError(t, workflow.MoveStage("deploy", 0))
+	assert.Equal(t, []string{"deploy", "checkout", "build", "test", "package"}, stageIDs())
+	assert.NoError(t, workflow.MoveStage("deploy", 4))
+	assert.Equal(t, []string{"checkout", "build", "test", "package", "deploy"}, stageIDs())
+	assert.Equal(t, 0, order("checkout"))
+
+	assert.NoError(t, workflow.RemoveStage("package"))
+	assert.Equal(t, []string{"checkout", "build", "test", "deploy"}, stageIDs())
+	_, err := workflow.GetStage("package")
+	assert.Error(t, err)
+
+	replacement := NewStage("test", "Integration tests", "")
+	assert.NoError(t, workflow.ReplaceStage("test", replacement))
+	stage, err := workflow.GetStage("test")
+	assert.NoError(t, err)
+	assert.Same(t, replacement, stage)
+	assert.NoError(t, workflow.ReplaceStage("test", NewStage("e2e", "E2E", "")))
+	assert.Equal(t, []string{"checkout", "build", "e2e", "deploy"}, stageIDs())
+
+	info, err := store.Get[WorkflowInfo](workflow.Store, PrefixWorkflow+workflow.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, stageIDs(), info.StageIDs)
+
+	assert.ErrorContains(t, workflow.InsertStageBefore("missing", NewStage("x", "X", "")), "stage 'missing' not found in workflow 'edit'")
+	assert.ErrorContains(t, workflow.InsertStageAfter("build", NewStage("deploy", "Deploy", "")), "stage 'deploy' already exists")
+	assert.ErrorContains(t, workflow.ReplaceStage("build", NewStage("deploy", "Deploy", "")), "stage 'deploy' already exists")
+	assert.ErrorContains(t, workflow.InsertStageAfter("build", nil), "stage is nil")
+	assert.ErrorContains(t, workflow.InsertStageAfter("build", NewStage("", "", "")), "stage has no ID")
+	assert.ErrorContains(t, workflow.MoveStage("build", 4), "stage index 4 out of range [0, 4)")
+	assert.ErrorContains(t, workflow.RemoveStage("package"), "not found")
+	assert.Equal(t, []string{"checkout", "build", "e2e", "deploy"}, stageIDs())
+}